@@ -0,0 +1,63 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/spf13/cobra"
+)
+
+// adminCmd groups the commands to administer a provisioner service.
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer the provisioner",
+	Long:  `Administer the executor of a provisioner service`,
+}
+
+// adminStatusCmd with the command to show the state of the executor.
+var adminStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the executor",
+	Long:  `Show the mode of the executor and the number of queued and running operations`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIAdmin(provisionerAddress).Status()
+		ExitOnError(err, "cannot retrieve the executor status")
+	},
+}
+
+// adminModeCmd with the command to change the mode of the executor.
+var adminModeCmd = &cobra.Command{
+	Use:   "mode [active|paused|draining]",
+	Short: "Change the mode of the executor",
+	Long: `Change the mode of the executor. Paused executors keep the new operations queued, and draining executors
+reject new operations while finishing the queued ones`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIAdmin(provisionerAddress).SetMode(args[0])
+		ExitOnError(err, "cannot change the executor mode")
+	},
+}
+
+func init() {
+	adminCmd.PersistentFlags().StringVar(&provisionerAddress, "provisionerAddress", "localhost:8930",
+		"Address of the provisioner gRPC API")
+	adminCmd.AddCommand(adminStatusCmd)
+	adminCmd.AddCommand(adminModeCmd)
+	rootCmd.AddCommand(adminCmd)
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/spf13/cobra"
+)
+
+var provisionerAddress string
+var cancelOperationType string
+
+// cancelCmd with the command to cancel an operation being executed by a provisioner service.
+var cancelCmd = &cobra.Command{
+	Use:   "cancel [requestID]",
+	Short: "Cancel an operation",
+	Long:  `Cancel an ongoing operation on a provisioner service. Cancelled operations stop at the next step boundary`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		TriggerCancel(args[0])
+	},
+}
+
+// TriggerCancel requests the cancellation of an operation to the provisioner service.
+func TriggerCancel(requestID string) {
+	cliCancel := provisioner_cli.NewCLICancel(provisionerAddress, cancelOperationType, requestID)
+	err := cliCancel.Run()
+	ExitOnError(err, "cancel failed")
+}
+
+func init() {
+	cancelCmd.Flags().StringVar(&provisionerAddress, "provisionerAddress", "localhost:8930",
+		"Address of the provisioner gRPC API")
+	cancelCmd.Flags().StringVar(&cancelOperationType, "type", "provision",
+		"Type of the operation to cancel: provision, scale or decommission")
+	rootCmd.AddCommand(cancelCmd)
+}
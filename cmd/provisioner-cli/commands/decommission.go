@@ -22,6 +22,7 @@ import (
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
@@ -68,6 +69,8 @@ func ConfigureDecommission() {
 		}
 		decommissionRequest.AzureOptions = &azureOptions
 	}
+	// Selecting the fake platform enables the fake provider for the local execution.
+	cfg.EnableFakeProvider = targetPlatform == fake.Platform.ToGRPC()
 	cfg.LaunchService = false
 }
 
@@ -82,7 +85,9 @@ func init() {
 	decommissionCmd.Flags().StringVar(&decommissionRequest.ClusterId, "name", "",
 		"Name of the cluster for management cluster requests")
 	decommissionCmd.Flags().StringVar(&targetPlatform, "platform", "",
-		"Target plaftorm determining the provider: AZURE or BAREMETAL")
+		"Target plaftorm determining the provider: AZURE, BAREMETAL or FAKE")
+	addFakeProviderFlags(decommissionCmd)
+	addBareMetalFlags(decommissionCmd)
 	decommissionCmd.Flags().StringVar(&azureCredentialsPath, "azureCredentialsPath", "",
 		"Path to the file containing the azure credentials")
 	decommissionCmd.Flags().StringVar(&azureOptions.ResourceGroup, "resourceGroup", "",
@@ -23,6 +23,7 @@ import (
 	grpc_installer_go "github.com/nalej/grpc-installer-go"
 	grpc_provisioner_go "github.com/nalej/grpc-provisioner-go"
 	provisioner_cli "github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/nalej/provisioner/internal/pkg/entities"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
@@ -100,6 +101,8 @@ func ConfigureClusterRequest(clusterID string) {
 		}
 		clusterRequest.AzureOptions = &azureOptions
 	}
+	// Selecting the fake platform enables the fake provider for the local execution.
+	cfg.EnableFakeProvider = targetPlatform == fake.Platform.ToGRPC()
 	cfg.LaunchService = false
 
 }
@@ -113,7 +116,9 @@ func TriggerGetKubeConfig() {
 
 func init() {
 	getKubeConfigCmd.Flags().StringVar(&targetPlatform, "platform", "",
-		"Target plaftorm determining the provider: AZURE or BAREMETAL")
+		"Target plaftorm determining the provider: AZURE, BAREMETAL or FAKE")
+	addFakeProviderFlags(getKubeConfigCmd)
+	addBareMetalFlags(getKubeConfigCmd)
 	getKubeConfigCmd.Flags().StringVar(&azureOptions.ResourceGroup, "resourceGroup", "",
 		"Target resource group where the cluster will be created. Only for Azure platform.")
 	getKubeConfigCmd.Flags().StringVar(&azureCredentialsPath, "azureCredentialsPath", "",
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/spf13/cobra"
+)
+
+var operationsFilter entities.OperationFilter
+var operationsType string
+var operationsProgress string
+var operationsFrom string
+var operationsTo string
+
+// operationsCmd groups the commands to query the operations of a provisioner service.
+var operationsCmd = &cobra.Command{
+	Use:   "operations",
+	Short: "Query the operations",
+	Long:  `Query the operations known by a provisioner service`,
+}
+
+// listOperationsCmd with the command to list the operations of a provisioner service.
+var listOperationsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the operations",
+	Long:  `List the ongoing and finished operations of a provisioner service`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		TriggerListOperations()
+	},
+}
+
+// TriggerListOperations requests the list of operations to the provisioner service.
+func TriggerListOperations() {
+	err := ConfigureOperationsFilter()
+	ExitOnError(err, "invalid filter")
+	cliOperations := provisioner_cli.NewCLIOperations(provisionerAddress, operationsFilter)
+	err = cliOperations.List()
+	ExitOnError(err, "cannot list operations")
+}
+
+// ConfigureOperationsFilter completes the filter with the values that require parsing.
+func ConfigureOperationsFilter() derrors.Error {
+	if operationsType != "" {
+		operationType, err := entities.OperationTypeFromString(operationsType)
+		if err != nil {
+			return err
+		}
+		operationsFilter.Type = &operationType
+	}
+	if operationsProgress != "" {
+		progress, err := entities.TaskProgressFromString(operationsProgress)
+		if err != nil {
+			return err
+		}
+		operationsFilter.Progress = &progress
+	}
+	from, err := parseTimestamp(operationsFrom)
+	if err != nil {
+		return err
+	}
+	operationsFilter.From = from
+	to, err := parseTimestamp(operationsTo)
+	if err != nil {
+		return err
+	}
+	operationsFilter.To = to
+	return nil
+}
+
+// parseTimestamp parses an RFC3339 time. An empty value is translated into 0.
+func parseTimestamp(value string) (int64, derrors.Error) {
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, derrors.NewInvalidArgumentError("time must follow the RFC3339 format", err).WithParams(value)
+	}
+	return parsed.Unix(), nil
+}
+
+func init() {
+	listOperationsCmd.Flags().StringVar(&provisionerAddress, "provisionerAddress", "localhost:8930",
+		"Address of the provisioner gRPC API")
+	listOperationsCmd.Flags().StringVar(&operationsFilter.OrganizationID, "organizationId", "",
+		"Organization of the operations")
+	listOperationsCmd.Flags().StringVar(&operationsFilter.ClusterID, "clusterId", "",
+		"Cluster identifier or name targeted by the operations")
+	listOperationsCmd.Flags().StringVar(&operationsType, "type", "",
+		"Type of the operations: provision, scale, decommission or management")
+	listOperationsCmd.Flags().StringVar(&operationsProgress, "progress", "",
+		"Progress of the operations: init, registered, inprogress, error, finished, interrupted or cancelled")
+	listOperationsCmd.Flags().StringVar(&operationsFrom, "from", "",
+		"Only operations registered after this RFC3339 time")
+	listOperationsCmd.Flags().StringVar(&operationsTo, "to", "",
+		"Only operations registered before this RFC3339 time")
+	listOperationsCmd.Flags().IntVar(&operationsFilter.Offset, "offset", 0,
+		"Number of operations to skip")
+	listOperationsCmd.Flags().IntVar(&operationsFilter.Limit, "limit", entities.DefaultListLimit,
+		"Maximum number of operations to list")
+	operationsCmd.AddCommand(listOperationsCmd)
+	rootCmd.AddCommand(operationsCmd)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/spf13/cobra"
+)
+
+// profilePath with the path of the JSON file describing a credentials profile.
+var profilePath string
+
+// profilesCmd groups the commands to manage the credentials profiles.
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "Manage the credentials profiles",
+	Long:  `Manage the credentials profiles used by the provisioner to access the infrastructure providers`,
+}
+
+// profilesListCmd with the command to list the profiles.
+var profilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the credentials profiles",
+	Long:  `List the credentials profiles available on the provisioner`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).List()
+		ExitOnError(err, "cannot list the credentials profiles")
+	},
+}
+
+// profilesGetCmd with the command to show a profile.
+var profilesGetCmd = &cobra.Command{
+	Use:   "get [profileID]",
+	Short: "Show a credentials profile",
+	Long:  `Show a credentials profile, secrets are never returned by the provisioner`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).Get(args[0])
+		ExitOnError(err, "cannot retrieve the credentials profile")
+	},
+}
+
+// profilesAddCmd with the command to create a profile.
+var profilesAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Create a credentials profile",
+	Long:  `Create a credentials profile from a JSON file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).Add(profilePath)
+		ExitOnError(err, "cannot create the credentials profile")
+	},
+}
+
+// profilesUpdateCmd with the command to replace a profile.
+var profilesUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update a credentials profile",
+	Long:  `Replace a credentials profile with the content of a JSON file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).Update(profilePath)
+		ExitOnError(err, "cannot update the credentials profile")
+	},
+}
+
+// profilesRemoveCmd with the command to delete a profile.
+var profilesRemoveCmd = &cobra.Command{
+	Use:   "remove [profileID]",
+	Short: "Remove a credentials profile",
+	Long:  `Remove a credentials profile, profiles loaded from Kubernetes secrets cannot be removed`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).Remove(args[0])
+		ExitOnError(err, "cannot remove the credentials profile")
+	},
+}
+
+// profilesValidateCmd with the command to check a profile.
+var profilesValidateCmd = &cobra.Command{
+	Use:   "validate [profileID]",
+	Short: "Validate a credentials profile",
+	Long:  `Check that the credentials of a profile are accepted by its platform`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		err := provisioner_cli.NewCLIProfiles(provisionerAddress).Validate(args[0])
+		ExitOnError(err, "credentials profile validation failed")
+	},
+}
+
+func init() {
+	profilesCmd.PersistentFlags().StringVar(&provisionerAddress, "provisionerAddress", "localhost:8930",
+		"Address of the provisioner gRPC API")
+	for _, command := range []*cobra.Command{profilesAddCmd, profilesUpdateCmd} {
+		command.Flags().StringVar(&profilePath, "file", "", "JSON file with the credentials profile")
+		_ = command.MarkFlagRequired("file")
+	}
+	profilesCmd.AddCommand(profilesListCmd)
+	profilesCmd.AddCommand(profilesGetCmd)
+	profilesCmd.AddCommand(profilesAddCmd)
+	profilesCmd.AddCommand(profilesUpdateCmd)
+	profilesCmd.AddCommand(profilesRemoveCmd)
+	profilesCmd.AddCommand(profilesValidateCmd)
+	rootCmd.AddCommand(profilesCmd)
+}
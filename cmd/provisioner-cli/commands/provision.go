@@ -22,6 +22,7 @@ import (
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
@@ -91,6 +92,8 @@ func ConfigureProvisioning() {
 		}
 		provisionRequest.AzureOptions = &azureOptions
 	}
+	// Selecting the fake platform enables the fake provider for the local execution.
+	cfg.EnableFakeProvider = targetPlatform == fake.Platform.ToGRPC()
 	cfg.LaunchService = false
 }
 
@@ -112,7 +115,9 @@ func init() {
 	provisionCmd.Flags().StringVar(&azureOptions.DnsZoneName, "dnsZoneName", "",
 		"Name of the DNS zone where the entries will be added.")
 	provisionCmd.Flags().StringVar(&targetPlatform, "platform", "",
-		"Target plaftorm determining the provider: AZURE or BAREMETAL")
+		"Target plaftorm determining the provider: AZURE, BAREMETAL or FAKE")
+	addFakeProviderFlags(provisionCmd)
+	addBareMetalFlags(provisionCmd)
 	provisionCmd.Flags().BoolVar(&provisionRequest.IsProduction, "isProduction", false,
 		"Whether the provisioning if for a production cluster")
 	_ = provisionCmd.MarkFlagRequired("platform")
@@ -124,5 +129,7 @@ func init() {
 		"Directory to store temporal files")
 	provisionCmd.Flags().StringVar(&cfg.ResourcesPath, "resourcesPath", "./resources/",
 		"Directory with the provisioner resources files")
+	provisionCmd.Flags().BoolVar(&cfg.RollbackOnFailure, "rollbackOnFailure", false,
+		"Release the resources created if the provisioning fails")
 	rootCmd.AddCommand(provisionCmd)
 }
@@ -17,12 +17,15 @@
 package commands
 
 import (
+	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/pkg/redact"
 	"github.com/nalej/provisioner/version"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -44,6 +47,16 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&debugLevel, "debug", false, "Set debug level")
 	rootCmd.PersistentFlags().BoolVar(&consoleLogging, "consoleLogging", false, "Pretty print logging")
+	rootCmd.PersistentFlags().BoolVar(&provisioner_cli.ConnectionTLS.Enabled, "tls", false,
+		"Connect to the provisioner gRPC API using TLS")
+	rootCmd.PersistentFlags().StringVar(&provisioner_cli.ConnectionTLS.CAPath, "tlsCAPath", "",
+		"CA used to verify the provisioner certificate. If empty, the system roots are used")
+	rootCmd.PersistentFlags().StringVar(&provisioner_cli.ConnectionTLS.CertPath, "tlsCertPath", "",
+		"Client certificate presented to the provisioner")
+	rootCmd.PersistentFlags().StringVar(&provisioner_cli.ConnectionTLS.KeyPath, "tlsKeyPath", "",
+		"Private key of the client certificate")
+	rootCmd.PersistentFlags().StringVar(&provisioner_cli.ConnectionToken, "token", os.Getenv("PROVISIONER_TOKEN"),
+		"Bearer token sent to the provisioner. Defaults to the PROVISIONER_TOKEN environment variable")
 }
 
 func Execute() {
@@ -61,7 +74,10 @@ func SetupLogging() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
+	var output io.Writer = os.Stderr
 	if consoleLogging {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+		output = zerolog.ConsoleWriter{Out: os.Stdout}
 	}
+	// Credentials that reach the log by mistake are masked before being written.
+	log.Logger = log.Output(redact.NewWriter(output))
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner-cli"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
@@ -69,6 +70,8 @@ func ConfigureScale() {
 		}
 		scaleRequest.AzureOptions = &azureOptions
 	}
+	// Selecting the fake platform enables the fake provider for the local execution.
+	cfg.EnableFakeProvider = targetPlatform == fake.Platform.ToGRPC()
 	cfg.LaunchService = false
 }
 
@@ -87,7 +90,9 @@ func init() {
 	scaleCmd.Flags().Int64Var(&scaleRequest.NumNodes, "numNodes", 3,
 		"Number of nodes to scale the cluster")
 	scaleCmd.Flags().StringVar(&targetPlatform, "platform", "",
-		"Target plaftorm determining the provider: AZURE or BAREMETAL")
+		"Target plaftorm determining the provider: AZURE, BAREMETAL or FAKE")
+	addFakeProviderFlags(scaleCmd)
+	addBareMetalFlags(scaleCmd)
 	scaleCmd.Flags().StringVar(&azureCredentialsPath, "azureCredentialsPath", "",
 		"Path to the file containing the azure credentials")
 	scaleCmd.Flags().StringVar(&azureOptions.ResourceGroup, "resourceGroup", "",
@@ -21,7 +21,10 @@ import (
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/baremetal"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
 	"os"
 	"strings"
 )
@@ -35,12 +38,36 @@ func GetTargetPlatform(platform string) (grpc_installer_go.Platform, derrors.Err
 		return grpc_installer_go.Platform_AZURE, nil
 	case "baremetal":
 		return grpc_installer_go.Platform_BAREMETAL, nil
+	case strings.ToLower(fake.PlatformName):
+		return fake.Platform.ToGRPC(), nil
 	default:
 		// returning a value due to the constant pointer problem
 		return grpc_installer_go.Platform_MINIKUBE, derrors.NewInvalidArgumentError("unsupported platform type")
 	}
 }
 
+// addFakeProviderFlags adds the flags configuring the fake provider to a command executed locally.
+func addFakeProviderFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.FakeInventoryPath, "fakeInventoryPath", "",
+		"File where the clusters of the fake platform are persisted. If empty, they are kept in memory")
+	cmd.Flags().DurationVar(&cfg.FakeStepLatency, "fakeStepLatency", 0,
+		"Time each step of the fake provider takes")
+	cmd.Flags().StringSliceVar(&cfg.FakeFailSteps, "fakeFailSteps", []string{},
+		"Steps of the fake provider that fail, e.g. create-dns-entries")
+}
+
+// addBareMetalFlags adds the flags configuring the bare-metal provider to a command executed locally.
+func addBareMetalFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.BareMetalInventoryPath, "bareMetalInventoryPath", "",
+		"File listing the hosts of the bare-metal platform")
+	cmd.Flags().StringVar(&cfg.BareMetalSSHKeyPath, "bareMetalSSHKeyPath", "",
+		"Private key used to connect to the bare-metal hosts")
+	cmd.Flags().StringVar(&cfg.BareMetalKnownHostsPath, "bareMetalKnownHostsPath", "",
+		"Known hosts file used to verify the bare-metal hosts")
+	cmd.Flags().StringVar(&cfg.BareMetalSSHUser, "bareMetalSSHUser", baremetal.DefaultSSHUser,
+		"User to connect to the bare-metal hosts")
+}
+
 // LoadAzureCredentials loads the content of a file into the grpc structure.
 func LoadAzureCredentials(credentialsPath string) (*grpc_provisioner_go.AzureCredentials, derrors.Error) {
 	credentials := &grpc_provisioner_go.AzureCredentials{}
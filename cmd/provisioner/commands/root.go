@@ -17,12 +17,14 @@
 package commands
 
 import (
+	"github.com/nalej/provisioner/internal/pkg/redact"
 	"github.com/nalej/provisioner/version"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -61,7 +63,10 @@ func SetupLogging() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
+	var output io.Writer = os.Stderr
 	if consoleLogging {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+		output = zerolog.ConsoleWriter{Out: os.Stdout}
 	}
+	// Credentials that reach the log by mistake are masked before being written.
+	log.Logger = log.Output(redact.NewWriter(output))
 }
@@ -18,7 +18,13 @@ package commands
 
 import (
 	"github.com/nalej/provisioner/internal/app/provisioner"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/baremetal"
+	"github.com/nalej/provisioner/internal/pkg/certs"
 	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -44,9 +50,101 @@ var runCmd = &cobra.Command{
 
 func init() {
 	runCmd.Flags().IntVar(&cfg.Port, "port", 8930, "Port to launch the provisioner gRPC API")
+	runCmd.Flags().IntVar(&cfg.GatewayPort, "gatewayPort", 0,
+		"Port to expose the API as JSON over HTTP. Use 0 to disable the gateway")
+	runCmd.Flags().StringVar(&cfg.TLSCertPath, "tlsCertPath", "",
+		"Server certificate of the gRPC API. If empty, TLS is disabled")
+	runCmd.Flags().StringVar(&cfg.TLSKeyPath, "tlsKeyPath", "",
+		"Private key of the server certificate")
+	runCmd.Flags().StringVar(&cfg.TLSClientCAPath, "tlsClientCAPath", "",
+		"CA used to verify the client certificates")
+	runCmd.Flags().BoolVar(&cfg.TLSRequireClientCert, "tlsRequireClientCert", false,
+		"Require the clients to present a certificate signed by the client CA")
+	runCmd.Flags().DurationVar(&cfg.TLSReloadInterval, "tlsReloadInterval", certs.DefaultReloadInterval,
+		"Interval to reload the certificates from disk. Use 0 to disable the reload")
+	runCmd.Flags().StringSliceVar(&cfg.AuthKeyPaths, "authKeyPaths", []string{},
+		"Keys used to verify the bearer tokens: PEM public keys or HMAC secrets. If empty, calls are not authenticated")
+	runCmd.Flags().StringVar(&cfg.AuthIssuer, "authIssuer", "",
+		"Issuer expected in the bearer tokens")
+	runCmd.Flags().StringVar(&cfg.AuthAudience, "authAudience", "",
+		"Audience expected in the bearer tokens")
+	runCmd.Flags().StringVar(&cfg.AuditLogPath, "auditLogPath", "",
+		"Append-only file recording the calls that modify the clusters. If empty, the calls are written to the log")
+	runCmd.Flags().StringVar(&cfg.CredentialsProfilesPath, "credentialsProfilesPath", "",
+		"Directory with the credentials profiles. If empty, profiles created through the API are kept in memory")
+	runCmd.Flags().StringVar(&cfg.CredentialsProfilesNamespace, "credentialsProfilesNamespace", "",
+		"Namespace of the Kubernetes secrets containing credentials profiles. If empty, secrets are not loaded")
+	runCmd.Flags().StringVar(&cfg.CredentialsProfilesSelector, "credentialsProfilesSelector", profiles.DefaultSecretSelector,
+		"Label selector of the Kubernetes secrets containing credentials profiles")
 	runCmd.Flags().StringVar(&cfg.TempPath, "tempPath", "./temp/",
 		"Directory to store temporal files")
 	runCmd.Flags().StringVar(&cfg.ResourcesPath, "resourcesPath", "./resources/",
 		"Directory with the provisioner resources files")
+	runCmd.Flags().StringVar(&cfg.StorePath, "storePath", "",
+		"File where the state of the operations is persisted. If empty, operations are kept in memory")
+	runCmd.Flags().DurationVar(&cfg.CheckpointInterval, "checkpointInterval", workflow.DefaultCheckpointInterval,
+		"Interval to persist the state of the ongoing operations")
+	runCmd.Flags().BoolVar(&cfg.RollbackOnFailure, "rollbackOnFailure", false,
+		"Release the resources created by failed provisioning operations by default")
+	runCmd.Flags().StringVar(&cfg.ClusterLockPolicy, "clusterLockPolicy", "wait",
+		"Policy for operations on a cluster being modified by another operation: wait or reject")
+	runCmd.Flags().IntVar(&cfg.MaxConcurrentOperations, "maxConcurrentOperations", workflow.MaxConcurrentOperation,
+		"Maximum number of operations executed at the same time")
+	runCmd.Flags().IntVar(&cfg.MaxConcurrentPerOrganization, "maxConcurrentPerOrganization", 3,
+		"Maximum number of operations of the same organization executed at the same time. Use 0 to disable the limit")
+	runCmd.Flags().DurationVar(&cfg.ProvisionDeadline, "provisionDeadline", workflow.DefaultProvisionDeadline,
+		"Maximum duration of a provisioning operation. Use 0 to disable the deadline")
+	runCmd.Flags().DurationVar(&cfg.ScaleDeadline, "scaleDeadline", workflow.DefaultScaleDeadline,
+		"Maximum duration of a scaling operation. Use 0 to disable the deadline")
+	runCmd.Flags().DurationVar(&cfg.DecommissionDeadline, "decommissionDeadline", workflow.DefaultDecommissionDeadline,
+		"Maximum duration of a decommission operation. Use 0 to disable the deadline")
+	runCmd.Flags().DurationVar(&cfg.ManagementDeadline, "managementDeadline", workflow.DefaultManagementDeadline,
+		"Maximum duration of a management operation. Use 0 to disable the deadline")
+	runCmd.Flags().DurationVar(&cfg.StalledOperationTimeout, "stalledOperationTimeout", workflow.DefaultStalledOperationTimeout,
+		"Maximum time an operation may run without logging progress. Use 0 to disable the detection")
+	runCmd.Flags().DurationVar(&cfg.OperationTTL, "operationTTL", workflow.DefaultOperationTTL,
+		"Time finished operations are kept before being removed. Use 0 to keep them until removed")
+	runCmd.Flags().DurationVar(&cfg.ShutdownGracePeriod, "shutdownGracePeriod", workflow.DefaultShutdownGracePeriod,
+		"Time the running operations are given to finish when the provisioner is stopped")
+	runCmd.Flags().IntVar(&cfg.MetricsPort, "metricsPort", 8931,
+		"Port to expose the Prometheus metrics. Use 0 to disable them")
+	runCmd.Flags().IntVar(&cfg.HealthPort, "healthPort", 8932,
+		"Port to expose the liveness and readiness endpoints. It may be the metrics port. Use 0 to disable them")
+	runCmd.Flags().StringVar(&cfg.TracingExporter, "tracingExporter", tracing.NoExporter,
+		"Exporter of the operation traces: none, stdout or jaeger")
+	runCmd.Flags().StringVar(&cfg.TracingEndpoint, "tracingEndpoint", "",
+		"Endpoint of the collector receiving the traces, e.g. http://jaeger:14268/api/traces")
+	runCmd.Flags().Float64Var(&cfg.TracingSampleRatio, "tracingSampleRatio", 1,
+		"Fraction of the operations that are traced")
+	runCmd.Flags().StringSliceVar(&cfg.WebhookURLs, "webhookURLs", []string{},
+		"Webhooks notified when any operation finishes or fails")
+	runCmd.Flags().StringVar(&cfg.WebhookSecret, "webhookSecret", "",
+		"Secret used to sign the webhook notifications. If empty, notifications are not signed")
+	runCmd.Flags().StringVar(&cfg.WebhookStorePath, "webhookStorePath", "",
+		"File where the webhook delivery log is persisted. If empty, the log is kept in memory")
+	runCmd.Flags().IntVar(&cfg.WebhookMaxAttempts, "webhookMaxAttempts", webhook.DefaultMaxAttempts,
+		"Maximum number of attempts to deliver a webhook notification")
+	runCmd.Flags().StringSliceVar(&cfg.WebhookAllowedHosts, "webhookAllowedHosts", []string{},
+		"Hosts, IP addresses or CIDR ranges that the webhooks of the requests may target even if they are private")
+	runCmd.Flags().BoolVar(&cfg.EnableFakeProvider, "enableFakeProvider", false,
+		"Accept requests for the fake platform, whose clusters are simulated. Only for testing")
+	runCmd.Flags().StringVar(&cfg.FakeInventoryPath, "fakeInventoryPath", "",
+		"File where the clusters of the fake provider are persisted. If empty, they are kept in memory")
+	runCmd.Flags().DurationVar(&cfg.FakeStepLatency, "fakeStepLatency", 0,
+		"Time each step of the fake provider takes")
+	runCmd.Flags().StringSliceVar(&cfg.FakeStepLatencies, "fakeStepLatencies", []string{},
+		"Latency of specific steps of the fake provider, e.g. create-cluster=30s")
+	runCmd.Flags().StringSliceVar(&cfg.FakeFailSteps, "fakeFailSteps", []string{},
+		"Steps of the fake provider that fail, e.g. create-dns-entries, or create-dns-entries=1 to fail only the first attempt")
+	runCmd.Flags().StringVar(&cfg.BareMetalInventoryPath, "bareMetalInventoryPath", "",
+		"File listing the hosts of the bare-metal provider. If empty, the bare-metal platform is not available")
+	runCmd.Flags().StringVar(&cfg.BareMetalSSHKeyPath, "bareMetalSSHKeyPath", "",
+		"Private key used to connect to the bare-metal hosts")
+	runCmd.Flags().StringVar(&cfg.BareMetalKnownHostsPath, "bareMetalKnownHostsPath", "",
+		"Known hosts file used to verify the bare-metal hosts")
+	runCmd.Flags().StringVar(&cfg.BareMetalSSHUser, "bareMetalSSHUser", baremetal.DefaultSSHUser,
+		"User to connect to the bare-metal hosts. Users other than root require passwordless sudo")
+	runCmd.Flags().StringVar(&cfg.BareMetalNetworkManifest, "bareMetalNetworkManifest", baremetal.DefaultNetworkManifest,
+		"Manifest of the pod network installed on the bare-metal clusters")
 	rootCmd.AddCommand(runCmd)
 }
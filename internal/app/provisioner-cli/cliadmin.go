@@ -0,0 +1,72 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner_cli
+
+import (
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/admin"
+	"github.com/nalej/provisioner/internal/pkg/common"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// CLIAdmin structure to administer a provisioner service.
+type CLIAdmin struct {
+	// provisionerAddress with the address of the provisioner gRPC API.
+	provisionerAddress string
+}
+
+// NewCLIAdmin creates a new CLI command to administer a remote provisioner.
+func NewCLIAdmin(provisionerAddress string) *CLIAdmin {
+	return &CLIAdmin{
+		provisionerAddress: provisionerAddress,
+	}
+}
+
+// Status retrieves and prints the state of the executor.
+func (ca *CLIAdmin) Status() derrors.Error {
+	return ca.call(func(client *admin.Client) (*entities.ExecutorStatus, error) {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		return client.GetExecutorStatus(ctx)
+	})
+}
+
+// SetMode changes the mode of the executor and prints its state.
+func (ca *CLIAdmin) SetMode(mode string) derrors.Error {
+	return ca.call(func(client *admin.Client) (*entities.ExecutorStatus, error) {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		return client.SetExecutorMode(ctx, &entities.ExecutorModeRequest{Mode: mode})
+	})
+}
+
+// call connects to the provisioner, performs a call of the admin service and prints the resulting state.
+func (ca *CLIAdmin) call(method func(client *admin.Client) (*entities.ExecutorStatus, error)) derrors.Error {
+	conn, dErr := dial(ca.provisionerAddress)
+	if dErr != nil {
+		return dErr
+	}
+	defer conn.Close()
+	status, err := method(admin.NewClient(conn))
+	if err != nil {
+		return derrors.AsError(err, "admin request failed")
+	}
+	fmt.Printf("Mode: %s\nQueued operations: %d\nRunning operations: %d\n", status.Mode, status.QueuedOperations, status.RunningOperations)
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner_cli
+
+import (
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/common"
+	"github.com/rs/zerolog/log"
+)
+
+// CLICancel structure to cancel an operation being executed by a provisioner service.
+type CLICancel struct {
+	// provisionerAddress with the address of the provisioner gRPC API.
+	provisionerAddress string
+	// operationType with the type of the operation to be cancelled: provision, scale or decommission.
+	operationType string
+	// requestID of the operation to be cancelled.
+	requestID string
+}
+
+// NewCLICancel creates a new CLI command to cancel remote operations.
+func NewCLICancel(provisionerAddress string, operationType string, requestID string) *CLICancel {
+	return &CLICancel{
+		provisionerAddress: provisionerAddress,
+		operationType:      strings.ToLower(operationType),
+		requestID:          requestID,
+	}
+}
+
+// Run requests the cancellation of the operation.
+func (cc *CLICancel) Run() derrors.Error {
+	if cc.requestID == "" {
+		return derrors.NewInvalidArgumentError("requestID must be specified")
+	}
+	conn, dErr := dial(cc.provisionerAddress)
+	if dErr != nil {
+		return dErr
+	}
+	defer conn.Close()
+
+	ctx, cancel := common.GetContext()
+	defer cancel()
+	requestID := &grpc_common_go.RequestId{RequestId: cc.requestID}
+	var err error
+	switch cc.operationType {
+	case "provision":
+		_, err = grpc_provisioner_go.NewProvisionClient(conn).RemoveProvision(ctx, requestID)
+	case "scale":
+		_, err = grpc_provisioner_go.NewScaleClient(conn).RemoveScale(ctx, requestID)
+	case "decommission":
+		_, err = grpc_provisioner_go.NewDecommissionClient(conn).RemoveDecommission(ctx, requestID)
+	default:
+		return derrors.NewInvalidArgumentError("unsupported operation type").WithParams(cc.operationType)
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot cancel operation")
+	}
+	log.Info().Str("requestID", cc.requestID).Str("type", cc.operationType).Msg("cancellation requested")
+	return nil
+}
@@ -18,8 +18,11 @@
 package provisioner_cli
 
 import (
+	"context"
 	"fmt"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"path/filepath"
@@ -31,14 +34,65 @@ type CLICommon struct {
 	kubeConfigOutputPath string
 }
 
-func (cc * CLICommon) printOperationLog(logPool []string) {
+// printOperationLog prints the new entries of the operation log with the time elapsed since the first entry.
+func (cc * CLICommon) printOperationLog(logPool []entities.LogEntry) {
 	if len(logPool) > cc.lastLogEntry {
 		for ; cc.lastLogEntry < len(logPool); cc.lastLogEntry++ {
-			log.Info().Msg(logPool[cc.lastLogEntry])
+			printLogEntry(logPool[cc.lastLogEntry], logPool[0].Timestamp)
 		}
 	}
 }
 
+// printLogEntry prints a log entry with its level and the time elapsed since a reference time.
+func printLogEntry(entry entities.LogEntry, reference time.Time) {
+	var event *zerolog.Event
+	switch entry.Level {
+	case entities.WarningLevel:
+		event = log.Warn()
+	case entities.ErrorLevel:
+		event = log.Error()
+	default:
+		event = log.Info()
+	}
+	if !entry.Timestamp.IsZero() && !reference.IsZero() {
+		event = event.Str("at", fmt.Sprintf("+%s", entry.Timestamp.Sub(reference).Round(time.Second).String()))
+	}
+	event.Msg(entry.String())
+}
+
+// watchOperation prints the log entries and progress changes of an operation as they happen until the operation finishes.
+func (cc * CLICommon) watchOperation(operation entities.InfrastructureOperation, operationName string) {
+	stream := &cliStream{operationName: operationName, start: time.Now()}
+	err := watch.Serve(watch.GetHub(), operation, stream)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("cannot watch operation")
+	}
+}
+
+// cliStream prints the events of a watched operation.
+type cliStream struct {
+	operationName string
+	start         time.Time
+}
+
+// Send prints an event.
+func (cs * cliStream) Send(event *watch.Event) error {
+	switch event.Type {
+	case watch.LogEvent:
+		if event.LogEntry != nil {
+			printLogEntry(*event.LogEntry, cs.start)
+		}
+	case watch.ProgressEvent:
+		fmt.Printf("%s operation %s - %s\n", cs.operationName, entities.TaskProgressToString[event.Progress], time.Since(cs.start).String())
+	}
+	return nil
+}
+
+// Context returns the context of the stream, the CLI watches the operation until it finishes.
+func (cs * cliStream) Context() context.Context {
+	return context.Background()
+}
+
 // PrintJSONResult prints the result of a provisioner operation as JSON
 func (cc * CLICommon) printJSONResult(clusterName string, result entities.OperationResult) {
 	logger := log.With().
@@ -32,7 +32,7 @@ import (
 type CLIDecommissioner struct {
 	*CLICommon
 	request  *grpc_provisioner_go.DecommissionClusterRequest
-	Executor workflow.Executor
+	Executor *workflow.Executor
 	config   *config.Config
 }
 
@@ -56,7 +56,7 @@ func (cs *CLIDecommissioner) Run() derrors.Error {
 	}
 	cs.config.Print()
 	log.Debug().Str("target_platform", cs.request.TargetPlatform.String()).Msg("Decommission request received")
-	infraProvider, err := provider.NewInfrastructureProvider(cs.request.TargetPlatform, cs.request.AzureCredentials, cs.config)
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(cs.request.TargetPlatform), provider.Credentials{AzureCredentials: cs.request.AzureCredentials}, cs.config)
 	if err != nil {
 		log.Error().Str("provider", cs.request.TargetPlatform.String()).Msg("cannot obtain infrastructure provider")
 		return err
@@ -67,17 +67,12 @@ func (cs *CLIDecommissioner) Run() derrors.Error {
 		return err
 	}
 
-	cs.Executor.ScheduleOperation(operation)
-	start := time.Now()
-	checks := 0
-	for cs.Executor.IsManaged(cs.request.RequestId) {
-		time.Sleep(15 * time.Second)
-		cs.printOperationLog(operation.Log())
-		if checks%4 == 0 {
-			fmt.Printf("Decommission operation %s - %s\n", entities.TaskProgressToString[operation.Progress()], time.Since(start).String())
-		}
-		checks++
+	err = cs.Executor.ScheduleOperation(operation)
+	if err != nil {
+		return err
 	}
+	start := time.Now()
+	cs.watchOperation(operation, "Decommission")
 	elapsed := time.Since(start)
 	fmt.Println("Decommissioning took ", elapsed)
 	// Process the result
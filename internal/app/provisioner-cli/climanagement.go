@@ -17,6 +17,7 @@
 package provisioner_cli
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -35,7 +36,7 @@ type CLIManagement struct {
 	*CLICommon
 	request   *grpc_provisioner_go.ClusterRequest
 	Operation entities.ManagementOperationType
-	Executor  workflow.Executor
+	Executor  *workflow.Executor
 	config    *config.Config
 }
 
@@ -63,7 +64,7 @@ func (cm *CLIManagement) Run() derrors.Error {
 	}
 	cm.config.Print()
 	log.Debug().Str("target_platform", cm.request.TargetPlatform.String()).Bool("isManagementCluster", cm.request.IsManagementCluster).Msg("Cluster request received")
-	infraProvider, err := provider.NewInfrastructureProvider(cm.request.TargetPlatform, cm.request.AzureCredentials, cm.config)
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(cm.request.TargetPlatform), provider.Credentials{AzureCredentials: cm.request.AzureCredentials}, cm.config)
 	if err != nil {
 		log.Error().Msg("cannot obtain infrastructure provider")
 		return err
@@ -85,7 +86,7 @@ func (cm *CLIManagement) GetKubeConfig(infraProvider providerEntities.Infrastruc
 	checks := 0
 	wfc := &WaitForCompletion{Called: false}
 	operation.SetProgress(entities.InProgress)
-	operation.Execute(wfc.finished)
+	operation.Execute(context.Background(), wfc.finished)
 	for !wfc.Called {
 		time.Sleep(15 * time.Second)
 		cm.printOperationLog(operation.Log())
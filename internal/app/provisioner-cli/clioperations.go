@@ -0,0 +1,92 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner_cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
+	"github.com/nalej/provisioner/internal/pkg/common"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// CLIOperations structure to query the operations known by a provisioner service.
+type CLIOperations struct {
+	// provisionerAddress with the address of the provisioner gRPC API.
+	provisionerAddress string
+	// filter with the criteria to list the operations.
+	filter entities.OperationFilter
+}
+
+// NewCLIOperations creates a new CLI command to list remote operations.
+func NewCLIOperations(provisionerAddress string, filter entities.OperationFilter) *CLIOperations {
+	return &CLIOperations{
+		provisionerAddress: provisionerAddress,
+		filter:             filter,
+	}
+}
+
+// List retrieves and prints the operations matching the filter.
+func (co *CLIOperations) List() derrors.Error {
+	vErr := co.filter.Validate()
+	if vErr != nil {
+		return vErr
+	}
+	conn, dErr := dial(co.provisionerAddress)
+	if dErr != nil {
+		return dErr
+	}
+	defer conn.Close()
+
+	ctx, cancel := common.GetContext()
+	defer cancel()
+	result, err := operations.NewClient(conn).ListOperations(ctx, &co.filter)
+	if err != nil {
+		return derrors.AsError(err, "cannot list operations")
+	}
+	co.printOperations(result)
+	return nil
+}
+
+// printOperations prints a page of operations as a table.
+func (co *CLIOperations) printOperations(result *entities.OperationList) {
+	writer := NewTabWriterHelper()
+	writer.Println("REQUEST\tTYPE\tORGANIZATION\tCLUSTER\tPROGRESS\tREGISTERED\tELAPSED\tERROR")
+	for _, operation := range result.Operations {
+		cluster := operation.ClusterID
+		if cluster == "" {
+			cluster = operation.ClusterName
+		}
+		writer.Println(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			operation.RequestID,
+			entities.ToOperationTypeString[operation.Type],
+			operation.OrganizationID,
+			cluster,
+			entities.TaskProgressToString[operation.Progress],
+			time.Unix(operation.Registered, 0).Format(time.RFC3339),
+			time.Duration(operation.ElapsedTime).Round(time.Second).String(),
+			operation.ErrorMsg))
+	}
+	_ = writer.Flush()
+	if result.NextOffset > 0 {
+		fmt.Printf("Showing %d of %d operations, use --offset %d for the next page\n", len(result.Operations), result.Total, result.NextOffset)
+	} else {
+		fmt.Printf("Showing %d of %d operations\n", len(result.Operations), result.Total)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner_cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/profiles"
+	"github.com/nalej/provisioner/internal/pkg/common"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// CLIProfiles structure to manage the credentials profiles of a provisioner service.
+type CLIProfiles struct {
+	// provisionerAddress with the address of the provisioner gRPC API.
+	provisionerAddress string
+}
+
+// NewCLIProfiles creates a new CLI command to manage the credentials profiles of a remote provisioner.
+func NewCLIProfiles(provisionerAddress string) *CLIProfiles {
+	return &CLIProfiles{
+		provisionerAddress: provisionerAddress,
+	}
+}
+
+// List prints the available profiles as a table.
+func (cp *CLIProfiles) List() derrors.Error {
+	return cp.call(func(client *profiles.Client) derrors.Error {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		result, err := client.ListProfiles(ctx)
+		if err != nil {
+			return derrors.AsError(err, "cannot list credentials profiles")
+		}
+		writer := NewTabWriterHelper()
+		writer.Println("ID\tPLATFORM\tSOURCE\tORGANIZATIONS\tDESCRIPTION")
+		for _, profile := range result.Profiles {
+			writer.Println(fmt.Sprintf("%s\t%s\t%s\t%s\t%s", profile.ID, profile.Platform, profile.Source,
+				strings.Join(profile.Organizations, ","), profile.Description))
+		}
+		_ = writer.Flush()
+		return nil
+	})
+}
+
+// Get prints a profile without its secrets.
+func (cp *CLIProfiles) Get(profileID string) derrors.Error {
+	return cp.call(func(client *profiles.Client) derrors.Error {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		result, err := client.GetProfile(ctx, &entities.ProfileID{ID: profileID})
+		if err != nil {
+			return derrors.AsError(err, "cannot retrieve credentials profile")
+		}
+		return cp.printProfile(result)
+	})
+}
+
+// Add creates a profile from a JSON file.
+func (cp *CLIProfiles) Add(profilePath string) derrors.Error {
+	return cp.store(profilePath, func(client *profiles.Client, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error) {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		return client.AddProfile(ctx, profile)
+	})
+}
+
+// Update replaces a profile with the content of a JSON file.
+func (cp *CLIProfiles) Update(profilePath string) derrors.Error {
+	return cp.store(profilePath, func(client *profiles.Client, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error) {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		return client.UpdateProfile(ctx, profile)
+	})
+}
+
+// Remove deletes a profile.
+func (cp *CLIProfiles) Remove(profileID string) derrors.Error {
+	return cp.call(func(client *profiles.Client) derrors.Error {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		_, err := client.RemoveProfile(ctx, &entities.ProfileID{ID: profileID})
+		if err != nil {
+			return derrors.AsError(err, "cannot remove credentials profile")
+		}
+		fmt.Printf("Profile %s removed\n", profileID)
+		return nil
+	})
+}
+
+// Validate checks the credentials of a profile against its platform.
+func (cp *CLIProfiles) Validate(profileID string) derrors.Error {
+	return cp.call(func(client *profiles.Client) derrors.Error {
+		ctx, cancel := common.GetContext()
+		defer cancel()
+		result, err := client.ValidateProfile(ctx, &entities.ProfileID{ID: profileID})
+		if err != nil {
+			return derrors.AsError(err, "cannot validate credentials profile")
+		}
+		if !result.Valid {
+			return derrors.NewFailedPreconditionError("invalid credentials profile").WithParams(result.ID, result.Error)
+		}
+		fmt.Printf("Profile %s is valid\n", result.ID)
+		return nil
+	})
+}
+
+// store reads a profile from a file, sends it to the provisioner and prints the stored profile.
+func (cp *CLIProfiles) store(profilePath string, method func(client *profiles.Client, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error)) derrors.Error {
+	raw, err := ioutil.ReadFile(profilePath)
+	if err != nil {
+		return derrors.AsError(err, "cannot read credentials profile file")
+	}
+	profile := &entities.CredentialsProfile{}
+	if err := json.Unmarshal(raw, profile); err != nil {
+		return derrors.AsError(err, "cannot parse credentials profile file")
+	}
+	if vErr := profile.Validate(); vErr != nil {
+		return vErr
+	}
+	return cp.call(func(client *profiles.Client) derrors.Error {
+		result, err := method(client, profile)
+		if err != nil {
+			return derrors.AsError(err, "cannot store credentials profile")
+		}
+		return cp.printProfile(result)
+	})
+}
+
+// call connects to the provisioner and performs calls of the profiles service.
+func (cp *CLIProfiles) call(method func(client *profiles.Client) derrors.Error) derrors.Error {
+	conn, dErr := dial(cp.provisionerAddress)
+	if dErr != nil {
+		return dErr
+	}
+	defer conn.Close()
+	return method(profiles.NewClient(conn))
+}
+
+// printProfile prints a profile as JSON.
+func (cp *CLIProfiles) printProfile(profile *entities.CredentialsProfile) derrors.Error {
+	raw, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal credentials profile")
+	}
+	fmt.Println(string(raw))
+	return nil
+}
@@ -33,7 +33,7 @@ import (
 type CLIProvisioner struct {
 	*CLICommon
 	request  *grpc_provisioner_go.ProvisionClusterRequest
-	Executor workflow.Executor
+	Executor *workflow.Executor
 	config   *config.Config
 }
 
@@ -59,27 +59,24 @@ func (cp *CLIProvisioner) Run() derrors.Error {
 	}
 	cp.config.Print()
 	log.Debug().Str("target_platform", cp.request.TargetPlatform.String()).Bool("isProduction", cp.request.IsProduction).Msg("Provision request received")
-	infraProvider, err := provider.NewInfrastructureProvider(cp.request.TargetPlatform, cp.request.AzureCredentials, cp.config)
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(cp.request.TargetPlatform), provider.Credentials{AzureCredentials: cp.request.AzureCredentials}, cp.config)
 	if err != nil {
 		log.Error().Msg("cannot obtain infrastructure provider")
 		return err
 	}
-	operation, err := infraProvider.Provision(entities.NewProvisionRequest(cp.request))
+	provisionRequest := entities.NewProvisionRequest(cp.request)
+	provisionRequest.RollbackOnFailure = cp.config.RollbackOnFailure
+	operation, err := infraProvider.Provision(provisionRequest)
 	if err != nil {
 		log.Error().Str("trace", err.DebugReport()).Msg("cannot create provision operation")
 		return err
 	}
-	cp.Executor.ScheduleOperation(operation)
-	start := time.Now()
-	checks := 0
-	for cp.Executor.IsManaged(cp.request.RequestId) {
-		time.Sleep(15 * time.Second)
-		cp.printOperationLog(operation.Log())
-		if checks%4 == 0 {
-			fmt.Printf("Provision operation %s - %s\n", entities.TaskProgressToString[operation.Progress()], time.Since(start).String())
-		}
-		checks++
+	err = cp.Executor.ScheduleOperation(operation)
+	if err != nil {
+		return err
 	}
+	start := time.Now()
+	cp.watchOperation(operation, "Provision")
 	elapsed := time.Since(start)
 	fmt.Println("Provisioning took ", elapsed)
 	// Process the result
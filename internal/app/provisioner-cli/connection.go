@@ -0,0 +1,79 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner_cli
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/certs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSOptions with the transport security used to connect to a provisioner service.
+type TLSOptions struct {
+	// Enabled determines if the connection uses TLS.
+	Enabled bool
+	// CAPath with the CA used to verify the provisioner. If empty, the system roots are used.
+	CAPath string
+	// CertPath with the client certificate presented to provisioners requiring one.
+	CertPath string
+	// KeyPath with the private key of the client certificate.
+	KeyPath string
+}
+
+// ConnectionTLS with the transport security of the connections to the provisioner services.
+var ConnectionTLS = TLSOptions{}
+
+// ConnectionToken with the bearer token sent to the provisioner services. If empty, no token is sent.
+var ConnectionToken = ""
+
+// tokenCredentials attaches a bearer token to every call.
+type tokenCredentials struct {
+	token string
+}
+
+// GetRequestMetadata returns the authorization metadata of the calls.
+func (tc tokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + tc.token}, nil
+}
+
+// RequireTransportSecurity returns false so that tokens can be used against development services without TLS.
+func (tc tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// dial connects to a provisioner service using the configured transport security.
+func dial(address string) (*grpc.ClientConn, derrors.Error) {
+	transport := grpc.WithInsecure()
+	if ConnectionTLS.Enabled {
+		tlsConfig, err := certs.ClientConfig(ConnectionTLS.CAPath, ConnectionTLS.CertPath, ConnectionTLS.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	options := []grpc.DialOption{transport}
+	if ConnectionToken != "" {
+		options = append(options, grpc.WithPerRPCCredentials(tokenCredentials{token: ConnectionToken}))
+	}
+	conn, err := grpc.Dial(address, options...)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot connect to the provisioner")
+	}
+	return conn, nil
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+type Handler struct {
+	Manager Manager
+}
+
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager}
+}
+
+// GetExecutorStatus returns the mode of the executor and the number of queued and running operations.
+func (h *Handler) GetExecutorStatus(_ context.Context, _ *grpc_common_go.Empty) (*entities.ExecutorStatus, error) {
+	return h.Manager.GetExecutorStatus(), nil
+}
+
+// SetExecutorMode changes the mode of the executor to active, paused or draining.
+func (h *Handler) SetExecutorMode(_ context.Context, request *entities.ExecutorModeRequest) (*entities.ExecutorStatus, error) {
+	result, err := h.Manager.SetExecutorMode(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// Manager structure to administer the executor of the provisioner.
+type Manager struct {
+	Executor *workflow.Executor
+}
+
+func NewManager() Manager {
+	return Manager{
+		Executor: workflow.GetExecutor(),
+	}
+}
+
+// GetExecutorStatus returns the mode of the executor and the number of queued and running operations.
+func (m *Manager) GetExecutorStatus() *entities.ExecutorStatus {
+	status := m.Executor.Status()
+	return &status
+}
+
+// SetExecutorMode changes the mode of the executor. Paused executors keep the new operations queued, and
+// draining executors reject them while finishing the queued ones.
+func (m *Manager) SetExecutorMode(request *entities.ExecutorModeRequest) (*entities.ExecutorStatus, derrors.Error) {
+	mode, exists := workflow.ExecutorModeFromString[strings.ToLower(request.Mode)]
+	if !exists {
+		return nil, derrors.NewInvalidArgumentError("mode must be active, paused or draining").WithParams(request.Mode)
+	}
+	err := m.Executor.SetMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("mode", workflow.ExecutorModeToString[mode]).Msg("executor mode requested")
+	return m.GetExecutorStatus(), nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"google.golang.org/grpc"
+)
+
+// ServiceName with the name of the gRPC service to administer the provisioner. The service is declared by hand
+// as the provisioner protocol buffers do not define it yet, and its messages are encoded as JSON.
+const ServiceName = "provisioner.Admin"
+
+// GetExecutorStatusMethod with the full name of the method returning the state of the executor.
+const GetExecutorStatusMethod = "/" + ServiceName + "/GetExecutorStatus"
+
+// SetExecutorModeMethod with the full name of the method changing the mode of the executor.
+const SetExecutorModeMethod = "/" + ServiceName + "/SetExecutorMode"
+
+// AdminServer is the server API of the admin service.
+type AdminServer interface {
+	// GetExecutorStatus returns the mode of the executor and the number of queued and running operations.
+	GetExecutorStatus(ctx context.Context, empty *grpc_common_go.Empty) (*entities.ExecutorStatus, error)
+	// SetExecutorMode changes the mode of the executor to active, paused or draining.
+	SetExecutorMode(ctx context.Context, request *entities.ExecutorModeRequest) (*entities.ExecutorStatus, error)
+}
+
+func getExecutorStatusHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	empty := &grpc_common_go.Empty{}
+	if err := dec(empty); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetExecutorStatus(ctx, empty)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GetExecutorStatusMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetExecutorStatus(ctx, req.(*grpc_common_go.Empty))
+	}
+	return interceptor(ctx, empty, info, handler)
+}
+
+func setExecutorModeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	request := &entities.ExecutorModeRequest{}
+	if err := dec(request); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetExecutorMode(ctx, request)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SetExecutorModeMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetExecutorMode(ctx, req.(*entities.ExecutorModeRequest))
+	}
+	return interceptor(ctx, request, info, handler)
+}
+
+// serviceDesc with the description of the admin service.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetExecutorStatus",
+			Handler:    getExecutorStatusHandler,
+		},
+		{
+			MethodName: "SetExecutorMode",
+			Handler:    setExecutorModeHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin",
+}
+
+// RegisterAdminServer registers the admin service on a gRPC server.
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client of the admin service.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient creates a client of the admin service on an existing connection.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+// GetExecutorStatus returns the mode of the executor and the number of queued and running operations.
+func (c *Client) GetExecutorStatus(ctx context.Context, opts ...grpc.CallOption) (*entities.ExecutorStatus, error) {
+	result := &entities.ExecutorStatus{}
+	opts = append(opts, grpc.CallContentSubtype(operations.JSONCodecName))
+	err := c.conn.Invoke(ctx, GetExecutorStatusMethod, &grpc_common_go.Empty{}, result, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetExecutorMode changes the mode of the executor to active, paused or draining.
+func (c *Client) SetExecutorMode(ctx context.Context, request *entities.ExecutorModeRequest, opts ...grpc.CallOption) (*entities.ExecutorStatus, error) {
+	result := &entities.ExecutorStatus{}
+	opts = append(opts, grpc.CallContentSubtype(operations.JSONCodecName))
+	err := c.conn.Invoke(ctx, SetExecutorModeMethod, request, result, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
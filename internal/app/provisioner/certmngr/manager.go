@@ -32,6 +32,7 @@ import (
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -60,6 +61,18 @@ const StagingLetsEncryptCA = "letsencrypt_staging.pem"
 //LetsEncryptURLEntry is the placeholder to replace the Let's encrypt URL
 const LetsEncryptURLEntry = "LETS_ENCRYPT_URL"
 
+//CertManagerNamespace is the namespace where the cert-manager is installed
+const CertManagerNamespace = "cert-manager"
+
+//CertificateIssuerName is the name of the ClusterIssuer resource
+const CertificateIssuerName = "letsencrypt"
+
+//ServicePrincipalSecret is the name of the Secret with the Azure credentials used by the certificate issuer
+const ServicePrincipalSecret = "k8s-service-principal"
+
+//CertificateNamespace is the namespace of the cluster certificate and the CA certificate
+const CertificateNamespace = "nalej"
+
 //ClientIDEntry is the placeholder to replace the Azure Service Principal Client ID
 const ClientIDEntry = "CLIENT_ID"
 
@@ -81,6 +94,42 @@ const ClusterNameEntry = "CLUSTER_NAME"
 //ClientCertificateEntry is the placeholder for the TLS client certificate name
 const ClientCertificateEntry = "CLIENT_CERTIFICATE_NAME"
 
+//DNSProviderEntry is the placeholder for the DNS01 provider of the certificate issuer
+const DNSProviderEntry = "DNS_PROVIDER"
+
+//ProjectIDEntry is the placeholder to replace the Google Cloud project
+const ProjectIDEntry = "PROJECT_ID"
+
+//AzureDNSProvider is the name of the DNS01 provider of the Azure certificate issuer
+const AzureDNSProvider = "azuredns"
+
+//CloudDNSProvider is the name of the DNS01 provider of the Google Cloud certificate issuer
+const CloudDNSProvider = "clouddns"
+
+//CloudDNSServiceAccountSecret is the name of the Secret with the Google Cloud service account used by the certificate issuer
+const CloudDNSServiceAccountSecret = "clouddns-service-account"
+
+//CloudDNSServiceAccountKey is the entry of the CloudDNSServiceAccountSecret with the JSON key of the service account
+const CloudDNSServiceAccountKey = "service-account.json"
+
+//RegionEntry is the placeholder to replace the AWS region
+const RegionEntry = "REGION"
+
+//HostedZoneIDEntry is the placeholder to replace the identifier of the Route53 hosted zone
+const HostedZoneIDEntry = "HOSTED_ZONE_ID"
+
+//AccessKeyIDEntry is the placeholder to replace the AWS access key
+const AccessKeyIDEntry = "ACCESS_KEY_ID"
+
+//Route53DNSProvider is the name of the DNS01 provider of the AWS certificate issuer
+const Route53DNSProvider = "route53"
+
+//Route53CredentialsSecret is the name of the Secret with the AWS secret access key used by the certificate issuer
+const Route53CredentialsSecret = "route53-credentials"
+
+//Route53SecretAccessKey is the entry of the Route53CredentialsSecret with the secret access key
+const Route53SecretAccessKey = "secret-access-key"
+
 //AzureCertificateIssuerTemplate to create a ClusterIssuer resource for Azure
 const AzureCertificateIssuerTemplate = `
 apiVersion: certmanager.k8s.io/v1alpha1
@@ -107,6 +156,52 @@ spec:
             hostedZoneName: DNS_ZONE
 `
 
+//CloudDNSCertificateIssuerTemplate to create a ClusterIssuer resource for Google Cloud
+const CloudDNSCertificateIssuerTemplate = `
+apiVersion: certmanager.k8s.io/v1alpha1
+kind: ClusterIssuer
+metadata:
+  name: letsencrypt
+spec:
+  acme:
+    server: LETS_ENCRYPT_URL
+    email: jarvis@nalej.com
+    privateKeySecretRef:
+      name: letsencrypt
+    dns01:
+      providers:
+        - name: clouddns
+          clouddns:
+            project: PROJECT_ID
+            serviceAccountSecretRef:
+              name: clouddns-service-account
+              key: service-account.json
+`
+
+//Route53CertificateIssuerTemplate to create a ClusterIssuer resource for AWS
+const Route53CertificateIssuerTemplate = `
+apiVersion: certmanager.k8s.io/v1alpha1
+kind: ClusterIssuer
+metadata:
+  name: letsencrypt
+spec:
+  acme:
+    server: LETS_ENCRYPT_URL
+    email: jarvis@nalej.com
+    privateKeySecretRef:
+      name: letsencrypt
+    dns01:
+      providers:
+        - name: route53
+          route53:
+            region: REGION
+            hostedZoneID: HOSTED_ZONE_ID
+            accessKeyID: ACCESS_KEY_ID
+            secretAccessKeySecretRef:
+              name: route53-credentials
+              key: secret-access-key
+`
+
 //CertificateTemplate to create a Certificate resource
 const CertificateTemplate = `
 apiVersion: certmanager.k8s.io/v1alpha1
@@ -124,7 +219,7 @@ spec:
   acme:
     config:
       - dns01:
-          provider: azuredns
+          provider: DNS_PROVIDER
         domains:
           - '*.CLUSTER_NAME.DNS_ZONE'
 `
@@ -161,12 +256,52 @@ func (cmh *CertManagerHelper) Connect(rawKubeConfig string) derrors.Error {
 
 // Destroy will cleanup the temporal structures.
 func (cmh *CertManagerHelper) Destroy() {
+	if cmh.kubeConfigFilePath == nil {
+		return
+	}
 	// remove the file once the cert manager install finishes
 	cmh.cleanupTempFile(*cmh.kubeConfigFilePath)
+	cmh.kubeConfigFilePath = nil
+	cmh.Kubernetes = nil
 }
 
 // InstallCertManager installs the cert manager on a given cluster.
 func (cmh *CertManagerHelper) InstallCertManager() derrors.Error {
+	targetFiles := cmh.certManagerFiles()
+	// Now trigger the install process of all involved YAML
+	var installErr derrors.Error
+	for index := 0; index < len(targetFiles) && installErr == nil; index++ {
+		installErr = cmh.installCertManagerFile(targetFiles[index])
+	}
+	// We let cert-manager to start itself inside the cluster
+	// TODO: Provide a more accurate way to detect that cert-manager is ready to receive operations
+	time.Sleep(30 * time.Second)
+	return installErr
+}
+
+// UninstallCertManager removes the resources created by InstallCertManager in reverse order.
+func (cmh *CertManagerHelper) UninstallCertManager() derrors.Error {
+	targetFiles := cmh.certManagerFiles()
+	for index := len(targetFiles) - 1; index >= 0; index-- {
+		obj, err := cmh.decodeCertManagerFile(targetFiles[index])
+		if err != nil {
+			return err
+		}
+		err = cmh.Kubernetes.Delete(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CertManagerInstalled checks if the cert manager is already installed on the cluster.
+func (cmh *CertManagerHelper) CertManagerInstalled() (bool, derrors.Error) {
+	return cmh.Kubernetes.ExistsNamespace(CertManagerNamespace)
+}
+
+// certManagerFiles returns the names of the cert manager YAML files in installation order.
+func (cmh *CertManagerHelper) certManagerFiles() []string {
 	// List of files
 	fileInfo, err := ioutil.ReadDir(cmh.config.ResourcesPath)
 	if err != nil {
@@ -178,23 +313,24 @@ func (cmh *CertManagerHelper) InstallCertManager() derrors.Error {
 			targetFiles = append(targetFiles, file.Name())
 		}
 	}
-	// Now trigger the install process of all involved YAML
-	var installErr derrors.Error
-	for index := 0; index < len(targetFiles) && installErr == nil; index++ {
-		installErr = cmh.installCertManagerFile(targetFiles[index])
-	}
-	// We let cert-manager to start itself inside the cluster
-	// TODO: Provide a more accurate way to detect that cert-manager is ready to receive operations
-	time.Sleep(30 * time.Second)
-	return installErr
+	return targetFiles
 }
 
 // installCertManager triggers the installation of the cert manager YAML
 func (cmh *CertManagerHelper) installCertManagerFile(fileName string) derrors.Error {
+	obj, err := cmh.decodeCertManagerFile(fileName)
+	if err != nil {
+		return err
+	}
+	return cmh.Kubernetes.Create(obj)
+}
+
+// decodeCertManagerFile reads the resource contained in a cert manager YAML file.
+func (cmh *CertManagerHelper) decodeCertManagerFile(fileName string) (runtime.Object, derrors.Error) {
 	certManagerPath := path.Join(cmh.config.ResourcesPath, fileName)
 	f, err := os.Open(certManagerPath)
 	if err != nil {
-		return derrors.NewPermissionDeniedError("cannot read component file", err)
+		return nil, derrors.NewPermissionDeniedError("cannot read component file", err)
 	}
 	defer f.Close()
 	// We use a YAML decoder to decode the resource straight into an
@@ -204,7 +340,7 @@ func (cmh *CertManagerHelper) installCertManagerFile(fileName string) derrors.Er
 	yamlDecoder := yaml.NewYAMLOrJSONDecoder(f, 1024)
 	err = yamlDecoder.Decode(obj)
 	if err != nil {
-		return derrors.NewInvalidArgumentError("cannot parse component file", err)
+		return nil, derrors.NewInvalidArgumentError("cannot parse component file", err)
 	}
 	gvk := obj.GetObjectKind().GroupVersionKind()
 	log.Debug().Str("resource", gvk.String()).Msg("decoded resource")
@@ -218,10 +354,10 @@ func (cmh *CertManagerHelper) installCertManagerFile(fileName string) derrors.Er
 		// Ah, we can convert this to something specific to deal with!
 		err := clientScheme.Convert(obj, typed, nil)
 		if err != nil {
-			return derrors.NewInternalError("cannot convert resource to specific type", err)
+			return nil, derrors.NewInternalError("cannot convert resource to specific type", err)
 		}
 	}
-	return cmh.Kubernetes.Create(obj)
+	return obj, nil
 }
 
 // cleanupTempFile removes the temporal file storing the kubeconfig file.
@@ -278,8 +414,8 @@ func (cmh *CertManagerHelper) createServicePrincipalSecretOnAzure(
 			APIVersion: "v1",
 		},
 		ObjectMeta: metaV1.ObjectMeta{
-			Name:      "k8s-service-principal",
-			Namespace: "cert-manager",
+			Name:      ServicePrincipalSecret,
+			Namespace: CertManagerNamespace,
 		},
 		Data: map[string][]byte{
 			"client-secret": []byte(clientSecret),
@@ -316,6 +452,83 @@ func (cmh *CertManagerHelper) createCertificateIssuerOnAzure(
 
 }
 
+// RequestCertificateIssuerOnGCP creates the required entities in the cluster to request and issue a
+// certificate validated through Google Cloud DNS.
+func (cmh *CertManagerHelper) RequestCertificateIssuerOnGCP(projectID string, serviceAccountKey string, isProduction bool) derrors.Error {
+	err := cmh.createServiceAccountSecretOnGCP(serviceAccountKey)
+	if err != nil {
+		return err
+	}
+	letsEncryptURL := ProductionLetsEncryptURL
+	if !isProduction {
+		letsEncryptURL = StagingLetsEncryptURL
+	}
+	toCreate := strings.ReplaceAll(CloudDNSCertificateIssuerTemplate, LetsEncryptURLEntry, letsEncryptURL)
+	toCreate = strings.ReplaceAll(toCreate, ProjectIDEntry, projectID)
+	return cmh.Kubernetes.CreateUnstructure(toCreate)
+}
+
+// createServiceAccountSecretOnGCP creates a secret in Kubernetes with the service account used by the cert
+// manager to solve the DNS challenges.
+func (cmh *CertManagerHelper) createServiceAccountSecretOnGCP(serviceAccountKey string) derrors.Error {
+	opaqueSecret := &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      CloudDNSServiceAccountSecret,
+			Namespace: CertManagerNamespace,
+		},
+		Data: map[string][]byte{
+			CloudDNSServiceAccountKey: []byte(serviceAccountKey),
+		},
+		Type: v1.SecretTypeOpaque,
+	}
+	return cmh.Kubernetes.Create(opaqueSecret)
+}
+
+// RequestCertificateIssuerOnAWS creates the required entities in the cluster to request and issue a
+// certificate validated through a Route53 hosted zone.
+func (cmh *CertManagerHelper) RequestCertificateIssuerOnAWS(
+	region string, hostedZoneID string,
+	accessKeyID string, secretAccessKey string,
+	isProduction bool) derrors.Error {
+	err := cmh.createAccessKeySecretOnAWS(secretAccessKey)
+	if err != nil {
+		return err
+	}
+	letsEncryptURL := ProductionLetsEncryptURL
+	if !isProduction {
+		letsEncryptURL = StagingLetsEncryptURL
+	}
+	toCreate := strings.ReplaceAll(Route53CertificateIssuerTemplate, LetsEncryptURLEntry, letsEncryptURL)
+	toCreate = strings.ReplaceAll(toCreate, RegionEntry, region)
+	toCreate = strings.ReplaceAll(toCreate, HostedZoneIDEntry, hostedZoneID)
+	toCreate = strings.ReplaceAll(toCreate, AccessKeyIDEntry, accessKeyID)
+	return cmh.Kubernetes.CreateUnstructure(toCreate)
+}
+
+// createAccessKeySecretOnAWS creates a secret in Kubernetes with the secret access key used by the cert manager
+// to solve the DNS challenges.
+func (cmh *CertManagerHelper) createAccessKeySecretOnAWS(secretAccessKey string) derrors.Error {
+	opaqueSecret := &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      Route53CredentialsSecret,
+			Namespace: CertManagerNamespace,
+		},
+		Data: map[string][]byte{
+			Route53SecretAccessKey: []byte(secretAccessKey),
+		},
+		Type: v1.SecretTypeOpaque,
+	}
+	return cmh.Kubernetes.Create(opaqueSecret)
+}
+
 // CheckCertificateIssuer waits for the certificate to be issued by the authority
 func (cmh *CertManagerHelper) CheckCertificateIssuer() derrors.Error {
 	issued, err := cmh.Kubernetes.MatchCRDStatus(
@@ -336,11 +549,29 @@ func (cmh *CertManagerHelper) CheckCertificateIssuer() derrors.Error {
 
 // CreateCertificate creates a new certificate request for a given cluster and dnsZone
 func (cmh *CertManagerHelper) CreateCertificate(clusterName string, dnsZone string) derrors.Error {
+	return cmh.createCertificate(clusterName, dnsZone, AzureDNSProvider)
+}
+
+// CreateCertificateOnGCP creates a new certificate request for a given cluster and dnsZone validated through
+// Google Cloud DNS.
+func (cmh *CertManagerHelper) CreateCertificateOnGCP(clusterName string, dnsZone string) derrors.Error {
+	return cmh.createCertificate(clusterName, dnsZone, CloudDNSProvider)
+}
+
+// CreateCertificateOnAWS creates a new certificate request for a given cluster and dnsZone validated through
+// Route53.
+func (cmh *CertManagerHelper) CreateCertificateOnAWS(clusterName string, dnsZone string) derrors.Error {
+	return cmh.createCertificate(clusterName, dnsZone, Route53DNSProvider)
+}
+
+// createCertificate creates a new certificate request solved by the given DNS01 provider of the issuer.
+func (cmh *CertManagerHelper) createCertificate(clusterName string, dnsZone string, dnsProvider string) derrors.Error {
 	err := cmh.Kubernetes.CreateNamespaceIfNotExists("nalej")
 	if err != nil {
 		return err
 	}
 	toCreate := strings.ReplaceAll(CertificateTemplate, DNSZoneEntry, dnsZone)
+	toCreate = strings.ReplaceAll(toCreate, DNSProviderEntry, dnsProvider)
 	toCreate = strings.ReplaceAll(toCreate, ClusterNameEntry, clusterName)
 	toCreate = strings.ReplaceAll(toCreate, ClientCertificateEntry, ClientCertificate)
 	return cmh.Kubernetes.CreateUnstructure(toCreate)
@@ -412,3 +643,68 @@ func (cmh *CertManagerHelper) CreateCASecret(isProduction bool) derrors.Error {
 
 	return nil
 }
+
+// certificateIssuerResource identifies the ClusterIssuer resources.
+var certificateIssuerResource = schema.GroupVersionResource{Group: "certmanager.k8s.io", Version: "v1alpha1", Resource: "clusterissuers"}
+
+// certificateResource identifies the Certificate resources.
+var certificateResource = schema.GroupVersionResource{Group: "certmanager.k8s.io", Version: "v1alpha1", Resource: "certificates"}
+
+// secretResource identifies the Secret resources.
+var secretResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// CertificateIssuerExists checks if the cluster already has a certificate issuer.
+func (cmh *CertManagerHelper) CertificateIssuerExists() (bool, derrors.Error) {
+	return cmh.Kubernetes.ExistsResource(certificateIssuerResource, "", CertificateIssuerName)
+}
+
+// CertificateExists checks if the cluster already has a certificate.
+func (cmh *CertManagerHelper) CertificateExists() (bool, derrors.Error) {
+	return cmh.Kubernetes.ExistsResource(certificateResource, CertificateNamespace, ClientCertificate)
+}
+
+// CASecretExists checks if the cluster already has the CA certificate secret.
+func (cmh *CertManagerHelper) CASecretExists() (bool, derrors.Error) {
+	return cmh.Kubernetes.ExistsResource(secretResource, CertificateNamespace, CACertificate)
+}
+
+// DeleteCertificateIssuerOnAzure removes the ClusterIssuer and the secret created by RequestCertificateIssuerOnAzure.
+func (cmh *CertManagerHelper) DeleteCertificateIssuerOnAzure() derrors.Error {
+	err := cmh.Kubernetes.DeleteResource(certificateIssuerResource, "", CertificateIssuerName)
+	if err != nil {
+		return err
+	}
+	return cmh.Kubernetes.DeleteResource(secretResource, CertManagerNamespace, ServicePrincipalSecret)
+}
+
+// DeleteCertificateIssuerOnGCP removes the ClusterIssuer and the secret created by RequestCertificateIssuerOnGCP.
+func (cmh *CertManagerHelper) DeleteCertificateIssuerOnGCP() derrors.Error {
+	err := cmh.Kubernetes.DeleteResource(certificateIssuerResource, "", CertificateIssuerName)
+	if err != nil {
+		return err
+	}
+	return cmh.Kubernetes.DeleteResource(secretResource, CertManagerNamespace, CloudDNSServiceAccountSecret)
+}
+
+// DeleteCertificateIssuerOnAWS removes the ClusterIssuer and the secret created by RequestCertificateIssuerOnAWS.
+func (cmh *CertManagerHelper) DeleteCertificateIssuerOnAWS() derrors.Error {
+	err := cmh.Kubernetes.DeleteResource(certificateIssuerResource, "", CertificateIssuerName)
+	if err != nil {
+		return err
+	}
+	return cmh.Kubernetes.DeleteResource(secretResource, CertManagerNamespace, Route53CredentialsSecret)
+}
+
+// DeleteCertificate removes the cluster certificate and the secret issued for it.
+func (cmh *CertManagerHelper) DeleteCertificate() derrors.Error {
+	err := cmh.Kubernetes.DeleteResource(certificateResource, CertificateNamespace, ClientCertificate)
+	if err != nil {
+		return err
+	}
+	return cmh.Kubernetes.DeleteResource(secretResource, CertificateNamespace, ClientCertificate)
+}
+
+// DeleteCASecret removes the secret created by CreateCASecret.
+func (cmh *CertManagerHelper) DeleteCASecret() derrors.Error {
+	return cmh.Kubernetes.DeleteResource(secretResource, CertificateNamespace, CACertificate)
+}
@@ -21,6 +21,9 @@ import (
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/context"
 )
@@ -34,13 +37,30 @@ func NewHandler(manager Manager) *Handler {
 }
 
 func (h *Handler) DecommissionCluster(ctx context.Context, request *grpc_provisioner_go.DecommissionClusterRequest) (*grpc_common_go.OpResponse, error) {
-	err := entities.ValidDecommissionClusterRequest(request)
+	ctx, span := tracing.StartSpan(ctx, "decommissioner.Handler.DecommissionCluster",
+		tracing.RequestAttributes(request.RequestId, request.OrganizationId, request.ClusterId)...)
+	defer span.End()
+	profileID, err := profiles.IDFromContext(ctx)
+	if err == nil {
+		err = entities.ValidDecommissionClusterRequest(request, profileID)
+	}
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
 		return nil, conversions.ToGRPCError(err)
 	}
-	log.Debug().Interface("request", request).Msg("decommission cluster")
-	return h.Manager.DecommissionCluster(request)
+	webhooks, err := h.Manager.Webhooks.URLsFromContext(ctx)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	log.Debug().Interface("request", redact.Value(request)).Msg("decommission cluster")
+	response, err := h.Manager.DecommissionCluster(ctx, request, profileID, webhooks)
+	if err != nil {
+		return nil, tracing.Fail(span, err)
+	}
+	return response, nil
 }
 
 func (h *Handler) CheckProgress(_ context.Context, request *grpc_common_go.RequestId) (*grpc_common_go.OpResponse, error) {
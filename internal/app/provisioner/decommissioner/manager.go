@@ -17,12 +17,15 @@
 package decommissioner
 
 import (
+	"context"
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
 	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"sync"
@@ -32,21 +35,36 @@ import (
 type Manager struct {
 	sync.Mutex
 	Config   config.Config
-	Executor workflow.Executor
-	// Operation per request identifier.
-	Operation map[string]entities.InfrastructureOperation
+	Executor *workflow.Executor
+	// Registry shared by the managers with the operations per request identifier.
+	Registry *workflow.Registry
+	// Webhooks notified when the operations finish.
+	Webhooks *webhook.Dispatcher
 }
 
 func NewManager(config config.Config) Manager {
+	executor := workflow.GetExecutor()
+	registry := workflow.GetRegistry()
+	// Recover the operations from previous executions of the provisioner.
+	for _, restored := range executor.RestoredOperations(entities.Decommission) {
+		registry.Put(restored)
+	}
 	return Manager{
-		Config:    config,
-		Executor:  workflow.GetExecutor(),
-		Operation: make(map[string]entities.InfrastructureOperation, 0),
+		Config:   config,
+		Executor: executor,
+		Registry: registry,
+		Webhooks: webhook.GetDispatcher(),
 	}
 }
 
-func (m *Manager) DecommissionCluster(request *grpc_provisioner_go.DecommissionClusterRequest) (*grpc_common_go.OpResponse, derrors.Error) {
-	infraProvider, err := provider.NewInfrastructureProvider(request.TargetPlatform, request.AzureCredentials, &m.Config)
+// DecommissionCluster triggers the removal of a given cluster. The credentials are taken from the referenced
+// credentials profile, if any. The webhooks are notified when the operation finishes.
+func (m *Manager) DecommissionCluster(ctx context.Context, request *grpc_provisioner_go.DecommissionClusterRequest, profileID string, webhooks []string) (*grpc_common_go.OpResponse, derrors.Error) {
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(request.TargetPlatform), provider.Credentials{
+		AzureCredentials: request.AzureCredentials,
+		ProfileID:        profileID,
+		OrganizationID:   request.OrganizationId,
+	}, &m.Config)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +76,17 @@ func (m *Manager) DecommissionCluster(request *grpc_provisioner_go.DecommissionC
 	m.Lock()
 	defer m.Unlock()
 
-	_, exists := m.Operation[request.RequestId]
-	if exists {
+	if m.Registry.Exists(request.RequestId) {
 		return nil, derrors.NewAlreadyExistsError("request is already being processed")
 	}
-	m.Operation[request.RequestId] = operation
 	// schedule the operation for execution
-	m.Executor.ScheduleOperation(operation)
+	m.Webhooks.Subscribe(request.RequestId, webhooks)
+	err = m.Executor.ScheduleOperationContext(ctx, operation)
+	if err != nil {
+		m.Webhooks.Unsubscribe(request.RequestId)
+		return nil, err
+	}
+	m.Registry.Put(operation)
 	// return initial response for the request
 	response := &grpc_common_go.OpResponse{
 		OrganizationId: request.GetOrganizationId(),
@@ -79,21 +101,44 @@ func (m *Manager) DecommissionCluster(request *grpc_provisioner_go.DecommissionC
 func (m *Manager) CheckProgress(request *grpc_common_go.RequestId) (*grpc_common_go.OpResponse, derrors.Error) {
 	m.Lock()
 	defer m.Unlock()
-	operation, exists := m.Operation[request.RequestId]
+	operation, exists := m.Registry.Get(request.RequestId, entities.Decommission)
 	if !exists {
 		return nil, derrors.NewNotFoundError("request_id not found")
 	}
 	result := operation.Result()
+	m.Executor.SetSchedulingState(&result)
 	return result.ToOpResponse()
 }
 
+// RemoveDecommission cancels an ongoing decommission or removes the information of an already processed one.
 func (m *Manager) RemoveDecommission(request *grpc_common_go.RequestId) (*grpc_common_go.Success, derrors.Error) {
 	m.Lock()
 	defer m.Unlock()
-	_, exists := m.Operation[request.GetRequestId()]
+	_, exists := m.Registry.Get(request.GetRequestId(), entities.Decommission)
 	if !exists {
 		return nil, derrors.NewNotFoundError("request_id not found")
 	}
-	delete(m.Operation, request.GetRequestId())
+	if m.Executor.IsManaged(request.GetRequestId()) {
+		// The operation is kept so that the cancellation can be checked with CheckProgress.
+		err := m.Executor.CancelOperation(request.GetRequestId())
+		if err != nil {
+			return nil, err
+		}
+		return &grpc_common_go.Success{}, nil
+	}
+	m.Registry.Remove(request.GetRequestId())
+	m.Executor.ForgetOperation(request.GetRequestId())
 	return &grpc_common_go.Success{}, nil
 }
+
+// WatchOperation sends the log entries and progress changes of a decommission operation to a stream until the
+// operation finishes.
+func (m *Manager) WatchOperation(requestID *grpc_common_go.RequestId, stream watch.Stream) derrors.Error {
+	m.Lock()
+	operation, exists := m.Registry.Get(requestID.RequestId, entities.Decommission)
+	m.Unlock()
+	if !exists {
+		return derrors.NewNotFoundError("request_id not found")
+	}
+	return watch.Serve(watch.GetHub(), operation, stream)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nalej/derrors"
+)
+
+// statusClientClosedRequest with the non standard status used when the client canceled the request.
+const statusClientClosedRequest = 499
+
+// errorStatus maps the types of error into HTTP status codes. Failed preconditions refer to the state of the
+// operations, such as resuming one that did not fail, so they are reported as conflicts. The 412 status is
+// reserved for the conditional request headers.
+var errorStatus = map[derrors.ErrorType]int{
+	derrors.Generic:            http.StatusInternalServerError,
+	derrors.Canceled:           statusClientClosedRequest,
+	derrors.InvalidArgument:    http.StatusBadRequest,
+	derrors.DeadlineExceeded:   http.StatusGatewayTimeout,
+	derrors.NotFound:           http.StatusNotFound,
+	derrors.AlreadyExists:      http.StatusConflict,
+	derrors.PermissionDenied:   http.StatusForbidden,
+	derrors.ResourceExhausted:  http.StatusTooManyRequests,
+	derrors.FailedPrecondition: http.StatusConflict,
+	derrors.Aborted:            http.StatusConflict,
+	derrors.OutOfRange:         http.StatusBadRequest,
+	derrors.Unimplemented:      http.StatusNotImplemented,
+	derrors.Internal:           http.StatusInternalServerError,
+	derrors.Unavailable:        http.StatusServiceUnavailable,
+	derrors.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the HTTP status code corresponding to a type of error.
+func HTTPStatus(errorType derrors.ErrorType) int {
+	code, exists := errorStatus[errorType]
+	if !exists {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+// writeError writes an error as the JSON response of a call.
+func writeError(w http.ResponseWriter, err derrors.Error) {
+	if err.Type() == derrors.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(err.Type()))
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		Type:    derrors.ErrorTypeAsString(err.Type()),
+		Message: err.Error(),
+	})
+}
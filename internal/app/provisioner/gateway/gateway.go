@@ -0,0 +1,305 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package gateway exposes the provisioner API as JSON over HTTP for the clients that cannot use gRPC. The calls
+// go through the same handlers and interceptors as the gRPC API.
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/app/provisioner/provisioner"
+	"github.com/nalej/provisioner/internal/pkg/auth"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// ProvisionPath with the prefix of the provisioning endpoints.
+	ProvisionPath = "/v1/provision"
+	// ScalePath with the prefix of the scaling endpoints.
+	ScalePath = "/v1/scale"
+	// DecommissionPath with the prefix of the decommission endpoints.
+	DecommissionPath = "/v1/decommission"
+	// KubeConfigPath with the endpoint returning the kubeconfig of a cluster.
+	KubeConfigPath = "/v1/kubeconfig"
+)
+
+// MaxRequestSize with the maximum size of the body of a request.
+const MaxRequestSize = 1 << 20
+
+// forwardedHeaders contains the HTTP headers passed to the handlers as gRPC metadata.
+var forwardedHeaders = []string{
+	auth.AuthorizationMetadataKey,
+	profiles.MetadataKey,
+	webhook.URLMetadataKey,
+	provisioner.RollbackOnFailureMetadataKey,
+}
+
+// marshaler encodes the responses using the field names of the protocol buffers.
+var marshaler = jsonpb.Marshaler{OrigName: true}
+
+// unmarshaler decodes the requests rejecting unknown fields.
+var unmarshaler = jsonpb.Unmarshaler{}
+
+// Servers with the implementation of the gRPC services exposed by the gateway.
+type Servers struct {
+	Provision    grpc_provisioner_go.ProvisionServer
+	Scale        grpc_provisioner_go.ScaleServer
+	Decommission grpc_provisioner_go.DecommissionServer
+	Management   grpc_provisioner_go.ManagementServer
+}
+
+// Gateway translating HTTP requests into calls to the gRPC handlers.
+type Gateway struct {
+	servers Servers
+	// interceptor applied to every call, as the gRPC server does. It may be nil.
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// NewGateway creates a gateway for a set of servers applying the interceptor of the gRPC server.
+func NewGateway(servers Servers, interceptor grpc.UnaryServerInterceptor) *Gateway {
+	return &Gateway{
+		servers:     servers,
+		interceptor: interceptor,
+	}
+}
+
+// ErrorResponse with the body returned when a call fails.
+type ErrorResponse struct {
+	// Type of the error, e.g. NotFound.
+	Type string `json:"type"`
+	// Message of the error.
+	Message string `json:"message"`
+}
+
+// Handler returns the HTTP handler serving the endpoints of the gateway. Each resource accepts POST to create an
+// operation, and GET and DELETE on /{requestID} to check its progress and remove it.
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(ProvisionPath, g.collection("/provisioner.Provision/ProvisionCluster",
+		func() proto.Message { return &grpc_provisioner_go.ProvisionClusterRequest{} },
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Provision.ProvisionCluster(ctx, req.(*grpc_provisioner_go.ProvisionClusterRequest))
+		}))
+	mux.Handle(ProvisionPath+"/", g.operation(ProvisionPath, "/provisioner.Provision/CheckProgress", "/provisioner.Provision/RemoveProvision",
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Provision.CheckProgress(ctx, req.(*grpc_common_go.RequestId))
+		},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Provision.RemoveProvision(ctx, req.(*grpc_common_go.RequestId))
+		}))
+	mux.Handle(ScalePath, g.collection("/provisioner.Scale/ScaleCluster",
+		func() proto.Message { return &grpc_provisioner_go.ScaleClusterRequest{} },
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Scale.ScaleCluster(ctx, req.(*grpc_provisioner_go.ScaleClusterRequest))
+		}))
+	mux.Handle(ScalePath+"/", g.operation(ScalePath, "/provisioner.Scale/CheckProgress", "/provisioner.Scale/RemoveScale",
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Scale.CheckProgress(ctx, req.(*grpc_common_go.RequestId))
+		},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Scale.RemoveScale(ctx, req.(*grpc_common_go.RequestId))
+		}))
+	mux.Handle(DecommissionPath, g.collection("/provisioner.Decommission/DecommissionCluster",
+		func() proto.Message { return &grpc_provisioner_go.DecommissionClusterRequest{} },
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Decommission.DecommissionCluster(ctx, req.(*grpc_provisioner_go.DecommissionClusterRequest))
+		}))
+	mux.Handle(DecommissionPath+"/", g.operation(DecommissionPath, "/provisioner.Decommission/CheckProgress", "/provisioner.Decommission/RemoveDecommission",
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Decommission.CheckProgress(ctx, req.(*grpc_common_go.RequestId))
+		},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Decommission.RemoveDecommission(ctx, req.(*grpc_common_go.RequestId))
+		}))
+	mux.Handle(KubeConfigPath, g.collection("/provisioner.Management/GetKubeConfig",
+		func() proto.Message { return &grpc_provisioner_go.ClusterRequest{} },
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.servers.Management.GetKubeConfig(ctx, req.(*grpc_provisioner_go.ClusterRequest))
+		}))
+	return mux
+}
+
+// collection returns the handler of an endpoint receiving a JSON request through POST.
+func (g *Gateway) collection(fullMethod string, newRequest func() proto.Message, call grpc.UnaryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		request := newRequest()
+		body := http.MaxBytesReader(w, r.Body, MaxRequestSize)
+		if err := unmarshaler.Unmarshal(body, request); err != nil && err != io.EOF {
+			writeError(w, derrors.NewInvalidArgumentError("invalid request body", err))
+			return
+		}
+		g.invoke(w, r, fullMethod, request, call)
+	})
+}
+
+// operation returns the handler of the endpoints of an operation identified by the request ID in the path.
+func (g *Gateway) operation(prefix string, getMethod string, deleteMethod string, get grpc.UnaryHandler, remove grpc.UnaryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := strings.TrimPrefix(r.URL.Path, prefix+"/")
+		if requestID == "" || strings.Contains(requestID, "/") {
+			writeError(w, derrors.NewNotFoundError("unknown endpoint").WithParams(r.URL.Path))
+			return
+		}
+		request := &grpc_common_go.RequestId{RequestId: requestID}
+		switch r.Method {
+		case http.MethodGet:
+			g.invoke(w, r, getMethod, request, get)
+		case http.MethodDelete:
+			g.invoke(w, r, deleteMethod, request, remove)
+		default:
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	})
+}
+
+// invoke calls a handler through the interceptor and writes its response.
+func (g *Gateway) invoke(w http.ResponseWriter, r *http.Request, fullMethod string, request interface{}, call grpc.UnaryHandler) {
+	stream := &headerStream{method: fullMethod, header: metadata.MD{}}
+	ctx := grpc.NewContextWithServerTransportStream(incomingContext(r), stream)
+	var response interface{}
+	var err error
+	if g.interceptor != nil {
+		response, err = g.interceptor(ctx, request, &grpc.UnaryServerInfo{FullMethod: fullMethod}, call)
+	} else {
+		response, err = call(ctx, request)
+	}
+	for key, values := range stream.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if err != nil {
+		writeError(w, conversions.ToDerror(err))
+		return
+	}
+	message, ok := response.(proto.Message)
+	if !ok {
+		writeError(w, derrors.NewInternalError("unexpected response type").WithParams(fullMethod))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if mErr := marshaler.Marshal(w, message); mErr != nil {
+		log.Warn().Str("method", fullMethod).Err(mErr).Msg("cannot write gateway response")
+	}
+}
+
+// incomingContext creates the context of a call with the forwarded headers as metadata and the caller as peer.
+func incomingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, key := range forwardedHeaders {
+		if values := r.Header[http.CanonicalHeaderKey(key)]; len(values) > 0 {
+			md.Append(key, values...)
+		}
+	}
+	caller := &peer.Peer{Addr: httpAddr(r.RemoteAddr)}
+	if r.TLS != nil {
+		caller.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	return peer.NewContext(ctx, caller)
+}
+
+// TLSConfig returns the TLS configuration of the gateway based on the one of the gRPC server, which only
+// negotiates HTTP/2.
+func TLSConfig(server *tls.Config) *tls.Config {
+	return &tls.Config{
+		MinVersion: server.MinVersion,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			config := server
+			if server.GetConfigForClient != nil {
+				clientConfig, err := server.GetConfigForClient(hello)
+				if err != nil {
+					return nil, err
+				}
+				if clientConfig != nil {
+					config = clientConfig
+				}
+			}
+			config = config.Clone()
+			config.NextProtos = []string{"h2", "http/1.1"}
+			return config, nil
+		},
+	}
+}
+
+// writeMethodNotAllowed rejects a request with a method not supported by the endpoint.
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	_, _ = io.WriteString(w, `{"type":"Unimplemented","message":"method not allowed"}`)
+}
+
+// httpAddr with the address of an HTTP client.
+type httpAddr string
+
+// Network returns the name of the network.
+func (a httpAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address.
+func (a httpAddr) String() string {
+	return string(a)
+}
+
+// headerStream captures the headers set by the handlers so that they are returned as HTTP headers.
+type headerStream struct {
+	method string
+	header metadata.MD
+}
+
+// Method returns the name of the method being called.
+func (hs *headerStream) Method() string {
+	return hs.method
+}
+
+// SetHeader adds headers to the response.
+func (hs *headerStream) SetHeader(md metadata.MD) error {
+	hs.header = metadata.Join(hs.header, md)
+	return nil
+}
+
+// SendHeader adds headers to the response. Headers are sent along with the response.
+func (hs *headerStream) SendHeader(md metadata.MD) error {
+	return hs.SetHeader(md)
+}
+
+// SetTrailer ignores the trailers as they are not supported by the gateway.
+func (hs *headerStream) SetTrailer(_ metadata.MD) error {
+	return nil
+}
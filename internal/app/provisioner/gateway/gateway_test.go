@@ -0,0 +1,145 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// testProvisionServer records the calls received by the provision service.
+type testProvisionServer struct {
+	request *grpc_provisioner_go.ProvisionClusterRequest
+	md      metadata.MD
+}
+
+func (tps *testProvisionServer) ProvisionCluster(ctx context.Context, request *grpc_provisioner_go.ProvisionClusterRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
+	tps.request = request
+	tps.md, _ = metadata.FromIncomingContext(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-queue-position", "2"))
+	return &grpc_provisioner_go.ProvisionClusterResponse{RequestId: "req1", ClusterName: request.ClusterName}, nil
+}
+
+func (tps *testProvisionServer) CheckProgress(_ context.Context, requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
+	if requestID.RequestId != "req1" {
+		return nil, conversions.ToGRPCError(derrors.NewNotFoundError("request_id not found"))
+	}
+	return &grpc_provisioner_go.ProvisionClusterResponse{RequestId: requestID.RequestId}, nil
+}
+
+func (tps *testProvisionServer) RemoveProvision(_ context.Context, requestID *grpc_common_go.RequestId) (*grpc_common_go.Success, error) {
+	if requestID.RequestId == "running" {
+		return nil, conversions.ToGRPCError(derrors.NewFailedPreconditionError("cannot remove an ongoing operation"))
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+var _ = ginkgo.Describe("HTTP gateway", func() {
+
+	var server *testProvisionServer
+	var handler http.Handler
+	var intercepted []string
+
+	ginkgo.BeforeEach(func() {
+		server = &testProvisionServer{}
+		intercepted = make([]string, 0)
+		interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			intercepted = append(intercepted, info.FullMethod)
+			return handler(ctx, req)
+		}
+		handler = NewGateway(Servers{Provision: server}, interceptor).Handler()
+	})
+
+	// send performs a request against the gateway.
+	send := func(method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	ginkgo.It("provisions a cluster through the interceptor", func() {
+		response := send(http.MethodPost, ProvisionPath, `{"organization_id": "org1", "cluster_name": "app"}`,
+			map[string]string{"Authorization": "Bearer token", "X-Credentials-Profile": "azure-prod"})
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(intercepted).To(gomega.Equal([]string{"/provisioner.Provision/ProvisionCluster"}))
+		gomega.Expect(server.request.OrganizationId).To(gomega.Equal("org1"))
+		gomega.Expect(server.md.Get("authorization")).To(gomega.Equal([]string{"Bearer token"}))
+		gomega.Expect(server.md.Get(profiles.MetadataKey)).To(gomega.Equal([]string{"azure-prod"}))
+		gomega.Expect(response.Header().Get("X-Queue-Position")).To(gomega.Equal("2"))
+		result := map[string]interface{}{}
+		gomega.Expect(json.Unmarshal(response.Body.Bytes(), &result)).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("request_id", "req1"))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("cluster_name", "app"))
+	})
+
+	ginkgo.It("maps the errors into HTTP status codes", func() {
+		response := send(http.MethodGet, ProvisionPath+"/other", "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusNotFound))
+		result := ErrorResponse{}
+		gomega.Expect(json.Unmarshal(response.Body.Bytes(), &result)).To(gomega.Succeed())
+		gomega.Expect(result.Type).To(gomega.Equal("NotFound"))
+
+		response = send(http.MethodGet, ProvisionPath+"/req1", "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusOK))
+		response = send(http.MethodDelete, ProvisionPath+"/req1", "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(intercepted).To(gomega.ContainElement("/provisioner.Provision/RemoveProvision"))
+
+		// Failed preconditions are conflicts with the state of the operation.
+		response = send(http.MethodDelete, ProvisionPath+"/running", "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusConflict))
+		gomega.Expect(json.Unmarshal(response.Body.Bytes(), &result)).To(gomega.Succeed())
+		gomega.Expect(result.Type).To(gomega.Equal("FailedPrecondition"))
+	})
+
+	ginkgo.It("rejects invalid requests", func() {
+		response := send(http.MethodPost, ProvisionPath, `{"unknown_field": true}`, nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusBadRequest))
+		response = send(http.MethodGet, ProvisionPath, "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusMethodNotAllowed))
+		response = send(http.MethodPut, ProvisionPath+"/req1", "", nil)
+		gomega.Expect(response.Code).To(gomega.Equal(http.StatusMethodNotAllowed))
+		gomega.Expect(intercepted).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("maps every type of error", func() {
+		gomega.Expect(HTTPStatus(derrors.Unauthenticated)).To(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(HTTPStatus(derrors.PermissionDenied)).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(HTTPStatus(derrors.Unavailable)).To(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(HTTPStatus(derrors.FailedPrecondition)).To(gomega.Equal(http.StatusConflict))
+		for errorType := range derrors.ErrorTypeNames {
+			gomega.Expect(HTTPStatus(errorType)).To(gomega.BeNumerically(">=", 400))
+		}
+	})
+})
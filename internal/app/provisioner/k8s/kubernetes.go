@@ -18,6 +18,7 @@ package k8s
 
 import (
 	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/redact"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"strings"
 	"time"
@@ -32,6 +33,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/tidwall/gjson"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -228,39 +230,147 @@ func (k *Kubernetes) Create(obj runtime.Object) derrors.Error {
 		return nil
 	}
 
+	client, derr := k.resourceClient(gvk, unstructuredObj.GetNamespace())
+	if derr != nil {
+		return derr
+	}
+
+	log.Debug().Interface("obj", redact.Value(unstructuredObj)).Msg("creating resource")
+
+	created, err := client.Create(unstructuredObj, metaV1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// Existing resources are accepted so that resumed operations can create them again.
+		log.Debug().Str("resource", gvk.String()).Str("name", unstructuredObj.GetName()).Msg("resource already exists")
+		return nil
+	}
+	if err != nil {
+		return derrors.NewInternalError("unable to create object", err).WithParams(unstructuredObj)
+	}
+
+	log.Debug().Str("resource", created.GetSelfLink()).Interface("groupVersionKind", created.GroupVersionKind()).Msg("created")
+
+	return nil
+}
+
+// Delete removes the resource described by an object. Missing resources are accepted so that interrupted
+// operations can delete them again.
+func (k *Kubernetes) Delete(obj runtime.Object) derrors.Error {
+	unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot convert object to unstructured", err)
+	}
+	unstructuredObj := &unstructured.Unstructured{
+		Object: unstructuredMap,
+	}
+	gvk, derr := getKind(obj)
+	if derr != nil {
+		return derr
+	}
+	client, derr := k.resourceClient(gvk, unstructuredObj.GetNamespace())
+	if derr != nil {
+		return derr
+	}
+	err = client.Delete(unstructuredObj.GetName(), &metaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return derrors.NewInternalError("unable to delete object", err).WithParams(gvk.String(), unstructuredObj.GetName())
+	}
+	log.Debug().Str("resource", gvk.String()).Str("name", unstructuredObj.GetName()).Msg("deleted")
+	return nil
+}
+
+// resourceClient obtains the client of the REST endpoint of a kind of resource.
+func (k *Kubernetes) resourceClient(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, derrors.Error) {
 	// Create the REST mapper through a discovery client
 	// We do this every time we create a resource, because if we created
 	// a custom resource definition in a previous step, we need to
 	// update the list of supported resources.
 	resources, err := restmapper.GetAPIGroupResources(k.discoveryClient)
 	if err != nil {
-		return derrors.NewInternalError("failed to get api group resources", err)
+		return nil, derrors.NewInternalError("failed to get api group resources", err)
 	}
 	mapper := restmapper.NewDiscoveryRESTMapper(resources)
 
 	// Get the right REST endpoint through the mapper
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return derrors.NewInternalError("unable to get REST mapping for object", err).WithParams(unstructuredObj)
+		return nil, derrors.NewInternalError("unable to get REST mapping for object", err).WithParams(gvk.String())
 	}
-
-	var client dynamic.ResourceInterface
-	namespace := unstructuredObj.GetNamespace()
 	if namespace != "" {
-		client = k.dynClient.Resource(mapping.Resource).Namespace(namespace)
-	} else {
-		client = k.dynClient.Resource(mapping.Resource)
+		return k.dynClient.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return k.dynClient.Resource(mapping.Resource), nil
+}
+
+// ExistsResource checks if a resource exists.
+func (k *Kubernetes) ExistsResource(resource schema.GroupVersionResource, namespace string, name string) (bool, derrors.Error) {
+	_, err := k.namespacedResource(resource, namespace).Get(name, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
 	}
+	if err != nil {
+		return false, derrors.NewInternalError("cannot retrieve resource", err).WithParams(resource.String(), namespace, name)
+	}
+	return true, nil
+}
 
-	log.Debug().Interface("obj", unstructuredObj).Msg("creating resource")
+// DeleteResource removes a resource. Missing resources are accepted so that interrupted operations can delete
+// them again.
+func (k *Kubernetes) DeleteResource(resource schema.GroupVersionResource, namespace string, name string) derrors.Error {
+	err := k.namespacedResource(resource, namespace).Delete(name, &metaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return derrors.NewInternalError("cannot delete resource", err).WithParams(resource.String(), namespace, name)
+	}
+	log.Debug().Str("resource", resource.String()).Str("namespace", namespace).Str("name", name).Msg("deleted")
+	return nil
+}
 
-	created, err := client.Create(unstructuredObj, metaV1.CreateOptions{})
+// namespacedResource returns the client of a resource in a namespace, or of a cluster resource if the namespace
+// is empty.
+func (k *Kubernetes) namespacedResource(resource schema.GroupVersionResource, namespace string) dynamic.ResourceInterface {
+	if namespace == "" {
+		return k.dynClient.Resource(resource)
+	}
+	return k.dynClient.Resource(resource).Namespace(namespace)
+}
+
+// GetConfigMap retrieves a config map.
+func (k *Kubernetes) GetConfigMap(namespace string, name string) (*v1.ConfigMap, derrors.Error) {
+	configMap, err := k.Client.CoreV1().ConfigMaps(namespace).Get(name, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, derrors.NewNotFoundError("config map not found").WithParams(namespace, name)
+	}
 	if err != nil {
-		return derrors.NewInternalError("unable to create object", err).WithParams(unstructuredObj)
+		return nil, derrors.AsError(err, "cannot retrieve config map")
 	}
+	return configMap, nil
+}
 
-	log.Debug().Str("resource", created.GetSelfLink()).Interface("groupVersionKind", created.GroupVersionKind()).Msg("created")
+// ApplyConfigMap creates a config map or replaces its data if it already exists.
+func (k *Kubernetes) ApplyConfigMap(configMap *v1.ConfigMap) derrors.Error {
+	client := k.Client.CoreV1().ConfigMaps(configMap.Namespace)
+	existing, err := client.Get(configMap.Name, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if _, err := client.Create(configMap); err != nil {
+			return derrors.AsError(err, "cannot create config map")
+		}
+		return nil
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot retrieve config map")
+	}
+	existing.Data = configMap.Data
+	if _, err := client.Update(existing); err != nil {
+		return derrors.AsError(err, "cannot update config map")
+	}
+	return nil
+}
 
+// DeleteConfigMap removes a config map. Missing config maps are accepted.
+func (k *Kubernetes) DeleteConfigMap(namespace string, name string) derrors.Error {
+	err := k.Client.CoreV1().ConfigMaps(namespace).Delete(name, &metaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return derrors.AsError(err, "cannot delete config map")
+	}
 	return nil
 }
 
@@ -321,7 +431,7 @@ func (k *Kubernetes) MatchCRDStatus(namespace string, group string, version stri
 		if err != nil {
 			log.Warn().Err(err).Msg("unable to retrieve resource")
 		} else {
-			log.Debug().Interface("raw", unstructure.Object).Msg("resource retrieved")
+			log.Debug().Interface("raw", redact.Value(unstructure.Object)).Msg("resource retrieved")
 			matches := k.MatchUnstructuredField(unstructure, key, expected)
 			log.Debug().Bool("match", matches).Msg("CRD status")
 			if matches {
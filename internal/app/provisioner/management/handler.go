@@ -21,6 +21,8 @@ import (
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/context"
 )
@@ -34,11 +36,22 @@ func NewHandler(manager Manager) *Handler {
 }
 
 // GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
-func (h *Handler) GetKubeConfig(_ context.Context, request *grpc_provisioner_go.ClusterRequest) (*grpc_provisioner_go.KubeConfigResponse, error) {
-	err := entities.ValidClusterRequest(request)
+func (h *Handler) GetKubeConfig(ctx context.Context, request *grpc_provisioner_go.ClusterRequest) (*grpc_provisioner_go.KubeConfigResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "management.Handler.GetKubeConfig",
+		tracing.RequestAttributes(request.RequestId, request.OrganizationId, request.ClusterId)...)
+	defer span.End()
+	profileID, err := profiles.IDFromContext(ctx)
+	if err == nil {
+		err = entities.ValidClusterRequest(request, profileID)
+	}
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
 		return nil, conversions.ToGRPCError(err)
 	}
-	return h.Manager.GetKubeConfig(request)
+	response, err := h.Manager.GetKubeConfig(ctx, request, profileID)
+	if err != nil {
+		return nil, tracing.Fail(span, err)
+	}
+	return response, nil
 }
@@ -18,11 +18,13 @@
 package management
 
 import (
+	"context"
 	"github.com/nalej/derrors"
 	grpc_provisioner_go "github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"sync"
 	"time"
@@ -32,11 +34,14 @@ import (
 type Manager struct {
 	sync.Mutex
 	Config config.Config
+	// Registry shared by the managers so that management operations are included in the listings.
+	Registry *workflow.Registry
 }
 
 func NewManager(config config.Config) Manager {
 	return Manager{
-		Config: config,
+		Config:   config,
+		Registry: workflow.GetRegistry(),
 	}
 }
 
@@ -49,9 +54,14 @@ func (wfc *WaitForCompletion) finished (requestID string){
 }
 
 // GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
-// This operation is expected to be executed synchronously.
-func (m *Manager) GetKubeConfig(request *grpc_provisioner_go.ClusterRequest) (*grpc_provisioner_go.KubeConfigResponse, derrors.Error) {
-	infraProvider, err := provider.NewInfrastructureProvider(request.TargetPlatform, request.AzureCredentials, &m.Config)
+// This operation is expected to be executed synchronously and it is cancelled if the context is cancelled.
+// The credentials are taken from the referenced credentials profile, if any.
+func (m *Manager) GetKubeConfig(ctx context.Context, request *grpc_provisioner_go.ClusterRequest, profileID string) (*grpc_provisioner_go.KubeConfigResponse, derrors.Error) {
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(request.TargetPlatform), provider.Credentials{
+		AzureCredentials: request.AzureCredentials,
+		ProfileID:        profileID,
+		OrganizationID:   request.OrganizationId,
+	}, &m.Config)
 	if err != nil {
 		return nil, err
 	}
@@ -60,9 +70,13 @@ func (m *Manager) GetKubeConfig(request *grpc_provisioner_go.ClusterRequest) (*g
 		log.Error().Str("trace", err.DebugReport()).Msg("cannot create get kubeconfig management operation")
 		return nil, err
 	}
+	err = m.Registry.Register(operation)
+	if err != nil {
+		return nil, err
+	}
 	wfc := &WaitForCompletion{Called:false}
 	operation.SetProgress(entities.InProgress)
-	operation.Execute(wfc.finished)
+	operation.Execute(ctx, wfc.finished)
 	// Wait for the operation to complete within a given deadline.
 	// TODO improve with deadline
 	for !wfc.Called {
@@ -70,7 +84,7 @@ func (m *Manager) GetKubeConfig(request *grpc_provisioner_go.ClusterRequest) (*g
 	}
 	opResult := operation.Result()
 	result := &grpc_provisioner_go.KubeConfigResponse{}
-	if opResult.Progress == entities.Error{
+	if opResult.Progress != entities.Finished{
 		result.Error = opResult.ErrorMsg
 	}else{
 		result.RawKubeConfig = *opResult.KubeConfigResult
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package operations
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// JSONCodecName with the content subtype of the messages of the services that are not defined in the
+// provisioner protocol buffers. The calls must use grpc.CallContentSubtype(JSONCodecName).
+const JSONCodecName = "json"
+
+// jsonCodec serializes the gRPC messages as JSON.
+type jsonCodec struct{}
+
+// Marshal returns the JSON encoding of a message.
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON encoding of a message.
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns the content subtype of the codec.
+func (jsonCodec) Name() string {
+	return JSONCodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
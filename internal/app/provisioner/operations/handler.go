@@ -0,0 +1,82 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package operations
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+)
+
+// Resumer executes again the failed provisioning operations.
+type Resumer interface {
+	// ResumeOperation executes again a failed provisioning from the step that failed.
+	ResumeOperation(ctx context.Context, request *ResumeRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error)
+}
+
+// Watcher streams the progress of the operations of a given type.
+type Watcher interface {
+	// WatchOperation sends the log entries and progress changes of an operation to a stream until the operation
+	// finishes. It returns a NotFound error if the operation is not known by the watcher.
+	WatchOperation(requestID *grpc_common_go.RequestId, stream watch.Stream) derrors.Error
+}
+
+type Handler struct {
+	Manager Manager
+	// Resumer of the provisioning operations.
+	Resumer Resumer
+	// Watchers of the operations of each type.
+	Watchers []Watcher
+}
+
+func NewHandler(manager Manager, resumer Resumer, watchers ...Watcher) *Handler {
+	return &Handler{manager, resumer, watchers}
+}
+
+// ListOperations returns a page of the operations matching a filter.
+func (h *Handler) ListOperations(_ context.Context, filter *entities.OperationFilter) (*entities.OperationList, error) {
+	result, err := h.Manager.ListOperations(filter)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// ResumeOperation executes again a failed provisioning from the step that failed.
+func (h *Handler) ResumeOperation(ctx context.Context, request *ResumeRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
+	return h.Resumer.ResumeOperation(ctx, request)
+}
+
+// WatchOperation streams the log entries and progress changes of an operation until it finishes. The watchers are
+// queried in order until one of them knows the operation.
+func (h *Handler) WatchOperation(requestID *grpc_common_go.RequestId, stream watch.Stream) error {
+	for _, watcher := range h.Watchers {
+		err := watcher.WatchOperation(requestID, stream)
+		if err == nil {
+			return nil
+		}
+		if err.Type() != derrors.NotFound {
+			return conversions.ToGRPCError(err)
+		}
+	}
+	return conversions.ToGRPCError(derrors.NewNotFoundError("request_id not found"))
+}
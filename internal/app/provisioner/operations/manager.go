@@ -0,0 +1,44 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package operations
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+)
+
+// Manager structure to query the operations of all types known by the provisioner.
+type Manager struct {
+	Registry *workflow.Registry
+}
+
+func NewManager() Manager {
+	return Manager{
+		Registry: workflow.GetRegistry(),
+	}
+}
+
+// ListOperations returns a page of the operations matching a filter.
+func (m *Manager) ListOperations(filter *entities.OperationFilter) (*entities.OperationList, derrors.Error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	result := m.Registry.List(*filter)
+	return &result, nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package operations
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"google.golang.org/grpc"
+)
+
+// ServiceName with the name of the gRPC service exposing the methods of the provisioner that are not part of the
+// provisioner protocol buffers yet. The service is declared by hand and its messages are encoded as JSON, so it
+// must be called with the Client of this package, or with any gRPC client selecting the JSONCodecName content
+// subtype. It contains the following methods:
+//
+//	ListOperations(OperationFilter) returns (OperationList)
+//	ResumeOperation(ResumeRequest) returns (ProvisionClusterResponse)
+//	WatchOperation(RequestId) returns (stream Event)
+const ServiceName = "provisioner.Operations"
+
+// ListOperationsMethod with the full name of the method listing the operations.
+const ListOperationsMethod = "/" + ServiceName + "/ListOperations"
+
+// ResumeOperationMethod with the full name of the method resuming a failed provisioning.
+const ResumeOperationMethod = "/" + ServiceName + "/ResumeOperation"
+
+// WatchOperationMethod with the full name of the method streaming the progress of an operation.
+const WatchOperationMethod = "/" + ServiceName + "/" + watch.WatchOperationStream
+
+// ResumeRequest with the provisioning operation to be resumed.
+type ResumeRequest struct {
+	// RequestID of the failed operation.
+	RequestID string `json:"request_id"`
+	// Provision with the original provisioning request. It is only required for the operations restored after a
+	// restart of the provisioner, as their credentials are not persisted.
+	Provision *grpc_provisioner_go.ProvisionClusterRequest `json:"provision,omitempty"`
+}
+
+// GetRequestId returns the request identifier of the operation to be resumed.
+func (rr *ResumeRequest) GetRequestId() string {
+	if rr == nil {
+		return ""
+	}
+	return rr.RequestID
+}
+
+// OperationsServer is the server API of the operations service.
+type OperationsServer interface {
+	watch.Server
+	// ListOperations returns a page of the operations matching a filter.
+	ListOperations(ctx context.Context, filter *entities.OperationFilter) (*entities.OperationList, error)
+	// ResumeOperation executes again a failed provisioning from the step that failed.
+	ResumeOperation(ctx context.Context, request *ResumeRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error)
+}
+
+func listOperationsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	filter := &entities.OperationFilter{}
+	if err := dec(filter); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationsServer).ListOperations(ctx, filter)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ListOperationsMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationsServer).ListOperations(ctx, req.(*entities.OperationFilter))
+	}
+	return interceptor(ctx, filter, info, handler)
+}
+
+func resumeOperationHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	request := &ResumeRequest{}
+	if err := dec(request); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationsServer).ResumeOperation(ctx, request)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ResumeOperationMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationsServer).ResumeOperation(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, request, info, handler)
+}
+
+// serviceDesc with the description of the operations service.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*OperationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListOperations",
+			Handler:    listOperationsHandler,
+		},
+		{
+			MethodName: "ResumeOperation",
+			Handler:    resumeOperationHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{watch.StreamDesc()},
+	Metadata: "operations",
+}
+
+// RegisterOperationsServer registers the operations service on a gRPC server.
+func RegisterOperationsServer(s *grpc.Server, srv OperationsServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client of the operations service.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient creates a client of the operations service on an existing connection.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+// ListOperations returns a page of the operations matching a filter.
+func (c *Client) ListOperations(ctx context.Context, filter *entities.OperationFilter, opts ...grpc.CallOption) (*entities.OperationList, error) {
+	result := &entities.OperationList{}
+	opts = append(opts, grpc.CallContentSubtype(JSONCodecName))
+	err := c.conn.Invoke(ctx, ListOperationsMethod, filter, result, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResumeOperation executes again a failed provisioning from the step that failed.
+func (c *Client) ResumeOperation(ctx context.Context, request *ResumeRequest, opts ...grpc.CallOption) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
+	result := &grpc_provisioner_go.ProvisionClusterResponse{}
+	opts = append(opts, grpc.CallContentSubtype(JSONCodecName))
+	err := c.conn.Invoke(ctx, ResumeOperationMethod, request, result, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WatchOperation streams the log entries and progress changes of an operation until it finishes.
+func (c *Client) WatchOperation(ctx context.Context, requestID *grpc_common_go.RequestId, opts ...grpc.CallOption) (*watch.ClientStream, error) {
+	opts = append(opts, grpc.CallContentSubtype(JSONCodecName))
+	return watch.NewClientStream(ctx, c.conn, WatchOperationMethod, requestID, opts...)
+}
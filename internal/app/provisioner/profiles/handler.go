@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+type Handler struct {
+	Manager Manager
+}
+
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager}
+}
+
+// ListProfiles returns the available profiles.
+func (h *Handler) ListProfiles(_ context.Context, _ *grpc_common_go.Empty) (*entities.ProfileList, error) {
+	return h.Manager.ListProfiles(), nil
+}
+
+// GetProfile returns a profile.
+func (h *Handler) GetProfile(_ context.Context, profileID *entities.ProfileID) (*entities.CredentialsProfile, error) {
+	result, err := h.Manager.GetProfile(profileID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// AddProfile creates a new profile.
+func (h *Handler) AddProfile(_ context.Context, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error) {
+	result, err := h.Manager.AddProfile(profile)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// UpdateProfile replaces an existing profile.
+func (h *Handler) UpdateProfile(_ context.Context, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error) {
+	result, err := h.Manager.UpdateProfile(profile)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// RemoveProfile deletes a profile.
+func (h *Handler) RemoveProfile(_ context.Context, profileID *entities.ProfileID) (*grpc_common_go.Success, error) {
+	err := h.Manager.RemoveProfile(profileID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// ValidateProfile checks the credentials of a profile against its platform.
+func (h *Handler) ValidateProfile(_ context.Context, profileID *entities.ProfileID) (*entities.ProfileValidation, error) {
+	result, err := h.Manager.ValidateProfile(profileID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
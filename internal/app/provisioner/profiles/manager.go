@@ -0,0 +1,97 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	pkgProfiles "github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/rs/zerolog/log"
+)
+
+// Manager structure to manage the credentials profiles of the provisioner.
+type Manager struct {
+	Registry *pkgProfiles.Registry
+}
+
+func NewManager() Manager {
+	return Manager{
+		Registry: pkgProfiles.GetRegistry(),
+	}
+}
+
+// ListProfiles returns the available profiles without their secrets.
+func (m *Manager) ListProfiles() *entities.ProfileList {
+	return &entities.ProfileList{Profiles: m.Registry.List()}
+}
+
+// GetProfile returns a profile without its secrets.
+func (m *Manager) GetProfile(profileID *entities.ProfileID) (*entities.CredentialsProfile, derrors.Error) {
+	profile, err := m.Registry.Get(profileID.ID)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Masked(), nil
+}
+
+// AddProfile creates a new profile.
+func (m *Manager) AddProfile(profile *entities.CredentialsProfile) (*entities.CredentialsProfile, derrors.Error) {
+	err := m.Registry.Add(profile)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("profile", profile.ID).Str("platform", profile.Platform).Msg("credentials profile added")
+	return m.GetProfile(&entities.ProfileID{ID: profile.ID})
+}
+
+// UpdateProfile replaces an existing profile.
+func (m *Manager) UpdateProfile(profile *entities.CredentialsProfile) (*entities.CredentialsProfile, derrors.Error) {
+	err := m.Registry.Update(profile)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("profile", profile.ID).Str("platform", profile.Platform).Msg("credentials profile updated")
+	return m.GetProfile(&entities.ProfileID{ID: profile.ID})
+}
+
+// RemoveProfile deletes a profile. Operations already created with the profile keep its credentials.
+func (m *Manager) RemoveProfile(profileID *entities.ProfileID) derrors.Error {
+	err := m.Registry.Remove(profileID.ID)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("profile", profileID.ID).Msg("credentials profile removed")
+	return nil
+}
+
+// ValidateProfile checks the credentials of a profile against its platform.
+func (m *Manager) ValidateProfile(profileID *entities.ProfileID) (*entities.ProfileValidation, derrors.Error) {
+	profile, err := m.Registry.Get(profileID.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := &entities.ProfileValidation{ID: profile.ID, Valid: true}
+	vErr := provider.ValidateProfile(profile)
+	m.Registry.SetValidation(profile.ID, vErr)
+	if vErr != nil {
+		log.Warn().Str("profile", profile.ID).Str("err", vErr.Error()).Msg("credentials profile rejected")
+		result.Valid = false
+		result.Error = vErr.Error()
+	}
+	return result, nil
+}
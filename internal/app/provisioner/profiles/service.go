@@ -0,0 +1,217 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"google.golang.org/grpc"
+)
+
+// ServiceName with the name of the gRPC service to manage the credentials profiles. The service is declared by
+// hand as the provisioner protocol buffers do not define it yet, and its messages are encoded as JSON.
+const ServiceName = "provisioner.Profiles"
+
+const (
+	// ListProfilesMethod with the full name of the method listing the profiles.
+	ListProfilesMethod = "/" + ServiceName + "/ListProfiles"
+	// GetProfileMethod with the full name of the method returning a profile.
+	GetProfileMethod = "/" + ServiceName + "/GetProfile"
+	// AddProfileMethod with the full name of the method creating a profile.
+	AddProfileMethod = "/" + ServiceName + "/AddProfile"
+	// UpdateProfileMethod with the full name of the method replacing a profile.
+	UpdateProfileMethod = "/" + ServiceName + "/UpdateProfile"
+	// RemoveProfileMethod with the full name of the method deleting a profile.
+	RemoveProfileMethod = "/" + ServiceName + "/RemoveProfile"
+	// ValidateProfileMethod with the full name of the method checking a profile against its platform.
+	ValidateProfileMethod = "/" + ServiceName + "/ValidateProfile"
+)
+
+// ProfilesServer is the server API of the credentials profiles service. Profiles are always returned without
+// their secrets.
+type ProfilesServer interface {
+	// ListProfiles returns the available profiles.
+	ListProfiles(ctx context.Context, empty *grpc_common_go.Empty) (*entities.ProfileList, error)
+	// GetProfile returns a profile.
+	GetProfile(ctx context.Context, profileID *entities.ProfileID) (*entities.CredentialsProfile, error)
+	// AddProfile creates a new profile.
+	AddProfile(ctx context.Context, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error)
+	// UpdateProfile replaces an existing profile.
+	UpdateProfile(ctx context.Context, profile *entities.CredentialsProfile) (*entities.CredentialsProfile, error)
+	// RemoveProfile deletes a profile.
+	RemoveProfile(ctx context.Context, profileID *entities.ProfileID) (*grpc_common_go.Success, error)
+	// ValidateProfile checks the credentials of a profile against its platform.
+	ValidateProfile(ctx context.Context, profileID *entities.ProfileID) (*entities.ProfileValidation, error)
+}
+
+// newMethodHandler creates the handler of a method decoding its request and passing it through the interceptor.
+func newMethodHandler(fullMethod string, newRequest func() interface{},
+	call func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		request := newRequest()
+		if err := dec(request); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(ProfilesServer), ctx, request)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fullMethod,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(ProfilesServer), ctx, req)
+		}
+		return interceptor(ctx, request, info, handler)
+	}
+}
+
+func newEmpty() interface{} {
+	return &grpc_common_go.Empty{}
+}
+
+func newProfileID() interface{} {
+	return &entities.ProfileID{}
+}
+
+func newProfile() interface{} {
+	return &entities.CredentialsProfile{}
+}
+
+// serviceDesc with the description of the credentials profiles service.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ProfilesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListProfiles",
+			Handler: newMethodHandler(ListProfilesMethod, newEmpty, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.ListProfiles(ctx, req.(*grpc_common_go.Empty))
+			}),
+		},
+		{
+			MethodName: "GetProfile",
+			Handler: newMethodHandler(GetProfileMethod, newProfileID, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.GetProfile(ctx, req.(*entities.ProfileID))
+			}),
+		},
+		{
+			MethodName: "AddProfile",
+			Handler: newMethodHandler(AddProfileMethod, newProfile, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.AddProfile(ctx, req.(*entities.CredentialsProfile))
+			}),
+		},
+		{
+			MethodName: "UpdateProfile",
+			Handler: newMethodHandler(UpdateProfileMethod, newProfile, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.UpdateProfile(ctx, req.(*entities.CredentialsProfile))
+			}),
+		},
+		{
+			MethodName: "RemoveProfile",
+			Handler: newMethodHandler(RemoveProfileMethod, newProfileID, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.RemoveProfile(ctx, req.(*entities.ProfileID))
+			}),
+		},
+		{
+			MethodName: "ValidateProfile",
+			Handler: newMethodHandler(ValidateProfileMethod, newProfileID, func(srv ProfilesServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.ValidateProfile(ctx, req.(*entities.ProfileID))
+			}),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "profiles",
+}
+
+// RegisterProfilesServer registers the credentials profiles service on a gRPC server.
+func RegisterProfilesServer(s *grpc.Server, srv ProfilesServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client of the credentials profiles service.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient creates a client of the credentials profiles service on an existing connection.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+// invoke calls a method of the service using the JSON codec.
+func (c *Client) invoke(ctx context.Context, method string, request interface{}, result interface{}, opts []grpc.CallOption) error {
+	opts = append(opts, grpc.CallContentSubtype(operations.JSONCodecName))
+	return c.conn.Invoke(ctx, method, request, result, opts...)
+}
+
+// ListProfiles returns the available profiles.
+func (c *Client) ListProfiles(ctx context.Context, opts ...grpc.CallOption) (*entities.ProfileList, error) {
+	result := &entities.ProfileList{}
+	if err := c.invoke(ctx, ListProfilesMethod, &grpc_common_go.Empty{}, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetProfile returns a profile.
+func (c *Client) GetProfile(ctx context.Context, profileID *entities.ProfileID, opts ...grpc.CallOption) (*entities.CredentialsProfile, error) {
+	result := &entities.CredentialsProfile{}
+	if err := c.invoke(ctx, GetProfileMethod, profileID, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddProfile creates a new profile.
+func (c *Client) AddProfile(ctx context.Context, profile *entities.CredentialsProfile, opts ...grpc.CallOption) (*entities.CredentialsProfile, error) {
+	result := &entities.CredentialsProfile{}
+	if err := c.invoke(ctx, AddProfileMethod, profile, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateProfile replaces an existing profile.
+func (c *Client) UpdateProfile(ctx context.Context, profile *entities.CredentialsProfile, opts ...grpc.CallOption) (*entities.CredentialsProfile, error) {
+	result := &entities.CredentialsProfile{}
+	if err := c.invoke(ctx, UpdateProfileMethod, profile, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RemoveProfile deletes a profile.
+func (c *Client) RemoveProfile(ctx context.Context, profileID *entities.ProfileID, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	result := &grpc_common_go.Success{}
+	if err := c.invoke(ctx, RemoveProfileMethod, profileID, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ValidateProfile checks the credentials of a profile against its platform.
+func (c *Client) ValidateProfile(ctx context.Context, profileID *entities.ProfileID, opts ...grpc.CallOption) (*entities.ProfileValidation, error) {
+	result := &entities.ProfileValidation{}
+	if err := c.invoke(ctx, ValidateProfileMethod, profileID, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/redact"
 	"github.com/rs/zerolog/log"
 )
 
@@ -74,7 +75,7 @@ func GetBearerAuthorizer(credentials *AzureCredentials) (autorest.Authorizer, de
 
 	token, err := adal.NewServicePrincipalToken(
 		*oauthConfig, credentials.ClientId, credentials.ClientSecret, GraphBaseURI)
-	log.Debug().Interface("token", token).Msg("Oauth token")
+	log.Debug().Interface("token", redact.Value(token)).Msg("Oauth token")
 	if err != nil {
 		return nil, derrors.NewInternalError("cannot create service principal token", err)
 	}
@@ -19,13 +19,12 @@ package azure
 import (
 	"context"
 	"fmt"
-	"github.com/Azure/azure-sdk-for-go/services/containerservice/mgmt/2019-08-01/containerservice"
 	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/nalej/derrors"
-	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
 	"time"
 )
@@ -39,7 +38,7 @@ type DecommissionerOperation struct {
 }
 
 func NewDecommissionerOperation(credentials *AzureCredentials, request entities.DecommissionRequest, config *config.Config) (*DecommissionerOperation, derrors.Error) {
-	azureOp, err := NewAzureOperation(credentials)
+	azureOp, err := NewAzureOperation(request.RequestID, credentials)
 	if err != nil {
 		return nil, err
 	}
@@ -56,101 +55,99 @@ func (do *DecommissionerOperation) RequestID() string {
 
 func (do *DecommissionerOperation) Metadata() entities.OperationMetadata {
 	return entities.OperationMetadata{
-		OrganizationID: do.request.OrganizationID,
-		ClusterID:      do.request.ClusterID,
-		RequestID:      do.request.RequestID,
+		OrganizationID:      do.request.OrganizationID,
+		ClusterID:           do.request.ClusterID,
+		RequestID:           do.request.RequestID,
+		IsManagementCluster: do.request.IsManagementCluster,
 	}
 }
 
-func (do *DecommissionerOperation) notifyError(err derrors.Error, callback func(requestId string)) {
-	log.Error().Str("trace", err.DebugReport()).Msg("decommission operation failed")
-	do.setError(err.Error())
+// Request returns the request that originated the operation
+func (do *DecommissionerOperation) Request() interface{} {
+	return do.request
+}
+
+func (do *DecommissionerOperation) notifyError(ctx context.Context, err derrors.Error, callback func(requestId string)) {
+	do.setFailure(ctx, err)
 	callback(do.request.RequestID)
 }
 
-func (do *DecommissionerOperation) Execute(callback func(requestID string)) {
+func (do *DecommissionerOperation) Execute(ctx context.Context, callback func(requestID string)) {
 	log.Debug().Str("organizationID", do.request.OrganizationID).Str("clusterID", do.request.ClusterID).Msg("executing decommission operation")
-	do.started = time.Now()
-	do.SetProgress(entities.InProgress)
+	ctx = do.start(ctx)
+	defer do.finish()
 
-	managedCluster, err := do.getClusterDetails(do.request.IsManagementCluster, do.request.AzureOptions.ResourceGroup, do.request.ClusterID)
+	managedCluster, err := do.getClusterDetails(ctx, do.request.IsManagementCluster, do.request.AzureOptions.ResourceGroup, do.request.ClusterID)
 	if err != nil {
-		do.notifyError(err, callback)
+		do.notifyError(ctx, err, callback)
 		return
 	}
 	log.Debug().Interface("existingCluster", managedCluster).Msg("AKS cluster retrieved")
 
 	dnsZoneName := managedCluster.Tags[DnsZoneTag]
 	if dnsZoneName == nil {
-		do.notifyError(derrors.NewFailedPreconditionError(fmt.Sprintf("Cluster entity does not contain needed tag [%s]", DnsZoneTag)), callback)
+		do.notifyError(ctx, derrors.NewFailedPreconditionError(fmt.Sprintf("Cluster entity does not contain needed tag [%s]", DnsZoneTag)), callback)
 		return
 	}
 	clusterName := managedCluster.Tags[ClusterNameTag]
 	if clusterName == nil {
-		do.notifyError(derrors.NewFailedPreconditionError(fmt.Sprintf("Cluster entity does not contain needed tag [%s]", ClusterNameTag)), callback)
+		do.notifyError(ctx, derrors.NewFailedPreconditionError(fmt.Sprintf("Cluster entity does not contain needed tag [%s]", ClusterNameTag)), callback)
 		return
 	}
 
-	zone, err := do.getDNSZone(*dnsZoneName)
+	zone, err := do.getDNSZone(ctx, *dnsZoneName)
 	if err != nil {
-		do.notifyError(err, callback)
+		do.notifyError(ctx, err, callback)
 		return
 	}
 	dnsZoneResourceGroupName, err := do.getDNSResourceGroupName(zone)
 	if err != nil {
-		do.notifyError(err, callback)
+		do.notifyError(ctx, err, callback)
 		return
 	}
 
-	err = do.deleteDNSEntries(*clusterName, *dnsZoneResourceGroupName, *dnsZoneName)
+	err = do.deleteDNSEntries(ctx, *clusterName, *dnsZoneResourceGroupName, *dnsZoneName)
 	if err != nil {
-		do.notifyError(err, callback)
+		do.notifyError(ctx, err, callback)
 		return
 	}
 
-	decommissionResponse, err := do.decommissionAksCluster()
+	decommissionResponse, err := do.decommissionAksCluster(ctx)
 	if err != nil {
-		do.notifyError(err, callback)
+		do.notifyError(ctx, err, callback)
 		return
 	}
 	do.AddToLog("cluster has been decommissioned")
 	log.Debug().Interface("response", *decommissionResponse).Msg("cluster has been decommissioned")
 
-	do.elapsedTime = time.Now().Sub(do.started).Nanoseconds()
-	do.SetProgress(entities.Finished)
+	do.setFinished()
 	callback(do.request.RequestID)
 }
 
-func (do *DecommissionerOperation) Cancel() derrors.Error {
-	panic("implement me") // TODO implement DecommissionerOperation.Cancel()
-}
-
 func (do *DecommissionerOperation) Result() entities.OperationResult {
-	elapsed := do.elapsedTime
-	if do.elapsedTime == 0 && do.taskProgress == entities.InProgress {
-		// If the operation is in progress, retrieve the ongoing time.
-		elapsed = time.Now().Sub(do.started).Nanoseconds()
-	}
+	progress, elapsed, errorMsg := do.status()
 
 	return entities.OperationResult{
 		OrganizationId: do.request.OrganizationID,
 		RequestId:      do.request.RequestID,
 		Type:           entities.Decommission,
-		Progress:       do.taskProgress,
+		Progress:       progress,
 		ElapsedTime:    elapsed,
-		ErrorMsg:       do.errorMsg,
+		ErrorMsg:       errorMsg,
 	}
 }
 
-func (do *DecommissionerOperation) deleteDNSEntries(clusterName string, resourceGroupName string, dnsZoneName string) derrors.Error {
+func (do *DecommissionerOperation) deleteDNSEntries(ctx context.Context, clusterName string, resourceGroupName string, dnsZoneName string) derrors.Error {
+	ctx, span := tracing.StartSpan(ctx, "deleteDNSEntries")
+	defer span.End()
 	do.AddToLog("Deleting DNS entries")
-	recordsetTypeA, err := do.listDnsRecords(resourceGroupName, dnsZoneName, clusterName)
+	recordsetTypeA, err := do.listDnsRecords(ctx, resourceGroupName, dnsZoneName, clusterName)
 	if err != nil {
-		return err
+		return tracing.Fail(span, err)
 	}
-	recordsetTypeNS, err := do.listDnsRecords(resourceGroupName, dnsZoneName, fmt.Sprintf("%s.%s", clusterName, dnsZoneName))
+	recordsetTypeNS, err := do.listDnsRecords(ctx, resourceGroupName, dnsZoneName, fmt.Sprintf("%s.%s", clusterName, dnsZoneName))
 	if err != nil {
-		return err
+		return tracing.Fail(span, err)
 	}
 	toRemove := make([]dns.RecordSet, 0, len(recordsetTypeA)+len(recordsetTypeNS))
 	toRemove = append(toRemove, recordsetTypeA...)
@@ -171,9 +168,9 @@ func (do *DecommissionerOperation) deleteDNSEntries(clusterName string, resource
 			Str("dnsRecordName", dnsRecordName).
 			Str("DNSZoneName", dnsZoneName).
 			Msg("Deleting DNS A entry")
-		_, err := do.deleteDNSARecord(resourceGroupName, dnsRecordName, dnsZoneName)
+		_, err := do.deleteDNSARecord(ctx, resourceGroupName, dnsRecordName, dnsZoneName)
 		if err != nil {
-			return err
+			return tracing.Fail(span, err)
 		}
 		do.AddToLog(fmt.Sprintf("DNS record set deleted %s", dnsRecordName))
 	}
@@ -181,32 +178,8 @@ func (do *DecommissionerOperation) deleteDNSEntries(clusterName string, resource
 }
 
 // decommissionAksCluster triggers the decommission of an existing management cluster.
-func (do *DecommissionerOperation) decommissionAksCluster() (*autorest.Response, derrors.Error) {
+func (do *DecommissionerOperation) decommissionAksCluster(ctx context.Context) (*autorest.Response, derrors.Error) {
 	do.AddToLog("Decommissioning cluster")
-	clusterClient := containerservice.NewManagedClustersClient(do.credentials.SubscriptionId)
-	clusterClient.Authorizer = do.managementAuthorizer
-
-	ctx, cancel := common.GetContext()
-	defer cancel()
-
 	resourceName := do.getResourceName(do.request.IsManagementCluster, do.request.ClusterID)
-	log.Debug().Str("resourceGroupName", do.request.AzureOptions.ResourceGroup).Str("resourceName", resourceName).Msg("Delete params")
-	deleteFuture, deleteErr := clusterClient.Delete(ctx, do.request.AzureOptions.ResourceGroup, resourceName)
-	if deleteErr != nil {
-		return nil, derrors.NewInternalError("cannot decommission AKS cluster", deleteErr).WithParams(do.request)
-	}
-
-	do.AddToLog("waiting for AKS cluster to be decommissioned")
-	futureContext, cancelFuture := context.WithTimeout(context.Background(), ClusterDecommissionDeadline)
-	defer cancelFuture()
-	waitErr := deleteFuture.WaitForCompletionRef(futureContext, clusterClient.Client)
-	if waitErr != nil {
-		return nil, derrors.AsError(waitErr, "AKS cluster decommission failed")
-	}
-	decommissionResponse, resultErr := deleteFuture.Result(clusterClient)
-	if resultErr != nil {
-		log.Error().Interface("err", resultErr).Msg("AKS decommission failed")
-		return nil, derrors.AsError(resultErr, "AKS decommission failed")
-	}
-	return &decommissionResponse, nil
+	return do.deleteAKSCluster(ctx, do.request.AzureOptions.ResourceGroup, resourceName)
 }
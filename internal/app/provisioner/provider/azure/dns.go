@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-provisioner-go"
+)
+
+// DNSClient managing the records of an Azure DNS zone. It is used by the providers whose clusters run elsewhere
+// but are published on Azure DNS.
+type DNSClient struct {
+	operation *AzureOperation
+}
+
+// NewDNSClient creates a client with a set of credentials.
+func NewDNSClient(credentials *grpc_provisioner_go.AzureCredentials) (*DNSClient, derrors.Error) {
+	operation, err := NewAzureOperation("", NewAzureCredentials(credentials))
+	if err != nil {
+		return nil, err
+	}
+	return &DNSClient{operation: operation}, nil
+}
+
+// ZoneResourceGroup obtains the resource group of a DNS zone.
+func (dc *DNSClient) ZoneResourceGroup(ctx context.Context, zoneName string) (string, derrors.Error) {
+	zone, err := dc.operation.getDNSZone(ctx, zoneName)
+	if err != nil {
+		return "", err
+	}
+	resourceGroupName, err := dc.operation.getDNSResourceGroupName(zone)
+	if err != nil {
+		return "", err
+	}
+	return *resourceGroupName, nil
+}
+
+// CreateARecord creates or replaces a DNS A record.
+func (dc *DNSClient) CreateARecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string, IPAddress string) derrors.Error {
+	_, err := dc.operation.createDNSARecord(ctx, resourceGroupName, recordName, zoneName, IPAddress)
+	return err
+}
+
+// CreateNSRecord creates or replaces a DNS NS record.
+func (dc *DNSClient) CreateNSRecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string, nsName string) derrors.Error {
+	_, err := dc.operation.createDNSNSRecord(ctx, resourceGroupName, recordName, nsName, zoneName)
+	return err
+}
+
+// DeleteARecord removes a DNS A record.
+func (dc *DNSClient) DeleteARecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string) derrors.Error {
+	_, err := dc.operation.deleteDNSARecord(ctx, resourceGroupName, recordName, zoneName)
+	return err
+}
+
+// DeleteNSRecord removes a DNS NS record.
+func (dc *DNSClient) DeleteNSRecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string) derrors.Error {
+	_, err := dc.operation.deleteDNSNSRecord(ctx, resourceGroupName, recordName, zoneName)
+	return err
+}
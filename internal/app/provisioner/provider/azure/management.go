@@ -18,11 +18,12 @@
 package azure
 
 import (
+	"context"
+
 	"github.com/nalej/derrors"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
 	"github.com/rs/zerolog/log"
-	"time"
 )
 
 type ManagementOperation struct {
@@ -34,7 +35,7 @@ type ManagementOperation struct {
 }
 
 func NewManagementOperation(credentials *AzureCredentials, request entities.ClusterRequest, operation entities.ManagementOperationType, config *config.Config) (*ManagementOperation, derrors.Error) {
-	azureOp, err := NewAzureOperation(credentials)
+	azureOp, err := NewAzureOperation(request.RequestID, credentials)
 	if err != nil {
 		return nil, err
 	}
@@ -54,62 +55,57 @@ func (mo *ManagementOperation) RequestID() string {
 // Metadata returns the operation associated metadata
 func (mo *ManagementOperation) Metadata() entities.OperationMetadata {
 	return entities.OperationMetadata{
-		OrganizationID: mo.request.OrganizationID,
-		ClusterID:      mo.request.ClusterID,
-		RequestID:      mo.request.RequestID,
+		OrganizationID:      mo.request.OrganizationID,
+		ClusterID:           mo.request.ClusterID,
+		RequestID:           mo.request.RequestID,
+		IsManagementCluster: mo.request.IsManagementCluster,
 	}
 }
 
-func (mo *ManagementOperation) notifyError(err derrors.Error, callback func(requestId string)) {
-	log.Error().Str("trace", err.DebugReport()).Msg("operation failed")
-	mo.setError(err.Error())
+// Request returns the request that originated the operation
+func (mo *ManagementOperation) Request() interface{} {
+	return mo.request
+}
+
+func (mo *ManagementOperation) notifyError(ctx context.Context, err derrors.Error, callback func(requestId string)) {
+	mo.setFailure(ctx, err)
 	callback(mo.request.RequestID)
 }
 
 // Execute triggers the execution of the operation. The callback function on the execute is expected to be
 // called when the operation finish its execution independently of the status.
-func (mo *ManagementOperation) Execute(callback func(requestId string)) {
+func (mo *ManagementOperation) Execute(ctx context.Context, callback func(requestId string)) {
 	log.Debug().Str("organizationID", mo.request.OrganizationID).Str("clusterID", mo.request.ClusterID).Msg("executing management operation")
-	mo.started = time.Now()
-	mo.SetProgress(entities.InProgress)
+	ctx = mo.start(ctx)
+	defer mo.finish()
 
 	if mo.targetOp != entities.GetKubeConfig {
 		err := derrors.NewUnimplementedError("target operation is not supported").WithParams(mo.targetOp)
-		mo.notifyError(err, callback)
+		mo.notifyError(ctx, err, callback)
 		return
 	}
 
 	resourceName := mo.getResourceName(mo.request.IsManagementCluster, mo.request.ClusterID)
 	log.Debug().Str("resourceGroupName", mo.request.AzureOptions.ResourceGroup).Str("resourceName", resourceName).Msg("GetKubeConfig params")
-	result, err := mo.retrieveKubeConfig(mo.request.AzureOptions.ResourceGroup, resourceName)
+	result, err := mo.retrieveKubeConfig(ctx, mo.request.AzureOptions.ResourceGroup, resourceName)
 	if err != nil {
-		mo.notifyError(err, callback)
+		mo.notifyError(ctx, err, callback)
 		return
 	}
 	mo.KubeConfigResult = result
-	mo.elapsedTime = time.Now().Sub(mo.started).Nanoseconds()
-	mo.SetProgress(entities.Finished)
+	mo.setFinished()
 	callback(mo.request.RequestID)
 }
 
-// Cancel triggers the cancellation of the operation
-func (mo *ManagementOperation) Cancel() derrors.Error {
-	panic("implement me")
-}
-
 // Result returns the operation result if this operation is successful
 func (mo *ManagementOperation) Result() entities.OperationResult {
-	elapsed := mo.elapsedTime
-	if mo.elapsedTime == 0 && mo.taskProgress == entities.InProgress {
-		// If the operation is in progress, retrieved the ongoing time.
-		elapsed = time.Now().Sub(mo.started).Nanoseconds()
-	}
+	progress, elapsed, errorMsg := mo.status()
 	return entities.OperationResult{
 		RequestId:        mo.request.RequestID,
 		Type:             entities.Management,
-		Progress:         mo.taskProgress,
+		Progress:         progress,
 		ElapsedTime:      elapsed,
-		ErrorMsg:         mo.errorMsg,
+		ErrorMsg:         errorMsg,
 		KubeConfigResult: mo.KubeConfigResult,
 	}
 }
@@ -19,6 +19,7 @@ package azure
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -33,6 +34,9 @@ import (
 	"github.com/nalej/derrors"
 	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/watch"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 )
@@ -47,6 +51,10 @@ const ClusterIDTag = "clusterID"
 // value even if it is not updated, is maintained for reference.
 const ClusterNameTag = "clusterName"
 
+// RequestIDTag with the name of the tag associated with the request identifier of the operation that created the
+// cluster. It is checked before removing the cluster in a rollback.
+const RequestIDTag = "requestID"
+
 // CreateByTag with the name of the tag used to indicate the creator of the cluster
 const CreateByTag = "created-by"
 
@@ -66,18 +74,35 @@ const AzureRetries = 36
 // AzureOperation structure with common functions shared among the different operations.
 type AzureOperation struct {
 	sync.Mutex
+	requestID            string
 	credentials          *AzureCredentials
 	graphAuthorizer      autorest.Authorizer
 	managementAuthorizer autorest.Authorizer
 	started              time.Time
-	log                  []string
+	log                  []entities.LogEntry
 	taskProgress         entities.TaskProgress
 	errorMsg             string
 	elapsedTime          int64
+	// cancelRequested is set when the user requests the cancellation of the operation.
+	cancelRequested bool
+	// cancel function of the context associated with the execution of the operation.
+	cancel context.CancelFunc
+	// rollback with the actions performed to undo a failed operation.
+	rollback []entities.RollbackAction
+	// hub used to notify the changes of the operation to the watchers.
+	hub *watch.Hub
+	// step being executed, included in the log entries.
+	step string
+	// stepStarted with the time the current step started.
+	stepStarted time.Time
+	// expired is set when the executor stops the operation for exceeding its deadline or not making progress.
+	expired bool
+	// interrupted is set when the executor stops the operation because the provisioner is shutting down.
+	interrupted bool
 }
 
 // NewAzureOperation creates an AzureOperation with a set of credentials.
-func NewAzureOperation(credentials *AzureCredentials) (*AzureOperation, derrors.Error) {
+func NewAzureOperation(requestID string, credentials *AzureCredentials) (*AzureOperation, derrors.Error) {
 	graph, err := GetGraphAuthorizer(credentials)
 	if err != nil {
 		return nil, err
@@ -87,44 +112,286 @@ func NewAzureOperation(credentials *AzureCredentials) (*AzureOperation, derrors.
 		return nil, err
 	}
 	return &AzureOperation{
+		requestID:            requestID,
 		credentials:          credentials,
 		graphAuthorizer:      graph,
 		managementAuthorizer: mngt,
-		log:                  make([]string, 0),
+		log:                  make([]entities.LogEntry, 0),
 		taskProgress:         entities.Init,
+		hub:                  watch.GetHub(),
 	}, nil
 }
 
 // Log returns the operation log.
-func (ao *AzureOperation) Log() []string {
+func (ao *AzureOperation) Log() []entities.LogEntry {
 	ao.Lock()
 	defer ao.Unlock()
 	return ao.log
 }
 
-// AddToLog adds a new entry to the operation log.
-func (ao *AzureOperation) AddToLog(entry string) {
+// AddToLog adds a new informative entry to the operation log.
+func (ao *AzureOperation) AddToLog(message string) {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.appendLog(entities.InfoLevel, message, nil)
+}
+
+// AddWarningToLog adds a new warning entry to the operation log.
+func (ao *AzureOperation) AddWarningToLog(message string, fields map[string]string) {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.appendLog(entities.WarningLevel, message, fields)
+}
+
+// AddErrorToLog adds a new error entry to the operation log.
+func (ao *AzureOperation) AddErrorToLog(message string, fields map[string]string) {
 	ao.Lock()
 	defer ao.Unlock()
+	ao.appendLog(entities.ErrorLevel, message, fields)
+}
+
+// appendLog adds a new entry associated with the current step to the operation log and notifies the watchers.
+// The caller is expected to hold the lock.
+func (ao *AzureOperation) appendLog(level entities.LogLevel, message string, fields map[string]string) {
+	entry := entities.NewLogEntry(level, ao.step, message)
+	entry.Fields = fields
 	ao.log = append(ao.log, entry)
+	ao.hub.PublishLog(ao.requestID, len(ao.log)-1, entry)
+}
+
+// startStep sets the step being executed so that it is included in the following log entries.
+func (ao *AzureOperation) startStep(stepName string) {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.step = stepName
+	ao.stepStarted = time.Now()
+	ao.appendLog(entities.InfoLevel, fmt.Sprintf("step %s started", stepName), nil)
+}
+
+// completeStep logs the completion of the current step with its duration.
+func (ao *AzureOperation) completeStep(stepName string) {
+	ao.Lock()
+	defer ao.Unlock()
+	duration := time.Since(ao.stepStarted).Round(time.Second)
+	ao.appendLog(entities.InfoLevel, fmt.Sprintf("step %s completed", stepName), map[string]string{entities.StepDurationField: duration.String()})
+	ao.step = ""
+}
+
+// failStep logs the failure of the current step with its duration and the cause.
+func (ao *AzureOperation) failStep(stepName string, err derrors.Error) {
+	ao.Lock()
+	defer ao.Unlock()
+	duration := time.Since(ao.stepStarted).Round(time.Second)
+	ao.appendLog(entities.ErrorLevel, fmt.Sprintf("step %s failed", stepName), map[string]string{entities.StepDurationField: duration.String(), "error": err.Error()})
+	ao.step = ""
 }
 
 // Progress returns the progress of an operation.
 func (ao *AzureOperation) Progress() entities.TaskProgress {
+	ao.Lock()
+	defer ao.Unlock()
 	return ao.taskProgress
 }
 
+// status returns the progress, the elapsed time and the error message of the operation. If the operation is in
+// progress, the elapsed time is the ongoing one.
+func (ao *AzureOperation) status() (entities.TaskProgress, int64, string) {
+	ao.Lock()
+	defer ao.Unlock()
+	elapsed := ao.elapsedTime
+	if ao.elapsedTime == 0 && ao.taskProgress == entities.InProgress {
+		elapsed = time.Now().Sub(ao.started).Nanoseconds()
+	}
+	return ao.taskProgress, elapsed, ao.errorMsg
+}
+
 // SetProgress sets the progress of the ongoing operation.
 func (ao *AzureOperation) SetProgress(progress entities.TaskProgress) {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.updateProgress(progress)
+}
+
+// updateProgress sets the progress of the operation and notifies the watchers. The caller is expected to hold
+// the lock.
+func (ao *AzureOperation) updateProgress(progress entities.TaskProgress) {
 	ao.taskProgress = progress
+	ao.hub.PublishProgress(ao.requestID, progress)
+}
+
+// start marks the operation as started and derives the context that is used by all the calls performed
+// by the operation so that they are stopped upon cancellation.
+func (ao *AzureOperation) start(parent context.Context) context.Context {
+	ao.Lock()
+	defer ao.Unlock()
+	ctx, cancel := context.WithCancel(parent)
+	ao.cancel = cancel
+	if ao.cancelRequested {
+		cancel()
+	}
+	ao.started = time.Now()
+	if !ao.interrupted {
+		ao.updateProgress(entities.InProgress)
+	}
+	return ctx
+}
+
+// finish releases the resources associated with the execution context.
+func (ao *AzureOperation) finish() {
+	ao.Lock()
+	defer ao.Unlock()
+	if ao.cancel != nil {
+		ao.cancel()
+	}
+}
+
+// Cancel triggers the cancellation of the operation. Ongoing operations will stop at the next step boundary,
+// while operations that have not been started are directly marked as cancelled.
+func (ao *AzureOperation) Cancel() derrors.Error {
+	ao.Lock()
+	defer ao.Unlock()
+	if ao.taskProgress.IsTerminal() {
+		return derrors.NewFailedPreconditionError("operation is already finished").WithParams(entities.TaskProgressToString[ao.taskProgress])
+	}
+	ao.cancelRequested = true
+	if ao.cancel != nil {
+		ao.cancel()
+	} else {
+		ao.setCancelled()
+	}
+	return nil
+}
+
+// Expire stops the operation and marks it as failed. It is used by the executor to stop the operations that
+// exceed their deadline or stop making progress.
+func (ao *AzureOperation) Expire(reason derrors.Error) {
+	ao.Lock()
+	defer ao.Unlock()
+	if ao.taskProgress.IsTerminal() {
+		return
+	}
+	ao.expired = true
+	if ao.cancel != nil {
+		ao.cancel()
+	}
+	ao.appendLog(entities.ErrorLevel, reason.Error(), nil)
+	if !ao.started.IsZero() {
+		ao.elapsedTime = time.Now().Sub(ao.started).Nanoseconds()
+	}
+	ao.errorMsg = reason.Error()
+	ao.updateProgress(entities.Error)
+}
+
+// Interrupt marks the operation as interrupted. It is used by the executor when the provisioner shuts down. The
+// ongoing call to Azure is not cancelled, and operations executed as a pipeline of steps also stop at the next
+// step boundary.
+func (ao *AzureOperation) Interrupt() {
+	ao.Lock()
+	defer ao.Unlock()
+	if ao.taskProgress.IsTerminal() {
+		return
+	}
+	ao.interrupted = true
+	ao.appendLog(entities.WarningLevel, entities.InterruptedErrorMsg, nil)
+	if !ao.started.IsZero() {
+		ao.elapsedTime = time.Now().Sub(ao.started).Nanoseconds()
+	}
+	ao.errorMsg = entities.InterruptedErrorMsg
+	ao.updateProgress(entities.Interrupted)
+}
+
+// isInterrupted checks if the operation has been interrupted.
+func (ao *AzureOperation) isInterrupted() bool {
+	ao.Lock()
+	defer ao.Unlock()
+	return ao.interrupted
+}
+
+// reset clears the execution state of the operation so that it can be executed again. The operation log
+// is kept so that it contains the history of all the executions.
+func (ao *AzureOperation) reset() {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.updateProgress(entities.Init)
+	ao.errorMsg = ""
+	ao.elapsedTime = 0
+	ao.cancelRequested = false
+	ao.cancel = nil
+	ao.rollback = nil
+	ao.expired = false
+	ao.interrupted = false
+	ao.step = ""
+}
+
+// setRollback records the actions performed to undo a failed operation.
+func (ao *AzureOperation) setRollback(actions []entities.RollbackAction) {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.rollback = actions
+}
+
+// rollbackActions returns the actions performed to undo a failed operation.
+func (ao *AzureOperation) rollbackActions() []entities.RollbackAction {
+	ao.Lock()
+	defer ao.Unlock()
+	return ao.rollback
+}
+
+// setFailure updates the operation state after an error. Errors caused by the cancellation of the operation
+// context are reported as a cancellation, unless the operation has expired or has been interrupted.
+func (ao *AzureOperation) setFailure(ctx context.Context, err derrors.Error) {
+	ao.Lock()
+	expired := ao.expired
+	interrupted := ao.interrupted
+	ao.Unlock()
+	if expired {
+		// The reason has already been reported by Expire.
+		log.Warn().Str("cause", err.Error()).Msg("expired operation has stopped")
+		return
+	}
+	if interrupted {
+		// The state has already been set by Interrupt.
+		log.Info().Str("cause", err.Error()).Msg("interrupted operation has stopped")
+		return
+	}
+	if ctx.Err() == context.Canceled {
+		log.Info().Str("cause", err.Error()).Msg("operation has been cancelled")
+		ao.Lock()
+		ao.appendLog(entities.WarningLevel, entities.CancelledErrorMsg, nil)
+		ao.setCancelled()
+		ao.Unlock()
+		return
+	}
+	log.Error().Str("trace", err.DebugReport()).Msg("operation failed")
+	ao.Lock()
+	ao.setError(err.Error())
+	ao.Unlock()
+}
+
+// setFinished records the elapsed time and marks the operation as finished.
+func (ao *AzureOperation) setFinished() {
+	ao.Lock()
+	defer ao.Unlock()
+	ao.elapsedTime = time.Now().Sub(ao.started).Nanoseconds()
+	ao.updateProgress(entities.Finished)
 }
 
-// setError updates all the fields to indicate that an error ocurred.
+// setCancelled updates all the fields to indicate that the operation has been cancelled. The caller is
+// expected to hold the lock.
+func (ao *AzureOperation) setCancelled() {
+	if !ao.started.IsZero() {
+		ao.elapsedTime = time.Now().Sub(ao.started).Nanoseconds()
+	}
+	ao.errorMsg = entities.CancelledErrorMsg
+	ao.updateProgress(entities.Cancelled)
+}
+
+// setError updates all the fields to indicate that an error ocurred. The caller is expected to hold the lock.
 func (ao *AzureOperation) setError(errMsg string) {
 	log.Debug().Str("previous", entities.TaskProgressToString[ao.taskProgress]).Str("error", errMsg).Msg("setting error")
 	ao.elapsedTime = time.Now().Sub(ao.started).Nanoseconds()
-	ao.taskProgress = entities.Error
 	ao.errorMsg = errMsg
+	ao.updateProgress(entities.Error)
 }
 
 func (ao *AzureOperation) getTags(clusterID string) []string {
@@ -152,7 +419,9 @@ func (ao *AzureOperation) getPasswordCredentialsForNewApp() *[]graphrbac.Passwor
 }
 
 // createApplication creates an Application entity on the Graph RBAC.
-func (ao *AzureOperation) createApplication(client graphrbac.ApplicationsClient, clusterID string) (*graphrbac.Application, derrors.Error) {
+func (ao *AzureOperation) createApplication(ctx context.Context, client graphrbac.ApplicationsClient, clusterID string) (*graphrbac.Application, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createApplication")
+	defer span.End()
 	timeMark := time.Now().Format("20060102-150405")
 	displayName := fmt.Sprintf("nalej-%s-%s", clusterID, timeMark)
 	name := fmt.Sprintf("http://%s", displayName)
@@ -170,19 +439,21 @@ func (ao *AzureOperation) createApplication(client graphrbac.ApplicationsClient,
 		//WwwHomepage:                &nalejWeb,
 	}
 
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
-	log.Debug().Interface("request", createAppRequest).Msg("creating application")
+	log.Debug().Interface("request", redact.Value(createAppRequest)).Msg("creating application")
 	app, err := client.Create(ctx, createAppRequest)
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot create application entity in Azure")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot create application entity in Azure"))
 	}
-	log.Debug().Interface("app", app).Msg("application entity has been creating")
+	log.Debug().Interface("app", redact.Value(app)).Msg("application entity has been creating")
 	return &app, nil
 }
 
 // createServicePrincipal creates a ServicePrincipal entity associated to an Application.
-func (ao *AzureOperation) createServicePrincipal(client graphrbac.ServicePrincipalsClient, appID string, clusterID string) (*graphrbac.ServicePrincipal, derrors.Error) {
+func (ao *AzureOperation) createServicePrincipal(ctx context.Context, client graphrbac.ServicePrincipalsClient, appID string, clusterID string) (*graphrbac.ServicePrincipal, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createServicePrincipal")
+	defer span.End()
 	appSpCreated := false
 	tags := ao.getTags(clusterID)
 	accountEnabled := true
@@ -196,7 +467,7 @@ func (ao *AzureOperation) createServicePrincipal(client graphrbac.ServicePrincip
 	var associatedSP graphrbac.ServicePrincipal
 	for retry := 0; retry < AzureRetries && !appSpCreated; retry++ {
 		log.Debug().Int("retry", retry).Msg("attempting to create sp")
-		ctxSP, cancelSP := common.GetContext()
+		ctxSP, cancelSP := common.GetContextFrom(ctx)
 		defer cancelSP()
 		log.Debug().Msg("creating SP")
 		sp, err := client.Create(ctxSP, createSPRequest)
@@ -205,27 +476,33 @@ func (ao *AzureOperation) createServicePrincipal(client graphrbac.ServicePrincip
 			associatedSP = sp
 		} else if strings.Contains(err.Error(), "does not reference") || strings.Contains(err.Error(), "does not exists") {
 			log.Debug().Msg("creation of service principal failed, retrying in 5 seconds")
-			time.Sleep(time.Second * 5)
+			select {
+			case <-time.After(time.Second * 5):
+			case <-ctx.Done():
+				return nil, tracing.Fail(span, derrors.AsError(ctx.Err(), "creation of associated service principal cancelled"))
+			}
 		} else {
-			return nil, derrors.AsError(err, "creation of associated service principal failed")
+			return nil, tracing.Fail(span, derrors.AsError(err, "creation of associated service principal failed"))
 		}
 	}
 	if !appSpCreated {
-		return nil, derrors.NewInternalError("unable to create service principal after retries")
+		return nil, tracing.Fail(span, derrors.NewInternalError("unable to create service principal after retries"))
 	}
 	return &associatedSP, nil
 }
 
 // getRoleID obtains the role associated with a given name on a Tenant
-func (ao *AzureOperation) getRoleID(roleName string, scope string) (*string, derrors.Error) {
+func (ao *AzureOperation) getRoleID(ctx context.Context, roleName string, scope string) (*string, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "getRoleID")
+	defer span.End()
 	roleDefClient := authorization.NewRoleDefinitionsClient(ao.credentials.TenantId)
 	roleDefClient.Authorizer = ao.managementAuthorizer
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	log.Debug().Str("roleName", roleName).Str("scope", scope).Msg("obtaining role ID")
 	roles, err := roleDefClient.List(ctx, scope, "")
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot retrieve list of roles")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot retrieve list of roles"))
 	}
 	for _, role := range roles.Values() {
 		if *role.RoleName == roleName {
@@ -233,19 +510,21 @@ func (ao *AzureOperation) getRoleID(roleName string, scope string) (*string, der
 			return role.ID, nil
 		}
 	}
-	return nil, derrors.NewNotFoundError("role not found in scope")
+	return nil, tracing.Fail(span, derrors.NewNotFoundError("role not found in scope"))
 }
 
 // authorizeDNSToSP authorizes the management of a DNS zone to a service principal
-func (ao *AzureOperation) authorizeDNSToSP(appID string, dnsZone string) derrors.Error {
+func (ao *AzureOperation) authorizeDNSToSP(ctx context.Context, appID string, dnsZone string) derrors.Error {
+	ctx, span := tracing.StartSpan(ctx, "authorizeDNSToSP")
+	defer span.End()
 	zoneClient := dns.NewZonesClient(ao.credentials.SubscriptionId)
 	zoneClient.Authorizer = ao.managementAuthorizer
 	log.Debug().Str("appID", appID).Str("zone", dnsZone).Msg("authorizing SP for DNS zone management")
-	ctx, cancel := common.GetContext()
+	listCtx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
-	zones, err := zoneClient.List(ctx, nil)
+	zones, err := zoneClient.List(listCtx, nil)
 	if err != nil {
-		return derrors.AsError(err, "cannot retrieve list of zones")
+		return tracing.Fail(span, derrors.AsError(err, "cannot retrieve list of zones"))
 	}
 	targetZoneId := ""
 	for _, zone := range zones.Values() {
@@ -255,13 +534,13 @@ func (ao *AzureOperation) authorizeDNSToSP(appID string, dnsZone string) derrors
 		}
 	}
 	if targetZoneId == "" {
-		return derrors.NewNotFoundError("unable to find target DNS zone on Azure")
+		return tracing.Fail(span, derrors.NewNotFoundError("unable to find target DNS zone on Azure"))
 	}
 
 	scope := targetZoneId
-	roleID, roleErr := ao.getRoleID(ContributorRole, scope)
+	roleID, roleErr := ao.getRoleID(ctx, ContributorRole, scope)
 	if roleErr != nil {
-		return roleErr
+		return tracing.Fail(span, roleErr)
 	}
 	log.Debug().Str("roleID", *roleID).Str("roleName", ContributorRole).Msg("role ID resolved")
 
@@ -274,12 +553,12 @@ func (ao *AzureOperation) authorizeDNSToSP(appID string, dnsZone string) derrors
 	roleAssignationRequest := authorization.RoleAssignmentCreateParameters{
 		Properties: roleProperties,
 	}
-	roleCtx, roleCancel := common.GetContext()
+	roleCtx, roleCancel := common.GetContextFrom(ctx)
 	defer roleCancel()
 	assignmentName := uuid.NewV4().String()
 	result, err := roleClient.Create(roleCtx, scope, assignmentName, roleAssignationRequest)
 	if err != nil {
-		return derrors.AsError(err, "cannot assign role")
+		return tracing.Fail(span, derrors.AsError(err, "cannot assign role"))
 	}
 	log.Debug().Str("ID", *result.ID).Msg("Role has been assigned")
 	return nil
@@ -297,15 +576,17 @@ func (ao *AzureOperation) getDNSResourceGroupName(zone *dns.Zone) (*string, derr
 	return &resourceGroupName, nil
 }
 
-func (ao *AzureOperation) getDNSZone(zoneName string) (*dns.Zone, derrors.Error) {
+func (ao *AzureOperation) getDNSZone(ctx context.Context, zoneName string) (*dns.Zone, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "getDNSZone")
+	defer span.End()
 	ao.AddToLog("Obtaining DNS zone information")
 	zoneClient := dns.NewZonesClient(ao.credentials.SubscriptionId)
 	zoneClient.Authorizer = ao.managementAuthorizer
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	zones, err := zoneClient.List(ctx, nil)
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot retrieve list of zones")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot retrieve list of zones"))
 	}
 	var targetZone dns.Zone
 	found := false
@@ -317,7 +598,7 @@ func (ao *AzureOperation) getDNSZone(zoneName string) (*dns.Zone, derrors.Error)
 		}
 	}
 	if !found {
-		return nil, derrors.NewNotFoundError("unable to find target DNS zone on Azure")
+		return nil, tracing.Fail(span, derrors.NewNotFoundError("unable to find target DNS zone on Azure"))
 	}
 	return &targetZone, nil
 }
@@ -347,6 +628,11 @@ func (ao *AzureOperation) getVMSubnetID(clusterID string) string {
 
 // getClusterName returns a valid cluster name to create resources in Azure.
 func (ao *AzureOperation) getClusterName(clusterName string) string {
+	return ClusterDNSName(clusterName)
+}
+
+// ClusterDNSName returns the name of the cluster used in its DNS records.
+func ClusterDNSName(clusterName string) string {
 	noSpaces := strings.ReplaceAll(clusterName, " ", "")
 	noDots := strings.ReplaceAll(noSpaces, ".", "-")
 	return strings.ToLower(noDots)
@@ -364,7 +650,9 @@ func (ao *AzureOperation) getResourceName(isManagement bool, clusterID string) s
 // createIPAddress reserves an IP address.
 //
 // az network public-ip create --name $1 --resource-group $2 --allocation-method Static --location "$3"
-func (ao *AzureOperation) createIPAddress(resourceGroupName string, addressName string, region string) (*network.PublicIPAddress, derrors.Error) {
+func (ao *AzureOperation) createIPAddress(ctx context.Context, resourceGroupName string, addressName string, region string) (*network.PublicIPAddress, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createIPAddress")
+	defer span.End()
 	networkClient := network.NewPublicIPAddressesClient(ao.credentials.SubscriptionId)
 	networkClient.Authorizer = ao.managementAuthorizer
 	tags := make(map[string]*string, 0)
@@ -384,70 +672,149 @@ func (ao *AzureOperation) createIPAddress(resourceGroupName string, addressName
 		Location:                        StringAsPTR(region),
 		Tags:                            tags,
 	}
-	ctx, cancel := common.GetContext()
+	createCtx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
-	responseFuture, createErr := networkClient.CreateOrUpdate(ctx, resourceGroupName, addressName, createRequest)
+	responseFuture, createErr := networkClient.CreateOrUpdate(createCtx, resourceGroupName, addressName, createRequest)
 	if createErr != nil {
-		return nil, derrors.AsError(createErr, "cannot create IP address")
+		return nil, tracing.Fail(span, derrors.AsError(createErr, "cannot create IP address"))
 	}
-	futureContext, cancelFuture := context.WithTimeout(context.Background(), IPAddressCreateDeadline)
+	futureContext, cancelFuture := context.WithTimeout(ctx, IPAddressCreateDeadline)
 	defer cancelFuture()
 	waitErr := responseFuture.WaitForCompletionRef(futureContext, networkClient.Client)
 	if waitErr != nil {
-		return nil, derrors.AsError(waitErr, "IP address failed during creation")
+		return nil, tracing.Fail(span, derrors.AsError(waitErr, "IP address failed during creation"))
 	}
 	IPAddress, resultErr := responseFuture.Result(networkClient)
 	if resultErr != nil {
 		log.Error().Interface("err", resultErr).Msg("IP address creation failed")
-		return nil, derrors.AsError(resultErr, "IP address creation failed")
+		return nil, tracing.Fail(span, derrors.AsError(resultErr, "IP address creation failed"))
 	}
 	log.Debug().Interface("ip", IPAddress).Msg("ip address created")
 	return &IPAddress, nil
 }
 
+// deleteIPAddress releases a public IP address.
+func (ao *AzureOperation) deleteIPAddress(ctx context.Context, resourceGroupName string, addressName string) derrors.Error {
+	ctx, span := tracing.StartSpan(ctx, "deleteIPAddress")
+	defer span.End()
+	networkClient := network.NewPublicIPAddressesClient(ao.credentials.SubscriptionId)
+	networkClient.Authorizer = ao.managementAuthorizer
+	deleteCtx, cancel := common.GetContextFrom(ctx)
+	defer cancel()
+	responseFuture, deleteErr := networkClient.Delete(deleteCtx, resourceGroupName, addressName)
+	if deleteErr != nil {
+		return tracing.Fail(span, derrors.AsError(deleteErr, "cannot delete IP address"))
+	}
+	futureContext, cancelFuture := context.WithTimeout(ctx, IPAddressCreateDeadline)
+	defer cancelFuture()
+	waitErr := responseFuture.WaitForCompletionRef(futureContext, networkClient.Client)
+	if waitErr != nil {
+		return tracing.Fail(span, derrors.AsError(waitErr, "IP address failed during deletion"))
+	}
+	log.Debug().Str("addressName", addressName).Msg("ip address deleted")
+	return nil
+}
+
+// clusterOwner returns the request identifier of the operation that created a cluster, and whether the cluster
+// exists.
+func (ao *AzureOperation) clusterOwner(ctx context.Context, resourceGroupName string, resourceName string) (string, bool, derrors.Error) {
+	clusterClient := containerservice.NewManagedClustersClient(ao.credentials.SubscriptionId)
+	clusterClient.Authorizer = ao.managementAuthorizer
+
+	getCtx, cancel := common.GetContextFrom(ctx)
+	defer cancel()
+	cluster, err := clusterClient.Get(getCtx, resourceGroupName, resourceName)
+	if err != nil {
+		if cluster.Response.Response != nil && cluster.StatusCode == http.StatusNotFound {
+			return "", false, nil
+		}
+		return "", false, derrors.NewInternalError("cannot retrieve AKS cluster", err).WithParams(resourceGroupName, resourceName)
+	}
+	owner, exists := cluster.Tags[RequestIDTag]
+	if !exists || owner == nil {
+		return "", true, nil
+	}
+	return *owner, true, nil
+}
+
+// deleteAKSCluster deletes an existing cluster managed by Azure.
+func (ao *AzureOperation) deleteAKSCluster(ctx context.Context, resourceGroupName string, resourceName string) (*autorest.Response, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "deleteAKSCluster")
+	defer span.End()
+	clusterClient := containerservice.NewManagedClustersClient(ao.credentials.SubscriptionId)
+	clusterClient.Authorizer = ao.managementAuthorizer
+
+	deleteCtx, cancel := common.GetContextFrom(ctx)
+	defer cancel()
+
+	log.Debug().Str("resourceGroupName", resourceGroupName).Str("resourceName", resourceName).Msg("Delete params")
+	deleteFuture, deleteErr := clusterClient.Delete(deleteCtx, resourceGroupName, resourceName)
+	if deleteErr != nil {
+		return nil, tracing.Fail(span, derrors.NewInternalError("cannot delete AKS cluster", deleteErr).WithParams(resourceGroupName, resourceName))
+	}
+
+	ao.AddToLog("waiting for AKS cluster to be deleted")
+	futureContext, cancelFuture := context.WithTimeout(ctx, ClusterDecommissionDeadline)
+	defer cancelFuture()
+	waitErr := deleteFuture.WaitForCompletionRef(futureContext, clusterClient.Client)
+	if waitErr != nil {
+		return nil, tracing.Fail(span, derrors.AsError(waitErr, "AKS cluster deletion failed"))
+	}
+	deleteResponse, resultErr := deleteFuture.Result(clusterClient)
+	if resultErr != nil {
+		log.Error().Interface("err", resultErr).Msg("AKS deletion failed")
+		return nil, tracing.Fail(span, derrors.AsError(resultErr, "AKS deletion failed"))
+	}
+	return &deleteResponse, nil
+}
+
 // retrieveKubeConfig retrieves the KubeConfig file for a given cluster
 //
 //  az aks get-credentials --resource-group dev --name mngt-dhiguero001
-func (ao *AzureOperation) retrieveKubeConfig(resourceGroupName string, resourceName string) (*string, derrors.Error) {
+func (ao *AzureOperation) retrieveKubeConfig(ctx context.Context, resourceGroupName string, resourceName string) (*string, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "retrieveKubeConfig")
+	defer span.End()
 	ao.AddToLog("retrieving kubeConfig")
 	clusterClient := containerservice.NewManagedClustersClient(ao.credentials.SubscriptionId)
 	clusterClient.Authorizer = ao.managementAuthorizer
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 
 	credentials, err := clusterClient.ListClusterUserCredentials(ctx, resourceGroupName, resourceName)
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot obtain cluster credentials")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot obtain cluster credentials"))
 	}
 
 	if credentials.Kubeconfigs == nil {
-		return nil, derrors.NewInternalError("empty kubeconfig returned")
+		return nil, tracing.Fail(span, derrors.NewInternalError("empty kubeconfig returned"))
 	}
 	kubeConfigs := *credentials.Kubeconfigs
 	if len(kubeConfigs) > 1 {
-		return nil, derrors.NewInternalError("credentials returned more than one KubeConfig file")
+		return nil, tracing.Fail(span, derrors.NewInternalError("credentials returned more than one KubeConfig file"))
 	}
 	result := kubeConfigs[0]
 	asString := string(*result.Value)
 	return &asString, nil
 }
 
-func (ao *AzureOperation) listDnsRecords(resourceGroupName string, dnsZone string, suffix string) ([]dns.RecordSet, derrors.Error) {
+func (ao *AzureOperation) listDnsRecords(ctx context.Context, resourceGroupName string, dnsZone string, suffix string) ([]dns.RecordSet, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "listDnsRecords")
+	defer span.End()
 	dnsClient := dns.NewRecordSetsClient(ao.credentials.SubscriptionId)
 	dnsClient.Authorizer = ao.managementAuthorizer
 
 	dnsRecords := make([]dns.RecordSet, 0)
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	recordSetListResultIterator, err := dnsClient.ListAllByDNSZoneComplete(ctx, resourceGroupName, dnsZone, nil, suffix)
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot list DNS entries")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot list DNS entries"))
 	}
 	dnsRecords = append(dnsRecords, recordSetListResultIterator.Value())
 	for recordSetListResultIterator.NotDone() {
 		err := recordSetListResultIterator.NextWithContext(ctx)
 		if err != nil {
-			return nil, derrors.AsError(err, "cannot list DNS entries")
+			return nil, tracing.Fail(span, derrors.AsError(err, "cannot list DNS entries"))
 		}
 		dnsRecords = append(dnsRecords, recordSetListResultIterator.Value())
 	}
@@ -456,7 +823,9 @@ func (ao *AzureOperation) listDnsRecords(resourceGroupName string, dnsZone strin
 
 // createDNSARecord creates a DNS A record for a given domain and IP.
 //az network dns record-set a add-record --resource-group $4 --zone-name $2 --record-set-name "$1" --ipv4-address $3 -o none
-func (ao *AzureOperation) createDNSARecord(resourceGroupName string, recordName string, dnsZone string, IPAddress string) (*dns.RecordSet, derrors.Error) {
+func (ao *AzureOperation) createDNSARecord(ctx context.Context, resourceGroupName string, recordName string, dnsZone string, IPAddress string) (*dns.RecordSet, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createDNSARecord")
+	defer span.End()
 	dnsClient := dns.NewRecordSetsClient(ao.credentials.SubscriptionId)
 	dnsClient.Authorizer = ao.managementAuthorizer
 	aRecord := dns.ARecord{Ipv4Address: &IPAddress}
@@ -470,35 +839,39 @@ func (ao *AzureOperation) createDNSARecord(resourceGroupName string, recordName
 	parameters := dns.RecordSet{
 		RecordSetProperties: recordSetProperties,
 	}
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	log.Debug().Str("resourceGroupName", resourceGroupName).Str("dnsZone", dnsZone).Str("recordName", recordName).Interface("parameters", parameters).Msg("creating entry")
 	entry, err := dnsClient.CreateOrUpdate(ctx, resourceGroupName, dnsZone, recordName, recordType, parameters, "", "")
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot create DNS entry")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot create DNS entry"))
 	}
 	log.Debug().Interface("A record", entry).Msg("DNS entry has been created")
 	return &entry, nil
 }
 
 // deleteDNSARecord removes a DNS A record
-func (ao *AzureOperation) deleteDNSARecord(resourceGroupName string, recordName string, dnsZone string) (*autorest.Response, derrors.Error) {
+func (ao *AzureOperation) deleteDNSARecord(ctx context.Context, resourceGroupName string, recordName string, dnsZone string) (*autorest.Response, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "deleteDNSARecord")
+	defer span.End()
 	dnsClient := dns.NewRecordSetsClient(ao.credentials.SubscriptionId)
 	dnsClient.Authorizer = ao.managementAuthorizer
 	recordType := dns.A
 
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	result, err := dnsClient.Delete(ctx, resourceGroupName, dnsZone, recordName, recordType, "")
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot delete DNS entry")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot delete DNS entry"))
 	}
 	return &result, nil
 }
 
 // createDNSARecord creates a DNS NS record for a given domain and IP.
 //az network dns record-set ns add-record --resource-group $4 --zone-name $2 --record-set-name "$1" --nsdname "$3.$2" -o none
-func (ao *AzureOperation) createDNSNSRecord(resourceGroupName string, recordName string, nsName string, dnsZone string) (*dns.RecordSet, derrors.Error) {
+func (ao *AzureOperation) createDNSNSRecord(ctx context.Context, resourceGroupName string, recordName string, nsName string, dnsZone string) (*dns.RecordSet, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createDNSNSRecord")
+	defer span.End()
 	dnsClient := dns.NewRecordSetsClient(ao.credentials.SubscriptionId)
 	dnsClient.Authorizer = ao.managementAuthorizer
 	nsRecord := dns.NsRecord{Nsdname: StringAsPTR(nsName)}
@@ -512,44 +885,48 @@ func (ao *AzureOperation) createDNSNSRecord(resourceGroupName string, recordName
 	parameters := dns.RecordSet{
 		RecordSetProperties: recordSetProperties,
 	}
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	log.Debug().Str("resourceGroupName", resourceGroupName).Str("dnsZone", dnsZone).Str("recordName", recordName).Interface("parameters", parameters).Msg("creating entry")
 	entry, err := dnsClient.CreateOrUpdate(ctx, resourceGroupName, dnsZone, recordName, recordType, parameters, "", "")
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot create DNS entry")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot create DNS entry"))
 	}
 	log.Debug().Interface("A record", entry).Msg("DNS entry has been created")
 	return &entry, nil
 }
 
 // deleteDNSNSRecord removes a DNS NS record
-func (ao *AzureOperation) deleteDNSNSRecord(resourceGroupName string, recordName string, dnsZone string) (*autorest.Response, derrors.Error) {
+func (ao *AzureOperation) deleteDNSNSRecord(ctx context.Context, resourceGroupName string, recordName string, dnsZone string) (*autorest.Response, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "deleteDNSNSRecord")
+	defer span.End()
 	dnsClient := dns.NewRecordSetsClient(ao.credentials.SubscriptionId)
 	dnsClient.Authorizer = ao.managementAuthorizer
 	recordType := dns.NS
 
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	result, err := dnsClient.Delete(ctx, resourceGroupName, dnsZone, recordName, recordType, "")
 	if err != nil {
-		return nil, derrors.AsError(err, "cannot delete DNS entry")
+		return nil, tracing.Fail(span, derrors.AsError(err, "cannot delete DNS entry"))
 	}
 	return &result, nil
 }
 
 // GetClusterDetails retrieves the information of an existing cluster.
-func (ao *AzureOperation) getClusterDetails(isManagementCluster bool, resourceGroupName string, clusterID string) (*containerservice.ManagedCluster, derrors.Error) {
+func (ao *AzureOperation) getClusterDetails(ctx context.Context, isManagementCluster bool, resourceGroupName string, clusterID string) (*containerservice.ManagedCluster, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "getClusterDetails")
+	defer span.End()
 	ao.AddToLog("Obtaining Cluster information")
 	clusterClient := containerservice.NewManagedClustersClient(ao.credentials.SubscriptionId)
 	clusterClient.Authorizer = ao.managementAuthorizer
 	resourceName := ao.getResourceName(isManagementCluster, clusterID)
 
-	ctx, cancel := common.GetContext()
+	ctx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 	managedCluster, err := clusterClient.Get(ctx, resourceGroupName, resourceName)
 	if err != nil {
-		return nil, derrors.NewNotFoundError("cannot retrieve managed cluster", err)
+		return nil, tracing.Fail(span, derrors.NewNotFoundError("cannot retrieve managed cluster", err))
 	}
 	return &managedCluster, nil
 }
@@ -583,6 +960,7 @@ func (ao *AzureOperation) getKubernetesCreateRequest(
 	tags[ClusterNameTag] = StringAsPTR(ao.getClusterName(clusterName))
 	tags[CreateByTag] = StringAsPTR(CreateByValue)
 	tags[DnsZoneTag] = StringAsPTR(dnsZoneName)
+	tags[RequestIDTag] = StringAsPTR(ao.requestID)
 
 	numNodesPtr, err := Int64ToInt32(numNodes)
 	if err != nil {
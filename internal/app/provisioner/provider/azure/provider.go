@@ -17,9 +17,12 @@
 package azure
 
 import (
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-provisioner-go"
 	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
 )
@@ -53,3 +56,26 @@ func (aip *AzureInfrastructureProvider) Scale(request entities.ScaleRequest) (en
 func (aip *AzureInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
 	return NewManagementOperation(aip.credentials, request, entities.GetKubeConfig, aip.config)
 }
+
+// ValidateCredentials checks that Azure accepts a set of credentials by requesting a token for the management API.
+func ValidateCredentials(credentials *grpc_provisioner_go.AzureCredentials) derrors.Error {
+	creds := NewAzureCredentials(credentials)
+	endpoint := creds.ActiveDirectoryEndpointUrl
+	if endpoint == "" {
+		endpoint = azure.PublicCloud.ActiveDirectoryEndpoint
+	}
+	oauthConfig, err := adal.NewOAuthConfig(endpoint, creds.TenantId)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot create OAuthConfig", err)
+	}
+	token, err := adal.NewServicePrincipalToken(*oauthConfig, creds.ClientId, creds.ClientSecret, ManagementBaseURI)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot create service principal token", err)
+	}
+	ctx, cancel := common.GetContext()
+	defer cancel()
+	if err := token.RefreshWithContext(ctx); err != nil {
+		return derrors.NewUnauthenticatedError("azure rejected the credentials", err)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ package azure
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,6 +31,9 @@ import (
 	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 )
 
@@ -45,6 +49,28 @@ var ManagementIPAddressNames = []string{entities.IngressIPAddressName, entities.
 // ApplicationIPAddressNames with the list of addresses to be created in the application cluster
 var ApplicationIPAddressNames = []string{entities.IngressIPAddressName}
 
+// Names of the steps of a provisioning operation.
+const (
+	CreateClusterStep            = "create-cluster"
+	RetrieveKubeConfigStep       = "retrieve-kubeconfig"
+	ReserveIPAddressesStep       = "reserve-ip-addresses"
+	ResolveDNSZoneStep           = "resolve-dns-zone"
+	CreateDNSEntriesStep         = "create-dns-entries"
+	InstallCertManagerStep       = "install-cert-manager"
+	RequestCertificateIssuerStep = "request-certificate-issuer"
+	RequestCertificateStep       = "request-certificate"
+	CreateCASecretStep           = "create-ca-secret"
+)
+
+// Names of the outputs produced by the provisioning steps that are required by later steps.
+const (
+	NodeResourceGroupOutput    = "nodeResourceGroup"
+	KubeConfigOutput           = "kubeConfig"
+	DNSZoneResourceGroupOutput = "dnsZoneResourceGroup"
+	// IPAddressOutputPrefix is prepended to the name of each reserved IP address.
+	IPAddressOutputPrefix = "ip."
+)
+
 // ProvisionerOperation structure with the methods required to performing a provisioning for a new Kubernetes
 // cluster in Azure.
 type ProvisionerOperation struct {
@@ -53,15 +79,16 @@ type ProvisionerOperation struct {
 	result            *entities.ProvisionResult
 	config            *config.Config
 	certManagerHelper *certmngr.CertManagerHelper
+	pipeline          *workflow.Pipeline
 }
 
 // NewProvisionerOperation creates a new Azure provisioning operation.
 func NewProvisionerOperation(credentials *AzureCredentials, request entities.ProvisionRequest, config *config.Config) (*ProvisionerOperation, derrors.Error) {
-	azureOp, err := NewAzureOperation(credentials)
+	azureOp, err := NewAzureOperation(request.RequestID, credentials)
 	if err != nil {
 		return nil, err
 	}
-	return &ProvisionerOperation{
+	po := &ProvisionerOperation{
 		AzureOperation: azureOp,
 		request:        request,
 		result: &entities.ProvisionResult{
@@ -70,7 +97,29 @@ func NewProvisionerOperation(credentials *AzureCredentials, request entities.Pro
 		},
 		config:            config,
 		certManagerHelper: certmngr.NewCertManagerHelper(config),
-	}, nil
+	}
+	po.pipeline = workflow.NewPipeline(po.steps()...)
+	po.pipeline.OnStepStarted(po.startStep)
+	po.pipeline.OnStepCompleted(po.completeStep)
+	return po, nil
+}
+
+// steps returns the sequence of steps required to provision a cluster.
+func (po *ProvisionerOperation) steps() []workflow.Step {
+	steps := []workflow.Step{
+		workflow.NewCompensableStep(CreateClusterStep, po.createClusterStep, po.deleteClusterStep),
+		workflow.NewStep(RetrieveKubeConfigStep, po.retrieveKubeConfigStep),
+		workflow.NewCompensableStep(ReserveIPAddressesStep, po.reserveIPAddressesStep, po.releaseIPAddressesStep),
+		workflow.NewStep(ResolveDNSZoneStep, po.resolveDNSZoneStep),
+		workflow.NewCompensableStep(CreateDNSEntriesStep, po.createDNSEntriesStep, po.deleteDNSEntriesStep),
+		workflow.NewStep(InstallCertManagerStep, po.installCertManagerStep),
+		workflow.NewStep(RequestCertificateIssuerStep, po.requestCertificateIssuerStep),
+		workflow.NewStep(RequestCertificateStep, po.requestCertificateStep),
+	}
+	if po.request.IsManagementCluster {
+		steps = append(steps, workflow.NewStep(CreateCASecretStep, po.createCASecretStep))
+	}
+	return steps
 }
 
 // RequestID returns the request identifier associated with this operation
@@ -81,140 +130,334 @@ func (po ProvisionerOperation) RequestID() string {
 // Metadata returns the operation associated metadata
 func (po ProvisionerOperation) Metadata() entities.OperationMetadata {
 	return entities.OperationMetadata{
-		OrganizationID: po.request.OrganizationID,
-		ClusterID:      po.request.ClusterID,
-		RequestID:      po.request.RequestID,
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
 	}
 }
 
-func (po ProvisionerOperation) notifyError(err derrors.Error, callback func(requestId string)) {
-	log.Error().Str("trace", err.DebugReport()).Msg("operation failed")
-	po.setError(err.Error())
+// Request returns the request that originated the operation
+func (po ProvisionerOperation) Request() interface{} {
+	return po.request
+}
+
+func (po ProvisionerOperation) notifyError(ctx context.Context, err derrors.Error, callback func(requestId string)) {
+	checkpoint := po.pipeline.Checkpoint()
+	if checkpoint.Failed != "" {
+		po.failStep(checkpoint.Failed, err)
+	}
+	if po.request.RollbackOnFailure {
+		po.rollback()
+	}
+	po.setFailure(ctx, err)
 	callback(po.request.RequestID)
 }
 
 // Execute triggers the execution of the operation. The callback function on the execute is expected to be
 // called when the operation finish its execution independently of the status.
-func (po ProvisionerOperation) Execute(callback func(requestId string)) {
+func (po ProvisionerOperation) Execute(ctx context.Context, callback func(requestId string)) {
 	log.Debug().Str("organizationID", po.request.OrganizationID).Str("clusterID", po.request.ClusterID).Str("clusterName", po.request.ClusterName).Str("resultClusterName", po.result.ClusterName).Msg("executing provisioning operation")
-	po.started = time.Now()
-	po.SetProgress(entities.InProgress)
+	ctx = po.start(ctx)
+	defer po.finish()
+	defer po.certManagerHelper.Destroy()
+
+	err := po.pipeline.Run(ctx)
+	if err != nil {
+		po.notifyError(ctx, err, callback)
+		return
+	}
+
+	log.Debug().Msg("provisioning finished")
+	po.setFinished()
+	callback(po.request.RequestID)
+	return
+}
+
+// Interrupt stops the provisioning at the next step boundary and marks it as interrupted.
+func (po ProvisionerOperation) Interrupt() {
+	po.pipeline.Interrupt()
+	po.AzureOperation.Interrupt()
+}
+
+// Checkpoint returns the state of the steps of the operation.
+func (po ProvisionerOperation) Checkpoint() *entities.StepCheckpoint {
+	return po.pipeline.Checkpoint()
+}
 
-	createdCluster, err := po.createAKSCluster()
+// Resume prepares the operation to be executed again from the step that failed. The outputs of the
+// completed steps are used to rebuild the result of the operation.
+func (po ProvisionerOperation) Resume(checkpoint entities.StepCheckpoint) derrors.Error {
+	if _, exists := checkpoint.Outputs[KubeConfigOutput]; !exists {
+		// The kubeconfig is not persisted, so the operations restored after a restart retrieve it again.
+		checkpoint.Invalidate(RetrieveKubeConfigStep)
+	}
+	err := po.pipeline.Restore(checkpoint)
 	if err != nil {
-		po.notifyError(err, callback)
+		return err
+	}
+	for key, value := range checkpoint.Outputs {
+		if key == KubeConfigOutput {
+			po.result.RawKubeConfig = value
+		} else if strings.HasPrefix(key, IPAddressOutputPrefix) {
+			po.result.SetIPAddress(strings.TrimPrefix(key, IPAddressOutputPrefix), value)
+		}
+	}
+	po.reset()
+	if checkpoint.Failed != "" {
+		po.AddToLog(fmt.Sprintf("resuming operation from step %s", checkpoint.Failed))
+	} else {
+		po.AddToLog("resuming operation")
+	}
+	return nil
+}
+
+// rollback undoes the steps executed by the operation so that the partially provisioned resources are released.
+// Interrupted operations are not rolled back so that they can be resumed after a restart.
+func (po ProvisionerOperation) rollback() {
+	if po.isInterrupted() {
+		po.AddToLog("provisioning interrupted, rollback skipped")
 		return
 	}
+	po.AddToLog("rolling back provisioning")
+	// The execution context may have been cancelled so the rollback uses its own context.
+	actions := po.pipeline.Rollback(context.Background())
+	for _, action := range actions {
+		if action.ErrorMsg != "" {
+			po.AddWarningToLog("cannot roll back step", map[string]string{"step": action.Step, "error": action.ErrorMsg})
+		} else {
+			po.AddToLog(fmt.Sprintf("step %s rolled back", action.Step))
+		}
+	}
+	po.setRollback(actions)
+}
 
+// createClusterStep creates the AKS cluster.
+func (po *ProvisionerOperation) createClusterStep(ctx context.Context) derrors.Error {
+	createdCluster, err := po.createAKSCluster(ctx)
+	if err != nil {
+		return err
+	}
+	po.pipeline.SetOutput(NodeResourceGroupOutput, *createdCluster.NodeResourceGroup)
 	po.AddToLog(fmt.Sprintf("New cluster has been created with an associated resource group named as %s", *createdCluster.NodeResourceGroup))
+	return nil
+}
+
+// deleteClusterStep deletes the AKS cluster if it was created by the operation.
+func (po *ProvisionerOperation) deleteClusterStep(ctx context.Context) derrors.Error {
+	resourceName := po.getResourceName(po.request.IsManagementCluster, po.request.ClusterID)
+	owner, exists, err := po.clusterOwner(ctx, po.request.AzureOptions.ResourceGroup, resourceName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if owner != po.request.RequestID {
+		po.AddWarningToLog("cluster was not created by the operation, keeping it", map[string]string{"owner": owner})
+		return nil
+	}
+	po.AddToLog("Deleting cluster")
+	_, err = po.deleteAKSCluster(ctx, po.request.AzureOptions.ResourceGroup, resourceName)
+	return err
+}
+
+// retrieveKubeConfigStep obtains the credentials to access the new cluster.
+func (po *ProvisionerOperation) retrieveKubeConfigStep(ctx context.Context) derrors.Error {
+	resourceName := po.getResourceName(po.request.IsManagementCluster, po.request.ClusterID)
+	kubeConfig, err := po.retrieveKubeConfig(ctx, po.request.AzureOptions.ResourceGroup, resourceName)
+	if err != nil {
+		return err
+	}
+	po.result.RawKubeConfig = *kubeConfig
+	po.pipeline.SetOutput(KubeConfigOutput, *kubeConfig)
+	return nil
+}
+
+// reserveIPAddressesStep reserves the public IP addresses of the cluster.
+func (po *ProvisionerOperation) reserveIPAddressesStep(ctx context.Context) derrors.Error {
+	nodeResourceGroup, err := po.requiredOutput(NodeResourceGroupOutput)
+	if err != nil {
+		return err
+	}
 	log.Debug().Msg("cluster is ready, creating the IP addresses")
-	err = po.createAssociatedIPAddresses(*createdCluster.NodeResourceGroup)
+	err = po.createAssociatedIPAddresses(ctx, nodeResourceGroup)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
 	log.Debug().Msg("IP address have been reserved")
 	po.AddToLog("IP address have been reserved")
+	return nil
+}
+
+// releaseIPAddressesStep releases the public IP addresses of the cluster.
+func (po *ProvisionerOperation) releaseIPAddressesStep(ctx context.Context) derrors.Error {
+	nodeResourceGroup, err := po.requiredOutput(NodeResourceGroupOutput)
+	if err != nil {
+		return err
+	}
+	for _, addressName := range po.ipAddressNames() {
+		err = po.deleteIPAddress(ctx, nodeResourceGroup, addressName)
+		if err != nil {
+			return err
+		}
+		po.AddToLog(fmt.Sprintf("IP address released %s", addressName))
+	}
+	return nil
+}
+
+// resolveDNSZoneStep obtains the resource group of the target DNS zone.
+func (po *ProvisionerOperation) resolveDNSZoneStep(ctx context.Context) derrors.Error {
 	po.AddToLog("Obtaining DNS zone information")
-	zone, err := po.getDNSZone(po.request.AzureOptions.DNSZoneName)
+	zone, err := po.getDNSZone(ctx, po.request.AzureOptions.DNSZoneName)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
 	log.Debug().Interface("zone", zone).Msg("Target zone details")
-	po.AddToLog("Creating DNS entries")
 	dnsZoneResourceGroupName, err := po.getDNSResourceGroupName(zone)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
+	po.pipeline.SetOutput(DNSZoneResourceGroupOutput, *dnsZoneResourceGroupName)
+	return nil
+}
 
-	if po.request.IsManagementCluster {
-		err = po.createManagementDNSEntries(*dnsZoneResourceGroupName)
-	} else {
-		err = po.createApplicationDNSEntries(*dnsZoneResourceGroupName)
+// createDNSEntriesStep creates the DNS entries pointing to the reserved IP addresses.
+func (po *ProvisionerOperation) createDNSEntriesStep(ctx context.Context) derrors.Error {
+	dnsZoneResourceGroupName, err := po.requiredOutput(DNSZoneResourceGroupOutput)
+	if err != nil {
+		return err
 	}
+	po.AddToLog("Creating DNS entries")
+	err = po.createDNSEntries(ctx, dnsZoneResourceGroupName)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
 	po.AddToLog("DNS entries have been defined")
+	return nil
+}
 
-	err = po.installCertManager()
+// deleteDNSEntriesStep deletes the DNS entries of the cluster.
+func (po *ProvisionerOperation) deleteDNSEntriesStep(ctx context.Context) derrors.Error {
+	dnsZoneResourceGroupName, err := po.requiredOutput(DNSZoneResourceGroupOutput)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
+	}
+	if po.request.IsManagementCluster {
+		nsRecordName, _ := po.endpointNSRecord()
+		_, err = po.deleteDNSNSRecord(ctx, dnsZoneResourceGroupName, nsRecordName, po.request.AzureOptions.DNSZoneName)
+		if err != nil {
+			return err
+		}
+		po.AddToLog(fmt.Sprintf("DNS entry deleted %s", nsRecordName))
+	}
+	for dnsRecordName := range po.dnsARecords() {
+		_, err = po.deleteDNSARecord(ctx, dnsZoneResourceGroupName, dnsRecordName, po.request.AzureOptions.DNSZoneName)
+		if err != nil {
+			return err
+		}
+		po.AddToLog(fmt.Sprintf("DNS entry deleted %s", dnsRecordName))
+	}
+	return nil
+}
+
+// installCertManagerStep installs the cert manager on the new cluster.
+func (po *ProvisionerOperation) installCertManagerStep(ctx context.Context) derrors.Error {
+	err := po.installCertManager(ctx)
+	if err != nil {
+		return err
 	}
-	defer po.certManagerHelper.Destroy()
 	po.AddToLog("Cert manager has been installed")
+	return nil
+}
 
-	err = po.requestCertificateIssuer(*dnsZoneResourceGroupName)
+// requestCertificateIssuerStep creates the certificate issuer and waits for it to be available.
+func (po *ProvisionerOperation) requestCertificateIssuerStep(ctx context.Context) derrors.Error {
+	dnsZoneResourceGroupName, err := po.requiredOutput(DNSZoneResourceGroupOutput)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
+	}
+	err = po.connectCertManager()
+	if err != nil {
+		return err
+	}
+	err = po.requestCertificateIssuer(ctx, dnsZoneResourceGroupName)
+	if err != nil {
+		return err
 	}
 	po.AddToLog("certificate issuer requested")
-	err = po.certManagerHelper.CheckCertificateIssuer()
+	err = tracing.Trace(ctx, "CheckCertificateIssuer", func(context.Context) derrors.Error {
+		return po.certManagerHelper.CheckCertificateIssuer()
+	})
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
 	log.Debug().Msg("certificate issuer available")
-	err = po.requestCertificate()
+	return nil
+}
+
+// requestCertificateStep requests the cluster certificate and waits for it to be valid.
+func (po *ProvisionerOperation) requestCertificateStep(ctx context.Context) derrors.Error {
+	err := po.connectCertManager()
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
-	po.AddToLog("validating cluster certificate")
-	err = po.certManagerHelper.ValidateCertificate()
+	err = po.requestCertificate(ctx)
 	if err != nil {
-		po.notifyError(err, callback)
-		return
+		return err
 	}
+	po.AddToLog("validating cluster certificate")
+	return tracing.Trace(ctx, "ValidateCertificate", func(context.Context) derrors.Error {
+		return po.certManagerHelper.ValidateCertificate()
+	})
+}
 
-	if po.request.IsManagementCluster {
-		po.AddToLog("Adding CA certificate")
-		err = po.certManagerHelper.CreateCASecret(po.request.IsProduction)
-		if err != nil {
-			po.notifyError(err, callback)
-			return
-		}
-		po.AddToLog("Added CA certificate as a secret")
+// createCASecretStep adds the CA certificate as a secret on management clusters.
+func (po *ProvisionerOperation) createCASecretStep(ctx context.Context) derrors.Error {
+	err := po.connectCertManager()
+	if err != nil {
+		return err
 	}
-
-	log.Debug().Msg("provisioning finished")
-	po.elapsedTime = time.Now().Sub(po.started).Nanoseconds()
-	po.SetProgress(entities.Finished)
-	callback(po.request.RequestID)
-	return
+	po.AddToLog("Adding CA certificate")
+	err = tracing.Trace(ctx, "CreateCASecret", func(context.Context) derrors.Error {
+		return po.certManagerHelper.CreateCASecret(po.request.IsProduction)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Added CA certificate as a secret")
+	return nil
 }
 
-// Cancel triggers the cancellation of the operation
-func (po ProvisionerOperation) Cancel() derrors.Error {
-	panic("implement me")
+// requiredOutput retrieves an output of a previous step.
+func (po ProvisionerOperation) requiredOutput(key string) (string, derrors.Error) {
+	value, exists := po.pipeline.Output(key)
+	if !exists {
+		return "", derrors.NewFailedPreconditionError("output of a previous step not found").WithParams(key)
+	}
+	return value, nil
 }
 
 // setResultIP sets the resulting IP address
 func (po ProvisionerOperation) setResultIP(addressName string, IP *network.PublicIPAddress) {
 	po.result.SetIPAddress(addressName, *IP.IPAddress)
+	po.pipeline.SetOutput(IPAddressOutputPrefix+addressName, *IP.IPAddress)
 }
 
 // Result returns the operation result if this operation is successful
 func (po ProvisionerOperation) Result() entities.OperationResult {
-	elapsed := po.elapsedTime
-	if po.elapsedTime == 0 && po.taskProgress == entities.InProgress {
-		// If the operation is in progress, retrieved the ongoing time.
-		elapsed = time.Now().Sub(po.started).Nanoseconds()
-	}
+	progress, elapsed, errorMsg := po.status()
 
 	// TODO Fix with the final result
 	return entities.OperationResult{
 		RequestId:       po.request.RequestID,
 		Type:            entities.Provision,
-		Progress:        po.taskProgress,
+		Progress:        progress,
 		ElapsedTime:     elapsed,
-		ErrorMsg:        po.errorMsg,
+		ErrorMsg:        errorMsg,
 		ProvisionResult: po.result,
+		Rollback:        po.rollbackActions(),
 	}
 }
 
@@ -231,7 +474,9 @@ func (po ProvisionerOperation) getLinuxProperties() *containerservice.LinuxProfi
 // Equivalent function az aks create --resource-group $2 --location "$3" --name $AKS_NAME
 // --service-principal $4 --client-secret $5 --node-count $6 --kubernetes-version $7
 // --enable-addons monitoring --node-vm-size Standard_DS2_v2 --disable-rbac
-func (po ProvisionerOperation) createAKSCluster() (*containerservice.ManagedCluster, derrors.Error) {
+func (po ProvisionerOperation) createAKSCluster(ctx context.Context) (*containerservice.ManagedCluster, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createAKSCluster")
+	defer span.End()
 	po.AddToLog("Creating new cluster")
 	clusterClient := containerservice.NewManagedClustersClient(po.credentials.SubscriptionId)
 	clusterClient.Authorizer = po.managementAuthorizer
@@ -242,78 +487,78 @@ func (po ProvisionerOperation) createAKSCluster() (*containerservice.ManagedClus
 		po.request.NumNodes, po.request.NodeType, po.request.Zone,
 		po.request.AzureOptions.DNSZoneName)
 	if err != nil {
-		return nil, err
+		return nil, tracing.Fail(span, err)
+	}
+	resourceName := po.getResourceName(po.request.IsManagementCluster, po.request.ClusterID)
+	// CreateOrUpdate would take over a cluster with the same name created by another operation.
+	owner, exists, err := po.clusterOwner(ctx, po.request.AzureOptions.ResourceGroup, resourceName)
+	if err != nil {
+		return nil, tracing.Fail(span, err)
+	}
+	if exists && owner != po.request.RequestID {
+		return nil, tracing.Fail(span, derrors.NewAlreadyExistsError("AKS cluster already exists").WithParams(resourceName))
 	}
-	ctx, cancel := common.GetContext()
+	createCtx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 
-	resourceName := po.getResourceName(po.request.IsManagementCluster, po.request.ClusterID)
 	log.Debug().Str("resourceGroupName", po.request.AzureOptions.ResourceGroup).Str("resourceName", resourceName).Msg("CreateOrUpdate params")
-	responseFuture, createErr := clusterClient.CreateOrUpdate(ctx, po.request.AzureOptions.ResourceGroup, resourceName, *parameters)
+	responseFuture, createErr := clusterClient.CreateOrUpdate(createCtx, po.request.AzureOptions.ResourceGroup, resourceName, *parameters)
 	if createErr != nil {
-		return nil, derrors.NewInternalError("cannot create AKS cluster", createErr).WithParams(po.request)
+		return nil, tracing.Fail(span, derrors.NewInternalError("cannot create AKS cluster", createErr).WithParams(redact.Value(po.request)))
 	}
 	po.AddToLog("waiting for AKS to be created")
-	futureContext, cancelFuture := context.WithTimeout(context.Background(), ClusterCreateDeadline)
+	futureContext, cancelFuture := context.WithTimeout(ctx, ClusterCreateDeadline)
 	defer cancelFuture()
 	waitErr := responseFuture.WaitForCompletionRef(futureContext, clusterClient.Client)
 	if waitErr != nil {
-		return nil, derrors.AsError(waitErr, "AKS cluster creation failed during creation")
+		return nil, tracing.Fail(span, derrors.AsError(waitErr, "AKS cluster creation failed during creation"))
 	}
 	managedCluster, resultErr := responseFuture.Result(clusterClient)
 	if resultErr != nil {
 		log.Error().Interface("err", resultErr).Msg("AKS creation failed")
-		return nil, derrors.AsError(resultErr, "AKS creation failed")
+		return nil, tracing.Fail(span, derrors.AsError(resultErr, "AKS creation failed"))
 	}
 	log.Debug().Str("nodeResourceGroup", *managedCluster.NodeResourceGroup).Msg("AKS has been created")
-	kubeConfig, err := po.retrieveKubeConfig(po.request.AzureOptions.ResourceGroup, resourceName)
-	if err != nil {
-		return nil, err
-	}
-	po.result.RawKubeConfig = *kubeConfig
 	return &managedCluster, nil
 }
 
 // CreateServicePrincipal creates a service principal for rbac. The code is based on the azure
 // CLI code that is available at: https://github.com/Azure/azure-cli/blob/master/src/azure-cli/azure/cli/command_modules/role/custom.py
-func (po ProvisionerOperation) createServicePrincipalForRBAC(requestID string) (*graphrbac.Application, derrors.Error) {
+func (po ProvisionerOperation) createServicePrincipalForRBAC(ctx context.Context, requestID string) (*graphrbac.Application, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "createServicePrincipalForRBAC")
+	defer span.End()
 	log.Debug().Msg("creating service principal for RBAC")
 	appClient := graphrbac.NewApplicationsClient(po.credentials.TenantId)
 	appClient.Authorizer = po.graphAuthorizer
 	spClient := graphrbac.NewServicePrincipalsClient(po.credentials.TenantId)
 	spClient.Authorizer = po.graphAuthorizer
 	log.Debug().Msg("creating base application")
-	app, err := po.createApplication(appClient, po.request.ClusterID)
+	app, err := po.createApplication(ctx, appClient, po.request.ClusterID)
 	if err != nil {
-		return nil, err
+		return nil, tracing.Fail(span, err)
 	}
-	log.Debug().Interface("app", app).Msg("application entity has been created, creating SP")
+	log.Debug().Interface("app", redact.Value(app)).Msg("application entity has been created, creating SP")
 
 	// Once the main application entity is created, we need to create the associated service principal
-	associatedSP, err := po.createServicePrincipal(spClient, *app.AppID, po.request.ClusterID)
+	associatedSP, err := po.createServicePrincipal(ctx, spClient, *app.AppID, po.request.ClusterID)
 	if err != nil {
-		return nil, err
+		return nil, tracing.Fail(span, err)
 	}
-	log.Debug().Interface("sp", associatedSP).Msg("service principal has been created")
+	log.Debug().Interface("sp", redact.Value(associatedSP)).Msg("service principal has been created")
 	return app, nil
 }
 
 // createAssociatedIPAddresses creates a set of publicly exposed IP addresses for the cluster.
-func (po ProvisionerOperation) createAssociatedIPAddresses(nodeResourceGroup string) derrors.Error {
+func (po ProvisionerOperation) createAssociatedIPAddresses(ctx context.Context, nodeResourceGroup string) derrors.Error {
 	po.AddToLog("Reserving IP addresses")
-	var IPAddressPool []string
-	if po.request.IsManagementCluster {
-		IPAddressPool = ManagementIPAddressNames
-	} else {
-		IPAddressPool = ApplicationIPAddressNames
-	}
+	IPAddressPool := po.ipAddressNames()
 
 	responseCh := make(chan ParallelIPCreateResponse, len(IPAddressPool))
 	var wg sync.WaitGroup
 	wg.Add(len(IPAddressPool))
 
 	for _, addressName := range IPAddressPool {
-		go po.createIPInParallel(responseCh, &wg, nodeResourceGroup, addressName, po.request.Zone)
+		go po.createIPInParallel(ctx, responseCh, &wg, nodeResourceGroup, addressName, po.request.Zone)
 	}
 
 	wg.Wait()
@@ -335,9 +580,9 @@ type ParallelIPCreateResponse struct {
 }
 
 // createIPInParallel manages the creation of the required IP addresses in parallel.
-func (po ProvisionerOperation) createIPInParallel(response chan<- ParallelIPCreateResponse, wg *sync.WaitGroup, resourceGroupName string, addressName string, region string) {
+func (po ProvisionerOperation) createIPInParallel(ctx context.Context, response chan<- ParallelIPCreateResponse, wg *sync.WaitGroup, resourceGroupName string, addressName string, region string) {
 	defer wg.Done()
-	ip, err := po.createIPAddress(resourceGroupName, addressName, region)
+	ip, err := po.createIPAddress(ctx, resourceGroupName, addressName, region)
 	result := ParallelIPCreateResponse{
 		AddressName: addressName,
 		IPAddress:   ip,
@@ -346,34 +591,58 @@ func (po ProvisionerOperation) createIPInParallel(response chan<- ParallelIPCrea
 	response <- result
 }
 
-// createDNSEntries triggers the creation of the different DNS entries required for a management cluster
-func (po ProvisionerOperation) createManagementDNSEntries(resourceGroupName string) derrors.Error {
+// ipAddressNames returns the names of the IP addresses to be reserved for the cluster.
+func (po ProvisionerOperation) ipAddressNames() []string {
+	if po.request.IsManagementCluster {
+		return ManagementIPAddressNames
+	}
+	return ApplicationIPAddressNames
+}
+
+// dnsARecords returns the DNS A records of the cluster indexed by record name.
+func (po ProvisionerOperation) dnsARecords() map[string]string {
 	dnsClusterRoot := po.getClusterName(po.request.ClusterName)
 
 	toAdd := make(map[string]string, 0)
 	// Ingress entries name.dnsZone and *.name.dnsZone
 	toAdd[dnsClusterRoot] = po.result.StaticIPAddresses.Ingress
 	toAdd[fmt.Sprintf("*.%s", dnsClusterRoot)] = po.result.StaticIPAddresses.Ingress
+	if !po.request.IsManagementCluster {
+		return toAdd
+	}
 	// DNS
 	toAdd[fmt.Sprintf("dns.%s", dnsClusterRoot)] = po.result.StaticIPAddresses.DNS
 	// VPN Server
 	toAdd[fmt.Sprintf("vpn-server.%s", dnsClusterRoot)] = po.result.StaticIPAddresses.VPNServer
 	// CoreDNS
 	toAdd[fmt.Sprintf("app-dns.%s", dnsClusterRoot)] = po.result.StaticIPAddresses.CoreDNSExt
+	return toAdd
+}
 
-	for dnsRecordName, IP := range toAdd {
-		entry, err := po.createDNSARecord(resourceGroupName, dnsRecordName, po.request.AzureOptions.DNSZoneName, IP)
+// endpointNSRecord returns the name and target of the NS record used for the endpoint resolution of management
+// clusters.
+func (po ProvisionerOperation) endpointNSRecord() (string, string) {
+	dnsClusterRoot := po.getClusterName(po.request.ClusterName)
+	// TODO Append dnsZone to the ns
+	return fmt.Sprintf("ep.%s.%s", dnsClusterRoot, po.request.AzureOptions.DNSZoneName), fmt.Sprintf("app-dns.%s", dnsClusterRoot)
+}
+
+// createDNSEntries triggers the creation of the different DNS entries required for the cluster
+func (po ProvisionerOperation) createDNSEntries(ctx context.Context, resourceGroupName string) derrors.Error {
+	for dnsRecordName, IP := range po.dnsARecords() {
+		entry, err := po.createDNSARecord(ctx, resourceGroupName, dnsRecordName, po.request.AzureOptions.DNSZoneName, IP)
 		if err != nil {
 			return err
 		}
 		po.AddToLog(fmt.Sprintf("DNS entry created %s", *entry.Fqdn))
 	}
+	if !po.request.IsManagementCluster {
+		return nil
+	}
 
-	// TODO Append dnsZone to the ns
 	// Create the NS entry for the endpoint resolution
-	entry, err := po.createDNSNSRecord(resourceGroupName,
-		fmt.Sprintf("ep.%s.%s", dnsClusterRoot, po.request.AzureOptions.DNSZoneName), fmt.Sprintf("app-dns.%s", dnsClusterRoot),
-		po.request.AzureOptions.DNSZoneName)
+	nsRecordName, nsName := po.endpointNSRecord()
+	entry, err := po.createDNSNSRecord(ctx, resourceGroupName, nsRecordName, nsName, po.request.AzureOptions.DNSZoneName)
 	if err != nil {
 		return err
 	}
@@ -382,46 +651,41 @@ func (po ProvisionerOperation) createManagementDNSEntries(resourceGroupName stri
 	return nil
 }
 
-func (po ProvisionerOperation) createApplicationDNSEntries(resourceGroupName string) derrors.Error {
-	dnsClusterRoot := po.getClusterName(po.request.ClusterName)
-
-	toAdd := make(map[string]string, 0)
-	// Ingress entries name.dnsZone and *.name.dnsZone
-	toAdd[dnsClusterRoot] = po.result.StaticIPAddresses.Ingress
-	toAdd[fmt.Sprintf("*.%s", dnsClusterRoot)] = po.result.StaticIPAddresses.Ingress
-
-	for dnsRecordName, IP := range toAdd {
-		entry, err := po.createDNSARecord(resourceGroupName, dnsRecordName, po.request.AzureOptions.DNSZoneName, IP)
-		if err != nil {
-			return err
-		}
-		po.AddToLog(fmt.Sprintf("DNS entry created %s", *entry.Fqdn))
-	}
-
-	return nil
-}
-
 // installCertManager triggers the installation of the cert manager component in charge of providing
 // certificates.
-func (po ProvisionerOperation) installCertManager() derrors.Error {
+func (po ProvisionerOperation) installCertManager(ctx context.Context) derrors.Error {
 	po.AddToLog("installing cert manager")
-	err := po.certManagerHelper.Connect(po.result.RawKubeConfig)
+	err := po.connectCertManager()
 	if err != nil {
 		return err
 	}
-	return po.certManagerHelper.InstallCertManager()
+	return tracing.Trace(ctx, "InstallCertManager", func(context.Context) derrors.Error {
+		return po.certManagerHelper.InstallCertManager()
+	})
+}
+
+// connectCertManager connects the cert manager helper with the new cluster if it is not already connected.
+func (po ProvisionerOperation) connectCertManager() derrors.Error {
+	if po.certManagerHelper.Kubernetes != nil {
+		return nil
+	}
+	return po.certManagerHelper.Connect(po.result.RawKubeConfig)
 }
 
-func (po ProvisionerOperation) requestCertificateIssuer(dnsResourceGroupName string) derrors.Error {
+func (po ProvisionerOperation) requestCertificateIssuer(ctx context.Context, dnsResourceGroupName string) derrors.Error {
 	po.AddToLog("requesting certificate")
-	return po.certManagerHelper.RequestCertificateIssuerOnAzure(
-		po.credentials.ClientId, po.credentials.ClientSecret,
-		po.credentials.SubscriptionId, po.credentials.TenantId,
-		dnsResourceGroupName,
-		po.request.AzureOptions.DNSZoneName, po.request.IsProduction)
+	return tracing.Trace(ctx, "RequestCertificateIssuer", func(context.Context) derrors.Error {
+		return po.certManagerHelper.RequestCertificateIssuerOnAzure(
+			po.credentials.ClientId, po.credentials.ClientSecret,
+			po.credentials.SubscriptionId, po.credentials.TenantId,
+			dnsResourceGroupName,
+			po.request.AzureOptions.DNSZoneName, po.request.IsProduction)
+	})
 }
 
-func (po ProvisionerOperation) requestCertificate() derrors.Error {
-	return po.certManagerHelper.CreateCertificate(
-		po.getClusterName(po.request.ClusterName), po.request.AzureOptions.DNSZoneName)
+func (po ProvisionerOperation) requestCertificate(ctx context.Context) derrors.Error {
+	return tracing.Trace(ctx, "CreateCertificate", func(context.Context) derrors.Error {
+		return po.certManagerHelper.CreateCertificate(
+			po.getClusterName(po.request.ClusterName), po.request.AzureOptions.DNSZoneName)
+	})
 }
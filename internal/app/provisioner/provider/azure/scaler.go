@@ -24,8 +24,9 @@ import (
 	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
-	"time"
 )
 
 type ScalerOperation struct {
@@ -35,7 +36,7 @@ type ScalerOperation struct {
 }
 
 func NewScalerOperation(credentials *AzureCredentials, request entities.ScaleRequest, config *config.Config) (*ScalerOperation, derrors.Error) {
-	azureOp, err := NewAzureOperation(credentials)
+	azureOp, err := NewAzureOperation(request.RequestID, credentials)
 	if err != nil {
 		return nil, err
 	}
@@ -52,94 +53,92 @@ func (so *ScalerOperation) RequestID() string {
 
 func (so *ScalerOperation) Metadata() entities.OperationMetadata {
 	return entities.OperationMetadata{
-		OrganizationID: so.request.OrganizationID,
-		ClusterID:      so.request.ClusterID,
-		RequestID:      so.request.RequestID,
+		OrganizationID:      so.request.OrganizationID,
+		ClusterID:           so.request.ClusterID,
+		RequestID:           so.request.RequestID,
+		IsManagementCluster: so.request.IsManagementCluster,
 	}
 }
 
-func (so *ScalerOperation) notifyError(err derrors.Error, callback func(requestId string)) {
-	log.Error().Str("trace", err.DebugReport()).Msg("operation failed")
-	so.setError(err.Error())
+// Request returns the request that originated the operation
+func (so *ScalerOperation) Request() interface{} {
+	return so.request
+}
+
+func (so *ScalerOperation) notifyError(ctx context.Context, err derrors.Error, callback func(requestId string)) {
+	so.setFailure(ctx, err)
 	callback(so.request.RequestID)
 }
 
-func (so *ScalerOperation) Execute(callback func(requestID string)) {
+func (so *ScalerOperation) Execute(ctx context.Context, callback func(requestID string)) {
 	log.Debug().Str("organizationID", so.request.OrganizationID).Str("clusterID", so.request.ClusterID).Int64("numNodes", so.request.NumNodes).Msg("executing scaling operation")
-	so.started = time.Now()
-	so.SetProgress(entities.InProgress)
+	ctx = so.start(ctx)
+	defer so.finish()
 
 	if so.request.NumNodes < 3 {
-		so.notifyError(derrors.NewInvalidArgumentError("cannot scale a cluster to less than 3 nodes"), callback)
+		so.notifyError(ctx, derrors.NewInvalidArgumentError("cannot scale a cluster to less than 3 nodes"), callback)
 		return
 	}
 
-	scaled, err := so.scaleAKS()
+	scaled, err := so.scaleAKS(ctx)
 	if err != nil {
-		so.notifyError(err, callback)
+		so.notifyError(ctx, err, callback)
 		return
 	}
 	log.Debug().Interface("name", scaled.Name).Msg("cluster has been scaled")
 
-	so.elapsedTime = time.Now().Sub(so.started).Nanoseconds()
-	so.SetProgress(entities.Finished)
+	so.setFinished()
 	callback(so.request.RequestID)
 }
 
-func (so *ScalerOperation) Cancel() derrors.Error {
-	panic("implement me")
-}
-
 func (so *ScalerOperation) Result() entities.OperationResult {
-	elapsed := so.elapsedTime
-	if so.elapsedTime == 0 && so.taskProgress == entities.InProgress {
-		// If the operation is in progress, retrieved the ongoing time.
-		elapsed = time.Now().Sub(so.started).Nanoseconds()
-	}
+	progress, elapsed, errorMsg := so.status()
 
 	return entities.OperationResult{
 		RequestId:   so.request.RequestID,
 		Type:        entities.Scale,
-		Progress:    so.taskProgress,
+		Progress:    progress,
 		ElapsedTime: elapsed,
-		ErrorMsg:    so.errorMsg,
+		ErrorMsg:    errorMsg,
 	}
 }
 
 // ScaleAKS triggers the scaling of an existing management cluster.
-func (so *ScalerOperation) scaleAKS() (*containerservice.ManagedCluster, derrors.Error) {
+func (so *ScalerOperation) scaleAKS(ctx context.Context) (*containerservice.ManagedCluster, derrors.Error) {
+	ctx, span := tracing.StartSpan(ctx, "scaleAKS")
+	defer span.End()
 	so.AddToLog("Scaling existing cluster")
 	clusterClient := containerservice.NewManagedClustersClient(so.credentials.SubscriptionId)
 	clusterClient.Authorizer = so.managementAuthorizer
 
-	existingCluster, err := so.getClusterDetails(so.request.IsManagementCluster, so.request.AzureOptions.ResourceGroup, so.request.ClusterID)
+	existingCluster, err := so.getClusterDetails(ctx, so.request.IsManagementCluster, so.request.AzureOptions.ResourceGroup, so.request.ClusterID)
 	if err != nil {
-		return nil, err
+		return nil, tracing.Fail(span, err)
 	}
 	log.Debug().Interface("existingCluster", existingCluster).Msg("AKS cluster retrieved")
 
 	updated, err := so.getKubernetesUpdateRequest(existingCluster, so.request.NumNodes)
-	ctx, cancel := common.GetContext()
+	updateCtx, cancel := common.GetContextFrom(ctx)
 	defer cancel()
 
 	resourceName := so.getResourceName(so.request.IsManagementCluster, so.request.ClusterID)
 	log.Debug().Str("resourceGroupName", so.request.AzureOptions.ResourceGroup).Str("resourceName", resourceName).Msg("CreateOrUpdate params")
-	responseFuture, createErr := clusterClient.CreateOrUpdate(ctx, so.request.AzureOptions.ResourceGroup, resourceName, *updated)
+	responseFuture, createErr := clusterClient.CreateOrUpdate(updateCtx, so.request.AzureOptions.ResourceGroup, resourceName, *updated)
 	if createErr != nil {
-		return nil, derrors.NewInternalError("cannot scale AKS cluster", createErr).WithParams(so.request)
+		return nil, tracing.Fail(span, derrors.NewInternalError("cannot scale AKS cluster", createErr).WithParams(redact.Value(so.request)))
 	}
 
 	so.AddToLog("waiting for AKS to be scaled")
-	futureContext, cancelFuture := context.WithTimeout(context.Background(), ClusterCreateDeadline)
+	futureContext, cancelFuture := context.WithTimeout(ctx, ClusterCreateDeadline)
 	defer cancelFuture()
 	waitErr := responseFuture.WaitForCompletionRef(futureContext, clusterClient.Client)
 	if waitErr != nil {
-		return nil, derrors.AsError(waitErr, "AKS cluster scale failed")
+		return nil, tracing.Fail(span, derrors.AsError(waitErr, "AKS cluster scale failed"))
 	}
 	scaledCluster, resultErr := responseFuture.Result(clusterClient)
 	if resultErr != nil {
 		log.Error().Interface("err", resultErr).Msg("AKS scale failed")
-		return nil, derrors.AsError(resultErr, "AKS scale failed")
+		return nil, tracing.Fail(span, derrors.AsError(resultErr, "AKS scale failed"))
 	}
 	return &scaledCluster, nil
 }
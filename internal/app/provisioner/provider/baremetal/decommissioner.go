@@ -0,0 +1,107 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// DecommissionerOperation tearing down a bare-metal cluster and returning its hosts to the pool.
+type DecommissionerOperation struct {
+	*BareMetalOperation
+	request entities.DecommissionRequest
+}
+
+// NewDecommissionerOperation creates a new bare-metal decommission operation.
+func NewDecommissionerOperation(inventory *Inventory, runner Runner, networkManifest string, request entities.DecommissionRequest) *DecommissionerOperation {
+	do := &DecommissionerOperation{
+		BareMetalOperation: NewBareMetalOperation(request.RequestID, inventory, runner, networkManifest),
+		request:            request,
+	}
+	do.SetSteps(
+		workflow.NewStep(ResetWorkersStep, do.resetWorkersStep),
+		workflow.NewStep(ResetControlPlaneStep, do.resetControlPlaneStep),
+		workflow.NewStep(ReleaseHostsStep, do.releaseHostsStep),
+	)
+	return do
+}
+
+// RequestID returns the request identifier associated with this operation
+func (do *DecommissionerOperation) RequestID() string {
+	return do.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (do *DecommissionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      do.request.OrganizationID,
+		ClusterID:           do.request.ClusterID,
+		RequestID:           do.request.RequestID,
+		IsManagementCluster: do.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (do *DecommissionerOperation) Request() interface{} {
+	return do.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (do *DecommissionerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", do.request.OrganizationID).Str("clusterID", do.request.ClusterID).Msg("executing bare-metal decommission operation")
+	ctx = do.Start(ctx)
+	defer do.Finish()
+
+	if err := do.RunSteps(ctx); err != nil {
+		do.SetFailure(ctx, err)
+		callback(do.request.RequestID)
+		return
+	}
+	do.Succeed()
+	callback(do.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (do *DecommissionerOperation) Result() entities.OperationResult {
+	return do.OperationResult(entities.Decommission)
+}
+
+// resetWorkersStep reverts kubeadm on the workers of the cluster.
+func (do *DecommissionerOperation) resetWorkersStep(ctx context.Context) derrors.Error {
+	if _, err := do.inventory.ControlPlane(do.request.OrganizationID, do.request.ClusterID); err != nil {
+		return err
+	}
+	return do.resetHosts(ctx, do.inventory.ClusterHosts(do.request.OrganizationID, do.request.ClusterID, WorkerRole))
+}
+
+// resetControlPlaneStep reverts kubeadm on the control plane of the cluster.
+func (do *DecommissionerOperation) resetControlPlaneStep(ctx context.Context) derrors.Error {
+	return do.resetHosts(ctx, do.inventory.ClusterHosts(do.request.OrganizationID, do.request.ClusterID, ControlPlaneRole))
+}
+
+// releaseHostsStep returns the hosts of the cluster to the pool of free hosts.
+func (do *DecommissionerOperation) releaseHostsStep(_ context.Context) derrors.Error {
+	hosts := do.inventory.ClusterHosts(do.request.OrganizationID, do.request.ClusterID, WorkerRole)
+	hosts = append(hosts, do.inventory.ClusterHosts(do.request.OrganizationID, do.request.ClusterID, ControlPlaneRole)...)
+	return do.releaseHosts(do.request.OrganizationID, do.request.ClusterID, hosts)
+}
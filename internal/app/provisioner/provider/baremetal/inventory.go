@@ -0,0 +1,279 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultSSHPort with the port used to reach the hosts that do not set one.
+const DefaultSSHPort = 22
+
+// Roles of the hosts allocated to a cluster.
+const (
+	ControlPlaneRole = "control-plane"
+	WorkerRole       = "worker"
+)
+
+// Host of the bare-metal inventory. Hosts are free until a provisioning or scaling operation allocates them to a
+// cluster, and are released when they are removed from it.
+type Host struct {
+	// Name of the host, used as the name of the Kubernetes node.
+	Name string `json:"name"`
+	// Address where the host is reachable through SSH.
+	Address string `json:"address"`
+	// Port of the SSH server. If 0, DefaultSSHPort is used.
+	Port int `json:"port,omitempty"`
+	// User to log in as. If empty, the user of the configuration is used.
+	User string `json:"user,omitempty"`
+	// NodeType of the host. Hosts without a type can be allocated to any request.
+	NodeType string `json:"node_type,omitempty"`
+	// OrganizationID of the cluster the host is allocated to.
+	OrganizationID string `json:"organization_id,omitempty"`
+	// ClusterID of the cluster the host is allocated to. Empty if the host is free.
+	ClusterID string `json:"cluster_id,omitempty"`
+	// Role of the host in the cluster.
+	Role string `json:"role,omitempty"`
+	// RequestID of the operation that allocated the host.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// SSHAddress returns the address of the SSH server of the host.
+func (h Host) SSHAddress() string {
+	port := h.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+	return net.JoinHostPort(h.Address, strconv.Itoa(port))
+}
+
+// IsFree checks if the host is not allocated to any cluster.
+func (h Host) IsFree() bool {
+	return h.ClusterID == ""
+}
+
+// belongsTo checks if the host is allocated to a cluster.
+func (h Host) belongsTo(organizationID string, clusterID string) bool {
+	return h.ClusterID == clusterID && h.OrganizationID == organizationID
+}
+
+// Inventory with the hosts available to the bare-metal provider. The allocation of the hosts is persisted in the
+// inventory file.
+type Inventory struct {
+	sync.Mutex
+	hosts []*Host
+	// path of the file containing the inventory. If empty, the inventory is only kept in memory.
+	path string
+}
+
+var inventories = make(map[string]*Inventory, 0)
+var inventoriesLock sync.Mutex
+
+// GetInventory returns the inventory shared by the bare-metal providers loaded from a given file.
+func GetInventory(path string) (*Inventory, derrors.Error) {
+	inventoriesLock.Lock()
+	defer inventoriesLock.Unlock()
+	path = filepath.Clean(path)
+	if inventory, exists := inventories[path]; exists {
+		return inventory, nil
+	}
+	inventory, err := LoadInventory(path)
+	if err != nil {
+		return nil, err
+	}
+	inventories[path] = inventory
+	return inventory, nil
+}
+
+// LoadInventory reads an inventory from a file.
+func LoadInventory(path string) (*Inventory, derrors.Error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read bare-metal inventory")
+	}
+	hosts := make([]Host, 0)
+	if err := json.Unmarshal(raw, &hosts); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot decode bare-metal inventory", err).WithParams(path)
+	}
+	inventory, vErr := NewInventory(hosts)
+	if vErr != nil {
+		return nil, vErr
+	}
+	inventory.path = path
+	return inventory, nil
+}
+
+// NewInventory creates an in-memory inventory with a set of hosts.
+func NewInventory(hosts []Host) (*Inventory, derrors.Error) {
+	inventory := &Inventory{hosts: make([]*Host, 0, len(hosts))}
+	names := make(map[string]bool, 0)
+	for index := range hosts {
+		host := hosts[index]
+		if host.Name == "" || host.Address == "" {
+			return nil, derrors.NewInvalidArgumentError("bare-metal hosts must have a name and an address").WithParams(index)
+		}
+		if names[host.Name] {
+			return nil, derrors.NewInvalidArgumentError("duplicated bare-metal host").WithParams(host.Name)
+		}
+		if host.Port < 0 || host.Port > 65535 {
+			return nil, derrors.NewInvalidArgumentError("invalid SSH port").WithParams(host.Name, host.Port)
+		}
+		names[host.Name] = true
+		inventory.hosts = append(inventory.hosts, &host)
+	}
+	return inventory, nil
+}
+
+// List returns a copy of the hosts.
+func (i *Inventory) List() []Host {
+	i.Lock()
+	defer i.Unlock()
+	result := make([]Host, 0, len(i.hosts))
+	for _, host := range i.hosts {
+		result = append(result, *host)
+	}
+	return result
+}
+
+// ClusterHosts returns the hosts allocated to a cluster with a given role, in inventory order.
+func (i *Inventory) ClusterHosts(organizationID string, clusterID string, role string) []Host {
+	i.Lock()
+	defer i.Unlock()
+	result := make([]Host, 0)
+	for _, host := range i.hosts {
+		if host.belongsTo(organizationID, clusterID) && host.Role == role {
+			result = append(result, *host)
+		}
+	}
+	return result
+}
+
+// ControlPlane returns the control plane host of a cluster.
+func (i *Inventory) ControlPlane(organizationID string, clusterID string) (*Host, derrors.Error) {
+	hosts := i.ClusterHosts(organizationID, clusterID, ControlPlaneRole)
+	if len(hosts) == 0 {
+		return nil, derrors.NewNotFoundError("cluster has no control plane host").WithParams(organizationID, clusterID)
+	}
+	return &hosts[0], nil
+}
+
+// Allocate ensures that a cluster has a given number of hosts with a role, allocating free hosts of a node type
+// if required. Existing hosts are kept, so allocating again after a failure does not take more hosts.
+func (i *Inventory) Allocate(organizationID string, clusterID string, requestID string, role string, nodeType string, total int) ([]Host, derrors.Error) {
+	i.Lock()
+	defer i.Unlock()
+	allocated := 0
+	for _, host := range i.hosts {
+		if host.belongsTo(organizationID, clusterID) && host.Role == role {
+			allocated++
+		}
+	}
+	candidates := make([]*Host, 0)
+	for _, host := range i.hosts {
+		if allocated+len(candidates) >= total {
+			break
+		}
+		if host.IsFree() && (host.NodeType == "" || host.NodeType == nodeType) {
+			candidates = append(candidates, host)
+		}
+	}
+	if allocated+len(candidates) < total {
+		return nil, derrors.NewResourceExhaustedError("not enough free bare-metal hosts").WithParams(role, nodeType, total-allocated)
+	}
+	for _, host := range candidates {
+		host.OrganizationID = organizationID
+		host.ClusterID = clusterID
+		host.Role = role
+		host.RequestID = requestID
+	}
+	if err := i.save(); err != nil {
+		for _, host := range candidates {
+			host.OrganizationID, host.ClusterID, host.Role, host.RequestID = "", "", "", ""
+		}
+		return nil, err
+	}
+	result := make([]Host, 0, len(candidates))
+	for _, host := range candidates {
+		result = append(result, *host)
+	}
+	return result, nil
+}
+
+// Release frees the hosts of a cluster with the given names. Hosts that are not allocated to the cluster are
+// ignored.
+func (i *Inventory) Release(organizationID string, clusterID string, names ...string) derrors.Error {
+	i.Lock()
+	defer i.Unlock()
+	released := make(map[string]Host, 0)
+	for _, name := range names {
+		for _, host := range i.hosts {
+			if host.Name == name && host.belongsTo(organizationID, clusterID) {
+				released[name] = *host
+				host.OrganizationID, host.ClusterID, host.Role, host.RequestID = "", "", "", ""
+			}
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	if err := i.save(); err != nil {
+		for _, host := range i.hosts {
+			if previous, exists := released[host.Name]; exists {
+				*host = previous
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the inventory to its file replacing the previous content atomically. The caller is expected to
+// hold the lock.
+func (i *Inventory) save() derrors.Error {
+	if i.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(i.hosts, "", "  ")
+	if err != nil {
+		return derrors.AsError(err, "cannot encode bare-metal inventory")
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(i.path), "."+filepath.Base(i.path))
+	if err != nil {
+		return derrors.AsError(err, "cannot create bare-metal inventory file")
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(raw); err != nil {
+		_ = temp.Close()
+		return derrors.AsError(err, "cannot write bare-metal inventory")
+	}
+	if err := temp.Close(); err != nil {
+		return derrors.AsError(err, "cannot close bare-metal inventory")
+	}
+	if err := os.Rename(temp.Name(), i.path); err != nil {
+		return derrors.AsError(err, fmt.Sprintf("cannot replace bare-metal inventory %s", i.path))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nalej/derrors"
+)
+
+// Paths of the files created by kubeadm on the hosts.
+const (
+	AdminKubeConfigPath   = "/etc/kubernetes/admin.conf"
+	KubeletKubeConfigPath = "/etc/kubernetes/kubelet.conf"
+)
+
+// PodNetworkCIDR with the range of the pod network, matching the default of the network add-on.
+const PodNetworkCIDR = "10.244.0.0/16"
+
+// DefaultNetworkManifest with the manifest of the pod network add-on applied on new clusters.
+const DefaultNetworkManifest = "https://raw.githubusercontent.com/coreos/flannel/v0.11.0/Documentation/kube-flannel.yml"
+
+// DrainTimeout with the maximum time to evict the pods of a node being removed.
+const DrainTimeout = "5m"
+
+// joinCommandPattern with the expected format of the join command printed by kubeadm. The command is executed on
+// the workers so anything else is rejected.
+var joinCommandPattern = regexp.MustCompile(`^kubeadm join [A-Za-z0-9.:\[\]-]+( +--[a-z-]+ +[A-Za-z0-9.:-]+)+$`)
+
+// versionCommand checks that kubeadm is installed.
+func versionCommand() string {
+	return "kubeadm version -o short"
+}
+
+// initCommand initializes the control plane on a host. Hosts that are already initialized are skipped.
+func initCommand(host Host, kubernetesVersion string) string {
+	args := []string{
+		"kubeadm", "init",
+		"--node-name=" + shellQuote(host.Name),
+		"--apiserver-advertise-address=" + shellQuote(host.Address),
+		"--apiserver-cert-extra-sans=" + shellQuote(host.Address),
+		"--pod-network-cidr=" + PodNetworkCIDR,
+	}
+	if kubernetesVersion != "" {
+		args = append(args, "--kubernetes-version="+shellQuote(kubernetesVersion))
+	}
+	return fmt.Sprintf("test -f %s || %s", AdminKubeConfigPath, strings.Join(args, " "))
+}
+
+// kubectlCommand runs kubectl on the control plane with the admin credentials.
+func kubectlCommand(args ...string) string {
+	return fmt.Sprintf("kubectl --kubeconfig=%s %s", AdminKubeConfigPath, strings.Join(args, " "))
+}
+
+// networkCommand installs the pod network add-on.
+func networkCommand(manifest string) string {
+	return kubectlCommand("apply", "-f", shellQuote(manifest))
+}
+
+// kubeConfigCommand prints the admin kubeconfig.
+func kubeConfigCommand() string {
+	return "cat " + AdminKubeConfigPath
+}
+
+// joinTokenCommand creates a bootstrap token and prints the command to join a worker.
+func joinTokenCommand() string {
+	return "kubeadm token create --ttl 1h --print-join-command"
+}
+
+// joinCommand joins a worker to the cluster. Hosts that already joined are skipped.
+func joinCommand(join string, host Host) (string, derrors.Error) {
+	join = strings.Join(strings.Fields(join), " ")
+	if !joinCommandPattern.MatchString(join) {
+		return "", derrors.NewInternalError("unexpected join command returned by the control plane")
+	}
+	return fmt.Sprintf("test -f %s || %s --node-name=%s", KubeletKubeConfigPath, join, shellQuote(host.Name)), nil
+}
+
+// drainCommand evicts the pods of a node and removes it from the cluster. Nodes that are not part of the
+// cluster are skipped.
+func drainCommand(host Host) string {
+	node := shellQuote(host.Name)
+	return fmt.Sprintf("if %s >/dev/null 2>&1; then %s && %s; fi",
+		kubectlCommand("get", "node", node),
+		kubectlCommand("drain", node, "--ignore-daemonsets", "--delete-local-data", "--force", "--timeout="+DrainTimeout),
+		kubectlCommand("delete", "node", node, "--ignore-not-found"))
+}
+
+// resetCommand reverts the changes performed by kubeadm on a host.
+func resetCommand() string {
+	return "kubeadm reset -f"
+}
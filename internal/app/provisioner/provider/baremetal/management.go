@@ -0,0 +1,112 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// ManagementOperation performing management operations on a bare-metal cluster.
+type ManagementOperation struct {
+	*BareMetalOperation
+	targetOp         entities.ManagementOperationType
+	request          entities.ClusterRequest
+	kubeConfigResult *string
+}
+
+// NewManagementOperation creates a new bare-metal management operation.
+func NewManagementOperation(inventory *Inventory, runner Runner, networkManifest string, request entities.ClusterRequest, operation entities.ManagementOperationType) *ManagementOperation {
+	mo := &ManagementOperation{
+		BareMetalOperation: NewBareMetalOperation(request.RequestID, inventory, runner, networkManifest),
+		targetOp:           operation,
+		request:            request,
+	}
+	mo.SetSteps(workflow.NewStep(RetrieveKubeConfigStep, mo.retrieveKubeConfigStep))
+	return mo
+}
+
+// RequestID returns the request identifier associated with this operation
+func (mo *ManagementOperation) RequestID() string {
+	return mo.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (mo *ManagementOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      mo.request.OrganizationID,
+		ClusterID:           mo.request.ClusterID,
+		RequestID:           mo.request.RequestID,
+		IsManagementCluster: mo.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (mo *ManagementOperation) Request() interface{} {
+	return mo.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (mo *ManagementOperation) Execute(ctx context.Context, callback func(requestId string)) {
+	log.Debug().Str("organizationID", mo.request.OrganizationID).Str("clusterID", mo.request.ClusterID).Msg("executing bare-metal management operation")
+	ctx = mo.Start(ctx)
+	defer mo.Finish()
+
+	var err derrors.Error
+	if mo.targetOp != entities.GetKubeConfig {
+		err = derrors.NewUnimplementedError("target operation is not supported").WithParams(mo.targetOp)
+	} else {
+		err = mo.RunSteps(ctx)
+	}
+	if err != nil {
+		mo.SetFailure(ctx, err)
+		callback(mo.request.RequestID)
+		return
+	}
+	mo.Succeed()
+	callback(mo.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (mo *ManagementOperation) Result() entities.OperationResult {
+	result := mo.OperationResult(entities.Management)
+	mo.Lock()
+	result.KubeConfigResult = mo.kubeConfigResult
+	mo.Unlock()
+	return result
+}
+
+// retrieveKubeConfigStep obtains the admin kubeconfig from the control plane of the cluster.
+func (mo *ManagementOperation) retrieveKubeConfigStep(ctx context.Context) derrors.Error {
+	controlPlane, err := mo.inventory.ControlPlane(mo.request.OrganizationID, mo.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	kubeConfig, err := mo.retrieveKubeConfig(ctx, *controlPlane)
+	if err != nil {
+		return err
+	}
+	mo.Lock()
+	mo.kubeConfigResult = &kubeConfig
+	mo.Unlock()
+	return nil
+}
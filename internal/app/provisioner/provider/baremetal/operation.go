@@ -0,0 +1,160 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the steps shared by the bare-metal operations.
+const (
+	AllocateHostsStep      = "allocate-hosts"
+	CheckHostsStep         = "check-hosts"
+	InitControlPlaneStep   = "init-control-plane"
+	InstallNetworkStep     = "install-network"
+	RetrieveKubeConfigStep = "retrieve-kubeconfig"
+	JoinWorkersStep        = "join-workers"
+	DrainNodesStep         = "drain-nodes"
+	ResetNodesStep         = "reset-nodes"
+	ResetWorkersStep       = "reset-workers"
+	ResetControlPlaneStep  = "reset-control-plane"
+	ReleaseHostsStep       = "release-hosts"
+)
+
+// BareMetalOperation structure with the common functions shared among the bare-metal operations.
+type BareMetalOperation struct {
+	*base.Operation
+	inventory *Inventory
+	runner    Runner
+	// networkManifest with the pod network add-on installed on new clusters.
+	networkManifest string
+}
+
+// NewBareMetalOperation creates a BareMetalOperation on a given inventory.
+func NewBareMetalOperation(requestID string, inventory *Inventory, runner Runner, networkManifest string) *BareMetalOperation {
+	return &BareMetalOperation{
+		Operation:       base.NewOperation(requestID),
+		inventory:       inventory,
+		runner:          runner,
+		networkManifest: networkManifest,
+	}
+}
+
+// run executes a command on a host.
+func (bo *BareMetalOperation) run(ctx context.Context, host Host, command string) (string, derrors.Error) {
+	log.Debug().Str("host", host.Name).Msg("running command on host")
+	return bo.runner.Run(ctx, host, command)
+}
+
+// runOnAll executes a command on a set of hosts in parallel and returns the first error.
+func (bo *BareMetalOperation) runOnAll(ctx context.Context, hosts []Host, command func(host Host) (string, derrors.Error), message string) derrors.Error {
+	errs := make(chan derrors.Error, len(hosts))
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host Host) {
+			defer wg.Done()
+			cmd, err := command(host)
+			if err == nil {
+				_, err = bo.run(ctx, host, cmd)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			bo.AddToLog(fmt.Sprintf("%s %s", message, host.Name))
+		}(host)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// fixed returns a function producing the same command for every host.
+func fixed(command string) func(host Host) (string, derrors.Error) {
+	return func(host Host) (string, derrors.Error) {
+		return command, nil
+	}
+}
+
+// checkHosts verifies that kubeadm is available on a set of hosts.
+func (bo *BareMetalOperation) checkHosts(ctx context.Context, hosts []Host) derrors.Error {
+	return bo.runOnAll(ctx, hosts, fixed(versionCommand()), "kubeadm is available on")
+}
+
+// joinWorkers joins a set of hosts to the cluster of a control plane.
+func (bo *BareMetalOperation) joinWorkers(ctx context.Context, controlPlane Host, workers []Host) derrors.Error {
+	if len(workers) == 0 {
+		return nil
+	}
+	join, err := bo.run(ctx, controlPlane, joinTokenCommand())
+	if err != nil {
+		return err
+	}
+	return bo.runOnAll(ctx, workers, func(host Host) (string, derrors.Error) {
+		return joinCommand(join, host)
+	}, "node joined")
+}
+
+// drainNodes removes a set of nodes from the cluster of a control plane.
+func (bo *BareMetalOperation) drainNodes(ctx context.Context, controlPlane Host, nodes []Host) derrors.Error {
+	for _, node := range nodes {
+		if _, err := bo.run(ctx, controlPlane, drainCommand(node)); err != nil {
+			return err
+		}
+		bo.AddToLog(fmt.Sprintf("node drained %s", node.Name))
+	}
+	return nil
+}
+
+// resetHosts reverts kubeadm on a set of hosts.
+func (bo *BareMetalOperation) resetHosts(ctx context.Context, hosts []Host) derrors.Error {
+	return bo.runOnAll(ctx, hosts, fixed(resetCommand()), "host reset")
+}
+
+// releaseHosts returns a set of hosts of a cluster to the pool of free hosts.
+func (bo *BareMetalOperation) releaseHosts(organizationID string, clusterID string, hosts []Host) derrors.Error {
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		names = append(names, host.Name)
+	}
+	if err := bo.inventory.Release(organizationID, clusterID, names...); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		bo.AddToLog(fmt.Sprintf("%d hosts released", len(names)))
+	}
+	return nil
+}
+
+// retrieveKubeConfig obtains the admin kubeconfig from the control plane.
+func (bo *BareMetalOperation) retrieveKubeConfig(ctx context.Context, controlPlane Host) (string, derrors.Error) {
+	kubeConfig, err := bo.run(ctx, controlPlane, kubeConfigCommand())
+	if err != nil {
+		return "", err
+	}
+	if kubeConfig == "" {
+		return "", derrors.NewFailedPreconditionError("control plane has no admin kubeconfig").WithParams(controlPlane.Name)
+	}
+	return kubeConfig, nil
+}
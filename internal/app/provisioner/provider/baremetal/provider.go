@@ -0,0 +1,78 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package baremetal contains the infrastructure provider that installs Kubernetes with kubeadm on an inventory of
+// hosts reachable through SSH.
+package baremetal
+
+import (
+	"github.com/nalej/derrors"
+	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// BareMetalInfrastructureProvider managing clusters on the hosts of an inventory.
+type BareMetalInfrastructureProvider struct {
+	inventory       *Inventory
+	runner          Runner
+	networkManifest string
+}
+
+// NewBareMetalInfrastructureProvider creates a provider using the inventory and the SSH credentials of the
+// configuration.
+func NewBareMetalInfrastructureProvider(config *config.Config) (providerEntities.InfrastructureProvider, derrors.Error) {
+	if config.BareMetalInventoryPath == "" {
+		return nil, derrors.NewFailedPreconditionError("bare-metal inventory is not configured")
+	}
+	inventory, err := GetInventory(config.BareMetalInventoryPath)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := NewSSHRunner(config.BareMetalSSHKeyPath, config.BareMetalKnownHostsPath, config.BareMetalSSHUser)
+	if err != nil {
+		return nil, err
+	}
+	return NewBareMetalInfrastructureProviderWith(inventory, runner, config.BareMetalNetworkManifest), nil
+}
+
+// NewBareMetalInfrastructureProviderWith creates a provider on a given inventory and runner.
+func NewBareMetalInfrastructureProviderWith(inventory *Inventory, runner Runner, networkManifest string) *BareMetalInfrastructureProvider {
+	if networkManifest == "" {
+		networkManifest = DefaultNetworkManifest
+	}
+	return &BareMetalInfrastructureProvider{inventory: inventory, runner: runner, networkManifest: networkManifest}
+}
+
+// Provision a cluster creates a InfrastructureOperation to provision a new cluster.
+func (bip *BareMetalInfrastructureProvider) Provision(request entities.ProvisionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewProvisionerOperation(bip.inventory, bip.runner, bip.networkManifest, request), nil
+}
+
+// Decommission a cluster creates a InfrastructureOperation to decommission a cluster.
+func (bip *BareMetalInfrastructureProvider) Decommission(request entities.DecommissionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewDecommissionerOperation(bip.inventory, bip.runner, bip.networkManifest, request), nil
+}
+
+// Scale a cluster creates a InfrastructureOperation to scale a cluster.
+func (bip *BareMetalInfrastructureProvider) Scale(request entities.ScaleRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewScalerOperation(bip.inventory, bip.runner, bip.networkManifest, request), nil
+}
+
+// GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
+func (bip *BareMetalInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewManagementOperation(bip.inventory, bip.runner, bip.networkManifest, request, entities.GetKubeConfig), nil
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const numHosts = 4
+
+func provisionRequest(requestID string, numNodes int64) entities.ProvisionRequest {
+	request := providertest.ProvisionRequest(requestID, true)
+	request.NumNodes = numNodes
+	return request
+}
+
+var _ = ginkgo.Describe("Bare-metal infrastructure provider", func() {
+
+	var hostKey ssh.Signer
+	var clientKey ssh.Signer
+	var servers []*sshServer
+	var inventory *Inventory
+	var provider *BareMetalInfrastructureProvider
+
+	// clusterHosts returns the servers of the hosts of the cluster with a given role.
+	clusterHosts := func(role string) []*sshServer {
+		result := make([]*sshServer, 0)
+		for _, host := range inventory.ClusterHosts(providertest.OrganizationID, providertest.ClusterID, role) {
+			var index int
+			_, err := fmt.Sscanf(host.Name, "host-%d", &index)
+			gomega.Expect(err).To(gomega.Succeed())
+			result = append(result, servers[index])
+		}
+		return result
+	}
+
+	ginkgo.BeforeEach(func() {
+		hostKey = newSigner()
+		clientKey = newSigner()
+		servers = make([]*sshServer, 0, numHosts)
+		hosts := make([]Host, 0, numHosts)
+		for index := 0; index < numHosts; index++ {
+			server := newSSHServer(hostKey, clientKey.PublicKey())
+			servers = append(servers, server)
+			hosts = append(hosts, Host{Name: fmt.Sprintf("host-%d", index), Address: "127.0.0.1", Port: server.Port()})
+		}
+		inv, err := NewInventory(hosts)
+		gomega.Expect(err).To(gomega.Succeed())
+		inventory = inv
+		provider = NewBareMetalInfrastructureProviderWith(inventory, NewSSHRunnerWith(clientKey, ssh.FixedHostKey(hostKey.PublicKey()), ""), "")
+	})
+
+	ginkgo.AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	ginkgo.It("installs, scales and removes a cluster", func() {
+		operation, err := provider.Provision(provisionRequest("provision", 2))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("127.0.0.1"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.Equal(testKubeConfig))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.Ingress).To(gomega.Equal("127.0.0.1"))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.VPNServer).To(gomega.Equal("127.0.0.1"))
+
+		controlPlane := clusterHosts(ControlPlaneRole)
+		gomega.Expect(controlPlane).To(gomega.HaveLen(1))
+		gomega.Expect(controlPlane[0].Executed("kubeadm init")).To(gomega.Equal(1))
+		gomega.Expect(controlPlane[0].Executed(DefaultNetworkManifest)).To(gomega.Equal(1))
+		workers := clusterHosts(WorkerRole)
+		gomega.Expect(workers).To(gomega.HaveLen(2))
+		for _, worker := range workers {
+			gomega.Expect(worker.Executed("kubeadm join 127.0.0.1:6443")).To(gomega.Equal(1))
+			gomega.Expect(worker.Executed("kubeadm init")).To(gomega.Equal(0))
+		}
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale-up", true, 3))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(clusterHosts(WorkerRole)).To(gomega.HaveLen(3))
+		for _, server := range servers {
+			gomega.Expect(server.Executed(resetCommand())).To(gomega.Equal(0))
+		}
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale-down", true, 1))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(clusterHosts(WorkerRole)).To(gomega.HaveLen(1))
+		gomega.Expect(controlPlane[0].Executed("drain")).To(gomega.Equal(2))
+		reset := 0
+		for _, server := range servers {
+			reset += server.Executed(resetCommand())
+		}
+		gomega.Expect(reset).To(gomega.Equal(2))
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(*result.KubeConfigResult).To(gomega.Equal(testKubeConfig))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(controlPlane[0].Executed(resetCommand())).To(gomega.Equal(1))
+		for _, host := range inventory.List() {
+			gomega.Expect(host.IsFree()).To(gomega.BeTrue())
+		}
+	})
+
+	ginkgo.It("rejects clusters that do not fit in the inventory", func() {
+		operation, err := provider.Provision(provisionRequest("provision", numHosts))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("ResourceExhausted"))
+		for _, server := range servers {
+			gomega.Expect(server.Commands()).To(gomega.BeEmpty())
+		}
+	})
+
+	ginkgo.It("releases the hosts of a failed installation", func() {
+		for _, server := range servers {
+			server.Fail("kubeadm join", -1)
+		}
+		request := provisionRequest("provision", 2)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("command failed"))
+		gomega.Expect(result.Rollback).To(gomega.HaveLen(3))
+		for _, host := range inventory.List() {
+			gomega.Expect(host.IsFree()).To(gomega.BeTrue())
+		}
+		reset := 0
+		for _, server := range servers {
+			reset += server.Executed(resetCommand())
+		}
+		gomega.Expect(reset).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("resumes an installation from the step that failed", func() {
+		for _, server := range servers {
+			server.Fail(DefaultNetworkManifest, 1)
+		}
+		operation, err := provider.Provision(provisionRequest("provision", 1))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		checkpoint := operation.(entities.ResumableOperation).Checkpoint()
+		gomega.Expect(checkpoint.Failed).To(gomega.Equal(InstallNetworkStep))
+
+		resumed, err := provider.Provision(provisionRequest("provision", 1))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(resumed.(entities.ResumableOperation).Resume(*checkpoint)).To(gomega.Succeed())
+		result = providertest.Execute(resumed)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("127.0.0.1"))
+		controlPlane := clusterHosts(ControlPlaneRole)
+		gomega.Expect(controlPlane[0].Executed("kubeadm init")).To(gomega.Equal(1))
+		gomega.Expect(controlPlane[0].Executed(DefaultNetworkManifest)).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("fails the operations on unknown clusters", func() {
+		operation, err := provider.Decommission(entities.DecommissionRequest{RequestID: "decommission", OrganizationID: providertest.OrganizationID, ClusterID: "missing"})
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+	})
+
+	ginkgo.It("interrupts the commands when the operation is cancelled", func() {
+		for _, server := range servers {
+			server.Block("kubeadm init")
+		}
+		operation, err := provider.Provision(provisionRequest("provision", 1))
+		gomega.Expect(err).To(gomega.Succeed())
+		done := make(chan string, 1)
+		go operation.Execute(context.Background(), func(requestID string) {
+			done <- requestID
+		})
+		gomega.Eventually(func() int {
+			total := 0
+			for _, server := range servers {
+				total += server.Executed("kubeadm init")
+			}
+			return total
+		}).Should(gomega.Equal(1))
+		gomega.Expect(operation.Cancel()).To(gomega.Succeed())
+		gomega.Eventually(done, 5*time.Second).Should(gomega.Receive())
+		gomega.Expect(operation.Result().Progress).To(gomega.Equal(entities.Cancelled))
+	})
+
+	ginkgo.Context("connecting through SSH", func() {
+
+		var tempDir string
+
+		ginkgo.BeforeEach(func() {
+			dir, err := ioutil.TempDir("", "baremetal")
+			gomega.Expect(err).To(gomega.Succeed())
+			tempDir = dir
+		})
+
+		ginkgo.AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+
+		// writeFiles writes the client key and a known_hosts file trusting a host key.
+		writeFiles := func(trusted ssh.PublicKey) (string, string) {
+			key, err := rsaKeyPEM()
+			gomega.Expect(err).To(gomega.Succeed())
+			keyPath := filepath.Join(tempDir, "id_rsa")
+			gomega.Expect(ioutil.WriteFile(keyPath, key, 0600)).To(gomega.Succeed())
+			signer, err := ssh.ParsePrivateKey(key)
+			gomega.Expect(err).To(gomega.Succeed())
+			clientKey = signer
+			servers[0].Close()
+			servers[0] = newSSHServer(hostKey, clientKey.PublicKey())
+			line := knownhosts.Line([]string{knownhosts.Normalize(servers[0].Address())}, trusted)
+			knownHostsPath := filepath.Join(tempDir, "known_hosts")
+			gomega.Expect(ioutil.WriteFile(knownHostsPath, []byte(line+"\n"), 0600)).To(gomega.Succeed())
+			return keyPath, knownHostsPath
+		}
+
+		ginkgo.It("runs commands on known hosts", func() {
+			keyPath, knownHostsPath := writeFiles(hostKey.PublicKey())
+			runner, err := NewSSHRunner(keyPath, knownHostsPath, "")
+			gomega.Expect(err).To(gomega.Succeed())
+			output, err := runner.Run(context.Background(), Host{Name: "host-0", Address: "127.0.0.1", Port: servers[0].Port()}, versionCommand())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(output).To(gomega.Equal("v1.13.11\n"))
+		})
+
+		ginkgo.It("uses sudo for users other than root", func() {
+			keyPath, knownHostsPath := writeFiles(hostKey.PublicKey())
+			runner, err := NewSSHRunner(keyPath, knownHostsPath, "nalej")
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = runner.Run(context.Background(), Host{Name: "host-0", Address: "127.0.0.1", Port: servers[0].Port()}, "echo 'it works'")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(servers[0].Commands()).To(gomega.Equal([]string{`sudo -n sh -c 'echo '"'"'it works'"'"''`}))
+		})
+
+		ginkgo.It("rejects hosts with an unknown key", func() {
+			keyPath, knownHostsPath := writeFiles(newSigner().PublicKey())
+			runner, err := NewSSHRunner(keyPath, knownHostsPath, "")
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = runner.Run(context.Background(), Host{Name: "host-0", Address: "127.0.0.1", Port: servers[0].Port()}, versionCommand())
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			gomega.Expect(err.(derrors.Error).Type()).To(gomega.Equal(derrors.Unauthenticated))
+			gomega.Expect(servers[0].Commands()).To(gomega.BeEmpty())
+		})
+	})
+})
+
+// rsaKeyPEM generates a private key in the PEM format used by ssh-keygen.
+func rsaKeyPEM() ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the outputs produced by the provisioning steps.
+const (
+	KubeConfigOutput          = "kubeConfig"
+	ControlPlaneAddressOutput = "controlPlaneAddress"
+)
+
+// ProvisionerOperation installing Kubernetes with kubeadm on hosts of the inventory. The first host becomes the
+// control plane and the number of nodes of the request are joined as workers.
+type ProvisionerOperation struct {
+	*BareMetalOperation
+	request entities.ProvisionRequest
+	result  *entities.ProvisionResult
+}
+
+// NewProvisionerOperation creates a new bare-metal provisioning operation.
+func NewProvisionerOperation(inventory *Inventory, runner Runner, networkManifest string, request entities.ProvisionRequest) *ProvisionerOperation {
+	po := &ProvisionerOperation{
+		BareMetalOperation: NewBareMetalOperation(request.RequestID, inventory, runner, networkManifest),
+		request:            request,
+		result:             &entities.ProvisionResult{ClusterName: request.ClusterName},
+	}
+	// The hosts are allocated to the cluster by the first step, so a failed installation on them is reset as well.
+	po.SetSteps(
+		workflow.NewCompensableStep(AllocateHostsStep, po.allocateHostsStep, po.releaseHostsStep),
+		workflow.NewStep(CheckHostsStep, po.checkHostsStep),
+		workflow.NewPartialCompensableStep(InitControlPlaneStep, po.initControlPlaneStep, po.resetControlPlaneStep),
+		workflow.NewStep(InstallNetworkStep, po.installNetworkStep),
+		workflow.NewStep(RetrieveKubeConfigStep, po.retrieveKubeConfigStep),
+		workflow.NewPartialCompensableStep(JoinWorkersStep, po.joinWorkersStep, po.resetWorkersStep),
+	)
+	return po
+}
+
+// RequestID returns the request identifier associated with this operation
+func (po *ProvisionerOperation) RequestID() string {
+	return po.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (po *ProvisionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (po *ProvisionerOperation) Request() interface{} {
+	return po.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (po *ProvisionerOperation) Execute(ctx context.Context, callback func(requestId string)) {
+	log.Debug().Str("organizationID", po.request.OrganizationID).Str("clusterID", po.request.ClusterID).Msg("executing bare-metal provisioning operation")
+	ctx = po.Start(ctx)
+	defer po.Finish()
+
+	err := po.RunSteps(ctx)
+	if err != nil {
+		if po.request.RollbackOnFailure {
+			po.RollbackSteps()
+		}
+		po.SetFailure(ctx, err)
+		callback(po.request.RequestID)
+		return
+	}
+	po.Succeed()
+	callback(po.request.RequestID)
+}
+
+// Checkpoint returns the state of the steps of the operation.
+func (po *ProvisionerOperation) Checkpoint() *entities.StepCheckpoint {
+	return po.Pipeline().Checkpoint()
+}
+
+// Resume prepares the operation to be executed again from the step that failed. The outputs of the completed
+// steps are used to rebuild the result of the operation.
+func (po *ProvisionerOperation) Resume(checkpoint entities.StepCheckpoint) derrors.Error {
+	if _, exists := checkpoint.Outputs[KubeConfigOutput]; !exists {
+		// The kubeconfig is not persisted, so the operations restored after a restart retrieve it again.
+		checkpoint.Invalidate(RetrieveKubeConfigStep)
+	}
+	if err := po.RestoreCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	if address, exists := checkpoint.Outputs[ControlPlaneAddressOutput]; exists {
+		po.setControlPlaneAddress(address)
+	}
+	if kubeConfig, exists := checkpoint.Outputs[KubeConfigOutput]; exists {
+		po.result.RawKubeConfig = kubeConfig
+	}
+	return nil
+}
+
+// Result returns the operation result if this operation is successful
+func (po *ProvisionerOperation) Result() entities.OperationResult {
+	result := po.OperationResult(entities.Provision)
+	result.ProvisionResult = po.result
+	return result
+}
+
+// setControlPlaneAddress sets the address of the control plane as hostname of the cluster. Bare-metal clusters
+// do not have load balancers, so the services of the cluster are exposed on the address of the control plane.
+func (po *ProvisionerOperation) setControlPlaneAddress(address string) {
+	po.result.Hostname = address
+	for _, addressName := range []string{entities.IngressIPAddressName, entities.DNSPublicIPAddress, entities.CoreDNSPublicIPAddress, entities.VPNServerPublicIPAddress} {
+		if addressName == entities.IngressIPAddressName || po.request.IsManagementCluster {
+			po.result.SetIPAddress(addressName, address)
+		}
+	}
+}
+
+// controlPlane returns the control plane host allocated to the cluster.
+func (po *ProvisionerOperation) controlPlane() (*Host, derrors.Error) {
+	return po.inventory.ControlPlane(po.request.OrganizationID, po.request.ClusterID)
+}
+
+// workers returns the worker hosts allocated to the cluster.
+func (po *ProvisionerOperation) workers() []Host {
+	return po.inventory.ClusterHosts(po.request.OrganizationID, po.request.ClusterID, WorkerRole)
+}
+
+// allocateHostsStep takes the control plane and worker hosts from the pool of free hosts.
+func (po *ProvisionerOperation) allocateHostsStep(_ context.Context) derrors.Error {
+	existing := po.inventory.ClusterHosts(po.request.OrganizationID, po.request.ClusterID, ControlPlaneRole)
+	if len(existing) > 0 && existing[0].RequestID != po.request.RequestID {
+		return derrors.NewAlreadyExistsError("cluster already exists").WithParams(po.request.OrganizationID, po.request.ClusterID)
+	}
+	_, err := po.inventory.Allocate(po.request.OrganizationID, po.request.ClusterID, po.request.RequestID, ControlPlaneRole, po.request.NodeType, 1)
+	if err != nil {
+		return err
+	}
+	_, err = po.inventory.Allocate(po.request.OrganizationID, po.request.ClusterID, po.request.RequestID, WorkerRole, po.request.NodeType, int(po.request.NumNodes))
+	if err != nil {
+		return err
+	}
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	po.setControlPlaneAddress(controlPlane.Address)
+	po.Pipeline().SetOutput(ControlPlaneAddressOutput, controlPlane.Address)
+	po.AddToLog("hosts have been allocated")
+	return nil
+}
+
+// releaseHostsStep returns the hosts allocated by the operation to the pool of free hosts.
+func (po *ProvisionerOperation) releaseHostsStep(_ context.Context) derrors.Error {
+	hosts := po.workers()
+	hosts = append(hosts, po.inventory.ClusterHosts(po.request.OrganizationID, po.request.ClusterID, ControlPlaneRole)...)
+	return po.releaseHosts(po.request.OrganizationID, po.request.ClusterID, hosts)
+}
+
+// checkHostsStep verifies that the allocated hosts can be reached and have kubeadm installed.
+func (po *ProvisionerOperation) checkHostsStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	return po.checkHosts(ctx, append([]Host{*controlPlane}, po.workers()...))
+}
+
+// initControlPlaneStep initializes the control plane of the cluster.
+func (po *ProvisionerOperation) initControlPlaneStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Initializing control plane")
+	if _, err := po.run(ctx, *controlPlane, initCommand(*controlPlane, po.request.KubernetesVersion)); err != nil {
+		return err
+	}
+	po.AddToLog("control plane has been initialized")
+	return nil
+}
+
+// resetControlPlaneStep reverts the initialization of the control plane.
+func (po *ProvisionerOperation) resetControlPlaneStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		if err.Type() == derrors.NotFound {
+			return nil
+		}
+		return err
+	}
+	return po.resetHosts(ctx, []Host{*controlPlane})
+}
+
+// installNetworkStep installs the pod network add-on.
+func (po *ProvisionerOperation) installNetworkStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	if _, err := po.run(ctx, *controlPlane, networkCommand(po.networkManifest)); err != nil {
+		return err
+	}
+	po.AddToLog("pod network has been installed")
+	return nil
+}
+
+// retrieveKubeConfigStep obtains the credentials to access the new cluster.
+func (po *ProvisionerOperation) retrieveKubeConfigStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	kubeConfig, err := po.retrieveKubeConfig(ctx, *controlPlane)
+	if err != nil {
+		return err
+	}
+	po.result.RawKubeConfig = kubeConfig
+	po.Pipeline().SetOutput(KubeConfigOutput, kubeConfig)
+	return nil
+}
+
+// joinWorkersStep joins the worker hosts to the cluster.
+func (po *ProvisionerOperation) joinWorkersStep(ctx context.Context) derrors.Error {
+	controlPlane, err := po.controlPlane()
+	if err != nil {
+		return err
+	}
+	return po.joinWorkers(ctx, *controlPlane, po.workers())
+}
+
+// resetWorkersStep reverts the join of the worker hosts.
+func (po *ProvisionerOperation) resetWorkersStep(ctx context.Context) derrors.Error {
+	return po.resetHosts(ctx, po.workers())
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DialTimeout with the maximum time to establish the SSH connection with a host.
+const DialTimeout = 30 * time.Second
+
+// DefaultSSHUser with the user to log in as on the hosts that do not set one.
+const DefaultSSHUser = "root"
+
+// maxErrorOutput with the number of characters of the error output of a command included in its error.
+const maxErrorOutput = 512
+
+// Runner executes commands on the hosts.
+type Runner interface {
+	// Run executes a command on a host and returns its standard output. The execution is stopped when the
+	// context is cancelled.
+	Run(ctx context.Context, host Host, command string) (string, derrors.Error)
+}
+
+// SSHRunner executes the commands through SSH. Commands run as root, using sudo for other users.
+type SSHRunner struct {
+	signer          ssh.Signer
+	hostKeyCallback ssh.HostKeyCallback
+	user            string
+}
+
+// NewSSHRunner creates a runner authenticating with the private key in a file and verifying the hosts with a
+// known_hosts file.
+func NewSSHRunner(keyPath string, knownHostsPath string, user string) (*SSHRunner, derrors.Error) {
+	raw, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read SSH private key")
+	}
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse SSH private key", err).WithParams(keyPath)
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot load SSH known hosts", err).WithParams(knownHostsPath)
+	}
+	return NewSSHRunnerWith(signer, callback, user), nil
+}
+
+// NewSSHRunnerWith creates a runner with a given key and host verification.
+func NewSSHRunnerWith(signer ssh.Signer, hostKeyCallback ssh.HostKeyCallback, user string) *SSHRunner {
+	if user == "" {
+		user = DefaultSSHUser
+	}
+	return &SSHRunner{signer: signer, hostKeyCallback: hostKeyCallback, user: user}
+}
+
+// Run executes a command on a host and returns its standard output.
+func (r *SSHRunner) Run(ctx context.Context, host Host, command string) (string, derrors.Error) {
+	user := host.User
+	if user == "" {
+		user = r.user
+	}
+	if user != DefaultSSHUser {
+		command = "sudo -n sh -c " + shellQuote(command)
+	}
+	dialer := net.Dialer{Timeout: DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host.SSHAddress())
+	if err != nil {
+		return "", derrors.NewUnavailableError("cannot connect to host", err).WithParams(host.Name)
+	}
+	clientConfig := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(r.signer)},
+		HostKeyCallback: r.hostKeyCallback,
+		Timeout:         DialTimeout,
+	}
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, host.SSHAddress(), clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return "", derrors.NewUnauthenticatedError("cannot open SSH connection", err).WithParams(host.Name)
+	}
+	client := ssh.NewClient(sshConn, channels, requests)
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return "", derrors.NewUnavailableError("cannot open SSH session", err).WithParams(host.Name)
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(command)
+	}()
+	select {
+	case <-ctx.Done():
+		// Closing the connection stops the command when the host kills the processes of the session.
+		_ = client.Close()
+		return "", derrors.NewCanceledError("command interrupted", ctx.Err()).WithParams(host.Name)
+	case err = <-done:
+	}
+	if err != nil {
+		// The command is not included as it may contain secrets such as join tokens.
+		log.Debug().Str("host", host.Name).Str("stderr", stderr.String()).Msg("command failed")
+		return "", derrors.NewInternalError("command failed on host", err).WithParams(host.Name, errorOutput(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// errorOutput returns the end of the error output of a command, which usually contains the cause.
+func errorOutput(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > maxErrorOutput {
+		return stderr[len(stderr)-maxErrorOutput:]
+	}
+	return stderr
+}
+
+// shellQuote quotes a value so that it is passed as a single word to the shell of the host.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// ScalerOperation changing the number of workers of a bare-metal cluster. Scaling up allocates free hosts and
+// joins them, while scaling down drains and resets the last workers and releases them. Each step recomputes the
+// hosts from the inventory so that a failed operation can be executed again.
+type ScalerOperation struct {
+	*BareMetalOperation
+	request entities.ScaleRequest
+}
+
+// NewScalerOperation creates a new bare-metal scaling operation.
+func NewScalerOperation(inventory *Inventory, runner Runner, networkManifest string, request entities.ScaleRequest) *ScalerOperation {
+	so := &ScalerOperation{
+		BareMetalOperation: NewBareMetalOperation(request.RequestID, inventory, runner, networkManifest),
+		request:            request,
+	}
+	so.SetSteps(
+		workflow.NewStep(AllocateHostsStep, so.allocateHostsStep),
+		workflow.NewStep(JoinWorkersStep, so.joinWorkersStep),
+		workflow.NewStep(DrainNodesStep, so.drainNodesStep),
+		workflow.NewStep(ResetNodesStep, so.resetNodesStep),
+		workflow.NewStep(ReleaseHostsStep, so.releaseHostsStep),
+	)
+	return so
+}
+
+// RequestID returns the request identifier associated with this operation
+func (so *ScalerOperation) RequestID() string {
+	return so.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (so *ScalerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      so.request.OrganizationID,
+		ClusterID:           so.request.ClusterID,
+		RequestID:           so.request.RequestID,
+		IsManagementCluster: so.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (so *ScalerOperation) Request() interface{} {
+	return so.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (so *ScalerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", so.request.OrganizationID).Str("clusterID", so.request.ClusterID).Int64("numNodes", so.request.NumNodes).Msg("executing bare-metal scaling operation")
+	ctx = so.Start(ctx)
+	defer so.Finish()
+
+	var err derrors.Error
+	if so.request.NumNodes < 1 {
+		err = derrors.NewInvalidArgumentError("cannot scale a cluster to less than 1 node")
+	} else {
+		err = so.RunSteps(ctx)
+	}
+	if err != nil {
+		so.SetFailure(ctx, err)
+		callback(so.request.RequestID)
+		return
+	}
+	so.Succeed()
+	callback(so.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (so *ScalerOperation) Result() entities.OperationResult {
+	return so.OperationResult(entities.Scale)
+}
+
+// workers returns the worker hosts allocated to the cluster.
+func (so *ScalerOperation) workers() []Host {
+	return so.inventory.ClusterHosts(so.request.OrganizationID, so.request.ClusterID, WorkerRole)
+}
+
+// removedWorkers returns the workers exceeding the requested number of nodes.
+func (so *ScalerOperation) removedWorkers() []Host {
+	workers := so.workers()
+	if int64(len(workers)) <= so.request.NumNodes {
+		return []Host{}
+	}
+	return workers[so.request.NumNodes:]
+}
+
+// allocateHostsStep takes free hosts from the pool when the cluster grows. New hosts are of the same type as
+// the existing ones.
+func (so *ScalerOperation) allocateHostsStep(_ context.Context) derrors.Error {
+	controlPlane, err := so.inventory.ControlPlane(so.request.OrganizationID, so.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	current := so.workers()
+	if int64(len(current)) >= so.request.NumNodes {
+		return nil
+	}
+	nodeType := controlPlane.NodeType
+	if len(current) > 0 {
+		nodeType = current[0].NodeType
+	}
+	allocated, err := so.inventory.Allocate(so.request.OrganizationID, so.request.ClusterID, so.request.RequestID, WorkerRole, nodeType, int(so.request.NumNodes))
+	if err != nil {
+		return err
+	}
+	so.AddToLog(fmt.Sprintf("%d hosts have been allocated", len(allocated)))
+	return nil
+}
+
+// joinWorkersStep joins the workers of the cluster. Workers that already joined are skipped by the hosts.
+func (so *ScalerOperation) joinWorkersStep(ctx context.Context) derrors.Error {
+	controlPlane, err := so.inventory.ControlPlane(so.request.OrganizationID, so.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	workers := so.workers()
+	if int64(len(workers)) > so.request.NumNodes {
+		workers = workers[:so.request.NumNodes]
+	}
+	return so.joinWorkers(ctx, *controlPlane, workers)
+}
+
+// drainNodesStep removes the exceeding workers from the cluster.
+func (so *ScalerOperation) drainNodesStep(ctx context.Context) derrors.Error {
+	removed := so.removedWorkers()
+	if len(removed) == 0 {
+		return nil
+	}
+	controlPlane, err := so.inventory.ControlPlane(so.request.OrganizationID, so.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	return so.drainNodes(ctx, *controlPlane, removed)
+}
+
+// resetNodesStep reverts kubeadm on the exceeding workers.
+func (so *ScalerOperation) resetNodesStep(ctx context.Context) derrors.Error {
+	return so.resetHosts(ctx, so.removedWorkers())
+}
+
+// releaseHostsStep returns the exceeding workers to the pool of free hosts.
+func (so *ScalerOperation) releaseHostsStep(_ context.Context) derrors.Error {
+	return so.releaseHosts(so.request.OrganizationID, so.request.ClusterID, so.removedWorkers())
+}
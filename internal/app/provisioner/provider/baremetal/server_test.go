@@ -0,0 +1,205 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package baremetal
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+)
+
+// Scripted outputs of the commands executed on the test hosts.
+const (
+	testKubeConfig  = "apiVersion: v1\nkind: Config\nclusters:\n- cluster:\n    server: https://127.0.0.1:6443\n"
+	testJoinCommand = "kubeadm join 127.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:0123456789abcdef\n"
+)
+
+// newSigner generates a key for the tests.
+func newSigner() ssh.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	gomega.Expect(err).To(gomega.Succeed())
+	signer, err := ssh.NewSignerFromKey(key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return signer
+}
+
+// sshServer is a stand-in of a host accepting a single client key and answering the commands with scripted
+// outputs. The commands are recorded to check what was executed on the host.
+type sshServer struct {
+	sync.Mutex
+	listener net.Listener
+	config   *ssh.ServerConfig
+	commands []string
+	// failures with the number of times the commands containing a value fail. Negative values always fail.
+	failures map[string]int
+	// blocked with the value of the commands that never finish.
+	blocked string
+}
+
+// newSSHServer starts a server on a random local port.
+func newSSHServer(hostKey ssh.Signer, clientKey ssh.PublicKey) *sshServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	gomega.Expect(err).To(gomega.Succeed())
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	server := &sshServer{listener: listener, config: config, commands: make([]string, 0), failures: make(map[string]int, 0)}
+	go server.serve()
+	return server
+}
+
+// Port returns the port the server listens on.
+func (s *sshServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Address returns the address of the server.
+func (s *sshServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *sshServer) Close() {
+	_ = s.listener.Close()
+}
+
+// Fail makes the commands containing a value fail a number of times.
+func (s *sshServer) Fail(value string, times int) {
+	s.Lock()
+	defer s.Unlock()
+	s.failures[value] = times
+}
+
+// Block makes the commands containing a value run until the connection is closed.
+func (s *sshServer) Block(value string) {
+	s.Lock()
+	defer s.Unlock()
+	s.blocked = value
+}
+
+// Commands returns the commands executed on the server.
+func (s *sshServer) Commands() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+// Executed returns the number of commands containing a value executed on the server.
+func (s *sshServer) Executed(value string) int {
+	count := 0
+	for _, command := range s.Commands() {
+		if strings.Contains(command, value) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(serverConn, channel, channelRequests)
+	}
+}
+
+func (s *sshServer) session(conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" {
+			_ = request.Reply(false, nil)
+			continue
+		}
+		payload := struct{ Command string }{}
+		if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+			_ = request.Reply(false, nil)
+			return
+		}
+		_ = request.Reply(true, nil)
+		output, status, blocked := s.execute(payload.Command)
+		if blocked {
+			_ = conn.Wait()
+			return
+		}
+		if status == 0 {
+			_, _ = channel.Write([]byte(output))
+		} else {
+			_, _ = channel.Stderr().Write([]byte(output))
+		}
+		_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// execute records a command and returns its scripted output.
+func (s *sshServer) execute(command string) (string, uint32, bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.commands = append(s.commands, command)
+	if s.blocked != "" && strings.Contains(command, s.blocked) {
+		return "", 0, true
+	}
+	for value, times := range s.failures {
+		if strings.Contains(command, value) && times != 0 {
+			s.failures[value] = times - 1
+			return "simulated failure", 1, false
+		}
+	}
+	switch {
+	case strings.HasPrefix(command, versionCommand()):
+		return "v1.13.11\n", 0, false
+	case command == kubeConfigCommand():
+		return testKubeConfig, 0, false
+	case command == joinTokenCommand():
+		return testJoinCommand, 0, false
+	}
+	return "", 0, false
+}
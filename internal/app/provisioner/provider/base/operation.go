@@ -0,0 +1,376 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package base contains the state handling shared by the operations of the providers that execute their work as
+// a pipeline of steps.
+package base
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// Operation with the progress, log, cancellation and rollback handling of an operation executed as a pipeline
+// of steps. Providers embed it and add the request and the result of each type of operation.
+type Operation struct {
+	sync.Mutex
+	requestID    string
+	started      time.Time
+	log          []entities.LogEntry
+	taskProgress entities.TaskProgress
+	errorMsg     string
+	elapsedTime  int64
+	// cancelRequested is set when the user requests the cancellation of the operation.
+	cancelRequested bool
+	// cancel function of the context associated with the execution of the operation.
+	cancel context.CancelFunc
+	// rollback with the actions performed to undo a failed operation.
+	rollback []entities.RollbackAction
+	// hub used to notify the changes of the operation to the watchers.
+	hub *watch.Hub
+	// step being executed, included in the log entries.
+	step string
+	// stepStarted with the time the current step started.
+	stepStarted time.Time
+	// expired is set when the executor stops the operation for exceeding its deadline or not making progress.
+	expired bool
+	// interrupted is set when the executor stops the operation because the provisioner is shutting down.
+	interrupted bool
+	// pipeline with the steps of the operation.
+	pipeline *workflow.Pipeline
+}
+
+// NewOperation creates an Operation without steps.
+func NewOperation(requestID string) *Operation {
+	o := &Operation{
+		requestID:    requestID,
+		log:          make([]entities.LogEntry, 0),
+		taskProgress: entities.Init,
+		hub:          watch.GetHub(),
+	}
+	o.SetSteps()
+	return o
+}
+
+// SetSteps sets the sequence of steps executed by the operation.
+func (o *Operation) SetSteps(steps ...workflow.Step) {
+	o.pipeline = workflow.NewPipeline(steps...)
+	o.pipeline.OnStepStarted(o.startStep)
+	o.pipeline.OnStepCompleted(o.completeStep)
+}
+
+// Pipeline returns the pipeline executing the steps of the operation.
+func (o *Operation) Pipeline() *workflow.Pipeline {
+	return o.pipeline
+}
+
+// RunSteps executes the pending steps of the operation logging the step that failed.
+func (o *Operation) RunSteps(ctx context.Context) derrors.Error {
+	err := o.pipeline.Run(ctx)
+	if err != nil {
+		checkpoint := o.pipeline.Checkpoint()
+		if checkpoint.Failed != "" {
+			o.failStep(checkpoint.Failed, err)
+		}
+	}
+	return err
+}
+
+// RollbackSteps undoes the steps executed by the operation and records the actions performed. Interrupted
+// operations are not rolled back so that they can be resumed after a restart.
+func (o *Operation) RollbackSteps() {
+	o.Lock()
+	interrupted := o.interrupted
+	o.Unlock()
+	if interrupted {
+		o.AddToLog("operation interrupted, rollback skipped")
+		return
+	}
+	o.AddToLog("rolling back operation")
+	// The execution context may have been cancelled so the rollback uses its own context.
+	actions := o.pipeline.Rollback(context.Background())
+	for _, action := range actions {
+		if action.ErrorMsg != "" {
+			o.AddWarningToLog("cannot roll back step", map[string]string{"step": action.Step, "error": action.ErrorMsg})
+		} else {
+			o.AddToLog(fmt.Sprintf("step %s rolled back", action.Step))
+		}
+	}
+	o.Lock()
+	o.rollback = actions
+	o.Unlock()
+}
+
+// RestoreCheckpoint prepares the operation to be executed again from the step that failed in a checkpoint.
+func (o *Operation) RestoreCheckpoint(checkpoint entities.StepCheckpoint) derrors.Error {
+	if err := o.pipeline.Restore(checkpoint); err != nil {
+		return err
+	}
+	o.Reset()
+	if checkpoint.Failed != "" {
+		o.AddToLog(fmt.Sprintf("resuming operation from step %s", checkpoint.Failed))
+	} else {
+		o.AddToLog("resuming operation")
+	}
+	return nil
+}
+
+// Log returns the operation log.
+func (o *Operation) Log() []entities.LogEntry {
+	o.Lock()
+	defer o.Unlock()
+	return o.log
+}
+
+// AddToLog adds a new informative entry to the operation log.
+func (o *Operation) AddToLog(message string) {
+	o.Lock()
+	defer o.Unlock()
+	o.appendLog(entities.InfoLevel, message, nil)
+}
+
+// AddWarningToLog adds a new warning entry to the operation log.
+func (o *Operation) AddWarningToLog(message string, fields map[string]string) {
+	o.Lock()
+	defer o.Unlock()
+	o.appendLog(entities.WarningLevel, message, fields)
+}
+
+// appendLog adds a new entry associated with the current step to the operation log and notifies the watchers.
+// The caller is expected to hold the lock.
+func (o *Operation) appendLog(level entities.LogLevel, message string, fields map[string]string) {
+	entry := entities.NewLogEntry(level, o.step, message)
+	entry.Fields = fields
+	o.log = append(o.log, entry)
+	o.hub.PublishLog(o.requestID, len(o.log)-1, entry)
+}
+
+// startStep sets the step being executed so that it is included in the following log entries.
+func (o *Operation) startStep(stepName string) {
+	o.Lock()
+	defer o.Unlock()
+	o.step = stepName
+	o.stepStarted = time.Now()
+	o.appendLog(entities.InfoLevel, fmt.Sprintf("step %s started", stepName), nil)
+}
+
+// completeStep logs the completion of the current step with its duration.
+func (o *Operation) completeStep(stepName string) {
+	o.Lock()
+	defer o.Unlock()
+	duration := time.Since(o.stepStarted).Round(time.Millisecond)
+	o.appendLog(entities.InfoLevel, fmt.Sprintf("step %s completed", stepName), map[string]string{entities.StepDurationField: duration.String()})
+	o.step = ""
+}
+
+// failStep logs the failure of the current step with its duration and the cause.
+func (o *Operation) failStep(stepName string, err derrors.Error) {
+	o.Lock()
+	defer o.Unlock()
+	duration := time.Since(o.stepStarted).Round(time.Millisecond)
+	o.appendLog(entities.ErrorLevel, fmt.Sprintf("step %s failed", stepName), map[string]string{entities.StepDurationField: duration.String(), "error": err.Error()})
+	o.step = ""
+}
+
+// Progress returns the progress of an operation.
+func (o *Operation) Progress() entities.TaskProgress {
+	o.Lock()
+	defer o.Unlock()
+	return o.taskProgress
+}
+
+// SetProgress sets the progress of the ongoing operation.
+func (o *Operation) SetProgress(progress entities.TaskProgress) {
+	o.Lock()
+	defer o.Unlock()
+	o.updateProgress(progress)
+}
+
+// updateProgress sets the progress of the operation and notifies the watchers. The caller is expected to hold
+// the lock.
+func (o *Operation) updateProgress(progress entities.TaskProgress) {
+	o.taskProgress = progress
+	o.hub.PublishProgress(o.requestID, progress)
+}
+
+// Start marks the operation as started and derives the context that is used by all the steps so that they are
+// stopped upon cancellation.
+func (o *Operation) Start(parent context.Context) context.Context {
+	o.Lock()
+	defer o.Unlock()
+	ctx, cancel := context.WithCancel(parent)
+	o.cancel = cancel
+	if o.cancelRequested {
+		cancel()
+	}
+	o.started = time.Now()
+	if !o.interrupted {
+		o.updateProgress(entities.InProgress)
+	}
+	return ctx
+}
+
+// Finish releases the resources associated with the execution context.
+func (o *Operation) Finish() {
+	o.Lock()
+	defer o.Unlock()
+	if o.cancel != nil {
+		o.cancel()
+	}
+}
+
+// Succeed marks the operation as finished.
+func (o *Operation) Succeed() {
+	o.Lock()
+	defer o.Unlock()
+	o.elapsedTime = time.Now().Sub(o.started).Nanoseconds()
+	o.updateProgress(entities.Finished)
+}
+
+// Cancel triggers the cancellation of the operation. Ongoing operations will stop at the next step boundary,
+// while operations that have not been started are directly marked as cancelled.
+func (o *Operation) Cancel() derrors.Error {
+	o.Lock()
+	defer o.Unlock()
+	if o.taskProgress.IsTerminal() {
+		return derrors.NewFailedPreconditionError("operation is already finished").WithParams(entities.TaskProgressToString[o.taskProgress])
+	}
+	o.cancelRequested = true
+	if o.cancel != nil {
+		o.cancel()
+	} else {
+		o.setCancelled()
+	}
+	return nil
+}
+
+// Expire stops the operation and marks it as failed. It is used by the executor to stop the operations that
+// exceed their deadline or stop making progress.
+func (o *Operation) Expire(reason derrors.Error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.taskProgress.IsTerminal() {
+		return
+	}
+	o.expired = true
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.appendLog(entities.ErrorLevel, reason.Error(), nil)
+	if !o.started.IsZero() {
+		o.elapsedTime = time.Now().Sub(o.started).Nanoseconds()
+	}
+	o.errorMsg = reason.Error()
+	o.updateProgress(entities.Error)
+}
+
+// Interrupt stops the operation at the next step boundary and marks it as interrupted. It is used by the
+// executor when the provisioner shuts down.
+func (o *Operation) Interrupt() {
+	o.Lock()
+	defer o.Unlock()
+	if o.taskProgress.IsTerminal() {
+		return
+	}
+	o.interrupted = true
+	o.pipeline.Interrupt()
+	o.appendLog(entities.WarningLevel, entities.InterruptedErrorMsg, nil)
+	if !o.started.IsZero() {
+		o.elapsedTime = time.Now().Sub(o.started).Nanoseconds()
+	}
+	o.errorMsg = entities.InterruptedErrorMsg
+	o.updateProgress(entities.Interrupted)
+}
+
+// Reset clears the execution state of the operation so that it can be executed again. The operation log is
+// kept so that it contains the history of all the executions.
+func (o *Operation) Reset() {
+	o.Lock()
+	defer o.Unlock()
+	o.updateProgress(entities.Init)
+	o.errorMsg = ""
+	o.elapsedTime = 0
+	o.cancelRequested = false
+	o.cancel = nil
+	o.rollback = nil
+	o.expired = false
+	o.interrupted = false
+	o.step = ""
+}
+
+// SetFailure updates the operation state after an error. Errors caused by the cancellation of the operation
+// context are reported as a cancellation, unless the operation has expired or has been interrupted.
+func (o *Operation) SetFailure(ctx context.Context, err derrors.Error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.expired {
+		// The reason has already been reported by Expire.
+		log.Warn().Str("cause", err.Error()).Msg("expired operation has stopped")
+		return
+	}
+	if o.interrupted {
+		// The state has already been set by Interrupt.
+		log.Info().Str("cause", err.Error()).Msg("interrupted operation has stopped")
+		return
+	}
+	if ctx.Err() == context.Canceled {
+		log.Info().Str("cause", err.Error()).Msg("operation has been cancelled")
+		o.appendLog(entities.WarningLevel, entities.CancelledErrorMsg, nil)
+		o.setCancelled()
+		return
+	}
+	log.Error().Str("trace", err.DebugReport()).Msg("operation failed")
+	o.elapsedTime = time.Now().Sub(o.started).Nanoseconds()
+	o.errorMsg = err.Error()
+	o.updateProgress(entities.Error)
+}
+
+// setCancelled updates all the fields to indicate that the operation has been cancelled. The caller is
+// expected to hold the lock.
+func (o *Operation) setCancelled() {
+	if !o.started.IsZero() {
+		o.elapsedTime = time.Now().Sub(o.started).Nanoseconds()
+	}
+	o.errorMsg = entities.CancelledErrorMsg
+	o.updateProgress(entities.Cancelled)
+}
+
+// OperationResult returns the common fields of the result of the operation.
+func (o *Operation) OperationResult(operationType entities.OperationType) entities.OperationResult {
+	o.Lock()
+	defer o.Unlock()
+	elapsed := o.elapsedTime
+	if o.elapsedTime == 0 && o.taskProgress == entities.InProgress {
+		// If the operation is in progress, retrieved the ongoing time.
+		elapsed = time.Now().Sub(o.started).Nanoseconds()
+	}
+	return entities.OperationResult{
+		RequestId:   o.requestID,
+		Type:        operationType,
+		Progress:    o.taskProgress,
+		ElapsedTime: elapsed,
+		ErrorMsg:    o.errorMsg,
+		Rollback:    o.rollback,
+	}
+}
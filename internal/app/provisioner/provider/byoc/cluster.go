@@ -0,0 +1,177 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"encoding/json"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/certmngr"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdoptionNamespace with the namespace of the config map recording the adoption of a cluster.
+const AdoptionNamespace = "kube-system"
+
+// AdoptionConfigMap with the name of the config map recording the adoption of a cluster.
+const AdoptionConfigMap = "nalej-provisioner-adoption"
+
+// adoptionKey with the entry of the config map containing the adoption record.
+const adoptionKey = "adoption"
+
+// Adoption records what the provisioner added to an adopted cluster so that the decommission removes only that.
+// The record is kept on the cluster itself.
+type Adoption struct {
+	// OrganizationID of the adopted cluster.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID of the adopted cluster.
+	ClusterID string `json:"cluster_id"`
+	// RequestID of the provisioning that adopted the cluster.
+	RequestID string `json:"request_id"`
+	// DNSZone containing the DNS records of the cluster.
+	DNSZone string `json:"dns_zone,omitempty"`
+	// ZoneResourceGroup with the resource group of the DNS zone.
+	ZoneResourceGroup string `json:"zone_resource_group,omitempty"`
+	// ARecords with the names of the DNS A records created for the cluster.
+	ARecords []string `json:"a_records,omitempty"`
+	// NSRecords with the names of the DNS NS records created for the cluster.
+	NSRecords []string `json:"ns_records,omitempty"`
+	// CertManager is set if the cert manager was installed by the provisioner.
+	CertManager bool `json:"cert_manager,omitempty"`
+	// CertificateIssuer is set if the certificate issuer was created by the provisioner.
+	CertificateIssuer bool `json:"certificate_issuer,omitempty"`
+	// Certificate is set if the cluster certificate was requested by the provisioner.
+	Certificate bool `json:"certificate,omitempty"`
+	// CASecret is set if the CA certificate secret was created by the provisioner.
+	CASecret bool `json:"ca_secret,omitempty"`
+}
+
+// belongsTo checks if the record is the adoption of a given cluster.
+func (a *Adoption) belongsTo(organizationID string, clusterID string) bool {
+	return a.OrganizationID == organizationID && a.ClusterID == clusterID
+}
+
+// Cluster with the operations performed on an adopted cluster.
+type Cluster interface {
+	// Connect establishes the connection with the cluster.
+	Connect(kubeConfig string) derrors.Error
+	// Close releases the connection with the cluster.
+	Close()
+	// LoadAdoption retrieves the adoption record of the cluster. NotFound is returned if the cluster has not
+	// been adopted.
+	LoadAdoption() (*Adoption, derrors.Error)
+	// SaveAdoption stores the adoption record of the cluster.
+	SaveAdoption(adoption *Adoption) derrors.Error
+	// DeleteAdoption removes the adoption record of the cluster.
+	DeleteAdoption() derrors.Error
+	// CertManagerInstalled checks if the cert manager is installed.
+	CertManagerInstalled() (bool, derrors.Error)
+	// InstallCertManager installs the cert manager.
+	InstallCertManager() derrors.Error
+	// UninstallCertManager removes the cert manager.
+	UninstallCertManager() derrors.Error
+	// CertificateIssuerExists checks if the certificate issuer exists.
+	CertificateIssuerExists() (bool, derrors.Error)
+	// RequestCertificateIssuer creates the certificate issuer validating the certificates on an Azure DNS zone.
+	RequestCertificateIssuer(credentials *grpc_provisioner_go.AzureCredentials, zoneResourceGroup string, dnsZone string, isProduction bool) derrors.Error
+	// CheckCertificateIssuer waits for the certificate issuer to be available.
+	CheckCertificateIssuer() derrors.Error
+	// DeleteCertificateIssuer removes the certificate issuer.
+	DeleteCertificateIssuer() derrors.Error
+	// CertificateExists checks if the cluster certificate exists.
+	CertificateExists() (bool, derrors.Error)
+	// CreateCertificate requests the cluster certificate.
+	CreateCertificate(clusterName string, dnsZone string) derrors.Error
+	// ValidateCertificate waits for the cluster certificate to be issued.
+	ValidateCertificate() derrors.Error
+	// DeleteCertificate removes the cluster certificate.
+	DeleteCertificate() derrors.Error
+	// CASecretExists checks if the CA certificate secret exists.
+	CASecretExists() (bool, derrors.Error)
+	// CreateCASecret creates the CA certificate secret.
+	CreateCASecret(isProduction bool) derrors.Error
+	// DeleteCASecret removes the CA certificate secret.
+	DeleteCASecret() derrors.Error
+}
+
+// KubernetesCluster accessing the adopted cluster through the Kubernetes API.
+type KubernetesCluster struct {
+	*certmngr.CertManagerHelper
+}
+
+// NewKubernetesCluster creates a new Cluster using the Kubernetes API.
+func NewKubernetesCluster(config *config.Config) Cluster {
+	return &KubernetesCluster{CertManagerHelper: certmngr.NewCertManagerHelper(config)}
+}
+
+// Close releases the connection with the cluster.
+func (kc *KubernetesCluster) Close() {
+	kc.Destroy()
+}
+
+// LoadAdoption retrieves the adoption record of the cluster.
+func (kc *KubernetesCluster) LoadAdoption() (*Adoption, derrors.Error) {
+	configMap, err := kc.Kubernetes.GetConfigMap(AdoptionNamespace, AdoptionConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	adoption := &Adoption{}
+	if err := json.Unmarshal([]byte(configMap.Data[adoptionKey]), adoption); err != nil {
+		return nil, derrors.NewInternalError("cannot decode adoption record", err)
+	}
+	return adoption, nil
+}
+
+// SaveAdoption stores the adoption record of the cluster.
+func (kc *KubernetesCluster) SaveAdoption(adoption *Adoption) derrors.Error {
+	raw, err := json.Marshal(adoption)
+	if err != nil {
+		return derrors.NewInternalError("cannot encode adoption record", err)
+	}
+	return kc.Kubernetes.ApplyConfigMap(&v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      AdoptionConfigMap,
+			Namespace: AdoptionNamespace,
+		},
+		Data: map[string]string{adoptionKey: string(raw)},
+	})
+}
+
+// DeleteAdoption removes the adoption record of the cluster.
+func (kc *KubernetesCluster) DeleteAdoption() derrors.Error {
+	return kc.Kubernetes.DeleteConfigMap(AdoptionNamespace, AdoptionConfigMap)
+}
+
+// RequestCertificateIssuer creates the certificate issuer validating the certificates on an Azure DNS zone.
+func (kc *KubernetesCluster) RequestCertificateIssuer(credentials *grpc_provisioner_go.AzureCredentials, zoneResourceGroup string, dnsZone string, isProduction bool) derrors.Error {
+	return kc.RequestCertificateIssuerOnAzure(
+		credentials.ClientId, credentials.ClientSecret,
+		credentials.SubscriptionId, credentials.TenantId,
+		zoneResourceGroup, dnsZone, isProduction)
+}
+
+// DeleteCertificateIssuer removes the certificate issuer.
+func (kc *KubernetesCluster) DeleteCertificateIssuer() derrors.Error {
+	return kc.DeleteCertificateIssuerOnAzure()
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-provisioner-go"
+)
+
+// fakeCluster keeping the state of an adopted cluster in memory. The state is shared by the Cluster instances
+// created for each operation.
+type fakeCluster struct {
+	sync.Mutex
+	kubeConfig        string
+	adoption          []byte
+	certManager       bool
+	certificateIssuer bool
+	certificate       bool
+	caSecret          bool
+	// fail with the names of the methods that return an error.
+	fail map[string]bool
+}
+
+func newFakeCluster(kubeConfig string) *fakeCluster {
+	return &fakeCluster{kubeConfig: kubeConfig, fail: make(map[string]bool)}
+}
+
+// newCluster returns the factory of clusters used by the provider.
+func (fc *fakeCluster) newCluster() Cluster {
+	return fc
+}
+
+func (fc *fakeCluster) call(name string) derrors.Error {
+	if fc.fail[name] {
+		return derrors.NewInternalError(fmt.Sprintf("%s failed", name))
+	}
+	return nil
+}
+
+func (fc *fakeCluster) Connect(kubeConfig string) derrors.Error {
+	if kubeConfig != fc.kubeConfig {
+		return derrors.NewPermissionDeniedError("unknown kubeconfig")
+	}
+	return fc.call("Connect")
+}
+
+func (fc *fakeCluster) Close() {}
+
+func (fc *fakeCluster) LoadAdoption() (*Adoption, derrors.Error) {
+	fc.Lock()
+	defer fc.Unlock()
+	if fc.adoption == nil {
+		return nil, derrors.NewNotFoundError("config map not found")
+	}
+	adoption := &Adoption{}
+	if err := json.Unmarshal(fc.adoption, adoption); err != nil {
+		return nil, derrors.NewInternalError("cannot decode adoption record", err)
+	}
+	return adoption, nil
+}
+
+func (fc *fakeCluster) SaveAdoption(adoption *Adoption) derrors.Error {
+	fc.Lock()
+	defer fc.Unlock()
+	raw, err := json.Marshal(adoption)
+	if err != nil {
+		return derrors.NewInternalError("cannot encode adoption record", err)
+	}
+	fc.adoption = raw
+	return nil
+}
+
+func (fc *fakeCluster) DeleteAdoption() derrors.Error {
+	fc.Lock()
+	defer fc.Unlock()
+	fc.adoption = nil
+	return nil
+}
+
+func (fc *fakeCluster) CertManagerInstalled() (bool, derrors.Error) {
+	return fc.certManager, nil
+}
+
+func (fc *fakeCluster) InstallCertManager() derrors.Error {
+	if err := fc.call("InstallCertManager"); err != nil {
+		return err
+	}
+	fc.certManager = true
+	return nil
+}
+
+func (fc *fakeCluster) UninstallCertManager() derrors.Error {
+	fc.certManager = false
+	return nil
+}
+
+func (fc *fakeCluster) CertificateIssuerExists() (bool, derrors.Error) {
+	return fc.certificateIssuer, nil
+}
+
+func (fc *fakeCluster) RequestCertificateIssuer(credentials *grpc_provisioner_go.AzureCredentials, zoneResourceGroup string, dnsZone string, isProduction bool) derrors.Error {
+	if err := fc.call("RequestCertificateIssuer"); err != nil {
+		return err
+	}
+	fc.certificateIssuer = true
+	return nil
+}
+
+func (fc *fakeCluster) CheckCertificateIssuer() derrors.Error {
+	return fc.call("CheckCertificateIssuer")
+}
+
+func (fc *fakeCluster) DeleteCertificateIssuer() derrors.Error {
+	fc.certificateIssuer = false
+	return nil
+}
+
+func (fc *fakeCluster) CertificateExists() (bool, derrors.Error) {
+	return fc.certificate, nil
+}
+
+func (fc *fakeCluster) CreateCertificate(clusterName string, dnsZone string) derrors.Error {
+	if err := fc.call("CreateCertificate"); err != nil {
+		return err
+	}
+	fc.certificate = true
+	return nil
+}
+
+func (fc *fakeCluster) ValidateCertificate() derrors.Error {
+	return fc.call("ValidateCertificate")
+}
+
+func (fc *fakeCluster) DeleteCertificate() derrors.Error {
+	fc.certificate = false
+	return nil
+}
+
+func (fc *fakeCluster) CASecretExists() (bool, derrors.Error) {
+	return fc.caSecret, nil
+}
+
+func (fc *fakeCluster) CreateCASecret(isProduction bool) derrors.Error {
+	if err := fc.call("CreateCASecret"); err != nil {
+		return err
+	}
+	fc.caSecret = true
+	return nil
+}
+
+func (fc *fakeCluster) DeleteCASecret() derrors.Error {
+	fc.caSecret = false
+	return nil
+}
+
+// fakeDNS keeping the records of a DNS zone in memory.
+type fakeDNS struct {
+	sync.Mutex
+	zone      string
+	aRecords  map[string]string
+	nsRecords map[string]string
+}
+
+func newFakeDNS(zone string) *fakeDNS {
+	return &fakeDNS{zone: zone, aRecords: make(map[string]string), nsRecords: make(map[string]string)}
+}
+
+func (fd *fakeDNS) ZoneResourceGroup(_ context.Context, zoneName string) (string, derrors.Error) {
+	if zoneName != fd.zone {
+		return "", derrors.NewNotFoundError("DNS zone not found").WithParams(zoneName)
+	}
+	return "dns-rg", nil
+}
+
+func (fd *fakeDNS) CreateARecord(_ context.Context, _ string, _ string, recordName string, IPAddress string) derrors.Error {
+	fd.Lock()
+	defer fd.Unlock()
+	fd.aRecords[recordName] = IPAddress
+	return nil
+}
+
+func (fd *fakeDNS) CreateNSRecord(_ context.Context, _ string, _ string, recordName string, nsName string) derrors.Error {
+	fd.Lock()
+	defer fd.Unlock()
+	fd.nsRecords[recordName] = nsName
+	return nil
+}
+
+func (fd *fakeDNS) DeleteARecord(_ context.Context, _ string, _ string, recordName string) derrors.Error {
+	fd.Lock()
+	defer fd.Unlock()
+	delete(fd.aRecords, recordName)
+	return nil
+}
+
+func (fd *fakeDNS) DeleteNSRecord(_ context.Context, _ string, _ string, recordName string) derrors.Error {
+	fd.Lock()
+	defer fd.Unlock()
+	delete(fd.nsRecords, recordName)
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// DecommissionerOperation releasing an adopted cluster. Only the elements added by the provisioner are removed, the
+// cluster itself is kept.
+type DecommissionerOperation struct {
+	*BYOCOperation
+	request entities.DecommissionRequest
+}
+
+// NewDecommissionerOperation creates a new operation releasing the cluster described by a profile.
+func NewDecommissionerOperation(profile *entities.CredentialsProfile, cluster Cluster, dns DNS, request entities.DecommissionRequest) *DecommissionerOperation {
+	do := &DecommissionerOperation{
+		BYOCOperation: NewBYOCOperation(request.RequestID, profile, cluster, dns),
+		request:       request,
+	}
+	do.SetSteps(
+		workflow.NewStep(LoadAdoptionStep, do.loadAdoptionStep),
+		workflow.NewStep(DeleteCASecretStep, do.deleteCASecretStep),
+		workflow.NewStep(DeleteCertificateStep, do.deleteCertificateStep),
+		workflow.NewStep(DeleteCertificateIssuerStep, do.deleteCertificateIssuerStep),
+		workflow.NewStep(UninstallCertManagerStep, do.uninstallCertManagerStep),
+		workflow.NewStep(DeleteDNSEntriesStep, do.deleteDNSEntriesStep),
+		workflow.NewStep(RemoveAdoptionStep, do.removeAdoptionStep),
+	)
+	return do
+}
+
+// RequestID returns the request identifier associated with this operation
+func (do *DecommissionerOperation) RequestID() string {
+	return do.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (do *DecommissionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      do.request.OrganizationID,
+		ClusterID:           do.request.ClusterID,
+		RequestID:           do.request.RequestID,
+		IsManagementCluster: do.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (do *DecommissionerOperation) Request() interface{} {
+	return do.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (do *DecommissionerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", do.request.OrganizationID).Str("clusterID", do.request.ClusterID).Msg("executing cluster release operation")
+	ctx = do.Start(ctx)
+	defer do.Finish()
+	defer do.disconnect()
+
+	if err := do.RunSteps(ctx); err != nil {
+		do.SetFailure(ctx, err)
+		callback(do.request.RequestID)
+		return
+	}
+	do.Succeed()
+	callback(do.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (do *DecommissionerOperation) Result() entities.OperationResult {
+	return do.OperationResult(entities.Decommission)
+}
+
+// loadAdoptionStep checks that the cluster has been adopted with the identifiers of the request.
+func (do *DecommissionerOperation) loadAdoptionStep(ctx context.Context) derrors.Error {
+	_, err := do.loadAdoption(ctx, do.request.OrganizationID, do.request.ClusterID)
+	if err != nil && err.Type() == derrors.FailedPrecondition {
+		return derrors.NewNotFoundError("cluster has not been adopted").WithParams(do.request.OrganizationID, do.request.ClusterID)
+	}
+	return err
+}
+
+// deleteCASecretStep removes the CA certificate secret if it was created by the provisioner.
+func (do *DecommissionerOperation) deleteCASecretStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeCASecret(ctx)
+}
+
+// deleteCertificateStep removes the cluster certificate if it was requested by the provisioner.
+func (do *DecommissionerOperation) deleteCertificateStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeCertificate(ctx)
+}
+
+// deleteCertificateIssuerStep removes the certificate issuer if it was created by the provisioner.
+func (do *DecommissionerOperation) deleteCertificateIssuerStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeCertificateIssuer(ctx)
+}
+
+// uninstallCertManagerStep removes the cert manager if it was installed by the provisioner.
+func (do *DecommissionerOperation) uninstallCertManagerStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeCertManager(ctx)
+}
+
+// deleteDNSEntriesStep deletes the DNS entries created by the provisioner.
+func (do *DecommissionerOperation) deleteDNSEntriesStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeDNSEntries(ctx)
+}
+
+// removeAdoptionStep deletes the adoption record of the cluster.
+func (do *DecommissionerOperation) removeAdoptionStep(ctx context.Context) derrors.Error {
+	if err := do.loadAdoptionStep(ctx); err != nil {
+		return err
+	}
+	return do.removeAdoption(ctx)
+}
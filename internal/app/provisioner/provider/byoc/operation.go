@@ -0,0 +1,240 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/azure"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+)
+
+// Names of the steps of the BYOC operations.
+const (
+	CheckClusterStep             = "check-cluster"
+	RecordIPAddressesStep        = "record-ip-addresses"
+	ResolveDNSZoneStep           = "resolve-dns-zone"
+	CreateDNSEntriesStep         = "create-dns-entries"
+	InstallCertManagerStep       = "install-cert-manager"
+	RequestCertificateIssuerStep = "request-certificate-issuer"
+	RequestCertificateStep       = "request-certificate"
+	CreateCASecretStep           = "create-ca-secret"
+	LoadAdoptionStep             = "load-adoption"
+	DeleteCASecretStep           = "delete-ca-secret"
+	DeleteCertificateStep        = "delete-certificate"
+	DeleteCertificateIssuerStep  = "delete-certificate-issuer"
+	UninstallCertManagerStep     = "uninstall-cert-manager"
+	DeleteDNSEntriesStep         = "delete-dns-entries"
+	RemoveAdoptionStep           = "remove-adoption"
+	RetrieveKubeConfigStep       = "retrieve-kubeconfig"
+)
+
+// DNS managing the records of the zone where the adopted clusters are published.
+type DNS interface {
+	// ZoneResourceGroup obtains the resource group of a DNS zone.
+	ZoneResourceGroup(ctx context.Context, zoneName string) (string, derrors.Error)
+	// CreateARecord creates or replaces a DNS A record.
+	CreateARecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string, IPAddress string) derrors.Error
+	// CreateNSRecord creates or replaces a DNS NS record.
+	CreateNSRecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string, nsName string) derrors.Error
+	// DeleteARecord removes a DNS A record.
+	DeleteARecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string) derrors.Error
+	// DeleteNSRecord removes a DNS NS record.
+	DeleteNSRecord(ctx context.Context, resourceGroupName string, zoneName string, recordName string) derrors.Error
+}
+
+// BYOCOperation structure with the common functions shared among the operations on adopted clusters.
+type BYOCOperation struct {
+	*base.Operation
+	profile *entities.CredentialsProfile
+	cluster Cluster
+	dns     DNS
+	// connected is set once the connection with the cluster is established.
+	connected bool
+	// adoption record of the cluster, loaded on demand.
+	adoption *Adoption
+}
+
+// NewBYOCOperation creates a BYOCOperation on the cluster described by a profile.
+func NewBYOCOperation(requestID string, profile *entities.CredentialsProfile, cluster Cluster, dns DNS) *BYOCOperation {
+	return &BYOCOperation{
+		Operation: base.NewOperation(requestID),
+		profile:   profile,
+		cluster:   cluster,
+		dns:       dns,
+	}
+}
+
+// connect establishes the connection with the cluster if it is not already connected.
+func (bo *BYOCOperation) connect(ctx context.Context) derrors.Error {
+	if bo.connected {
+		return nil
+	}
+	err := tracing.Trace(ctx, "ConnectCluster", func(context.Context) derrors.Error {
+		return bo.cluster.Connect(bo.profile.KubeConfig)
+	})
+	if err != nil {
+		return err
+	}
+	bo.connected = true
+	return nil
+}
+
+// disconnect releases the connection with the cluster.
+func (bo *BYOCOperation) disconnect() {
+	if bo.connected {
+		bo.cluster.Close()
+		bo.connected = false
+	}
+}
+
+// loadAdoption retrieves the adoption record of a cluster. The cluster must have been adopted with the given
+// identifiers.
+func (bo *BYOCOperation) loadAdoption(ctx context.Context, organizationID string, clusterID string) (*Adoption, derrors.Error) {
+	if bo.adoption != nil {
+		return bo.adoption, nil
+	}
+	if err := bo.connect(ctx); err != nil {
+		return nil, err
+	}
+	adoption, err := bo.cluster.LoadAdoption()
+	if err != nil {
+		return nil, err
+	}
+	if !adoption.belongsTo(organizationID, clusterID) {
+		return nil, derrors.NewFailedPreconditionError("cluster has been adopted with other identifiers").WithParams(adoption.OrganizationID, adoption.ClusterID)
+	}
+	bo.adoption = adoption
+	return adoption, nil
+}
+
+// saveAdoption stores the changes of the adoption record.
+func (bo *BYOCOperation) saveAdoption() derrors.Error {
+	return bo.cluster.SaveAdoption(bo.adoption)
+}
+
+// removeCASecret removes the CA certificate secret if it was created by the provisioner.
+func (bo *BYOCOperation) removeCASecret(ctx context.Context) derrors.Error {
+	if !bo.adoption.CASecret {
+		return nil
+	}
+	err := tracing.Trace(ctx, "DeleteCASecret", func(context.Context) derrors.Error {
+		return bo.cluster.DeleteCASecret()
+	})
+	if err != nil {
+		return err
+	}
+	bo.adoption.CASecret = false
+	bo.AddToLog("CA certificate secret removed")
+	return bo.saveAdoption()
+}
+
+// removeCertificate removes the cluster certificate if it was requested by the provisioner.
+func (bo *BYOCOperation) removeCertificate(ctx context.Context) derrors.Error {
+	if !bo.adoption.Certificate {
+		return nil
+	}
+	err := tracing.Trace(ctx, "DeleteCertificate", func(context.Context) derrors.Error {
+		return bo.cluster.DeleteCertificate()
+	})
+	if err != nil {
+		return err
+	}
+	bo.adoption.Certificate = false
+	bo.AddToLog("cluster certificate removed")
+	return bo.saveAdoption()
+}
+
+// removeCertificateIssuer removes the certificate issuer if it was created by the provisioner.
+func (bo *BYOCOperation) removeCertificateIssuer(ctx context.Context) derrors.Error {
+	if !bo.adoption.CertificateIssuer {
+		return nil
+	}
+	err := tracing.Trace(ctx, "DeleteCertificateIssuer", func(context.Context) derrors.Error {
+		return bo.cluster.DeleteCertificateIssuer()
+	})
+	if err != nil {
+		return err
+	}
+	bo.adoption.CertificateIssuer = false
+	bo.AddToLog("certificate issuer removed")
+	return bo.saveAdoption()
+}
+
+// removeCertManager uninstalls the cert manager if it was installed by the provisioner.
+func (bo *BYOCOperation) removeCertManager(ctx context.Context) derrors.Error {
+	if !bo.adoption.CertManager {
+		return nil
+	}
+	err := tracing.Trace(ctx, "UninstallCertManager", func(context.Context) derrors.Error {
+		return bo.cluster.UninstallCertManager()
+	})
+	if err != nil {
+		return err
+	}
+	bo.adoption.CertManager = false
+	bo.AddToLog("Cert manager has been uninstalled")
+	return bo.saveAdoption()
+}
+
+// removeDNSEntries deletes the DNS records created by the provisioner.
+func (bo *BYOCOperation) removeDNSEntries(ctx context.Context) derrors.Error {
+	for len(bo.adoption.NSRecords) > 0 {
+		last := len(bo.adoption.NSRecords) - 1
+		recordName := bo.adoption.NSRecords[last]
+		if err := bo.dns.DeleteNSRecord(ctx, bo.adoption.ZoneResourceGroup, bo.adoption.DNSZone, recordName); err != nil {
+			return err
+		}
+		bo.adoption.NSRecords = bo.adoption.NSRecords[:last]
+		if err := bo.saveAdoption(); err != nil {
+			return err
+		}
+		bo.AddToLog(fmt.Sprintf("DNS entry deleted %s", recordName))
+	}
+	for len(bo.adoption.ARecords) > 0 {
+		last := len(bo.adoption.ARecords) - 1
+		recordName := bo.adoption.ARecords[last]
+		if err := bo.dns.DeleteARecord(ctx, bo.adoption.ZoneResourceGroup, bo.adoption.DNSZone, recordName); err != nil {
+			return err
+		}
+		bo.adoption.ARecords = bo.adoption.ARecords[:last]
+		if err := bo.saveAdoption(); err != nil {
+			return err
+		}
+		bo.AddToLog(fmt.Sprintf("DNS entry deleted %s", recordName))
+	}
+	return nil
+}
+
+// removeAdoption deletes the adoption record, releasing the cluster.
+func (bo *BYOCOperation) removeAdoption(_ context.Context) derrors.Error {
+	if err := bo.cluster.DeleteAdoption(); err != nil {
+		return err
+	}
+	bo.adoption = nil
+	bo.AddToLog("cluster has been released")
+	return nil
+}
+
+// clusterDNSName returns the name of a cluster in its DNS records.
+func clusterDNSName(clusterName string) string {
+	return azure.ClusterDNSName(clusterName)
+}
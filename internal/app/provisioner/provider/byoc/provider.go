@@ -0,0 +1,92 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package byoc contains the infrastructure provider that adopts existing clusters. The clusters are described by a
+// credentials profile of the BYOC platform with their kubeconfig, their public addresses, and the Azure credentials
+// used to publish them on a DNS zone.
+package byoc
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/azure"
+	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Platform identifying the adopted clusters on the requests.
+const Platform = entities.BYOCPlatform
+
+// BYOCInfrastructureProvider managing the cluster described by a credentials profile.
+type BYOCInfrastructureProvider struct {
+	profile    *entities.CredentialsProfile
+	newCluster func() Cluster
+	dns        DNS
+}
+
+// NewBYOCInfrastructureProvider creates a provider for the cluster described by a profile.
+func NewBYOCInfrastructureProvider(profile *entities.CredentialsProfile, config *config.Config) (providerEntities.InfrastructureProvider, derrors.Error) {
+	if profile == nil || profile.Platform != entities.BYOCPlatformName {
+		return nil, derrors.NewInvalidArgumentError("a credentials profile of the BYOC platform is required")
+	}
+	dns, err := azure.NewDNSClient(profile.AzureCredentials)
+	if err != nil {
+		return nil, err
+	}
+	newCluster := func() Cluster {
+		return NewKubernetesCluster(config)
+	}
+	return NewBYOCInfrastructureProviderWith(profile, newCluster, dns), nil
+}
+
+// NewBYOCInfrastructureProviderWith creates a provider for the cluster described by a profile using a given
+// cluster factory and DNS client.
+func NewBYOCInfrastructureProviderWith(profile *entities.CredentialsProfile, newCluster func() Cluster, dns DNS) *BYOCInfrastructureProvider {
+	return &BYOCInfrastructureProvider{profile: profile, newCluster: newCluster, dns: dns}
+}
+
+// Provision a cluster creates a InfrastructureOperation to adopt the cluster.
+func (bip *BYOCInfrastructureProvider) Provision(request entities.ProvisionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	if request.DNSOptions == nil || request.DNSOptions.ZoneName == "" {
+		return nil, derrors.NewInvalidArgumentError("dns_zone_name is required to adopt a cluster")
+	}
+	return NewProvisionerOperation(bip.profile, bip.newCluster(), bip.dns, request), nil
+}
+
+// Decommission a cluster creates a InfrastructureOperation to release the cluster.
+func (bip *BYOCInfrastructureProvider) Decommission(request entities.DecommissionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewDecommissionerOperation(bip.profile, bip.newCluster(), bip.dns, request), nil
+}
+
+// Scale a cluster is not supported as adopted clusters are scaled by their owners.
+func (bip *BYOCInfrastructureProvider) Scale(request entities.ScaleRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return nil, derrors.NewUnimplementedError("adopted clusters are scaled by their owners").WithParams(request.ClusterID)
+}
+
+// GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
+func (bip *BYOCInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewManagementOperation(bip.profile, bip.newCluster(), bip.dns, request, entities.GetKubeConfig), nil
+}
+
+// ValidateCredentials checks that the kubeconfig of a profile can be parsed and that its Azure credentials are
+// accepted.
+func ValidateCredentials(profile *entities.CredentialsProfile) derrors.Error {
+	if _, err := clientcmd.Load([]byte(profile.KubeConfig)); err != nil {
+		return derrors.NewInvalidArgumentError("cannot parse kube_config", err).WithParams(profile.ID)
+	}
+	return azure.ValidateCredentials(profile.AzureCredentials)
+}
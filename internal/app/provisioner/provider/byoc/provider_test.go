@@ -0,0 +1,191 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const testKubeConfig = "apiVersion: v1\nkind: Config\n"
+
+func testProfile() *entities.CredentialsProfile {
+	return &entities.CredentialsProfile{
+		ID:       "existing",
+		Platform: entities.BYOCPlatformName,
+		AzureCredentials: &grpc_provisioner_go.AzureCredentials{
+			ClientId: "client", ClientSecret: "secret", TenantId: "tenant", SubscriptionId: "subscription",
+		},
+		KubeConfig: testKubeConfig,
+		IPAddresses: map[string]string{
+			entities.IngressIPAddressName:     "10.0.0.1",
+			entities.DNSPublicIPAddress:       "10.0.0.2",
+			entities.CoreDNSPublicIPAddress:   "10.0.0.3",
+			entities.VPNServerPublicIPAddress: "10.0.0.4",
+		},
+	}
+}
+
+var _ = ginkgo.Describe("BYOC infrastructure provider", func() {
+
+	var cluster *fakeCluster
+	var dns *fakeDNS
+	var provider *BYOCInfrastructureProvider
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster(testKubeConfig)
+		dns = newFakeDNS(providertest.DNSZone)
+		provider = NewBYOCInfrastructureProviderWith(testProfile(), cluster.newCluster, dns)
+	})
+
+	ginkgo.It("adopts and releases a management cluster", func() {
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("Test.Cluster.nalej.tech"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.Equal(testKubeConfig))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.Ingress).To(gomega.Equal("10.0.0.1"))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.VPNServer).To(gomega.Equal("10.0.0.4"))
+
+		gomega.Expect(dns.aRecords).To(gomega.HaveLen(5))
+		gomega.Expect(dns.aRecords).To(gomega.HaveKeyWithValue("test-cluster", "10.0.0.1"))
+		gomega.Expect(dns.aRecords).To(gomega.HaveKeyWithValue("*.test-cluster", "10.0.0.1"))
+		gomega.Expect(dns.aRecords).To(gomega.HaveKeyWithValue("app-dns.test-cluster", "10.0.0.3"))
+		gomega.Expect(dns.nsRecords).To(gomega.HaveKeyWithValue("ep.test-cluster.nalej.tech", "app-dns.test-cluster"))
+		gomega.Expect(cluster.certManager).To(gomega.BeTrue())
+		gomega.Expect(cluster.certificateIssuer).To(gomega.BeTrue())
+		gomega.Expect(cluster.certificate).To(gomega.BeTrue())
+		gomega.Expect(cluster.caSecret).To(gomega.BeTrue())
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(*result.KubeConfigResult).To(gomega.Equal(testKubeConfig))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(dns.aRecords).To(gomega.BeEmpty())
+		gomega.Expect(dns.nsRecords).To(gomega.BeEmpty())
+		gomega.Expect(cluster.certManager).To(gomega.BeFalse())
+		gomega.Expect(cluster.certificateIssuer).To(gomega.BeFalse())
+		gomega.Expect(cluster.certificate).To(gomega.BeFalse())
+		gomega.Expect(cluster.caSecret).To(gomega.BeFalse())
+		gomega.Expect(cluster.adoption).To(gomega.BeNil())
+	})
+
+	ginkgo.It("publishes only the ingress address of application clusters", func() {
+		profile := testProfile()
+		profile.IPAddresses = map[string]string{entities.IngressIPAddressName: "10.0.0.1"}
+		provider = NewBYOCInfrastructureProviderWith(profile, cluster.newCluster, dns)
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(dns.aRecords).To(gomega.HaveLen(2))
+		gomega.Expect(dns.nsRecords).To(gomega.BeEmpty())
+		gomega.Expect(cluster.caSecret).To(gomega.BeFalse())
+
+		operation, err = provider.Provision(providertest.ProvisionRequest("management", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("AlreadyExists"))
+	})
+
+	ginkgo.It("keeps the elements already present on the cluster", func() {
+		cluster.certManager = true
+		cluster.certificateIssuer = true
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(cluster.certManager).To(gomega.BeTrue())
+		gomega.Expect(cluster.certificateIssuer).To(gomega.BeTrue())
+		gomega.Expect(cluster.certificate).To(gomega.BeFalse())
+		gomega.Expect(cluster.caSecret).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("rolls back a failed adoption", func() {
+		cluster.fail["ValidateCertificate"] = true
+		request := providertest.ProvisionRequest("provision", true)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("ValidateCertificate failed"))
+		gomega.Expect(dns.aRecords).To(gomega.BeEmpty())
+		gomega.Expect(cluster.certManager).To(gomega.BeFalse())
+		gomega.Expect(cluster.certificate).To(gomega.BeFalse())
+		gomega.Expect(cluster.adoption).To(gomega.BeNil())
+	})
+
+	ginkgo.It("resumes a failed adoption", func() {
+		cluster.fail["CreateCertificate"] = true
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Error))
+		checkpoint := operation.(*ProvisionerOperation).Checkpoint()
+		gomega.Expect(checkpoint.Failed).To(gomega.Equal(RequestCertificateStep))
+
+		cluster.fail["CreateCertificate"] = false
+		resumed, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(resumed.(*ProvisionerOperation).Resume(*checkpoint)).To(gomega.Succeed())
+		result := providertest.Execute(resumed)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.DNS).To(gomega.Equal("10.0.0.2"))
+		gomega.Expect(cluster.certificate).To(gomega.BeTrue())
+		gomega.Expect(cluster.caSecret).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("rejects clusters not adopted by the organization", func() {
+		operation, err := provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+
+		operation, err = provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		request := providertest.DecommissionRequest("other", true)
+		request.OrganizationID = "other"
+		operation, err = provider.Decommission(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+		gomega.Expect(cluster.adoption).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("does not scale adopted clusters", func() {
+		_, err := provider.Scale(providertest.ScaleRequest("scale", true, 3))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
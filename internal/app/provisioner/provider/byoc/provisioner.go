@@ -0,0 +1,438 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package byoc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// dnsRecord with the name and the target of a DNS record.
+type dnsRecord struct {
+	name   string
+	target string
+}
+
+// ProvisionerOperation adopting an existing cluster. The cluster is published on the DNS zone of the request and
+// prepared with the cert manager and the certificates used by the platform. The elements already present on the
+// cluster are kept as they are.
+type ProvisionerOperation struct {
+	*BYOCOperation
+	request entities.ProvisionRequest
+	result  *entities.ProvisionResult
+}
+
+// NewProvisionerOperation creates a new operation adopting the cluster described by a profile.
+func NewProvisionerOperation(profile *entities.CredentialsProfile, cluster Cluster, dns DNS, request entities.ProvisionRequest) *ProvisionerOperation {
+	po := &ProvisionerOperation{
+		BYOCOperation: NewBYOCOperation(request.RequestID, profile, cluster, dns),
+		request:       request,
+		result: &entities.ProvisionResult{
+			ClusterName:   request.ClusterName,
+			Hostname:      fmt.Sprintf("%s.%s", request.ClusterName, request.DNSOptions.ZoneName),
+			RawKubeConfig: profile.KubeConfig,
+		},
+	}
+	// The compensations only remove what the adoption record shows that the operation created, so they also undo
+	// the step that failed.
+	steps := []workflow.Step{
+		workflow.NewPartialCompensableStep(CheckClusterStep, po.checkClusterStep, po.releaseClusterStep),
+		workflow.NewStep(RecordIPAddressesStep, po.recordIPAddressesStep),
+		workflow.NewStep(ResolveDNSZoneStep, po.resolveDNSZoneStep),
+		workflow.NewPartialCompensableStep(CreateDNSEntriesStep, po.createDNSEntriesStep, po.deleteDNSEntriesStep),
+		workflow.NewPartialCompensableStep(InstallCertManagerStep, po.installCertManagerStep, po.uninstallCertManagerStep),
+		workflow.NewPartialCompensableStep(RequestCertificateIssuerStep, po.requestCertificateIssuerStep, po.deleteCertificateIssuerStep),
+		workflow.NewPartialCompensableStep(RequestCertificateStep, po.requestCertificateStep, po.deleteCertificateStep),
+	}
+	if request.IsManagementCluster {
+		steps = append(steps, workflow.NewPartialCompensableStep(CreateCASecretStep, po.createCASecretStep, po.deleteCASecretStep))
+	}
+	po.SetSteps(steps...)
+	return po
+}
+
+// RequestID returns the request identifier associated with this operation
+func (po *ProvisionerOperation) RequestID() string {
+	return po.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (po *ProvisionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (po *ProvisionerOperation) Request() interface{} {
+	return po.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (po *ProvisionerOperation) Execute(ctx context.Context, callback func(requestId string)) {
+	log.Debug().Str("organizationID", po.request.OrganizationID).Str("clusterID", po.request.ClusterID).Msg("executing cluster adoption operation")
+	ctx = po.Start(ctx)
+	defer po.Finish()
+	defer po.disconnect()
+
+	err := po.RunSteps(ctx)
+	if err != nil {
+		if po.request.RollbackOnFailure {
+			po.RollbackSteps()
+		}
+		po.SetFailure(ctx, err)
+		callback(po.request.RequestID)
+		return
+	}
+	po.Succeed()
+	callback(po.request.RequestID)
+}
+
+// Checkpoint returns the state of the steps of the operation.
+func (po *ProvisionerOperation) Checkpoint() *entities.StepCheckpoint {
+	return po.Pipeline().Checkpoint()
+}
+
+// Resume prepares the operation to be executed again from the step that failed. The adoption record is reloaded
+// from the cluster by the next step.
+func (po *ProvisionerOperation) Resume(checkpoint entities.StepCheckpoint) derrors.Error {
+	if err := po.RestoreCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	if contains(checkpoint.Completed, RecordIPAddressesStep) {
+		return po.setIPAddresses()
+	}
+	return nil
+}
+
+// Result returns the operation result if this operation is successful
+func (po *ProvisionerOperation) Result() entities.OperationResult {
+	result := po.OperationResult(entities.Provision)
+	result.ProvisionResult = po.result
+	return result
+}
+
+// addressNames returns the names of the IP addresses required by the cluster.
+func (po *ProvisionerOperation) addressNames() []string {
+	if !po.request.IsManagementCluster {
+		return []string{entities.IngressIPAddressName}
+	}
+	return []string{entities.IngressIPAddressName, entities.DNSPublicIPAddress, entities.CoreDNSPublicIPAddress, entities.VPNServerPublicIPAddress}
+}
+
+// setIPAddresses sets the addresses of the profile required by the cluster in the result.
+func (po *ProvisionerOperation) setIPAddresses() derrors.Error {
+	for _, addressName := range po.addressNames() {
+		address, exists := po.profile.IPAddresses[addressName]
+		if !exists || address == "" {
+			return derrors.NewInvalidArgumentError("profile does not contain an address required by the cluster").WithParams(po.profile.ID, addressName)
+		}
+		po.result.SetIPAddress(addressName, address)
+	}
+	return nil
+}
+
+// dnsARecords returns the DNS A records of the cluster.
+func (po *ProvisionerOperation) dnsARecords() []dnsRecord {
+	dnsClusterRoot := clusterDNSName(po.request.ClusterName)
+	ingress := po.profile.IPAddresses[entities.IngressIPAddressName]
+	records := []dnsRecord{
+		{name: dnsClusterRoot, target: ingress},
+		{name: fmt.Sprintf("*.%s", dnsClusterRoot), target: ingress},
+	}
+	if !po.request.IsManagementCluster {
+		return records
+	}
+	return append(records,
+		dnsRecord{name: fmt.Sprintf("dns.%s", dnsClusterRoot), target: po.profile.IPAddresses[entities.DNSPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("vpn-server.%s", dnsClusterRoot), target: po.profile.IPAddresses[entities.VPNServerPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("app-dns.%s", dnsClusterRoot), target: po.profile.IPAddresses[entities.CoreDNSPublicIPAddress]},
+	)
+}
+
+// dnsNSRecords returns the DNS NS records used for the endpoint resolution of management clusters.
+func (po *ProvisionerOperation) dnsNSRecords() []dnsRecord {
+	if !po.request.IsManagementCluster {
+		return nil
+	}
+	dnsClusterRoot := clusterDNSName(po.request.ClusterName)
+	return []dnsRecord{{
+		name:   fmt.Sprintf("ep.%s.%s", dnsClusterRoot, po.request.DNSOptions.ZoneName),
+		target: fmt.Sprintf("app-dns.%s", dnsClusterRoot),
+	}}
+}
+
+// currentAdoption retrieves the adoption record of the cluster of the request.
+func (po *ProvisionerOperation) currentAdoption(ctx context.Context) (*Adoption, derrors.Error) {
+	return po.loadAdoption(ctx, po.request.OrganizationID, po.request.ClusterID)
+}
+
+// ensure creates an element of the cluster unless it is already present. The flag of the adoption record is set
+// before creating the element so that a failed creation is also removed.
+func (po *ProvisionerOperation) ensure(ctx context.Context, name string, flag *bool, exists func() (bool, derrors.Error), create func() derrors.Error) derrors.Error {
+	found, err := exists()
+	if err != nil {
+		return err
+	}
+	if found {
+		if !*flag {
+			po.AddToLog(fmt.Sprintf("%s already present on the cluster, keeping it", name))
+		}
+		return nil
+	}
+	if !*flag {
+		*flag = true
+		if err := po.saveAdoption(); err != nil {
+			return err
+		}
+	}
+	return tracing.Trace(ctx, name, func(context.Context) derrors.Error {
+		return create()
+	})
+}
+
+// checkClusterStep connects with the cluster and records its adoption. Clusters adopted by other requests are
+// rejected.
+func (po *ProvisionerOperation) checkClusterStep(ctx context.Context) derrors.Error {
+	if err := po.connect(ctx); err != nil {
+		return err
+	}
+	adoption, err := po.cluster.LoadAdoption()
+	if err != nil {
+		if err.Type() != derrors.NotFound {
+			return err
+		}
+		adoption = &Adoption{
+			OrganizationID: po.request.OrganizationID,
+			ClusterID:      po.request.ClusterID,
+			RequestID:      po.request.RequestID,
+			DNSZone:        po.request.DNSOptions.ZoneName,
+		}
+		if err := po.cluster.SaveAdoption(adoption); err != nil {
+			return err
+		}
+		po.AddToLog("cluster has been adopted")
+	} else if adoption.RequestID != po.request.RequestID {
+		return derrors.NewAlreadyExistsError("cluster has already been adopted").WithParams(adoption.OrganizationID, adoption.ClusterID)
+	}
+	po.adoption = adoption
+	return nil
+}
+
+// releaseClusterStep removes the adoption record created by the operation.
+func (po *ProvisionerOperation) releaseClusterStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		if err.Type() == derrors.NotFound || err.Type() == derrors.FailedPrecondition {
+			return nil
+		}
+		return err
+	}
+	if adoption.RequestID != po.request.RequestID {
+		return nil
+	}
+	return po.removeAdoption(ctx)
+}
+
+// recordIPAddressesStep checks that the profile contains the addresses required by the cluster.
+func (po *ProvisionerOperation) recordIPAddressesStep(_ context.Context) derrors.Error {
+	return po.setIPAddresses()
+}
+
+// resolveDNSZoneStep obtains the resource group of the target DNS zone.
+func (po *ProvisionerOperation) resolveDNSZoneStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	resourceGroup, err := po.dns.ZoneResourceGroup(ctx, po.request.DNSOptions.ZoneName)
+	if err != nil {
+		return err
+	}
+	adoption.DNSZone = po.request.DNSOptions.ZoneName
+	adoption.ZoneResourceGroup = resourceGroup
+	return po.saveAdoption()
+}
+
+// createDNSEntriesStep creates the DNS entries pointing to the addresses of the cluster. Each entry is recorded
+// before being created.
+func (po *ProvisionerOperation) createDNSEntriesStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Creating DNS entries")
+	for _, record := range po.dnsARecords() {
+		if !contains(adoption.ARecords, record.name) {
+			adoption.ARecords = append(adoption.ARecords, record.name)
+			if err := po.saveAdoption(); err != nil {
+				return err
+			}
+		}
+		if err := po.dns.CreateARecord(ctx, adoption.ZoneResourceGroup, adoption.DNSZone, record.name, record.target); err != nil {
+			return err
+		}
+		po.AddToLog(fmt.Sprintf("DNS entry created %s", record.name))
+	}
+	for _, record := range po.dnsNSRecords() {
+		if !contains(adoption.NSRecords, record.name) {
+			adoption.NSRecords = append(adoption.NSRecords, record.name)
+			if err := po.saveAdoption(); err != nil {
+				return err
+			}
+		}
+		if err := po.dns.CreateNSRecord(ctx, adoption.ZoneResourceGroup, adoption.DNSZone, record.name, record.target); err != nil {
+			return err
+		}
+		po.AddToLog(fmt.Sprintf("DNS entry created %s", record.name))
+	}
+	po.AddToLog("DNS entries have been defined")
+	return nil
+}
+
+// deleteDNSEntriesStep deletes the DNS entries created by the operation.
+func (po *ProvisionerOperation) deleteDNSEntriesStep(ctx context.Context) derrors.Error {
+	if _, err := po.currentAdoption(ctx); err != nil {
+		return err
+	}
+	return po.removeDNSEntries(ctx)
+}
+
+// installCertManagerStep installs the cert manager unless the cluster already has one.
+func (po *ProvisionerOperation) installCertManagerStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	err = po.ensure(ctx, "InstallCertManager", &adoption.CertManager, po.cluster.CertManagerInstalled, po.cluster.InstallCertManager)
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Cert manager is available")
+	return nil
+}
+
+// uninstallCertManagerStep removes the cert manager if it was installed by the operation.
+func (po *ProvisionerOperation) uninstallCertManagerStep(ctx context.Context) derrors.Error {
+	if _, err := po.currentAdoption(ctx); err != nil {
+		return err
+	}
+	return po.removeCertManager(ctx)
+}
+
+// requestCertificateIssuerStep creates the certificate issuer and waits for it to be available.
+func (po *ProvisionerOperation) requestCertificateIssuerStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	err = po.ensure(ctx, "RequestCertificateIssuer", &adoption.CertificateIssuer, po.cluster.CertificateIssuerExists, func() derrors.Error {
+		return po.cluster.RequestCertificateIssuer(po.profile.AzureCredentials, adoption.ZoneResourceGroup, adoption.DNSZone, po.request.IsProduction)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("certificate issuer requested")
+	err = tracing.Trace(ctx, "CheckCertificateIssuer", func(context.Context) derrors.Error {
+		return po.cluster.CheckCertificateIssuer()
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug().Msg("certificate issuer available")
+	return nil
+}
+
+// deleteCertificateIssuerStep removes the certificate issuer if it was created by the operation.
+func (po *ProvisionerOperation) deleteCertificateIssuerStep(ctx context.Context) derrors.Error {
+	if _, err := po.currentAdoption(ctx); err != nil {
+		return err
+	}
+	return po.removeCertificateIssuer(ctx)
+}
+
+// requestCertificateStep requests the cluster certificate and waits for it to be valid.
+func (po *ProvisionerOperation) requestCertificateStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	err = po.ensure(ctx, "RequestCertificate", &adoption.Certificate, po.cluster.CertificateExists, func() derrors.Error {
+		return po.cluster.CreateCertificate(clusterDNSName(po.request.ClusterName), adoption.DNSZone)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("validating cluster certificate")
+	return tracing.Trace(ctx, "ValidateCertificate", func(context.Context) derrors.Error {
+		return po.cluster.ValidateCertificate()
+	})
+}
+
+// deleteCertificateStep removes the cluster certificate if it was requested by the operation.
+func (po *ProvisionerOperation) deleteCertificateStep(ctx context.Context) derrors.Error {
+	if _, err := po.currentAdoption(ctx); err != nil {
+		return err
+	}
+	return po.removeCertificate(ctx)
+}
+
+// createCASecretStep adds the CA certificate as a secret on management clusters.
+func (po *ProvisionerOperation) createCASecretStep(ctx context.Context) derrors.Error {
+	adoption, err := po.currentAdoption(ctx)
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Adding CA certificate")
+	err = po.ensure(ctx, "CreateCASecret", &adoption.CASecret, po.cluster.CASecretExists, func() derrors.Error {
+		return po.cluster.CreateCASecret(po.request.IsProduction)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("CA certificate is available as a secret")
+	return nil
+}
+
+// deleteCASecretStep removes the CA certificate secret if it was created by the operation.
+func (po *ProvisionerOperation) deleteCASecretStep(ctx context.Context) derrors.Error {
+	if _, err := po.currentAdoption(ctx); err != nil {
+		return err
+	}
+	return po.removeCASecret(ctx)
+}
+
+// contains checks if a list of names contains a given one.
+func contains(names []string, name string) bool {
+	for _, current := range names {
+		if current == name {
+			return true
+		}
+	}
+	return false
+}
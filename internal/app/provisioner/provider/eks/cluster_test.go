@@ -0,0 +1,51 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+)
+
+// fakeCluster keeping the state of the cert manager of a new cluster in memory.
+type fakeCluster struct {
+	*providertest.CertManager
+	region          string
+	hostedZoneID    string
+	accessKeyID     string
+	secretAccessKey string
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{CertManager: providertest.NewCertManager()}
+}
+
+// newCluster returns the factory of clusters used by the provider.
+func (fc *fakeCluster) newCluster() Cluster {
+	return fc
+}
+
+func (fc *fakeCluster) RequestCertificateIssuer(region string, hostedZoneID string, accessKeyID string, secretAccessKey string, isProduction bool) derrors.Error {
+	if err := fc.Call("RequestCertificateIssuer"); err != nil {
+		return err
+	}
+	fc.region = region
+	fc.hostedZoneID = hostedZoneID
+	fc.accessKeyID = accessKeyID
+	fc.secretAccessKey = secretAccessKey
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/nalej/derrors"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExecAPIVersion with the version of the client authentication API used by the credential plugin.
+const ExecAPIVersion = "client.authentication.k8s.io/v1alpha1"
+
+// Parameters of the bearer tokens accepted by the EKS clusters, which are presigned GetCallerIdentity requests
+// bound to the name of a cluster as generated by aws eks get-token.
+const (
+	// TokenPrefix with the prefix of the encoded presigned URL.
+	TokenPrefix = "k8s-aws-v1."
+	// ClusterIDHeader with the header binding the presigned request to a cluster.
+	ClusterIDHeader = "x-k8s-aws-id"
+	// TokenExpiration with the validity of the presigned request, which is capped by EKS to 15 minutes.
+	TokenExpiration = 15 * time.Minute
+)
+
+// KubeConfigNotice with the limitation of the kubeconfig files returned for the EKS clusters.
+const KubeConfigNotice = "the kubeconfig obtains its tokens with aws eks get-token, so the AWS CLI and an IAM identity mapped on the cluster are required to use it"
+
+// KubeConfig generates the kubeconfig returned to access an EKS cluster.
+func (eo *EKSOperation) KubeConfig(ctx context.Context, resourceName string) (string, derrors.Error) {
+	cluster, err := eo.describeCluster(ctx, resourceName)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig, err := buildKubeConfig(cluster, eo.credentials.Region)
+	if err != nil {
+		return "", err
+	}
+	eo.AddToLog(KubeConfigNotice)
+	return kubeConfig, nil
+}
+
+// buildKubeConfig generates the kubeconfig returned to access an EKS cluster. EKS authenticates the users through
+// their IAM identity, so the kubeconfig obtains the tokens with the AWS CLI in the same way as
+// aws eks update-kubeconfig. Only the IAM identity of the profile, which creates the cluster, is mapped by EKS;
+// other identities must be added to the aws-auth ConfigMap of the cluster.
+func buildKubeConfig(cluster *eks.Cluster, region string) (string, derrors.Error) {
+	return writeKubeConfig(cluster, &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			APIVersion: ExecAPIVersion,
+			Command:    "aws",
+			Args:       []string{"--region", region, "eks", "get-token", "--cluster-name", aws.StringValue(cluster.Name)},
+		},
+	})
+}
+
+// buildTokenKubeConfig generates a kubeconfig embedding a token of the IAM identity of the profile. The provisioner
+// uses it to install the cert manager without depending on the AWS CLI. The token expires after TokenExpiration,
+// so the kubeconfig is never returned or persisted.
+func buildTokenKubeConfig(cluster *eks.Cluster, token string) (string, derrors.Error) {
+	return writeKubeConfig(cluster, &clientcmdapi.AuthInfo{Token: token})
+}
+
+// writeKubeConfig encodes a kubeconfig to access an EKS cluster with the given user.
+func writeKubeConfig(cluster *eks.Cluster, authInfo *clientcmdapi.AuthInfo) (string, derrors.Error) {
+	if cluster.Endpoint == nil || cluster.CertificateAuthority == nil || cluster.CertificateAuthority.Data == nil {
+		return "", derrors.NewUnavailableError("cluster endpoint is not available").WithParams(aws.StringValue(cluster.Name))
+	}
+	ca, err := base64.StdEncoding.DecodeString(aws.StringValue(cluster.CertificateAuthority.Data))
+	if err != nil {
+		return "", derrors.NewInternalError("cannot decode cluster certificate authority", err)
+	}
+	name := aws.StringValue(cluster.Arn)
+	if name == "" {
+		name = aws.StringValue(cluster.Name)
+	}
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   aws.StringValue(cluster.Endpoint),
+		CertificateAuthorityData: ca,
+	}
+	config.AuthInfos[name] = authInfo
+	config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	config.CurrentContext = name
+	raw, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot encode kubeconfig", err)
+	}
+	return string(raw), nil
+}
+
+// clusterToken generates a bearer token of the IAM identity of the profile for an EKS cluster.
+func (eo *EKSOperation) clusterToken(clusterName string) (string, derrors.Error) {
+	request, _ := eo.sts.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	request.HTTPRequest.Header.Add(ClusterIDHeader, clusterName)
+	presignedURL, err := request.Presign(TokenExpiration)
+	if err != nil {
+		return "", convertError(err, "cannot generate cluster token").WithParams(clusterName)
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURL)), nil
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// NewManagementOperation creates a new management operation on an EKS cluster.
+func NewManagementOperation(credentials *entities.AWSCredentials, awsSession *session.Session, waitDelay time.Duration, request entities.ClusterRequest, operation entities.ManagementOperationType) *managed.ManagementOperation {
+	eo := NewEKSOperation(request.RequestID, credentials, awsSession, waitDelay)
+	return managed.NewManagementOperation(eo.Operation, eo, ResourceName(request.IsManagementCluster, request.ClusterID), request, operation)
+}
@@ -0,0 +1,467 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the steps shared by the EKS operations.
+const (
+	CreateClusterStep            = "create-cluster"
+	CreateNodeGroupStep          = "create-node-group"
+	CreateIPAddressesStep        = "create-ip-addresses"
+	ResolveDNSZoneStep           = "resolve-dns-zone"
+	CreateDNSEntriesStep         = "create-dns-entries"
+	RetrieveKubeConfigStep       = managed.RetrieveKubeConfigStep
+	InstallCertManagerStep       = "install-cert-manager"
+	RequestCertificateIssuerStep = "request-certificate-issuer"
+	RequestCertificateStep       = "request-certificate"
+	CreateCASecretStep           = "create-ca-secret"
+	LoadClusterStep              = "load-cluster"
+	DeleteDNSEntriesStep         = "delete-dns-entries"
+	ReleaseIPAddressesStep       = "release-ip-addresses"
+	DeleteNodeGroupStep          = "delete-node-group"
+	DeleteClusterStep            = "delete-cluster"
+)
+
+// Names of the outputs produced by the steps.
+const (
+	HostedZoneOutput  = "hostedZone"
+	ClusterNameOutput = "clusterName"
+	DNSZoneOutput     = "dnsZone"
+	KubeConfigOutput  = "kubeConfig"
+	// IPAddressOutputPrefix with the prefix of the outputs containing the allocated addresses.
+	IPAddressOutputPrefix = "ipAddress."
+)
+
+// Tags set on the resources created by the provider.
+const (
+	// CreateByTag with the name of the tag used to indicate the creator of the resources.
+	CreateByTag = "created-by"
+	// CreateByValue with the value of the CreateByTag to mark the resources as Nalej managed.
+	CreateByValue = "nalej-provisioner"
+	// ResourceTag with the name of the tag containing the name of the cluster owning a resource.
+	ResourceTag = "nalej-resource"
+	// RequestTag with the name of the tag containing the request that created a cluster.
+	RequestTag = "nalej-request-id"
+	// ClusterNameTag with the name of the tag containing the name of the cluster used in its DNS records.
+	ClusterNameTag = "nalej-cluster-name"
+	// DNSZoneTag with the name of the tag containing the DNS zone of a cluster.
+	DNSZoneTag = "nalej-dns-zone"
+	// AddressTag with the name of the tag containing the name of an address, e.g. ingressPublicIPAddress.
+	AddressTag = "nalej-address"
+)
+
+// DNSRecordTTL with the time to live of the DNS records of the clusters in seconds.
+const DNSRecordTTL = 300
+
+// HostedZonePrefix with the prefix of the identifiers of the hosted zones returned by Route53.
+const HostedZonePrefix = "/hostedzone/"
+
+// EKSOperation structure with the common functions shared among the EKS operations. It implements the hooks used by
+// the operations of the managed package.
+type EKSOperation struct {
+	*base.Operation
+	credentials *entities.AWSCredentials
+	eks         *eks.EKS
+	ec2         *ec2.EC2
+	route53     *route53.Route53
+	sts         *sts.STS
+	// waitDelay between the checks of the resources being created or deleted. The default delays of the AWS
+	// waiters are used if it is zero.
+	waitDelay time.Duration
+}
+
+// NewEKSOperation creates an EKSOperation using a session of the account of the credentials.
+func NewEKSOperation(requestID string, credentials *entities.AWSCredentials, awsSession *session.Session, waitDelay time.Duration) *EKSOperation {
+	return &EKSOperation{
+		Operation:   base.NewOperation(requestID),
+		credentials: credentials,
+		eks:         eks.New(awsSession),
+		ec2:         ec2.New(awsSession),
+		route53:     route53.New(awsSession),
+		sts:         sts.New(awsSession),
+		waitDelay:   waitDelay,
+	}
+}
+
+// ServiceName returns the name of the managed Kubernetes service.
+func (eo *EKSOperation) ServiceName() string {
+	return "EKS"
+}
+
+// ResourceName returns the name of the EKS cluster based on the clusterID.
+func ResourceName(isManagement bool, clusterID string) string {
+	if isManagement {
+		// When installing a management cluster, the clusterID matches the clusterName
+		return fmt.Sprintf("mngt-%s", ClusterDNSName(clusterID))
+	}
+	return fmt.Sprintf("appcluster-%s", clusterID)
+}
+
+// ClusterDNSName returns the name of the cluster used in its DNS records.
+func ClusterDNSName(clusterName string) string {
+	noSpaces := strings.ReplaceAll(clusterName, " ", "")
+	noDots := strings.ReplaceAll(noSpaces, ".", "-")
+	return strings.ToLower(noDots)
+}
+
+// nodeGroupName returns the name of the node group of a cluster.
+func nodeGroupName(resourceName string) string {
+	return fmt.Sprintf("%s-nodes", resourceName)
+}
+
+// waiterOptions returns the options of the AWS waiters.
+func (eo *EKSOperation) waiterOptions() []request.WaiterOption {
+	if eo.waitDelay == 0 {
+		return nil
+	}
+	return []request.WaiterOption{request.WithWaiterDelay(request.ConstantWaiterDelay(eo.waitDelay))}
+}
+
+// describeCluster retrieves an EKS cluster.
+func (eo *EKSOperation) describeCluster(ctx context.Context, resourceName string) (*eks.Cluster, derrors.Error) {
+	output, err := eo.eks.DescribeClusterWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(resourceName)})
+	if err != nil {
+		return nil, convertError(err, "cannot retrieve cluster").WithParams(resourceName)
+	}
+	return output.Cluster, nil
+}
+
+// waitClusterActive waits for an EKS cluster to be available.
+func (eo *EKSOperation) waitClusterActive(ctx context.Context, resourceName string) derrors.Error {
+	return tracing.Trace(ctx, "WaitClusterActive", func(ctx context.Context) derrors.Error {
+		err := eo.eks.WaitUntilClusterActiveWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(resourceName)}, eo.waiterOptions()...)
+		if err != nil {
+			return convertError(err, "cluster failed during creation").WithParams(resourceName)
+		}
+		return nil
+	})
+}
+
+// deleteCluster removes an EKS cluster and waits for its deletion.
+func (eo *EKSOperation) deleteCluster(ctx context.Context, resourceName string) derrors.Error {
+	_, err := eo.eks.DeleteClusterWithContext(ctx, &eks.DeleteClusterInput{Name: aws.String(resourceName)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return convertError(err, "cannot delete cluster").WithParams(resourceName)
+	}
+	eo.AddToLog("Deleting cluster")
+	return tracing.Trace(ctx, "WaitClusterDeleted", func(ctx context.Context) derrors.Error {
+		err := eo.eks.WaitUntilClusterDeletedWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(resourceName)}, eo.waiterOptions()...)
+		if err != nil {
+			return convertError(err, "cluster failed during deletion").WithParams(resourceName)
+		}
+		eo.AddToLog("cluster has been deleted")
+		return nil
+	})
+}
+
+// describeNodeGroup retrieves the node group of a cluster.
+func (eo *EKSOperation) describeNodeGroup(ctx context.Context, resourceName string) (*eks.Nodegroup, derrors.Error) {
+	output, err := eo.eks.DescribeNodegroupWithContext(ctx, &eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(resourceName),
+		NodegroupName: aws.String(nodeGroupName(resourceName)),
+	})
+	if err != nil {
+		return nil, convertError(err, "cannot retrieve node group").WithParams(resourceName)
+	}
+	return output.Nodegroup, nil
+}
+
+// waitNodeGroupActive waits for the node group of a cluster to be available.
+func (eo *EKSOperation) waitNodeGroupActive(ctx context.Context, resourceName string) derrors.Error {
+	return tracing.Trace(ctx, "WaitNodeGroupActive", func(ctx context.Context) derrors.Error {
+		err := eo.eks.WaitUntilNodegroupActiveWithContext(ctx, &eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(resourceName),
+			NodegroupName: aws.String(nodeGroupName(resourceName)),
+		}, eo.waiterOptions()...)
+		if err != nil {
+			return convertError(err, "node group is not available").WithParams(resourceName)
+		}
+		return nil
+	})
+}
+
+// deleteNodeGroup removes the node group of a cluster and waits for its deletion.
+func (eo *EKSOperation) deleteNodeGroup(ctx context.Context, resourceName string) derrors.Error {
+	input := &eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(resourceName),
+		NodegroupName: aws.String(nodeGroupName(resourceName)),
+	}
+	_, err := eo.eks.DeleteNodegroupWithContext(ctx, &eks.DeleteNodegroupInput{
+		ClusterName:   input.ClusterName,
+		NodegroupName: input.NodegroupName,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return convertError(err, "cannot delete node group").WithParams(resourceName)
+	}
+	eo.AddToLog("Deleting node group")
+	return tracing.Trace(ctx, "WaitNodeGroupDeleted", func(ctx context.Context) derrors.Error {
+		err := eo.eks.WaitUntilNodegroupDeletedWithContext(ctx, input, eo.waiterOptions()...)
+		if err != nil {
+			return convertError(err, "node group failed during deletion").WithParams(resourceName)
+		}
+		eo.AddToLog("node group has been deleted")
+		return nil
+	})
+}
+
+// findAddresses retrieves the Elastic IP addresses allocated to a cluster indexed by the name of the address.
+func (eo *EKSOperation) findAddresses(ctx context.Context, resourceName string) (map[string]*ec2.Address, derrors.Error) {
+	output, err := eo.ec2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String(fmt.Sprintf("tag:%s", ResourceTag)),
+			Values: []*string{aws.String(resourceName)},
+		}},
+	})
+	if err != nil {
+		return nil, convertError(err, "cannot list IP addresses").WithParams(resourceName)
+	}
+	addresses := make(map[string]*ec2.Address, 0)
+	for _, address := range output.Addresses {
+		for _, tag := range address.Tags {
+			if aws.StringValue(tag.Key) == AddressTag {
+				addresses[aws.StringValue(tag.Value)] = address
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// allocateAddress reserves an Elastic IP address for a cluster.
+func (eo *EKSOperation) allocateAddress(ctx context.Context, resourceName string, addressName string) (string, derrors.Error) {
+	output, err := eo.ec2.AllocateAddressWithContext(ctx, &ec2.AllocateAddressInput{Domain: aws.String(ec2.DomainTypeVpc)})
+	if err != nil {
+		return "", convertError(err, "cannot allocate IP address").WithParams(resourceName, addressName)
+	}
+	_, err = eo.ec2.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+		Resources: []*string{output.AllocationId},
+		Tags: []*ec2.Tag{
+			{Key: aws.String(CreateByTag), Value: aws.String(CreateByValue)},
+			{Key: aws.String(ResourceTag), Value: aws.String(resourceName)},
+			{Key: aws.String(AddressTag), Value: aws.String(addressName)},
+		},
+	})
+	if err != nil {
+		// An untagged address cannot be found later, so it is released right away.
+		eo.releaseAddress(ctx, aws.StringValue(output.AllocationId))
+		return "", convertError(err, "cannot tag IP address").WithParams(resourceName, addressName)
+	}
+	return aws.StringValue(output.PublicIp), nil
+}
+
+// releaseAddress returns an Elastic IP address to the pool of the account.
+func (eo *EKSOperation) releaseAddress(ctx context.Context, allocationID string) derrors.Error {
+	_, err := eo.ec2.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{AllocationId: aws.String(allocationID)})
+	if err != nil {
+		log.Warn().Str("allocationID", allocationID).Err(err).Msg("cannot release IP address")
+		return convertError(err, "cannot release IP address").WithParams(allocationID)
+	}
+	return nil
+}
+
+// releaseAddresses returns the Elastic IP addresses of a cluster to the pool of the account.
+func (eo *EKSOperation) releaseAddresses(ctx context.Context, resourceName string) derrors.Error {
+	addresses, err := eo.findAddresses(ctx, resourceName)
+	if err != nil {
+		return err
+	}
+	for addressName, address := range addresses {
+		if err := eo.releaseAddress(ctx, aws.StringValue(address.AllocationId)); err != nil {
+			return err
+		}
+		eo.AddToLog(fmt.Sprintf("IP address released %s", addressName))
+	}
+	return nil
+}
+
+// hostedZoneID obtains the identifier of the Route53 hosted zone of a DNS zone.
+func (eo *EKSOperation) hostedZoneID(ctx context.Context, zoneName string) (string, derrors.Error) {
+	output, err := eo.route53.ListHostedZonesByNameWithContext(ctx, &route53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(zoneName),
+		MaxItems: aws.String("1"),
+	})
+	if err != nil {
+		return "", convertError(err, "cannot retrieve DNS zone").WithParams(zoneName)
+	}
+	if len(output.HostedZones) == 0 || normalizeRecordName(aws.StringValue(output.HostedZones[0].Name)) != normalizeRecordName(zoneName) {
+		return "", derrors.NewNotFoundError("DNS zone not found").WithParams(zoneName)
+	}
+	return aws.StringValue(output.HostedZones[0].Id), nil
+}
+
+// dnsRecord with the name, type and value of a DNS record.
+type dnsRecord struct {
+	name       string
+	recordType string
+	value      string
+}
+
+// dnsRecords returns the DNS records of a cluster. Management clusters publish the addresses of their DNS and VPN
+// services, and delegate the resolution of the endpoints to their own DNS server.
+func dnsRecords(clusterName string, dnsZone string, isManagementCluster bool, addresses map[string]string) []dnsRecord {
+	dnsClusterRoot := fmt.Sprintf("%s.%s", ClusterDNSName(clusterName), dnsZone)
+	ingress := addresses[entities.IngressIPAddressName]
+	records := []dnsRecord{
+		{name: dnsClusterRoot, recordType: route53.RRTypeA, value: ingress},
+		{name: fmt.Sprintf("*.%s", dnsClusterRoot), recordType: route53.RRTypeA, value: ingress},
+	}
+	if !isManagementCluster {
+		return records
+	}
+	return append(records,
+		dnsRecord{name: fmt.Sprintf("dns.%s", dnsClusterRoot), recordType: route53.RRTypeA, value: addresses[entities.DNSPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("vpn-server.%s", dnsClusterRoot), recordType: route53.RRTypeA, value: addresses[entities.VPNServerPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("app-dns.%s", dnsClusterRoot), recordType: route53.RRTypeA, value: addresses[entities.CoreDNSPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("ep.%s", dnsClusterRoot), recordType: route53.RRTypeNs, value: fmt.Sprintf("app-dns.%s", dnsClusterRoot)},
+	)
+}
+
+// upsertDNSRecords creates or replaces a set of DNS records in a single change.
+func (eo *EKSOperation) upsertDNSRecords(ctx context.Context, hostedZoneID string, records []dnsRecord) derrors.Error {
+	changes := make([]*route53.Change, 0, len(records))
+	for _, record := range records {
+		changes = append(changes, &route53.Change{
+			Action: aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String(record.name),
+				Type:            aws.String(record.recordType),
+				TTL:             aws.Int64(DNSRecordTTL),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(record.value)}},
+			},
+		})
+	}
+	_, err := eo.route53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneID),
+		ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+	})
+	if err != nil {
+		return convertError(err, "cannot create DNS entries").WithParams(hostedZoneID)
+	}
+	return nil
+}
+
+// deleteDNSRecord removes a DNS record if it exists. The current record is retrieved as Route53 requires the
+// values of the record to delete it.
+func (eo *EKSOperation) deleteDNSRecord(ctx context.Context, hostedZoneID string, record dnsRecord) (bool, derrors.Error) {
+	output, err := eo.route53.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneID),
+		StartRecordName: aws.String(record.name),
+		StartRecordType: aws.String(record.recordType),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return false, convertError(err, "cannot retrieve DNS entry").WithParams(record.name)
+	}
+	if len(output.ResourceRecordSets) == 0 {
+		return false, nil
+	}
+	current := output.ResourceRecordSets[0]
+	if normalizeRecordName(aws.StringValue(current.Name)) != normalizeRecordName(record.name) || aws.StringValue(current.Type) != record.recordType {
+		return false, nil
+	}
+	_, err = eo.route53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneID),
+		ChangeBatch: &route53.ChangeBatch{Changes: []*route53.Change{{
+			Action:            aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: current,
+		}}},
+	})
+	if err != nil {
+		return false, convertError(err, "cannot delete DNS entry").WithParams(record.name)
+	}
+	return true, nil
+}
+
+// deleteDNSRecords removes the DNS records of a cluster.
+func (eo *EKSOperation) deleteDNSRecords(ctx context.Context, hostedZoneID string, records []dnsRecord) derrors.Error {
+	for _, record := range records {
+		deleted, err := eo.deleteDNSRecord(ctx, hostedZoneID, record)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			eo.AddToLog(fmt.Sprintf("DNS entry deleted %s", record.name))
+		}
+	}
+	return nil
+}
+
+// normalizeRecordName returns a DNS name as returned by Route53, which escapes the wildcards and appends the root.
+func normalizeRecordName(name string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(name, "\\052", "*"), ".")
+}
+
+// isNotFound checks if an AWS error reports a missing resource.
+func isNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case eks.ErrCodeResourceNotFoundException, "InvalidAllocationID.NotFound", route53.ErrCodeNoSuchHostedZone:
+			return true
+		}
+	}
+	return false
+}
+
+// convertError transforms the errors of the AWS SDK into derrors.
+func convertError(err error, msg string) *derrors.GenericError {
+	if isNotFound(err) {
+		return derrors.NewNotFoundError(msg, err)
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case eks.ErrCodeResourceInUseException:
+			return derrors.NewAlreadyExistsError(msg, err)
+		case eks.ErrCodeInvalidParameterException, eks.ErrCodeInvalidRequestException, "InvalidParameterValue":
+			return derrors.NewInvalidArgumentError(msg, err)
+		case eks.ErrCodeResourceLimitExceededException, "AddressLimitExceeded":
+			return derrors.NewResourceExhaustedError(msg, err)
+		case "UnrecognizedClientException", "AuthFailure", "InvalidClientTokenId", "SignatureDoesNotMatch":
+			return derrors.NewUnauthenticatedError(msg, err)
+		case "AccessDeniedException", "UnauthorizedOperation", "AccessDenied":
+			return derrors.NewPermissionDeniedError(msg, err)
+		case request.CanceledErrorCode:
+			return derrors.NewCanceledError(msg, err)
+		}
+	}
+	return derrors.NewGenericError(msg, err)
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package eks contains the infrastructure provider that creates Kubernetes clusters on Amazon EKS. The AWS
+// account is described by a credentials profile of the AWS platform.
+package eks
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/nalej/derrors"
+	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Platform identifying the EKS clusters on the requests.
+const Platform = entities.AWSPlatform
+
+// EKSInfrastructureProvider managing clusters on the AWS account of a credentials profile.
+type EKSInfrastructureProvider struct {
+	credentials *entities.AWSCredentials
+	session     *session.Session
+	// newCluster creates the access to the new clusters used to issue their certificates.
+	newCluster func() Cluster
+	// waitDelay between the checks of the resources being created or deleted.
+	waitDelay time.Duration
+}
+
+// NewEKSInfrastructureProvider creates a provider using the AWS credentials of a profile.
+func NewEKSInfrastructureProvider(profile *entities.CredentialsProfile, config *config.Config) (providerEntities.InfrastructureProvider, derrors.Error) {
+	if profile == nil || profile.AWSCredentials == nil {
+		return nil, derrors.NewInvalidArgumentError("a credentials profile with aws_credentials is required")
+	}
+	newCluster := func() Cluster {
+		return NewKubernetesCluster(config)
+	}
+	return NewEKSInfrastructureProviderWith(profile.AWSCredentials, newCluster, 0)
+}
+
+// NewEKSInfrastructureProviderWith creates a provider using the given AWS credentials, access to the new
+// clusters, and delay between the checks of the resources being created or deleted. The default delays of the
+// AWS waiters are used if it is zero.
+func NewEKSInfrastructureProviderWith(credentials *entities.AWSCredentials, newCluster func() Cluster, waitDelay time.Duration) (*EKSInfrastructureProvider, derrors.Error) {
+	awsSession, err := newSession(credentials)
+	if err != nil {
+		return nil, err
+	}
+	return &EKSInfrastructureProvider{credentials: credentials, session: awsSession, newCluster: newCluster, waitDelay: waitDelay}, nil
+}
+
+// newSession creates a session of the AWS SDK for the given credentials.
+func newSession(awsCredentials *entities.AWSCredentials) (*session.Session, derrors.Error) {
+	config := aws.NewConfig().
+		WithRegion(awsCredentials.Region).
+		WithCredentials(credentials.NewStaticCredentials(awsCredentials.AccessKeyID, awsCredentials.SecretAccessKey, ""))
+	if awsCredentials.Endpoint != "" {
+		config = config.WithEndpoint(awsCredentials.Endpoint)
+	}
+	awsSession, err := session.NewSession(config)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot create AWS session", err)
+	}
+	return awsSession, nil
+}
+
+// Provision a cluster creates a InfrastructureOperation to provision a new cluster.
+func (eip *EKSInfrastructureProvider) Provision(request entities.ProvisionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	if request.DNSOptions == nil || request.DNSOptions.ZoneName == "" {
+		return nil, derrors.NewInvalidArgumentError("dns_zone_name is required to provision an EKS cluster")
+	}
+	return NewProvisionerOperation(eip.credentials, eip.session, eip.newCluster(), eip.waitDelay, request), nil
+}
+
+// Decommission a cluster creates a InfrastructureOperation to decommission a cluster.
+func (eip *EKSInfrastructureProvider) Decommission(request entities.DecommissionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewDecommissionerOperation(eip.credentials, eip.session, eip.waitDelay, request), nil
+}
+
+// Scale a cluster creates a InfrastructureOperation to scale a cluster.
+func (eip *EKSInfrastructureProvider) Scale(request entities.ScaleRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewScalerOperation(eip.credentials, eip.session, eip.waitDelay, request), nil
+}
+
+// GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes. The kubeconfig
+// obtains its tokens with aws eks get-token, so it requires the AWS CLI and an IAM identity mapped on the cluster.
+func (eip *EKSInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewManagementOperation(eip.credentials, eip.session, eip.waitDelay, request, entities.GetKubeConfig), nil
+}
+
+// ValidateCredentials checks that AWS accepts the access keys of a profile.
+func ValidateCredentials(awsCredentials *entities.AWSCredentials) derrors.Error {
+	awsSession, err := newSession(awsCredentials)
+	if err != nil {
+		return err
+	}
+	_, callErr := sts.New(awsSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if callErr != nil {
+		return convertError(callErr, "invalid AWS credentials")
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func testCredentials(endpoint string) *entities.AWSCredentials {
+	return &entities.AWSCredentials{
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Region:          "eu-west-1",
+		ClusterRoleARN:  "arn:aws:iam::000000000000:role/cluster",
+		NodeRoleARN:     "arn:aws:iam::000000000000:role/node",
+		SubnetIDs:       []string{"subnet-1", "subnet-2"},
+		Endpoint:        endpoint,
+	}
+}
+
+func provisionRequest(requestID string, isManagementCluster bool) entities.ProvisionRequest {
+	request := providertest.ProvisionRequest(requestID, isManagementCluster)
+	request.NodeType = "m5.large"
+	return request
+}
+
+var _ = ginkgo.Describe("EKS infrastructure provider", func() {
+
+	var standIn *awsStandIn
+	var cluster *fakeCluster
+	var provider *EKSInfrastructureProvider
+
+	ginkgo.BeforeEach(func() {
+		standIn = newAWSStandIn(providertest.DNSZone)
+		cluster = newFakeCluster()
+		var err error
+		provider, err = NewEKSInfrastructureProviderWith(testCredentials(standIn.URL()), cluster.newCluster, time.Millisecond)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		standIn.Close()
+	})
+
+	ginkgo.It("provisions, scales and decommissions a management cluster", func() {
+		operation, err := provider.Provision(provisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("Test.Cluster.nalej.tech"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("mngt-test-cluster"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("get-token"))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.Ingress).ToNot(gomega.BeEmpty())
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.VPNServer).ToNot(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.HaveLen(4))
+		gomega.Expect(standIn.clusters["mngt-test-cluster"].nodeGroups["mngt-test-cluster-nodes"].desiredSize).To(gomega.Equal(int64(3)))
+		gomega.Expect(standIn.RecordNames()).To(gomega.ConsistOf(
+			"A test-cluster.nalej.tech.",
+			"A \\052.test-cluster.nalej.tech.",
+			"A dns.test-cluster.nalej.tech.",
+			"A vpn-server.test-cluster.nalej.tech.",
+			"A app-dns.test-cluster.nalej.tech.",
+			"NS ep.test-cluster.nalej.tech.",
+		))
+		providertest.ExpectCertificateIssued(cluster.CertManager, "test-cluster.nalej.tech", true)
+		gomega.Expect(cluster.KubeConfig).To(gomega.ContainSubstring("token: " + TokenPrefix))
+		gomega.Expect(cluster.KubeConfig).ToNot(gomega.ContainSubstring("get-token"))
+		gomega.Expect(cluster.region).To(gomega.Equal("eu-west-1"))
+		gomega.Expect(cluster.hostedZoneID).To(gomega.Equal("ZONE1"))
+		gomega.Expect(cluster.accessKeyID).To(gomega.Equal("access"))
+		gomega.Expect(cluster.secretAccessKey).To(gomega.Equal("secret"))
+		gomega.Expect(providertest.LogMessages(operation)).To(gomega.ContainElement(KubeConfigNotice))
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", true, 5))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.clusters["mngt-test-cluster"].nodeGroups["mngt-test-cluster-nodes"].desiredSize).To(gomega.Equal(int64(5)))
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(*result.KubeConfigResult).To(gomega.ContainSubstring("https://mngt-test-cluster.eks.amazonaws.com"))
+		gomega.Expect(providertest.LogMessages(operation)).To(gomega.ContainElement(KubeConfigNotice))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.clusters).To(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.BeEmpty())
+		gomega.Expect(standIn.RecordNames()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("skips the scaling of a node group with the requested size", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.addresses).To(gomega.HaveLen(1))
+		gomega.Expect(standIn.RecordNames()).To(gomega.HaveLen(2))
+		providertest.ExpectCertificateIssued(cluster.CertManager, "test-cluster.nalej.tech", false)
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", false, 3))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.Calls("UpdateNodegroupConfig")).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("rejects a cluster created by another request", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+
+		request := provisionRequest("other", false)
+		request.RollbackOnFailure = true
+		operation, err = provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("AlreadyExists"))
+		gomega.Expect(standIn.clusters).To(gomega.HaveKey("appcluster-Test.Cluster"))
+	})
+
+	ginkgo.It("rolls back a failed provisioning", func() {
+		standIn.fail["ChangeResourceRecordSets"] = true
+		request := provisionRequest("provision", true)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("cannot create DNS entries"))
+		gomega.Expect(standIn.clusters).To(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("resumes a failed provisioning reusing the created resources", func() {
+		standIn.fail["ChangeResourceRecordSets"] = true
+		operation, err := provider.Provision(provisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Error))
+		checkpoint := operation.(*ProvisionerOperation).Checkpoint()
+		gomega.Expect(checkpoint.Failed).To(gomega.Equal(CreateDNSEntriesStep))
+
+		standIn.fail["ChangeResourceRecordSets"] = false
+		resumed, err := provider.Provision(provisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(resumed.(*ProvisionerOperation).Resume(*checkpoint)).To(gomega.Succeed())
+		result := providertest.Execute(resumed)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.DNS).ToNot(gomega.BeEmpty())
+		gomega.Expect(standIn.Calls("CreateCluster")).To(gomega.Equal(1))
+		gomega.Expect(standIn.Calls("AllocateAddress")).To(gomega.Equal(4))
+		gomega.Expect(standIn.RecordNames()).To(gomega.HaveLen(6))
+	})
+
+	ginkgo.It("resumes a provisioning that failed to issue the certificate", func() {
+		provision := func() entities.InfrastructureOperation {
+			operation, err := provider.Provision(provisionRequest("provision", true))
+			gomega.Expect(err).To(gomega.Succeed())
+			return operation
+		}
+		result := providertest.ExpectResumeAfterCertificateFailure(cluster.CertManager, provision, RequestCertificateStep, "test-cluster.nalej.tech")
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("get-token"))
+		gomega.Expect(standIn.Calls("CreateCluster")).To(gomega.Equal(1))
+		gomega.Expect(standIn.Calls("ChangeResourceRecordSets")).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("connects with a token bound to the cluster and signed by the access key", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		config, cErr := clientcmd.Load([]byte(cluster.KubeConfig))
+		gomega.Expect(cErr).To(gomega.Succeed())
+		token := config.AuthInfos[config.Contexts[config.CurrentContext].AuthInfo].Token
+		gomega.Expect(token).To(gomega.HavePrefix(TokenPrefix))
+		presignedURL, dErr := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, TokenPrefix))
+		gomega.Expect(dErr).To(gomega.Succeed())
+		parsed, pErr := url.Parse(string(presignedURL))
+		gomega.Expect(pErr).To(gomega.Succeed())
+		gomega.Expect(parsed.Query().Get("Action")).To(gomega.Equal("GetCallerIdentity"))
+		gomega.Expect(parsed.Query().Get("X-Amz-Credential")).To(gomega.HavePrefix("access/"))
+		gomega.Expect(parsed.Query().Get("X-Amz-SignedHeaders")).To(gomega.ContainSubstring(ClusterIDHeader))
+	})
+
+	ginkgo.It("fails when the DNS zone is not hosted in the account", func() {
+		request := provisionRequest("provision", false)
+		request.DNSOptions.ZoneName = "unknown.tech"
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+	})
+
+	ginkgo.It("fails to decommission a missing cluster", func() {
+		operation, err := provider.Decommission(providertest.DecommissionRequest("decommission", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+	})
+
+	ginkgo.It("rejects requests without a DNS zone", func() {
+		request := provisionRequest("provision", false)
+		request.DNSOptions = nil
+		_, err := provider.Provision(request)
+		gomega.Expect(err).ToNot(gomega.Succeed())
+	})
+})
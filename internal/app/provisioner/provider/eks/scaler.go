@@ -0,0 +1,60 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// NewScalerOperation creates a new scaling operation changing the size of the node group of an EKS cluster.
+func NewScalerOperation(credentials *entities.AWSCredentials, awsSession *session.Session, waitDelay time.Duration, request entities.ScaleRequest) *managed.ScalerOperation {
+	eo := NewEKSOperation(request.RequestID, credentials, awsSession, waitDelay)
+	return managed.NewScalerOperation(eo.Operation, eo, ResourceName(request.IsManagementCluster, request.ClusterID), request)
+}
+
+// NodeCount returns the desired size of the node group of a cluster.
+func (eo *EKSOperation) NodeCount(ctx context.Context, resourceName string) (int64, derrors.Error) {
+	nodeGroup, err := eo.describeNodeGroup(ctx, resourceName)
+	if err != nil {
+		return 0, err
+	}
+	if nodeGroup.ScalingConfig == nil {
+		return 0, nil
+	}
+	return aws.Int64Value(nodeGroup.ScalingConfig.DesiredSize), nil
+}
+
+// ScaleNodes updates the size of the node group of a cluster and waits for the nodes to be available.
+func (eo *EKSOperation) ScaleNodes(ctx context.Context, resourceName string, numNodes int64) derrors.Error {
+	_, err := eo.eks.UpdateNodegroupConfigWithContext(ctx, &eks.UpdateNodegroupConfigInput{
+		ClusterName:   aws.String(resourceName),
+		NodegroupName: aws.String(nodeGroupName(resourceName)),
+		ScalingConfig: scalingConfig(numNodes),
+	})
+	if err != nil {
+		return convertError(err, "cannot scale node group").WithParams(resourceName)
+	}
+	return eo.waitNodeGroupActive(ctx, resourceName)
+}
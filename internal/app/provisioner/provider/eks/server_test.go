@@ -0,0 +1,450 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// standInCluster with the state of an EKS cluster on the stand-in.
+type standInCluster struct {
+	name       string
+	status     string
+	tags       map[string]string
+	nodeGroups map[string]*standInNodeGroup
+}
+
+// standInNodeGroup with the state of a node group on the stand-in.
+type standInNodeGroup struct {
+	status      string
+	desiredSize int64
+	instance    string
+}
+
+// standInAddress with an Elastic IP address of the stand-in.
+type standInAddress struct {
+	publicIP string
+	tags     map[string]string
+}
+
+// standInRecord with a record of a hosted zone of the stand-in.
+type standInRecord struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int64    `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+// changeBatchRequest with the body of the ChangeResourceRecordSets calls.
+type changeBatchRequest struct {
+	Changes []struct {
+		Action string        `xml:"Action"`
+		Record standInRecord `xml:"ResourceRecordSet"`
+	} `xml:"ChangeBatch>Changes>Change"`
+}
+
+// awsStandIn serving the subset of the EKS, EC2 and Route53 APIs used by the provider. Resources being created or
+// deleted change their state on the next describe call.
+type awsStandIn struct {
+	sync.Mutex
+	server    *httptest.Server
+	clusters  map[string]*standInCluster
+	addresses map[string]*standInAddress
+	zones     map[string]string
+	records   map[string]*standInRecord
+	// fail with the actions that return an error.
+	fail map[string]bool
+	// calls with the number of calls of each action.
+	calls  map[string]int
+	nextID int
+}
+
+func newAWSStandIn(zoneName string) *awsStandIn {
+	standIn := &awsStandIn{
+		clusters:  make(map[string]*standInCluster),
+		addresses: make(map[string]*standInAddress),
+		zones:     map[string]string{"ZONE1": zoneName + "."},
+		records:   make(map[string]*standInRecord),
+		fail:      make(map[string]bool),
+		calls:     make(map[string]int),
+	}
+	standIn.server = httptest.NewServer(http.HandlerFunc(standIn.handle))
+	return standIn
+}
+
+// URL returns the endpoint of the stand-in.
+func (s *awsStandIn) URL() string {
+	return s.server.URL
+}
+
+// Close stops the stand-in.
+func (s *awsStandIn) Close() {
+	s.server.Close()
+}
+
+// Calls returns the number of calls of an action.
+func (s *awsStandIn) Calls(action string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.calls[action]
+}
+
+// RecordNames returns the names of the records of the hosted zone.
+func (s *awsStandIn) RecordNames() []string {
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.records))
+	for _, record := range s.records {
+		names = append(names, fmt.Sprintf("%s %s", record.Type, record.Name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *awsStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/clusters"):
+		s.handleEKS(w, r)
+	case strings.HasPrefix(r.URL.Path, "/2013-04-01/"):
+		s.handleRoute53(w, r)
+	default:
+		s.handleEC2(w, r)
+	}
+}
+
+// call registers a call and checks if it must fail.
+func (s *awsStandIn) call(action string) bool {
+	s.calls[action]++
+	return s.fail[action]
+}
+
+func (s *awsStandIn) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *awsStandIn) eksError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("X-Amzn-Errortype", code+":")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (s *awsStandIn) eksReply(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *awsStandIn) clusterBody(cluster *standInCluster) map[string]interface{} {
+	return map[string]interface{}{"cluster": map[string]interface{}{
+		"name":     cluster.name,
+		"arn":      fmt.Sprintf("arn:aws:eks:eu-west-1:000000000000:cluster/%s", cluster.name),
+		"status":   cluster.status,
+		"endpoint": fmt.Sprintf("https://%s.eks.amazonaws.com", cluster.name),
+		"certificateAuthority": map[string]string{
+			"data": base64.StdEncoding.EncodeToString([]byte("test-ca")),
+		},
+		"tags": cluster.tags,
+	}}
+}
+
+func (s *awsStandIn) nodeGroupBody(cluster *standInCluster, name string, nodeGroup *standInNodeGroup) map[string]interface{} {
+	return map[string]interface{}{"nodegroup": map[string]interface{}{
+		"clusterName":   cluster.name,
+		"nodegroupName": name,
+		"status":        nodeGroup.status,
+		"instanceTypes": []string{nodeGroup.instance},
+		"scalingConfig": map[string]int64{
+			"minSize":     nodeGroup.desiredSize,
+			"maxSize":     nodeGroup.desiredSize,
+			"desiredSize": nodeGroup.desiredSize,
+		},
+	}}
+}
+
+func (s *awsStandIn) handleEKS(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	body := make(map[string]interface{})
+	if r.Method == http.MethodPost {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+	if len(parts) == 1 && r.Method == http.MethodPost {
+		if s.call("CreateCluster") {
+			s.eksError(w, http.StatusBadRequest, "InvalidParameterException", "CreateCluster failed")
+			return
+		}
+		name := body["name"].(string)
+		if _, exists := s.clusters[name]; exists {
+			s.eksError(w, http.StatusConflict, "ResourceInUseException", "cluster already exists")
+			return
+		}
+		tags := make(map[string]string)
+		if raw, ok := body["tags"].(map[string]interface{}); ok {
+			for key, value := range raw {
+				tags[key] = value.(string)
+			}
+		}
+		cluster := &standInCluster{name: name, status: "CREATING", tags: tags, nodeGroups: make(map[string]*standInNodeGroup)}
+		s.clusters[name] = cluster
+		s.eksReply(w, s.clusterBody(cluster))
+		return
+	}
+	cluster, exists := s.clusters[parts[1]]
+	if !exists {
+		s.eksError(w, http.StatusNotFound, "ResourceNotFoundException", "cluster not found")
+		return
+	}
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			s.calls["DescribeCluster"]++
+			switch cluster.status {
+			case "CREATING":
+				cluster.status = "ACTIVE"
+			case "DELETING":
+				delete(s.clusters, cluster.name)
+				s.eksError(w, http.StatusNotFound, "ResourceNotFoundException", "cluster not found")
+				return
+			}
+			s.eksReply(w, s.clusterBody(cluster))
+		case http.MethodDelete:
+			if s.call("DeleteCluster") {
+				s.eksError(w, http.StatusBadRequest, "InvalidRequestException", "DeleteCluster failed")
+				return
+			}
+			if len(cluster.nodeGroups) > 0 {
+				s.eksError(w, http.StatusConflict, "ResourceInUseException", "cluster has node groups")
+				return
+			}
+			cluster.status = "DELETING"
+			s.eksReply(w, s.clusterBody(cluster))
+		}
+		return
+	}
+	if len(parts) == 3 && r.Method == http.MethodPost {
+		if s.call("CreateNodegroup") {
+			s.eksError(w, http.StatusBadRequest, "InvalidParameterException", "CreateNodegroup failed")
+			return
+		}
+		name := body["nodegroupName"].(string)
+		if _, exists := cluster.nodeGroups[name]; exists {
+			s.eksError(w, http.StatusConflict, "ResourceInUseException", "node group already exists")
+			return
+		}
+		scaling := body["scalingConfig"].(map[string]interface{})
+		nodeGroup := &standInNodeGroup{
+			status:      "CREATING",
+			desiredSize: int64(scaling["desiredSize"].(float64)),
+			instance:    body["instanceTypes"].([]interface{})[0].(string),
+		}
+		cluster.nodeGroups[name] = nodeGroup
+		s.eksReply(w, s.nodeGroupBody(cluster, name, nodeGroup))
+		return
+	}
+	if len(parts) < 4 {
+		s.eksError(w, http.StatusBadRequest, "InvalidRequestException", "unsupported call")
+		return
+	}
+	name := parts[3]
+	nodeGroup, exists := cluster.nodeGroups[name]
+	if !exists {
+		s.eksError(w, http.StatusNotFound, "ResourceNotFoundException", "node group not found")
+		return
+	}
+	switch {
+	case len(parts) == 5 && parts[4] == "update-config":
+		if s.call("UpdateNodegroupConfig") {
+			s.eksError(w, http.StatusBadRequest, "InvalidParameterException", "UpdateNodegroupConfig failed")
+			return
+		}
+		scaling := body["scalingConfig"].(map[string]interface{})
+		nodeGroup.desiredSize = int64(scaling["desiredSize"].(float64))
+		nodeGroup.status = "UPDATING"
+		s.eksReply(w, map[string]interface{}{"update": map[string]string{"id": s.newID("update"), "status": "InProgress"}})
+	case r.Method == http.MethodGet:
+		switch nodeGroup.status {
+		case "CREATING", "UPDATING":
+			nodeGroup.status = "ACTIVE"
+		case "DELETING":
+			delete(cluster.nodeGroups, name)
+			s.eksError(w, http.StatusNotFound, "ResourceNotFoundException", "node group not found")
+			return
+		}
+		s.eksReply(w, s.nodeGroupBody(cluster, name, nodeGroup))
+	case r.Method == http.MethodDelete:
+		s.calls["DeleteNodegroup"]++
+		nodeGroup.status = "DELETING"
+		s.eksReply(w, s.nodeGroupBody(cluster, name, nodeGroup))
+	}
+}
+
+func (s *awsStandIn) ec2Error(w http.ResponseWriter, code string, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = fmt.Fprintf(w, "<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>req</RequestID></Response>", code, message)
+}
+
+func (s *awsStandIn) handleEC2(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	action := r.Form.Get("Action")
+	if s.call(action) {
+		s.ec2Error(w, "UnauthorizedOperation", action+" failed")
+		return
+	}
+	switch action {
+	case "AllocateAddress":
+		allocationID := s.newID("eipalloc")
+		address := &standInAddress{publicIP: fmt.Sprintf("52.0.0.%d", s.nextID), tags: make(map[string]string)}
+		s.addresses[allocationID] = address
+		_, _ = fmt.Fprintf(w, "<AllocateAddressResponse><requestId>req</requestId><publicIp>%s</publicIp><domain>vpc</domain><allocationId>%s</allocationId></AllocateAddressResponse>", address.publicIP, allocationID)
+	case "CreateTags":
+		address, exists := s.addresses[r.Form.Get("ResourceId.1")]
+		if !exists {
+			s.ec2Error(w, "InvalidAllocationID.NotFound", "address not found")
+			return
+		}
+		for index := 1; r.Form.Get(fmt.Sprintf("Tag.%d.Key", index)) != ""; index++ {
+			address.tags[r.Form.Get(fmt.Sprintf("Tag.%d.Key", index))] = r.Form.Get(fmt.Sprintf("Tag.%d.Value", index))
+		}
+		_, _ = fmt.Fprint(w, "<CreateTagsResponse><requestId>req</requestId><return>true</return></CreateTagsResponse>")
+	case "DescribeAddresses":
+		tagKey := strings.TrimPrefix(r.Form.Get("Filter.1.Name"), "tag:")
+		tagValue := r.Form.Get("Filter.1.Value.1")
+		items := ""
+		for allocationID, address := range s.addresses {
+			if address.tags[tagKey] != tagValue {
+				continue
+			}
+			tags := ""
+			for key, value := range address.tags {
+				tags += fmt.Sprintf("<item><key>%s</key><value>%s</value></item>", key, value)
+			}
+			items += fmt.Sprintf("<item><publicIp>%s</publicIp><allocationId>%s</allocationId><domain>vpc</domain><tagSet>%s</tagSet></item>", address.publicIP, allocationID, tags)
+		}
+		_, _ = fmt.Fprintf(w, "<DescribeAddressesResponse><requestId>req</requestId><addressesSet>%s</addressesSet></DescribeAddressesResponse>", items)
+	case "ReleaseAddress":
+		allocationID := r.Form.Get("AllocationId")
+		if _, exists := s.addresses[allocationID]; !exists {
+			s.ec2Error(w, "InvalidAllocationID.NotFound", "address not found")
+			return
+		}
+		delete(s.addresses, allocationID)
+		_, _ = fmt.Fprint(w, "<ReleaseAddressResponse><requestId>req</requestId><return>true</return></ReleaseAddressResponse>")
+	default:
+		s.ec2Error(w, "InvalidAction", "unsupported action "+action)
+	}
+}
+
+func (s *awsStandIn) route53Error(w http.ResponseWriter, code string, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>req</RequestId></ErrorResponse>", code, message)
+}
+
+// recordName returns the name of a record as stored by Route53.
+func recordName(name string) string {
+	name = strings.Replace(name, "*", "\\052", 1)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+func (s *awsStandIn) handleRoute53(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/2013-04-01/")
+	if path == "hostedzonesbyname" {
+		zones := ""
+		for id, name := range s.zones {
+			if name == recordName(r.URL.Query().Get("dnsname")) {
+				zones += fmt.Sprintf("<HostedZone><Id>/hostedzone/%s</Id><Name>%s</Name><CallerReference>ref</CallerReference></HostedZone>", id, name)
+			}
+		}
+		_, _ = fmt.Fprintf(w, "<ListHostedZonesByNameResponse><HostedZones>%s</HostedZones><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListHostedZonesByNameResponse>", zones)
+		return
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "hostedzone" || parts[2] != "rrset" {
+		s.route53Error(w, "InvalidInput", "unsupported call")
+		return
+	}
+	if _, exists := s.zones[parts[1]]; !exists {
+		s.route53Error(w, "NoSuchHostedZone", "hosted zone not found")
+		return
+	}
+	if r.Method == http.MethodGet {
+		key := recordName(r.URL.Query().Get("name")) + " " + r.URL.Query().Get("type")
+		keys := make([]string, 0, len(s.records))
+		for current := range s.records {
+			keys = append(keys, current)
+		}
+		sort.Strings(keys)
+		// Route53 returns the records following the requested one if it does not exist.
+		found := ""
+		for _, current := range keys {
+			if current >= key {
+				found = current
+				break
+			}
+		}
+		sets := ""
+		if found != "" {
+			record := s.records[found]
+			raw, _ := xml.Marshal(struct {
+				XMLName xml.Name `xml:"ResourceRecordSet"`
+				*standInRecord
+			}{standInRecord: record})
+			sets = string(raw)
+		}
+		_, _ = fmt.Fprintf(w, "<ListResourceRecordSetsResponse><ResourceRecordSets>%s</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListResourceRecordSetsResponse>", sets)
+		return
+	}
+	if s.call("ChangeResourceRecordSets") {
+		s.route53Error(w, "InvalidChangeBatch", "ChangeResourceRecordSets failed")
+		return
+	}
+	raw, _ := ioutil.ReadAll(r.Body)
+	batch := changeBatchRequest{}
+	if err := xml.Unmarshal(raw, &batch); err != nil {
+		s.route53Error(w, "InvalidInput", err.Error())
+		return
+	}
+	for _, change := range batch.Changes {
+		record := change.Record
+		record.Name = recordName(record.Name)
+		key := record.Name + " " + record.Type
+		switch change.Action {
+		case "UPSERT":
+			s.records[key] = &record
+		case "DELETE":
+			current, exists := s.records[key]
+			if !exists || strings.Join(current.Values, ",") != strings.Join(record.Values, ",") || current.TTL != record.TTL {
+				s.route53Error(w, "InvalidChangeBatch", "record not found")
+				return
+			}
+			delete(s.records, key)
+		}
+	}
+	_, _ = fmt.Fprint(w, "<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2020-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>")
+}
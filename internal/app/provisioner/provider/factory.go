@@ -18,21 +18,94 @@ package provider
 
 import (
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider/azure"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/baremetal"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/byoc"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/eks"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/gke"
 	"github.com/nalej/provisioner/internal/pkg/config"
+	pkgEntities "github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
 	"github.com/rs/zerolog/log"
 )
 
+// Credentials of the infrastructure provider, either embedded in the request or referenced through a credentials
+// profile managed by the provisioner.
+type Credentials struct {
+	// AzureCredentials embedded in the request.
+	AzureCredentials *grpc_provisioner_go.AzureCredentials
+	// ProfileID of the credentials profile referenced by the request, if any.
+	ProfileID string
+	// OrganizationID of the request, used to check that the organization may use the profile.
+	OrganizationID string
+	// Profile resolved from the ProfileID.
+	Profile *pkgEntities.CredentialsProfile
+}
+
 // NewInfrastructureProvider creates a new provider for a given target platform. Extra parameters are optional depending
-// on the type of provider to be created.
-func NewInfrastructureProvider(targetPlaform grpc_installer_go.Platform, azureCredentials *grpc_provisioner_go.AzureCredentials, config *config.Config) (entities.InfrastructureProvider, derrors.Error) {
+// on the type of provider to be created. Credentials profiles are resolved from the registry of profiles.
+func NewInfrastructureProvider(targetPlaform pkgEntities.Platform, credentials Credentials, config *config.Config) (entities.InfrastructureProvider, derrors.Error) {
+	if credentials.ProfileID != "" {
+		profile, err := profiles.GetRegistry().Resolve(credentials.ProfileID, targetPlaform.String(), credentials.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		credentials.AzureCredentials = profile.AzureCredentials
+		credentials.Profile = profile
+	}
 	switch targetPlaform {
-	case grpc_installer_go.Platform_AZURE:
-		return azure.NewAzureInfrastructureProvider(azureCredentials, config)
+	case pkgEntities.AzurePlatform:
+		if credentials.AzureCredentials == nil {
+			return nil, derrors.NewInvalidArgumentError("azure credentials are required")
+		}
+		return azure.NewAzureInfrastructureProvider(credentials.AzureCredentials, config)
+	case pkgEntities.BareMetalPlatform:
+		if config.BareMetalInventoryPath == "" {
+			return nil, derrors.NewFailedPreconditionError("bare-metal provider is not configured")
+		}
+		return baremetal.NewBareMetalInfrastructureProvider(config)
+	case byoc.Platform:
+		if credentials.Profile == nil {
+			return nil, derrors.NewInvalidArgumentError("a credentials profile is required to adopt a cluster")
+		}
+		return byoc.NewBYOCInfrastructureProvider(credentials.Profile, config)
+	case eks.Platform:
+		if credentials.Profile == nil {
+			return nil, derrors.NewInvalidArgumentError("a credentials profile is required to use AWS")
+		}
+		return eks.NewEKSInfrastructureProvider(credentials.Profile, config)
+	case gke.Platform:
+		if credentials.Profile == nil {
+			return nil, derrors.NewInvalidArgumentError("a credentials profile is required to use GCP")
+		}
+		return gke.NewGKEInfrastructureProvider(credentials.Profile, config)
+	case fake.Platform:
+		if !config.EnableFakeProvider {
+			return nil, derrors.NewFailedPreconditionError("fake provider is not enabled")
+		}
+		return fake.NewFakeInfrastructureProvider(config)
 	}
 	log.Debug().Str("targetPlatform", targetPlaform.String()).Msg("unsupported target platform for creating a provider")
 	return nil, derrors.NewUnimplementedError("unsupported target platform for creating a provider").WithParams(targetPlaform.String())
 }
+
+// ValidateProfile checks the credentials of a profile against its platform.
+func ValidateProfile(profile *pkgEntities.CredentialsProfile) derrors.Error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	switch pkgEntities.PlatformFromName(profile.Platform) {
+	case pkgEntities.AzurePlatform:
+		return azure.ValidateCredentials(profile.AzureCredentials)
+	case byoc.Platform:
+		return byoc.ValidateCredentials(profile)
+	case eks.Platform:
+		return eks.ValidateCredentials(profile.AWSCredentials)
+	case gke.Platform:
+		return gke.ValidateCredentials(profile.GCPCredentials)
+	}
+	return derrors.NewUnimplementedError("platform does not support validating credentials").WithParams(profile.Platform)
+}
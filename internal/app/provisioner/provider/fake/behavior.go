@@ -0,0 +1,132 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/config"
+)
+
+// AlwaysFail is the number of failures of a step that fails on every attempt.
+const AlwaysFail = 0
+
+// Behavior of the simulated infrastructure: how long the steps take and which ones fail.
+type Behavior struct {
+	// Latency of the steps that do not have a specific one.
+	Latency time.Duration
+	// StepLatencies with the latency of specific steps indexed by step name.
+	StepLatencies map[string]time.Duration
+	// Failures with the number of attempts of each step that fail before it succeeds, indexed by step name.
+	// AlwaysFail makes the step fail on every attempt.
+	Failures map[string]int
+}
+
+// NewBehavior creates a behavior where steps take no time and never fail.
+func NewBehavior() *Behavior {
+	return &Behavior{
+		StepLatencies: make(map[string]time.Duration, 0),
+		Failures:      make(map[string]int, 0),
+	}
+}
+
+// NewBehaviorFromConfig creates the behavior described by the fake provider options of the configuration.
+// Step latencies are expressed as step=duration and failures as step or step=attempts.
+func NewBehaviorFromConfig(config *config.Config) (*Behavior, derrors.Error) {
+	behavior := NewBehavior()
+	behavior.Latency = config.FakeStepLatency
+	for _, spec := range config.FakeStepLatencies {
+		step, value, err := splitSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		latency, parseErr := time.ParseDuration(value)
+		if parseErr != nil || latency < 0 {
+			return nil, derrors.NewInvalidArgumentError("invalid fake step latency").WithParams(spec)
+		}
+		behavior.StepLatencies[step] = latency
+	}
+	for _, spec := range config.FakeFailSteps {
+		step, value, err := splitSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		attempts := AlwaysFail
+		if value != "" {
+			parsed, parseErr := strconv.Atoi(value)
+			if parseErr != nil || parsed <= 0 {
+				return nil, derrors.NewInvalidArgumentError("invalid number of fake step failures").WithParams(spec)
+			}
+			attempts = parsed
+		}
+		behavior.Failures[step] = attempts
+	}
+	return behavior, nil
+}
+
+// splitSpec splits a step=value specification. The value is empty if the specification only names the step.
+func splitSpec(spec string) (string, string, derrors.Error) {
+	parts := strings.SplitN(spec, "=", 2)
+	step := strings.TrimSpace(parts[0])
+	if step == "" {
+		return "", "", derrors.NewInvalidArgumentError("fake step specification must name a step").WithParams(spec)
+	}
+	if len(parts) == 1 {
+		return step, "", nil
+	}
+	return step, strings.TrimSpace(parts[1]), nil
+}
+
+// StepLatency returns the time a step takes.
+func (b *Behavior) StepLatency(step string) time.Duration {
+	if latency, exists := b.StepLatencies[step]; exists {
+		return latency
+	}
+	return b.Latency
+}
+
+// ShouldFail checks if a step must fail on a given attempt, starting at 1.
+func (b *Behavior) ShouldFail(step string, attempt int) bool {
+	failures, exists := b.Failures[step]
+	if !exists {
+		return false
+	}
+	return failures == AlwaysFail || attempt <= failures
+}
+
+// Simulate waits for the latency of a step and returns the injected failure, if any. The wait is interrupted
+// when the context is cancelled.
+func (b *Behavior) Simulate(ctx context.Context, step string, attempt int) derrors.Error {
+	latency := b.StepLatency(step)
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return derrors.NewCanceledError("simulated step interrupted", ctx.Err()).WithParams(step)
+		case <-timer.C:
+		}
+	}
+	if b.ShouldFail(step, attempt) {
+		return derrors.NewInternalError("injected failure").WithParams(step, attempt)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// DeleteClusterStep with the name of the step of a decommission operation.
+const DeleteClusterStep = "delete-cluster"
+
+// DecommissionerOperation simulating the decommission of an existing cluster.
+type DecommissionerOperation struct {
+	*FakeOperation
+	request entities.DecommissionRequest
+}
+
+// NewDecommissionerOperation creates a new fake decommission operation.
+func NewDecommissionerOperation(inventory *Inventory, behavior *Behavior, request entities.DecommissionRequest) *DecommissionerOperation {
+	do := &DecommissionerOperation{
+		FakeOperation: NewFakeOperation(request.RequestID, inventory, behavior),
+		request:       request,
+	}
+	do.SetSteps(do.newStep(DeleteClusterStep, do.deleteClusterStep))
+	return do
+}
+
+// RequestID returns the request identifier associated with this operation
+func (do *DecommissionerOperation) RequestID() string {
+	return do.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (do *DecommissionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      do.request.OrganizationID,
+		ClusterID:           do.request.ClusterID,
+		RequestID:           do.request.RequestID,
+		IsManagementCluster: do.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (do *DecommissionerOperation) Request() interface{} {
+	return do.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (do *DecommissionerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", do.request.OrganizationID).Str("clusterID", do.request.ClusterID).Msg("executing fake decommission operation")
+	ctx = do.Start(ctx)
+	defer do.Finish()
+
+	if err := do.RunSteps(ctx); err != nil {
+		do.SetFailure(ctx, err)
+		callback(do.request.RequestID)
+		return
+	}
+	do.Succeed()
+	callback(do.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (do *DecommissionerOperation) Result() entities.OperationResult {
+	return do.OperationResult(entities.Decommission)
+}
+
+// deleteClusterStep removes the cluster from the inventory.
+func (do *DecommissionerOperation) deleteClusterStep(_ context.Context) derrors.Error {
+	if err := do.inventory.Remove(do.request.OrganizationID, do.request.ClusterID); err != nil {
+		return err
+	}
+	do.AddToLog("fake cluster has been deleted")
+	return nil
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Cluster simulated by the fake provider.
+type Cluster struct {
+	// OrganizationID owning the cluster.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID with the cluster identifier.
+	ClusterID string `json:"cluster_id"`
+	// ClusterName with the name given to the cluster on its creation.
+	ClusterName string `json:"cluster_name"`
+	// RequestID of the provisioning operation that created the cluster.
+	RequestID string `json:"request_id"`
+	// IsManagementCluster determines if the cluster is a management or application cluster.
+	IsManagementCluster bool `json:"is_management_cluster"`
+	// KubernetesVersion installed on the cluster.
+	KubernetesVersion string `json:"kubernetes_version"`
+	// NumNodes with the number of nodes of the cluster.
+	NumNodes int64 `json:"num_nodes"`
+	// NodeType with the type of the nodes.
+	NodeType string `json:"node_type"`
+	// Zone where the cluster is located.
+	Zone string `json:"zone"`
+	// Hostname of the cluster.
+	Hostname string `json:"hostname"`
+	// KubeConfig to access the cluster.
+	KubeConfig string `json:"kube_config"`
+	// StaticIPAddresses reserved for the cluster.
+	StaticIPAddresses entities.StaticIPAddresses `json:"static_ip_addresses"`
+	// Created with the creation timestamp.
+	Created int64 `json:"created"`
+	// Updated with the timestamp of the last change.
+	Updated int64 `json:"updated"`
+}
+
+// Key returns the key identifying the cluster in the inventory.
+func (c *Cluster) Key() string {
+	return ClusterKey(c.OrganizationID, c.ClusterID)
+}
+
+// ClusterKey returns the key identifying a cluster of an organization in the inventory.
+func ClusterKey(organizationID string, clusterID string) string {
+	return fmt.Sprintf("%s/%s", organizationID, clusterID)
+}
+
+// Inventory with the clusters created by the fake provider. The inventory is persisted in a file so that the
+// clusters survive restarts of the provisioner.
+type Inventory struct {
+	sync.Mutex
+	clusters map[string]*Cluster
+	// path of the file where the inventory is persisted. If empty, the inventory is only kept in memory.
+	path string
+}
+
+var inventories = make(map[string]*Inventory, 0)
+var inventoriesLock sync.Mutex
+
+// GetInventory returns the inventory shared by the fake providers persisting it in a given file. An empty path
+// returns the in-memory inventory.
+func GetInventory(path string) (*Inventory, derrors.Error) {
+	inventoriesLock.Lock()
+	defer inventoriesLock.Unlock()
+	if path != "" {
+		path = filepath.Clean(path)
+	}
+	if inventory, exists := inventories[path]; exists {
+		return inventory, nil
+	}
+	inventory, err := NewInventory(path)
+	if err != nil {
+		return nil, err
+	}
+	inventories[path] = inventory
+	return inventory, nil
+}
+
+// NewInventory creates an inventory loading the clusters persisted in a given file, if it exists.
+func NewInventory(path string) (*Inventory, derrors.Error) {
+	inventory := &Inventory{
+		clusters: make(map[string]*Cluster, 0),
+		path:     path,
+	}
+	if path == "" {
+		return inventory, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return inventory, nil
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read fake cluster inventory")
+	}
+	clusters := make([]*Cluster, 0)
+	if err := json.Unmarshal(raw, &clusters); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot decode fake cluster inventory", err).WithParams(path)
+	}
+	for _, cluster := range clusters {
+		inventory.clusters[cluster.Key()] = cluster
+	}
+	return inventory, nil
+}
+
+// Add registers a new cluster. An AlreadyExists error is returned if the organization already has a cluster
+// with the same identifier.
+func (i *Inventory) Add(cluster Cluster) derrors.Error {
+	i.Lock()
+	defer i.Unlock()
+	if _, exists := i.clusters[cluster.Key()]; exists {
+		return derrors.NewAlreadyExistsError("cluster already exists").WithParams(cluster.OrganizationID, cluster.ClusterID)
+	}
+	i.clusters[cluster.Key()] = &cluster
+	if err := i.save(); err != nil {
+		delete(i.clusters, cluster.Key())
+		return err
+	}
+	return nil
+}
+
+// Get returns a copy of a cluster.
+func (i *Inventory) Get(organizationID string, clusterID string) (*Cluster, derrors.Error) {
+	i.Lock()
+	defer i.Unlock()
+	cluster, exists := i.clusters[ClusterKey(organizationID, clusterID)]
+	if !exists {
+		return nil, derrors.NewNotFoundError("cluster not found").WithParams(organizationID, clusterID)
+	}
+	result := *cluster
+	return &result, nil
+}
+
+// Update replaces the content of an existing cluster.
+func (i *Inventory) Update(cluster Cluster) derrors.Error {
+	i.Lock()
+	defer i.Unlock()
+	previous, exists := i.clusters[cluster.Key()]
+	if !exists {
+		return derrors.NewNotFoundError("cluster not found").WithParams(cluster.OrganizationID, cluster.ClusterID)
+	}
+	i.clusters[cluster.Key()] = &cluster
+	if err := i.save(); err != nil {
+		i.clusters[cluster.Key()] = previous
+		return err
+	}
+	return nil
+}
+
+// Remove deletes a cluster.
+func (i *Inventory) Remove(organizationID string, clusterID string) derrors.Error {
+	i.Lock()
+	defer i.Unlock()
+	key := ClusterKey(organizationID, clusterID)
+	previous, exists := i.clusters[key]
+	if !exists {
+		return derrors.NewNotFoundError("cluster not found").WithParams(organizationID, clusterID)
+	}
+	delete(i.clusters, key)
+	if err := i.save(); err != nil {
+		i.clusters[key] = previous
+		return err
+	}
+	return nil
+}
+
+// List returns a copy of the clusters sorted by key.
+func (i *Inventory) List() []Cluster {
+	i.Lock()
+	defer i.Unlock()
+	return i.sorted()
+}
+
+// sorted returns a copy of the clusters sorted by key. The caller is expected to hold the lock.
+func (i *Inventory) sorted() []Cluster {
+	result := make([]Cluster, 0, len(i.clusters))
+	for _, cluster := range i.clusters {
+		result = append(result, *cluster)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Key() < result[b].Key()
+	})
+	return result
+}
+
+// save writes the inventory to its file replacing the previous content atomically. The caller is expected to
+// hold the lock.
+func (i *Inventory) save() derrors.Error {
+	if i.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(i.sorted(), "", "  ")
+	if err != nil {
+		return derrors.AsError(err, "cannot encode fake cluster inventory")
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(i.path), "."+filepath.Base(i.path))
+	if err != nil {
+		return derrors.AsError(err, "cannot create fake cluster inventory file")
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(raw); err != nil {
+		_ = temp.Close()
+		return derrors.AsError(err, "cannot write fake cluster inventory")
+	}
+	if err := temp.Close(); err != nil {
+		return derrors.AsError(err, "cannot close fake cluster inventory")
+	}
+	if err := os.Rename(temp.Name(), i.path); err != nil {
+		return derrors.AsError(err, "cannot replace fake cluster inventory")
+	}
+	return nil
+}
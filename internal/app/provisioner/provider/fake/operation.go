@@ -0,0 +1,72 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+)
+
+// CompensationSuffix is appended to the name of a step to configure the latency and failures of its compensation.
+const CompensationSuffix = ":rollback"
+
+// FakeOperation structure with the common functions shared among the fake operations. The steps simulate the
+// latency and failures set in the behavior before changing the inventory.
+type FakeOperation struct {
+	*base.Operation
+	inventory *Inventory
+	behavior  *Behavior
+	// attempts with the number of times each step has been executed, used for the failure injection.
+	attempts map[string]int
+}
+
+// NewFakeOperation creates a FakeOperation on a given inventory.
+func NewFakeOperation(requestID string, inventory *Inventory, behavior *Behavior) *FakeOperation {
+	return &FakeOperation{
+		Operation: base.NewOperation(requestID),
+		inventory: inventory,
+		behavior:  behavior,
+		attempts:  make(map[string]int, 0),
+	}
+}
+
+// newStep creates a step that simulates the latency and failures configured for it before being performed.
+func (fo *FakeOperation) newStep(name string, run func(ctx context.Context) derrors.Error) workflow.Step {
+	return workflow.NewStep(name, fo.simulated(name, run))
+}
+
+// newCompensableStep creates a step that can be undone. Both the step and its compensation are simulated.
+func (fo *FakeOperation) newCompensableStep(name string, run func(ctx context.Context) derrors.Error, compensate func(ctx context.Context) derrors.Error) workflow.Step {
+	return workflow.NewCompensableStep(name, fo.simulated(name, run), fo.simulated(name+CompensationSuffix, compensate))
+}
+
+// simulated wraps a function so that it is preceded by the simulation of a step.
+func (fo *FakeOperation) simulated(name string, run func(ctx context.Context) derrors.Error) func(ctx context.Context) derrors.Error {
+	return func(ctx context.Context) derrors.Error {
+		fo.Lock()
+		fo.attempts[name]++
+		attempt := fo.attempts[name]
+		fo.Unlock()
+		if err := fo.behavior.Simulate(ctx, name, attempt); err != nil {
+			return err
+		}
+		return run(ctx)
+	}
+}
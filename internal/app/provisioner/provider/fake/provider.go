@@ -0,0 +1,77 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fake contains an infrastructure provider that simulates the clusters in an inventory instead of creating
+// them, so that the layers above the providers can be exercised without a cloud subscription.
+package fake
+
+import (
+	"github.com/nalej/derrors"
+	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Platform is the target platform value selecting the fake provider.
+const Platform = entities.FakePlatform
+
+// PlatformName with the name used to select the fake provider on the CLI.
+const PlatformName = entities.FakePlatformName
+
+// FakeInfrastructureProvider simulating the operations on an inventory of clusters.
+type FakeInfrastructureProvider struct {
+	inventory *Inventory
+	behavior  *Behavior
+}
+
+// NewFakeInfrastructureProvider creates a fake provider using the shared inventory and the behavior defined in
+// the configuration.
+func NewFakeInfrastructureProvider(config *config.Config) (providerEntities.InfrastructureProvider, derrors.Error) {
+	behavior, err := NewBehaviorFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := GetInventory(config.FakeInventoryPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewFakeInfrastructureProviderWith(inventory, behavior), nil
+}
+
+// NewFakeInfrastructureProviderWith creates a fake provider on a given inventory.
+func NewFakeInfrastructureProviderWith(inventory *Inventory, behavior *Behavior) *FakeInfrastructureProvider {
+	return &FakeInfrastructureProvider{inventory: inventory, behavior: behavior}
+}
+
+// Provision a cluster creates a InfrastructureOperation to provision a new cluster.
+func (fip *FakeInfrastructureProvider) Provision(request entities.ProvisionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewProvisionerOperation(fip.inventory, fip.behavior, request), nil
+}
+
+// Decommission a cluster creates a InfrastructureOperation to decommission a cluster.
+func (fip *FakeInfrastructureProvider) Decommission(request entities.DecommissionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewDecommissionerOperation(fip.inventory, fip.behavior, request), nil
+}
+
+// Scale a cluster creates a InfrastructureOperation to scale a cluster.
+func (fip *FakeInfrastructureProvider) Scale(request entities.ScaleRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewScalerOperation(fip.inventory, fip.behavior, request), nil
+}
+
+// GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
+func (fip *FakeInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewManagementOperation(fip.inventory, fip.behavior, request, entities.GetKubeConfig), nil
+}
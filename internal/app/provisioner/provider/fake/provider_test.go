@@ -0,0 +1,221 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Fake infrastructure provider", func() {
+
+	var tempDir string
+	var inventory *Inventory
+	var behavior *Behavior
+	var provider *FakeInfrastructureProvider
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "fake")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+		inv, iErr := NewInventory(filepath.Join(tempDir, "inventory.json"))
+		gomega.Expect(iErr).To(gomega.Succeed())
+		inventory = inv
+		behavior = NewBehavior()
+		provider = NewFakeInfrastructureProviderWith(inventory, behavior)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	ginkgo.It("simulates the lifecycle of a cluster", func() {
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("Test.Cluster." + DNSZone))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("server: https://Test.Cluster." + DNSZone))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.VPNServer).NotTo(gomega.BeEmpty())
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", true, 5))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		cluster, err := inventory.Get(providertest.OrganizationID, providertest.ClusterID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cluster.NumNodes).To(gomega.Equal(int64(5)))
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(*result.KubeConfigResult).To(gomega.Equal(cluster.KubeConfig))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(inventory.List()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("persists the inventory", func() {
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+
+		reloaded, err := NewInventory(filepath.Join(tempDir, "inventory.json"))
+		gomega.Expect(err).To(gomega.Succeed())
+		clusters := reloaded.List()
+		gomega.Expect(clusters).To(gomega.HaveLen(1))
+		gomega.Expect(clusters[0].RequestID).To(gomega.Equal("provision"))
+		gomega.Expect(clusters[0].KubeConfig).NotTo(gomega.BeEmpty())
+	})
+
+	ginkgo.It("rejects operations on unknown or existing clusters", func() {
+		operation, err := provider.Scale(entities.ScaleRequest{RequestID: "scale", OrganizationID: providertest.OrganizationID, ClusterID: "missing", NumNodes: 5})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Error))
+
+		operation, err = provider.Provision(providertest.ProvisionRequest("first", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		operation, err = provider.Provision(providertest.ProvisionRequest("second", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("already exists"))
+	})
+
+	ginkgo.It("resumes an operation from the step where a failure was injected", func() {
+		behavior.Failures[CreateDNSEntriesStep] = 1
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("injected failure"))
+
+		resumable := operation.(entities.ResumableOperation)
+		checkpoint := resumable.Checkpoint()
+		gomega.Expect(checkpoint.Failed).To(gomega.Equal(CreateDNSEntriesStep))
+		gomega.Expect(resumable.Resume(*checkpoint)).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(operation.(*ProvisionerOperation).attempts[CreateClusterStep]).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("retrieves the kubeconfig again when resuming from a persisted checkpoint", func() {
+		behavior.Failures[CreateDNSEntriesStep] = 1
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Error))
+		record := entities.NewOperationRecord(operation)
+		gomega.Expect(record.Checkpoint.Outputs).NotTo(gomega.HaveKey(KubeConfigOutput))
+		gomega.Expect(record.Result.ProvisionResult.RawKubeConfig).To(gomega.BeEmpty())
+
+		// The operation is created again as it is done after a restart of the provisioner.
+		delete(behavior.Failures, CreateDNSEntriesStep)
+		recreated, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(recreated.(entities.ResumableOperation).Resume(*record.Checkpoint)).To(gomega.Succeed())
+		result := providertest.Execute(recreated)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("server: https://Test.Cluster." + DNSZone))
+		gomega.Expect(recreated.(*ProvisionerOperation).attempts[CreateClusterStep]).To(gomega.Equal(0))
+		gomega.Expect(recreated.(*ProvisionerOperation).attempts[RetrieveKubeConfigStep]).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("removes the cluster when a failed provisioning is rolled back", func() {
+		behavior.Failures[CreateDNSEntriesStep] = AlwaysFail
+		request := providertest.ProvisionRequest("provision", true)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.Rollback).To(gomega.HaveLen(2))
+		gomega.Expect(inventory.List()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("does not roll back the operations interrupted by a shutdown", func() {
+		behavior.StepLatencies[ReserveIPAddressesStep] = 200 * time.Millisecond
+		request := providertest.ProvisionRequest("provision", true)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		executor := workflow.NewExecutor(store.NewMemoryOperationStore())
+		gomega.Expect(executor.ScheduleOperation(operation)).To(gomega.BeNil())
+		gomega.Eventually(inventory.List).Should(gomega.HaveLen(1))
+		gomega.Expect(executor.Shutdown(0)).To(gomega.Equal(1))
+
+		// The running step finishes and the following ones are not started.
+		resumable := operation.(entities.ResumableOperation)
+		gomega.Eventually(func() []string {
+			return resumable.Checkpoint().Completed
+		}).Should(gomega.ContainElement(ReserveIPAddressesStep))
+		gomega.Consistently(inventory.List, 300*time.Millisecond).Should(gomega.HaveLen(1))
+		checkpoint := resumable.Checkpoint()
+		gomega.Expect(checkpoint.Completed).NotTo(gomega.ContainElement(CreateDNSEntriesStep))
+		gomega.Expect(checkpoint.Failed).To(gomega.BeEmpty())
+		result := operation.Result()
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Interrupted))
+		gomega.Expect(result.Rollback).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("stops the simulated latency when the operation is cancelled", func() {
+		behavior.Latency = time.Minute
+		operation, err := provider.Provision(providertest.ProvisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		done := make(chan bool, 1)
+		go func() {
+			providertest.Execute(operation)
+			done <- true
+		}()
+		gomega.Eventually(operation.Progress).Should(gomega.Equal(entities.InProgress))
+		gomega.Expect(operation.Cancel()).To(gomega.Succeed())
+		gomega.Eventually(done).Should(gomega.Receive())
+		gomega.Expect(operation.Progress()).To(gomega.Equal(entities.Cancelled))
+	})
+
+	ginkgo.It("parses the behavior from the configuration", func() {
+		loaded, err := NewBehaviorFromConfig(&config.Config{
+			FakeStepLatency:   time.Second,
+			FakeStepLatencies: []string{"create-cluster=1m"},
+			FakeFailSteps:     []string{"create-dns-entries", "scale-cluster=2"},
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(loaded.StepLatency(CreateClusterStep)).To(gomega.Equal(time.Minute))
+		gomega.Expect(loaded.StepLatency(ScaleClusterStep)).To(gomega.Equal(time.Second))
+		gomega.Expect(loaded.ShouldFail(CreateDNSEntriesStep, 10)).To(gomega.BeTrue())
+		gomega.Expect(loaded.ShouldFail(ScaleClusterStep, 2)).To(gomega.BeTrue())
+		gomega.Expect(loaded.ShouldFail(ScaleClusterStep, 3)).To(gomega.BeFalse())
+
+		_, err = NewBehaviorFromConfig(&config.Config{FakeStepLatencies: []string{"create-cluster=soon"}})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.InvalidArgument))
+		_, err = NewBehaviorFromConfig(&config.Config{FakeFailSteps: []string{"=1"}})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
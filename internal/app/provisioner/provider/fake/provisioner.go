@@ -0,0 +1,279 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// DNSZone with the zone where the hostnames of the fake clusters are created.
+const DNSZone = "fake.nalej.local"
+
+// Names of the steps of a provisioning operation.
+const (
+	CreateClusterStep      = "create-cluster"
+	RetrieveKubeConfigStep = "retrieve-kubeconfig"
+	ReserveIPAddressesStep = "reserve-ip-addresses"
+	CreateDNSEntriesStep   = "create-dns-entries"
+)
+
+// Names of the outputs produced by the provisioning steps.
+const (
+	KubeConfigOutput = "kubeConfig"
+	// IPAddressOutputPrefix is prepended to the name of each reserved IP address.
+	IPAddressOutputPrefix = "ip."
+)
+
+// ProvisionerOperation simulating the provisioning of a new cluster.
+type ProvisionerOperation struct {
+	*FakeOperation
+	request entities.ProvisionRequest
+	result  *entities.ProvisionResult
+}
+
+// NewProvisionerOperation creates a new fake provisioning operation.
+func NewProvisionerOperation(inventory *Inventory, behavior *Behavior, request entities.ProvisionRequest) *ProvisionerOperation {
+	po := &ProvisionerOperation{
+		FakeOperation: NewFakeOperation(request.RequestID, inventory, behavior),
+		request:       request,
+		result: &entities.ProvisionResult{
+			ClusterName: request.ClusterName,
+			Hostname:    fmt.Sprintf("%s.%s", request.ClusterName, DNSZone),
+		},
+	}
+	po.SetSteps(
+		po.newCompensableStep(CreateClusterStep, po.createClusterStep, po.deleteClusterStep),
+		po.newStep(RetrieveKubeConfigStep, po.retrieveKubeConfigStep),
+		po.newCompensableStep(ReserveIPAddressesStep, po.reserveIPAddressesStep, po.releaseIPAddressesStep),
+		po.newStep(CreateDNSEntriesStep, po.createDNSEntriesStep),
+	)
+	return po
+}
+
+// RequestID returns the request identifier associated with this operation
+func (po *ProvisionerOperation) RequestID() string {
+	return po.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (po *ProvisionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (po *ProvisionerOperation) Request() interface{} {
+	return po.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (po *ProvisionerOperation) Execute(ctx context.Context, callback func(requestId string)) {
+	log.Debug().Str("organizationID", po.request.OrganizationID).Str("clusterID", po.request.ClusterID).Msg("executing fake provisioning operation")
+	ctx = po.Start(ctx)
+	defer po.Finish()
+
+	err := po.RunSteps(ctx)
+	if err != nil {
+		if po.request.RollbackOnFailure {
+			po.RollbackSteps()
+		}
+		po.SetFailure(ctx, err)
+		callback(po.request.RequestID)
+		return
+	}
+	po.Succeed()
+	callback(po.request.RequestID)
+}
+
+// Checkpoint returns the state of the steps of the operation.
+func (po *ProvisionerOperation) Checkpoint() *entities.StepCheckpoint {
+	return po.Pipeline().Checkpoint()
+}
+
+// Resume prepares the operation to be executed again from the step that failed. The outputs of the completed
+// steps are used to rebuild the result of the operation.
+func (po *ProvisionerOperation) Resume(checkpoint entities.StepCheckpoint) derrors.Error {
+	if _, exists := checkpoint.Outputs[KubeConfigOutput]; !exists {
+		// The kubeconfig is not persisted, so the operations restored after a restart retrieve it again.
+		checkpoint.Invalidate(RetrieveKubeConfigStep)
+	}
+	if err := po.RestoreCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	for key, value := range checkpoint.Outputs {
+		if key == KubeConfigOutput {
+			po.result.RawKubeConfig = value
+		} else if strings.HasPrefix(key, IPAddressOutputPrefix) {
+			po.result.SetIPAddress(strings.TrimPrefix(key, IPAddressOutputPrefix), value)
+		}
+	}
+	return nil
+}
+
+// Result returns the operation result if this operation is successful
+func (po *ProvisionerOperation) Result() entities.OperationResult {
+	result := po.OperationResult(entities.Provision)
+	result.ProvisionResult = po.result
+	return result
+}
+
+// createClusterStep adds the cluster to the inventory. The step is idempotent for the request that created the
+// cluster so that a resumed operation can execute it again.
+func (po *ProvisionerOperation) createClusterStep(_ context.Context) derrors.Error {
+	existing, err := po.inventory.Get(po.request.OrganizationID, po.request.ClusterID)
+	if err == nil {
+		if existing.RequestID == po.request.RequestID {
+			return nil
+		}
+		return derrors.NewAlreadyExistsError("cluster already exists").WithParams(po.request.OrganizationID, po.request.ClusterID)
+	}
+	now := time.Now().Unix()
+	err = po.inventory.Add(Cluster{
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
+		KubernetesVersion:   po.request.KubernetesVersion,
+		NumNodes:            po.request.NumNodes,
+		NodeType:            po.request.NodeType,
+		Zone:                po.request.Zone,
+		Hostname:            po.result.Hostname,
+		Created:             now,
+		Updated:             now,
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog(fmt.Sprintf("fake cluster %s has been created with %d nodes", po.request.ClusterName, po.request.NumNodes))
+	return nil
+}
+
+// deleteClusterStep removes the cluster from the inventory.
+func (po *ProvisionerOperation) deleteClusterStep(_ context.Context) derrors.Error {
+	po.AddToLog("Deleting cluster")
+	err := po.inventory.Remove(po.request.OrganizationID, po.request.ClusterID)
+	if err != nil && err.Type() != derrors.NotFound {
+		return err
+	}
+	return nil
+}
+
+// retrieveKubeConfigStep generates the kubeconfig of the cluster.
+func (po *ProvisionerOperation) retrieveKubeConfigStep(_ context.Context) derrors.Error {
+	kubeConfig := KubeConfig(po.request.ClusterName, po.result.Hostname)
+	if err := po.updateCluster(func(cluster *Cluster) { cluster.KubeConfig = kubeConfig }); err != nil {
+		return err
+	}
+	po.result.RawKubeConfig = kubeConfig
+	po.Pipeline().SetOutput(KubeConfigOutput, kubeConfig)
+	return nil
+}
+
+// reserveIPAddressesStep assigns the public IP addresses of the cluster.
+func (po *ProvisionerOperation) reserveIPAddressesStep(_ context.Context) derrors.Error {
+	for index, addressName := range po.ipAddressNames() {
+		address := IPAddress(ClusterKey(po.request.OrganizationID, po.request.ClusterID), index)
+		po.result.SetIPAddress(addressName, address)
+		po.Pipeline().SetOutput(IPAddressOutputPrefix+addressName, address)
+	}
+	addresses := po.result.StaticIPAddresses
+	if err := po.updateCluster(func(cluster *Cluster) { cluster.StaticIPAddresses = addresses }); err != nil {
+		return err
+	}
+	po.AddToLog("IP address have been reserved")
+	return nil
+}
+
+// releaseIPAddressesStep releases the public IP addresses of the cluster.
+func (po *ProvisionerOperation) releaseIPAddressesStep(_ context.Context) derrors.Error {
+	po.result.StaticIPAddresses = entities.StaticIPAddresses{}
+	err := po.updateCluster(func(cluster *Cluster) { cluster.StaticIPAddresses = entities.StaticIPAddresses{} })
+	if err != nil && err.Type() != derrors.NotFound {
+		return err
+	}
+	return nil
+}
+
+// createDNSEntriesStep simulates the creation of the DNS entries of the cluster.
+func (po *ProvisionerOperation) createDNSEntriesStep(_ context.Context) derrors.Error {
+	po.AddToLog(fmt.Sprintf("DNS entries have been defined for %s", po.result.Hostname))
+	return nil
+}
+
+// ipAddressNames returns the names of the addresses reserved for the cluster.
+func (po *ProvisionerOperation) ipAddressNames() []string {
+	if po.request.IsManagementCluster {
+		return []string{entities.IngressIPAddressName, entities.DNSPublicIPAddress, entities.CoreDNSPublicIPAddress, entities.VPNServerPublicIPAddress}
+	}
+	return []string{entities.IngressIPAddressName}
+}
+
+// updateCluster modifies the cluster created by the operation.
+func (po *ProvisionerOperation) updateCluster(modify func(cluster *Cluster)) derrors.Error {
+	cluster, err := po.inventory.Get(po.request.OrganizationID, po.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	modify(cluster)
+	cluster.Updated = time.Now().Unix()
+	return po.inventory.Update(*cluster)
+}
+
+// IPAddress returns a deterministic address of the benchmarking range 198.18.0.0/15 for a cluster.
+func IPAddress(clusterKey string, index int) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(clusterKey))
+	value := hash.Sum32()
+	return fmt.Sprintf("198.%d.%d.%d", 18+(value>>16)%2, (value>>8)&0xff, (int(value&0xff)+index)%254+1)
+}
+
+// KubeConfig returns the kubeconfig of a fake cluster.
+func KubeConfig(clusterName string, hostname string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://%[2]s:443
+    insecure-skip-tls-verify: true
+  name: %[1]s
+contexts:
+- context:
+    cluster: %[1]s
+    user: %[1]s-admin
+  name: %[1]s
+current-context: %[1]s
+users:
+- name: %[1]s-admin
+  user:
+    token: fake-token
+`, clusterName, hostname)
+}
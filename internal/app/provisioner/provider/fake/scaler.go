@@ -0,0 +1,106 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// ScaleClusterStep with the name of the step of a scaling operation.
+const ScaleClusterStep = "scale-cluster"
+
+// ScalerOperation simulating the scaling of an existing cluster.
+type ScalerOperation struct {
+	*FakeOperation
+	request entities.ScaleRequest
+}
+
+// NewScalerOperation creates a new fake scaling operation.
+func NewScalerOperation(inventory *Inventory, behavior *Behavior, request entities.ScaleRequest) *ScalerOperation {
+	so := &ScalerOperation{
+		FakeOperation: NewFakeOperation(request.RequestID, inventory, behavior),
+		request:       request,
+	}
+	so.SetSteps(so.newStep(ScaleClusterStep, so.scaleClusterStep))
+	return so
+}
+
+// RequestID returns the request identifier associated with this operation
+func (so *ScalerOperation) RequestID() string {
+	return so.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (so *ScalerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      so.request.OrganizationID,
+		ClusterID:           so.request.ClusterID,
+		RequestID:           so.request.RequestID,
+		IsManagementCluster: so.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (so *ScalerOperation) Request() interface{} {
+	return so.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (so *ScalerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", so.request.OrganizationID).Str("clusterID", so.request.ClusterID).Int64("numNodes", so.request.NumNodes).Msg("executing fake scaling operation")
+	ctx = so.Start(ctx)
+	defer so.Finish()
+
+	if err := so.RunSteps(ctx); err != nil {
+		so.SetFailure(ctx, err)
+		callback(so.request.RequestID)
+		return
+	}
+	so.Succeed()
+	callback(so.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (so *ScalerOperation) Result() entities.OperationResult {
+	return so.OperationResult(entities.Scale)
+}
+
+// scaleClusterStep updates the number of nodes of the cluster in the inventory.
+func (so *ScalerOperation) scaleClusterStep(_ context.Context) derrors.Error {
+	if so.request.NumNodes <= 0 {
+		return derrors.NewInvalidArgumentError("cannot scale a cluster to less than 1 node")
+	}
+	cluster, err := so.inventory.Get(so.request.OrganizationID, so.request.ClusterID)
+	if err != nil {
+		return err
+	}
+	previous := cluster.NumNodes
+	cluster.NumNodes = so.request.NumNodes
+	cluster.Updated = time.Now().Unix()
+	if err := so.inventory.Update(*cluster); err != nil {
+		return err
+	}
+	so.AddToLog(fmt.Sprintf("fake cluster scaled from %d to %d nodes", previous, so.request.NumNodes))
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/config"
+)
+
+// Cluster with the operations performed on a new cluster to issue its certificate through Cloud DNS.
+type Cluster interface {
+	managed.Cluster
+	// RequestCertificateIssuer creates the certificate issuer validating the certificates on Cloud DNS.
+	RequestCertificateIssuer(projectID string, serviceAccountKey string, isProduction bool) derrors.Error
+}
+
+// KubernetesCluster accessing the new cluster through the Kubernetes API.
+type KubernetesCluster struct {
+	*managed.KubernetesCluster
+}
+
+// NewKubernetesCluster creates a new Cluster using the Kubernetes API.
+func NewKubernetesCluster(config *config.Config) Cluster {
+	return &KubernetesCluster{KubernetesCluster: managed.NewKubernetesCluster(config)}
+}
+
+// RequestCertificateIssuer creates the certificate issuer validating the certificates on Cloud DNS.
+func (kc *KubernetesCluster) RequestCertificateIssuer(projectID string, serviceAccountKey string, isProduction bool) derrors.Error {
+	return kc.RequestCertificateIssuerOnGCP(projectID, serviceAccountKey, isProduction)
+}
+
+// CreateCertificate requests the cluster certificate solved through Cloud DNS.
+func (kc *KubernetesCluster) CreateCertificate(clusterName string, dnsZone string) derrors.Error {
+	return kc.CreateCertificateOnGCP(clusterName, dnsZone)
+}
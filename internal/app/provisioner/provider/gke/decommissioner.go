@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/azure"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// DecommissionerOperation removing a GKE cluster with its addresses and DNS entries.
+type DecommissionerOperation struct {
+	*GKEOperation
+	request entities.DecommissionRequest
+}
+
+// NewDecommissionerOperation creates a new GKE decommission operation.
+func NewDecommissionerOperation(credentials *entities.GCPCredentials, services *Services, waitDelay time.Duration, request entities.DecommissionRequest) *DecommissionerOperation {
+	do := &DecommissionerOperation{
+		GKEOperation: NewGKEOperation(request.RequestID, "", credentials, services, waitDelay),
+		request:      request,
+	}
+	do.SetSteps(
+		workflow.NewStep(LoadClusterStep, do.loadClusterStep),
+		workflow.NewStep(DeleteDNSEntriesStep, do.deleteDNSEntriesStep),
+		workflow.NewStep(ReleaseIPAddressesStep, do.releaseIPAddressesStep),
+		workflow.NewStep(DeleteClusterStep, do.deleteClusterStep),
+	)
+	return do
+}
+
+// RequestID returns the request identifier associated with this operation
+func (do *DecommissionerOperation) RequestID() string {
+	return do.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (do *DecommissionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      do.request.OrganizationID,
+		ClusterID:           do.request.ClusterID,
+		RequestID:           do.request.RequestID,
+		IsManagementCluster: do.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (do *DecommissionerOperation) Request() interface{} {
+	return do.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (do *DecommissionerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("organizationID", do.request.OrganizationID).Str("clusterID", do.request.ClusterID).Msg("executing GKE decommission operation")
+	ctx = do.Start(ctx)
+	defer do.Finish()
+
+	if err := do.RunSteps(ctx); err != nil {
+		do.SetFailure(ctx, err)
+		callback(do.request.RequestID)
+		return
+	}
+	do.Succeed()
+	callback(do.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (do *DecommissionerOperation) Result() entities.OperationResult {
+	return do.OperationResult(entities.Decommission)
+}
+
+// resourceName returns the name of the GKE cluster.
+func (do *DecommissionerOperation) resourceName() string {
+	return ResourceName(do.request.IsManagementCluster, do.request.ClusterID)
+}
+
+// addressNames returns the names of the IP addresses that may have been reserved for the cluster.
+func (do *DecommissionerOperation) addressNames() []string {
+	if do.request.IsManagementCluster {
+		return azure.ManagementIPAddressNames
+	}
+	return azure.ApplicationIPAddressNames
+}
+
+// loadClusterStep locates the cluster and retrieves its name and DNS zone from its labels.
+func (do *DecommissionerOperation) loadClusterStep(ctx context.Context) derrors.Error {
+	if err := do.locateCluster(ctx, do.resourceName()); err != nil {
+		return err
+	}
+	cluster, err := do.getCluster(ctx, do.resourceName())
+	if err != nil {
+		return err
+	}
+	do.Pipeline().SetOutput(ClusterNameOutput, cluster.ResourceLabels[ClusterNameLabel])
+	do.Pipeline().SetOutput(DNSZoneOutput, dnsZoneFromLabel(cluster.ResourceLabels[DNSZoneLabel]))
+	return nil
+}
+
+// deleteDNSEntriesStep deletes the DNS entries of the cluster.
+func (do *DecommissionerOperation) deleteDNSEntriesStep(ctx context.Context) derrors.Error {
+	clusterName, _ := do.Pipeline().Output(ClusterNameOutput)
+	dnsZone, _ := do.Pipeline().Output(DNSZoneOutput)
+	if clusterName == "" || dnsZone == "" {
+		do.AddWarningToLog("cluster does not record its DNS entries", map[string]string{"cluster": do.resourceName()})
+		return nil
+	}
+	managedZone, err := do.managedZone(ctx, dnsZone)
+	if err != nil {
+		return err
+	}
+	return do.deleteDNSRecords(ctx, managedZone, dnsRecords(clusterName, dnsZone, do.request.IsManagementCluster, nil))
+}
+
+// releaseIPAddressesStep releases the static addresses of the cluster.
+func (do *DecommissionerOperation) releaseIPAddressesStep(ctx context.Context) derrors.Error {
+	return do.releaseAddresses(ctx, do.resourceName(), do.addressNames())
+}
+
+// deleteClusterStep removes the GKE cluster together with its node pool.
+func (do *DecommissionerOperation) deleteClusterStep(ctx context.Context) derrors.Error {
+	return do.deleteCluster(ctx, do.resourceName())
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// CloudPlatformScope with the OAuth scope of the tokens used to access the clusters.
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// KubeConfigNotice with the limitation of the kubeconfig files returned for the GKE clusters.
+const KubeConfigNotice = "the kubeconfig embeds an access token of the service account of the profile that expires after one hour, so it must be retrieved again with GetKubeConfig"
+
+// clusterToken obtains an OAuth access token of the service account of the credentials. GKE authorizes the token
+// with the IAM roles of the service account, so the account needs the Kubernetes Engine Admin role to manage the
+// clusters.
+func (gko *GKEOperation) clusterToken(ctx context.Context) (string, derrors.Error) {
+	config, err := google.JWTConfigFromJSON([]byte(gko.credentials.ServiceAccountKey), CloudPlatformScope)
+	if err != nil {
+		return "", derrors.NewInvalidArgumentError("cannot parse service account key", err)
+	}
+	token, err := config.TokenSource(ctx).Token()
+	if err != nil {
+		return "", derrors.NewUnauthenticatedError("cannot obtain service account token", err)
+	}
+	return token.AccessToken, nil
+}
+
+// KubeConfig generates the kubeconfig returned to access a GKE cluster.
+func (gko *GKEOperation) KubeConfig(ctx context.Context, resourceName string) (string, derrors.Error) {
+	if err := gko.locateCluster(ctx, resourceName); err != nil {
+		return "", err
+	}
+	cluster, err := gko.getCluster(ctx, resourceName)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig, err := gko.buildKubeConfig(ctx, cluster)
+	if err != nil {
+		return "", err
+	}
+	gko.AddToLog(KubeConfigNotice)
+	return kubeConfig, nil
+}
+
+// buildKubeConfig generates the kubeconfig to access a GKE cluster with an access token of the service account of
+// the credentials. GKE no longer supports the basic authentication, and the token avoids depending on the Google
+// Cloud SDK where the kubeconfig is used.
+func (gko *GKEOperation) buildKubeConfig(ctx context.Context, cluster *container.Cluster) (string, derrors.Error) {
+	if cluster.Endpoint == "" || cluster.MasterAuth == nil || cluster.MasterAuth.ClusterCaCertificate == "" {
+		return "", derrors.NewUnavailableError("cluster endpoint is not available").WithParams(cluster.Name)
+	}
+	ca, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot decode cluster certificate authority", err)
+	}
+	token, tErr := gko.clusterToken(ctx)
+	if tErr != nil {
+		return "", tErr
+	}
+	name := fmt.Sprintf("gke_%s_%s_%s", gko.credentials.ProjectID, cluster.Location, cluster.Name)
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   fmt.Sprintf("https://%s", cluster.Endpoint),
+		CertificateAuthorityData: ca,
+	}
+	config.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: token}
+	config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	config.CurrentContext = name
+	raw, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot encode kubeconfig", err)
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,561 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Names of the steps shared by the GKE operations.
+const (
+	CreateClusterStep            = "create-cluster"
+	ReserveIPAddressesStep       = "reserve-ip-addresses"
+	ResolveDNSZoneStep           = "resolve-dns-zone"
+	CreateDNSEntriesStep         = "create-dns-entries"
+	RetrieveKubeConfigStep       = managed.RetrieveKubeConfigStep
+	InstallCertManagerStep       = "install-cert-manager"
+	RequestCertificateIssuerStep = "request-certificate-issuer"
+	RequestCertificateStep       = "request-certificate"
+	CreateCASecretStep           = "create-ca-secret"
+	LoadClusterStep              = "load-cluster"
+	DeleteDNSEntriesStep         = "delete-dns-entries"
+	ReleaseIPAddressesStep       = "release-ip-addresses"
+	DeleteClusterStep            = "delete-cluster"
+)
+
+// Names of the outputs produced by the steps.
+const (
+	ManagedZoneOutput = "managedZone"
+	ClusterNameOutput = "clusterName"
+	DNSZoneOutput     = "dnsZone"
+	KubeConfigOutput  = "kubeConfig"
+	// IPAddressOutputPrefix with the prefix of the outputs containing the reserved addresses.
+	IPAddressOutputPrefix = "ipAddress."
+)
+
+// Labels set on the clusters created by the provider. Label values only accept lowercase letters, digits, dashes
+// and underscores.
+const (
+	// CreateByLabel with the name of the label used to indicate the creator of the clusters.
+	CreateByLabel = "created-by"
+	// CreateByValue with the value of the CreateByLabel to mark the clusters as Nalej managed.
+	CreateByValue = "nalej-provisioner"
+	// RequestLabel with the name of the label containing the request that created a cluster.
+	RequestLabel = "nalej-request-id"
+	// ClusterNameLabel with the name of the label containing the name of the cluster used in its DNS records.
+	ClusterNameLabel = "nalej-cluster-name"
+	// DNSZoneLabel with the name of the label containing the DNS zone of a cluster, with its dots replaced by
+	// underscores.
+	DNSZoneLabel = "nalej-dns-zone"
+)
+
+// NodePoolName with the name of the node pool of the clusters.
+const NodePoolName = "nodes"
+
+// DNSRecordTTL with the time to live of the DNS records of the clusters in seconds.
+const DNSRecordTTL = 300
+
+// DefaultWaitDelay between the checks of the resources being created or deleted.
+const DefaultWaitDelay = 10 * time.Second
+
+// maxResourceNameLength with the maximum length of the name of a GKE cluster.
+const maxResourceNameLength = 40
+
+// addressSuffixes with the suffix of the name of the static address reserved for each address of a cluster.
+var addressSuffixes = map[string]string{
+	entities.IngressIPAddressName:     "ingress",
+	entities.DNSPublicIPAddress:       "dns",
+	entities.CoreDNSPublicIPAddress:   "app-dns",
+	entities.VPNServerPublicIPAddress: "vpn-server",
+}
+
+// invalidLabelChars matches the characters not accepted in the values of the labels.
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// Services with the clients of the Google APIs used by the provider.
+type Services struct {
+	Container *container.Service
+	Compute   *compute.Service
+	DNS       *dns.Service
+}
+
+// GKEOperation structure with the common functions shared among the GKE operations. It implements the hooks used by
+// the operations of the managed package.
+type GKEOperation struct {
+	*base.Operation
+	credentials *entities.GCPCredentials
+	services    *Services
+	// zone where the cluster of the operation is located.
+	zone string
+	// located is set once the zone of the cluster is known.
+	located bool
+	// waitDelay between the checks of the resources being created or deleted.
+	waitDelay time.Duration
+}
+
+// NewGKEOperation creates a GKEOperation on the project of the credentials. If the zone is empty, the cluster is
+// searched on the project, using the default zone of the credentials if it does not exist. The default delay is
+// used if the waitDelay is zero.
+func NewGKEOperation(requestID string, zone string, credentials *entities.GCPCredentials, services *Services, waitDelay time.Duration) *GKEOperation {
+	located := zone != ""
+	if !located {
+		zone = credentials.Zone
+	}
+	if waitDelay == 0 {
+		waitDelay = DefaultWaitDelay
+	}
+	return &GKEOperation{
+		Operation:   base.NewOperation(requestID),
+		credentials: credentials,
+		services:    services,
+		zone:        zone,
+		located:     located,
+		waitDelay:   waitDelay,
+	}
+}
+
+// ServiceName returns the name of the managed Kubernetes service.
+func (gko *GKEOperation) ServiceName() string {
+	return "GKE"
+}
+
+// ResourceName returns the name of the GKE cluster based on the clusterID.
+func ResourceName(isManagement bool, clusterID string) string {
+	name := fmt.Sprintf("app-%s", ClusterDNSName(clusterID))
+	if isManagement {
+		// When installing a management cluster, the clusterID matches the clusterName
+		name = fmt.Sprintf("mngt-%s", ClusterDNSName(clusterID))
+	}
+	if len(name) > maxResourceNameLength {
+		name = name[:maxResourceNameLength]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// ClusterDNSName returns the name of the cluster used in its DNS records.
+func ClusterDNSName(clusterName string) string {
+	noSpaces := strings.ReplaceAll(clusterName, " ", "")
+	noDots := strings.ReplaceAll(noSpaces, ".", "-")
+	return strings.ToLower(noDots)
+}
+
+// AddressName returns the name of a static address of a cluster, e.g. ingressPublicIPAddress.
+func AddressName(resourceName string, addressName string) string {
+	return fmt.Sprintf("%s-%s", resourceName, addressSuffixes[addressName])
+}
+
+// labelValue transforms a value into a valid label value.
+func labelValue(value string) string {
+	label := invalidLabelChars.ReplaceAllString(strings.ToLower(value), "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
+
+// dnsZoneLabel returns the label value recording a DNS zone.
+func dnsZoneLabel(dnsZone string) string {
+	return labelValue(strings.ReplaceAll(dnsZone, ".", "_"))
+}
+
+// dnsZoneFromLabel returns the DNS zone recorded by dnsZoneLabel.
+func dnsZoneFromLabel(label string) string {
+	return strings.ReplaceAll(label, "_", ".")
+}
+
+// Region returns the region of a zone, e.g. europe-west1 for europe-west1-b.
+func Region(zone string) string {
+	if index := strings.LastIndex(zone, "-"); index > 0 {
+		return zone[:index]
+	}
+	return zone
+}
+
+// region returns the region of the cluster, where its static addresses are reserved.
+func (gko *GKEOperation) region() string {
+	return Region(gko.zone)
+}
+
+// locationName returns the resource name of the zone of the cluster.
+func (gko *GKEOperation) locationName() string {
+	return fmt.Sprintf("projects/%s/locations/%s", gko.credentials.ProjectID, gko.zone)
+}
+
+// clusterName returns the resource name of a cluster.
+func (gko *GKEOperation) clusterName(resourceName string) string {
+	return fmt.Sprintf("%s/clusters/%s", gko.locationName(), resourceName)
+}
+
+// nodePoolName returns the resource name of the node pool of a cluster.
+func (gko *GKEOperation) nodePoolName(resourceName string) string {
+	return fmt.Sprintf("%s/nodePools/%s", gko.clusterName(resourceName), NodePoolName)
+}
+
+// wait checks the state of a resource until the check reports that it is done. The wait is interrupted when the
+// context is cancelled.
+func (gko *GKEOperation) wait(ctx context.Context, check func() (bool, derrors.Error)) derrors.Error {
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		timer := time.NewTimer(gko.waitDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return derrors.NewCanceledError("wait interrupted", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// locateCluster sets the zone of the operation to the zone of an existing cluster. The requests on existing
+// clusters do not include their zone, so the cluster is searched on all the zones of the project. The zone of the
+// operation is kept if it is already known or the cluster is not found.
+func (gko *GKEOperation) locateCluster(ctx context.Context, resourceName string) derrors.Error {
+	if gko.located {
+		return nil
+	}
+	allLocations := fmt.Sprintf("projects/%s/locations/-", gko.credentials.ProjectID)
+	response, err := gko.services.Container.Projects.Locations.Clusters.List(allLocations).Context(ctx).Do()
+	if err != nil {
+		return convertError(err, "cannot list clusters").WithParams(resourceName)
+	}
+	for _, cluster := range response.Clusters {
+		if cluster.Name == resourceName {
+			gko.zone = cluster.Location
+			gko.located = true
+			return nil
+		}
+	}
+	return nil
+}
+
+// getCluster retrieves a GKE cluster on the zone of the operation.
+func (gko *GKEOperation) getCluster(ctx context.Context, resourceName string) (*container.Cluster, derrors.Error) {
+	cluster, err := gko.services.Container.Projects.Locations.Clusters.Get(gko.clusterName(resourceName)).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err, "cannot retrieve cluster").WithParams(resourceName)
+	}
+	return cluster, nil
+}
+
+// waitClusterRunning waits for a GKE cluster to finish its provisioning or reconciliation.
+func (gko *GKEOperation) waitClusterRunning(ctx context.Context, resourceName string) derrors.Error {
+	return tracing.Trace(ctx, "WaitClusterRunning", func(ctx context.Context) derrors.Error {
+		return gko.wait(ctx, func() (bool, derrors.Error) {
+			cluster, err := gko.getCluster(ctx, resourceName)
+			if err != nil {
+				return false, err
+			}
+			switch cluster.Status {
+			case "RUNNING":
+				return true, nil
+			case "PROVISIONING", "RECONCILING":
+				return false, nil
+			}
+			return false, derrors.NewFailedPreconditionError("cluster is not available").WithParams(resourceName, cluster.Status, cluster.StatusMessage)
+		})
+	})
+}
+
+// deleteCluster removes a GKE cluster and waits for its deletion.
+func (gko *GKEOperation) deleteCluster(ctx context.Context, resourceName string) derrors.Error {
+	_, err := gko.services.Container.Projects.Locations.Clusters.Delete(gko.clusterName(resourceName)).Context(ctx).Do()
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return convertError(err, "cannot delete cluster").WithParams(resourceName)
+	}
+	gko.AddToLog("Deleting cluster")
+	return tracing.Trace(ctx, "WaitClusterDeleted", func(ctx context.Context) derrors.Error {
+		err := gko.wait(ctx, func() (bool, derrors.Error) {
+			_, err := gko.getCluster(ctx, resourceName)
+			if err != nil {
+				if err.Type() == derrors.NotFound {
+					return true, nil
+				}
+				return false, err
+			}
+			return false, nil
+		})
+		if err != nil {
+			return err
+		}
+		gko.AddToLog("cluster has been deleted")
+		return nil
+	})
+}
+
+// waitClusterOperation waits for an operation of GKE to finish.
+func (gko *GKEOperation) waitClusterOperation(ctx context.Context, operation *container.Operation) derrors.Error {
+	name := fmt.Sprintf("%s/operations/%s", gko.locationName(), operation.Name)
+	return gko.wait(ctx, func() (bool, derrors.Error) {
+		current, err := gko.services.Container.Projects.Locations.Operations.Get(name).Context(ctx).Do()
+		if err != nil {
+			return false, convertError(err, "cannot retrieve operation").WithParams(operation.Name)
+		}
+		if current.Status != "DONE" {
+			return false, nil
+		}
+		if current.StatusMessage != "" {
+			return false, derrors.NewInternalError(current.StatusMessage).WithParams(operation.Name, operation.OperationType)
+		}
+		return true, nil
+	})
+}
+
+// waitRegionOperation waits for an operation of Compute Engine on the region of the operation to finish.
+func (gko *GKEOperation) waitRegionOperation(ctx context.Context, operation *compute.Operation) derrors.Error {
+	return gko.wait(ctx, func() (bool, derrors.Error) {
+		current, err := gko.services.Compute.RegionOperations.Get(gko.credentials.ProjectID, gko.region(), operation.Name).Context(ctx).Do()
+		if err != nil {
+			return false, convertError(err, "cannot retrieve operation").WithParams(operation.Name)
+		}
+		if current.Status != "DONE" {
+			return false, nil
+		}
+		if current.Error != nil && len(current.Error.Errors) > 0 {
+			return false, derrors.NewInternalError(current.Error.Errors[0].Message).WithParams(operation.Name, current.Error.Errors[0].Code)
+		}
+		return true, nil
+	})
+}
+
+// getAddress retrieves a static address of a cluster.
+func (gko *GKEOperation) getAddress(ctx context.Context, resourceName string, addressName string) (*compute.Address, derrors.Error) {
+	name := AddressName(resourceName, addressName)
+	address, err := gko.services.Compute.Addresses.Get(gko.credentials.ProjectID, gko.region(), name).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err, "cannot retrieve IP address").WithParams(name)
+	}
+	return address, nil
+}
+
+// reserveAddress reserves a static external address for a cluster. An address reserved by a previous execution
+// is reused.
+func (gko *GKEOperation) reserveAddress(ctx context.Context, resourceName string, addressName string) (string, derrors.Error) {
+	address, err := gko.getAddress(ctx, resourceName, addressName)
+	if err == nil {
+		return address.Address, nil
+	}
+	if err.Type() != derrors.NotFound {
+		return "", err
+	}
+	name := AddressName(resourceName, addressName)
+	operation, cErr := gko.services.Compute.Addresses.Insert(gko.credentials.ProjectID, gko.region(), &compute.Address{
+		Name:        name,
+		Description: fmt.Sprintf("%s of %s created by %s", addressName, resourceName, CreateByValue),
+		AddressType: "EXTERNAL",
+	}).Context(ctx).Do()
+	if cErr != nil {
+		return "", convertError(cErr, "cannot reserve IP address").WithParams(name)
+	}
+	if err := gko.waitRegionOperation(ctx, operation); err != nil {
+		return "", err
+	}
+	address, err = gko.getAddress(ctx, resourceName, addressName)
+	if err != nil {
+		return "", err
+	}
+	return address.Address, nil
+}
+
+// releaseAddresses releases the static addresses of a cluster.
+func (gko *GKEOperation) releaseAddresses(ctx context.Context, resourceName string, addressNames []string) derrors.Error {
+	for _, addressName := range addressNames {
+		name := AddressName(resourceName, addressName)
+		operation, err := gko.services.Compute.Addresses.Delete(gko.credentials.ProjectID, gko.region(), name).Context(ctx).Do()
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			log.Warn().Str("address", name).Err(err).Msg("cannot release IP address")
+			return convertError(err, "cannot release IP address").WithParams(name)
+		}
+		if err := gko.waitRegionOperation(ctx, operation); err != nil {
+			return err
+		}
+		gko.AddToLog(fmt.Sprintf("IP address released %s", addressName))
+	}
+	return nil
+}
+
+// managedZone obtains the name of the Cloud DNS managed zone of a DNS zone.
+func (gko *GKEOperation) managedZone(ctx context.Context, dnsZone string) (string, derrors.Error) {
+	response, err := gko.services.DNS.ManagedZones.List(gko.credentials.ProjectID).DnsName(fqdn(dnsZone)).Context(ctx).Do()
+	if err != nil {
+		return "", convertError(err, "cannot retrieve DNS zone").WithParams(dnsZone)
+	}
+	for _, zone := range response.ManagedZones {
+		if zone.DnsName == fqdn(dnsZone) {
+			return zone.Name, nil
+		}
+	}
+	return "", derrors.NewNotFoundError("DNS zone not found").WithParams(dnsZone)
+}
+
+// dnsRecord with the name, type and value of a DNS record.
+type dnsRecord struct {
+	name       string
+	recordType string
+	value      string
+}
+
+// dnsRecords returns the DNS records of a cluster. Management clusters publish the addresses of their DNS and VPN
+// services, and delegate the resolution of the endpoints to their own DNS server.
+func dnsRecords(clusterName string, dnsZone string, isManagementCluster bool, addresses map[string]string) []dnsRecord {
+	dnsClusterRoot := fmt.Sprintf("%s.%s", ClusterDNSName(clusterName), dnsZone)
+	ingress := addresses[entities.IngressIPAddressName]
+	records := []dnsRecord{
+		{name: dnsClusterRoot, recordType: "A", value: ingress},
+		{name: fmt.Sprintf("*.%s", dnsClusterRoot), recordType: "A", value: ingress},
+	}
+	if !isManagementCluster {
+		return records
+	}
+	return append(records,
+		dnsRecord{name: fmt.Sprintf("dns.%s", dnsClusterRoot), recordType: "A", value: addresses[entities.DNSPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("vpn-server.%s", dnsClusterRoot), recordType: "A", value: addresses[entities.VPNServerPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("app-dns.%s", dnsClusterRoot), recordType: "A", value: addresses[entities.CoreDNSPublicIPAddress]},
+		dnsRecord{name: fmt.Sprintf("ep.%s", dnsClusterRoot), recordType: "NS", value: fqdn(fmt.Sprintf("app-dns.%s", dnsClusterRoot))},
+	)
+}
+
+// fqdn returns a DNS name terminated by the root, as used by Cloud DNS.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// currentRecord retrieves the record set of a DNS record, if it exists.
+func (gko *GKEOperation) currentRecord(ctx context.Context, managedZone string, record dnsRecord) (*dns.ResourceRecordSet, derrors.Error) {
+	response, err := gko.services.DNS.ResourceRecordSets.List(gko.credentials.ProjectID, managedZone).
+		Name(fqdn(record.name)).Type(record.recordType).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err, "cannot retrieve DNS entry").WithParams(record.name)
+	}
+	if len(response.Rrsets) == 0 {
+		return nil, nil
+	}
+	return response.Rrsets[0], nil
+}
+
+// upsertDNSRecords creates or replaces a set of DNS records in a single change. Cloud DNS requires the current
+// record sets to be deleted in the same change that replaces them.
+func (gko *GKEOperation) upsertDNSRecords(ctx context.Context, managedZone string, records []dnsRecord) derrors.Error {
+	change := &dns.Change{}
+	for _, record := range records {
+		current, err := gko.currentRecord(ctx, managedZone, record)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			change.Deletions = append(change.Deletions, current)
+		}
+		change.Additions = append(change.Additions, &dns.ResourceRecordSet{
+			Name:    fqdn(record.name),
+			Type:    record.recordType,
+			Ttl:     DNSRecordTTL,
+			Rrdatas: []string{record.value},
+		})
+	}
+	_, err := gko.services.DNS.Changes.Create(gko.credentials.ProjectID, managedZone, change).Context(ctx).Do()
+	if err != nil {
+		return convertError(err, "cannot create DNS entries").WithParams(managedZone)
+	}
+	return nil
+}
+
+// deleteDNSRecords removes the DNS records of a cluster that exist in a single change.
+func (gko *GKEOperation) deleteDNSRecords(ctx context.Context, managedZone string, records []dnsRecord) derrors.Error {
+	change := &dns.Change{}
+	for _, record := range records {
+		current, err := gko.currentRecord(ctx, managedZone, record)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			change.Deletions = append(change.Deletions, current)
+		}
+	}
+	if len(change.Deletions) == 0 {
+		return nil
+	}
+	_, err := gko.services.DNS.Changes.Create(gko.credentials.ProjectID, managedZone, change).Context(ctx).Do()
+	if err != nil {
+		return convertError(err, "cannot delete DNS entries").WithParams(managedZone)
+	}
+	for _, deleted := range change.Deletions {
+		gko.AddToLog(fmt.Sprintf("DNS entry deleted %s", deleted.Name))
+	}
+	return nil
+}
+
+// isNotFound checks if an error of the Google APIs reports a missing resource.
+func isNotFound(err error) bool {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		return apiErr.Code == http.StatusNotFound
+	}
+	return false
+}
+
+// convertError transforms the errors of the Google APIs into derrors.
+func convertError(err error, msg string) *derrors.GenericError {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			return derrors.NewNotFoundError(msg, err)
+		case http.StatusConflict:
+			return derrors.NewAlreadyExistsError(msg, err)
+		case http.StatusBadRequest:
+			return derrors.NewInvalidArgumentError(msg, err)
+		case http.StatusUnauthorized:
+			return derrors.NewUnauthenticatedError(msg, err)
+		case http.StatusForbidden:
+			return derrors.NewPermissionDeniedError(msg, err)
+		case http.StatusTooManyRequests:
+			return derrors.NewResourceExhaustedError(msg, err)
+		}
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return derrors.NewCanceledError(msg, err)
+	}
+	return derrors.NewGenericError(msg, err)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package gke contains the infrastructure provider that creates Kubernetes clusters on Google GKE. The Google
+// Cloud project is described by a credentials profile of the GCP platform.
+package gke
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	providerEntities "github.com/nalej/provisioner/internal/app/provisioner/provider/entities"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/option"
+)
+
+// Platform identifying the GKE clusters on the requests.
+const Platform = entities.GCPPlatform
+
+// Paths of the Google APIs, appended to the endpoint of the credentials when it is overridden.
+const (
+	containerAPIPath = "/"
+	computeAPIPath   = "/compute/v1/projects/"
+	dnsAPIPath       = "/dns/v1/projects/"
+)
+
+// GKEInfrastructureProvider managing clusters on the Google Cloud project of a credentials profile.
+type GKEInfrastructureProvider struct {
+	credentials *entities.GCPCredentials
+	services    *Services
+	// newCluster creates the access to the new clusters used to issue their certificates.
+	newCluster func() Cluster
+	// waitDelay between the checks of the resources being created or deleted.
+	waitDelay time.Duration
+}
+
+// NewGKEInfrastructureProvider creates a provider using the GCP credentials of a profile.
+func NewGKEInfrastructureProvider(profile *entities.CredentialsProfile, config *config.Config) (providerEntities.InfrastructureProvider, derrors.Error) {
+	if profile == nil || profile.GCPCredentials == nil {
+		return nil, derrors.NewInvalidArgumentError("a credentials profile with gcp_credentials is required")
+	}
+	newCluster := func() Cluster {
+		return NewKubernetesCluster(config)
+	}
+	return NewGKEInfrastructureProviderWith(profile.GCPCredentials, newCluster, 0)
+}
+
+// NewGKEInfrastructureProviderWith creates a provider using the given GCP credentials, access to the new
+// clusters, and delay between the checks of the resources being created or deleted.
+func NewGKEInfrastructureProviderWith(credentials *entities.GCPCredentials, newCluster func() Cluster, waitDelay time.Duration) (*GKEInfrastructureProvider, derrors.Error) {
+	services, err := newServices(credentials)
+	if err != nil {
+		return nil, err
+	}
+	return &GKEInfrastructureProvider{credentials: credentials, services: services, newCluster: newCluster, waitDelay: waitDelay}, nil
+}
+
+// newServices creates the clients of the Google APIs authenticated with the service account of the credentials.
+func newServices(credentials *entities.GCPCredentials) (*Services, derrors.Error) {
+	ctx := context.Background()
+	options := func(apiPath string) []option.ClientOption {
+		opts := []option.ClientOption{option.WithCredentialsJSON([]byte(credentials.ServiceAccountKey))}
+		if credentials.Endpoint != "" {
+			opts = append(opts, option.WithEndpoint(strings.TrimSuffix(credentials.Endpoint, "/")+apiPath))
+		}
+		return opts
+	}
+	containerService, err := container.NewService(ctx, options(containerAPIPath)...)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot create GKE client", err)
+	}
+	computeService, err := compute.NewService(ctx, options(computeAPIPath)...)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot create Compute Engine client", err)
+	}
+	dnsService, err := dns.NewService(ctx, options(dnsAPIPath)...)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot create Cloud DNS client", err)
+	}
+	return &Services{Container: containerService, Compute: computeService, DNS: dnsService}, nil
+}
+
+// Provision a cluster creates a InfrastructureOperation to provision a new cluster.
+func (gip *GKEInfrastructureProvider) Provision(request entities.ProvisionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	if request.DNSOptions == nil || request.DNSOptions.ZoneName == "" {
+		return nil, derrors.NewInvalidArgumentError("dns_zone_name is required to provision a GKE cluster")
+	}
+	return NewProvisionerOperation(gip.credentials, gip.services, gip.newCluster(), gip.waitDelay, request), nil
+}
+
+// Decommission a cluster creates a InfrastructureOperation to decommission a cluster.
+func (gip *GKEInfrastructureProvider) Decommission(request entities.DecommissionRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewDecommissionerOperation(gip.credentials, gip.services, gip.waitDelay, request), nil
+}
+
+// Scale a cluster creates a InfrastructureOperation to scale a cluster.
+func (gip *GKEInfrastructureProvider) Scale(request entities.ScaleRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewScalerOperation(gip.credentials, gip.services, gip.waitDelay, request), nil
+}
+
+// GetKubeConfig retrieves the KubeConfig file to access the management layer of Kubernetes.
+func (gip *GKEInfrastructureProvider) GetKubeConfig(request entities.ClusterRequest) (entities.InfrastructureOperation, derrors.Error) {
+	return NewManagementOperation(gip.credentials, gip.services, gip.waitDelay, request, entities.GetKubeConfig), nil
+}
+
+// ValidateCredentials checks that Google Cloud accepts the service account of a profile by listing the clusters
+// of its zone.
+func ValidateCredentials(credentials *entities.GCPCredentials) derrors.Error {
+	services, err := newServices(credentials)
+	if err != nil {
+		return err
+	}
+	operation := NewGKEOperation("", "", credentials, services, 0)
+	_, callErr := services.Container.Projects.Locations.Clusters.List(operation.locationName()).Do()
+	if callErr != nil {
+		return convertError(callErr, "invalid GCP credentials")
+	}
+	return nil
+}
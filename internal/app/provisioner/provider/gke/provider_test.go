@@ -0,0 +1,243 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"time"
+
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/providertest"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func testCredentials(standIn *gcpStandIn) *entities.GCPCredentials {
+	return &entities.GCPCredentials{
+		ProjectID:         "nalej-project",
+		Zone:              "europe-west1-b",
+		ServiceAccountKey: standIn.serviceAccountKey(),
+		Endpoint:          standIn.URL(),
+	}
+}
+
+func provisionRequest(requestID string, isManagementCluster bool) entities.ProvisionRequest {
+	request := providertest.ProvisionRequest(requestID, isManagementCluster)
+	request.NodeType = "n1-standard-2"
+	return request
+}
+
+var _ = ginkgo.Describe("GKE infrastructure provider", func() {
+
+	var standIn *gcpStandIn
+	var cluster *fakeCluster
+	var provider *GKEInfrastructureProvider
+
+	ginkgo.BeforeEach(func() {
+		standIn = newGCPStandIn(providertest.DNSZone)
+		cluster = newFakeCluster()
+		var err error
+		provider, err = NewGKEInfrastructureProviderWith(testCredentials(standIn), cluster.newCluster, time.Millisecond)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		standIn.Close()
+	})
+
+	ginkgo.It("provisions, scales and decommissions a management cluster", func() {
+		operation, err := provider.Provision(provisionRequest("provision", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(result.ProvisionResult.Hostname).To(gomega.Equal("Test.Cluster.nalej.tech"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("gke_nalej-project_europe-west1-b_mngt-test-cluster"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("https://35.0.0.1"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("token: token"))
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).NotTo(gomega.ContainSubstring("password"))
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.Ingress).ToNot(gomega.BeEmpty())
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.VPNServer).ToNot(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.HaveLen(4))
+		gomega.Expect(standIn.addresses).To(gomega.HaveKey("mngt-test-cluster-ingress"))
+		gomega.Expect(standIn.NodeCount("mngt-test-cluster")).To(gomega.Equal(int64(3)))
+		gomega.Expect(standIn.clusters["mngt-test-cluster"].ResourceLabels).To(gomega.HaveKeyWithValue(DNSZoneLabel, "nalej_tech"))
+		gomega.Expect(standIn.RecordNames()).To(gomega.ConsistOf(
+			"A test-cluster.nalej.tech.",
+			"A *.test-cluster.nalej.tech.",
+			"A dns.test-cluster.nalej.tech.",
+			"A vpn-server.test-cluster.nalej.tech.",
+			"A app-dns.test-cluster.nalej.tech.",
+			"NS ep.test-cluster.nalej.tech.",
+		))
+		providertest.ExpectCertificateIssued(cluster.CertManager, "test-cluster.nalej.tech", true)
+		gomega.Expect(cluster.KubeConfig).To(gomega.Equal(result.ProvisionResult.RawKubeConfig))
+		gomega.Expect(cluster.projectID).To(gomega.Equal("nalej-project"))
+		gomega.Expect(cluster.serviceAccountKey).To(gomega.Equal(testCredentials(standIn).ServiceAccountKey))
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", true, 5))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.NodeCount("mngt-test-cluster")).To(gomega.Equal(int64(5)))
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(*result.KubeConfigResult).To(gomega.ContainSubstring("https://35.0.0.1"))
+		gomega.Expect(providertest.LogMessages(operation)).To(gomega.ContainElement(KubeConfigNotice))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", true))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.clusters).To(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.BeEmpty())
+		gomega.Expect(standIn.RecordNames()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("skips the scaling of a node pool with the requested size", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.addresses).To(gomega.HaveLen(1))
+		gomega.Expect(standIn.RecordNames()).To(gomega.HaveLen(2))
+		providertest.ExpectCertificateIssued(cluster.CertManager, "test-cluster.nalej.tech", false)
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", false, 3))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+		gomega.Expect(standIn.Calls("SetNodePoolSize")).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("scales a node pool whose cluster still reports its previous size", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+
+		for _, numNodes := range []int64{5, 3} {
+			operation, err = provider.Scale(providertest.ScaleRequest("scale", false, numNodes))
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+			gomega.Expect(standIn.NodeCount("app-test-cluster")).To(gomega.Equal(numNodes))
+		}
+		gomega.Expect(standIn.Calls("SetNodePoolSize")).To(gomega.Equal(2))
+		gomega.Expect(standIn.clusters["app-test-cluster"].CurrentNodeCount).To(gomega.Equal(int64(3)))
+	})
+
+	ginkgo.It("manages a cluster on the zone of the request", func() {
+		request := provisionRequest("provision", false)
+		request.Zone = "us-central1-a"
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(result.ProvisionResult.RawKubeConfig).To(gomega.ContainSubstring("gke_nalej-project_us-central1-a_app-test-cluster"))
+		gomega.Expect(standIn.clusters["app-test-cluster"].Location).To(gomega.Equal("us-central1-a"))
+		gomega.Expect(standIn.addresses["app-test-cluster-ingress"].Region).To(gomega.Equal("us-central1"))
+
+		operation, err = provider.Scale(providertest.ScaleRequest("scale", false, 4))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(standIn.NodeCount("app-test-cluster")).To(gomega.Equal(int64(4)))
+
+		operation, err = provider.GetKubeConfig(providertest.ClusterRequest("kubeconfig", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		result = providertest.Execute(operation)
+		gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(*result.KubeConfigResult).To(gomega.ContainSubstring("gke_nalej-project_us-central1-a_app-test-cluster"))
+
+		operation, err = provider.Decommission(providertest.DecommissionRequest("decommission", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).ErrorMsg).To(gomega.BeEmpty())
+		gomega.Expect(standIn.clusters).To(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("rejects a cluster created by another request", func() {
+		operation, err := provider.Provision(provisionRequest("provision", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(providertest.Execute(operation).Progress).To(gomega.Equal(entities.Finished))
+
+		request := provisionRequest("other", false)
+		request.RollbackOnFailure = true
+		operation, err = provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("AlreadyExists"))
+		gomega.Expect(standIn.clusters).To(gomega.HaveKey("app-test-cluster"))
+	})
+
+	ginkgo.It("rolls back a failed provisioning", func() {
+		standIn.fail["CreateChange"] = true
+		request := provisionRequest("provision", true)
+		request.RollbackOnFailure = true
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("cannot create DNS entries"))
+		gomega.Expect(standIn.clusters).To(gomega.BeEmpty())
+		gomega.Expect(standIn.addresses).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("resumes a failed provisioning reusing the created resources", func() {
+		provision := func() entities.InfrastructureOperation {
+			operation, err := provider.Provision(provisionRequest("provision", true))
+			gomega.Expect(err).To(gomega.Succeed())
+			return operation
+		}
+		result := providertest.ExpectResumeAfterCertificateFailure(cluster.CertManager, provision, RequestCertificateStep, "test-cluster.nalej.tech")
+		gomega.Expect(result.ProvisionResult.StaticIPAddresses.DNS).ToNot(gomega.BeEmpty())
+		gomega.Expect(cluster.KubeConfig).To(gomega.Equal(result.ProvisionResult.RawKubeConfig))
+		gomega.Expect(standIn.Calls("CreateCluster")).To(gomega.Equal(1))
+		gomega.Expect(standIn.Calls("InsertAddress")).To(gomega.Equal(4))
+		gomega.Expect(standIn.Calls("CreateChange")).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("fails when the DNS zone is not managed in the project", func() {
+		request := provisionRequest("provision", false)
+		request.DNSOptions.ZoneName = "unknown.tech"
+		operation, err := provider.Provision(request)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+	})
+
+	ginkgo.It("fails to decommission a missing cluster", func() {
+		operation, err := provider.Decommission(providertest.DecommissionRequest("decommission", false))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := providertest.Execute(operation)
+		gomega.Expect(result.Progress).To(gomega.Equal(entities.Error))
+		gomega.Expect(result.ErrorMsg).To(gomega.ContainSubstring("NotFound"))
+	})
+
+	ginkgo.It("rejects requests without a DNS zone", func() {
+		request := provisionRequest("provision", false)
+		request.DNSOptions = nil
+		_, err := provider.Provision(request)
+		gomega.Expect(err).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("validates the credentials of a profile", func() {
+		gomega.Expect(ValidateCredentials(testCredentials(standIn))).To(gomega.Succeed())
+	})
+})
@@ -0,0 +1,404 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/azure"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/container/v1"
+)
+
+// ProvisionerOperation creating a GKE cluster with a node pool. The addresses of the cluster are reserved as
+// static external addresses and published on a Cloud DNS managed zone, and the cluster certificate is issued by
+// the cert manager solving the challenges on the same zone.
+type ProvisionerOperation struct {
+	*GKEOperation
+	cluster Cluster
+	// connected is set once the connection with the cluster is established.
+	connected bool
+	request   entities.ProvisionRequest
+	result    *entities.ProvisionResult
+}
+
+// NewProvisionerOperation creates a new GKE provisioning operation.
+func NewProvisionerOperation(credentials *entities.GCPCredentials, services *Services, cluster Cluster, waitDelay time.Duration, request entities.ProvisionRequest) *ProvisionerOperation {
+	po := &ProvisionerOperation{
+		GKEOperation: NewGKEOperation(request.RequestID, request.Zone, credentials, services, waitDelay),
+		cluster:      cluster,
+		request:      request,
+		result: &entities.ProvisionResult{
+			ClusterName: request.ClusterName,
+			Hostname:    fmt.Sprintf("%s.%s", request.ClusterName, request.DNSOptions.ZoneName),
+		},
+	}
+	steps := []workflow.Step{
+		workflow.NewCompensableStep(CreateClusterStep, po.createClusterStep, po.deleteClusterStep),
+		workflow.NewCompensableStep(ReserveIPAddressesStep, po.reserveIPAddressesStep, po.releaseIPAddressesStep),
+		workflow.NewStep(ResolveDNSZoneStep, po.resolveDNSZoneStep),
+		workflow.NewCompensableStep(CreateDNSEntriesStep, po.createDNSEntriesStep, po.deleteDNSEntriesStep),
+		workflow.NewStep(RetrieveKubeConfigStep, po.retrieveKubeConfigStep),
+		workflow.NewStep(InstallCertManagerStep, po.installCertManagerStep),
+		workflow.NewStep(RequestCertificateIssuerStep, po.requestCertificateIssuerStep),
+		workflow.NewStep(RequestCertificateStep, po.requestCertificateStep),
+	}
+	if request.IsManagementCluster {
+		steps = append(steps, workflow.NewStep(CreateCASecretStep, po.createCASecretStep))
+	}
+	po.SetSteps(steps...)
+	return po
+}
+
+// RequestID returns the request identifier associated with this operation
+func (po *ProvisionerOperation) RequestID() string {
+	return po.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (po *ProvisionerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      po.request.OrganizationID,
+		ClusterID:           po.request.ClusterID,
+		ClusterName:         po.request.ClusterName,
+		RequestID:           po.request.RequestID,
+		IsManagementCluster: po.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (po *ProvisionerOperation) Request() interface{} {
+	return po.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (po *ProvisionerOperation) Execute(ctx context.Context, callback func(requestId string)) {
+	log.Debug().Str("organizationID", po.request.OrganizationID).Str("clusterID", po.request.ClusterID).Msg("executing GKE provisioning operation")
+	ctx = po.Start(ctx)
+	defer po.Finish()
+	defer po.disconnect()
+
+	err := po.RunSteps(ctx)
+	if err != nil {
+		if po.request.RollbackOnFailure {
+			po.RollbackSteps()
+		}
+		po.SetFailure(ctx, err)
+		callback(po.request.RequestID)
+		return
+	}
+	po.Succeed()
+	callback(po.request.RequestID)
+}
+
+// Checkpoint returns the state of the steps of the operation.
+func (po *ProvisionerOperation) Checkpoint() *entities.StepCheckpoint {
+	return po.Pipeline().Checkpoint()
+}
+
+// Resume prepares the operation to be executed again from the step that failed. The outputs of the completed
+// steps are used to rebuild the result of the operation.
+func (po *ProvisionerOperation) Resume(checkpoint entities.StepCheckpoint) derrors.Error {
+	if _, exists := checkpoint.Outputs[KubeConfigOutput]; !exists {
+		// The kubeconfig is not persisted, so the operations restored after a restart retrieve it again.
+		checkpoint.Invalidate(RetrieveKubeConfigStep)
+	}
+	if err := po.RestoreCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	for key, value := range checkpoint.Outputs {
+		if strings.HasPrefix(key, IPAddressOutputPrefix) {
+			po.result.SetIPAddress(strings.TrimPrefix(key, IPAddressOutputPrefix), value)
+		}
+	}
+	if kubeConfig, exists := checkpoint.Outputs[KubeConfigOutput]; exists {
+		po.result.RawKubeConfig = kubeConfig
+	}
+	return nil
+}
+
+// Result returns the operation result if this operation is successful
+func (po *ProvisionerOperation) Result() entities.OperationResult {
+	result := po.OperationResult(entities.Provision)
+	result.ProvisionResult = po.result
+	return result
+}
+
+// resourceName returns the name of the GKE cluster.
+func (po *ProvisionerOperation) resourceName() string {
+	return ResourceName(po.request.IsManagementCluster, po.request.ClusterID)
+}
+
+// addressNames returns the names of the IP addresses required by the cluster.
+func (po *ProvisionerOperation) addressNames() []string {
+	if po.request.IsManagementCluster {
+		return azure.ManagementIPAddressNames
+	}
+	return azure.ApplicationIPAddressNames
+}
+
+// clusterLabels returns the labels of the GKE cluster. The name and the DNS zone of the cluster are kept as
+// labels so that its DNS entries can be removed by the decommission.
+func (po *ProvisionerOperation) clusterLabels() map[string]string {
+	return map[string]string{
+		CreateByLabel:    CreateByValue,
+		RequestLabel:     labelValue(po.request.RequestID),
+		ClusterNameLabel: labelValue(ClusterDNSName(po.request.ClusterName)),
+		DNSZoneLabel:     dnsZoneLabel(po.request.DNSOptions.ZoneName),
+	}
+}
+
+// requiredOutput retrieves an output of a previous step.
+func (po *ProvisionerOperation) requiredOutput(key string) (string, derrors.Error) {
+	value, exists := po.Pipeline().Output(key)
+	if !exists {
+		return "", derrors.NewFailedPreconditionError("output of a previous step not found").WithParams(key)
+	}
+	return value, nil
+}
+
+// createClusterStep creates the GKE cluster with its node pool and waits for it to be available. A cluster
+// created by a previous execution of the same request is reused.
+func (po *ProvisionerOperation) createClusterStep(ctx context.Context) derrors.Error {
+	resourceName := po.resourceName()
+	_, cErr := po.services.Container.Projects.Locations.Clusters.Create(po.locationName(), &container.CreateClusterRequest{
+		Cluster: &container.Cluster{
+			Name:                  resourceName,
+			Description:           fmt.Sprintf("%s cluster created by %s", po.request.ClusterName, CreateByValue),
+			InitialClusterVersion: po.request.KubernetesVersion,
+			Network:               po.credentials.Network,
+			ResourceLabels:        po.clusterLabels(),
+			NodePools: []*container.NodePool{{
+				Name:             NodePoolName,
+				InitialNodeCount: po.request.NumNodes,
+				Config:           &container.NodeConfig{MachineType: po.request.NodeType},
+			}},
+		},
+	}).Context(ctx).Do()
+	if cErr != nil {
+		converted := convertError(cErr, "cannot create cluster")
+		if converted.Type() != derrors.AlreadyExists {
+			return converted.WithParams(resourceName)
+		}
+		cluster, err := po.getCluster(ctx, resourceName)
+		if err != nil {
+			return err
+		}
+		if cluster.ResourceLabels[RequestLabel] != labelValue(po.request.RequestID) {
+			return derrors.NewAlreadyExistsError("cluster already exists").WithParams(po.request.OrganizationID, po.request.ClusterID)
+		}
+	}
+	po.AddToLog("Creating cluster")
+	if err := po.waitClusterRunning(ctx, resourceName); err != nil {
+		return err
+	}
+	po.AddToLog("cluster has been created")
+	return nil
+}
+
+// deleteClusterStep removes the GKE cluster if it was created by the operation.
+func (po *ProvisionerOperation) deleteClusterStep(ctx context.Context) derrors.Error {
+	cluster, err := po.getCluster(ctx, po.resourceName())
+	if err != nil {
+		if err.Type() == derrors.NotFound {
+			return nil
+		}
+		return err
+	}
+	if cluster.ResourceLabels[RequestLabel] != labelValue(po.request.RequestID) {
+		return nil
+	}
+	return po.deleteCluster(ctx, po.resourceName())
+}
+
+// reserveIPAddressesStep reserves the static addresses of the cluster.
+func (po *ProvisionerOperation) reserveIPAddressesStep(ctx context.Context) derrors.Error {
+	po.AddToLog("Creating IP addresses")
+	for _, addressName := range po.addressNames() {
+		address, err := po.reserveAddress(ctx, po.resourceName(), addressName)
+		if err != nil {
+			return err
+		}
+		po.result.SetIPAddress(addressName, address)
+		po.Pipeline().SetOutput(IPAddressOutputPrefix+addressName, address)
+		po.AddToLog(fmt.Sprintf("IP address reserved %s", addressName))
+	}
+	return nil
+}
+
+// releaseIPAddressesStep releases the static addresses of the cluster.
+func (po *ProvisionerOperation) releaseIPAddressesStep(ctx context.Context) derrors.Error {
+	return po.releaseAddresses(ctx, po.resourceName(), po.addressNames())
+}
+
+// resolveDNSZoneStep obtains the managed zone of the target DNS zone.
+func (po *ProvisionerOperation) resolveDNSZoneStep(ctx context.Context) derrors.Error {
+	managedZone, err := po.managedZone(ctx, po.request.DNSOptions.ZoneName)
+	if err != nil {
+		return err
+	}
+	po.Pipeline().SetOutput(ManagedZoneOutput, managedZone)
+	return nil
+}
+
+// dnsRecords returns the DNS records of the cluster.
+func (po *ProvisionerOperation) dnsRecords() []dnsRecord {
+	addresses := make(map[string]string, 0)
+	for _, addressName := range po.addressNames() {
+		if value, exists := po.Pipeline().Output(IPAddressOutputPrefix + addressName); exists {
+			addresses[addressName] = value
+		}
+	}
+	return dnsRecords(po.request.ClusterName, po.request.DNSOptions.ZoneName, po.request.IsManagementCluster, addresses)
+}
+
+// createDNSEntriesStep creates the DNS entries pointing to the reserved IP addresses.
+func (po *ProvisionerOperation) createDNSEntriesStep(ctx context.Context) derrors.Error {
+	managedZone, err := po.requiredOutput(ManagedZoneOutput)
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Creating DNS entries")
+	if err := po.upsertDNSRecords(ctx, managedZone, po.dnsRecords()); err != nil {
+		return err
+	}
+	po.AddToLog("DNS entries have been defined")
+	return nil
+}
+
+// deleteDNSEntriesStep deletes the DNS entries of the cluster.
+func (po *ProvisionerOperation) deleteDNSEntriesStep(ctx context.Context) derrors.Error {
+	managedZone, err := po.requiredOutput(ManagedZoneOutput)
+	if err != nil {
+		return err
+	}
+	return po.deleteDNSRecords(ctx, managedZone, po.dnsRecords())
+}
+
+// retrieveKubeConfigStep generates the kubeconfig to access the new cluster.
+func (po *ProvisionerOperation) retrieveKubeConfigStep(ctx context.Context) derrors.Error {
+	kubeConfig, err := po.KubeConfig(ctx, po.resourceName())
+	if err != nil {
+		return err
+	}
+	po.result.RawKubeConfig = kubeConfig
+	po.Pipeline().SetOutput(KubeConfigOutput, kubeConfig)
+	return nil
+}
+
+// connect establishes the connection with the new cluster if it is not already connected.
+func (po *ProvisionerOperation) connect(ctx context.Context) derrors.Error {
+	if po.connected {
+		return nil
+	}
+	err := tracing.Trace(ctx, "ConnectCluster", func(context.Context) derrors.Error {
+		return po.cluster.Connect(po.result.RawKubeConfig)
+	})
+	if err != nil {
+		return err
+	}
+	po.connected = true
+	return nil
+}
+
+// disconnect releases the connection with the new cluster.
+func (po *ProvisionerOperation) disconnect() {
+	if po.connected {
+		po.cluster.Close()
+		po.connected = false
+	}
+}
+
+// installCertManagerStep installs the cert manager on the new cluster.
+func (po *ProvisionerOperation) installCertManagerStep(ctx context.Context) derrors.Error {
+	if err := po.connect(ctx); err != nil {
+		return err
+	}
+	po.AddToLog("installing cert manager")
+	err := tracing.Trace(ctx, "InstallCertManager", func(context.Context) derrors.Error {
+		return po.cluster.InstallCertManager()
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Cert manager has been installed")
+	return nil
+}
+
+// requestCertificateIssuerStep creates the certificate issuer solving the challenges on Cloud DNS and waits for
+// it to be available.
+func (po *ProvisionerOperation) requestCertificateIssuerStep(ctx context.Context) derrors.Error {
+	if err := po.connect(ctx); err != nil {
+		return err
+	}
+	err := tracing.Trace(ctx, "RequestCertificateIssuer", func(context.Context) derrors.Error {
+		return po.cluster.RequestCertificateIssuer(po.credentials.ProjectID, po.credentials.ServiceAccountKey, po.request.IsProduction)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("certificate issuer requested")
+	err = tracing.Trace(ctx, "CheckCertificateIssuer", func(context.Context) derrors.Error {
+		return po.cluster.CheckCertificateIssuer()
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug().Msg("certificate issuer available")
+	return nil
+}
+
+// requestCertificateStep requests the cluster certificate and waits for it to be valid.
+func (po *ProvisionerOperation) requestCertificateStep(ctx context.Context) derrors.Error {
+	if err := po.connect(ctx); err != nil {
+		return err
+	}
+	err := tracing.Trace(ctx, "CreateCertificate", func(context.Context) derrors.Error {
+		return po.cluster.CreateCertificate(ClusterDNSName(po.request.ClusterName), po.request.DNSOptions.ZoneName)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("validating cluster certificate")
+	return tracing.Trace(ctx, "ValidateCertificate", func(context.Context) derrors.Error {
+		return po.cluster.ValidateCertificate()
+	})
+}
+
+// createCASecretStep adds the CA certificate as a secret on management clusters.
+func (po *ProvisionerOperation) createCASecretStep(ctx context.Context) derrors.Error {
+	if err := po.connect(ctx); err != nil {
+		return err
+	}
+	po.AddToLog("Adding CA certificate")
+	err := tracing.Trace(ctx, "CreateCASecret", func(context.Context) derrors.Error {
+		return po.cluster.CreateCASecret(po.request.IsProduction)
+	})
+	if err != nil {
+		return err
+	}
+	po.AddToLog("Added CA certificate as a secret")
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/managed"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"google.golang.org/api/container/v1"
+)
+
+// NewScalerOperation creates a new scaling operation changing the size of the node pool of a GKE cluster.
+func NewScalerOperation(credentials *entities.GCPCredentials, services *Services, waitDelay time.Duration, request entities.ScaleRequest) *managed.ScalerOperation {
+	gko := NewGKEOperation(request.RequestID, "", credentials, services, waitDelay)
+	return managed.NewScalerOperation(gko.Operation, gko, ResourceName(request.IsManagementCluster, request.ClusterID), request)
+}
+
+// NodeCount returns the number of nodes requested for the node pool of a cluster, which is the sum of the target
+// sizes of its instance groups. The node count reported by the cluster is only refreshed periodically, so it does
+// not reflect the latest resizes of the node pool.
+func (gko *GKEOperation) NodeCount(ctx context.Context, resourceName string) (int64, derrors.Error) {
+	if err := gko.locateCluster(ctx, resourceName); err != nil {
+		return 0, err
+	}
+	nodePool, err := gko.services.Container.Projects.Locations.Clusters.NodePools.Get(gko.nodePoolName(resourceName)).Context(ctx).Do()
+	if err != nil {
+		return 0, convertError(err, "cannot retrieve node pool").WithParams(resourceName)
+	}
+	var size int64
+	for _, groupURL := range nodePool.InstanceGroupUrls {
+		zone, name, pErr := instanceGroupManager(groupURL)
+		if pErr != nil {
+			return 0, pErr
+		}
+		group, err := gko.services.Compute.InstanceGroupManagers.Get(gko.credentials.ProjectID, zone, name).Context(ctx).Do()
+		if err != nil {
+			return 0, convertError(err, "cannot retrieve instance group").WithParams(name)
+		}
+		size += group.TargetSize
+	}
+	return size, nil
+}
+
+// instanceGroupManager extracts the zone and the name of an instance group manager from its URL, e.g.
+// .../projects/{project}/zones/{zone}/instanceGroupManagers/{name}.
+func instanceGroupManager(groupURL string) (string, string, derrors.Error) {
+	parts := strings.Split(groupURL, "/")
+	if len(parts) < 4 || parts[len(parts)-4] != "zones" || parts[len(parts)-2] != "instanceGroupManagers" {
+		return "", "", derrors.NewInternalError("unexpected instance group URL").WithParams(groupURL)
+	}
+	return parts[len(parts)-3], parts[len(parts)-1], nil
+}
+
+// ScaleNodes updates the size of the node pool of a cluster and waits for the resize to finish.
+func (gko *GKEOperation) ScaleNodes(ctx context.Context, resourceName string, numNodes int64) derrors.Error {
+	if err := gko.locateCluster(ctx, resourceName); err != nil {
+		return err
+	}
+	operation, err := gko.services.Container.Projects.Locations.Clusters.NodePools.SetSize(gko.nodePoolName(resourceName), &container.SetNodePoolSizeRequest{
+		NodeCount: numNodes,
+	}).Context(ctx).Do()
+	if err != nil {
+		return convertError(err, "cannot scale node pool").WithParams(resourceName)
+	}
+	return tracing.Trace(ctx, "WaitNodePoolScaled", func(ctx context.Context) derrors.Error {
+		return gko.waitClusterOperation(ctx, operation)
+	})
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gke
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/dns/v1"
+)
+
+// gcpStandIn serving the subset of the GKE, Compute Engine and Cloud DNS APIs used by the provider, together with
+// the token endpoint of the service accounts. Clusters being created or deleted change their state on the next
+// get call, and the operations are done on their first check. As in GKE, resizing a node pool changes the target
+// size of its instance group but not the node count reported by the cluster.
+type gcpStandIn struct {
+	sync.Mutex
+	server    *httptest.Server
+	clusters  map[string]*container.Cluster
+	addresses map[string]*compute.Address
+	zones     map[string]string
+	records   map[string]*dns.ResourceRecordSet
+	// groups with the target size of the instance group of each node pool.
+	groups map[string]int64
+	// fail with the actions that return an error.
+	fail map[string]bool
+	// calls with the number of calls of each action.
+	calls  map[string]int
+	nextID int
+}
+
+func newGCPStandIn(zoneName string) *gcpStandIn {
+	standIn := &gcpStandIn{
+		clusters:  make(map[string]*container.Cluster),
+		addresses: make(map[string]*compute.Address),
+		groups:    make(map[string]int64),
+		zones:     map[string]string{"nalej-zone": zoneName + "."},
+		records:   make(map[string]*dns.ResourceRecordSet),
+		fail:      make(map[string]bool),
+		calls:     make(map[string]int),
+	}
+	standIn.server = httptest.NewServer(http.HandlerFunc(standIn.handle))
+	return standIn
+}
+
+// URL returns the endpoint of the stand-in.
+func (s *gcpStandIn) URL() string {
+	return s.server.URL
+}
+
+// Close stops the stand-in.
+func (s *gcpStandIn) Close() {
+	s.server.Close()
+}
+
+// Calls returns the number of calls of an action.
+func (s *gcpStandIn) Calls(action string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.calls[action]
+}
+
+// NodeCount returns the target size of the instance group of the node pool of a cluster.
+func (s *gcpStandIn) NodeCount(clusterName string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.groups[groupName(clusterName)]
+}
+
+// groupName returns the name of the instance group of the node pool of a cluster.
+func groupName(clusterName string) string {
+	return fmt.Sprintf("gke-%s-%s-grp", clusterName, NodePoolName)
+}
+
+// RecordNames returns the names of the records of the managed zone.
+func (s *gcpStandIn) RecordNames() []string {
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.records))
+	for key := range s.records {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceAccountKey returns the key of a service account whose tokens are issued by the stand-in.
+func (s *gcpStandIn) serviceAccountKey() string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	raw, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "nalej-project",
+		"private_key_id": "key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})),
+		"client_email":   "provisioner@nalej-project.iam.gserviceaccount.com",
+		"client_id":      "1",
+		"token_uri":      s.URL() + "/token",
+	})
+	return string(raw)
+}
+
+func (s *gcpStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case r.URL.Path == "/token":
+		s.reply(w, map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+	case strings.HasPrefix(r.URL.Path, "/v1/"):
+		s.handleContainer(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"))
+	case strings.HasPrefix(r.URL.Path, "/compute/v1/projects/"):
+		s.handleCompute(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, "/compute/v1/projects/"), "/"))
+	case strings.HasPrefix(r.URL.Path, "/dns/v1/projects/"):
+		s.handleDNS(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, "/dns/v1/projects/"), "/"))
+	default:
+		s.error(w, http.StatusNotFound, "unsupported call")
+	}
+}
+
+// call registers a call and checks if it must fail.
+func (s *gcpStandIn) call(action string) bool {
+	s.calls[action]++
+	return s.fail[action]
+}
+
+func (s *gcpStandIn) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *gcpStandIn) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": message}})
+}
+
+func (s *gcpStandIn) reply(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// handleContainer serves the calls on projects/{project}/locations/{zone}/...
+func (s *gcpStandIn) handleContainer(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 5 {
+		s.error(w, http.StatusBadRequest, "unsupported call")
+		return
+	}
+	if parts[4] == "operations" {
+		s.reply(w, &container.Operation{Name: parts[len(parts)-1], Status: "DONE"})
+		return
+	}
+	if len(parts) == 5 {
+		switch r.Method {
+		case http.MethodGet:
+			clusters := make([]*container.Cluster, 0, len(s.clusters))
+			for _, cluster := range s.clusters {
+				if parts[3] == "-" || parts[3] == cluster.Location {
+					clusters = append(clusters, cluster)
+				}
+			}
+			s.reply(w, &container.ListClustersResponse{Clusters: clusters})
+		case http.MethodPost:
+			if s.call("CreateCluster") {
+				s.error(w, http.StatusBadRequest, "CreateCluster failed")
+				return
+			}
+			request := &container.CreateClusterRequest{}
+			_ = json.NewDecoder(r.Body).Decode(request)
+			cluster := request.Cluster
+			if cluster.MasterAuth != nil && cluster.MasterAuth.Password != "" {
+				s.error(w, http.StatusBadRequest, "basic authentication is not supported")
+				return
+			}
+			if _, exists := s.clusters[cluster.Name]; exists {
+				s.error(w, http.StatusConflict, "cluster already exists")
+				return
+			}
+			cluster.Status = "PROVISIONING"
+			cluster.Location = parts[3]
+			cluster.Endpoint = fmt.Sprintf("35.0.0.%d", len(s.clusters)+1)
+			cluster.MasterAuth = &container.MasterAuth{ClusterCaCertificate: base64.StdEncoding.EncodeToString([]byte("test-ca"))}
+			cluster.CurrentNodeCount = cluster.NodePools[0].InitialNodeCount
+			cluster.NodePools[0].InstanceGroupUrls = []string{fmt.Sprintf("%s/compute/v1/projects/%s/zones/%s/instanceGroupManagers/%s",
+				s.URL(), parts[1], parts[3], groupName(cluster.Name))}
+			s.groups[groupName(cluster.Name)] = cluster.NodePools[0].InitialNodeCount
+			s.clusters[cluster.Name] = cluster
+			s.reply(w, &container.Operation{Name: s.newID("operation"), Status: "RUNNING", OperationType: "CREATE_CLUSTER"})
+		}
+		return
+	}
+	cluster, exists := s.clusters[strings.Split(parts[5], ":")[0]]
+	if !exists || cluster.Location != parts[3] {
+		s.error(w, http.StatusNotFound, "cluster not found")
+		return
+	}
+	if len(parts) == 8 && strings.HasSuffix(parts[7], ":setSize") {
+		if s.call("SetNodePoolSize") {
+			s.error(w, http.StatusBadRequest, "SetNodePoolSize failed")
+			return
+		}
+		request := &container.SetNodePoolSizeRequest{}
+		_ = json.NewDecoder(r.Body).Decode(request)
+		s.groups[groupName(cluster.Name)] = request.NodeCount
+		s.reply(w, &container.Operation{Name: s.newID("operation"), Status: "RUNNING", OperationType: "SET_NODE_POOL_SIZE"})
+		return
+	}
+	if len(parts) == 8 {
+		s.reply(w, cluster.NodePools[0])
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		switch cluster.Status {
+		case "PROVISIONING":
+			cluster.Status = "RUNNING"
+		case "STOPPING":
+			delete(s.clusters, cluster.Name)
+			delete(s.groups, groupName(cluster.Name))
+			s.error(w, http.StatusNotFound, "cluster not found")
+			return
+		}
+		s.reply(w, cluster)
+	case http.MethodDelete:
+		if s.call("DeleteCluster") {
+			s.error(w, http.StatusBadRequest, "DeleteCluster failed")
+			return
+		}
+		cluster.Status = "STOPPING"
+		s.reply(w, &container.Operation{Name: s.newID("operation"), Status: "RUNNING", OperationType: "DELETE_CLUSTER"})
+	}
+}
+
+// handleCompute serves the calls on {project}/regions/{region}/... and {project}/zones/{zone}/instanceGroupManagers/...
+func (s *gcpStandIn) handleCompute(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 4 {
+		s.error(w, http.StatusBadRequest, "unsupported call")
+		return
+	}
+	if parts[1] == "zones" {
+		size, exists := s.groups[parts[len(parts)-1]]
+		if !exists || len(parts) != 5 || parts[3] != "instanceGroupManagers" {
+			s.error(w, http.StatusNotFound, "instance group not found")
+			return
+		}
+		s.reply(w, &compute.InstanceGroupManager{Name: parts[4], Zone: parts[2], TargetSize: size})
+		return
+	}
+	if parts[3] == "operations" {
+		s.reply(w, &compute.Operation{Name: parts[len(parts)-1], Status: "DONE"})
+		return
+	}
+	if len(parts) == 4 && r.Method == http.MethodPost {
+		if s.call("InsertAddress") {
+			s.error(w, http.StatusForbidden, "InsertAddress failed")
+			return
+		}
+		address := &compute.Address{}
+		_ = json.NewDecoder(r.Body).Decode(address)
+		if _, exists := s.addresses[address.Name]; exists {
+			s.error(w, http.StatusConflict, "address already exists")
+			return
+		}
+		address.Region = parts[2]
+		address.Status = "RESERVED"
+		address.Address = fmt.Sprintf("34.0.0.%d", s.nextID+1)
+		s.addresses[address.Name] = address
+		s.reply(w, &compute.Operation{Name: s.newID("operation"), Status: "RUNNING"})
+		return
+	}
+	address, exists := s.addresses[parts[len(parts)-1]]
+	if !exists || address.Region != parts[2] {
+		s.error(w, http.StatusNotFound, "address not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.reply(w, address)
+	case http.MethodDelete:
+		s.calls["DeleteAddress"]++
+		delete(s.addresses, address.Name)
+		s.reply(w, &compute.Operation{Name: s.newID("operation"), Status: "RUNNING"})
+	}
+}
+
+// handleDNS serves the calls on {project}/managedZones/...
+func (s *gcpStandIn) handleDNS(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 2 {
+		zones := make([]*dns.ManagedZone, 0)
+		for name, dnsName := range s.zones {
+			if dnsName == r.URL.Query().Get("dnsName") {
+				zones = append(zones, &dns.ManagedZone{Name: name, DnsName: dnsName})
+			}
+		}
+		s.reply(w, &dns.ManagedZonesListResponse{ManagedZones: zones})
+		return
+	}
+	if _, exists := s.zones[parts[2]]; !exists || len(parts) != 4 {
+		s.error(w, http.StatusNotFound, "managed zone not found")
+		return
+	}
+	if r.Method == http.MethodGet {
+		rrsets := make([]*dns.ResourceRecordSet, 0)
+		if record, exists := s.records[r.URL.Query().Get("type")+" "+r.URL.Query().Get("name")]; exists {
+			rrsets = append(rrsets, record)
+		}
+		s.reply(w, &dns.ResourceRecordSetsListResponse{Rrsets: rrsets})
+		return
+	}
+	if s.call("CreateChange") {
+		s.error(w, http.StatusForbidden, "CreateChange failed")
+		return
+	}
+	change := &dns.Change{}
+	_ = json.NewDecoder(r.Body).Decode(change)
+	for _, deletion := range change.Deletions {
+		current, exists := s.records[deletion.Type+" "+deletion.Name]
+		if !exists || strings.Join(current.Rrdatas, ",") != strings.Join(deletion.Rrdatas, ",") || current.Ttl != deletion.Ttl {
+			s.error(w, http.StatusPreconditionFailed, "record set does not match")
+			return
+		}
+	}
+	for _, addition := range change.Additions {
+		if _, exists := s.records[addition.Type+" "+addition.Name]; exists && !contains(change.Deletions, addition) {
+			s.error(w, http.StatusConflict, "record set already exists")
+			return
+		}
+	}
+	for _, deletion := range change.Deletions {
+		delete(s.records, deletion.Type+" "+deletion.Name)
+	}
+	for _, addition := range change.Additions {
+		s.records[addition.Type+" "+addition.Name] = addition
+	}
+	change.Id = s.newID("change")
+	change.Status = "done"
+	s.reply(w, change)
+}
+
+// contains checks if a record set with the same name and type is in a list.
+func contains(records []*dns.ResourceRecordSet, record *dns.ResourceRecordSet) bool {
+	for _, current := range records {
+		if current.Name == record.Name && current.Type == record.Type {
+			return true
+		}
+	}
+	return false
+}
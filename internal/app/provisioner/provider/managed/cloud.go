@@ -0,0 +1,44 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package managed contains the operations shared by the providers of managed Kubernetes services, such as EKS and
+// GKE. The providers plug the calls to the API of their cloud through the Cloud hooks.
+package managed
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+)
+
+// Names of the steps of the shared operations.
+const (
+	RetrieveKubeConfigStep = "retrieve-kubeconfig"
+	ScaleNodesStep         = "scale-nodes"
+)
+
+// Cloud with the calls to the managed Kubernetes service of a cloud used by the shared operations. The hooks are
+// implemented by the operation of each provider, so they share its log and state.
+type Cloud interface {
+	// ServiceName returns the name of the managed Kubernetes service, e.g. EKS.
+	ServiceName() string
+	// KubeConfig generates the kubeconfig returned to access a cluster, and records its limitations in the log.
+	KubeConfig(ctx context.Context, resourceName string) (string, derrors.Error)
+	// NodeCount returns the number of nodes requested for a cluster, which may not be running yet.
+	NodeCount(ctx context.Context, resourceName string) (int64, derrors.Error)
+	// ScaleNodes changes the number of nodes of a cluster and waits for the change to finish.
+	ScaleNodes(ctx context.Context, resourceName string, numNodes int64) derrors.Error
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package managed
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/certmngr"
+	"github.com/nalej/provisioner/internal/pkg/config"
+)
+
+// Cluster with the operations performed on a new cluster to issue its certificate. The certificate issuer solves
+// the challenges on the DNS service of each cloud, so the providers extend it with the request of the issuer.
+type Cluster interface {
+	// Connect establishes the connection with the cluster.
+	Connect(kubeConfig string) derrors.Error
+	// Close releases the connection with the cluster.
+	Close()
+	// InstallCertManager installs the cert manager.
+	InstallCertManager() derrors.Error
+	// CheckCertificateIssuer waits for the certificate issuer to be available.
+	CheckCertificateIssuer() derrors.Error
+	// CreateCertificate requests the cluster certificate.
+	CreateCertificate(clusterName string, dnsZone string) derrors.Error
+	// ValidateCertificate waits for the cluster certificate to be issued.
+	ValidateCertificate() derrors.Error
+	// CreateCASecret creates the CA certificate secret.
+	CreateCASecret(isProduction bool) derrors.Error
+}
+
+// KubernetesCluster accessing the new cluster through the Kubernetes API.
+type KubernetesCluster struct {
+	*certmngr.CertManagerHelper
+}
+
+// NewKubernetesCluster creates a new KubernetesCluster.
+func NewKubernetesCluster(config *config.Config) *KubernetesCluster {
+	return &KubernetesCluster{CertManagerHelper: certmngr.NewCertManagerHelper(config)}
+}
+
+// Close releases the connection with the cluster.
+func (kc *KubernetesCluster) Close() {
+	kc.Destroy()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package managed
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/base"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// ScalerOperation changing the number of nodes of a cluster of a managed Kubernetes service.
+type ScalerOperation struct {
+	*base.Operation
+	cloud        Cloud
+	resourceName string
+	request      entities.ScaleRequest
+}
+
+// NewScalerOperation creates a new scaling operation on the cluster with the given resource name. The operation
+// shares the state of the provider operation implementing the cloud hooks.
+func NewScalerOperation(operation *base.Operation, cloud Cloud, resourceName string, request entities.ScaleRequest) *ScalerOperation {
+	so := &ScalerOperation{
+		Operation:    operation,
+		cloud:        cloud,
+		resourceName: resourceName,
+		request:      request,
+	}
+	so.SetSteps(workflow.NewStep(ScaleNodesStep, so.scaleNodesStep))
+	return so
+}
+
+// RequestID returns the request identifier associated with this operation
+func (so *ScalerOperation) RequestID() string {
+	return so.request.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (so *ScalerOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID:      so.request.OrganizationID,
+		ClusterID:           so.request.ClusterID,
+		RequestID:           so.request.RequestID,
+		IsManagementCluster: so.request.IsManagementCluster,
+	}
+}
+
+// Request returns the request that originated the operation
+func (so *ScalerOperation) Request() interface{} {
+	return so.request
+}
+
+// Execute triggers the execution of the operation. The callback function on the execute is expected to be
+// called when the operation finish its execution independently of the status.
+func (so *ScalerOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	log.Debug().Str("service", so.cloud.ServiceName()).Str("organizationID", so.request.OrganizationID).Str("clusterID", so.request.ClusterID).Int64("numNodes", so.request.NumNodes).Msg("executing scaling operation")
+	ctx = so.Start(ctx)
+	defer so.Finish()
+
+	var err derrors.Error
+	if so.request.NumNodes < 1 {
+		err = derrors.NewInvalidArgumentError("cannot scale a cluster to less than 1 node")
+	} else {
+		err = so.RunSteps(ctx)
+	}
+	if err != nil {
+		so.SetFailure(ctx, err)
+		callback(so.request.RequestID)
+		return
+	}
+	so.Succeed()
+	callback(so.request.RequestID)
+}
+
+// Result returns the operation result if this operation is successful
+func (so *ScalerOperation) Result() entities.OperationResult {
+	return so.OperationResult(entities.Scale)
+}
+
+// scaleNodesStep changes the number of nodes of the cluster unless it already has the requested number.
+func (so *ScalerOperation) scaleNodesStep(ctx context.Context) derrors.Error {
+	numNodes, err := so.cloud.NodeCount(ctx, so.resourceName)
+	if err != nil {
+		return err
+	}
+	if numNodes == so.request.NumNodes {
+		so.AddToLog("cluster already has the requested number of nodes")
+		return nil
+	}
+	so.AddToLog(fmt.Sprintf("Scaling cluster to %d nodes", so.request.NumNodes))
+	if err := so.cloud.ScaleNodes(ctx, so.resourceName, so.request.NumNodes); err != nil {
+		return err
+	}
+	so.AddToLog("cluster has been scaled")
+	return nil
+}
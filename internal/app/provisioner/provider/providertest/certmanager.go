@@ -0,0 +1,134 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package providertest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/gomega"
+)
+
+// CertManager keeping the state of the cert manager of a new cluster in memory. The fake clusters of the providers
+// embed it and add the request of their certificate issuer.
+type CertManager struct {
+	sync.Mutex
+	KubeConfig  string
+	Installed   bool
+	Certificate string
+	CASecret    bool
+	// Fail with the names of the methods that return an error.
+	Fail map[string]bool
+}
+
+// NewCertManager creates a CertManager without any certificate.
+func NewCertManager() *CertManager {
+	return &CertManager{Fail: make(map[string]bool)}
+}
+
+// Call returns the error of a method if it is set to fail.
+func (cm *CertManager) Call(name string) derrors.Error {
+	if cm.Fail[name] {
+		return derrors.NewInternalError(fmt.Sprintf("%s failed", name))
+	}
+	return nil
+}
+
+// Connect establishes the connection with the cluster.
+func (cm *CertManager) Connect(kubeConfig string) derrors.Error {
+	if err := cm.Call("Connect"); err != nil {
+		return err
+	}
+	cm.Lock()
+	defer cm.Unlock()
+	cm.KubeConfig = kubeConfig
+	return nil
+}
+
+// Close releases the connection with the cluster.
+func (cm *CertManager) Close() {}
+
+// InstallCertManager installs the cert manager.
+func (cm *CertManager) InstallCertManager() derrors.Error {
+	if err := cm.Call("InstallCertManager"); err != nil {
+		return err
+	}
+	cm.Installed = true
+	return nil
+}
+
+// CheckCertificateIssuer waits for the certificate issuer to be available.
+func (cm *CertManager) CheckCertificateIssuer() derrors.Error {
+	return cm.Call("CheckCertificateIssuer")
+}
+
+// CreateCertificate requests the cluster certificate.
+func (cm *CertManager) CreateCertificate(clusterName string, dnsZone string) derrors.Error {
+	if err := cm.Call("CreateCertificate"); err != nil {
+		return err
+	}
+	cm.Certificate = fmt.Sprintf("%s.%s", clusterName, dnsZone)
+	return nil
+}
+
+// ValidateCertificate waits for the cluster certificate to be issued.
+func (cm *CertManager) ValidateCertificate() derrors.Error {
+	return cm.Call("ValidateCertificate")
+}
+
+// CreateCASecret creates the CA certificate secret.
+func (cm *CertManager) CreateCASecret(isProduction bool) derrors.Error {
+	if err := cm.Call("CreateCASecret"); err != nil {
+		return err
+	}
+	cm.CASecret = true
+	return nil
+}
+
+// ExpectCertificateIssued checks that the provisioning of a cluster issued its certificate, and that the CA secret
+// is only created on management clusters.
+func ExpectCertificateIssued(cm *CertManager, certificate string, isManagementCluster bool) {
+	gomega.Expect(cm.KubeConfig).NotTo(gomega.BeEmpty())
+	gomega.Expect(cm.Installed).To(gomega.BeTrue())
+	gomega.Expect(cm.Certificate).To(gomega.Equal(certificate))
+	gomega.Expect(cm.CASecret).To(gomega.Equal(isManagementCluster))
+}
+
+// ExpectResumeAfterCertificateFailure provisions a management cluster whose certificate is not validated, and
+// checks that the operation created again from its persisted record, as done after a restart, issues the
+// certificate without repeating the steps creating the cluster.
+func ExpectResumeAfterCertificateFailure(cm *CertManager, provision func() entities.InfrastructureOperation, failedStep string, certificate string) entities.OperationResult {
+	cm.Fail["ValidateCertificate"] = true
+	operation := provision()
+	gomega.Expect(Execute(operation).Progress).To(gomega.Equal(entities.Error))
+	record := entities.NewOperationRecord(operation)
+	gomega.Expect(record.Checkpoint).NotTo(gomega.BeNil())
+	gomega.Expect(record.Checkpoint.Failed).To(gomega.Equal(failedStep))
+	gomega.Expect(cm.CASecret).To(gomega.BeFalse())
+
+	cm.Fail["ValidateCertificate"] = false
+	resumed := provision()
+	gomega.Expect(resumed.(entities.ResumableOperation).Resume(*record.Checkpoint)).To(gomega.Succeed())
+	result := Execute(resumed)
+	gomega.Expect(result.ErrorMsg).To(gomega.BeEmpty())
+	gomega.Expect(result.Progress).To(gomega.Equal(entities.Finished))
+	gomega.Expect(result.ProvisionResult.RawKubeConfig).NotTo(gomega.BeEmpty())
+	ExpectCertificateIssued(cm, certificate, true)
+	return result
+}
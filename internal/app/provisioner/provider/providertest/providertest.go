@@ -0,0 +1,99 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package providertest contains the helpers shared by the tests of the infrastructure providers.
+package providertest
+
+import (
+	"context"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/gomega"
+)
+
+// Identifiers of the cluster of the requests built by the helpers.
+const (
+	OrganizationID = "org"
+	ClusterID      = "Test.Cluster"
+)
+
+// DNSZone with the DNS zone where the clusters of the requests are published.
+const DNSZone = "nalej.tech"
+
+// ProvisionRequest returns a request provisioning a cluster of three nodes published on DNSZone. The tests set the
+// options of their platform on the returned request.
+func ProvisionRequest(requestID string, isManagementCluster bool) entities.ProvisionRequest {
+	return entities.ProvisionRequest{
+		RequestID:           requestID,
+		OrganizationID:      OrganizationID,
+		ClusterID:           ClusterID,
+		ClusterName:         ClusterID,
+		KubernetesVersion:   "1.15.7",
+		NumNodes:            3,
+		IsManagementCluster: isManagementCluster,
+		DNSOptions:          &entities.DNSOptions{ZoneName: DNSZone},
+	}
+}
+
+// ScaleRequest returns a request changing the number of nodes of the cluster of ProvisionRequest.
+func ScaleRequest(requestID string, isManagementCluster bool, numNodes int64) entities.ScaleRequest {
+	return entities.ScaleRequest{
+		RequestID:           requestID,
+		OrganizationID:      OrganizationID,
+		ClusterID:           ClusterID,
+		NumNodes:            numNodes,
+		IsManagementCluster: isManagementCluster,
+	}
+}
+
+// ClusterRequest returns a request retrieving the kubeconfig of the cluster of ProvisionRequest.
+func ClusterRequest(requestID string, isManagementCluster bool) entities.ClusterRequest {
+	return entities.ClusterRequest{
+		RequestID:           requestID,
+		OrganizationID:      OrganizationID,
+		ClusterID:           ClusterID,
+		IsManagementCluster: isManagementCluster,
+	}
+}
+
+// DecommissionRequest returns a request decommissioning the cluster of ProvisionRequest.
+func DecommissionRequest(requestID string, isManagementCluster bool) entities.DecommissionRequest {
+	return entities.DecommissionRequest{
+		RequestID:           requestID,
+		OrganizationID:      OrganizationID,
+		ClusterID:           ClusterID,
+		IsManagementCluster: isManagementCluster,
+	}
+}
+
+// Execute runs an operation waiting for its callback.
+func Execute(operation entities.InfrastructureOperation) entities.OperationResult {
+	done := make(chan string, 1)
+	operation.Execute(context.Background(), func(requestID string) {
+		done <- requestID
+	})
+	gomega.Expect(<-done).To(gomega.Equal(operation.RequestID()))
+	return operation.Result()
+}
+
+// LogMessages returns the messages of the log of an operation.
+func LogMessages(operation entities.InfrastructureOperation) []string {
+	messages := make([]string, 0)
+	for _, entry := range operation.Log() {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
@@ -17,14 +17,25 @@
 package provisioner
 
 import (
+	"strconv"
+
 	grpc_common_go "github.com/nalej/grpc-common-go"
 	grpc_provisioner_go "github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
 )
 
+// RollbackOnFailureMetadataKey with the name of the metadata entry used to request the rollback of a failed
+// provisioning as the option is not part of the ProvisionClusterRequest message.
+const RollbackOnFailureMetadataKey = "x-rollback-on-failure"
+
 type Handler struct {
 	Manager Manager
 }
@@ -35,18 +46,59 @@ func NewHandler(manager Manager) *Handler {
 
 // ProvisionCluster triggers the provisioning operation on a given cloud infrastructure provider.
 func (h *Handler) ProvisionCluster(ctx context.Context, request *grpc_provisioner_go.ProvisionClusterRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
-	err := entities.ValidProvisionClusterRequest(request)
+	ctx, span := tracing.StartSpan(ctx, "provisioner.Handler.ProvisionCluster",
+		tracing.RequestAttributes(request.RequestId, request.OrganizationId, request.ClusterId)...)
+	defer span.End()
+	profileID, err := profiles.IDFromContext(ctx)
+	if err == nil {
+		err = entities.ValidProvisionClusterRequest(request, profileID)
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	webhooks, err := h.Manager.Webhooks.URLsFromContext(ctx)
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
 		return nil, conversions.ToGRPCError(err)
 	}
-	log.Debug().Interface("request", request).Msg("provision cluster")
-	return h.Manager.ProvisionCluster(request)
+	log.Debug().Interface("request", redact.Value(request)).Msg("provision cluster")
+	response, err := h.Manager.ProvisionCluster(ctx, request, profileID, rollbackRequested(ctx), webhooks)
+	if err != nil {
+		return nil, tracing.Fail(span, err)
+	}
+	return response, nil
+}
+
+// rollbackRequested checks if the caller requested the rollback of the provisioning on failure.
+func rollbackRequested(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(RollbackOnFailureMetadataKey)
+	if len(values) == 0 {
+		return false
+	}
+	rollback, err := strconv.ParseBool(values[0])
+	if err != nil {
+		log.Warn().Str("value", values[0]).Msg("invalid rollback metadata value")
+		return false
+	}
+	return rollback
 }
 
 // CheckProgress gets an updated state of a provisioning request.
+// The position of queued operations is sent in the response headers.
 func (h *Handler) CheckProgress(ctx context.Context, requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
-	return h.Manager.CheckProgress(requestID)
+	response, err := h.Manager.CheckProgress(requestID)
+	if err != nil {
+		return nil, err
+	}
+	h.Manager.Executor.SendSchedulingHeaders(ctx, requestID.RequestId)
+	return response, nil
 }
 
 // RemoveProvision cancels an ongoing provisioning or removes the information of an already processed provision operation.
@@ -57,3 +109,31 @@ func (h *Handler) RemoveProvision(ctx context.Context, requestID *grpc_common_go
 	}
 	return &grpc_common_go.Success{}, nil
 }
+
+// ResumeOperation executes again a failed provisioning from the step that failed. Operations restored after a
+// restart of the provisioner must include the original provisioning request, whose credentials profile and
+// rollback option are taken from the metadata as in ProvisionCluster.
+func (h *Handler) ResumeOperation(ctx context.Context, request *operations.ResumeRequest) (*grpc_provisioner_go.ProvisionClusterResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "provisioner.Handler.ResumeOperation", tracing.RequestIDKey.String(request.RequestID))
+	defer span.End()
+	profileID, err := profiles.IDFromContext(ctx)
+	if err == nil {
+		err = entities.ValidResumeRequest(request.RequestID, request.Provision, profileID)
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	webhooks, err := h.Manager.Webhooks.URLsFromContext(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	response, err := h.Manager.ResumeOperation(ctx, request, profileID, rollbackRequested(ctx), webhooks)
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	return response, nil
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provisioner
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
+	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func fakeProvisionRequest(requestID string) *grpc_provisioner_go.ProvisionClusterRequest {
+	return &grpc_provisioner_go.ProvisionClusterRequest{
+		RequestId:         requestID,
+		OrganizationId:    "org",
+		ClusterId:         "cluster-" + requestID,
+		ClusterName:       "test",
+		KubernetesVersion: "1.13.11",
+		NumNodes:          3,
+		NodeType:          "small",
+		TargetPlatform:    fake.Platform.ToGRPC(),
+	}
+}
+
+// The Provision service is called on the handler, the operations service declared by hand is called through a
+// gRPC connection.
+var _ = ginkgo.Describe("Operations service", func() {
+
+	var handler *Handler
+	var server *grpc.Server
+	var conn *grpc.ClientConn
+	var client *operations.Client
+
+	ginkgo.BeforeEach(func() {
+		conf := config.Config{EnableFakeProvider: true, FakeFailSteps: []string{fake.CreateDNSEntriesStep + "=1"}}
+		handler = NewHandler(NewManager(conf))
+		server = grpc.NewServer()
+		operations.RegisterOperationsServer(server, operations.NewHandler(operations.NewManager(), handler, &handler.Manager))
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		gomega.Expect(err).To(gomega.Succeed())
+		go server.Serve(lis)
+		conn, err = grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		gomega.Expect(err).To(gomega.Succeed())
+		client = operations.NewClient(conn)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = conn.Close()
+		server.Stop()
+	})
+
+	// waitState waits for a provisioning operation to reach a given state.
+	waitState := func(requestID string, state grpc_provisioner_go.ProvisionProgress) {
+		gomega.Eventually(func() grpc_provisioner_go.ProvisionProgress {
+			response, err := handler.CheckProgress(context.Background(), &grpc_common_go.RequestId{RequestId: requestID})
+			gomega.Expect(err).To(gomega.Succeed())
+			return response.State
+		}, 5*time.Second, 10*time.Millisecond).Should(gomega.Equal(state))
+	}
+
+	ginkgo.It("resumes a failed provisioning through the gRPC service", func() {
+		requestID := uuid.NewV4().String()
+		_, err := handler.ProvisionCluster(context.Background(), fakeProvisionRequest(requestID))
+		gomega.Expect(err).To(gomega.Succeed())
+		waitState(requestID, grpc_provisioner_go.ProvisionProgress_ERROR)
+
+		// Sending the request again does not resume the operation.
+		_, err = handler.ProvisionCluster(context.Background(), fakeProvisionRequest(requestID))
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("already being processed"))
+
+		_, err = client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID})
+		gomega.Expect(err).To(gomega.Succeed())
+		waitState(requestID, grpc_provisioner_go.ProvisionProgress_FINISHED)
+	})
+
+	ginkgo.It("requires the provisioning request to resume a restored operation", func() {
+		requestID := uuid.NewV4().String()
+		request := fakeProvisionRequest(requestID)
+		workflow.GetRegistry().Put(workflow.NewRestoredOperation(entities.OperationRecord{
+			RequestID:      requestID,
+			OrganizationID: request.OrganizationId,
+			ClusterID:      request.ClusterId,
+			Type:           entities.Provision,
+			Progress:       entities.Error,
+			Result:         entities.OperationResult{RequestId: requestID, Type: entities.Provision, Progress: entities.Error},
+			Checkpoint:     &entities.StepCheckpoint{Completed: []string{}, Failed: fake.CreateClusterStep, Outputs: map[string]string{}},
+		}))
+
+		_, err := client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.FailedPrecondition))
+
+		// The provisioning request must refer to the resumed operation.
+		mismatched := fakeProvisionRequest(uuid.NewV4().String())
+		mismatched.ClusterId = request.ClusterId
+		_, derr := handler.Manager.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID, Provision: mismatched}, "", false, nil)
+		gomega.Expect(derr).NotTo(gomega.BeNil())
+		gomega.Expect(derr.Type()).To(gomega.Equal(derrors.InvalidArgument))
+
+		_, err = client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID, Provision: request})
+		gomega.Expect(err).To(gomega.Succeed())
+		// The recreated operation fails once on the DNS entries and is resumed again.
+		waitState(requestID, grpc_provisioner_go.ProvisionProgress_ERROR)
+		_, err = client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID})
+		gomega.Expect(err).To(gomega.Succeed())
+		waitState(requestID, grpc_provisioner_go.ProvisionProgress_FINISHED)
+	})
+
+	ginkgo.It("streams the log and progress of a provisioning through the gRPC service", func() {
+		requestID := uuid.NewV4().String()
+		_, err := handler.ProvisionCluster(context.Background(), fakeProvisionRequest(requestID))
+		gomega.Expect(err).To(gomega.Succeed())
+
+		stream, err := client.WatchOperation(context.Background(), &grpc_common_go.RequestId{RequestId: requestID})
+		gomega.Expect(err).To(gomega.Succeed())
+		logEntries := 0
+		var last *watch.Event
+		for {
+			event, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(event.RequestID).To(gomega.Equal(requestID))
+			if event.Type == watch.LogEvent {
+				gomega.Expect(event.LogEntry).NotTo(gomega.BeNil())
+				gomega.Expect(event.LogIndex).To(gomega.Equal(logEntries))
+				logEntries++
+			}
+			last = event
+		}
+		gomega.Expect(logEntries).To(gomega.BeNumerically(">", 0))
+		gomega.Expect(last).NotTo(gomega.BeNil())
+		gomega.Expect(last.Type).To(gomega.Equal(watch.ProgressEvent))
+		// The provisioning fails on the DNS entries.
+		gomega.Expect(last.Progress).To(gomega.Equal(entities.Error))
+	})
+
+	ginkgo.It("rejects watching unknown operations", func() {
+		stream, err := client.WatchOperation(context.Background(), &grpc_common_go.RequestId{RequestId: "unknown"})
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = stream.Recv()
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.NotFound))
+	})
+
+	ginkgo.It("rejects resuming unknown or running operations", func() {
+		_, err := client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: "unknown"})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.NotFound))
+
+		requestID := uuid.NewV4().String()
+		provision := fakeProvisionRequest(uuid.NewV4().String())
+		_, err = client.ResumeOperation(context.Background(), &operations.ResumeRequest{RequestID: requestID, Provision: provision})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.InvalidArgument))
+	})
+})
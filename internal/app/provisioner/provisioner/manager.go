@@ -17,14 +17,18 @@
 package provisioner
 
 import (
+	"context"
 	"sync"
 
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
 	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 )
@@ -32,42 +36,53 @@ import (
 type Manager struct {
 	sync.Mutex
 	Config   config.Config
-	Executor workflow.Executor
-	// Operation per request identifier.
-	Operation map[string]entities.InfrastructureOperation
+	Executor *workflow.Executor
+	// Registry shared by the managers with the operations per request identifier.
+	Registry *workflow.Registry
+	// Webhooks notified when the operations finish.
+	Webhooks *webhook.Dispatcher
 }
 
 func NewManager(config config.Config) Manager {
+	executor := workflow.GetExecutor()
+	registry := workflow.GetRegistry()
+	// Recover the operations from previous executions of the provisioner.
+	for _, restored := range executor.RestoredOperations(entities.Provision) {
+		registry.Put(restored)
+	}
 	return Manager{
-		Config:    config,
-		Executor:  workflow.GetExecutor(),
-		Operation: make(map[string]entities.InfrastructureOperation, 0),
+		Config:   config,
+		Executor: executor,
+		Registry: registry,
+		Webhooks: webhook.GetDispatcher(),
 	}
 }
 
-// ProvisionCluster triggers the provisioning operation on a given cloud infrastructure provider.
-func (m *Manager) ProvisionCluster(request *grpc_provisioner_go.ProvisionClusterRequest) (*grpc_provisioner_go.ProvisionClusterResponse, derrors.Error) {
+// ProvisionCluster triggers the provisioning operation on a given cloud infrastructure provider. If rollbackOnFailure
+// is set, or enabled by default in the configuration, the resources created by a failed provisioning are released.
+// The credentials are taken from the referenced credentials profile, if any. The webhooks are notified when the
+// operation finishes.
+func (m *Manager) ProvisionCluster(ctx context.Context, request *grpc_provisioner_go.ProvisionClusterRequest, profileID string, rollbackOnFailure bool, webhooks []string) (*grpc_provisioner_go.ProvisionClusterResponse, derrors.Error) {
 	log.Debug().Str("requestID", request.RequestId).
 		Str("target_platform", request.TargetPlatform.String()).Msg("Provision request received")
-	infraProvider, err := provider.NewInfrastructureProvider(request.TargetPlatform, request.AzureCredentials, &m.Config)
+	operation, err := m.newOperation(request, profileID, rollbackOnFailure)
 	if err != nil {
 		return nil, err
 	}
-	operation, err := infraProvider.Provision(entities.NewProvisionRequest(request))
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("cannot create provision operation")
-		return nil, err
-	}
 	m.Lock()
 	defer m.Unlock()
-	// Check if the operation is already registered
-	_, exists := m.Operation[request.RequestId]
-	if exists {
+	// Check if the operation is already registered. Failed operations are resumed through ResumeOperation.
+	if m.Registry.Exists(request.RequestId) {
 		return nil, derrors.NewAlreadyExistsError("request is already being processed")
 	}
-	m.Operation[request.RequestId] = operation
 	// schedule the operation for execution
-	m.Executor.ScheduleOperation(operation)
+	m.Webhooks.Subscribe(request.RequestId, webhooks)
+	err = m.Executor.ScheduleOperationContext(ctx, operation)
+	if err != nil {
+		m.Webhooks.Unsubscribe(request.RequestId)
+		return nil, err
+	}
+	m.Registry.Put(operation)
 	// return initial response for the request
 	response := &grpc_provisioner_go.ProvisionClusterResponse{
 		RequestId:   request.RequestId,
@@ -79,15 +94,36 @@ func (m *Manager) ProvisionCluster(request *grpc_provisioner_go.ProvisionCluster
 	return response, nil
 }
 
+// newOperation creates the provisioning operation of a request on its infrastructure provider.
+func (m *Manager) newOperation(request *grpc_provisioner_go.ProvisionClusterRequest, profileID string, rollbackOnFailure bool) (entities.InfrastructureOperation, derrors.Error) {
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(request.TargetPlatform), provider.Credentials{
+		AzureCredentials: request.AzureCredentials,
+		ProfileID:        profileID,
+		OrganizationID:   request.OrganizationId,
+	}, &m.Config)
+	if err != nil {
+		return nil, err
+	}
+	provisionRequest := entities.NewProvisionRequest(request)
+	provisionRequest.RollbackOnFailure = rollbackOnFailure || m.Config.RollbackOnFailure
+	operation, err := infraProvider.Provision(provisionRequest)
+	if err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("cannot create provision operation")
+		return nil, err
+	}
+	return operation, nil
+}
+
 // CheckProgress gets an updated state of a provisioning request.
 func (m *Manager) CheckProgress(requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ProvisionClusterResponse, derrors.Error) {
 	m.Lock()
 	defer m.Unlock()
-	operation, exists := m.Operation[requestID.RequestId]
+	operation, exists := m.Registry.Get(requestID.RequestId, entities.Provision)
 	if !exists {
 		return nil, derrors.NewNotFoundError("request_id not found")
 	}
 	result := operation.Result()
+	m.Executor.SetSchedulingState(&result)
 	return result.ToProvisionClusterResult()
 }
 
@@ -95,10 +131,103 @@ func (m *Manager) CheckProgress(requestID *grpc_common_go.RequestId) (*grpc_prov
 func (m *Manager) RemoveProvision(requestID *grpc_common_go.RequestId) derrors.Error {
 	m.Lock()
 	defer m.Unlock()
-	_, exists := m.Operation[requestID.RequestId]
+	_, exists := m.Registry.Get(requestID.RequestId, entities.Provision)
 	if !exists {
 		return derrors.NewNotFoundError("request_id not found")
 	}
-	delete(m.Operation, requestID.RequestId)
+	if m.Executor.IsManaged(requestID.RequestId) {
+		// The operation is kept so that the cancellation can be checked with CheckProgress.
+		return m.Executor.CancelOperation(requestID.RequestId)
+	}
+	m.Registry.Remove(requestID.RequestId)
+	m.Executor.ForgetOperation(requestID.RequestId)
 	return nil
 }
+
+// ResumeOperation executes again a failed provisioning starting from the step that failed. Operations restored
+// after a restart of the provisioner do not keep their credentials, so they are created again from the original
+// provisioning request, which must be included in the resume request. The webhooks are notified when the resumed
+// operation finishes.
+func (m *Manager) ResumeOperation(ctx context.Context, request *operations.ResumeRequest, profileID string, rollbackOnFailure bool, webhooks []string) (*grpc_provisioner_go.ProvisionClusterResponse, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+	operation, exists := m.Registry.Get(request.RequestID, entities.Provision)
+	if !exists {
+		return nil, derrors.NewNotFoundError("request_id not found")
+	}
+	checkpoint, err := m.resumableCheckpoint(operation)
+	if err != nil {
+		return nil, err
+	}
+	resumable, ok := operation.(entities.ResumableOperation)
+	if !ok {
+		resumable, err = m.recreateOperation(operation, request, profileID, rollbackOnFailure)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = resumable.Resume(*checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("requestID", request.RequestID).Str("failedStep", checkpoint.Failed).Msg("resuming operation")
+	m.Webhooks.Subscribe(request.RequestID, webhooks)
+	err = m.Executor.ScheduleOperationContext(ctx, resumable)
+	if err != nil {
+		m.Webhooks.Unsubscribe(request.RequestID)
+		return nil, err
+	}
+	m.Registry.Put(resumable)
+	result := resumable.Result()
+	return result.ToProvisionClusterResult()
+}
+
+// recreateOperation creates again an operation restored after a restart of the provisioner from its original
+// provisioning request.
+func (m *Manager) recreateOperation(restored entities.InfrastructureOperation, request *operations.ResumeRequest, profileID string, rollbackOnFailure bool) (entities.ResumableOperation, derrors.Error) {
+	if request.Provision == nil {
+		return nil, derrors.NewFailedPreconditionError("the provisioning request is required to resume an operation restored after a restart").WithParams(request.RequestID)
+	}
+	metadata := restored.Metadata()
+	if request.Provision.RequestId != request.RequestID || request.Provision.OrganizationId != metadata.OrganizationID ||
+		request.Provision.ClusterId != metadata.ClusterID {
+		return nil, derrors.NewInvalidArgumentError("provisioning request does not match the operation").WithParams(request.RequestID)
+	}
+	operation, err := m.newOperation(request.Provision, profileID, rollbackOnFailure)
+	if err != nil {
+		return nil, err
+	}
+	resumable, ok := operation.(entities.ResumableOperation)
+	if !ok {
+		return nil, derrors.NewFailedPreconditionError("operation does not support resuming").WithParams(request.RequestID)
+	}
+	return resumable, nil
+}
+
+// resumableCheckpoint returns the checkpoint from which an operation can be resumed.
+func (m *Manager) resumableCheckpoint(operation entities.InfrastructureOperation) (*entities.StepCheckpoint, derrors.Error) {
+	if m.Executor.IsManaged(operation.RequestID()) {
+		// Operations expired by the watchdog are managed until their execution actually returns.
+		return nil, derrors.NewFailedPreconditionError("operation is still being executed").WithParams(operation.RequestID())
+	}
+	if !operation.Progress().CanBeResumed() {
+		return nil, derrors.NewFailedPreconditionError("only failed operations can be resumed").WithParams(entities.TaskProgressToString[operation.Progress()])
+	}
+	provider, ok := operation.(entities.CheckpointProvider)
+	if !ok || provider.Checkpoint() == nil {
+		return nil, derrors.NewFailedPreconditionError("operation does not support resuming").WithParams(operation.RequestID())
+	}
+	return provider.Checkpoint(), nil
+}
+
+// WatchOperation sends the log entries and progress changes of a provisioning operation to a stream until the
+// operation finishes.
+func (m *Manager) WatchOperation(requestID *grpc_common_go.RequestId, stream watch.Stream) derrors.Error {
+	m.Lock()
+	operation, exists := m.Registry.Get(requestID.RequestId, entities.Provision)
+	m.Unlock()
+	if !exists {
+		return derrors.NewNotFoundError("request_id not found")
+	}
+	return watch.Serve(watch.GetHub(), operation, stream)
+}
@@ -21,6 +21,9 @@ import (
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/context"
 )
@@ -34,19 +37,40 @@ func NewHandler(manager Manager) *Handler {
 }
 
 // ScaleCluster triggers the rescaling of a given cluster by adding or removing nodes.
-func (h *Handler) ScaleCluster(_ context.Context, request *grpc_provisioner_go.ScaleClusterRequest) (*grpc_provisioner_go.ScaleClusterResponse, error) {
-	err := entities.ValidScaleClusterRequest(request)
+func (h *Handler) ScaleCluster(ctx context.Context, request *grpc_provisioner_go.ScaleClusterRequest) (*grpc_provisioner_go.ScaleClusterResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scaler.Handler.ScaleCluster",
+		tracing.RequestAttributes(request.RequestId, request.OrganizationId, request.ClusterId)...)
+	defer span.End()
+	profileID, err := profiles.IDFromContext(ctx)
+	if err == nil {
+		err = entities.ValidScaleClusterRequest(request, profileID)
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
+		return nil, conversions.ToGRPCError(err)
+	}
+	webhooks, err := h.Manager.Webhooks.URLsFromContext(ctx)
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		tracing.Fail(span, err)
 		return nil, conversions.ToGRPCError(err)
 	}
-	log.Debug().Interface("request", request).Msg("scale cluster")
-	return h.Manager.ScaleCluster(request)
+	log.Debug().Interface("request", redact.Value(request)).Msg("scale cluster")
+	response, sErr := h.Manager.ScaleCluster(ctx, request, profileID, webhooks)
+	tracing.Record(span, sErr)
+	return response, sErr
 }
 
 // CheckProgress gets an updated state of a scale request.
-func (h *Handler) CheckProgress(_ context.Context, requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ScaleClusterResponse, error) {
-	return h.Manager.CheckProgress(requestID)
+// The position of queued operations is sent in the response headers.
+func (h *Handler) CheckProgress(ctx context.Context, requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ScaleClusterResponse, error) {
+	response, err := h.Manager.CheckProgress(requestID)
+	if err != nil {
+		return nil, err
+	}
+	h.Manager.Executor.SendSchedulingHeaders(ctx, requestID.RequestId)
+	return response, nil
 }
 
 // RemoveScale cancels an ongoing scale process or removes the information of an already processed one.
@@ -17,12 +17,15 @@
 package scaler
 
 import (
+	"context"
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-provisioner-go"
 	"github.com/nalej/provisioner/internal/app/provisioner/provider"
 	"github.com/nalej/provisioner/internal/pkg/config"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
 	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"sync"
@@ -31,22 +34,36 @@ import (
 type Manager struct {
 	sync.Mutex
 	Config   config.Config
-	Executor workflow.Executor
-	// Operation per request identifier.
-	Operation map[string]entities.InfrastructureOperation
+	Executor *workflow.Executor
+	// Registry shared by the managers with the operations per request identifier.
+	Registry *workflow.Registry
+	// Webhooks notified when the operations finish.
+	Webhooks *webhook.Dispatcher
 }
 
 func NewManager(config config.Config) Manager {
+	executor := workflow.GetExecutor()
+	registry := workflow.GetRegistry()
+	// Recover the operations from previous executions of the provisioner.
+	for _, restored := range executor.RestoredOperations(entities.Scale) {
+		registry.Put(restored)
+	}
 	return Manager{
-		Config:    config,
-		Executor:  workflow.GetExecutor(),
-		Operation: make(map[string]entities.InfrastructureOperation, 0),
+		Config:   config,
+		Executor: executor,
+		Registry: registry,
+		Webhooks: webhook.GetDispatcher(),
 	}
 }
 
-// ScaleCluster triggers the rescaling of a given cluster by adding or removing nodes.
-func (m *Manager) ScaleCluster(request *grpc_provisioner_go.ScaleClusterRequest) (*grpc_provisioner_go.ScaleClusterResponse, error) {
-	infraProvider, err := provider.NewInfrastructureProvider(request.TargetPlatform, request.AzureCredentials, &m.Config)
+// ScaleCluster triggers the rescaling of a given cluster by adding or removing nodes. The credentials are taken
+// from the referenced credentials profile, if any. The webhooks are notified when the operation finishes.
+func (m *Manager) ScaleCluster(ctx context.Context, request *grpc_provisioner_go.ScaleClusterRequest, profileID string, webhooks []string) (*grpc_provisioner_go.ScaleClusterResponse, error) {
+	infraProvider, err := provider.NewInfrastructureProvider(entities.NewPlatform(request.TargetPlatform), provider.Credentials{
+		AzureCredentials: request.AzureCredentials,
+		ProfileID:        profileID,
+		OrganizationID:   request.OrganizationId,
+	}, &m.Config)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +75,17 @@ func (m *Manager) ScaleCluster(request *grpc_provisioner_go.ScaleClusterRequest)
 	m.Lock()
 	defer m.Unlock()
 	// Check if the operation is already registered
-	_, exists := m.Operation[request.RequestId]
-	if exists {
+	if m.Registry.Exists(request.RequestId) {
 		return nil, derrors.NewAlreadyExistsError("request is already being processed")
 	}
-	m.Operation[request.RequestId] = operation
 	// schedule the operation for execution
-	m.Executor.ScheduleOperation(operation)
+	m.Webhooks.Subscribe(request.RequestId, webhooks)
+	err = m.Executor.ScheduleOperationContext(ctx, operation)
+	if err != nil {
+		m.Webhooks.Unsubscribe(request.RequestId)
+		return nil, err
+	}
+	m.Registry.Put(operation)
 	// return initial response for the request
 	response := &grpc_provisioner_go.ScaleClusterResponse{
 		RequestId:   request.RequestId,
@@ -79,11 +100,12 @@ func (m *Manager) ScaleCluster(request *grpc_provisioner_go.ScaleClusterRequest)
 func (m *Manager) CheckProgress(requestID *grpc_common_go.RequestId) (*grpc_provisioner_go.ScaleClusterResponse, error) {
 	m.Lock()
 	defer m.Unlock()
-	operation, exists := m.Operation[requestID.RequestId]
+	operation, exists := m.Registry.Get(requestID.RequestId, entities.Scale)
 	if !exists {
 		return nil, derrors.NewNotFoundError("request_id not found")
 	}
 	result := operation.Result()
+	m.Executor.SetSchedulingState(&result)
 	return result.ToScaleClusterResult()
 }
 
@@ -91,10 +113,27 @@ func (m *Manager) CheckProgress(requestID *grpc_common_go.RequestId) (*grpc_prov
 func (m *Manager) RemoveScale(requestID *grpc_common_go.RequestId) derrors.Error {
 	m.Lock()
 	defer m.Unlock()
-	_, exists := m.Operation[requestID.RequestId]
+	_, exists := m.Registry.Get(requestID.RequestId, entities.Scale)
 	if !exists {
 		return derrors.NewNotFoundError("request_id not found")
 	}
-	delete(m.Operation, requestID.RequestId)
+	if m.Executor.IsManaged(requestID.RequestId) {
+		// The operation is kept so that the cancellation can be checked with CheckProgress.
+		return m.Executor.CancelOperation(requestID.RequestId)
+	}
+	m.Registry.Remove(requestID.RequestId)
+	m.Executor.ForgetOperation(requestID.RequestId)
 	return nil
 }
+
+// WatchOperation sends the log entries and progress changes of a scaling operation to a stream until the
+// operation finishes.
+func (m *Manager) WatchOperation(requestID *grpc_common_go.RequestId, stream watch.Stream) derrors.Error {
+	m.Lock()
+	operation, exists := m.Registry.Get(requestID.RequestId, entities.Scale)
+	m.Unlock()
+	if !exists {
+		return derrors.NewNotFoundError("request_id not found")
+	}
+	return watch.Serve(watch.GetHub(), operation, stream)
+}
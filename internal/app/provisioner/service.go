@@ -17,19 +17,50 @@
 package provisioner
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/app/provisioner/admin"
 	"github.com/nalej/provisioner/internal/app/provisioner/decommissioner"
+	"github.com/nalej/provisioner/internal/app/provisioner/gateway"
 	"github.com/nalej/provisioner/internal/app/provisioner/management"
+	"github.com/nalej/provisioner/internal/app/provisioner/operations"
+	"github.com/nalej/provisioner/internal/app/provisioner/profiles"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/baremetal"
+	"github.com/nalej/provisioner/internal/app/provisioner/provider/fake"
 	"github.com/nalej/provisioner/internal/app/provisioner/provisioner"
 	"github.com/nalej/provisioner/internal/app/provisioner/scaler"
+	"github.com/nalej/provisioner/internal/pkg/auth"
+	"github.com/nalej/provisioner/internal/pkg/certs"
+	"github.com/nalej/provisioner/internal/pkg/common"
 	"github.com/nalej/provisioner/internal/pkg/config"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/health"
+	"github.com/nalej/provisioner/internal/pkg/metrics"
+	pkgProfiles "github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// StopTimeout with the maximum time to wait for the gRPC calls in progress once the operations have been stopped.
+const StopTimeout = 10 * time.Second
+
 type Service struct {
 	Configuration config.Config
 }
@@ -53,6 +84,45 @@ func (s *Service) Run() error {
 		log.Fatal().Errs("failed to listen: %v", []error{err})
 	}
 
+	tracerProvider, tErr := tracing.Setup(s.Configuration.TracingExporter, s.Configuration.TracingEndpoint, s.Configuration.TracingSampleRatio)
+	if tErr != nil {
+		log.Fatal().Str("trace", tErr.DebugReport()).Msg("cannot configure tracing")
+	}
+	defer tracerProvider.Shutdown(context.Background())
+
+	// The store must be configured before creating the managers so that they can recover previous operations.
+	operationStore, sErr := store.NewOperationStore(s.Configuration.StorePath)
+	if sErr != nil {
+		log.Fatal().Str("trace", sErr.DebugReport()).Msg("cannot open operation store")
+	}
+	sErr = workflow.GetExecutor().UseStore(operationStore, s.Configuration.CheckpointInterval)
+	if sErr != nil {
+		log.Fatal().Str("trace", sErr.DebugReport()).Msg("cannot restore operations")
+	}
+	if policy, exists := workflow.LockPolicyFromString[s.Configuration.ClusterLockPolicy]; exists {
+		workflow.GetExecutor().SetLockPolicy(policy)
+	}
+	maxConcurrent := s.Configuration.MaxConcurrentOperations
+	if maxConcurrent == 0 {
+		maxConcurrent = workflow.MaxConcurrentOperation
+	}
+	workflow.GetExecutor().SetConcurrency(maxConcurrent, s.Configuration.MaxConcurrentPerOrganization)
+	workflow.GetExecutor().SetDeadlines(map[entities.OperationType]time.Duration{
+		entities.Provision:    s.Configuration.ProvisionDeadline,
+		entities.Scale:        s.Configuration.ScaleDeadline,
+		entities.Decommission: s.Configuration.DecommissionDeadline,
+		entities.Management:   s.Configuration.ManagementDeadline,
+	}, s.Configuration.StalledOperationTimeout)
+	workflow.GetExecutor().StartWatchdog(workflow.DefaultWatchdogInterval)
+	deliveryStore := s.configureWebhooks()
+	s.configureProfiles()
+	s.configureFakeProvider()
+	s.configureBareMetalProvider()
+	workflow.GetRegistry().SetTTL(s.Configuration.OperationTTL)
+	workflow.GetRegistry().StartGC(workflow.DefaultRegistryGCInterval, workflow.GetExecutor())
+	monitor := s.configureHealth()
+	s.launchMonitoringServers(monitor)
+
 	provisionerManager := provisioner.NewManager(s.Configuration)
 	provisionerHandler := provisioner.NewHandler(provisionerManager)
 
@@ -65,21 +135,268 @@ func (s *Service) Run() error {
 	mngtManager := management.NewManager(s.Configuration)
 	mngtHandler := management.NewHandler(mngtManager)
 
-	grpcServer := grpc.NewServer()
+	operationsManager := operations.NewManager()
+	operationsHandler := operations.NewHandler(operationsManager, provisionerHandler,
+		&provisionerHandler.Manager, &scaleHandler.Manager, &decommissionHandler.Manager)
+
+	adminManager := admin.NewManager()
+	adminHandler := admin.NewHandler(adminManager)
+
+	profilesManager := profiles.NewManager()
+	profilesHandler := profiles.NewHandler(profilesManager)
+
+	auditLog, aErr := auth.NewAuditLog(s.Configuration.AuditLogPath, organizationOf)
+	if aErr != nil {
+		log.Fatal().Str("trace", aErr.DebugReport()).Msg("cannot open audit log")
+	}
+	defer auditLog.Close()
+	unaryInterceptors := []grpc.UnaryServerInterceptor{tracing.UnaryServerInterceptor(), auditLog.UnaryServerInterceptor()}
+	streamInterceptors := []grpc.StreamServerInterceptor{tracing.StreamServerInterceptor()}
+	if len(s.Configuration.AuthKeyPaths) > 0 {
+		authenticator, aErr := auth.NewAuthenticator(s.Configuration.AuthIssuer, s.Configuration.AuthAudience, s.Configuration.AuthKeyPaths)
+		if aErr != nil {
+			log.Fatal().Str("trace", aErr.DebugReport()).Msg("cannot load token keys")
+		}
+		interceptor := auth.NewInterceptor(authenticator, organizationOf)
+		unaryInterceptors = append(unaryInterceptors, interceptor.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, interceptor.StreamServerInterceptor())
+	}
+	unaryInterceptor := common.ChainUnaryInterceptors(unaryInterceptors...)
+	serverOptions := []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StreamInterceptor(common.ChainStreamInterceptors(streamInterceptors...)),
+	}
+	var tlsConfig *tls.Config
+	if s.Configuration.TLSCertPath != "" {
+		reloader, cErr := certs.NewReloader(s.Configuration.TLSCertPath, s.Configuration.TLSKeyPath, s.Configuration.TLSClientCAPath)
+		if cErr != nil {
+			log.Fatal().Str("trace", cErr.DebugReport()).Msg("cannot load TLS certificates")
+		}
+		reloader.Start(s.Configuration.TLSReloadInterval)
+		defer reloader.Stop()
+		tlsConfig = reloader.ServerConfig(s.Configuration.TLSRequireClientCert)
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
 	grpc_provisioner_go.RegisterProvisionServer(grpcServer, provisionerHandler)
 	grpc_provisioner_go.RegisterDecommissionServer(grpcServer, decommissionHandler)
 	grpc_provisioner_go.RegisterScaleServer(grpcServer, scaleHandler)
 	grpc_provisioner_go.RegisterManagementServer(grpcServer, mngtHandler)
+	operations.RegisterOperationsServer(grpcServer, operationsHandler)
+	admin.RegisterAdminServer(grpcServer, adminHandler)
+	profiles.RegisterProfilesServer(grpcServer, profilesHandler)
+	monitor.Register(grpcServer)
 
 	if s.Configuration.Debug {
 		log.Info().Msg("Enabling gRPC server reflection")
 		// Register reflection service on gRPC server.
 		reflection.Register(grpcServer)
 	}
+	var gatewayServer *http.Server
+	if s.Configuration.GatewayPort > 0 {
+		gatewayServer = s.launchGateway(gateway.Servers{
+			Provision:    provisionerHandler,
+			Scale:        scaleHandler,
+			Decommission: decommissionHandler,
+			Management:   mngtHandler,
+		}, unaryInterceptor, tlsConfig)
+	}
 	log.Info().Msg("Launching gRPC server")
+	go s.waitForShutdown(grpcServer, gatewayServer, monitor)
 
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatal().Errs("failed to serve: %v", []error{err})
 	}
+	if cErr := workflow.GetExecutor().Close(); cErr != nil {
+		log.Error().Str("trace", cErr.DebugReport()).Msg("cannot close operation store")
+	}
+	if cErr := deliveryStore.Close(); cErr != nil {
+		log.Error().Str("trace", cErr.DebugReport()).Msg("cannot close webhook delivery store")
+	}
+	log.Info().Msg("provisioner stopped")
 	return nil
 }
+
+// waitForShutdown stops the service when a termination signal is received. New operations are rejected while
+// the running ones are given the grace period to finish, the gRPC server keeps serving the queries meanwhile.
+func (s *Service) waitForShutdown(grpcServer *grpc.Server, gatewayServer *http.Server, monitor *health.Monitor) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	received := <-signals
+	signal.Stop(signals)
+	log.Info().Str("signal", received.String()).Str("grace", s.Configuration.ShutdownGracePeriod.String()).Msg("shutting down provisioner")
+	monitor.Shutdown()
+	interrupted := workflow.GetExecutor().Shutdown(s.Configuration.ShutdownGracePeriod)
+	if interrupted > 0 {
+		log.Warn().Int("interrupted", interrupted).Msg("operations will be interrupted")
+	}
+	webhook.GetDispatcher().Stop()
+	if gatewayServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+		if err := gatewayServer.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("closing the HTTP gateway calls in progress")
+		}
+		cancel()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(StopTimeout):
+		log.Warn().Msg("closing the gRPC calls in progress")
+		grpcServer.Stop()
+	}
+}
+
+// configureWebhooks restores the webhook delivery log and attaches the dispatcher to the executor. It returns the
+// store of the delivery log.
+func (s *Service) configureWebhooks() webhook.DeliveryStore {
+	deliveryStore, err := webhook.NewDeliveryStore(s.Configuration.WebhookStorePath, webhook.DefaultRetention)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot open webhook delivery store")
+	}
+	dispatcher := webhook.GetDispatcher()
+	dispatcher.Configure(s.Configuration.WebhookURLs, s.Configuration.WebhookSecret, s.Configuration.WebhookMaxAttempts)
+	policy, err := webhook.NewURLPolicy(s.Configuration.WebhookAllowedHosts)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("invalid webhook allowed hosts")
+	}
+	dispatcher.SetURLPolicy(policy)
+	err = dispatcher.UseStore(deliveryStore)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot restore webhook deliveries")
+	}
+	workflow.GetExecutor().AddObserver(dispatcher)
+	return deliveryStore
+}
+
+// configureProfiles loads the credentials profiles from the profile directory and the Kubernetes secrets. The
+// provisioner does not start if any of them is invalid.
+func (s *Service) configureProfiles() {
+	registry := pkgProfiles.GetRegistry()
+	if s.Configuration.CredentialsProfilesPath != "" {
+		loaded, err := pkgProfiles.LoadDirectory(s.Configuration.CredentialsProfilesPath)
+		if err != nil {
+			log.Fatal().Str("trace", err.DebugReport()).Msg("cannot load credentials profiles")
+		}
+		registry.Load(loaded)
+		registry.SetPath(s.Configuration.CredentialsProfilesPath)
+	}
+	if s.Configuration.CredentialsProfilesNamespace != "" {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot access the Kubernetes API to load credentials profiles")
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot create Kubernetes client to load credentials profiles")
+		}
+		loaded, lErr := pkgProfiles.LoadKubernetesSecrets(client, s.Configuration.CredentialsProfilesNamespace, s.Configuration.CredentialsProfilesSelector)
+		if lErr != nil {
+			log.Fatal().Str("trace", lErr.DebugReport()).Msg("cannot load credentials profiles")
+		}
+		registry.Load(loaded)
+	}
+	log.Info().Int("profiles", len(registry.List())).Msg("credentials profiles loaded")
+}
+
+// configureFakeProvider checks the behavior of the fake provider and loads its inventory so that a wrong
+// configuration is reported on start instead of on the first request.
+func (s *Service) configureFakeProvider() {
+	if !s.Configuration.EnableFakeProvider {
+		return
+	}
+	if _, err := fake.NewFakeInfrastructureProvider(&s.Configuration); err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot configure the fake provider")
+	}
+	inventory, _ := fake.GetInventory(s.Configuration.FakeInventoryPath)
+	log.Info().Int("clusters", len(inventory.List())).Msg("fake cluster inventory loaded")
+}
+
+// configureBareMetalProvider loads the inventory of hosts and the SSH credentials of the bare-metal provider so
+// that a wrong configuration is reported on start instead of on the first request.
+func (s *Service) configureBareMetalProvider() {
+	if s.Configuration.BareMetalInventoryPath == "" {
+		return
+	}
+	if _, err := baremetal.NewBareMetalInfrastructureProvider(&s.Configuration); err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot configure the bare-metal provider")
+	}
+	inventory, _ := baremetal.GetInventory(s.Configuration.BareMetalInventoryPath)
+	log.Info().Int("hosts", len(inventory.List())).Msg("bare-metal host inventory loaded")
+}
+
+// configureHealth creates the monitor reporting whether the provisioner can accept operations.
+func (s *Service) configureHealth() *health.Monitor {
+	monitor := health.NewMonitor()
+	monitor.AddCheck("executor", health.ExecutorCheck(workflow.GetExecutor()))
+	monitor.AddCheck("store", health.StoreCheck(workflow.GetExecutor()))
+	monitor.AddCheck("profiles", health.ProfilesCheck(pkgProfiles.GetRegistry()))
+	monitor.Start(health.DefaultInterval)
+	return monitor
+}
+
+// organizationOf returns the organization of a registered operation.
+func organizationOf(requestID string) (string, bool) {
+	operation, found := workflow.GetRegistry().Find(requestID)
+	if !found {
+		return "", false
+	}
+	return operation.Metadata().OrganizationID, true
+}
+
+// launchGateway serves the API as JSON over HTTP. The calls go through the interceptors of the gRPC server, and TLS
+// is used with the same certificates when enabled.
+func (s *Service) launchGateway(servers gateway.Servers, interceptor grpc.UnaryServerInterceptor, tlsConfig *tls.Config) *http.Server {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.GatewayPort))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to listen for the HTTP gateway")
+	}
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, gateway.TLSConfig(tlsConfig))
+	}
+	server := &http.Server{Handler: gateway.NewGateway(servers, interceptor).Handler()}
+	go func() {
+		log.Info().Int("port", s.Configuration.GatewayPort).Bool("tls", tlsConfig != nil).Msg("Launching HTTP gateway")
+		err := server.Serve(lis)
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("failed to serve HTTP gateway")
+		}
+	}()
+	return server
+}
+
+// launchMonitoringServers attaches the metrics to the executor and serves them and the health endpoints through
+// HTTP. The health endpoints do not depend on the metrics being enabled, and a single server is launched if both
+// share the same port.
+func (s *Service) launchMonitoringServers(monitor *health.Monitor) {
+	muxes := make(map[int]*http.ServeMux, 0)
+	muxFor := func(port int) *http.ServeMux {
+		if _, exists := muxes[port]; !exists {
+			muxes[port] = http.NewServeMux()
+		}
+		return muxes[port]
+	}
+	if s.Configuration.MetricsPort > 0 {
+		operationMetrics := metrics.NewMetrics(workflow.GetExecutor())
+		operationMetrics.Attach(workflow.GetExecutor(), watch.GetHub())
+		muxFor(s.Configuration.MetricsPort).Handle(metrics.Path, operationMetrics.Handler())
+	}
+	if s.Configuration.HealthPort > 0 {
+		mux := muxFor(s.Configuration.HealthPort)
+		mux.Handle(health.LivenessPath, monitor.LivenessHandler())
+		mux.Handle(health.ReadinessPath, monitor.ReadinessHandler())
+	}
+	for port, mux := range muxes {
+		go func(port int, mux *http.ServeMux) {
+			log.Info().Int("port", port).Msg("Launching monitoring server")
+			err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+			if err != nil {
+				log.Fatal().Err(err).Int("port", port).Msg("failed to serve metrics and health endpoints")
+			}
+		}(port, mux)
+	}
+}
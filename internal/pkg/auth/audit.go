@@ -0,0 +1,149 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// AuditEntry with the record of a call that changes the state of the clusters or the provisioner.
+type AuditEntry struct {
+	// Timestamp of the call in RFC3339 format.
+	Timestamp string `json:"timestamp"`
+	// Method called.
+	Method string `json:"method"`
+	// Caller with the subject of the token, the common name of the client certificate or anonymous.
+	Caller string `json:"caller"`
+	// Authenticated determines if the caller presented a valid token.
+	Authenticated bool `json:"authenticated"`
+	// OrganizationID targeted by the call, if known.
+	OrganizationID string `json:"organization_id,omitempty"`
+	// RequestID of the operation, if known.
+	RequestID string `json:"request_id,omitempty"`
+	// Peer with the address of the caller.
+	Peer string `json:"peer,omitempty"`
+	// Outcome with the gRPC status code of the call.
+	Outcome string `json:"outcome"`
+	// Error returned to the caller, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLog writes the calls that change the state of the clusters to an append-only file.
+type AuditLog struct {
+	sync.Mutex
+	// file where the entries are appended. If nil, the entries are written to the service log.
+	file     *os.File
+	resolver OrganizationResolver
+}
+
+// NewAuditLog opens the audit log on a given path. If the path is empty, the entries are written to the
+// service log. The resolver is used to find the organization of the requests that only carry a request identifier.
+func NewAuditLog(path string, resolver OrganizationResolver) (*AuditLog, derrors.Error) {
+	auditLog := &AuditLog{resolver: resolver}
+	if path == "" {
+		return auditLog, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot open audit log")
+	}
+	auditLog.file = file
+	return auditLog, nil
+}
+
+// Record writes an entry to the audit log.
+func (al *AuditLog) Record(entry AuditEntry) derrors.Error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal audit entry")
+	}
+	al.Lock()
+	defer al.Unlock()
+	if al.file == nil {
+		log.Info().RawJSON("audit", raw).Msg("audit")
+		return nil
+	}
+	if _, err := al.file.Write(append(raw, '\n')); err != nil {
+		return derrors.AsError(err, "cannot write audit entry")
+	}
+	if err := al.file.Sync(); err != nil {
+		return derrors.AsError(err, "cannot sync audit log")
+	}
+	return nil
+}
+
+// Close closes the audit log.
+func (al *AuditLog) Close() derrors.Error {
+	al.Lock()
+	defer al.Unlock()
+	if al.file == nil {
+		return nil
+	}
+	err := al.file.Close()
+	al.file = nil
+	if err != nil {
+		return derrors.AsError(err, "cannot close audit log")
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns an interceptor recording the calls to mutating methods, including the rejected
+// ones. It must be placed before the authentication interceptor to know the identity of the caller.
+func (al *AuditLog) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !IsMutating(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		call := &callInfo{}
+		// The organization is resolved before the call as removals make the operation disappear.
+		organizationID, _ := requestOrganization(req, al.resolver)
+		resp, err := handler(context.WithValue(ctx, callInfoKey{}, call), req)
+		entry := AuditEntry{
+			Timestamp:      time.Now().UTC().Format(time.RFC3339),
+			Method:         info.FullMethod,
+			Caller:         AnonymousCaller,
+			OrganizationID: organizationID,
+			Peer:           peerAddress(ctx),
+			Outcome:        status.Code(err).String(),
+		}
+		if call.identity != nil {
+			entry.Caller = call.identity.Subject
+			entry.Authenticated = call.identity.Authenticated
+		} else {
+			entry.Caller = CallerName(ctx)
+		}
+		if withID, ok := req.(interface{ GetRequestId() string }); ok {
+			entry.RequestID = withID.GetRequestId()
+		}
+		if err != nil {
+			entry.Error = status.Convert(err).Message()
+		}
+		if rErr := al.Record(entry); rErr != nil {
+			log.Error().Str("trace", rErr.DebugReport()).Str("method", info.FullMethod).Msg("cannot write audit entry")
+		}
+		return resp, err
+	}
+}
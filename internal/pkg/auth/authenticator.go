@@ -0,0 +1,156 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nalej/derrors"
+)
+
+// Claims with the content of the tokens accepted by the provisioner.
+type Claims struct {
+	jwt.StandardClaims
+	// Organizations the bearer can act on. Use * to allow every organization.
+	Organizations []string `json:"organizations"`
+	// Operations the bearer can perform: provision, scale, decommission, management or admin. Use * to allow
+	// every operation.
+	Operations []string `json:"operations"`
+}
+
+// Authenticator validates the bearer tokens of the requests.
+type Authenticator struct {
+	issuer   string
+	audience string
+	// keys used to verify the signature of the tokens. Several keys may be accepted during a rotation.
+	keys []interface{}
+}
+
+// NewAuthenticator creates an authenticator accepting the tokens of a given issuer and audience signed with any of
+// the keys found on the given paths. Files with PEM encoded RSA or ECDSA public keys verify RS* and ES* tokens,
+// other files are used as HMAC secrets to verify HS* tokens. Empty issuer or audience are not checked.
+func NewAuthenticator(issuer string, audience string, keyPaths []string) (*Authenticator, derrors.Error) {
+	if len(keyPaths) == 0 {
+		return nil, derrors.NewInvalidArgumentError("at least a key is required to verify the tokens")
+	}
+	keys := make([]interface{}, 0, len(keyPaths))
+	for _, path := range keyPaths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot read token key")
+		}
+		key, kErr := parseKey(raw)
+		if kErr != nil {
+			return nil, kErr.WithParams(path)
+		}
+		keys = append(keys, key)
+	}
+	return &Authenticator{
+		issuer:   issuer,
+		audience: audience,
+		keys:     keys,
+	}, nil
+}
+
+// parseKey parses a public key or an HMAC secret.
+func parseKey(raw []byte) (interface{}, *derrors.GenericError) {
+	if !bytes.Contains(raw, []byte("-----BEGIN")) {
+		secret := bytes.TrimSpace(raw)
+		if len(secret) == 0 {
+			return nil, derrors.NewInvalidArgumentError("token secret is empty")
+		}
+		return secret, nil
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(raw); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(raw); err == nil {
+		return key, nil
+	}
+	return nil, derrors.NewInvalidArgumentError("token key must be a PEM encoded RSA or ECDSA public key")
+}
+
+// Authenticate validates a token returning the identity of its bearer.
+func (a *Authenticator) Authenticate(token string) (*Identity, derrors.Error) {
+	var lastErr error
+	for _, key := range a.keys {
+		claims := &Claims{}
+		_, err := jwt.ParseWithClaims(token, claims, keyFunc(key))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return a.identity(claims)
+	}
+	return nil, derrors.NewUnauthenticatedError("invalid token", lastErr)
+}
+
+// keyFunc returns the key to verify a token only if the signing method of the token matches the type of key.
+func keyFunc(key interface{}) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		valid := false
+		switch key.(type) {
+		case *rsa.PublicKey:
+			_, valid = token.Method.(*jwt.SigningMethodRSA)
+		case *ecdsa.PublicKey:
+			_, valid = token.Method.(*jwt.SigningMethodECDSA)
+		case []byte:
+			_, valid = token.Method.(*jwt.SigningMethodHMAC)
+		}
+		if !valid {
+			return nil, derrors.NewUnauthenticatedError("unexpected signing method").WithParams(token.Header["alg"])
+		}
+		return key, nil
+	}
+}
+
+// identity checks the claims of a valid token and returns the identity of the bearer.
+func (a *Authenticator) identity(claims *Claims) (*Identity, derrors.Error) {
+	if claims.ExpiresAt == 0 {
+		return nil, derrors.NewUnauthenticatedError("token must expire")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, derrors.NewUnauthenticatedError("unexpected token issuer").WithParams(claims.Issuer)
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, derrors.NewUnauthenticatedError("unexpected token audience").WithParams(claims.Audience)
+	}
+	if claims.Subject == "" {
+		return nil, derrors.NewUnauthenticatedError("token must have a subject")
+	}
+	return &Identity{
+		Subject:       claims.Subject,
+		Issuer:        claims.Issuer,
+		Organizations: claims.Organizations,
+		Operations:    normalize(claims.Operations),
+		Authenticated: true,
+	}, nil
+}
+
+// normalize lowercases a list of values.
+func normalize(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.ToLower(value))
+	}
+	return result
+}
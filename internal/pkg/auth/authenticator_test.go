@@ -0,0 +1,152 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const testIssuer = "https://issuer.nalej.com"
+const testAudience = "provisioner"
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newClaims returns valid claims for the tests.
+func newClaims(subject string, organizations []string, operations []string) *Claims {
+	return &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   subject,
+			Issuer:    testIssuer,
+			Audience:  testAudience,
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Organizations: organizations,
+		Operations:    operations,
+	}
+}
+
+// sign signs a set of claims with a given method and key.
+func sign(method jwt.SigningMethod, key interface{}, claims *Claims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return token
+}
+
+// writeFile writes a file on a directory returning its path.
+func writeFile(dir string, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	gomega.Expect(ioutil.WriteFile(path, content, 0600)).To(gomega.Succeed())
+	return path
+}
+
+var _ = ginkgo.Describe("Authenticator", func() {
+
+	var dir string
+	var rsaKey *rsa.PrivateKey
+	var authenticator *Authenticator
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auth")
+		gomega.Expect(err).To(gomega.Succeed())
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		gomega.Expect(err).To(gomega.Succeed())
+		public, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		gomega.Expect(err).To(gomega.Succeed())
+		publicPath := writeFile(dir, "public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+		secretPath := writeFile(dir, "secret", append(testSecret, '\n'))
+		var aErr error
+		authenticator, aErr = NewAuthenticator(testIssuer, testAudience, []string{publicPath, secretPath})
+		gomega.Expect(aErr).To(gomega.BeNil())
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	ginkgo.It("accepts tokens signed with any of the keys", func() {
+		claims := newClaims("user", []string{"org1"}, []string{"Provision"})
+		for _, token := range []string{sign(jwt.SigningMethodRS256, rsaKey, claims), sign(jwt.SigningMethodHS256, testSecret, claims)} {
+			identity, err := authenticator.Authenticate(token)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(identity.Subject).To(gomega.Equal("user"))
+			gomega.Expect(identity.Authenticated).To(gomega.BeTrue())
+			gomega.Expect(identity.CanAccessOrganization("org1")).To(gomega.BeTrue())
+			gomega.Expect(identity.CanAccessOrganization("org2")).To(gomega.BeFalse())
+			gomega.Expect(identity.CanPerform(ProvisionOperation)).To(gomega.BeTrue())
+			gomega.Expect(identity.CanPerform(DecommissionOperation)).To(gomega.BeFalse())
+		}
+	})
+
+	ginkgo.It("rejects expired tokens and tokens without expiration", func() {
+		claims := newClaims("user", []string{"org1"}, []string{"*"})
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		_, err := authenticator.Authenticate(sign(jwt.SigningMethodHS256, testSecret, claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		claims.ExpiresAt = 0
+		_, err = authenticator.Authenticate(sign(jwt.SigningMethodHS256, testSecret, claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects tokens from other issuers or audiences", func() {
+		claims := newClaims("user", []string{"org1"}, []string{"*"})
+		claims.Issuer = "other"
+		_, err := authenticator.Authenticate(sign(jwt.SigningMethodHS256, testSecret, claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		claims = newClaims("user", []string{"org1"}, []string{"*"})
+		claims.Audience = "other"
+		_, err = authenticator.Authenticate(sign(jwt.SigningMethodHS256, testSecret, claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects tokens signed with unknown keys", func() {
+		claims := newClaims("user", []string{"org1"}, []string{"*"})
+		_, err := authenticator.Authenticate(sign(jwt.SigningMethodHS256, []byte("another secret"), claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		otherKey, gErr := rsa.GenerateKey(rand.Reader, 2048)
+		gomega.Expect(gErr).To(gomega.Succeed())
+		_, err = authenticator.Authenticate(sign(jwt.SigningMethodRS256, otherKey, claims))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects HMAC tokens signed with the public key", func() {
+		public, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		gomega.Expect(err).To(gomega.Succeed())
+		publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+		claims := newClaims("user", []string{"*"}, []string{"*"})
+		_, aErr := authenticator.Authenticate(sign(jwt.SigningMethodHS256, publicPEM, claims))
+		gomega.Expect(aErr).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("requires a key", func() {
+		_, err := NewAuthenticator(testIssuer, testAudience, []string{})
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = NewAuthenticator(testIssuer, testAudience, []string{filepath.Join(dir, "missing")})
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+})
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// AnyValue grants access to every organization or operation when found in the claims of a token.
+const AnyValue = "*"
+
+// AnonymousCaller with the name of the callers that could not be identified.
+const AnonymousCaller = "anonymous"
+
+const (
+	// ProvisionOperation allows provisioning clusters and querying the provisioning operations.
+	ProvisionOperation = "provision"
+	// ScaleOperation allows scaling clusters and querying the scaling operations.
+	ScaleOperation = "scale"
+	// DecommissionOperation allows decommissioning clusters and querying the decommission operations.
+	DecommissionOperation = "decommission"
+	// ManagementOperation allows retrieving the kubeconfig of the clusters.
+	ManagementOperation = "management"
+	// AdminOperation allows administering the provisioner.
+	AdminOperation = "admin"
+)
+
+// Identity of the caller of a method.
+type Identity struct {
+	// Subject with the caller identifier.
+	Subject string
+	// Issuer of the token of the caller.
+	Issuer string
+	// Organizations the caller can access.
+	Organizations []string
+	// Operations the caller can perform.
+	Operations []string
+	// Authenticated determines if the identity was verified with a token.
+	Authenticated bool
+}
+
+// CanAccessOrganization checks if the caller can act on a given organization.
+func (i *Identity) CanAccessOrganization(organizationID string) bool {
+	return contains(i.Organizations, organizationID)
+}
+
+// CanAccessAllOrganizations checks if the caller can act on any organization.
+func (i *Identity) CanAccessAllOrganizations() bool {
+	return contains(i.Organizations, AnyValue)
+}
+
+// CanPerform checks if the caller can perform a given type of operation.
+func (i *Identity) CanPerform(operation string) bool {
+	return contains(i.Operations, operation)
+}
+
+// contains checks if a value or the wildcard is found in a list.
+func contains(values []string, value string) bool {
+	for _, current := range values {
+		if current == value || current == AnyValue {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// callInfoKey identifies the information of the call shared by the interceptors.
+type callInfoKey struct{}
+
+// callInfo with the information of a call collected by the interceptors for the audit log.
+type callInfo struct {
+	identity *Identity
+}
+
+// WithIdentity returns a context carrying the identity of the caller.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	if info, ok := ctx.Value(callInfoKey{}).(*callInfo); ok {
+		info.identity = identity
+	}
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the caller if it was authenticated.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// CallerName returns the best available name of the caller: the subject of its token, the common name of its
+// client certificate or its address.
+func CallerName(ctx context.Context) string {
+	if identity, ok := IdentityFromContext(ctx); ok && identity.Subject != "" {
+		return identity.Subject
+	}
+	if certificate := peerCertificate(ctx); certificate != nil {
+		return certificate.Subject.CommonName
+	}
+	return AnonymousCaller
+}
+
+// peerCertificate returns the client certificate presented on the TLS connection of the call, if any.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	caller, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := caller.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return tlsInfo.State.PeerCertificates[0]
+}
+
+// peerAddress returns the address of the caller.
+func peerAddress(ctx context.Context) string {
+	caller, ok := peer.FromContext(ctx)
+	if !ok || caller.Addr == nil {
+		return ""
+	}
+	return caller.Addr.String()
+}
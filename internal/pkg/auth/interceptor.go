@@ -0,0 +1,152 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// AuthorizationMetadataKey with the metadata key carrying the bearer token of the caller.
+const AuthorizationMetadataKey = "authorization"
+
+// bearerPrefix expected before the token in the authorization metadata.
+const bearerPrefix = "bearer "
+
+// Interceptor authenticates and authorizes the calls to the gRPC API.
+type Interceptor struct {
+	authenticator *Authenticator
+	resolver      OrganizationResolver
+}
+
+// NewInterceptor creates an interceptor validating the tokens with a given authenticator. The resolver is used to
+// find the organization of the requests that only carry a request identifier.
+func NewInterceptor(authenticator *Authenticator, resolver OrganizationResolver) *Interceptor {
+	return &Interceptor{
+		authenticator: authenticator,
+		resolver:      resolver,
+	}
+}
+
+// tokenFromContext extracts the bearer token from the metadata of the incoming call.
+func tokenFromContext(ctx context.Context) (string, derrors.Error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", derrors.NewUnauthenticatedError("bearer token is required")
+	}
+	values := md.Get(AuthorizationMetadataKey)
+	if len(values) == 0 {
+		return "", derrors.NewUnauthenticatedError("bearer token is required")
+	}
+	value := strings.TrimSpace(values[0])
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return "", derrors.NewUnauthenticatedError("authorization must use the Bearer scheme")
+	}
+	return strings.TrimSpace(value[len(bearerPrefix):]), nil
+}
+
+// authenticate returns the identity of the caller.
+func (i *Interceptor) authenticate(ctx context.Context) (*Identity, derrors.Error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return i.authenticator.Authenticate(token)
+}
+
+// authorize checks if the caller can send a request to a method.
+func (i *Interceptor) authorize(ctx context.Context, identity *Identity, fullMethod string, request interface{}) derrors.Error {
+	_, err := Authorize(identity, fullMethod, request, i.resolver)
+	if err != nil {
+		log.Warn().Str("caller", identity.Subject).Str("method", fullMethod).Str("peer", peerAddress(ctx)).
+			Str("err", err.Error()).Msg("call denied")
+	}
+	return err
+}
+
+// UnaryServerInterceptor returns an interceptor rejecting the unary calls of unauthenticated or unauthorized
+// callers. Public services are not checked.
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if IsPublic(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		identity, err := i.authenticate(ctx)
+		if err != nil {
+			log.Warn().Str("method", info.FullMethod).Str("peer", peerAddress(ctx)).Str("err", err.Error()).Msg("unauthenticated call")
+			return nil, conversions.ToGRPCError(err)
+		}
+		ctx = WithIdentity(ctx, identity)
+		if err := i.authorize(ctx, identity, info.FullMethod, req); err != nil {
+			return nil, conversions.ToGRPCError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor rejecting the streams of unauthenticated callers. Each message
+// received from the client is authorized as a unary request would be.
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if IsPublic(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		identity, err := i.authenticate(ss.Context())
+		if err != nil {
+			log.Warn().Str("method", info.FullMethod).Str("peer", peerAddress(ss.Context())).Str("err", err.Error()).Msg("unauthenticated call")
+			return conversions.ToGRPCError(err)
+		}
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			ctx:          WithIdentity(ss.Context(), identity),
+			interceptor:  i,
+			identity:     identity,
+			fullMethod:   info.FullMethod,
+		})
+	}
+}
+
+// authorizedStream authorizes the messages received on a server stream.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx         context.Context
+	interceptor *Interceptor
+	identity    *Identity
+	fullMethod  string
+}
+
+// Context returns the context of the stream carrying the identity of the caller.
+func (as *authorizedStream) Context() context.Context {
+	return as.ctx
+}
+
+// RecvMsg receives a message and checks that the caller is allowed to send it.
+func (as *authorizedStream) RecvMsg(m interface{}) error {
+	if err := as.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := as.interceptor.authorize(as.ctx, as.identity, as.fullMethod, m); err != nil {
+		return conversions.ToGRPCError(err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/common"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Interceptors", func() {
+
+	const provisionMethod = "/provisioner.Provision/ProvisionCluster"
+
+	var dir string
+	var auditLog *AuditLog
+	var interceptor grpc.UnaryServerInterceptor
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, found := IdentityFromContext(ctx)
+		gomega.Expect(found).To(gomega.BeTrue())
+		return identity.Subject, nil
+	}
+
+	// call invokes the interceptor chain with a given token.
+	call := func(token string, method string, request interface{}) (interface{}, error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(AuthorizationMetadataKey, "Bearer "+token))
+		}
+		return interceptor(ctx, request, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	// entries reads the audit log.
+	entries := func() []AuditEntry {
+		raw, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+		gomega.Expect(err).To(gomega.Succeed())
+		result := make([]AuditEntry, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			entry := AuditEntry{}
+			gomega.Expect(json.Unmarshal([]byte(line), &entry)).To(gomega.Succeed())
+			result = append(result, entry)
+		}
+		return result
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "audit")
+		gomega.Expect(err).To(gomega.Succeed())
+		secretPath := writeFile(dir, "secret", testSecret)
+		authenticator, aErr := NewAuthenticator(testIssuer, testAudience, []string{secretPath})
+		gomega.Expect(aErr).To(gomega.BeNil())
+		auditLog, aErr = NewAuditLog(filepath.Join(dir, "audit.log"), nil)
+		gomega.Expect(aErr).To(gomega.BeNil())
+		interceptor = common.ChainUnaryInterceptors(auditLog.UnaryServerInterceptor(),
+			NewInterceptor(authenticator, nil).UnaryServerInterceptor())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(auditLog.Close()).To(gomega.BeNil())
+		_ = os.RemoveAll(dir)
+	})
+
+	ginkgo.It("rejects calls without a valid token", func() {
+		_, err := call("", provisionMethod, &grpc_provisioner_go.ProvisionClusterRequest{OrganizationId: "org1"})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unauthenticated))
+		_, err = call("invalid", provisionMethod, &grpc_provisioner_go.ProvisionClusterRequest{OrganizationId: "org1"})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unauthenticated))
+	})
+
+	ginkgo.It("allows the health checks without a token", func() {
+		public := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "serving", nil
+		}
+		result, err := interceptor(context.Background(), &grpc_common_go.Empty{},
+			&grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, public)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.Equal("serving"))
+		_, err = interceptor(context.Background(), &grpc_common_go.Empty{},
+			&grpc.UnaryServerInfo{FullMethod: "/other.Health/Check"}, public)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unauthenticated))
+	})
+
+	ginkgo.It("audits the allowed and denied mutating calls", func() {
+		token := sign(jwt.SigningMethodHS256, testSecret, newClaims("operator", []string{"org1"}, []string{ProvisionOperation}))
+		resp, err := call(token, provisionMethod, &grpc_provisioner_go.ProvisionClusterRequest{RequestId: "req1", OrganizationId: "org1"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(resp).To(gomega.Equal("operator"))
+		_, err = call(token, provisionMethod, &grpc_provisioner_go.ProvisionClusterRequest{RequestId: "req2", OrganizationId: "org2"})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.PermissionDenied))
+		_, err = call(token, "/provisioner.Provision/CheckProgress", &grpc_provisioner_go.ProvisionClusterRequest{RequestId: "req1", OrganizationId: "org1"})
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = call("", provisionMethod, &grpc_provisioner_go.ProvisionClusterRequest{RequestId: "req3", OrganizationId: "org1"})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+
+		audited := entries()
+		gomega.Expect(audited).To(gomega.HaveLen(3))
+		gomega.Expect(audited[0].Caller).To(gomega.Equal("operator"))
+		gomega.Expect(audited[0].Authenticated).To(gomega.BeTrue())
+		gomega.Expect(audited[0].OrganizationID).To(gomega.Equal("org1"))
+		gomega.Expect(audited[0].RequestID).To(gomega.Equal("req1"))
+		gomega.Expect(audited[0].Outcome).To(gomega.Equal(codes.OK.String()))
+		gomega.Expect(audited[1].OrganizationID).To(gomega.Equal("org2"))
+		gomega.Expect(audited[1].Outcome).To(gomega.Equal(codes.PermissionDenied.String()))
+		gomega.Expect(audited[1].Error).NotTo(gomega.BeEmpty())
+		gomega.Expect(audited[2].Caller).To(gomega.Equal(AnonymousCaller))
+		gomega.Expect(audited[2].Outcome).To(gomega.Equal(codes.Unauthenticated.String()))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// OrganizationResolver returns the organization of the operation associated with a request identifier.
+type OrganizationResolver func(requestID string) (string, bool)
+
+// serviceOperations maps the services of the provisioner to the type of operation required to call their methods.
+var serviceOperations = map[string]string{
+	"Provision":    ProvisionOperation,
+	"Scale":        ScaleOperation,
+	"Decommission": DecommissionOperation,
+	"Management":   ManagementOperation,
+	"Admin":        AdminOperation,
+	"Profiles":     AdminOperation,
+}
+
+// operationsMethods maps the methods of the operations service that change the clusters to the type of operation
+// required to call them. The other methods of the service only read the operations of the organizations of the
+// caller.
+var operationsMethods = map[string]string{
+	"ResumeOperation": ProvisionOperation,
+}
+
+// publicServices contains the full names of the services that can be called without a token, so that the probes
+// of the orchestrator do not need credentials.
+var publicServices = map[string]bool{
+	"grpc.health.v1.Health": true,
+}
+
+// mutatingMethods contains the methods that change the state of the clusters or the provisioner. Calls to those
+// methods are written to the audit log.
+var mutatingMethods = map[string]bool{
+	"ProvisionCluster":    true,
+	"ResumeOperation":     true,
+	"RemoveProvision":     true,
+	"ScaleCluster":        true,
+	"RemoveScale":         true,
+	"DecommissionCluster": true,
+	"RemoveDecommission":  true,
+	"SetExecutorMode":     true,
+	"AddProfile":          true,
+	"UpdateProfile":       true,
+	"RemoveProfile":       true,
+}
+
+// splitMethod returns the service and the method names of a full gRPC method name such as
+// /provisioner.Provision/ProvisionCluster. The package of the service is removed.
+func splitMethod(fullMethod string) (string, string) {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	service := parts[0]
+	if index := strings.LastIndex(service, "."); index != -1 {
+		service = service[index+1:]
+	}
+	return service, parts[1]
+}
+
+// IsPublic checks if a gRPC method can be called without authentication.
+func IsPublic(fullMethod string) bool {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	return len(parts) == 2 && publicServices[parts[0]]
+}
+
+// IsMutating checks if a gRPC method changes the state of the clusters or the provisioner.
+func IsMutating(fullMethod string) bool {
+	_, method := splitMethod(fullMethod)
+	return mutatingMethods[method]
+}
+
+// requestOrganization returns the organization targeted by a request, if it can be determined.
+func requestOrganization(request interface{}, resolver OrganizationResolver) (string, bool) {
+	switch typed := request.(type) {
+	case interface{ GetOrganizationId() string }:
+		return typed.GetOrganizationId(), true
+	case interface{ GetRequestId() string }:
+		if resolver == nil {
+			return "", false
+		}
+		return resolver(typed.GetRequestId())
+	}
+	return "", false
+}
+
+// Authorize checks if an identity can call a method with a given request. It returns the organization targeted by
+// the request, if any.
+func Authorize(identity *Identity, fullMethod string, request interface{}, resolver OrganizationResolver) (string, derrors.Error) {
+	service, method := splitMethod(fullMethod)
+	if service == "Operations" {
+		return authorizeOperations(identity, method, request, resolver)
+	}
+	operation, known := serviceOperations[service]
+	if !known {
+		return "", derrors.NewPermissionDeniedError("method not allowed").WithParams(fullMethod)
+	}
+	if !identity.CanPerform(operation) {
+		return "", derrors.NewPermissionDeniedError("operation not allowed").WithParams(identity.Subject, operation, method)
+	}
+	return authorizeOrganization(identity, request, resolver)
+}
+
+// authorizeOperations checks if an identity can call a method of the operations service with a given request.
+func authorizeOperations(identity *Identity, method string, request interface{}, resolver OrganizationResolver) (string, derrors.Error) {
+	if method == "ListOperations" {
+		return authorizeListing(identity, request)
+	}
+	operation, mutating := operationsMethods[method]
+	if mutating && !identity.CanPerform(operation) {
+		return "", derrors.NewPermissionDeniedError("operation not allowed").WithParams(identity.Subject, operation, method)
+	}
+	return authorizeOrganization(identity, request, resolver)
+}
+
+// authorizeOrganization checks that a request targets one of the organizations of the caller.
+func authorizeOrganization(identity *Identity, request interface{}, resolver OrganizationResolver) (string, derrors.Error) {
+	organizationID, found := requestOrganization(request, resolver)
+	if !found {
+		// Requests not bound to an organization, or referring to unknown operations, are left to the handlers.
+		return "", nil
+	}
+	if !identity.CanAccessOrganization(organizationID) {
+		return organizationID, derrors.NewPermissionDeniedError("organization not allowed").WithParams(identity.Subject, organizationID)
+	}
+	return organizationID, nil
+}
+
+// authorizeListing checks that the listing of operations is restricted to the organizations of the caller.
+func authorizeListing(identity *Identity, request interface{}) (string, derrors.Error) {
+	filter, ok := request.(*entities.OperationFilter)
+	if !ok {
+		return "", derrors.NewInvalidArgumentError("unexpected request")
+	}
+	if filter.OrganizationID == "" {
+		if identity.CanAccessAllOrganizations() {
+			return "", nil
+		}
+		return "", derrors.NewPermissionDeniedError("organization_id must be set to list operations").WithParams(identity.Subject)
+	}
+	if !identity.CanAccessOrganization(filter.OrganizationID) {
+		return filter.OrganizationID, derrors.NewPermissionDeniedError("organization not allowed").WithParams(identity.Subject, filter.OrganizationID)
+	}
+	return filter.OrganizationID, nil
+}
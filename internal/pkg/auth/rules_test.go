@@ -0,0 +1,109 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Authorization rules", func() {
+
+	resolver := func(requestID string) (string, bool) {
+		if requestID == "req1" {
+			return "org1", true
+		}
+		return "", false
+	}
+
+	operator := &Identity{Subject: "operator", Organizations: []string{"org1"}, Operations: []string{ProvisionOperation, ScaleOperation}}
+	admin := &Identity{Subject: "admin", Organizations: []string{AnyValue}, Operations: []string{AnyValue}}
+
+	ginkgo.It("allows the operations of the organizations of the caller", func() {
+		organizationID, err := Authorize(operator, "/provisioner.Provision/ProvisionCluster",
+			&grpc_provisioner_go.ProvisionClusterRequest{OrganizationId: "org1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(organizationID).To(gomega.Equal("org1"))
+		_, err = Authorize(operator, "/provisioner.Scale/RemoveScale", &grpc_common_go.RequestId{RequestId: "req1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = Authorize(operator, "/provisioner.Operations/WatchOperation", &grpc_common_go.RequestId{RequestId: "req1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+
+	ginkgo.It("requires the provisioning operation to resume operations", func() {
+		viewer := &Identity{Subject: "viewer", Organizations: []string{"org1"}, Operations: []string{ScaleOperation}}
+		_, err := Authorize(viewer, "/provisioner.Operations/WatchOperation", &grpc_common_go.RequestId{RequestId: "req1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = Authorize(viewer, "/provisioner.Operations/ResumeOperation", &grpc_common_go.RequestId{RequestId: "req1"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.PermissionDenied))
+		_, err = Authorize(operator, "/provisioner.Operations/ResumeOperation", &grpc_common_go.RequestId{RequestId: "req1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects cross-organization requests", func() {
+		_, err := Authorize(operator, "/provisioner.Provision/ProvisionCluster",
+			&grpc_provisioner_go.ProvisionClusterRequest{OrganizationId: "org2"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.PermissionDenied))
+		notMine := func(requestID string) (string, bool) { return "org2", true }
+		_, err = Authorize(operator, "/provisioner.Provision/RemoveProvision", &grpc_common_go.RequestId{RequestId: "req2"}, notMine)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects the operations not granted to the caller", func() {
+		_, err := Authorize(operator, "/provisioner.Decommission/DecommissionCluster",
+			&grpc_provisioner_go.DecommissionClusterRequest{OrganizationId: "org1"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = Authorize(operator, "/provisioner.Admin/SetExecutorMode", &entities.ExecutorModeRequest{Mode: "paused"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = Authorize(admin, "/provisioner.Admin/SetExecutorMode", &entities.ExecutorModeRequest{Mode: "paused"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = Authorize(operator, "/provisioner.Profiles/GetProfile", &entities.ProfileID{ID: "azure-prod"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = Authorize(admin, "/provisioner.Profiles/GetProfile", &entities.ProfileID{ID: "azure-prod"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+
+	ginkgo.It("rejects unknown methods", func() {
+		_, err := Authorize(admin, "/other.Service/Method", &grpc_common_go.Empty{}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("restricts the listing of operations to the organizations of the caller", func() {
+		_, err := Authorize(operator, "/provisioner.Operations/ListOperations", &entities.OperationFilter{}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = Authorize(operator, "/provisioner.Operations/ListOperations", &entities.OperationFilter{OrganizationID: "org2"}, resolver)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		_, err = Authorize(operator, "/provisioner.Operations/ListOperations", &entities.OperationFilter{OrganizationID: "org1"}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = Authorize(admin, "/provisioner.Operations/ListOperations", &entities.OperationFilter{}, resolver)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+
+	ginkgo.It("identifies the mutating methods", func() {
+		gomega.Expect(IsMutating("/provisioner.Provision/ProvisionCluster")).To(gomega.BeTrue())
+		gomega.Expect(IsMutating("/provisioner.Decommission/RemoveDecommission")).To(gomega.BeTrue())
+		gomega.Expect(IsMutating("/provisioner.Profiles/AddProfile")).To(gomega.BeTrue())
+		gomega.Expect(IsMutating("/provisioner.Provision/CheckProgress")).To(gomega.BeFalse())
+		gomega.Expect(IsMutating("/provisioner.Management/GetKubeConfig")).To(gomega.BeFalse())
+	})
+})
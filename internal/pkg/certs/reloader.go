@@ -0,0 +1,200 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultReloadInterval with the default period to check if the certificates changed on disk.
+const DefaultReloadInterval = 30 * time.Second
+
+// Reloader keeps the server certificate and the client CA loaded from disk, and reloads them when the files
+// change so that rotated certificates are used without restarting the provisioner.
+type Reloader struct {
+	sync.RWMutex
+	certPath     string
+	keyPath      string
+	clientCAPath string
+	certificate  *tls.Certificate
+	clientCAs    *x509.CertPool
+	// checksum of the contents of the files currently loaded.
+	checksum []byte
+	// stop is used to stop the reload loop.
+	stop chan struct{}
+}
+
+// NewReloader loads the server certificate and key, and the optional client CA.
+func NewReloader(certPath string, keyPath string, clientCAPath string) (*Reloader, derrors.Error) {
+	reloader := &Reloader{
+		certPath:     certPath,
+		keyPath:      keyPath,
+		clientCAPath: clientCAPath,
+	}
+	_, err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the files again and replaces the loaded certificates if they changed. It returns whether the
+// certificates were replaced. Invalid files are reported and the previous certificates are kept.
+func (r *Reloader) Reload() (bool, derrors.Error) {
+	certPEM, err := ioutil.ReadFile(r.certPath)
+	if err != nil {
+		return false, derrors.AsError(err, "cannot read server certificate")
+	}
+	keyPEM, err := ioutil.ReadFile(r.keyPath)
+	if err != nil {
+		return false, derrors.AsError(err, "cannot read server key")
+	}
+	var caPEM []byte
+	if r.clientCAPath != "" {
+		caPEM, err = ioutil.ReadFile(r.clientCAPath)
+		if err != nil {
+			return false, derrors.AsError(err, "cannot read client CA")
+		}
+	}
+	hash := sha256.New()
+	for _, contents := range [][]byte{certPEM, keyPEM, caPEM} {
+		sum := sha256.Sum256(contents)
+		hash.Write(sum[:])
+	}
+	checksum := hash.Sum(nil)
+	r.RLock()
+	unchanged := bytes.Equal(checksum, r.checksum)
+	r.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, derrors.NewInvalidArgumentError("invalid server certificate or key", err).WithParams(r.certPath, r.keyPath)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAPath != "" {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return false, derrors.NewInvalidArgumentError("client CA does not contain any certificate").WithParams(r.clientCAPath)
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	r.checksum = checksum
+	return true, nil
+}
+
+// Start launches a loop that periodically reloads the certificates.
+func (r *Reloader) Start(interval time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if interval <= 0 || r.stop != nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	go r.reloadLoop(interval, r.stop)
+}
+
+// Stop stops the reload loop.
+func (r *Reloader) Stop() {
+	r.Lock()
+	defer r.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+func (r *Reloader) reloadLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Error().Str("trace", err.DebugReport()).Msg("cannot reload certificates, keeping the previous ones")
+			} else if reloaded {
+				log.Info().Str("certificate", r.certPath).Msg("certificates reloaded")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ServerConfig returns a TLS configuration that uses the certificates loaded at the time of each handshake. If a
+// client CA is loaded, client certificates are verified against it, and required if requireClientCert is set.
+func (r *Reloader) ServerConfig(requireClientCert bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.RLock()
+			defer r.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.certificate},
+				NextProtos:   []string{"h2"},
+				ClientAuth:   tls.NoClientCert,
+			}
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				if requireClientCert {
+					config.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return config, nil
+		},
+	}
+}
+
+// ClientConfig returns the TLS configuration of a client of the provisioner. The CA is used to verify the server
+// instead of the system roots if provided, and the client certificate is presented if provided.
+func ClientConfig(caPath string, certPath string, keyPath string) (*tls.Config, derrors.Error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caPath != "" {
+		caPEM, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot read CA")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, derrors.NewInvalidArgumentError("CA does not contain any certificate").WithParams(caPath)
+		}
+	}
+	if certPath != "" || keyPath != "" {
+		certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, derrors.NewInvalidArgumentError("invalid client certificate or key", err).WithParams(certPath, keyPath)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// testAuthority with a CA able to issue certificates for the tests.
+type testAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         []byte
+}
+
+func newTestAuthority(name string) *testAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	gomega.Expect(err).To(gomega.Succeed())
+	certificate, err := x509.ParseCertificate(raw)
+	gomega.Expect(err).To(gomega.Succeed())
+	return &testAuthority{
+		certificate: certificate,
+		key:         key,
+		pem:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}),
+	}
+}
+
+// issue creates a certificate signed by the authority and returns the PEM encoding of the certificate and key.
+func (ta *testAuthority) issue(name string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, ta.certificate, &key.PublicKey, ta.key)
+	gomega.Expect(err).To(gomega.Succeed())
+	keyRaw, err := x509.MarshalECPrivateKey(key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyRaw})
+}
+
+func writeFile(path string, contents []byte) {
+	gomega.Expect(ioutil.WriteFile(path, contents, 0600)).To(gomega.Succeed())
+}
+
+// serve accepts TLS connections completing their handshake until the listener is closed.
+func serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}()
+	}
+}
+
+var _ = ginkgo.Describe("Certificate reloader", func() {
+
+	var tempDir string
+	var certPath, keyPath, caPath string
+	var authority *testAuthority
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "certs")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+		certPath = filepath.Join(tempDir, "tls.crt")
+		keyPath = filepath.Join(tempDir, "tls.key")
+		caPath = filepath.Join(tempDir, "ca.crt")
+		authority = newTestAuthority("test CA")
+		cert, key := authority.issue("server", 2, x509.ExtKeyUsageServerAuth)
+		writeFile(certPath, cert)
+		writeFile(keyPath, key)
+		writeFile(caPath, authority.pem)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	// handshake connects to a TLS server returning the serial number of the server certificate. With TLS 1.3 the
+	// rejection of the client certificate is received after the handshake, so the connection is read until the
+	// server closes it.
+	handshake := func(address string, config *tls.Config) (int64, error) {
+		conn, err := tls.Dial("tcp", address, config)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if err != io.EOF {
+			return 0, err
+		}
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	ginkgo.It("should fail on invalid certificates", func() {
+		writeFile(keyPath, []byte("invalid"))
+		_, err := NewReloader(certPath, keyPath, "")
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should serve the rotated certificate", func() {
+		reloader, err := NewReloader(certPath, keyPath, "")
+		gomega.Expect(err).To(gomega.BeNil())
+		listener, lErr := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerConfig(false))
+		gomega.Expect(lErr).To(gomega.Succeed())
+		defer listener.Close()
+		go serve(listener)
+		clientConfig, err := ClientConfig(caPath, "", "")
+		gomega.Expect(err).To(gomega.BeNil())
+
+		serial, hErr := handshake(listener.Addr().String(), clientConfig)
+		gomega.Expect(hErr).To(gomega.Succeed())
+		gomega.Expect(serial).To(gomega.Equal(int64(2)))
+
+		reloaded, err := reloader.Reload()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(reloaded).To(gomega.BeFalse())
+
+		cert, key := authority.issue("server", 3, x509.ExtKeyUsageServerAuth)
+		writeFile(certPath, cert)
+		writeFile(keyPath, key)
+		reloader.Start(50 * time.Millisecond)
+		defer reloader.Stop()
+		gomega.Eventually(func() int64 {
+			serial, _ := handshake(listener.Addr().String(), clientConfig)
+			return serial
+		}, 5*time.Second, 50*time.Millisecond).Should(gomega.Equal(int64(3)))
+	})
+
+	ginkgo.It("should keep the previous certificate if the new one is invalid", func() {
+		reloader, err := NewReloader(certPath, keyPath, "")
+		gomega.Expect(err).To(gomega.BeNil())
+		writeFile(keyPath, []byte("partially written"))
+		reloaded, err := reloader.Reload()
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(reloaded).To(gomega.BeFalse())
+		config, cErr := reloader.ServerConfig(false).GetConfigForClient(nil)
+		gomega.Expect(cErr).To(gomega.Succeed())
+		gomega.Expect(config.Certificates).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should require client certificates signed by the client CA", func() {
+		reloader, err := NewReloader(certPath, keyPath, caPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		listener, lErr := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerConfig(true))
+		gomega.Expect(lErr).To(gomega.Succeed())
+		defer listener.Close()
+		go serve(listener)
+
+		withoutCert, err := ClientConfig(caPath, "", "")
+		gomega.Expect(err).To(gomega.BeNil())
+		_, hErr := handshake(listener.Addr().String(), withoutCert)
+		gomega.Expect(hErr).ToNot(gomega.Succeed())
+
+		clientCertPath := filepath.Join(tempDir, "client.crt")
+		clientKeyPath := filepath.Join(tempDir, "client.key")
+		cert, key := authority.issue("client", 4, x509.ExtKeyUsageClientAuth)
+		writeFile(clientCertPath, cert)
+		writeFile(clientKeyPath, key)
+		withCert, err := ClientConfig(caPath, clientCertPath, clientKeyPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, hErr = handshake(listener.Addr().String(), withCert)
+		gomega.Expect(hErr).To(gomega.Succeed())
+
+		other := newTestAuthority("other CA")
+		cert, key = other.issue("client", 5, x509.ExtKeyUsageClientAuth)
+		writeFile(clientCertPath, cert)
+		writeFile(clientKeyPath, key)
+		untrusted, err := ClientConfig(caPath, clientCertPath, clientKeyPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, hErr = handshake(listener.Addr().String(), untrusted)
+		gomega.Expect(hErr).ToNot(gomega.Succeed())
+	})
+})
@@ -28,3 +28,9 @@ const DefaultTimeout = time.Minute
 func GetContext() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), DefaultTimeout)
 }
+
+// GetContextFrom returns a context with the default timeout derived from a parent context. Use this function to
+// make the internal communications stop when the parent operation is cancelled.
+func GetContextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, DefaultTimeout)
+}
@@ -17,8 +17,13 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/nalej/derrors"
 	"github.com/nalej/edge-inventory-proxy/version"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/nalej/provisioner/internal/pkg/webhook"
 	"github.com/rs/zerolog/log"
 )
 
@@ -29,16 +34,212 @@ type Config struct {
 	Debug bool
 	// Port where the gRPC API service will listen requests.
 	Port int
+	// GatewayPort where the HTTP gateway exposing the API as JSON will listen. If 0, the gateway is not launched.
+	GatewayPort int
+	// TLSCertPath with the path of the server certificate. If empty, the gRPC API does not use TLS.
+	TLSCertPath string
+	// TLSKeyPath with the path of the private key of the server certificate.
+	TLSKeyPath string
+	// TLSClientCAPath with the path of the CA used to verify the client certificates.
+	TLSClientCAPath string
+	// TLSRequireClientCert determines if the clients must present a certificate signed by the client CA.
+	TLSRequireClientCert bool
+	// TLSReloadInterval with the period to check if the certificates changed on disk. If 0, they are not reloaded.
+	TLSReloadInterval time.Duration
+	// AuthKeyPaths with the paths of the keys used to verify the bearer tokens. If empty, the calls are not
+	// authenticated.
+	AuthKeyPaths []string
+	// AuthIssuer with the issuer expected in the tokens. If empty, the issuer is not checked.
+	AuthIssuer string
+	// AuthAudience with the audience expected in the tokens. If empty, the audience is not checked.
+	AuthAudience string
+	// AuditLogPath with the path of the append-only audit log. If empty, audit entries are written to the log.
+	AuditLogPath string
+	// CredentialsProfilesPath with the directory of the credentials profiles. Profiles created through the API are
+	// stored in it. If empty, those profiles are kept in memory.
+	CredentialsProfilesPath string
+	// CredentialsProfilesNamespace with the namespace of the Kubernetes secrets containing credentials profiles. If
+	// empty, secrets are not loaded.
+	CredentialsProfilesNamespace string
+	// CredentialsProfilesSelector with the label selector of the secrets containing credentials profiles.
+	CredentialsProfilesSelector string
 	// TempPath with the path where temporal files may be created.
 	TempPath string
 	// ResourcesPath with the path where extra YAML or resources are stored for some operation.
 	ResourcesPath string
+	// StorePath with the path of the file where the state of the operations is persisted. If empty, the
+	// operations are only kept in memory.
+	StorePath string
+	// CheckpointInterval with the period to persist the state of the operations being executed.
+	CheckpointInterval time.Duration
+	// RollbackOnFailure determines if failed provisioning operations release the created resources by default.
+	RollbackOnFailure bool
+	// ClusterLockPolicy determines how operations on a cluster being modified by another operation are handled:
+	// wait for the running operation to finish or reject them.
+	ClusterLockPolicy string
+	// MaxConcurrentOperations with the maximum number of operations executed at the same time. If 0, the
+	// executor default is used.
+	MaxConcurrentOperations int
+	// MaxConcurrentPerOrganization with the maximum number of operations of the same organization executed at
+	// the same time. If 0, the number is only limited by MaxConcurrentOperations.
+	MaxConcurrentPerOrganization int
+	// ProvisionDeadline with the maximum duration of a provisioning operation. If 0, no deadline is enforced.
+	ProvisionDeadline time.Duration
+	// ScaleDeadline with the maximum duration of a scaling operation. If 0, no deadline is enforced.
+	ScaleDeadline time.Duration
+	// DecommissionDeadline with the maximum duration of a decommission operation. If 0, no deadline is enforced.
+	DecommissionDeadline time.Duration
+	// ManagementDeadline with the maximum duration of a management operation. If 0, no deadline is enforced.
+	ManagementDeadline time.Duration
+	// StalledOperationTimeout with the maximum time an operation may run without adding entries to its log
+	// before being considered stuck. If 0, stalled operations are not detected.
+	StalledOperationTimeout time.Duration
+	// OperationTTL with the time finished operations are kept before being removed. If 0, finished operations
+	// are kept until they are explicitly removed.
+	OperationTTL time.Duration
+	// MetricsPort where the HTTP endpoint exposing the Prometheus metrics will listen. If 0, the metrics are not
+	// exposed.
+	MetricsPort int
+	// HealthPort where the HTTP liveness and readiness endpoints will listen. It may be the same as the metrics
+	// port. If 0, the endpoints are not exposed.
+	HealthPort int
+	// TracingExporter with the name of the exporter of the traces: none, stdout or jaeger.
+	TracingExporter string
+	// TracingEndpoint with the address of the collector receiving the traces for remote exporters.
+	TracingEndpoint string
+	// TracingSampleRatio with the fraction of the operations that are traced.
+	TracingSampleRatio float64
+	// ShutdownGracePeriod with the time the running operations are given to finish when the provisioner is
+	// stopped. The operations still running afterwards are interrupted.
+	ShutdownGracePeriod time.Duration
+	// WebhookURLs with the webhooks notified when any operation finishes.
+	WebhookURLs []string
+	// WebhookSecret with the key used to sign the webhook notifications. If empty, notifications are not signed.
+	WebhookSecret string
+	// WebhookStorePath with the path of the file where the webhook delivery log is persisted. If empty, the log is
+	// only kept in memory.
+	WebhookStorePath string
+	// WebhookMaxAttempts with the maximum number of attempts to deliver a webhook notification.
+	WebhookMaxAttempts int
+	// WebhookAllowedHosts with the host names, IP addresses or CIDR ranges that the webhooks registered by the
+	// callers may target even if they are loopback, private or link-local addresses.
+	WebhookAllowedHosts []string
+	// EnableFakeProvider determines if the requests may target the fake provider that simulates the clusters.
+	EnableFakeProvider bool
+	// FakeInventoryPath with the path of the file where the clusters of the fake provider are persisted. If
+	// empty, they are only kept in memory.
+	FakeInventoryPath string
+	// FakeStepLatency with the time each step of the fake provider takes.
+	FakeStepLatency time.Duration
+	// FakeStepLatencies with the latency of specific steps of the fake provider as step=duration.
+	FakeStepLatencies []string
+	// FakeFailSteps with the steps of the fake provider that fail as step, or step=attempts to fail only the
+	// first attempts.
+	FakeFailSteps []string
+	// BareMetalInventoryPath with the path of the file listing the hosts of the bare-metal provider. If empty,
+	// the bare-metal platform is not available.
+	BareMetalInventoryPath string
+	// BareMetalSSHKeyPath with the path of the private key used to connect to the bare-metal hosts.
+	BareMetalSSHKeyPath string
+	// BareMetalKnownHostsPath with the path of the known_hosts file used to verify the bare-metal hosts.
+	BareMetalKnownHostsPath string
+	// BareMetalSSHUser with the user to connect to the bare-metal hosts. Users other than root require
+	// passwordless sudo.
+	BareMetalSSHUser string
+	// BareMetalNetworkManifest with the manifest of the pod network installed on the bare-metal clusters.
+	BareMetalNetworkManifest string
 }
 
 func (conf *Config) Validate() derrors.Error {
 	if conf.LaunchService && conf.Port <= 0 {
 		return derrors.NewInvalidArgumentError("port must be valid")
 	}
+	if (conf.TLSCertPath == "") != (conf.TLSKeyPath == "") {
+		return derrors.NewInvalidArgumentError("tlsCertPath and tlsKeyPath must be set together")
+	}
+	if conf.TLSClientCAPath != "" && conf.TLSCertPath == "" {
+		return derrors.NewInvalidArgumentError("tlsClientCAPath requires tlsCertPath and tlsKeyPath")
+	}
+	if conf.TLSRequireClientCert && conf.TLSClientCAPath == "" {
+		return derrors.NewInvalidArgumentError("tlsRequireClientCert requires tlsClientCAPath")
+	}
+	if conf.TLSReloadInterval < 0 {
+		return derrors.NewInvalidArgumentError("tlsReloadInterval cannot be negative")
+	}
+	if len(conf.AuthKeyPaths) == 0 && (conf.AuthIssuer != "" || conf.AuthAudience != "") {
+		return derrors.NewInvalidArgumentError("authIssuer and authAudience require authKeyPaths")
+	}
+	if conf.CredentialsProfilesNamespace != "" && conf.CredentialsProfilesSelector == "" {
+		return derrors.NewInvalidArgumentError("credentialsProfilesNamespace requires credentialsProfilesSelector")
+	}
+	if conf.CheckpointInterval < 0 {
+		return derrors.NewInvalidArgumentError("checkpointInterval cannot be negative")
+	}
+	if conf.ClusterLockPolicy != "" && conf.ClusterLockPolicy != "wait" && conf.ClusterLockPolicy != "reject" {
+		return derrors.NewInvalidArgumentError("clusterLockPolicy must be wait or reject").WithParams(conf.ClusterLockPolicy)
+	}
+	if conf.MaxConcurrentOperations < 0 {
+		return derrors.NewInvalidArgumentError("maxConcurrentOperations cannot be negative")
+	}
+	if conf.MaxConcurrentPerOrganization < 0 {
+		return derrors.NewInvalidArgumentError("maxConcurrentPerOrganization cannot be negative")
+	}
+	if conf.ProvisionDeadline < 0 || conf.ScaleDeadline < 0 || conf.DecommissionDeadline < 0 || conf.ManagementDeadline < 0 {
+		return derrors.NewInvalidArgumentError("operation deadlines cannot be negative")
+	}
+	if conf.StalledOperationTimeout < 0 {
+		return derrors.NewInvalidArgumentError("stalledOperationTimeout cannot be negative")
+	}
+	if conf.OperationTTL < 0 {
+		return derrors.NewInvalidArgumentError("operationTTL cannot be negative")
+	}
+	if conf.GatewayPort < 0 {
+		return derrors.NewInvalidArgumentError("gatewayPort cannot be negative")
+	}
+	if conf.GatewayPort > 0 && (conf.GatewayPort == conf.Port || conf.GatewayPort == conf.MetricsPort ||
+		conf.GatewayPort == conf.HealthPort) {
+		return derrors.NewInvalidArgumentError("gatewayPort must differ from the gRPC, metrics and health ports").WithParams(conf.GatewayPort)
+	}
+	if conf.MetricsPort < 0 {
+		return derrors.NewInvalidArgumentError("metricsPort cannot be negative")
+	}
+	if conf.HealthPort < 0 {
+		return derrors.NewInvalidArgumentError("healthPort cannot be negative")
+	}
+	if conf.HealthPort > 0 && conf.HealthPort == conf.Port {
+		return derrors.NewInvalidArgumentError("healthPort must differ from the gRPC port").WithParams(conf.HealthPort)
+	}
+	if conf.TracingExporter != "" && !tracing.ValidExporter(conf.TracingExporter) {
+		return derrors.NewInvalidArgumentError("unsupported tracingExporter").WithParams(conf.TracingExporter)
+	}
+	if strings.EqualFold(conf.TracingExporter, tracing.JaegerExporter) && conf.TracingEndpoint == "" {
+		return derrors.NewInvalidArgumentError("tracingEndpoint is required by the jaeger exporter")
+	}
+	if conf.TracingSampleRatio < 0 || conf.TracingSampleRatio > 1 {
+		return derrors.NewInvalidArgumentError("tracingSampleRatio must be between 0 and 1")
+	}
+	if conf.ShutdownGracePeriod < 0 {
+		return derrors.NewInvalidArgumentError("shutdownGracePeriod cannot be negative")
+	}
+	if _, err := webhook.ParseURLs(conf.WebhookURLs); err != nil {
+		return err
+	}
+	if conf.WebhookMaxAttempts < 0 {
+		return derrors.NewInvalidArgumentError("webhookMaxAttempts cannot be negative")
+	}
+	if _, err := webhook.NewURLPolicy(conf.WebhookAllowedHosts); err != nil {
+		return err
+	}
+	if conf.FakeStepLatency < 0 {
+		return derrors.NewInvalidArgumentError("fakeStepLatency cannot be negative")
+	}
+	if !conf.EnableFakeProvider && (conf.FakeInventoryPath != "" || conf.FakeStepLatency > 0 ||
+		len(conf.FakeStepLatencies) > 0 || len(conf.FakeFailSteps) > 0) {
+		return derrors.NewInvalidArgumentError("fake provider options require enableFakeProvider")
+	}
+	if conf.BareMetalInventoryPath != "" && (conf.BareMetalSSHKeyPath == "" || conf.BareMetalKnownHostsPath == "") {
+		return derrors.NewInvalidArgumentError("bareMetalInventoryPath requires bareMetalSSHKeyPath and bareMetalKnownHostsPath")
+	}
 	return nil
 }
 
@@ -46,7 +247,70 @@ func (conf *Config) Print() {
 	log.Info().Str("app", version.AppVersion).Str("commit", version.Commit).Msg("Version")
 	if conf.LaunchService {
 		log.Info().Int("port", conf.Port).Msg("gRPC port")
+		if conf.GatewayPort > 0 {
+			log.Info().Int("port", conf.GatewayPort).Msg("HTTP gateway port")
+		}
+		if conf.TLSCertPath != "" {
+			log.Info().Str("certificate", conf.TLSCertPath).Str("clientCA", conf.TLSClientCAPath).
+				Bool("requireClientCert", conf.TLSRequireClientCert).Str("reload", conf.TLSReloadInterval.String()).Msg("TLS")
+		} else {
+			log.Warn().Msg("TLS is disabled, the credentials in the requests are sent in plain text")
+		}
+		if len(conf.AuthKeyPaths) > 0 {
+			log.Info().Strs("keys", conf.AuthKeyPaths).Str("issuer", conf.AuthIssuer).Str("audience", conf.AuthAudience).Msg("Authentication")
+		} else {
+			log.Warn().Msg("Authentication is disabled, any caller can manage the clusters")
+		}
+		if conf.AuditLogPath != "" {
+			log.Info().Str("path", conf.AuditLogPath).Msg("Audit log")
+		}
+		if conf.CredentialsProfilesPath != "" {
+			log.Info().Str("path", conf.CredentialsProfilesPath).Msg("Credentials profiles")
+		}
+		if conf.CredentialsProfilesNamespace != "" {
+			log.Info().Str("namespace", conf.CredentialsProfilesNamespace).Str("selector", conf.CredentialsProfilesSelector).Msg("Credentials profiles secrets")
+		}
 	}
 	log.Info().Str("path", conf.TempPath).Msg("Temporal files")
 	log.Info().Str("path", conf.ResourcesPath).Msg("Resources")
+	if conf.StorePath != "" {
+		log.Info().Str("path", conf.StorePath).Str("checkpoint", conf.CheckpointInterval.String()).Msg("Operation store")
+	} else {
+		log.Info().Msg("Operation store in memory")
+	}
+	log.Info().Bool("rollbackOnFailure", conf.RollbackOnFailure).Str("clusterLockPolicy", conf.ClusterLockPolicy).Msg("Provisioning")
+	log.Info().Int("maxConcurrentOperations", conf.MaxConcurrentOperations).
+		Int("maxConcurrentPerOrganization", conf.MaxConcurrentPerOrganization).Msg("Scheduling")
+	log.Info().Str("provision", conf.ProvisionDeadline.String()).Str("scale", conf.ScaleDeadline.String()).
+		Str("decommission", conf.DecommissionDeadline.String()).Str("management", conf.ManagementDeadline.String()).
+		Str("stalled", conf.StalledOperationTimeout.String()).Msg("Operation deadlines")
+	log.Info().Str("ttl", conf.OperationTTL.String()).Msg("Finished operations")
+	if conf.LaunchService {
+		log.Info().Str("gracePeriod", conf.ShutdownGracePeriod.String()).Msg("Shutdown")
+	}
+	if conf.LaunchService && conf.MetricsPort > 0 {
+		log.Info().Int("port", conf.MetricsPort).Msg("Metrics port")
+	}
+	if conf.LaunchService && conf.HealthPort > 0 {
+		log.Info().Int("port", conf.HealthPort).Msg("Health port")
+	}
+	if conf.TracingExporter != "" && !strings.EqualFold(conf.TracingExporter, tracing.NoExporter) {
+		log.Info().Str("exporter", conf.TracingExporter).Str("endpoint", conf.TracingEndpoint).
+			Float64("sampleRatio", conf.TracingSampleRatio).Msg("Tracing")
+	}
+	if len(conf.WebhookURLs) > 0 || conf.WebhookStorePath != "" {
+		log.Info().Strs("urls", conf.WebhookURLs).Bool("signed", conf.WebhookSecret != "").
+			Str("path", conf.WebhookStorePath).Int("maxAttempts", conf.WebhookMaxAttempts).
+			Strs("allowedHosts", conf.WebhookAllowedHosts).Msg("Webhooks")
+	}
+	if conf.EnableFakeProvider {
+		log.Warn().Str("inventory", conf.FakeInventoryPath).Str("latency", conf.FakeStepLatency.String()).
+			Strs("stepLatencies", conf.FakeStepLatencies).Strs("failSteps", conf.FakeFailSteps).
+			Msg("Fake provider enabled, clusters on the fake platform are simulated")
+	}
+	if conf.BareMetalInventoryPath != "" {
+		log.Info().Str("inventory", conf.BareMetalInventoryPath).Str("user", conf.BareMetalSSHUser).
+			Str("knownHosts", conf.BareMetalKnownHostsPath).Str("networkManifest", conf.BareMetalNetworkManifest).
+			Msg("Bare-metal provider")
+	}
 }
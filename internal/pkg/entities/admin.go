@@ -0,0 +1,33 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// ExecutorStatus with the state of the executor of the provisioner.
+type ExecutorStatus struct {
+	// Mode of the executor: active, paused, draining or stopping.
+	Mode string `json:"mode"`
+	// QueuedOperations with the number of operations waiting to be executed.
+	QueuedOperations int `json:"queued_operations"`
+	// RunningOperations with the number of operations being executed.
+	RunningOperations int `json:"running_operations"`
+}
+
+// ExecutorModeRequest with the mode requested for the executor.
+type ExecutorModeRequest struct {
+	// Mode of the executor: active, paused or draining.
+	Mode string `json:"mode"`
+}
@@ -17,10 +17,12 @@
 package entities
 
 import (
+	"fmt"
 	"github.com/nalej/derrors"
 	grpc_common_go "github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/redact"
 	"github.com/rs/zerolog/log"
 	"time"
 )
@@ -34,14 +36,33 @@ const (
 	InProgress
 	Error
 	Finished
+	// Interrupted operations are those that were in flight when the provisioner stopped.
+	Interrupted
+	// Cancelled operations are those stopped upon user request.
+	Cancelled
 )
 
+// CancelledErrorMsg with the error message associated with operations cancelled by the user.
+const CancelledErrorMsg = "operation cancelled"
+
 var TaskProgressToString = map[TaskProgress]string{
-	Init:       "Init",
-	Registered: "Registered",
-	InProgress: "InProgress",
-	Error:      "Error",
-	Finished:   "Finished",
+	Init:        "Init",
+	Registered:  "Registered",
+	InProgress:  "InProgress",
+	Error:       "Error",
+	Finished:    "Finished",
+	Interrupted: "Interrupted",
+	Cancelled:   "Cancelled",
+}
+
+// IsTerminal checks if the progress represents an operation that will not progress any further.
+func (tp TaskProgress) IsTerminal() bool {
+	return tp == Error || tp == Finished || tp == Interrupted || tp == Cancelled
+}
+
+// CanBeResumed checks if the progress represents an operation that stopped before finishing its execution.
+func (tp TaskProgress) CanBeResumed() bool {
+	return tp == Error || tp == Interrupted || tp == Cancelled
 }
 
 // ToGRPCProvisionProgress contains the mapping between the internal and gRPC progress structure.
@@ -51,6 +72,10 @@ var ToGRPCProvisionProgress = map[TaskProgress]grpc_provisioner_go.ProvisionProg
 	InProgress: grpc_provisioner_go.ProvisionProgress_IN_PROGRESS,
 	Error:      grpc_provisioner_go.ProvisionProgress_ERROR,
 	Finished:   grpc_provisioner_go.ProvisionProgress_FINISHED,
+	// Interrupted operations are reported as errors as the gRPC API does not contemplate that state.
+	Interrupted: grpc_provisioner_go.ProvisionProgress_ERROR,
+	// Cancelled operations are reported as errors with the cancellation message.
+	Cancelled: grpc_provisioner_go.ProvisionProgress_ERROR,
 }
 
 // ToGRPCProvisionProgress contains the mapping between the internal and gRPC progress structure.
@@ -61,6 +86,9 @@ var ToGRPCOpStatus = map[TaskProgress]grpc_common_go.OpStatus{
 	InProgress: grpc_common_go.OpStatus_INPROGRESS,
 	Finished:   grpc_common_go.OpStatus_SUCCESS,
 	Error:      grpc_common_go.OpStatus_FAILED,
+	// Interrupted operations are reported as failed as the gRPC API does not contemplate that state.
+	Interrupted: grpc_common_go.OpStatus_FAILED,
+	Cancelled:   grpc_common_go.OpStatus_CANCELED,
 }
 
 // OperationType defines the base type for an enum with the types of operations supported.
@@ -104,13 +132,20 @@ type OperationResult struct {
 	ProvisionResult *ProvisionResult
 	// KubeConfigResult contains the extracted kubeconfig file.
 	KubeConfigResult *string
+	// Rollback with the actions performed to undo a failed operation, if requested.
+	Rollback []RollbackAction
+	// LockHolder with the request identifier of the operation holding the lock of the cluster while this
+	// operation waits for it.
+	LockHolder string
+	// QueuePosition with the position of the operation in the execution queue, or 0 if it is not queued.
+	QueuePosition int
 }
 
 // ToProvisionClusterResult transforms an operation result into a ProvisionClusterResponse.
 func (or *OperationResult) ToProvisionClusterResult() (*grpc_provisioner_go.ProvisionClusterResponse, derrors.Error) {
 	if or.Type != Provision {
-		log.Error().Interface("result", or).Msg("cannot create scale cluster response for other type")
-		return nil, derrors.NewInternalError("cannot create provision cluster response for other type").WithParams(or)
+		log.Error().Interface("result", redact.Value(or)).Msg("cannot create scale cluster response for other type")
+		return nil, derrors.NewInternalError("cannot create provision cluster response for other type").WithParams(redact.Value(or))
 	}
 	kubeConfig := ""
 	var staticIPAddresses *grpc_installer_go.StaticIPAddresses
@@ -141,8 +176,8 @@ func (or *OperationResult) ToProvisionClusterResult() (*grpc_provisioner_go.Prov
 // ToScaleClusterResult transforms an operation result into a ScaleClusterResponse.
 func (or *OperationResult) ToScaleClusterResult() (*grpc_provisioner_go.ScaleClusterResponse, derrors.Error) {
 	if or.Type != Scale {
-		log.Error().Interface("result", or).Msg("cannot create scale cluster response for other type")
-		return nil, derrors.NewInternalError("cannot create scale cluster response for other type").WithParams(or)
+		log.Error().Interface("result", redact.Value(or)).Msg("cannot create scale cluster response for other type")
+		return nil, derrors.NewInternalError("cannot create scale cluster response for other type").WithParams(redact.Value(or))
 	}
 	return &grpc_provisioner_go.ScaleClusterResponse{
 		RequestId:   or.RequestId,
@@ -155,8 +190,8 @@ func (or *OperationResult) ToScaleClusterResult() (*grpc_provisioner_go.ScaleClu
 func (or *OperationResult) ToOpResponse() (*grpc_common_go.OpResponse, derrors.Error) {
 	// TODO When provisioner is refactored to return OpResponses, this check should be updated.
 	if or.Type != Decommission {
-		log.Error().Interface("result", or).Msg("cannot create op response for other type")
-		return nil, derrors.NewInternalError("cannot create op response for other type").WithParams(or)
+		log.Error().Interface("result", redact.Value(or)).Msg("cannot create op response for other type")
+		return nil, derrors.NewInternalError("cannot create op response for other type").WithParams(redact.Value(or))
 	}
 	return &grpc_common_go.OpResponse{
 		OrganizationId: or.OrganizationId,
@@ -165,7 +200,18 @@ func (or *OperationResult) ToOpResponse() (*grpc_common_go.OpResponse, derrors.E
 		ElapsedTime:    or.ElapsedTime,
 		Timestamp:      time.Now().Unix(),
 		Status:         ToGRPCOpStatus[or.Progress],
-		Info:           "",
+		Info:           or.info(),
 		Error:          or.ErrorMsg,
 	}, nil
 }
+
+// info returns the additional information of the operation state.
+func (or *OperationResult) info() string {
+	if or.LockHolder != "" {
+		return fmt.Sprintf("waiting for operation %s on the same cluster", or.LockHolder)
+	}
+	if or.QueuePosition > 0 {
+		return fmt.Sprintf("queued in position %d", or.QueuePosition)
+	}
+	return ""
+}
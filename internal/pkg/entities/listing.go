@@ -0,0 +1,116 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"strings"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultListLimit with the number of operations returned when the filter does not specify a limit.
+const DefaultListLimit = 100
+
+// MaxListLimit with the maximum number of operations returned on a single page.
+const MaxListLimit = 1000
+
+// OperationFilter with the criteria to list the operations known by the provisioner. Empty fields do not
+// filter the operations.
+type OperationFilter struct {
+	// OrganizationID of the operations.
+	OrganizationID string `json:"organization_id,omitempty"`
+	// ClusterID target of the operations. Operations on clusters without identifier match by cluster name.
+	ClusterID string `json:"cluster_id,omitempty"`
+	// Type of the operations.
+	Type *OperationType `json:"type,omitempty"`
+	// Progress of the operations.
+	Progress *TaskProgress `json:"progress,omitempty"`
+	// From with the timestamp of the earliest registration time.
+	From int64 `json:"from,omitempty"`
+	// To with the timestamp of the latest registration time.
+	To int64 `json:"to,omitempty"`
+	// Offset with the number of matching operations to skip.
+	Offset int `json:"offset,omitempty"`
+	// Limit with the maximum number of operations to return. If 0, DefaultListLimit is used.
+	Limit int `json:"limit,omitempty"`
+}
+
+// Validate checks that the filter contains valid values.
+func (of *OperationFilter) Validate() derrors.Error {
+	if of.Offset < 0 {
+		return derrors.NewInvalidArgumentError("offset cannot be negative")
+	}
+	if of.Limit < 0 || of.Limit > MaxListLimit {
+		return derrors.NewInvalidArgumentError("limit out of range").WithParams(of.Limit, MaxListLimit)
+	}
+	if of.From != 0 && of.To != 0 && of.From > of.To {
+		return derrors.NewInvalidArgumentError("from cannot be after to")
+	}
+	return nil
+}
+
+// OperationSummary with the state of an operation returned on listings.
+type OperationSummary struct {
+	// RequestID with the request identifier.
+	RequestID string `json:"request_id"`
+	// Type of operation.
+	Type OperationType `json:"type"`
+	// OrganizationID associated with the operation.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID target of the operation.
+	ClusterID string `json:"cluster_id,omitempty"`
+	// ClusterName target of the operation.
+	ClusterName string `json:"cluster_name,omitempty"`
+	// Progress with the state of the operation.
+	Progress TaskProgress `json:"progress"`
+	// Registered with the timestamp when the operation was received.
+	Registered int64 `json:"registered"`
+	// ElapsedTime with the duration of the execution in nanoseconds.
+	ElapsedTime int64 `json:"elapsed_time"`
+	// ErrorMsg with the description of the error if the operation failed.
+	ErrorMsg string `json:"error,omitempty"`
+}
+
+// OperationList with a page of operations.
+type OperationList struct {
+	// Operations matching the filter ordered by registration time.
+	Operations []OperationSummary `json:"operations"`
+	// Total with the number of operations matching the filter.
+	Total int `json:"total"`
+	// NextOffset with the offset of the next page, or 0 if this is the last one.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// OperationTypeFromString returns the operation type matching a name regardless of the case.
+func OperationTypeFromString(name string) (OperationType, derrors.Error) {
+	for operationType, typeName := range ToOperationTypeString {
+		if strings.EqualFold(typeName, name) {
+			return operationType, nil
+		}
+	}
+	return 0, derrors.NewInvalidArgumentError("unsupported operation type").WithParams(name)
+}
+
+// TaskProgressFromString returns the progress matching a name regardless of the case.
+func TaskProgressFromString(name string) (TaskProgress, derrors.Error) {
+	for progress, progressName := range TaskProgressToString {
+		if strings.EqualFold(progressName, name) {
+			return progress, nil
+		}
+	}
+	return 0, derrors.NewInvalidArgumentError("unsupported progress").WithParams(name)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogLevel with the severity of a log entry.
+type LogLevel string
+
+const (
+	// InfoLevel for entries describing the regular progress of an operation.
+	InfoLevel LogLevel = "info"
+	// WarningLevel for entries describing unexpected situations that do not stop the operation.
+	WarningLevel LogLevel = "warning"
+	// ErrorLevel for entries describing failures.
+	ErrorLevel LogLevel = "error"
+)
+
+// StepDurationField with the name of the field holding the duration of a step on the entry that marks its end.
+const StepDurationField = "duration"
+
+// LogEntry with an event of the execution of an operation.
+type LogEntry struct {
+	// Timestamp when the entry was added.
+	Timestamp time.Time `json:"timestamp"`
+	// Level with the severity of the entry.
+	Level LogLevel `json:"level"`
+	// Step being executed when the entry was added, if any.
+	Step string `json:"step,omitempty"`
+	// Message describing the event.
+	Message string `json:"message"`
+	// Fields with additional key/value information of the event.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// NewLogEntry creates an entry with the current time.
+func NewLogEntry(level LogLevel, step string, message string) LogEntry {
+	return LogEntry{
+		Timestamp: time.Now(),
+		Level:     level,
+		Step:      step,
+		Message:   message,
+	}
+}
+
+// WithField returns a copy of the entry with an additional field.
+func (le LogEntry) WithField(key string, value string) LogEntry {
+	fields := make(map[string]string, len(le.Fields)+1)
+	for k, v := range le.Fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	le.Fields = fields
+	return le
+}
+
+// StepFinished checks if the entry marks the end of a step, returning the duration of the step and whether it
+// succeeded.
+func (le LogEntry) StepFinished() (time.Duration, bool, bool) {
+	if le.Step == "" {
+		return 0, false, false
+	}
+	value, exists := le.Fields[StepDurationField]
+	if !exists {
+		return 0, false, false
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false, false
+	}
+	return duration, le.Level != ErrorLevel, true
+}
+
+// String returns a single line representation of the entry without the timestamp.
+func (le LogEntry) String() string {
+	var builder strings.Builder
+	if le.Step != "" {
+		builder.WriteString(fmt.Sprintf("[%s] ", le.Step))
+	}
+	builder.WriteString(le.Message)
+	keys := make([]string, 0, len(le.Fields))
+	for key := range le.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf(" %s=%s", key, le.Fields[key]))
+	}
+	return builder.String()
+}
+
+// UnmarshalJSON parses an entry. Plain strings are accepted as info entries so that the records persisted by
+// previous versions can be loaded.
+func (le *LogEntry) UnmarshalJSON(data []byte) error {
+	var message string
+	if json.Unmarshal(data, &message) == nil {
+		*le = LogEntry{Level: InfoLevel, Message: message}
+		return nil
+	}
+	type plainEntry LogEntry
+	var entry plainEntry
+	err := json.Unmarshal(data, &entry)
+	if err != nil {
+		return err
+	}
+	*le = LogEntry(entry)
+	return nil
+}
@@ -54,7 +54,7 @@ func NewClusterRequest(request *grpc_provisioner_go.ClusterRequest) ClusterReque
 	}
 }
 
-func ValidClusterRequest(request *grpc_provisioner_go.ClusterRequest) derrors.Error{
+func ValidClusterRequest(request *grpc_provisioner_go.ClusterRequest, profileID string) derrors.Error{
 	if request.RequestId == "" {
 		return derrors.NewInvalidArgumentError("request_id must be set by infrastructure-manager")
 	}
@@ -64,6 +64,9 @@ func ValidClusterRequest(request *grpc_provisioner_go.ClusterRequest) derrors.Er
 	if request.ClusterId == "" {
 		return derrors.NewInvalidArgumentError("cluster_id cannot be empty")
 	}
+	if err := validCredentials(request.AzureCredentials, profileID); err != nil {
+		return err
+	}
 	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && (request.AzureOptions == nil || request.AzureOptions.ResourceGroup == "") {
 		return derrors.NewInvalidArgumentError("azure_options.resource_group cannot be empty")
 	}
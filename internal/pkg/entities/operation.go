@@ -16,7 +16,12 @@
 
 package entities
 
-import "github.com/nalej/derrors"
+import (
+	"context"
+	"fmt"
+
+	"github.com/nalej/derrors"
+)
 
 // InfrastructureOperation represents an ongoing operation being performed by the infrastructure
 // provider.
@@ -25,13 +30,14 @@ type InfrastructureOperation interface {
 	RequestID() string
 	// Metadata returns the operation associated metadata
 	Metadata() OperationMetadata
-	// Log returns the information associated with the execution of the operation
-	Log() []string
+	// Log returns the entries describing the execution of the operation
+	Log() []LogEntry
 	// Progress returns the operation state
 	Progress() TaskProgress
 	// Execute triggers the execution of the operation. The callback function on the execute is expected to be
-	// called when the operation finish its execution independently of the status.
-	Execute(func(requestID string))
+	// called when the operation finish its execution independently of the status. The operation must stop
+	// at the next step boundary once the context is cancelled.
+	Execute(ctx context.Context, callback func(requestID string))
 	// Cancel triggers the cancellation of the operation
 	Cancel() derrors.Error
 	// SetProgress set a new progress to the ongoing operation.
@@ -40,12 +46,58 @@ type InfrastructureOperation interface {
 	Result() OperationResult
 }
 
+// ExpirableOperation is implemented by the operations that can be stopped by the executor when they exceed their
+// deadline or stop making progress.
+type ExpirableOperation interface {
+	InfrastructureOperation
+	// Expire stops the operation and marks it as failed with the given reason. Later failures caused by the
+	// cancellation of the execution context must not overwrite the reason.
+	Expire(reason derrors.Error)
+}
+
+// InterruptibleOperation is implemented by the operations that can be stopped by the executor when the
+// provisioner shuts down.
+type InterruptibleOperation interface {
+	InfrastructureOperation
+	// Interrupt stops the operation at the next step boundary and marks it as interrupted. The running step is not
+	// cancelled and the operation is not rolled back, so that it can be resumed after a restart.
+	Interrupt()
+}
+
+// ResumableOperation is implemented by the operations that are able to continue their execution from the step
+// that failed instead of starting over.
+type ResumableOperation interface {
+	InfrastructureOperation
+	CheckpointProvider
+	// Resume prepares a failed operation to be executed again from a given checkpoint. Completed steps
+	// are skipped and their outputs are restored.
+	Resume(checkpoint StepCheckpoint) derrors.Error
+}
+
 // OperationMetadata associated with the operation.
 type OperationMetadata struct {
 	// OrganizationID associated with the operation.
 	OrganizationID string
 	// ClusterID target of the operation.
 	ClusterID string
+	// ClusterName target of the operation, used to identify clusters that do not have an identifier yet.
+	ClusterName string
+	// IsManagementCluster determines if the operation targets a management cluster. Operations on management
+	// clusters are scheduled before the ones on application clusters.
+	IsManagementCluster bool
 	// RequestID for tracking purposes.
 	RequestID string
 }
+
+// ClusterKey returns the key identifying the cluster targeted by the operation. An empty key is returned if
+// the operation does not target an identifiable cluster.
+func (om OperationMetadata) ClusterKey() string {
+	cluster := om.ClusterID
+	if cluster == "" {
+		cluster = om.ClusterName
+	}
+	if cluster == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", om.OrganizationID, cluster)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import "github.com/nalej/grpc-installer-go"
+
+// Platform identifies the infrastructure where the provisioner creates or adopts the clusters. The requests of the
+// gRPC API use the enumeration of the installer API, which is mapped with NewPlatform when a request is received.
+type Platform int
+
+// Platforms supported by the provisioner.
+const (
+	// UnsupportedPlatform with the value of the platforms of the installer API not supported by the provisioner.
+	UnsupportedPlatform Platform = iota
+	// AzurePlatform identifies the clusters provisioned on Azure AKS.
+	AzurePlatform
+	// BareMetalPlatform identifies the clusters installed with kubeadm on the hosts of an inventory.
+	BareMetalPlatform
+	// FakePlatform selects the fake provider that simulates the clusters in an inventory.
+	FakePlatform
+	// BYOCPlatform identifies the existing clusters adopted by the provisioner.
+	BYOCPlatform
+	// AWSPlatform identifies the clusters provisioned on Amazon EKS.
+	AWSPlatform
+	// GCPPlatform identifies the clusters provisioned on Google GKE.
+	GCPPlatform
+)
+
+// Names of the platforms that are not part of the installer API, used by the credentials profiles and the CLI.
+const (
+	// FakePlatformName with the name used to select the fake provider.
+	FakePlatformName = "FAKE"
+	// BYOCPlatformName with the name of the platform of the adopted clusters.
+	BYOCPlatformName = "BYOC"
+	// AWSPlatformName with the name of the platform of the EKS clusters.
+	AWSPlatformName = "AWS"
+	// GCPPlatformName with the name of the platform of the GKE clusters.
+	GCPPlatformName = "GCP"
+)
+
+// The enumeration of platforms of the installer API (github.com/nalej/grpc-installer-go v0.0.38) does not define
+// the platforms supported only by the provisioner. The requests select them with the values starting at
+// extendedPlatformBase, above the range of the enumeration.
+//
+// TODO: Add FAKE, BYOC, AWS and GCP to the Platform enumeration of grpc-installer-go and bump the dependency. The
+// same numbers must be kept, as they are used by the clients.
+const extendedPlatformBase = 100
+
+// grpcPlatforms with the value of each platform on the requests of the gRPC API.
+var grpcPlatforms = map[Platform]grpc_installer_go.Platform{
+	AzurePlatform:     grpc_installer_go.Platform_AZURE,
+	BareMetalPlatform: grpc_installer_go.Platform_BAREMETAL,
+	FakePlatform:      extendedPlatformBase,
+	BYOCPlatform:      extendedPlatformBase + 1,
+	AWSPlatform:       extendedPlatformBase + 2,
+	GCPPlatform:       extendedPlatformBase + 3,
+}
+
+// platformNames with the name of each platform.
+var platformNames = map[Platform]string{
+	AzurePlatform:     grpc_installer_go.Platform_AZURE.String(),
+	BareMetalPlatform: grpc_installer_go.Platform_BAREMETAL.String(),
+	FakePlatform:      FakePlatformName,
+	BYOCPlatform:      BYOCPlatformName,
+	AWSPlatform:       AWSPlatformName,
+	GCPPlatform:       GCPPlatformName,
+}
+
+// NewPlatform maps the platform of a request of the gRPC API.
+func NewPlatform(platform grpc_installer_go.Platform) Platform {
+	for result, value := range grpcPlatforms {
+		if value == platform {
+			return result
+		}
+	}
+	return UnsupportedPlatform
+}
+
+// PlatformFromName returns the platform with a given name, as used by the credentials profiles.
+func PlatformFromName(name string) Platform {
+	for result, value := range platformNames {
+		if value == name {
+			return result
+		}
+	}
+	return UnsupportedPlatform
+}
+
+// ToGRPC returns the value of the platform on the requests of the gRPC API.
+func (p Platform) ToGRPC() grpc_installer_go.Platform {
+	return grpcPlatforms[p]
+}
+
+// String returns the name of the platform.
+func (p Platform) String() string {
+	if name, exists := platformNames[p]; exists {
+		return name
+	}
+	return "UNSUPPORTED"
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"net"
+	"regexp"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+)
+
+const (
+	// FileProfileSource identifies the profiles loaded from the profile directory.
+	FileProfileSource = "file"
+	// KubernetesProfileSource identifies the profiles loaded from Kubernetes secrets. They cannot be modified
+	// through the API.
+	KubernetesProfileSource = "kubernetes"
+	// APIProfileSource identifies the profiles created through the API.
+	APIProfileSource = "api"
+)
+
+// profileIDPattern with the format of the profile identifiers, which are also used as file names.
+var profileIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// CredentialsProfile with a named set of infrastructure credentials managed by the provisioner. Requests reference
+// a profile instead of embedding the credentials.
+type CredentialsProfile struct {
+	// ID of the profile.
+	ID string `json:"id"`
+	// Platform with the target platform of the credentials, e.g. AZURE.
+	Platform string `json:"platform"`
+	// Description of the profile.
+	Description string `json:"description,omitempty"`
+	// Organizations allowed to use the profile. If empty, any organization may use it.
+	Organizations []string `json:"organizations,omitempty"`
+	// AzureCredentials used by the profiles of the AZURE platform. Profiles of the BYOC platform use them to manage
+	// the DNS zone of the cluster.
+	AzureCredentials *grpc_provisioner_go.AzureCredentials `json:"azure_credentials,omitempty"`
+	// AWSCredentials used by the profiles of the AWS platform.
+	AWSCredentials *AWSCredentials `json:"aws_credentials,omitempty"`
+	// GCPCredentials used by the profiles of the GCP platform.
+	GCPCredentials *GCPCredentials `json:"gcp_credentials,omitempty"`
+	// KubeConfig of the existing cluster adopted by the profiles of the BYOC platform.
+	KubeConfig string `json:"kube_config,omitempty"`
+	// IPAddresses of the existing cluster adopted by the profiles of the BYOC platform, indexed by the name of the
+	// address, e.g. ingressPublicIPAddress.
+	IPAddresses map[string]string `json:"ip_addresses,omitempty"`
+	// Source from which the profile was loaded: file, kubernetes or api.
+	Source string `json:"source,omitempty"`
+	// Updated with the timestamp of the last modification of the profile.
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// AWSCredentials with the access keys of an AWS account and the resources of the account used by the EKS clusters.
+type AWSCredentials struct {
+	// AccessKeyID of the IAM user.
+	AccessKeyID string `json:"access_key_id"`
+	// SecretAccessKey of the IAM user.
+	SecretAccessKey string `json:"secret_access_key"`
+	// Region where the clusters are created.
+	Region string `json:"region"`
+	// ClusterRoleARN with the IAM role assumed by the control plane of the clusters.
+	ClusterRoleARN string `json:"cluster_role_arn"`
+	// NodeRoleARN with the IAM role of the nodes of the clusters.
+	NodeRoleARN string `json:"node_role_arn"`
+	// SubnetIDs where the clusters and their nodes are placed.
+	SubnetIDs []string `json:"subnet_ids"`
+	// Endpoint replacing the endpoints of the AWS services, e.g. to use a local stand-in.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// GCPCredentials with the service account of a Google Cloud project and the location of its GKE clusters.
+type GCPCredentials struct {
+	// ProjectID of the Google Cloud project.
+	ProjectID string `json:"project_id"`
+	// Zone where the clusters are created when the requests do not include one, e.g. europe-west1-b.
+	Zone string `json:"zone"`
+	// ServiceAccountKey with the JSON key of the service account.
+	ServiceAccountKey string `json:"service_account_key"`
+	// Network where the clusters are placed. If empty, the default network of the project is used.
+	Network string `json:"network,omitempty"`
+	// Endpoint replacing the endpoints of the Google APIs, e.g. to use a local stand-in.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// ValidProfileID checks the format of a profile identifier.
+func ValidProfileID(profileID string) derrors.Error {
+	if !profileIDPattern.MatchString(profileID) {
+		return derrors.NewInvalidArgumentError("profile id must contain lowercase letters, digits and dashes").WithParams(profileID)
+	}
+	return nil
+}
+
+// Validate checks that the profile contains the credentials required by its platform.
+func (cp *CredentialsProfile) Validate() derrors.Error {
+	if err := ValidProfileID(cp.ID); err != nil {
+		return err
+	}
+	switch cp.Platform {
+	case BYOCPlatformName:
+		return cp.validateBYOC()
+	case AWSPlatformName:
+		return cp.validateAWSCredentials()
+	case GCPPlatformName:
+		return cp.validateGCPCredentials()
+	}
+	platform, exists := grpc_installer_go.Platform_value[cp.Platform]
+	if !exists {
+		return derrors.NewInvalidArgumentError("unsupported profile platform").WithParams(cp.ID, cp.Platform)
+	}
+	switch grpc_installer_go.Platform(platform) {
+	case grpc_installer_go.Platform_AZURE:
+		return cp.validateAzureCredentials()
+	default:
+		return derrors.NewInvalidArgumentError("platform does not support credentials profiles").WithParams(cp.ID, cp.Platform)
+	}
+}
+
+// validateAzureCredentials checks that the profile contains complete Azure credentials.
+func (cp *CredentialsProfile) validateAzureCredentials() derrors.Error {
+	credentials := cp.AzureCredentials
+	if credentials == nil {
+		return derrors.NewInvalidArgumentError("azure_credentials must be set").WithParams(cp.ID, cp.Platform)
+	}
+	if credentials.ClientId == "" || credentials.ClientSecret == "" || credentials.TenantId == "" || credentials.SubscriptionId == "" {
+		return derrors.NewInvalidArgumentError("azure_credentials must contain client_id, client_secret, tenant_id and subscription_id").WithParams(cp.ID)
+	}
+	return nil
+}
+
+// validateAWSCredentials checks that the profile contains the access keys and the resources required to create
+// EKS clusters.
+func (cp *CredentialsProfile) validateAWSCredentials() derrors.Error {
+	credentials := cp.AWSCredentials
+	if credentials == nil {
+		return derrors.NewInvalidArgumentError("aws_credentials must be set").WithParams(cp.ID, cp.Platform)
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" || credentials.Region == "" {
+		return derrors.NewInvalidArgumentError("aws_credentials must contain access_key_id, secret_access_key and region").WithParams(cp.ID)
+	}
+	if credentials.ClusterRoleARN == "" || credentials.NodeRoleARN == "" || len(credentials.SubnetIDs) == 0 {
+		return derrors.NewInvalidArgumentError("aws_credentials must contain cluster_role_arn, node_role_arn and subnet_ids").WithParams(cp.ID)
+	}
+	return nil
+}
+
+// validateGCPCredentials checks that the profile contains the service account and the location of the GKE
+// clusters.
+func (cp *CredentialsProfile) validateGCPCredentials() derrors.Error {
+	credentials := cp.GCPCredentials
+	if credentials == nil {
+		return derrors.NewInvalidArgumentError("gcp_credentials must be set").WithParams(cp.ID, cp.Platform)
+	}
+	if credentials.ProjectID == "" || credentials.Zone == "" || credentials.ServiceAccountKey == "" {
+		return derrors.NewInvalidArgumentError("gcp_credentials must contain project_id, zone and service_account_key").WithParams(cp.ID)
+	}
+	return nil
+}
+
+// validateBYOC checks that the profile describes the cluster to adopt. The ingress address is required as it
+// is the target of the DNS entries of every cluster.
+func (cp *CredentialsProfile) validateBYOC() derrors.Error {
+	if cp.KubeConfig == "" {
+		return derrors.NewInvalidArgumentError("kube_config must be set when platform is BYOC").WithParams(cp.ID)
+	}
+	if err := cp.validateAzureCredentials(); err != nil {
+		return err
+	}
+	if cp.IPAddresses[IngressIPAddressName] == "" {
+		return derrors.NewInvalidArgumentError("ip_addresses must contain the ingress address").WithParams(cp.ID, IngressIPAddressName)
+	}
+	for name, address := range cp.IPAddresses {
+		switch name {
+		case IngressIPAddressName, DNSPublicIPAddress, CoreDNSPublicIPAddress, VPNServerPublicIPAddress:
+		default:
+			return derrors.NewInvalidArgumentError("unsupported address name").WithParams(cp.ID, name)
+		}
+		if net.ParseIP(address) == nil {
+			return derrors.NewInvalidArgumentError("invalid IP address").WithParams(cp.ID, name, address)
+		}
+	}
+	return nil
+}
+
+// AllowsOrganization checks if an organization may use the profile.
+func (cp *CredentialsProfile) AllowsOrganization(organizationID string) bool {
+	if len(cp.Organizations) == 0 {
+		return true
+	}
+	for _, allowed := range cp.Organizations {
+		if allowed == organizationID {
+			return true
+		}
+	}
+	return false
+}
+
+// Masked returns a copy of the profile without the secrets so that it can be returned by the API.
+func (cp *CredentialsProfile) Masked() *CredentialsProfile {
+	masked := *cp
+	if cp.AzureCredentials != nil {
+		credentials := *cp.AzureCredentials
+		if credentials.ClientSecret != "" {
+			credentials.ClientSecret = redact.Mask
+		}
+		masked.AzureCredentials = &credentials
+	}
+	if cp.AWSCredentials != nil {
+		credentials := *cp.AWSCredentials
+		if credentials.SecretAccessKey != "" {
+			credentials.SecretAccessKey = redact.Mask
+		}
+		masked.AWSCredentials = &credentials
+	}
+	if cp.GCPCredentials != nil {
+		credentials := *cp.GCPCredentials
+		if credentials.ServiceAccountKey != "" {
+			credentials.ServiceAccountKey = redact.Mask
+		}
+		masked.GCPCredentials = &credentials
+	}
+	if cp.KubeConfig != "" {
+		masked.KubeConfig = redact.Mask
+	}
+	return &masked
+}
+
+// ProfileID with the identifier of a credentials profile.
+type ProfileID struct {
+	// ID of the profile.
+	ID string `json:"id"`
+}
+
+// ProfileList with the credentials profiles managed by the provisioner.
+type ProfileList struct {
+	// Profiles without their secrets.
+	Profiles []*CredentialsProfile `json:"profiles"`
+}
+
+// ProfileValidation with the result of checking the credentials of a profile against its platform.
+type ProfileValidation struct {
+	// ID of the profile.
+	ID string `json:"id"`
+	// Valid determines if the platform accepted the credentials.
+	Valid bool `json:"valid"`
+	// Error returned by the platform, if any.
+	Error string `json:"error,omitempty"`
+}
@@ -28,8 +28,9 @@ const DNSPublicIPAddress = "dnsPublicIPAddress"
 const CoreDNSPublicIPAddress = "corednsPublicIPAddress"
 const VPNServerPublicIPAddress = "vpnserverPublicIPAddress"
 
-// ValidProvisionClusterRequest validates the request to create a new cluster.
-func ValidProvisionClusterRequest(request *grpc_provisioner_go.ProvisionClusterRequest) derrors.Error {
+// ValidProvisionClusterRequest validates the request to create a new cluster. The credentials may be omitted if the
+// request references a credentials profile.
+func ValidProvisionClusterRequest(request *grpc_provisioner_go.ProvisionClusterRequest, profileID string) derrors.Error {
 	if request.RequestId == "" {
 		return derrors.NewInvalidArgumentError("request_id must be set")
 	}
@@ -45,15 +46,52 @@ func ValidProvisionClusterRequest(request *grpc_provisioner_go.ProvisionClusterR
 	if request.NodeType == "" {
 		return derrors.NewInvalidArgumentError("node_type must be set")
 	}
-	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil {
+	if err := validCredentials(request.AzureCredentials, profileID); err != nil {
+		return err
+	}
+	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil && profileID == "" {
 		return derrors.NewInvalidArgumentError("azure_credentials must be set when type is Azure")
 	}
 	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureOptions == nil {
 		return derrors.NewInvalidArgumentError("azure_options must be set when type is Azure")
 	}
+	platform := NewPlatform(request.TargetPlatform)
+	if platform == AWSPlatform && profileID == "" {
+		return derrors.NewInvalidArgumentError("a credentials profile must be set when type is AWS")
+	}
+	if platform == AWSPlatform && (request.AzureOptions == nil || request.AzureOptions.DnsZoneName == "") {
+		return derrors.NewInvalidArgumentError("azure_options.dns_zone_name must be set when type is AWS")
+	}
+	if platform == GCPPlatform && profileID == "" {
+		return derrors.NewInvalidArgumentError("a credentials profile must be set when type is GCP")
+	}
+	if platform == GCPPlatform && (request.AzureOptions == nil || request.AzureOptions.DnsZoneName == "") {
+		return derrors.NewInvalidArgumentError("azure_options.dns_zone_name must be set when type is GCP")
+	}
+	if platform == BYOCPlatform && profileID == "" {
+		return derrors.NewInvalidArgumentError("a credentials profile must be set when type is BYOC")
+	}
+	if platform == BYOCPlatform && (request.AzureOptions == nil || request.AzureOptions.DnsZoneName == "") {
+		return derrors.NewInvalidArgumentError("azure_options.dns_zone_name must be set when type is BYOC")
+	}
 	return nil
 }
 
+// ValidResumeRequest validates the request to resume a failed provisioning. The original provisioning request is
+// optional, but it must refer to the same operation when present.
+func ValidResumeRequest(requestID string, provision *grpc_provisioner_go.ProvisionClusterRequest, profileID string) derrors.Error {
+	if requestID == "" {
+		return derrors.NewInvalidArgumentError("request_id must be set")
+	}
+	if provision == nil {
+		return nil
+	}
+	if provision.RequestId != requestID {
+		return derrors.NewInvalidArgumentError("provision.request_id must match request_id")
+	}
+	return ValidProvisionClusterRequest(provision, profileID)
+}
+
 type AzureOptions struct {
 	// ResourceGroup where the cluster will be provisioned.
 	ResourceGroup string
@@ -61,6 +99,12 @@ type AzureOptions struct {
 	DNSZoneName string
 }
 
+// DNSOptions with the DNS zone used by the providers that publish the records of the clusters on other platforms.
+type DNSOptions struct {
+	// ZoneName with the name of the target DNS zone onto which the new cluster entries will be added.
+	ZoneName string
+}
+
 // ProvisionRequest with the information required to perform a provisioning operation.
 type ProvisionRequest struct {
 	// RequestID with the request identifier.
@@ -87,6 +131,10 @@ type ProvisionRequest struct {
 	IsProduction bool
 	// AzureOptions with the provisioning specific options.
 	AzureOptions *AzureOptions
+	// DNSOptions with the DNS zone of the cluster on the platforms other than Azure.
+	DNSOptions *DNSOptions
+	// RollbackOnFailure determines if the resources created by a failed provisioning must be released.
+	RollbackOnFailure bool
 }
 
 func NewAzureOptions(request *grpc_provisioner_go.AzureProvisioningOptions) *AzureOptions {
@@ -99,6 +147,15 @@ func NewAzureOptions(request *grpc_provisioner_go.AzureProvisioningOptions) *Azu
 	}
 }
 
+// NewDNSOptions creates the DNS options of a request. The gRPC API only carries the DNS zone in the Azure options,
+// so it is taken from them for every platform.
+func NewDNSOptions(request *grpc_provisioner_go.AzureProvisioningOptions) *DNSOptions {
+	if request == nil || request.DnsZoneName == "" {
+		return nil
+	}
+	return &DNSOptions{ZoneName: request.DnsZoneName}
+}
+
 func NewProvisionRequest(request *grpc_provisioner_go.ProvisionClusterRequest) ProvisionRequest {
 	return ProvisionRequest{
 		RequestID:           request.RequestId,
@@ -112,6 +169,7 @@ func NewProvisionRequest(request *grpc_provisioner_go.ProvisionClusterRequest) P
 		IsManagementCluster: request.IsManagementCluster,
 		IsProduction:        request.IsProduction,
 		AzureOptions:        NewAzureOptions(request.AzureOptions),
+		DNSOptions:          NewDNSOptions(request.AzureOptions),
 	}
 }
 
@@ -180,7 +238,7 @@ func (pr *ProvisionResult) SetIPAddress(addressName string, IP string) {
 }
 
 // ValidScaleClusterRequest checks that the scale request contains the required values.
-func ValidScaleClusterRequest(request *grpc_provisioner_go.ScaleClusterRequest) derrors.Error {
+func ValidScaleClusterRequest(request *grpc_provisioner_go.ScaleClusterRequest, profileID string) derrors.Error {
 	if request.RequestId == "" {
 		return derrors.NewInvalidArgumentError("request_id must be set by infrastructure-manager")
 	}
@@ -193,7 +251,10 @@ func ValidScaleClusterRequest(request *grpc_provisioner_go.ScaleClusterRequest)
 	if request.IsManagementCluster {
 		return derrors.NewInvalidArgumentError("can only scale application clusters")
 	}
-	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil {
+	if err := validCredentials(request.AzureCredentials, profileID); err != nil {
+		return err
+	}
+	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil && profileID == "" {
 		return derrors.NewInvalidArgumentError("azure_credentials cannot be empty")
 	}
 	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && (request.AzureOptions == nil || request.AzureOptions.ResourceGroup == "") {
@@ -202,7 +263,7 @@ func ValidScaleClusterRequest(request *grpc_provisioner_go.ScaleClusterRequest)
 	return nil
 }
 
-func ValidDecommissionClusterRequest(request *grpc_provisioner_go.DecommissionClusterRequest) derrors.Error {
+func ValidDecommissionClusterRequest(request *grpc_provisioner_go.DecommissionClusterRequest, profileID string) derrors.Error {
 	if request.RequestId == "" {
 		return derrors.NewInvalidArgumentError("request_id must be set")
 	}
@@ -212,7 +273,10 @@ func ValidDecommissionClusterRequest(request *grpc_provisioner_go.DecommissionCl
 	if !request.IsManagementCluster && request.ClusterId == "" {
 		return derrors.NewInvalidArgumentError("cluster_id must be set")
 	}
-	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil {
+	if err := validCredentials(request.AzureCredentials, profileID); err != nil {
+		return err
+	}
+	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureCredentials == nil && profileID == "" {
 		return derrors.NewInvalidArgumentError("azure_credentials must be set when type is Azure")
 	}
 	if request.TargetPlatform == grpc_installer_go.Platform_AZURE && request.AzureOptions == nil {
@@ -221,6 +285,17 @@ func ValidDecommissionClusterRequest(request *grpc_provisioner_go.DecommissionCl
 	return nil
 }
 
+// validCredentials checks that a request does not embed credentials and reference a profile at the same time.
+func validCredentials(azureCredentials *grpc_provisioner_go.AzureCredentials, profileID string) derrors.Error {
+	if profileID == "" {
+		return nil
+	}
+	if azureCredentials != nil {
+		return derrors.NewInvalidArgumentError("azure_credentials cannot be set when a credentials profile is used")
+	}
+	return ValidProfileID(profileID)
+}
+
 type DecommissionRequest struct {
 	// RequestID with the request identifier.
 	RequestID string
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/rs/zerolog/log"
+)
+
+// InterruptedErrorMsg with the error message associated with operations that were in flight when the
+// provisioner stopped.
+const InterruptedErrorMsg = "operation interrupted by a provisioner restart"
+
+// RequestProvider is implemented by the operations that are able to expose the request that originated them
+// so that it can be persisted alongside the operation state.
+type RequestProvider interface {
+	// Request returns the internal request associated with the operation.
+	Request() interface{}
+}
+
+// OperationRecord with the persistent representation of an infrastructure operation.
+type OperationRecord struct {
+	// RequestID with the request identifier.
+	RequestID string `json:"request_id"`
+	// OrganizationID associated with the operation.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID target of the operation.
+	ClusterID string `json:"cluster_id"`
+	// Type of operation being executed.
+	Type OperationType `json:"type"`
+	// Request with the serialized request that originated the operation.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Progress with the state of the operation.
+	Progress TaskProgress `json:"progress"`
+	// Log with the information associated with the execution of the operation.
+	Log []LogEntry `json:"log"`
+	// Result with the last known result of the operation.
+	Result OperationResult `json:"result"`
+	// Checkpoint with the state of the steps for step based operations.
+	Checkpoint *StepCheckpoint `json:"checkpoint,omitempty"`
+	// Created with the timestamp when the record was first stored.
+	Created int64 `json:"created"`
+	// Updated with the timestamp of the last update of the record.
+	Updated int64 `json:"updated"`
+}
+
+// NewOperationRecord creates a record with the current state of an operation.
+func NewOperationRecord(operation InfrastructureOperation) OperationRecord {
+	metadata := operation.Metadata()
+	result := operation.Result()
+	now := time.Now().Unix()
+	record := OperationRecord{
+		RequestID:      operation.RequestID(),
+		OrganizationID: metadata.OrganizationID,
+		ClusterID:      metadata.ClusterID,
+		Type:           result.Type,
+		Progress:       operation.Progress(),
+		Log:            operation.Log(),
+		Result:         result,
+		Created:        now,
+		Updated:        now,
+	}
+	if provider, ok := operation.(CheckpointProvider); ok {
+		record.Checkpoint = provider.Checkpoint()
+	}
+	record.Redact()
+	if provider, ok := operation.(RequestProvider); ok {
+		// Credentials are never persisted, operations restored after a restart require the request again.
+		raw, err := redact.JSON(provider.Request())
+		if err != nil {
+			log.Warn().Err(err).Str("requestID", record.RequestID).Msg("cannot serialize operation request")
+		} else {
+			record.Request = raw
+		}
+	}
+	return record
+}
+
+// Redact removes the credentials from the result and the checkpoint of the record so that they are not persisted.
+// The kubeconfig files are dropped instead of masked, operations restored after a restart retrieve them again from
+// the provider when they are resumed.
+func (or *OperationRecord) Redact() {
+	if or.Result.ProvisionResult != nil && or.Result.ProvisionResult.RawKubeConfig != "" {
+		// The result may point to the one of the operation being executed.
+		provisionResult := *or.Result.ProvisionResult
+		provisionResult.RawKubeConfig = ""
+		or.Result.ProvisionResult = &provisionResult
+	}
+	or.Result.KubeConfigResult = nil
+	if or.Checkpoint != nil {
+		checkpoint := or.Checkpoint.Copy()
+		for key := range checkpoint.Outputs {
+			if redact.IsSensitive(key) {
+				delete(checkpoint.Outputs, key)
+			}
+		}
+		or.Checkpoint = checkpoint
+	}
+}
+
+// MarkInterrupted updates the record to reflect that the operation will not be completed.
+func (or *OperationRecord) MarkInterrupted() {
+	or.Progress = Interrupted
+	or.Result.Progress = Interrupted
+	or.Result.ErrorMsg = InterruptedErrorMsg
+	or.Log = append(or.Log, NewLogEntry(ErrorLevel, "", InterruptedErrorMsg))
+	or.Updated = time.Now().Unix()
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// StepCheckpoint with the state of an operation that is executed as a sequence of steps.
+type StepCheckpoint struct {
+	// Completed with the names of the steps that finished successfully.
+	Completed []string `json:"completed"`
+	// Failed with the name of the step that failed on the last execution, if any.
+	Failed string `json:"failed,omitempty"`
+	// Outputs produced by the completed steps.
+	Outputs map[string]string `json:"outputs"`
+}
+
+// NewStepCheckpoint creates an empty checkpoint.
+func NewStepCheckpoint() *StepCheckpoint {
+	return &StepCheckpoint{
+		Completed: make([]string, 0),
+		Outputs:   make(map[string]string, 0),
+	}
+}
+
+// IsCompleted checks if a given step has been completed.
+func (sc *StepCheckpoint) IsCompleted(stepName string) bool {
+	for _, completed := range sc.Completed {
+		if completed == stepName {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalidate marks a completed step as pending so that it is executed again when the operation is resumed.
+func (sc *StepCheckpoint) Invalidate(stepName string) {
+	completed := make([]string, 0, len(sc.Completed))
+	for _, name := range sc.Completed {
+		if name != stepName {
+			completed = append(completed, name)
+		}
+	}
+	sc.Completed = completed
+}
+
+// Copy returns a deep copy of the checkpoint.
+func (sc *StepCheckpoint) Copy() *StepCheckpoint {
+	result := &StepCheckpoint{
+		Completed: make([]string, len(sc.Completed)),
+		Failed:    sc.Failed,
+		Outputs:   make(map[string]string, len(sc.Outputs)),
+	}
+	copy(result.Completed, sc.Completed)
+	for key, value := range sc.Outputs {
+		result.Outputs[key] = value
+	}
+	return result
+}
+
+// CheckpointProvider is implemented by the operations that are executed as a sequence of steps so that their
+// checkpoint can be persisted alongside the operation state.
+type CheckpointProvider interface {
+	// Checkpoint returns the state of the steps of the operation.
+	Checkpoint() *StepCheckpoint
+}
+
+// RollbackAction with the outcome of undoing a step of a failed operation.
+type RollbackAction struct {
+	// Step that has been undone.
+	Step string `json:"step"`
+	// ErrorMsg with the description of the error if the step could not be undone.
+	ErrorMsg string `json:"error_msg,omitempty"`
+}
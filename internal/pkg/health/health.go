@@ -0,0 +1,236 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package health reports whether the provisioner can accept operations through the standard gRPC health service
+// and the HTTP endpoints used by the Kubernetes probes.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/profiles"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// LivenessPath where the liveness of the provisioner is served.
+	LivenessPath = "/healthz"
+	// ReadinessPath where the readiness of the provisioner is served.
+	ReadinessPath = "/readyz"
+)
+
+// DefaultInterval with the default period to evaluate the checks and update the gRPC health service.
+const DefaultInterval = 5 * time.Second
+
+// healthyCheck with the value reported for the checks that pass.
+const healthyCheck = "ok"
+
+// Check verifies a condition required to serve requests. It returns nil if the condition holds.
+type Check func() derrors.Error
+
+// namedCheck with a check and the name used to report it.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Report with the readiness of the provisioner.
+type Report struct {
+	// Status with the serving status of the provisioner: SERVING or NOT_SERVING.
+	Status string `json:"status"`
+	// Checks with the result of each check: ok or the reason why it failed.
+	Checks map[string]string `json:"checks"`
+}
+
+// Ready determines if the report allows serving requests.
+func (r *Report) Ready() bool {
+	return r.Status == grpc_health_v1.HealthCheckResponse_SERVING.String()
+}
+
+// Monitor evaluates the checks of the provisioner and publishes the result.
+type Monitor struct {
+	sync.Mutex
+	// server with the gRPC health service.
+	server *health.Server
+	// checks evaluated to determine the readiness.
+	checks []namedCheck
+	// serving with the last status published.
+	serving bool
+	// shutdown determines if the provisioner is stopping, in which case it is never ready again.
+	shutdown bool
+	// stop is used to stop the evaluation loop.
+	stop chan struct{}
+}
+
+// NewMonitor creates a monitor without checks.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		server:  health.NewServer(),
+		checks:  make([]namedCheck, 0),
+		serving: true,
+	}
+}
+
+// AddCheck adds a condition required to serve requests.
+func (m *Monitor) AddCheck(name string, check Check) {
+	m.Lock()
+	defer m.Unlock()
+	m.checks = append(m.checks, namedCheck{name: name, check: check})
+}
+
+// Register registers the gRPC health service on a server.
+func (m *Monitor) Register(server *grpc.Server) {
+	grpc_health_v1.RegisterHealthServer(server, m.server)
+}
+
+// Evaluate runs the checks, publishes the resulting status on the gRPC health service and returns the report.
+func (m *Monitor) Evaluate() Report {
+	m.Lock()
+	defer m.Unlock()
+	report := Report{Checks: make(map[string]string, len(m.checks))}
+	serving := !m.shutdown
+	if m.shutdown {
+		report.Checks["shutdown"] = "provisioner is stopping"
+	}
+	for _, named := range m.checks {
+		if err := named.check(); err != nil {
+			serving = false
+			report.Checks[named.name] = err.Error()
+		} else {
+			report.Checks[named.name] = healthyCheck
+		}
+	}
+	status := grpc_health_v1.HealthCheckResponse_SERVING
+	if !serving {
+		status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	report.Status = status.String()
+	if serving != m.serving {
+		m.logChange(report)
+		m.serving = serving
+	}
+	if !m.shutdown {
+		m.server.SetServingStatus("", status)
+	}
+	return report
+}
+
+// logChange logs the failing checks when the status changes. The caller is expected to hold the lock.
+func (m *Monitor) logChange(report Report) {
+	if report.Ready() {
+		log.Info().Msg("provisioner is ready")
+		return
+	}
+	failing := make([]string, 0)
+	for name, result := range report.Checks {
+		if result != healthyCheck {
+			failing = append(failing, name)
+		}
+	}
+	sort.Strings(failing)
+	log.Warn().Strs("checks", failing).Msg("provisioner is not ready")
+}
+
+// Start periodically evaluates the checks.
+func (m *Monitor) Start(interval time.Duration) {
+	m.Evaluate()
+	m.Lock()
+	defer m.Unlock()
+	if m.stop != nil || interval <= 0 {
+		return
+	}
+	m.stop = make(chan struct{})
+	go m.loop(interval, m.stop)
+}
+
+// loop evaluates the checks until stopped.
+func (m *Monitor) loop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.Evaluate()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Shutdown reports the provisioner as not serving from now on, and stops the evaluation loop.
+func (m *Monitor) Shutdown() {
+	m.Lock()
+	defer m.Unlock()
+	m.shutdown = true
+	m.serving = false
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.server.Shutdown()
+}
+
+// LivenessHandler returns the handler of the liveness endpoint. The provisioner is alive as long as it answers,
+// even while draining, so that the running operations are not interrupted by a restart.
+func (m *Monitor) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(healthyCheck))
+	})
+}
+
+// ReadinessHandler returns the handler of the readiness endpoint. It answers with the report of the checks, using
+// the 503 status code when the provisioner is not ready.
+func (m *Monitor) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := m.Evaluate()
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// ExecutorCheck fails while the executor is draining or stopping.
+func ExecutorCheck(executor *workflow.Executor) Check {
+	return func() derrors.Error {
+		mode := executor.Mode()
+		if mode == workflow.DrainingMode || mode == workflow.StoppingMode {
+			return derrors.NewUnavailableError("executor is not accepting operations").WithParams(workflow.ExecutorModeToString[mode])
+		}
+		return nil
+	}
+}
+
+// StoreCheck fails while the operations cannot be persisted.
+func StoreCheck(executor *workflow.Executor) Check {
+	return executor.StoreError
+}
+
+// ProfilesCheck fails while any credentials profile is rejected by its platform.
+func ProfilesCheck(registry *profiles.Registry) Check {
+	return registry.Check
+}
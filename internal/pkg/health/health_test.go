@@ -0,0 +1,98 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// readiness requests the readiness endpoint returning the status code and the report.
+func readiness(monitor *Monitor) (int, Report) {
+	recorder := httptest.NewRecorder()
+	monitor.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", ReadinessPath, nil))
+	report := Report{}
+	gomega.Expect(json.Unmarshal(recorder.Body.Bytes(), &report)).To(gomega.Succeed())
+	return recorder.Code, report
+}
+
+// grpcStatus returns the status published on the gRPC health service.
+func grpcStatus(monitor *Monitor) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	response, err := monitor.server.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	gomega.Expect(err).To(gomega.Succeed())
+	return response.Status
+}
+
+var _ = ginkgo.Describe("Health monitor", func() {
+
+	var executor *workflow.Executor
+	var monitor *Monitor
+
+	ginkgo.BeforeEach(func() {
+		executor = workflow.NewExecutor(store.NewMemoryOperationStore())
+		monitor = NewMonitor()
+		monitor.AddCheck("executor", ExecutorCheck(executor))
+		monitor.AddCheck("store", StoreCheck(executor))
+	})
+
+	ginkgo.It("is ready while all the checks pass", func() {
+		code, report := readiness(monitor)
+		gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(report.Checks).To(gomega.HaveKeyWithValue("executor", healthyCheck))
+		gomega.Expect(grpcStatus(monitor)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+	})
+
+	ginkgo.It("is not ready while draining", func() {
+		gomega.Expect(executor.SetMode(workflow.DrainingMode)).To(gomega.Succeed())
+		code, report := readiness(monitor)
+		gomega.Expect(code).To(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(report.Ready()).To(gomega.BeFalse())
+		gomega.Expect(report.Checks["executor"]).NotTo(gomega.Equal(healthyCheck))
+		gomega.Expect(grpcStatus(monitor)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+
+		gomega.Expect(executor.SetMode(workflow.ActiveMode)).To(gomega.Succeed())
+		code, _ = readiness(monitor)
+		gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("is not ready while a check fails", func() {
+		monitor.AddCheck("profiles", func() derrors.Error {
+			return derrors.NewFailedPreconditionError("credentials profiles rejected by their platform")
+		})
+		monitor.Evaluate()
+		gomega.Expect(grpcStatus(monitor)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+	})
+
+	ginkgo.It("stays alive but not ready once shut down", func() {
+		monitor.Shutdown()
+		code, _ := readiness(monitor)
+		gomega.Expect(code).To(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(grpcStatus(monitor)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+		recorder := httptest.NewRecorder()
+		monitor.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", LivenessPath, nil))
+		gomega.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics exposes the metrics of the provisioner operations in the Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace of the provisioner metrics.
+const Namespace = "provisioner"
+
+// Path where the metrics are served.
+const Path = "/metrics"
+
+// StepSucceeded with the outcome of the steps that completed successfully.
+const StepSucceeded = "success"
+
+// StepFailed with the outcome of the steps that failed.
+const StepFailed = "failure"
+
+// operationBuckets in seconds ranging from 10 seconds to roughly 1.5 hours.
+var operationBuckets = prometheus.ExponentialBuckets(10, 2, 10)
+
+// stepBuckets in seconds ranging from 1 second to roughly 1 hour.
+var stepBuckets = prometheus.ExponentialBuckets(1, 2, 13)
+
+// Metrics collects the metrics of the operations from the executor and the operation logs.
+type Metrics struct {
+	sync.Mutex
+	registry          *prometheus.Registry
+	scheduled         *prometheus.CounterVec
+	operations        *prometheus.CounterVec
+	operationDuration *prometheus.HistogramVec
+	steps             *prometheus.CounterVec
+	stepDuration      *prometheus.HistogramVec
+	// types contains the type of the operations being executed indexed by request identifier.
+	types map[string]string
+}
+
+// NewMetrics creates the metrics of the operations managed by an executor. The metrics are not fed until they
+// are attached to the executor and the hub.
+func NewMetrics(executor *workflow.Executor) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		scheduled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operations_scheduled_total",
+			Help:      "Number of operations scheduled for execution.",
+		}, []string{"type"}),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operations_total",
+			Help:      "Number of operations that are no longer executed by outcome.",
+		}, []string{"type", "outcome"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the execution of the operations.",
+			Buckets:   operationBuckets,
+		}, []string{"type", "outcome"}),
+		steps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operation_steps_total",
+			Help:      "Number of operation steps executed by outcome.",
+		}, []string{"type", "step", "outcome"}),
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "operation_step_duration_seconds",
+			Help:      "Duration of the operation steps.",
+			Buckets:   stepBuckets,
+		}, []string{"type", "step", "outcome"}),
+		types: make(map[string]string, 0),
+	}
+	queued := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "executor_queued_operations",
+		Help:      "Number of operations waiting to be executed.",
+	}, func() float64 {
+		return float64(executor.QueueLength())
+	})
+	running := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "executor_running_operations",
+		Help:      "Number of operations being executed.",
+	}, func() float64 {
+		return float64(executor.RunningOperations())
+	})
+	m.registry.MustRegister(m.scheduled, m.operations, m.operationDuration, m.steps, m.stepDuration, queued, running,
+		prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	return m
+}
+
+// Attach registers the metrics as observer of the executor and listener of the operation events.
+func (m *Metrics) Attach(executor *workflow.Executor, hub *watch.Hub) {
+	executor.AddObserver(m)
+	hub.AddListener(m.OnEvent)
+}
+
+// Handler returns the HTTP handler serving the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// OperationScheduled counts a new operation.
+func (m *Metrics) OperationScheduled(operation entities.InfrastructureOperation) {
+	m.scheduled.WithLabelValues(operationType(operation)).Inc()
+}
+
+// OperationStarted tracks the type of an operation so that its steps can be labeled.
+func (m *Metrics) OperationStarted(operation entities.InfrastructureOperation) {
+	m.Lock()
+	defer m.Unlock()
+	m.types[operation.RequestID()] = operationType(operation)
+}
+
+// OperationFinished records the outcome and the duration of an operation.
+func (m *Metrics) OperationFinished(operation entities.InfrastructureOperation, duration time.Duration) {
+	m.Lock()
+	delete(m.types, operation.RequestID())
+	m.Unlock()
+	opType := operationType(operation)
+	outcome := strings.ToLower(entities.TaskProgressToString[operation.Progress()])
+	m.operations.WithLabelValues(opType, outcome).Inc()
+	if duration > 0 {
+		m.operationDuration.WithLabelValues(opType, outcome).Observe(duration.Seconds())
+	}
+}
+
+// OnEvent records the steps finished by the operations being executed from their log entries.
+func (m *Metrics) OnEvent(event watch.Event) {
+	if event.Type != watch.LogEvent || event.LogEntry == nil {
+		return
+	}
+	duration, succeeded, finished := event.LogEntry.StepFinished()
+	if !finished {
+		return
+	}
+	m.Lock()
+	opType, exists := m.types[event.RequestID]
+	m.Unlock()
+	if !exists {
+		return
+	}
+	outcome := StepSucceeded
+	if !succeeded {
+		outcome = StepFailed
+	}
+	m.steps.WithLabelValues(opType, event.LogEntry.Step, outcome).Inc()
+	m.stepDuration.WithLabelValues(opType, event.LogEntry.Step, outcome).Observe(duration.Seconds())
+}
+
+// operationType returns the label value of the type of an operation.
+func operationType(operation entities.InfrastructureOperation) string {
+	return strings.ToLower(entities.ToOperationTypeString[operation.Result().Type])
+}
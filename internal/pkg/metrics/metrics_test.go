@@ -0,0 +1,122 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"time"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/watch"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// scrape returns the text exposition of the metrics.
+func scrape(m *Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", Path, nil))
+	gomega.Expect(recorder.Code).Should(gomega.Equal(200))
+	body, err := ioutil.ReadAll(recorder.Body)
+	gomega.Expect(err).To(gomega.Succeed())
+	return string(body)
+}
+
+func newOperation(requestID string, operationType entities.OperationType, progress entities.TaskProgress) entities.InfrastructureOperation {
+	return workflow.NewRestoredOperation(entities.OperationRecord{
+		RequestID: requestID,
+		Type:      operationType,
+		Progress:  progress,
+		Result:    entities.OperationResult{RequestId: requestID, Type: operationType},
+	})
+}
+
+var _ = ginkgo.Describe("Metrics", func() {
+
+	var executor *workflow.Executor
+	var hub *watch.Hub
+	var metrics *Metrics
+
+	ginkgo.BeforeEach(func() {
+		executor = workflow.NewExecutor(store.NewMemoryOperationStore())
+		hub = watch.NewHub()
+		metrics = NewMetrics(executor)
+		metrics.Attach(executor, hub)
+	})
+
+	ginkgo.It("should expose the executor gauges", func() {
+		output := scrape(metrics)
+		gomega.Expect(output).Should(gomega.ContainSubstring("provisioner_executor_queued_operations 0"))
+		gomega.Expect(output).Should(gomega.ContainSubstring("provisioner_executor_running_operations 0"))
+	})
+
+	ginkgo.It("should record the outcome and duration of the operations", func() {
+		operation := newOperation("req-1", entities.Provision, entities.InProgress)
+		metrics.OperationScheduled(operation)
+		metrics.OperationStarted(operation)
+		operation.SetProgress(entities.Finished)
+		metrics.OperationFinished(operation, 2*time.Minute)
+
+		output := scrape(metrics)
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operations_scheduled_total{type="provision"} 1`))
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operations_total{outcome="finished",type="provision"} 1`))
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operation_duration_seconds_sum{outcome="finished",type="provision"} 120`))
+	})
+
+	ginkgo.It("should not record the duration of operations cancelled while queued", func() {
+		operation := newOperation("req-1", entities.Scale, entities.Cancelled)
+		metrics.OperationScheduled(operation)
+		metrics.OperationFinished(operation, 0)
+
+		output := scrape(metrics)
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operations_total{outcome="cancelled",type="scale"} 1`))
+		gomega.Expect(output).ShouldNot(gomega.ContainSubstring(`provisioner_operation_duration_seconds_count{outcome="cancelled"`))
+	})
+
+	ginkgo.It("should record the steps from the operation log", func() {
+		operation := newOperation("req-1", entities.Provision, entities.InProgress)
+		metrics.OperationStarted(operation)
+		hub.PublishLog("req-1", 0, entities.NewLogEntry(entities.InfoLevel, "createCluster", "step createCluster started"))
+		hub.PublishLog("req-1", 1, entities.NewLogEntry(entities.InfoLevel, "createCluster", "step createCluster completed").
+			WithField(entities.StepDurationField, "30s"))
+		hub.PublishLog("req-1", 2, entities.NewLogEntry(entities.ErrorLevel, "createDNS", "step createDNS failed").
+			WithField(entities.StepDurationField, "5s"))
+
+		output := scrape(metrics)
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operation_steps_total{outcome="success",step="createCluster",type="provision"} 1`))
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operation_step_duration_seconds_sum{outcome="success",step="createCluster",type="provision"} 30`))
+		gomega.Expect(output).Should(gomega.ContainSubstring(`provisioner_operation_steps_total{outcome="failure",step="createDNS",type="provision"} 1`))
+	})
+
+	ginkgo.It("should ignore the steps of operations not being executed", func() {
+		hub.PublishLog("unknown", 0, entities.NewLogEntry(entities.InfoLevel, "createCluster", "step createCluster completed").
+			WithField(entities.StepDurationField, "30s"))
+		gomega.Expect(scrape(metrics)).ShouldNot(gomega.ContainSubstring("provisioner_operation_steps_total"))
+	})
+
+	ginkgo.It("should be fed by the executor", func() {
+		operation := newOperation("req-1", entities.Decommission, entities.Init)
+		gomega.Expect(executor.ScheduleOperation(operation)).To(gomega.Succeed())
+		gomega.Eventually(func() string {
+			return scrape(metrics)
+		}).Should(gomega.ContainSubstring(`provisioner_operations_total{outcome="registered",type="decommission"} 1`))
+	})
+
+})
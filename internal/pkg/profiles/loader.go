@@ -0,0 +1,158 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// profileExtension with the extension of the profile files.
+const profileExtension = ".json"
+
+// DefaultSecretSelector with the label selector of the Kubernetes secrets containing credentials profiles.
+const DefaultSecretSelector = "nalej.com/credentials-profile"
+
+// SecretProfileKey with the key of the secret data containing the profile.
+const SecretProfileKey = "profile.json"
+
+// parseProfile decodes and validates a profile. The identifier is used if the profile does not contain one.
+func parseProfile(raw []byte, defaultID string, source string) (*entities.CredentialsProfile, derrors.Error) {
+	profile := &entities.CredentialsProfile{}
+	if err := json.Unmarshal(raw, profile); err != nil {
+		return nil, derrors.AsErrorWithParams(err, "cannot decode credentials profile", defaultID)
+	}
+	if profile.ID == "" {
+		profile.ID = defaultID
+	}
+	profile.Source = source
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// LoadDirectory loads the profiles stored as JSON files in a directory. The name of the file is used as
+// identifier if the profile does not contain one. Any invalid profile makes the load fail.
+func LoadDirectory(path string) ([]*entities.CredentialsProfile, derrors.Error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*entities.CredentialsProfile{}, nil
+		}
+		return nil, derrors.AsError(err, "cannot read credentials profile directory")
+	}
+	result := make([]*entities.CredentialsProfile, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != profileExtension {
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			return nil, derrors.AsErrorWithParams(err, "cannot read credentials profile", file.Name())
+		}
+		profile, pErr := parseProfile(raw, strings.TrimSuffix(file.Name(), profileExtension), entities.FileProfileSource)
+		if pErr != nil {
+			return nil, pErr
+		}
+		log.Info().Str("profile", profile.ID).Str("platform", profile.Platform).Msg("credentials profile loaded from file")
+		result = append(result, profile)
+	}
+	return result, nil
+}
+
+// LoadKubernetesSecrets loads the profiles stored in the secrets of a namespace matching a label selector. Each
+// secret contains the profile in the profile.json key, the name of the secret is used as identifier if the profile
+// does not contain one. Any invalid profile makes the load fail.
+func LoadKubernetesSecrets(client kubernetes.Interface, namespace string, selector string) ([]*entities.CredentialsProfile, derrors.Error) {
+	secrets, err := client.CoreV1().Secrets(namespace).List(metaV1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, derrors.AsErrorWithParams(err, "cannot list credentials profile secrets", namespace)
+	}
+	result := make([]*entities.CredentialsProfile, 0, len(secrets.Items))
+	for index := range secrets.Items {
+		profile, pErr := ProfileFromSecret(&secrets.Items[index])
+		if pErr != nil {
+			return nil, pErr
+		}
+		log.Info().Str("profile", profile.ID).Str("platform", profile.Platform).Str("secret", secrets.Items[index].Name).
+			Msg("credentials profile loaded from secret")
+		result = append(result, profile)
+	}
+	return result, nil
+}
+
+// ProfileFromSecret extracts the profile stored in a Kubernetes secret.
+func ProfileFromSecret(secret *v1.Secret) (*entities.CredentialsProfile, derrors.Error) {
+	raw, exists := secret.Data[SecretProfileKey]
+	if !exists {
+		return nil, derrors.NewInvalidArgumentError("secret does not contain a credentials profile").WithParams(secret.Name, SecretProfileKey)
+	}
+	return parseProfile(raw, secret.Name, entities.KubernetesProfileSource)
+}
+
+// SaveProfile writes a profile to the profile directory. The file is replaced atomically and is only readable by
+// the provisioner.
+func SaveProfile(path string, profile *entities.CredentialsProfile) derrors.Error {
+	raw, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return derrors.AsError(err, "cannot encode credentials profile")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return derrors.AsError(err, "cannot create credentials profile directory")
+	}
+	target := filepath.Join(path, profile.ID+profileExtension)
+	temp, err := ioutil.TempFile(path, "."+profile.ID)
+	if err != nil {
+		return derrors.AsError(err, "cannot create credentials profile file")
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(raw); err != nil {
+		_ = temp.Close()
+		return derrors.AsError(err, "cannot write credentials profile")
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return derrors.AsError(err, "cannot sync credentials profile")
+	}
+	if err := temp.Close(); err != nil {
+		return derrors.AsError(err, "cannot close credentials profile")
+	}
+	if err := os.Rename(temp.Name(), target); err != nil {
+		return derrors.AsError(err, "cannot replace credentials profile")
+	}
+	return nil
+}
+
+// RemoveProfile deletes the file of a profile from the profile directory.
+func RemoveProfile(path string, profileID string) derrors.Error {
+	err := os.Remove(filepath.Join(path, profileID+profileExtension))
+	if err != nil && !os.IsNotExist(err) {
+		return derrors.AsError(err, "cannot remove credentials profile")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testProfileJSON = `{"platform": "AZURE", "azure_credentials": {"client_id": "client", "client_secret": "secret-value",
+	"tenant_id": "tenant", "subscription_id": "subscription"}}`
+
+// profileSecret creates a secret containing a profile.
+func profileSecret(name string, labels map[string]string, content string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "nalej", Labels: labels},
+		Data:       map[string][]byte{SecretProfileKey: []byte(content)},
+	}
+}
+
+var _ = ginkgo.Describe("Credentials profiles loader", func() {
+
+	ginkgo.Context("loading a directory", func() {
+		var tempDir string
+
+		ginkgo.BeforeEach(func() {
+			dir, err := ioutil.TempDir("", "profiles")
+			gomega.Expect(err).To(gomega.Succeed())
+			tempDir = dir
+		})
+
+		ginkgo.AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+
+		ginkgo.It("uses the file name as identifier", func() {
+			gomega.Expect(ioutil.WriteFile(filepath.Join(tempDir, "azure-prod.json"), []byte(testProfileJSON), 0600)).To(gomega.Succeed())
+			gomega.Expect(ioutil.WriteFile(filepath.Join(tempDir, "README.md"), []byte("not a profile"), 0600)).To(gomega.Succeed())
+			loaded, err := LoadDirectory(tempDir)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded).To(gomega.HaveLen(1))
+			gomega.Expect(loaded[0].ID).To(gomega.Equal("azure-prod"))
+			gomega.Expect(loaded[0].Source).To(gomega.Equal(entities.FileProfileSource))
+		})
+
+		ginkgo.It("fails on invalid profiles", func() {
+			gomega.Expect(ioutil.WriteFile(filepath.Join(tempDir, "azure-prod.json"), []byte(`{"platform": "AZURE"}`), 0600)).To(gomega.Succeed())
+			_, err := LoadDirectory(tempDir)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("returns no profiles for a missing directory", func() {
+			loaded, err := LoadDirectory(filepath.Join(tempDir, "missing"))
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("loading Kubernetes secrets", func() {
+		labels := map[string]string{DefaultSecretSelector: "true"}
+
+		ginkgo.It("loads the secrets matching the selector", func() {
+			client := fake.NewSimpleClientset(
+				profileSecret("azure-prod", labels, testProfileJSON),
+				profileSecret("other", map[string]string{}, testProfileJSON))
+			loaded, err := LoadKubernetesSecrets(client, "nalej", DefaultSecretSelector)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded).To(gomega.HaveLen(1))
+			gomega.Expect(loaded[0].ID).To(gomega.Equal("azure-prod"))
+			gomega.Expect(loaded[0].Source).To(gomega.Equal(entities.KubernetesProfileSource))
+		})
+
+		ginkgo.It("fails on invalid secrets", func() {
+			client := fake.NewSimpleClientset(profileSecret("azure-prod", labels, `{"platform": "AZURE"}`))
+			_, err := LoadKubernetesSecrets(client, "nalej", DefaultSecretSelector)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package profiles manages the named credentials profiles that requests reference instead of embedding the
+// credentials of the infrastructure providers.
+package profiles
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey with the gRPC metadata key used by the requests to reference a credentials profile.
+const MetadataKey = "x-credentials-profile"
+
+// IDFromContext returns the credentials profile referenced in the metadata of an incoming call, or an empty
+// string if none is referenced.
+func IDFromContext(ctx context.Context) (string, derrors.Error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return "", nil
+	}
+	if len(values) > 1 {
+		return "", derrors.NewInvalidArgumentError("only one credentials profile can be referenced")
+	}
+	profileID := strings.TrimSpace(values[0])
+	if err := entities.ValidProfileID(profileID); err != nil {
+		return "", err
+	}
+	return profileID, nil
+}
+
+// Registry with the credentials profiles available to the requests.
+type Registry struct {
+	sync.RWMutex
+	profiles map[string]*entities.CredentialsProfile
+	// path of the directory where the profiles created through the API are persisted. If empty, they are only
+	// kept in memory.
+	path string
+	// rejected contains the error returned by the platform for the profiles whose validation failed.
+	rejected map[string]string
+}
+
+var registryInstance *Registry
+var registryOnce sync.Once
+
+// GetRegistry returns the registry of credentials profiles shared by the provisioner.
+func GetRegistry() *Registry {
+	registryOnce.Do(func() {
+		registryInstance = NewRegistry("")
+	})
+	return registryInstance
+}
+
+// NewRegistry creates an empty registry persisting the profiles managed through the API in a given directory.
+func NewRegistry(path string) *Registry {
+	return &Registry{
+		profiles: make(map[string]*entities.CredentialsProfile, 0),
+		path:     path,
+		rejected: make(map[string]string, 0),
+	}
+}
+
+// SetPath sets the directory where the profiles managed through the API are persisted.
+func (r *Registry) SetPath(path string) {
+	r.Lock()
+	defer r.Unlock()
+	r.path = path
+}
+
+// Load adds a set of validated profiles replacing the existing ones with the same identifier.
+func (r *Registry) Load(profiles []*entities.CredentialsProfile) {
+	r.Lock()
+	defer r.Unlock()
+	for _, profile := range profiles {
+		r.profiles[profile.ID] = profile
+		delete(r.rejected, profile.ID)
+	}
+}
+
+// Add registers a new profile. An AlreadyExists error is returned if the identifier is in use.
+func (r *Registry) Add(profile *entities.CredentialsProfile) derrors.Error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, exists := r.profiles[profile.ID]; exists {
+		return derrors.NewAlreadyExistsError("credentials profile already exists").WithParams(profile.ID)
+	}
+	return r.put(profile)
+}
+
+// Update replaces the content of an existing profile. Profiles loaded from Kubernetes secrets must be updated
+// through the secrets.
+func (r *Registry) Update(profile *entities.CredentialsProfile) derrors.Error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	previous, exists := r.profiles[profile.ID]
+	if !exists {
+		return derrors.NewNotFoundError("credentials profile not found").WithParams(profile.ID)
+	}
+	if previous.Source == entities.KubernetesProfileSource {
+		return derrors.NewFailedPreconditionError("profiles loaded from Kubernetes secrets cannot be modified").WithParams(profile.ID)
+	}
+	return r.put(profile)
+}
+
+// put stores a profile managed through the API. The caller must hold the lock.
+func (r *Registry) put(profile *entities.CredentialsProfile) derrors.Error {
+	stored := *profile
+	stored.Source = entities.APIProfileSource
+	stored.Updated = time.Now().Unix()
+	if r.path != "" {
+		if err := SaveProfile(r.path, &stored); err != nil {
+			return err
+		}
+		stored.Source = entities.FileProfileSource
+	}
+	r.profiles[stored.ID] = &stored
+	delete(r.rejected, stored.ID)
+	return nil
+}
+
+// Remove deletes a profile.
+func (r *Registry) Remove(profileID string) derrors.Error {
+	r.Lock()
+	defer r.Unlock()
+	profile, exists := r.profiles[profileID]
+	if !exists {
+		return derrors.NewNotFoundError("credentials profile not found").WithParams(profileID)
+	}
+	if profile.Source == entities.KubernetesProfileSource {
+		return derrors.NewFailedPreconditionError("profiles loaded from Kubernetes secrets cannot be removed").WithParams(profileID)
+	}
+	if profile.Source == entities.FileProfileSource && r.path != "" {
+		if err := RemoveProfile(r.path, profileID); err != nil {
+			return err
+		}
+	}
+	delete(r.profiles, profileID)
+	delete(r.rejected, profileID)
+	return nil
+}
+
+// Get returns a profile including its secrets.
+func (r *Registry) Get(profileID string) (*entities.CredentialsProfile, derrors.Error) {
+	r.RLock()
+	defer r.RUnlock()
+	profile, exists := r.profiles[profileID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("credentials profile not found").WithParams(profileID)
+	}
+	return profile, nil
+}
+
+// List returns the profiles sorted by identifier without their secrets.
+func (r *Registry) List() []*entities.CredentialsProfile {
+	r.RLock()
+	defer r.RUnlock()
+	result := make([]*entities.CredentialsProfile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		result = append(result, profile.Masked())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Resolve returns the profile referenced by a request checking that it targets the same platform and that the
+// organization of the request may use it.
+func (r *Registry) Resolve(profileID string, platform string, organizationID string) (*entities.CredentialsProfile, derrors.Error) {
+	profile, err := r.Get(profileID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Platform != platform {
+		return nil, derrors.NewFailedPreconditionError("credentials profile belongs to another platform").WithParams(profileID, profile.Platform)
+	}
+	if !profile.AllowsOrganization(organizationID) {
+		return nil, derrors.NewPermissionDeniedError("organization cannot use the credentials profile").WithParams(profileID, organizationID)
+	}
+	return profile, nil
+}
+
+// SetValidation records the result of validating a profile against its platform. Changing the profile clears the
+// result.
+func (r *Registry) SetValidation(profileID string, err derrors.Error) {
+	r.Lock()
+	defer r.Unlock()
+	if _, exists := r.profiles[profileID]; !exists {
+		return
+	}
+	if err != nil {
+		r.rejected[profileID] = err.Error()
+	} else {
+		delete(r.rejected, profileID)
+	}
+}
+
+// Check returns an error if the last validation of any profile failed.
+func (r *Registry) Check() derrors.Error {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.rejected) == 0 {
+		return nil
+	}
+	rejected := make([]string, 0, len(r.rejected))
+	for profileID := range r.rejected {
+		rejected = append(rejected, profileID)
+	}
+	sort.Strings(rejected)
+	return derrors.NewFailedPreconditionError("credentials profiles rejected by their platform").WithParams(strings.Join(rejected, ","))
+}
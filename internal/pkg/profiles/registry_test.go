@@ -0,0 +1,205 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiles
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/redact"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/metadata"
+)
+
+// testProfile creates a valid Azure profile.
+func testProfile(profileID string, organizations ...string) *entities.CredentialsProfile {
+	return &entities.CredentialsProfile{
+		ID:            profileID,
+		Platform:      "AZURE",
+		Organizations: organizations,
+		AzureCredentials: &grpc_provisioner_go.AzureCredentials{
+			ClientId:       "client",
+			ClientSecret:   "secret-value",
+			TenantId:       "tenant",
+			SubscriptionId: "subscription",
+		},
+	}
+}
+
+var _ = ginkgo.Describe("Credentials profiles registry", func() {
+
+	var tempDir string
+	var registry *Registry
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "profiles")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+		registry = NewRegistry(tempDir)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	ginkgo.It("persists the profiles added through the API", func() {
+		gomega.Expect(registry.Add(testProfile("azure-prod"))).To(gomega.Succeed())
+		gomega.Expect(registry.Add(testProfile("azure-prod"))).NotTo(gomega.Succeed())
+		gomega.Expect(filepath.Join(tempDir, "azure-prod.json")).To(gomega.BeAnExistingFile())
+
+		loaded, err := LoadDirectory(tempDir)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(loaded).To(gomega.HaveLen(1))
+		gomega.Expect(loaded[0].AzureCredentials.ClientSecret).To(gomega.Equal("secret-value"))
+
+		gomega.Expect(registry.Remove("azure-prod")).To(gomega.Succeed())
+		gomega.Expect(filepath.Join(tempDir, "azure-prod.json")).NotTo(gomega.BeAnExistingFile())
+		_, err = registry.Get("azure-prod")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("rejects invalid profiles", func() {
+		invalidID := testProfile("Azure_Prod")
+		gomega.Expect(registry.Add(invalidID)).NotTo(gomega.Succeed())
+		missingSecret := testProfile("azure-prod")
+		missingSecret.AzureCredentials.ClientSecret = ""
+		gomega.Expect(registry.Add(missingSecret)).NotTo(gomega.Succeed())
+		unknownPlatform := testProfile("azure-prod")
+		unknownPlatform.Platform = "OTHER"
+		gomega.Expect(registry.Add(unknownPlatform)).NotTo(gomega.Succeed())
+		gomega.Expect(registry.Update(testProfile("missing"))).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("does not modify the profiles loaded from Kubernetes secrets", func() {
+		profile := testProfile("azure-prod")
+		profile.Source = entities.KubernetesProfileSource
+		registry.Load([]*entities.CredentialsProfile{profile})
+		gomega.Expect(registry.Update(testProfile("azure-prod"))).NotTo(gomega.Succeed())
+		gomega.Expect(registry.Remove("azure-prod")).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("lists the profiles without their secrets", func() {
+		registry.Load([]*entities.CredentialsProfile{testProfile("b-profile"), testProfile("a-profile")})
+		listed := registry.List()
+		gomega.Expect(listed).To(gomega.HaveLen(2))
+		gomega.Expect(listed[0].ID).To(gomega.Equal("a-profile"))
+		for _, profile := range listed {
+			gomega.Expect(profile.AzureCredentials.ClientSecret).To(gomega.Equal(redact.Mask))
+		}
+		stored, err := registry.Get("a-profile")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(stored.AzureCredentials.ClientSecret).To(gomega.Equal("secret-value"))
+	})
+
+	ginkgo.It("resolves the profiles checking the platform and the organization", func() {
+		registry.Load([]*entities.CredentialsProfile{testProfile("azure-org1", "org1"), testProfile("azure-any")})
+		_, err := registry.Resolve("azure-org1", "AZURE", "org1")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = registry.Resolve("azure-org1", "AZURE", "org2")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = registry.Resolve("azure-any", "AZURE", "org2")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = registry.Resolve("azure-any", "MINIKUBE", "org2")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = registry.Resolve("missing", "AZURE", "org1")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("accepts the profiles describing an existing cluster", func() {
+		profile := testProfile("existing")
+		profile.Platform = entities.BYOCPlatformName
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.KubeConfig = "apiVersion: v1"
+		profile.IPAddresses = map[string]string{entities.IngressIPAddressName: "not-an-address"}
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.IPAddresses[entities.IngressIPAddressName] = "10.0.0.1"
+		gomega.Expect(registry.Add(profile)).To(gomega.Succeed())
+
+		_, err := registry.Resolve("existing", entities.BYOCPlatform.String(), "org1")
+		gomega.Expect(err).To(gomega.Succeed())
+		listed := registry.List()
+		gomega.Expect(listed).To(gomega.HaveLen(1))
+		gomega.Expect(listed[0].KubeConfig).To(gomega.Equal(redact.Mask))
+	})
+
+	ginkgo.It("accepts the profiles of an AWS account", func() {
+		profile := testProfile("aws-prod")
+		profile.Platform = entities.AWSPlatformName
+		profile.AzureCredentials = nil
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.AWSCredentials = &entities.AWSCredentials{
+			AccessKeyID: "access", SecretAccessKey: "secret-value", Region: "eu-west-1",
+			ClusterRoleARN: "cluster-role", NodeRoleARN: "node-role",
+		}
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.AWSCredentials.SubnetIDs = []string{"subnet-1"}
+		gomega.Expect(registry.Add(profile)).To(gomega.Succeed())
+
+		_, err := registry.Resolve("aws-prod", entities.AWSPlatform.String(), "org1")
+		gomega.Expect(err).To(gomega.Succeed())
+		listed := registry.List()
+		gomega.Expect(listed).To(gomega.HaveLen(1))
+		gomega.Expect(listed[0].AWSCredentials.SecretAccessKey).To(gomega.Equal(redact.Mask))
+	})
+
+	ginkgo.It("accepts the profiles of a GCP project", func() {
+		profile := testProfile("gcp-prod")
+		profile.Platform = entities.GCPPlatformName
+		profile.AzureCredentials = nil
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.GCPCredentials = &entities.GCPCredentials{ProjectID: "nalej-project", Zone: "europe-west1-b"}
+		gomega.Expect(registry.Add(profile)).NotTo(gomega.Succeed())
+		profile.GCPCredentials.ServiceAccountKey = "{\"type\": \"service_account\"}"
+		gomega.Expect(registry.Add(profile)).To(gomega.Succeed())
+
+		_, err := registry.Resolve("gcp-prod", entities.GCPPlatform.String(), "org1")
+		gomega.Expect(err).To(gomega.Succeed())
+		listed := registry.List()
+		gomega.Expect(listed).To(gomega.HaveLen(1))
+		gomega.Expect(listed[0].GCPCredentials.ServiceAccountKey).To(gomega.Equal(redact.Mask))
+	})
+
+	ginkgo.It("reports the profiles rejected by their platform", func() {
+		registry.Load([]*entities.CredentialsProfile{testProfile("azure-prod")})
+		gomega.Expect(registry.Check()).To(gomega.Succeed())
+		registry.SetValidation("azure-prod", derrors.NewUnauthenticatedError("invalid client secret"))
+		gomega.Expect(registry.Check()).NotTo(gomega.Succeed())
+		gomega.Expect(registry.Update(testProfile("azure-prod"))).To(gomega.Succeed())
+		gomega.Expect(registry.Check()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("reads the profile referenced in the call metadata", func() {
+		profileID, err := IDFromContext(context.Background())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(profileID).To(gomega.BeEmpty())
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "azure-prod"))
+		profileID, err = IDFromContext(ctx)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(profileID).To(gomega.Equal("azure-prod"))
+
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "../etc"))
+		_, err = IDFromContext(ctx)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redact masks the credentials contained in the requests, results and log entries of the provisioner
+// before they are logged, attached to errors or persisted.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Mask replacing the sensitive values.
+const Mask = "[REDACTED]"
+
+// sensitiveNames contains the fragments of the field names whose values must be masked. Names are compared in
+// lowercase ignoring underscores and dashes so that both Go fields and JSON keys are matched.
+var sensitiveNames = []string{
+	"secret",
+	"password",
+	"passwd",
+	"token",
+	"privatekey",
+	"apikey",
+	"accesskey",
+	"kubeconfig",
+}
+
+// secretKinds contains the Kubernetes resources whose data must be masked.
+var secretKinds = map[string]bool{
+	"Secret": true,
+}
+
+// secretDataFields contains the fields of the Kubernetes secrets holding the secret values.
+var secretDataFields = []string{"data", "stringData"}
+
+// IsSensitive checks if a field name is expected to hold a secret value.
+func IsSensitive(name string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(name))
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(normalized, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns a copy of a value with the sensitive fields masked. The copy is built from the JSON
+// representation of the value so it can be passed to zerolog or to derrors.WithParams. Values that cannot be
+// represented as JSON are fully masked.
+func Value(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return Mask
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return Mask
+	}
+	return walk(generic)
+}
+
+// JSON returns the JSON representation of a value with the sensitive fields masked.
+func JSON(value interface{}) ([]byte, error) {
+	return json.Marshal(Value(value))
+}
+
+// walk masks the sensitive fields of a generic JSON value.
+func walk(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		kind, _ := typed["kind"].(string)
+		for key, content := range typed {
+			if content != nil && content != "" && IsSensitive(key) {
+				typed[key] = Mask
+				continue
+			}
+			typed[key] = walk(content)
+		}
+		if secretKinds[kind] {
+			for _, field := range secretDataFields {
+				if _, exists := typed[field]; exists {
+					typed[field] = Mask
+				}
+			}
+		}
+		return typed
+	case []interface{}:
+		for index, content := range typed {
+			typed[index] = walk(content)
+		}
+		return typed
+	}
+	return value
+}
+
+// Writer masks the sensitive fields of the JSON log entries written by zerolog before passing them to the
+// underlying writer. Entries that are not JSON are written unchanged.
+type Writer struct {
+	out io.Writer
+}
+
+// NewWriter creates a writer masking the log entries sent to another writer.
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out}
+}
+
+// Write masks a log entry and writes it to the underlying writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	var entry map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entry); err != nil {
+		return w.out.Write(p)
+	}
+	masked, err := json.Marshal(walk(entry))
+	if err != nil {
+		return w.out.Write(p)
+	}
+	if _, err := w.out.Write(append(masked, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
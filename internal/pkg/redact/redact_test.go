@@ -0,0 +1,123 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-provisioner-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+const clientSecret = "azure-client-secret-value"
+const appPassword = "generated-app-password"
+const kubeConfig = "apiVersion: v1\nusers:\n- name: admin\n  user:\n    token: cluster-admin-token"
+
+// newTestRequest returns a provisioning request carrying credentials.
+func newTestRequest() *grpc_provisioner_go.ProvisionClusterRequest {
+	return &grpc_provisioner_go.ProvisionClusterRequest{
+		RequestId:      "request",
+		OrganizationId: "org",
+		ClusterName:    "cluster",
+		AzureCredentials: &grpc_provisioner_go.AzureCredentials{
+			ClientId:     "client",
+			ClientSecret: clientSecret,
+			TenantId:     "tenant",
+		},
+	}
+}
+
+var _ = ginkgo.Describe("Redaction", func() {
+
+	ginkgo.It("identifies the sensitive field names", func() {
+		for _, name := range []string{"ClientSecret", "client_secret", "PasswordCredentials", "access_token", "RawKubeConfig", "private-key"} {
+			gomega.Expect(IsSensitive(name)).To(gomega.BeTrue(), name)
+		}
+		for _, name := range []string{"ClientId", "tenant_id", "ClusterName", "keyId"} {
+			gomega.Expect(IsSensitive(name)).To(gomega.BeFalse(), name)
+		}
+	})
+
+	ginkgo.It("masks the credentials of the requests", func() {
+		raw, err := JSON(newTestRequest())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(raw)).NotTo(gomega.ContainSubstring(clientSecret))
+		gomega.Expect(string(raw)).To(gomega.ContainSubstring(Mask))
+		gomega.Expect(string(raw)).To(gomega.ContainSubstring("tenant"))
+		gomega.Expect(string(raw)).To(gomega.ContainSubstring("cluster"))
+	})
+
+	ginkgo.It("masks the generated passwords", func() {
+		password := appPassword
+		app := graphrbac.ApplicationCreateParameters{
+			PasswordCredentials: &[]graphrbac.PasswordCredential{{Value: &password}},
+		}
+		raw, err := JSON(app)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(raw)).NotTo(gomega.ContainSubstring(appPassword))
+	})
+
+	ginkgo.It("masks the data of Kubernetes secrets", func() {
+		secret := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "credentials"},
+			"data":       map[string]interface{}{"password": "c2VjcmV0", "user": "YWRtaW4="},
+		}
+		raw, err := JSON(secret)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(raw)).NotTo(gomega.ContainSubstring("YWRtaW4="))
+		gomega.Expect(string(raw)).To(gomega.ContainSubstring("credentials"))
+	})
+
+	ginkgo.It("masks the credentials attached to errors", func() {
+		kubeConfigCopy := kubeConfig
+		err := derrors.NewInternalError("cannot create cluster").WithParams(Value(newTestRequest()), Value(map[string]interface{}{
+			"KubeConfigResult": &kubeConfigCopy,
+		}))
+		gomega.Expect(err.DebugReport()).NotTo(gomega.ContainSubstring(clientSecret))
+		gomega.Expect(err.DebugReport()).NotTo(gomega.ContainSubstring("cluster-admin-token"))
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("request"))
+	})
+
+	ginkgo.It("masks the credentials written to the log", func() {
+		buffer := &bytes.Buffer{}
+		logger := zerolog.New(NewWriter(buffer))
+		logger.Info().Interface("request", newTestRequest()).Str("password", appPassword).Msg("provision cluster")
+		logger.Info().Interface("request", Value(newTestRequest())).Msg("provision cluster")
+		gomega.Expect(buffer.String()).NotTo(gomega.ContainSubstring(clientSecret))
+		gomega.Expect(buffer.String()).NotTo(gomega.ContainSubstring(appPassword))
+		lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+		gomega.Expect(lines).To(gomega.HaveLen(2))
+		entry := map[string]interface{}{}
+		gomega.Expect(json.Unmarshal(lines[0], &entry)).To(gomega.Succeed())
+		gomega.Expect(entry["message"]).To(gomega.Equal("provision cluster"))
+	})
+
+	ginkgo.It("writes the entries that are not JSON unchanged", func() {
+		buffer := &bytes.Buffer{}
+		written, err := NewWriter(buffer).Write([]byte("plain entry\n"))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(written).To(gomega.Equal(len("plain entry\n")))
+		gomega.Expect(buffer.String()).To(gomega.Equal("plain entry\n"))
+	})
+})
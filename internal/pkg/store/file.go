@@ -0,0 +1,336 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// MaxJournalLineSize with the maximum size of a journal entry. Operation records include the raw kubeconfig
+// and the operation log so the default scanner buffer is not enough.
+const MaxJournalLineSize = 16 * 1024 * 1024
+
+// DefaultCompactionSize with the minimum size of the journal before it is compacted while the store is open. The
+// journal is also allowed to double the size it had after the last compaction, so that stores with many records
+// are not compacted on every change.
+const DefaultCompactionSize = 32 * 1024 * 1024
+
+const (
+	saveEntry   = "save"
+	removeEntry = "remove"
+)
+
+// journalEntry with the structure of each line of the journal.
+type journalEntry struct {
+	// Action performed on the store.
+	Action string `json:"action"`
+	// RequestID affected by the action.
+	RequestID string `json:"request_id"`
+	// Record with the new state of the operation for save actions.
+	Record *entities.OperationRecord `json:"record,omitempty"`
+}
+
+// FileOperationStore with an append-only journal implementation of the operation store. The current state
+// is kept in memory and every change is appended to the journal file. When the store is opened, the journal
+// is replayed and compacted. The journal is compacted again whenever it outgrows its compaction threshold.
+type FileOperationStore struct {
+	*MemoryOperationStore
+	path    string
+	journal *os.File
+	// size of the journal file.
+	size int64
+	// minCompactionSize with the minimum size of the journal to be compacted.
+	minCompactionSize int64
+	// compactionSize with the size of the journal that triggers the next compaction.
+	compactionSize int64
+}
+
+// NewFileOperationStore opens or creates a journal on the given path.
+func NewFileOperationStore(path string) (*FileOperationStore, derrors.Error) {
+	fos := &FileOperationStore{
+		MemoryOperationStore: NewMemoryOperationStore(),
+		path:                 path,
+		minCompactionSize:    DefaultCompactionSize,
+	}
+	err := fos.replay()
+	if err != nil {
+		return nil, err
+	}
+	err = fos.compact()
+	if err != nil {
+		return nil, err
+	}
+	err = fos.open()
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("path", path).Int("records", len(fos.records)).Msg("operation store loaded")
+	return fos, nil
+}
+
+// SetMinCompactionSize changes the minimum size of the journal to be compacted.
+func (fos *FileOperationStore) SetMinCompactionSize(size int64) {
+	fos.Lock()
+	defer fos.Unlock()
+	fos.minCompactionSize = size
+	fos.updateCompactionSize()
+}
+
+// updateCompactionSize computes the size of the journal that triggers the next compaction. The caller is
+// expected to hold the lock.
+func (fos *FileOperationStore) updateCompactionSize() {
+	fos.compactionSize = 2 * fos.size
+	if fos.compactionSize < fos.minCompactionSize {
+		fos.compactionSize = fos.minCompactionSize
+	}
+}
+
+// open opens the journal to append the new entries.
+func (fos *FileOperationStore) open() derrors.Error {
+	journal, err := os.OpenFile(fos.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return derrors.AsError(err, "cannot open operation journal")
+	}
+	fos.journal = journal
+	return nil
+}
+
+// replay reads the journal and applies all the entries to the in-memory state.
+func (fos *FileOperationStore) replay() derrors.Error {
+	file, err := os.Open(fos.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return derrors.AsError(err, "cannot open operation journal")
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxJournalLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := journalEntry{}
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// A partially written entry may be found if the provisioner died while writing.
+			log.Warn().Err(err).Int("line", line).Msg("skipping invalid journal entry")
+			continue
+		}
+		switch entry.Action {
+		case saveEntry:
+			if entry.Record != nil {
+				fos.save(*entry.Record)
+			}
+		case removeEntry:
+			delete(fos.records, entry.RequestID)
+		default:
+			log.Warn().Str("action", entry.Action).Int("line", line).Msg("unknown journal action")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return derrors.AsError(err, "cannot read operation journal")
+	}
+	return nil
+}
+
+// compact rewrites the journal so that it only contains the current state of the records. The journal must not
+// be open for appending.
+func (fos *FileOperationStore) compact() derrors.Error {
+	dir := filepath.Dir(fos.path)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return derrors.AsError(err, "cannot create operation journal directory")
+	}
+	tmpPath := fos.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return derrors.AsError(err, "cannot create temporal operation journal")
+	}
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	for _, record := range fos.records {
+		toWrite := record
+		written, wErr := fos.writeEntry(writer, journalEntry{Action: saveEntry, RequestID: toWrite.RequestID, Record: &toWrite})
+		if wErr != nil {
+			tmp.Close()
+			return wErr
+		}
+		size += written
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot write temporal operation journal")
+	}
+	err = os.Rename(tmpPath, fos.path)
+	if err != nil {
+		return derrors.AsError(err, "cannot replace operation journal")
+	}
+	fos.size = size
+	fos.updateCompactionSize()
+	return nil
+}
+
+// compactOpen compacts the journal while the store is open. The journal is reopened even if the compaction
+// fails, as the entries keep being appended to the previous journal in that case. The caller is expected to
+// hold the lock.
+func (fos *FileOperationStore) compactOpen() derrors.Error {
+	if err := fos.journal.Close(); err != nil {
+		log.Warn().Err(err).Msg("cannot close operation journal before compacting it")
+	}
+	fos.journal = nil
+	err := fos.compact()
+	if err != nil {
+		// Avoid trying again on every change.
+		fos.updateCompactionSize()
+	}
+	if oErr := fos.open(); oErr != nil {
+		return oErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("path", fos.path).Int64("size", fos.size).Int("records", len(fos.records)).Msg("operation journal compacted")
+	return nil
+}
+
+// writeEntry serializes an entry as a new line of the journal. It returns the number of bytes written.
+func (fos *FileOperationStore) writeEntry(writer *bufio.Writer, entry journalEntry) (int64, derrors.Error) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return 0, derrors.AsError(err, "cannot serialize journal entry")
+	}
+	written, err := writer.Write(append(raw, '\n'))
+	if err != nil {
+		return 0, derrors.AsError(err, "cannot write journal entry")
+	}
+	return int64(written), nil
+}
+
+// append adds a new entry to the journal file. The caller is expected to hold the lock.
+func (fos *FileOperationStore) append(entry journalEntry) derrors.Error {
+	if fos.journal == nil {
+		return derrors.NewFailedPreconditionError("operation journal is closed")
+	}
+	writer := bufio.NewWriter(fos.journal)
+	written, err := fos.writeEntry(writer, entry)
+	if err != nil {
+		return err
+	}
+	fErr := writer.Flush()
+	if fErr == nil {
+		fErr = fos.journal.Sync()
+	}
+	if fErr != nil {
+		return derrors.AsError(fErr, "cannot persist journal entry")
+	}
+	fos.size += written
+	return nil
+}
+
+// compactIfNeeded compacts the journal once it reaches the compaction size. The entries are already persisted,
+// so a failed compaction is only reported. The caller is expected to hold the lock.
+func (fos *FileOperationStore) compactIfNeeded() {
+	if fos.size < fos.compactionSize {
+		return
+	}
+	if err := fos.compactOpen(); err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("cannot compact operation journal")
+	}
+}
+
+// Save creates or updates the record of an operation. The credentials of the record are removed before it is
+// written to the journal.
+func (fos *FileOperationStore) Save(record entities.OperationRecord) derrors.Error {
+	fos.Lock()
+	defer fos.Unlock()
+	record.Redact()
+	err := fos.append(journalEntry{Action: saveEntry, RequestID: record.RequestID, Record: &record})
+	if err != nil {
+		return err
+	}
+	fos.save(record)
+	fos.compactIfNeeded()
+	return nil
+}
+
+// Remove deletes the record of an operation.
+func (fos *FileOperationStore) Remove(requestID string) derrors.Error {
+	fos.Lock()
+	defer fos.Unlock()
+	_, exists := fos.records[requestID]
+	if !exists {
+		return derrors.NewNotFoundError("operation record not found").WithParams(requestID)
+	}
+	err := fos.append(journalEntry{Action: removeEntry, RequestID: requestID})
+	if err != nil {
+		return err
+	}
+	delete(fos.records, requestID)
+	fos.compactIfNeeded()
+	return nil
+}
+
+// Check verifies that the journal is open and that it has not been removed or replaced on disk.
+func (fos *FileOperationStore) Check() derrors.Error {
+	fos.Lock()
+	defer fos.Unlock()
+	if fos.journal == nil {
+		return derrors.NewUnavailableError("operation journal is closed")
+	}
+	opened, err := fos.journal.Stat()
+	if err != nil {
+		return derrors.AsError(err, "cannot access operation journal")
+	}
+	current, err := os.Stat(fos.path)
+	if err != nil {
+		return derrors.AsError(err, "cannot access operation journal")
+	}
+	if !os.SameFile(opened, current) {
+		return derrors.NewUnavailableError("operation journal has been replaced").WithParams(fos.path)
+	}
+	return nil
+}
+
+// Close releases the resources associated with the store.
+func (fos *FileOperationStore) Close() derrors.Error {
+	fos.Lock()
+	defer fos.Unlock()
+	if fos.journal == nil {
+		return nil
+	}
+	err := fos.journal.Close()
+	fos.journal = nil
+	if err != nil {
+		return derrors.AsError(err, "cannot close operation journal")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+)
+
+func newTestRecord(progress entities.TaskProgress) entities.OperationRecord {
+	requestID := uuid.NewV4().String()
+	return entities.OperationRecord{
+		RequestID:      requestID,
+		OrganizationID: "org",
+		ClusterID:      "cluster",
+		Type:           entities.Provision,
+		Progress:       progress,
+		Log:            []entities.LogEntry{entities.NewLogEntry(entities.InfoLevel, "step", "first entry")},
+		Result: entities.OperationResult{
+			RequestId: requestID,
+			Type:      entities.Provision,
+			Progress:  progress,
+		},
+	}
+}
+
+func logMessages(entries []entities.LogEntry) []string {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Message)
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("File operation store", func() {
+
+	var tempDir string
+	var journalPath string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "store")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+		journalPath = filepath.Join(tempDir, "operations.journal")
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	ginkgo.It("should recover the records after reopening the journal", func() {
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		inProgress := newTestRecord(entities.InProgress)
+		finished := newTestRecord(entities.Finished)
+		removed := newTestRecord(entities.Error)
+		gomega.Expect(fos.Save(inProgress)).To(gomega.BeNil())
+		gomega.Expect(fos.Save(finished)).To(gomega.BeNil())
+		gomega.Expect(fos.Save(removed)).To(gomega.BeNil())
+		inProgress.Log = append(inProgress.Log, entities.NewLogEntry(entities.WarningLevel, "", "second entry"))
+		gomega.Expect(fos.Save(inProgress)).To(gomega.BeNil())
+		gomega.Expect(fos.Remove(removed.RequestID)).To(gomega.BeNil())
+		gomega.Expect(fos.Close()).To(gomega.BeNil())
+
+		reopened, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		records, err := reopened.List()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(len(records)).To(gomega.Equal(2))
+		retrieved, err := reopened.Get(inProgress.RequestID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logMessages(retrieved.Log)).To(gomega.Equal([]string{"first entry", "second entry"}))
+		gomega.Expect(retrieved.Log[0].Step).To(gomega.Equal("step"))
+		gomega.Expect(retrieved.Log[1].Level).To(gomega.Equal(entities.WarningLevel))
+		gomega.Expect(retrieved.Log[0].Timestamp.Unix()).To(gomega.Equal(inProgress.Log[0].Timestamp.Unix()))
+		gomega.Expect(retrieved.Progress).To(gomega.Equal(entities.InProgress))
+		_, err = reopened.Get(removed.RequestID)
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should skip partially written entries", func() {
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		record := newTestRecord(entities.Finished)
+		gomega.Expect(fos.Save(record)).To(gomega.BeNil())
+		gomega.Expect(fos.Close()).To(gomega.BeNil())
+
+		file, fErr := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0600)
+		gomega.Expect(fErr).To(gomega.Succeed())
+		_, fErr = file.WriteString("{\"action\":\"save\",\"request_id\":\"trunc")
+		gomega.Expect(fErr).To(gomega.Succeed())
+		gomega.Expect(file.Close()).To(gomega.Succeed())
+
+		reopened, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		records, err := reopened.List()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(len(records)).To(gomega.Equal(1))
+		gomega.Expect(records[0].RequestID).To(gomega.Equal(record.RequestID))
+	})
+
+	ginkgo.It("should load the plain log entries of previous versions", func() {
+		legacy := "{\"action\":\"save\",\"request_id\":\"legacy\",\"record\":{\"request_id\":\"legacy\",\"progress\":4,\"log\":[\"old entry\"]}}\n"
+		gomega.Expect(ioutil.WriteFile(journalPath, []byte(legacy), 0600)).To(gomega.Succeed())
+
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer fos.Close()
+		retrieved, err := fos.Get("legacy")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logMessages(retrieved.Log)).To(gomega.Equal([]string{"old entry"}))
+		gomega.Expect(retrieved.Log[0].Level).To(gomega.Equal(entities.InfoLevel))
+	})
+
+	ginkgo.It("should not write the kubeconfig files or the secrets to the journal", func() {
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		kubeConfig := "apiVersion: v1\nusers:\n- name: admin\n  user:\n    token: kubeconfig-token-value\n"
+		record := newTestRecord(entities.Error)
+		record.Result.ProvisionResult = &entities.ProvisionResult{ClusterName: "cluster", RawKubeConfig: kubeConfig}
+		record.Result.KubeConfigResult = &kubeConfig
+		record.Checkpoint = &entities.StepCheckpoint{
+			Completed: []string{"retrieve-kubeconfig"},
+			Failed:    "create-dns-entries",
+			Outputs:   map[string]string{"kubeConfig": kubeConfig, "adminPassword": "password-value", "dnsZone": "zone"},
+		}
+		gomega.Expect(fos.Save(record)).To(gomega.BeNil())
+		gomega.Expect(fos.Close()).To(gomega.BeNil())
+		// The record of the caller is not modified.
+		gomega.Expect(record.Result.ProvisionResult.RawKubeConfig).To(gomega.Equal(kubeConfig))
+		gomega.Expect(record.Checkpoint.Outputs).To(gomega.HaveKey("kubeConfig"))
+
+		content, rErr := ioutil.ReadFile(journalPath)
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(string(content)).To(gomega.ContainSubstring("zone"))
+		gomega.Expect(string(content)).NotTo(gomega.ContainSubstring("kubeconfig-token-value"))
+		gomega.Expect(string(content)).NotTo(gomega.ContainSubstring("password-value"))
+
+		reopened, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		retrieved, err := reopened.Get(record.RequestID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(retrieved.Result.ProvisionResult.ClusterName).To(gomega.Equal("cluster"))
+		gomega.Expect(retrieved.Result.ProvisionResult.RawKubeConfig).To(gomega.BeEmpty())
+		gomega.Expect(retrieved.Result.KubeConfigResult).To(gomega.BeNil())
+		gomega.Expect(retrieved.Checkpoint.Outputs).To(gomega.Equal(map[string]string{"dnsZone": "zone"}))
+	})
+
+	ginkgo.It("should compact the journal while it is open", func() {
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		fos.SetMinCompactionSize(4 * 1024)
+		record := newTestRecord(entities.InProgress)
+		for index := 0; index < 200; index++ {
+			record.Log = []entities.LogEntry{entities.NewLogEntry(entities.InfoLevel, "step", fmt.Sprintf("checkpoint %d", index))}
+			gomega.Expect(fos.Save(record)).To(gomega.BeNil())
+		}
+		info, sErr := os.Stat(journalPath)
+		gomega.Expect(sErr).To(gomega.Succeed())
+		gomega.Expect(info.Size()).To(gomega.BeNumerically("<", 8*1024))
+		gomega.Expect(fos.Check()).To(gomega.BeNil())
+		gomega.Expect(fos.Close()).To(gomega.BeNil())
+
+		reopened, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		retrieved, err := reopened.Get(record.RequestID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logMessages(retrieved.Log)).To(gomega.Equal([]string{"checkpoint 199"}))
+	})
+
+	ginkgo.It("should report the journal as unavailable once removed or closed", func() {
+		fos, err := NewFileOperationStore(journalPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(fos.Check()).To(gomega.BeNil())
+		gomega.Expect(os.Remove(journalPath)).To(gomega.Succeed())
+		gomega.Expect(fos.Check()).NotTo(gomega.BeNil())
+		gomega.Expect(fos.Close()).To(gomega.BeNil())
+		gomega.Expect(fos.Check()).NotTo(gomega.BeNil())
+	})
+})
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// MemoryOperationStore with a volatile implementation of the operation store.
+type MemoryOperationStore struct {
+	sync.Mutex
+	records map[string]entities.OperationRecord
+}
+
+// NewMemoryOperationStore creates an empty in-memory store.
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{
+		records: make(map[string]entities.OperationRecord, 0),
+	}
+}
+
+// Save creates or updates the record of an operation.
+func (mos *MemoryOperationStore) Save(record entities.OperationRecord) derrors.Error {
+	mos.Lock()
+	defer mos.Unlock()
+	mos.save(record)
+	return nil
+}
+
+// save stores a record maintaining its creation timestamp. The caller is expected to hold the lock.
+func (mos *MemoryOperationStore) save(record entities.OperationRecord) {
+	previous, exists := mos.records[record.RequestID]
+	if exists && previous.Created != 0 {
+		record.Created = previous.Created
+	}
+	mos.records[record.RequestID] = record
+}
+
+// Get retrieves the record of an operation.
+func (mos *MemoryOperationStore) Get(requestID string) (*entities.OperationRecord, derrors.Error) {
+	mos.Lock()
+	defer mos.Unlock()
+	record, exists := mos.records[requestID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("operation record not found").WithParams(requestID)
+	}
+	return &record, nil
+}
+
+// List retrieves all the stored records sorted by creation time.
+func (mos *MemoryOperationStore) List() ([]entities.OperationRecord, derrors.Error) {
+	mos.Lock()
+	defer mos.Unlock()
+	result := make([]entities.OperationRecord, 0, len(mos.records))
+	for _, record := range mos.records {
+		result = append(result, record)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+	return result, nil
+}
+
+// Remove deletes the record of an operation.
+func (mos *MemoryOperationStore) Remove(requestID string) derrors.Error {
+	mos.Lock()
+	defer mos.Unlock()
+	_, exists := mos.records[requestID]
+	if !exists {
+		return derrors.NewNotFoundError("operation record not found").WithParams(requestID)
+	}
+	delete(mos.records, requestID)
+	return nil
+}
+
+// Close releases the resources associated with the store.
+func (mos *MemoryOperationStore) Close() derrors.Error {
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// OperationStore interface defining the operations required to persist the state of the infrastructure
+// operations so that it survives restarts of the provisioner.
+type OperationStore interface {
+	// Save creates or updates the record of an operation.
+	Save(record entities.OperationRecord) derrors.Error
+	// Get retrieves the record of an operation.
+	Get(requestID string) (*entities.OperationRecord, derrors.Error)
+	// List retrieves all the stored records.
+	List() ([]entities.OperationRecord, derrors.Error)
+	// Remove deletes the record of an operation.
+	Remove(requestID string) derrors.Error
+	// Close releases the resources associated with the store.
+	Close() derrors.Error
+}
+
+// HealthChecker is implemented by the stores that depend on resources that may become unavailable while the
+// provisioner is running.
+type HealthChecker interface {
+	// Check verifies that the store can persist the operations.
+	Check() derrors.Error
+}
+
+// NewOperationStore creates the store for a given path. If no path is provided, the state of the operations
+// is only kept in memory.
+func NewOperationStore(path string) (OperationStore, derrors.Error) {
+	if path == "" {
+		return NewMemoryOperationStore(), nil
+	}
+	return NewFileOperationStore(path)
+}
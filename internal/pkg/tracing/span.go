@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName with the name of the instrumentation library.
+const TracerName = "github.com/nalej/provisioner"
+
+const (
+	// RequestIDKey with the request identifier of the operation.
+	RequestIDKey = attribute.Key("provisioner.request_id")
+	// OrganizationIDKey with the organization of the operation.
+	OrganizationIDKey = attribute.Key("provisioner.organization_id")
+	// ClusterIDKey with the cluster target of the operation.
+	ClusterIDKey = attribute.Key("provisioner.cluster_id")
+	// OperationTypeKey with the type of operation.
+	OperationTypeKey = attribute.Key("provisioner.operation_type")
+	// StepKey with the name of the step of the operation.
+	StepKey = attribute.Key("provisioner.step")
+	// ProgressKey with the final progress of the operation.
+	ProgressKey = attribute.Key("provisioner.progress")
+)
+
+// StartSpan starts a span as a child of the span found in the context, if any.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// OperationAttributes returns the attributes that identify an operation.
+func OperationAttributes(operation entities.InfrastructureOperation) []attribute.KeyValue {
+	metadata := operation.Metadata()
+	return []attribute.KeyValue{
+		RequestIDKey.String(operation.RequestID()),
+		OrganizationIDKey.String(metadata.OrganizationID),
+		ClusterIDKey.String(metadata.ClusterID),
+		OperationTypeKey.String(entities.ToOperationTypeString[operation.Result().Type]),
+	}
+}
+
+// RequestAttributes returns the attributes that identify the target of a request.
+func RequestAttributes(requestID string, organizationID string, clusterID string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		RequestIDKey.String(requestID),
+		OrganizationIDKey.String(organizationID),
+		ClusterIDKey.String(clusterID),
+	}
+}
+
+// Fail records an error on a span marking it as failed. The error is returned so that it can be used on return
+// statements.
+func Fail(span trace.Span, err derrors.Error) derrors.Error {
+	if err != nil {
+		Record(span, err)
+	}
+	return err
+}
+
+// Record marks a span as failed if an error is found.
+func Record(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Trace executes a function inside a span, recording the error it returns.
+func Trace(ctx context.Context, name string, call func(ctx context.Context) derrors.Error) derrors.Error {
+	ctx, span := StartSpan(ctx, name)
+	defer span.End()
+	return Fail(span, call(ctx))
+}
+
+// Detach returns a context that is not cancelled with the parent but keeps its span, so that the work started by
+// a request can be traced after the request is answered.
+func Detach(parent context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(parent))
+}
+
+// EndOperationSpan ends the span of an operation recording its final progress.
+func EndOperationSpan(span trace.Span, operation entities.InfrastructureOperation) {
+	progress := operation.Progress()
+	span.SetAttributes(ProgressKey.String(entities.TaskProgressToString[progress]))
+	if progress == entities.Error {
+		span.SetStatus(codes.Error, operation.Result().ErrorMsg)
+	}
+	span.End()
+}
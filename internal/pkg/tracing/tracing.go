@@ -0,0 +1,121 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing configures the OpenTelemetry traces of the provisioner operations.
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// ServiceName with the name of the service reported on the traces.
+const ServiceName = "provisioner"
+
+const (
+	// NoExporter disables the export of the traces.
+	NoExporter = "none"
+	// StdoutExporter writes the traces to the standard output.
+	StdoutExporter = "stdout"
+	// JaegerExporter sends the traces to the HTTP endpoint of a Jaeger collector.
+	JaegerExporter = "jaeger"
+)
+
+// Exporters with the names of the exporters that can be configured.
+var Exporters = []string{NoExporter, StdoutExporter, JaegerExporter}
+
+// ValidExporter checks if an exporter name is supported.
+func ValidExporter(name string) bool {
+	for _, exporter := range Exporters {
+		if strings.EqualFold(exporter, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider with the tracer provider configured for the process.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+// Setup configures the process wide tracer provider with the given exporter. The endpoint is only used by the
+// exporters that send the traces to a remote collector. The sampleRatio determines the fraction of the traces
+// that are recorded; traces started by a sampled remote parent are always recorded.
+func Setup(exporterName string, endpoint string, sampleRatio float64) (*Provider, derrors.Error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(exporterName) {
+	case "", NoExporter:
+		return &Provider{}, nil
+	case StdoutExporter:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case JaegerExporter:
+		if endpoint == "" {
+			return nil, derrors.NewInvalidArgumentError("jaeger exporter requires an endpoint")
+		}
+		exporter, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)))
+	default:
+		return nil, derrors.NewInvalidArgumentError("unsupported trace exporter").WithParams(exporterName)
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create trace exporter")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	install(provider)
+	return &Provider{provider: provider}, nil
+}
+
+// UseInMemoryExporter configures the process wide tracer provider to record all the spans in memory. The
+// spans are exported as soon as they end, so this exporter is intended for tests.
+func UseInMemoryExporter() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+}
+
+// install sets the tracer provider and the propagation of the trace context used by the process.
+func install(provider *sdktrace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Shutdown exports the pending spans and releases the exporter.
+func (p *Provider) Shutdown(ctx context.Context) derrors.Error {
+	if p.provider == nil {
+		return nil
+	}
+	err := p.provider.Shutdown(ctx)
+	if err != nil {
+		return derrors.AsError(err, "cannot shutdown tracer provider")
+	}
+	return nil
+}
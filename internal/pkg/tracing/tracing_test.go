@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var _ = ginkgo.Describe("Tracing", func() {
+
+	var exporter *tracetest.InMemoryExporter
+
+	ginkgo.BeforeEach(func() {
+		exporter = UseInMemoryExporter()
+	})
+
+	ginkgo.It("should record nested spans", func() {
+		ctx, parent := StartSpan(context.Background(), "parent", RequestIDKey.String("req-1"))
+		err := Trace(ctx, "child", func(ctx context.Context) derrors.Error {
+			return nil
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		parent.End()
+
+		spans := exporter.GetSpans()
+		gomega.Expect(spans).Should(gomega.HaveLen(2))
+		gomega.Expect(spans[0].Name).Should(gomega.Equal("child"))
+		gomega.Expect(spans[1].Name).Should(gomega.Equal("parent"))
+		gomega.Expect(spans[0].Parent.SpanID()).Should(gomega.Equal(spans[1].SpanContext.SpanID()))
+		gomega.Expect(spans[1].Attributes).Should(gomega.ContainElement(RequestIDKey.String("req-1")))
+	})
+
+	ginkgo.It("should mark failed spans", func() {
+		err := Trace(context.Background(), "failing", func(ctx context.Context) derrors.Error {
+			return derrors.NewInternalError("cannot create cluster")
+		})
+		gomega.Expect(err).To(gomega.HaveOccurred())
+
+		spans := exporter.GetSpans()
+		gomega.Expect(spans).Should(gomega.HaveLen(1))
+		gomega.Expect(spans[0].Status.Code).Should(gomega.Equal(codes.Error))
+		gomega.Expect(spans[0].Status.Description).Should(gomega.Equal(err.Error()))
+		gomega.Expect(spans[0].Events).Should(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should keep the span of a detached context", func() {
+		ctx, span := StartSpan(context.Background(), "request")
+		requestCtx, cancel := context.WithCancel(ctx)
+		detached := Detach(requestCtx)
+		cancel()
+		span.End()
+
+		gomega.Expect(detached.Err()).To(gomega.Succeed())
+		gomega.Expect(trace.SpanContextFromContext(detached).SpanID()).Should(gomega.Equal(span.SpanContext().SpanID()))
+	})
+
+	ginkgo.It("should continue the trace of the caller", func() {
+		ctx, client := StartSpan(context.Background(), "client")
+		outgoing, _ := metadata.FromOutgoingContext(Inject(ctx))
+		incoming := metadata.NewIncomingContext(context.Background(), outgoing)
+
+		interceptor := UnaryServerInterceptor()
+		_, err := interceptor(incoming, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, server := StartSpan(ctx, "server")
+			server.End()
+			return nil, nil
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		client.End()
+
+		spans := exporter.GetSpans()
+		gomega.Expect(spans).Should(gomega.HaveLen(2))
+		gomega.Expect(spans[0].Name).Should(gomega.Equal("server"))
+		gomega.Expect(spans[0].SpanContext.TraceID()).Should(gomega.Equal(client.SpanContext().TraceID()))
+		gomega.Expect(spans[0].Parent.SpanID()).Should(gomega.Equal(client.SpanContext().SpanID()))
+	})
+
+	ginkgo.It("should reject unsupported exporters", func() {
+		_, err := Setup("unknown", "", 1)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		_, err = Setup(JaegerExporter, "", 1)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		provider, err := Setup(NoExporter, "", 1)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(provider.Shutdown(context.Background())).To(gomega.Succeed())
+	})
+
+})
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-common-go"
+	"google.golang.org/grpc"
+)
+
+// WatchOperationStream with the name of the server streaming method that watches an operation.
+const WatchOperationStream = "WatchOperation"
+
+// Server is the server API of the services that watch operations.
+type Server interface {
+	// WatchOperation streams the log entries and progress changes of an operation until it finishes.
+	WatchOperation(requestID *grpc_common_go.RequestId, stream Stream) error
+}
+
+// StreamDesc returns the description of the WatchOperation method for the gRPC services whose handlers implement
+// Server.
+func StreamDesc() grpc.StreamDesc {
+	return grpc.StreamDesc{
+		StreamName:    WatchOperationStream,
+		Handler:       watchOperationHandler,
+		ServerStreams: true,
+	}
+}
+
+func watchOperationHandler(srv interface{}, stream grpc.ServerStream) error {
+	requestID := &grpc_common_go.RequestId{}
+	if err := stream.RecvMsg(requestID); err != nil {
+		return err
+	}
+	return srv.(Server).WatchOperation(requestID, &serverStream{stream})
+}
+
+// serverStream sends the events of a watch through a gRPC server stream.
+type serverStream struct {
+	grpc.ServerStream
+}
+
+// Send an event to the watcher.
+func (ss *serverStream) Send(event *Event) error {
+	return ss.ServerStream.SendMsg(event)
+}
+
+// ClientStream receives the events of a watch from a gRPC client stream.
+type ClientStream struct {
+	grpc.ClientStream
+}
+
+// NewClientStream starts watching an operation through a WatchOperation method. The options must select the codec
+// of the service.
+func NewClientStream(ctx context.Context, conn *grpc.ClientConn, fullMethod string, requestID *grpc_common_go.RequestId, opts ...grpc.CallOption) (*ClientStream, error) {
+	desc := StreamDesc()
+	stream, err := conn.NewStream(ctx, &desc, fullMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(requestID); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &ClientStream{stream}, nil
+}
+
+// Recv receives the next event of the operation. It returns io.EOF once the operation reaches a terminal state.
+func (cs *ClientStream) Recv() (*Event, error) {
+	event := &Event{}
+	if err := cs.ClientStream.RecvMsg(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
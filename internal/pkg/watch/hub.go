@@ -0,0 +1,198 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// SubscriptionBufferSize with the number of events that can be pending on a subscription. Events published on
+// a full subscription are dropped, watchers recover them from the operation log.
+const SubscriptionBufferSize = 256
+
+// EventType with the type of change notified to the watchers.
+type EventType int
+
+const (
+	// LogEvent is sent when a new entry is added to the operation log.
+	LogEvent EventType = iota + 1
+	// ProgressEvent is sent when the progress of the operation changes.
+	ProgressEvent
+)
+
+// EventTypeToString map translating event types to their string representation.
+var EventTypeToString = map[EventType]string{
+	LogEvent:      "Log",
+	ProgressEvent: "Progress",
+}
+
+// Event with a change on an operation.
+type Event struct {
+	// RequestID of the operation.
+	RequestID string `json:"request_id"`
+	// Type of event.
+	Type EventType `json:"type"`
+	// LogIndex with the position of the entry in the operation log for log events.
+	LogIndex int `json:"log_index,omitempty"`
+	// LogEntry with the new entry for log events.
+	LogEntry *entities.LogEntry `json:"log_entry,omitempty"`
+	// Progress with the new progress for progress events.
+	Progress entities.TaskProgress `json:"progress,omitempty"`
+	// Timestamp when the event was produced.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Subscription to the events of an operation.
+type Subscription struct {
+	id        int64
+	requestID string
+	events    chan Event
+}
+
+// Events returns the channel where the events are received. The channel is closed when the operation reaches
+// a terminal state or the subscription is cancelled.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Listener receives the events of all the operations. Listeners are called synchronously when the event is
+// published so they must return quickly and must not use the hub.
+type Listener func(event Event)
+
+// Hub dispatches the events of the operations to their subscribers.
+type Hub struct {
+	sync.Mutex
+	nextID int64
+	// subscriptions per request identifier.
+	subscriptions map[string]map[int64]*Subscription
+	// listeners receiving the events of all the operations.
+	listeners []Listener
+}
+
+// NewHub creates a new hub without subscriptions.
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[string]map[int64]*Subscription, 0),
+	}
+}
+
+var hubInstance *Hub
+var hubOnce sync.Once
+
+// GetHub returns the hub shared by all the operations of the process.
+func GetHub() *Hub {
+	hubOnce.Do(func() {
+		hubInstance = NewHub()
+	})
+	return hubInstance
+}
+
+// Subscribe creates a subscription to the events of an operation.
+func (h *Hub) Subscribe(requestID string) *Subscription {
+	h.Lock()
+	defer h.Unlock()
+	h.nextID++
+	subscription := &Subscription{
+		id:        h.nextID,
+		requestID: requestID,
+		events:    make(chan Event, SubscriptionBufferSize),
+	}
+	subscribers, exists := h.subscriptions[requestID]
+	if !exists {
+		subscribers = make(map[int64]*Subscription, 0)
+		h.subscriptions[requestID] = subscribers
+	}
+	subscribers[subscription.id] = subscription
+	return subscription
+}
+
+// AddListener registers a listener that receives the events of all the operations.
+func (h *Hub) AddListener(listener Listener) {
+	h.Lock()
+	defer h.Unlock()
+	h.listeners = append(h.listeners, listener)
+}
+
+// Unsubscribe cancels a subscription. Cancelling a subscription that has been already closed has no effect.
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.Lock()
+	defer h.Unlock()
+	subscribers, exists := h.subscriptions[subscription.requestID]
+	if !exists {
+		return
+	}
+	if _, exists := subscribers[subscription.id]; !exists {
+		return
+	}
+	delete(subscribers, subscription.id)
+	close(subscription.events)
+	if len(subscribers) == 0 {
+		delete(h.subscriptions, subscription.requestID)
+	}
+}
+
+// PublishLog notifies a new entry of the log of an operation.
+func (h *Hub) PublishLog(requestID string, index int, entry entities.LogEntry) {
+	h.Publish(Event{
+		RequestID: requestID,
+		Type:      LogEvent,
+		LogIndex:  index,
+		LogEntry:  &entry,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// PublishProgress notifies a change in the progress of an operation.
+func (h *Hub) PublishProgress(requestID string, progress entities.TaskProgress) {
+	h.Publish(Event{
+		RequestID: requestID,
+		Type:      ProgressEvent,
+		Progress:  progress,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// Publish sends an event to the listeners and the subscribers of the operation. Subscriptions are closed once a progress event
+// with a terminal state is published.
+func (h *Hub) Publish(event Event) {
+	h.Lock()
+	defer h.Unlock()
+	for _, listener := range h.listeners {
+		listener(event)
+	}
+	subscribers, exists := h.subscriptions[event.RequestID]
+	if !exists {
+		return
+	}
+	for _, subscription := range subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			log.Warn().Str("requestID", event.RequestID).Str("type", EventTypeToString[event.Type]).Msg("subscription is full, dropping event")
+		}
+	}
+	if event.Type == ProgressEvent && event.Progress.IsTerminal() {
+		for _, subscription := range subscribers {
+			close(subscription.events)
+		}
+		delete(h.subscriptions, event.RequestID)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// testOperation publishes its changes on a hub as the infrastructure operations do.
+type testOperation struct {
+	sync.Mutex
+	hub      *Hub
+	log      []entities.LogEntry
+	progress entities.TaskProgress
+}
+
+func (to *testOperation) RequestID() string {
+	return "request"
+}
+
+func (to *testOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{RequestID: to.RequestID()}
+}
+
+func (to *testOperation) Log() []entities.LogEntry {
+	to.Lock()
+	defer to.Unlock()
+	return append([]entities.LogEntry{}, to.log...)
+}
+
+func (to *testOperation) AddToLog(entry string) {
+	to.Lock()
+	defer to.Unlock()
+	logEntry := entities.NewLogEntry(entities.InfoLevel, "", entry)
+	to.log = append(to.log, logEntry)
+	to.hub.PublishLog(to.RequestID(), len(to.log)-1, logEntry)
+}
+
+func (to *testOperation) Progress() entities.TaskProgress {
+	to.Lock()
+	defer to.Unlock()
+	return to.progress
+}
+
+func (to *testOperation) SetProgress(progress entities.TaskProgress) {
+	to.Lock()
+	defer to.Unlock()
+	to.progress = progress
+	to.hub.PublishProgress(to.RequestID(), progress)
+}
+
+func (to *testOperation) Execute(_ context.Context, callback func(requestID string)) {
+	callback(to.RequestID())
+}
+
+func (to *testOperation) Cancel() derrors.Error {
+	return nil
+}
+
+func (to *testOperation) Result() entities.OperationResult {
+	return entities.OperationResult{RequestId: to.RequestID(), Progress: to.Progress()}
+}
+
+// testStream collects the events sent to a watcher.
+type testStream struct {
+	sync.Mutex
+	ctx    context.Context
+	events []Event
+}
+
+func (ts *testStream) Send(event *Event) error {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.events = append(ts.events, *event)
+	return nil
+}
+
+func (ts *testStream) Context() context.Context {
+	return ts.ctx
+}
+
+func (ts *testStream) received() []Event {
+	ts.Lock()
+	defer ts.Unlock()
+	return append([]Event{}, ts.events...)
+}
+
+var _ = ginkgo.Describe("Hub", func() {
+
+	var hub *Hub
+
+	ginkgo.BeforeEach(func() {
+		hub = NewHub()
+	})
+
+	ginkgo.It("should send the events to all the subscribers", func() {
+		first := hub.Subscribe("request")
+		second := hub.Subscribe("request")
+		other := hub.Subscribe("other")
+		hub.PublishLog("request", 0, entities.NewLogEntry(entities.InfoLevel, "step", "entry"))
+		for _, subscription := range []*Subscription{first, second} {
+			event := <-subscription.Events()
+			gomega.Expect(event.Type).To(gomega.Equal(LogEvent))
+			gomega.Expect(event.LogEntry.Message).To(gomega.Equal("entry"))
+			gomega.Expect(event.LogEntry.Step).To(gomega.Equal("step"))
+		}
+		gomega.Expect(len(other.Events())).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should close the subscriptions when the operation finishes", func() {
+		subscription := hub.Subscribe("request")
+		hub.PublishProgress("request", entities.InProgress)
+		hub.PublishProgress("request", entities.Finished)
+		progress := make([]entities.TaskProgress, 0)
+		for event := range subscription.Events() {
+			progress = append(progress, event.Progress)
+		}
+		gomega.Expect(progress).To(gomega.Equal([]entities.TaskProgress{entities.InProgress, entities.Finished}))
+		// Unsubscribing a closed subscription has no effect.
+		hub.Unsubscribe(subscription)
+	})
+
+	ginkgo.It("should drop events instead of blocking on full subscriptions", func() {
+		subscription := hub.Subscribe("request")
+		for index := 0; index < SubscriptionBufferSize+10; index++ {
+			hub.PublishLog("request", index, entities.NewLogEntry(entities.InfoLevel, "", "entry"))
+		}
+		gomega.Expect(len(subscription.Events())).To(gomega.Equal(SubscriptionBufferSize))
+		hub.Unsubscribe(subscription)
+	})
+})
+
+var _ = ginkgo.Describe("Serve", func() {
+
+	var hub *Hub
+	var operation *testOperation
+
+	ginkgo.BeforeEach(func() {
+		hub = NewHub()
+		operation = &testOperation{hub: hub, log: make([]entities.LogEntry, 0), progress: entities.Init}
+	})
+
+	ginkgo.It("should send the previous entries and the live changes", func() {
+		operation.AddToLog("previous")
+		stream := &testStream{ctx: context.Background()}
+		done := make(chan derrors.Error, 1)
+		go func() {
+			done <- Serve(hub, operation, stream)
+		}()
+		// Wait for the snapshot to be sent before producing new changes.
+		gomega.Eventually(func() int { return len(stream.received()) }).Should(gomega.Equal(2))
+		operation.SetProgress(entities.InProgress)
+		operation.AddToLog("live")
+		operation.SetProgress(entities.Error)
+		gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+
+		events := stream.received()
+		gomega.Expect(len(events)).To(gomega.Equal(5))
+		gomega.Expect(events[0].LogEntry.Message).To(gomega.Equal("previous"))
+		gomega.Expect(events[1].Progress).To(gomega.Equal(entities.Init))
+		gomega.Expect(events[2].Progress).To(gomega.Equal(entities.InProgress))
+		gomega.Expect(events[3].LogEntry.Message).To(gomega.Equal("live"))
+		gomega.Expect(events[3].LogIndex).To(gomega.Equal(1))
+		gomega.Expect(events[4].Progress).To(gomega.Equal(entities.Error))
+	})
+
+	ginkgo.It("should finish immediately on finished operations", func() {
+		operation.AddToLog("entry")
+		operation.SetProgress(entities.Finished)
+		stream := &testStream{ctx: context.Background()}
+		gomega.Expect(Serve(hub, operation, stream)).To(gomega.BeNil())
+		gomega.Expect(len(stream.received())).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should stop when the watcher leaves", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := &testStream{ctx: ctx}
+		done := make(chan derrors.Error, 1)
+		go func() {
+			done <- Serve(hub, operation, stream)
+		}()
+		cancel()
+		gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+	})
+})
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Stream is the server side of a watch. It contains the methods of a gRPC server stream used to send the events.
+type Stream interface {
+	// Send an event to the watcher.
+	Send(event *Event) error
+	// Context of the stream that is cancelled when the watcher leaves.
+	Context() context.Context
+}
+
+// watcher keeps track of the events already sent to a stream.
+type watcher struct {
+	operation    entities.InfrastructureOperation
+	stream       Stream
+	sentLog      int
+	lastProgress entities.TaskProgress
+	sentProgress bool
+}
+
+// Serve sends the changes of an operation to a stream until the operation reaches a terminal state or the stream
+// is closed. The log entries already produced by the operation and its current progress are sent first.
+func Serve(hub *Hub, operation entities.InfrastructureOperation, stream Stream) derrors.Error {
+	subscription := hub.Subscribe(operation.RequestID())
+	defer hub.Unsubscribe(subscription)
+	w := &watcher{operation: operation, stream: stream}
+	err := w.sync()
+	if err != nil {
+		return err
+	}
+	if w.lastProgress.IsTerminal() {
+		return nil
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// Send the entries added after the operation reached a terminal state.
+				return w.sync()
+			}
+			err = w.process(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// process sends an event to the stream skipping the ones already sent.
+func (w *watcher) process(event Event) derrors.Error {
+	switch event.Type {
+	case LogEvent:
+		if event.LogIndex < w.sentLog {
+			return nil
+		}
+		if event.LogIndex > w.sentLog {
+			// Some events have been dropped, recover them from the operation log.
+			return w.sync()
+		}
+		w.sentLog++
+		return w.send(event)
+	case ProgressEvent:
+		return w.sendProgress(event.Progress)
+	}
+	return nil
+}
+
+// sync sends the log entries and the progress of the operation that have not been sent yet.
+func (w *watcher) sync() derrors.Error {
+	entries := w.operation.Log()
+	for ; w.sentLog < len(entries); w.sentLog++ {
+		entry := entries[w.sentLog]
+		err := w.send(Event{
+			RequestID: w.operation.RequestID(),
+			Type:      LogEvent,
+			LogIndex:  w.sentLog,
+			LogEntry:  &entry,
+			Timestamp: time.Now().Unix(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.sendProgress(w.operation.Progress())
+}
+
+// sendProgress sends a progress event if the progress has changed.
+func (w *watcher) sendProgress(progress entities.TaskProgress) derrors.Error {
+	if w.sentProgress && progress == w.lastProgress {
+		return nil
+	}
+	w.lastProgress = progress
+	w.sentProgress = true
+	return w.send(Event{
+		RequestID: w.operation.RequestID(),
+		Type:      ProgressEvent,
+		Progress:  progress,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+func (w *watcher) send(event Event) derrors.Error {
+	err := w.stream.Send(&event)
+	if err != nil {
+		return derrors.AsError(err, "cannot send event to watcher")
+	}
+	return nil
+}
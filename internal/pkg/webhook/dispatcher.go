@@ -0,0 +1,404 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultMaxAttempts with the default number of attempts to deliver a notification.
+const DefaultMaxAttempts = 10
+
+// DefaultInitialBackoff with the default time to wait before retrying a failed delivery. The time is doubled
+// on each failed attempt.
+const DefaultInitialBackoff = time.Second
+
+// DefaultMaxBackoff with the default maximum time to wait between attempts.
+const DefaultMaxBackoff = 5 * time.Minute
+
+// DefaultRequestTimeout with the default timeout of each delivery attempt.
+const DefaultRequestTimeout = 10 * time.Second
+
+// DefaultRetention with the default time completed deliveries are kept in the delivery log.
+const DefaultRetention = 7 * 24 * time.Hour
+
+var dispatcherInstance *Dispatcher
+var onceDispatcher sync.Once
+
+// Dispatcher notifies the result of the operations to the registered webhooks. It is attached to the executor
+// as an observer and delivers the notifications in the background, retrying failed deliveries with an
+// exponential backoff.
+type Dispatcher struct {
+	sync.Mutex
+	store  DeliveryStore
+	client *http.Client
+	// callerClient with the client used to deliver the notifications to the webhooks registered by the callers.
+	callerClient *http.Client
+	policy       *URLPolicy
+	secret       []byte
+	// urls with the webhooks notified of every operation.
+	urls []string
+	// subscriptions with the webhooks registered per request identifier.
+	subscriptions  map[string][]string
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// inFlight with the identifiers of the deliveries being processed.
+	inFlight map[string]bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher with an in-memory delivery log and no webhooks.
+func NewDispatcher() *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy, _ := NewURLPolicy(nil)
+	return &Dispatcher{
+		store:          NewMemoryDeliveryStore(),
+		client:         &http.Client{Timeout: DefaultRequestTimeout},
+		callerClient:   policy.client(DefaultRequestTimeout),
+		policy:         policy,
+		urls:           make([]string, 0),
+		subscriptions:  make(map[string][]string, 0),
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		inFlight:       make(map[string]bool, 0),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// GetDispatcher returns the dispatcher shared by the managers.
+func GetDispatcher() *Dispatcher {
+	onceDispatcher.Do(func() {
+		dispatcherInstance = NewDispatcher()
+	})
+	return dispatcherInstance
+}
+
+// Configure sets the webhooks notified of every operation, the secret used to sign the notifications and the
+// maximum number of attempts of each delivery. If the secret is empty, the notifications are not signed.
+func (d *Dispatcher) Configure(urls []string, secret string, maxAttempts int) {
+	d.Lock()
+	defer d.Unlock()
+	d.urls = append(make([]string, 0, len(urls)), urls...)
+	d.secret = []byte(secret)
+	if maxAttempts > 0 {
+		d.maxAttempts = maxAttempts
+	}
+}
+
+// SetURLPolicy sets the policy the webhooks registered by the callers must comply with.
+func (d *Dispatcher) SetURLPolicy(policy *URLPolicy) {
+	d.Lock()
+	defer d.Unlock()
+	d.policy = policy
+	d.callerClient = policy.client(DefaultRequestTimeout)
+}
+
+// URLsFromContext returns the webhooks registered in the metadata of an incoming request. The webhooks are checked
+// against the URLPolicy of the dispatcher.
+func (d *Dispatcher) URLsFromContext(ctx context.Context) ([]string, derrors.Error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	d.Lock()
+	policy := d.policy
+	d.Unlock()
+	return parseURLs(md.Get(URLMetadataKey), policy.Check)
+}
+
+// SetBackoff sets the time to wait after the first failed attempt and the maximum time between attempts.
+func (d *Dispatcher) SetBackoff(initial time.Duration, max time.Duration) {
+	d.Lock()
+	defer d.Unlock()
+	d.initialBackoff = initial
+	d.maxBackoff = max
+}
+
+// UseStore sets the store of the delivery log and resumes the pending deliveries found on it.
+func (d *Dispatcher) UseStore(store DeliveryStore) derrors.Error {
+	deliveries, err := store.List()
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.store = store
+	resumed := 0
+	for _, delivery := range deliveries {
+		if delivery.Status == Pending && !d.inFlight[delivery.ID] {
+			d.start(delivery)
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		log.Info().Int("deliveries", resumed).Msg("resuming pending webhook deliveries")
+	}
+	return nil
+}
+
+// Subscribe registers webhooks to be notified when the operation of a given request finishes.
+func (d *Dispatcher) Subscribe(requestID string, urls []string) {
+	if len(urls) == 0 {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.subscriptions[requestID] = append(d.subscriptions[requestID], urls...)
+}
+
+// Unsubscribe removes the webhooks registered for a given request.
+func (d *Dispatcher) Unsubscribe(requestID string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.subscriptions, requestID)
+}
+
+// Deliveries returns the delivery log of the notifications of a given request.
+func (d *Dispatcher) Deliveries(requestID string) ([]Delivery, derrors.Error) {
+	d.Lock()
+	store := d.store
+	d.Unlock()
+	deliveries, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Delivery, 0)
+	for _, delivery := range deliveries {
+		if delivery.RequestID == requestID {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+// Stop interrupts the ongoing deliveries and waits for them to return. Pending deliveries are resumed the next
+// time the delivery log is loaded.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// OperationScheduled is part of the workflow.Observer interface.
+func (d *Dispatcher) OperationScheduled(operation entities.InfrastructureOperation) {
+}
+
+// OperationStarted is part of the workflow.Observer interface.
+func (d *Dispatcher) OperationStarted(operation entities.InfrastructureOperation) {
+}
+
+// OperationFinished is part of the workflow.Observer interface. Operations that finished or failed are notified
+// to the webhooks, the registrations of the request are removed in any case.
+func (d *Dispatcher) OperationFinished(operation entities.InfrastructureOperation, duration time.Duration) {
+	progress := operation.Progress()
+	if progress == entities.Finished || progress == entities.Error {
+		d.Notify(operation.Result(), operation.Metadata().ClusterID)
+	}
+	d.Unsubscribe(operation.RequestID())
+}
+
+// Notify creates the deliveries of the result of an operation to the webhooks of the dispatcher and those
+// registered for the request.
+func (d *Dispatcher) Notify(result entities.OperationResult, clusterID string) {
+	d.Lock()
+	defer d.Unlock()
+	urls := append(append(make([]string, 0), d.urls...), d.subscriptions[result.RequestId]...)
+	if len(urls) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	payload := NewPayload(result, clusterID, now)
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("requestID", result.RequestId).Msg("cannot serialize webhook payload")
+		return
+	}
+	notified := make(map[string]bool, 0)
+	for _, url := range urls {
+		if notified[url] {
+			continue
+		}
+		notified[url] = true
+		delivery := Delivery{
+			ID:        uuid.NewV4().String(),
+			RequestID: result.RequestId,
+			URL:       url,
+			Event:     payload.Event,
+			Payload:   raw,
+			Status:    Pending,
+			Created:   now,
+			Updated:   now,
+		}
+		d.save(delivery)
+		d.start(delivery)
+	}
+}
+
+// start launches the delivery of a notification. The caller is expected to hold the lock.
+func (d *Dispatcher) start(delivery Delivery) {
+	d.inFlight[delivery.ID] = true
+	d.wg.Add(1)
+	go d.deliver(delivery)
+}
+
+// save persists the state of a delivery. The caller is expected to hold the lock.
+func (d *Dispatcher) save(delivery Delivery) {
+	err := d.store.Save(delivery)
+	if err != nil {
+		log.Error().Str("delivery", delivery.ID).Str("trace", err.DebugReport()).Msg("cannot persist webhook delivery")
+	}
+}
+
+// deliver sends a notification until it is accepted, rejected or the attempts are exhausted.
+func (d *Dispatcher) deliver(delivery Delivery) {
+	defer d.wg.Done()
+	wait := time.Until(time.Unix(delivery.NextAttempt, 0))
+	for {
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-d.ctx.Done():
+				timer.Stop()
+				d.release(delivery.ID)
+				return
+			}
+		}
+		retry, err := d.send(delivery)
+		if d.ctx.Err() != nil {
+			// The attempt was interrupted by the dispatcher being stopped.
+			d.release(delivery.ID)
+			return
+		}
+		d.Lock()
+		delivery.Attempts++
+		delivery.Updated = time.Now().Unix()
+		if err == nil {
+			delivery.Status = Delivered
+			delivery.LastError = ""
+			delivery.NextAttempt = 0
+		} else {
+			delivery.LastError = err.Error()
+			if !retry || delivery.Attempts >= d.maxAttempts {
+				delivery.Status = Failed
+				delivery.NextAttempt = 0
+			} else {
+				wait = d.backoff(delivery.Attempts)
+				delivery.NextAttempt = time.Now().Add(wait).Unix()
+			}
+		}
+		d.save(delivery)
+		if delivery.Status != Pending {
+			delete(d.inFlight, delivery.ID)
+		}
+		d.Unlock()
+		switch delivery.Status {
+		case Delivered:
+			log.Debug().Str("requestID", delivery.RequestID).Str("url", delivery.URL).Int("attempts", delivery.Attempts).Msg("webhook delivered")
+			return
+		case Failed:
+			log.Warn().Str("requestID", delivery.RequestID).Str("url", delivery.URL).Int("attempts", delivery.Attempts).
+				Str("error", delivery.LastError).Msg("webhook delivery failed")
+			return
+		}
+		log.Debug().Str("requestID", delivery.RequestID).Str("url", delivery.URL).Str("error", delivery.LastError).
+			Str("retryIn", wait.String()).Msg("webhook delivery attempt failed")
+	}
+}
+
+// release removes a delivery from the set of deliveries being processed.
+func (d *Dispatcher) release(deliveryID string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.inFlight, deliveryID)
+}
+
+// backoff returns the time to wait after a given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.initialBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
+
+// clientFor returns the client used to deliver the notifications to a webhook. The webhooks not set in the
+// configuration were registered by the callers. The caller is expected to hold the lock.
+func (d *Dispatcher) clientFor(url string) *http.Client {
+	for _, configured := range d.urls {
+		if configured == url {
+			return d.client
+		}
+	}
+	return d.callerClient
+}
+
+// send performs an attempt to deliver a notification. It returns whether a failed attempt may be retried.
+func (d *Dispatcher) send(delivery Delivery) (bool, error) {
+	request, err := http.NewRequestWithContext(d.ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return false, err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	d.Lock()
+	secret := d.secret
+	client := d.clientFor(delivery.URL)
+	d.Unlock()
+	if len(secret) > 0 {
+		request.Header.Set(SignatureHeader, Sign(secret, timestamp, delivery.Payload))
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		var restricted *RestrictedAddressError
+		return !errors.As(err, &restricted), err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+const testSecret = "webhook-secret"
+
+// receivedRequest with the relevant information of a notification received by the test server.
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// testReceiver with a webhook receiver answering with a sequence of status codes.
+type testReceiver struct {
+	sync.Mutex
+	server   *httptest.Server
+	statuses []int
+	received []receivedRequest
+}
+
+func newTestReceiver(statuses ...int) *testReceiver {
+	receiver := &testReceiver{statuses: statuses}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receiver.Lock()
+		defer receiver.Unlock()
+		receiver.received = append(receiver.received, receivedRequest{header: r.Header, body: body})
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status = receiver.statuses[0]
+			receiver.statuses = receiver.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return receiver
+}
+
+func (tr *testReceiver) requests() []receivedRequest {
+	tr.Lock()
+	defer tr.Unlock()
+	return append(make([]receivedRequest, 0), tr.received...)
+}
+
+func newFinishedOperation(progress entities.TaskProgress) *workflow.RestoredOperation {
+	requestID := uuid.NewV4().String()
+	return workflow.NewRestoredOperation(entities.OperationRecord{
+		RequestID:      requestID,
+		OrganizationID: "org",
+		ClusterID:      "cluster",
+		Type:           entities.Provision,
+		Progress:       progress,
+		Result: entities.OperationResult{
+			OrganizationId: "org",
+			RequestId:      requestID,
+			Type:           entities.Provision,
+			Progress:       progress,
+			ErrorMsg:       "",
+			ProvisionResult: &entities.ProvisionResult{
+				ClusterName:   "cluster-name",
+				RawKubeConfig: "secret kubeconfig",
+			},
+		},
+	})
+}
+
+func deliveryStatus(dispatcher *Dispatcher, requestID string) func() []DeliveryStatus {
+	return func() []DeliveryStatus {
+		deliveries, err := dispatcher.Deliveries(requestID)
+		gomega.Expect(err).To(gomega.BeNil())
+		result := make([]DeliveryStatus, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			result = append(result, delivery.Status)
+		}
+		return result
+	}
+}
+
+var _ = ginkgo.Describe("Webhook dispatcher", func() {
+
+	var dispatcher *Dispatcher
+
+	ginkgo.BeforeEach(func() {
+		dispatcher = NewDispatcher()
+		dispatcher.SetBackoff(10*time.Millisecond, 50*time.Millisecond)
+	})
+
+	ginkgo.AfterEach(func() {
+		dispatcher.Stop()
+	})
+
+	ginkgo.It("should post a signed payload when an operation finishes", func() {
+		receiver := newTestReceiver()
+		defer receiver.server.Close()
+		dispatcher.Configure([]string{receiver.server.URL}, testSecret, 3)
+		operation := newFinishedOperation(entities.Finished)
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Delivered}))
+		requests := receiver.requests()
+		gomega.Expect(requests).To(gomega.HaveLen(1))
+		header := requests[0].header
+		timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(Verify([]byte(testSecret), timestamp, requests[0].body, header.Get(SignatureHeader))).To(gomega.BeTrue())
+		gomega.Expect(Verify([]byte("other"), timestamp, requests[0].body, header.Get(SignatureHeader))).To(gomega.BeFalse())
+		gomega.Expect(header.Get(EventHeader)).To(gomega.Equal(FinishedEvent))
+		gomega.Expect(header.Get(DeliveryHeader)).ShouldNot(gomega.BeEmpty())
+
+		payload := Payload{}
+		gomega.Expect(json.Unmarshal(requests[0].body, &payload)).To(gomega.Succeed())
+		gomega.Expect(payload.RequestID).To(gomega.Equal(operation.RequestID()))
+		gomega.Expect(payload.ClusterID).To(gomega.Equal("cluster"))
+		gomega.Expect(payload.Progress).To(gomega.Equal("Finished"))
+		gomega.Expect(payload.ClusterName).To(gomega.Equal("cluster-name"))
+		gomega.Expect(string(requests[0].body)).ShouldNot(gomega.ContainSubstring("secret kubeconfig"))
+	})
+
+	ginkgo.It("should notify the webhooks registered for the request", func() {
+		receiver := newTestReceiver()
+		defer receiver.server.Close()
+		operation := newFinishedOperation(entities.Error)
+		other := newFinishedOperation(entities.Error)
+		policy, err := NewURLPolicy([]string{"127.0.0.1"})
+		gomega.Expect(err).To(gomega.BeNil())
+		dispatcher.SetURLPolicy(policy)
+		dispatcher.Subscribe(operation.RequestID(), []string{receiver.server.URL})
+		dispatcher.OperationFinished(other, time.Minute)
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Delivered}))
+		gomega.Expect(deliveryStatus(dispatcher, other.RequestID())()).To(gomega.BeEmpty())
+		requests := receiver.requests()
+		gomega.Expect(requests).To(gomega.HaveLen(1))
+		gomega.Expect(requests[0].header.Get(EventHeader)).To(gomega.Equal(FailedEvent))
+		gomega.Expect(requests[0].header.Get(SignatureHeader)).To(gomega.BeEmpty())
+		// The registration is removed once the operation is no longer managed.
+		dispatcher.OperationFinished(operation, time.Minute)
+		gomega.Consistently(receiver.requests, 100*time.Millisecond).Should(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should not notify cancelled operations", func() {
+		receiver := newTestReceiver()
+		defer receiver.server.Close()
+		dispatcher.Configure([]string{receiver.server.URL}, testSecret, 3)
+		operation := newFinishedOperation(entities.Cancelled)
+		dispatcher.OperationFinished(operation, 0)
+		gomega.Consistently(receiver.requests, 100*time.Millisecond).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should retry failed deliveries with backoff", func() {
+		receiver := newTestReceiver(http.StatusInternalServerError, http.StatusTooManyRequests)
+		defer receiver.server.Close()
+		dispatcher.Configure([]string{receiver.server.URL}, testSecret, 3)
+		operation := newFinishedOperation(entities.Finished)
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Delivered}))
+		requests := receiver.requests()
+		gomega.Expect(requests).To(gomega.HaveLen(3))
+		gomega.Expect(requests[0].header.Get(DeliveryHeader)).To(gomega.Equal(requests[2].header.Get(DeliveryHeader)))
+		deliveries, err := dispatcher.Deliveries(operation.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries[0].Attempts).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should give up after the maximum number of attempts", func() {
+		receiver := newTestReceiver(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		defer receiver.server.Close()
+		dispatcher.Configure([]string{receiver.server.URL}, "", 2)
+		operation := newFinishedOperation(entities.Finished)
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Failed}))
+		deliveries, err := dispatcher.Deliveries(operation.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries[0].Attempts).To(gomega.Equal(2))
+		gomega.Expect(deliveries[0].LastError).To(gomega.ContainSubstring("502"))
+	})
+
+	ginkgo.It("should not retry deliveries rejected by the receiver", func() {
+		receiver := newTestReceiver(http.StatusBadRequest)
+		defer receiver.server.Close()
+		dispatcher.Configure([]string{receiver.server.URL}, "", 5)
+		operation := newFinishedOperation(entities.Finished)
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Failed}))
+		gomega.Expect(receiver.requests()).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should not deliver to restricted addresses registered by the callers", func() {
+		receiver := newTestReceiver()
+		defer receiver.server.Close()
+		operation := newFinishedOperation(entities.Finished)
+		dispatcher.Subscribe(operation.RequestID(), []string{receiver.server.URL})
+		dispatcher.OperationFinished(operation, time.Minute)
+
+		gomega.Eventually(deliveryStatus(dispatcher, operation.RequestID())).Should(gomega.Equal([]DeliveryStatus{Failed}))
+		deliveries, err := dispatcher.Deliveries(operation.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries[0].Attempts).To(gomega.Equal(1))
+		gomega.Expect(deliveries[0].LastError).To(gomega.ContainSubstring("restricted address"))
+		gomega.Expect(receiver.requests()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should resume the pending deliveries of the delivery log", func() {
+		receiver := newTestReceiver()
+		defer receiver.server.Close()
+		store := NewMemoryDeliveryStore()
+		pending := Delivery{ID: "pending", RequestID: "request", URL: receiver.server.URL, Event: FinishedEvent,
+			Payload: []byte("{}"), Status: Pending, Attempts: 1}
+		delivered := Delivery{ID: "delivered", RequestID: "request", URL: receiver.server.URL, Event: FinishedEvent,
+			Payload: []byte("{}"), Status: Delivered, Attempts: 1}
+		gomega.Expect(store.Save(pending)).To(gomega.BeNil())
+		gomega.Expect(store.Save(delivered)).To(gomega.BeNil())
+		dispatcher.Configure([]string{receiver.server.URL}, "", 3)
+		gomega.Expect(dispatcher.UseStore(store)).To(gomega.BeNil())
+
+		gomega.Eventually(deliveryStatus(dispatcher, "request")).Should(gomega.Equal([]DeliveryStatus{Delivered, Delivered}))
+		requests := receiver.requests()
+		gomega.Expect(requests).To(gomega.HaveLen(1))
+		gomega.Expect(requests[0].header.Get(DeliveryHeader)).To(gomega.Equal("pending"))
+	})
+})
+
+var _ = ginkgo.Describe("Webhook URLs", func() {
+
+	ginkgo.It("should parse lists of URLs", func() {
+		urls, err := ParseURLs([]string{"http://a.example/hook, https://b.example/hook", "", "http://c.example"})
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(urls).To(gomega.Equal([]string{"http://a.example/hook", "https://b.example/hook", "http://c.example"}))
+	})
+
+	ginkgo.It("should reject invalid URLs", func() {
+		_, err := ParseURLs([]string{"ftp://a.example/hook"})
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+		_, err = ParseURLs([]string{"/relative"})
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+	})
+})
+
+var _ = ginkgo.Describe("Webhook URL policy", func() {
+
+	var policy *URLPolicy
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		policy, err = NewURLPolicy(nil)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+
+	ginkgo.It("should accept public https URLs", func() {
+		gomega.Expect(policy.Check("https://203.0.113.10/hook")).To(gomega.BeNil())
+	})
+
+	ginkgo.It("should require the https scheme", func() {
+		gomega.Expect(policy.Check("http://203.0.113.10/hook")).ShouldNot(gomega.BeNil())
+		gomega.Expect(policy.Check("/relative")).ShouldNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject loopback, private and link-local hosts", func() {
+		for _, rawURL := range []string{"https://127.0.0.1/hook", "https://10.1.2.3/hook", "https://192.168.1.1:8443/hook",
+			"https://169.254.169.254/latest/meta-data", "https://[::1]/hook", "https://[fe80::1]/hook", "https://localhost/hook"} {
+			err := policy.Check(rawURL)
+			gomega.Expect(err).ShouldNot(gomega.BeNil(), rawURL)
+			gomega.Expect(err.Type()).To(gomega.Equal(derrors.InvalidArgument))
+		}
+	})
+
+	ginkgo.It("should accept the allowed hosts", func() {
+		allowed, err := NewURLPolicy([]string{"10.0.0.0/8", "Hooks.Internal", "192.168.1.1"})
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(allowed.Check("https://10.1.2.3/hook")).To(gomega.BeNil())
+		gomega.Expect(allowed.Check("https://hooks.internal/hook")).To(gomega.BeNil())
+		gomega.Expect(allowed.Check("https://192.168.1.1/hook")).To(gomega.BeNil())
+		gomega.Expect(allowed.Check("https://192.168.1.2/hook")).ShouldNot(gomega.BeNil())
+		gomega.Expect(allowed.Check("http://10.1.2.3/hook")).ShouldNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject invalid allowed hosts", func() {
+		_, err := NewURLPolicy([]string{"10.0.0.0/33"})
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should check the webhooks of the request metadata", func() {
+		dispatcher := NewDispatcher()
+		defer dispatcher.Stop()
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(URLMetadataKey, "https://203.0.113.10/a, https://203.0.113.11/b"))
+		urls, err := dispatcher.URLsFromContext(ctx)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(urls).To(gomega.Equal([]string{"https://203.0.113.10/a", "https://203.0.113.11/b"}))
+
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(URLMetadataKey, "https://10.0.0.1/hook"))
+		_, err = dispatcher.URLsFromContext(ctx)
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+	})
+})
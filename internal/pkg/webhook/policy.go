@@ -0,0 +1,200 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultResolveTimeout with the default timeout to resolve the host of a webhook registered by a caller.
+const DefaultResolveTimeout = 5 * time.Second
+
+// restrictedNetworks with the address ranges that caller supplied webhooks cannot target: loopback, private,
+// shared, link-local and unspecified addresses. Link-local ranges include the metadata endpoints of the clouds.
+var restrictedNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.168.0.0/16", "::/128", "::1/128", "fc00::/7", "fe80::/10")
+
+// RestrictedAddressError is returned when a webhook registered by a caller targets a restricted address.
+type RestrictedAddressError struct {
+	Host    string
+	Address net.IP
+}
+
+func (e *RestrictedAddressError) Error() string {
+	return fmt.Sprintf("webhook host %s resolves to the restricted address %s", e.Host, e.Address)
+}
+
+// URLPolicy restricts the webhooks registered by the callers with the x-webhook-url metadata entry. Those webhooks
+// must use HTTPS and cannot target loopback, private or link-local addresses, unless their host is allowed
+// explicitly. The webhooks set in the configuration are trusted and not checked.
+type URLPolicy struct {
+	// hosts with the host names exempt from the address checks.
+	hosts map[string]bool
+	// networks with the address ranges exempt from the address checks.
+	networks []*net.IPNet
+	resolver *net.Resolver
+}
+
+// NewURLPolicy creates a policy exempting the given hosts from the address checks. Each entry is a host name, an
+// IP address or a CIDR range.
+func NewURLPolicy(allowedHosts []string) (*URLPolicy, derrors.Error) {
+	policy := &URLPolicy{
+		hosts:    make(map[string]bool, 0),
+		networks: make([]*net.IPNet, 0),
+		resolver: net.DefaultResolver,
+	}
+	for _, entry := range allowedHosts {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, derrors.NewInvalidArgumentError("invalid webhook allowed network").WithParams(entry)
+			}
+			policy.networks = append(policy.networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			policy.networks = append(policy.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		policy.hosts[entry] = true
+	}
+	return policy, nil
+}
+
+// Check validates a webhook URL registered by a caller.
+func (p *URLPolicy) Check(rawURL string) derrors.Error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid webhook URL").WithParams(rawURL)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return derrors.NewInvalidArgumentError("webhook URL must be an absolute https URL").WithParams(rawURL)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultResolveTimeout)
+	defer cancel()
+	_, err = p.resolve(ctx, parsed.Hostname())
+	if err != nil {
+		return derrors.NewInvalidArgumentError("webhook host is not allowed", err).WithParams(rawURL)
+	}
+	return nil
+}
+
+// resolve returns the addresses of a host, failing if any of them is restricted. Allowed host names are not
+// resolved and an empty list is returned for them.
+func (p *URLPolicy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(host)
+	if p.hosts[host] {
+		return []net.IP{}, nil
+	}
+	addresses := make([]net.IP, 0)
+	if ip := net.ParseIP(host); ip != nil {
+		addresses = append(addresses, ip)
+	} else {
+		resolved, err := p.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range resolved {
+			addresses = append(addresses, address.IP)
+		}
+	}
+	for _, address := range addresses {
+		if !p.allowedAddress(address) {
+			return nil, &RestrictedAddressError{Host: host, Address: address}
+		}
+	}
+	return addresses, nil
+}
+
+// allowedAddress checks if a webhook registered by a caller may target an address.
+func (p *URLPolicy) allowedAddress(address net.IP) bool {
+	for _, network := range p.networks {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	if address.IsLoopback() || address.IsLinkLocalUnicast() || address.IsUnspecified() {
+		return false
+	}
+	for _, network := range restrictedNetworks {
+		if network.Contains(address) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialContext connects to the host of a webhook registered by a caller. The address is checked again when the
+// connection is opened so that the host cannot be changed to resolve to a restricted address after the webhook
+// is registered.
+func (p *URLPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addresses, err := p.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addresses) == 0 {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(addresses[0].String(), port))
+	}
+}
+
+// client returns an HTTP client for the webhooks registered by the callers. Proxies are not used as the address
+// of the webhook must be checked.
+func (p *URLPolicy) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         p.dialContext(dialer),
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// parseNetworks parses a list of CIDR ranges.
+func parseNetworks(ranges ...string) []*net.IPNet {
+	result := make([]*net.IPNet, 0, len(ranges))
+	for _, cidr := range ranges {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, network)
+	}
+	return result
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// DeliveryStatus with the state of the delivery of a notification.
+type DeliveryStatus string
+
+const (
+	// Pending deliveries are waiting for their next attempt.
+	Pending DeliveryStatus = "pending"
+	// Delivered notifications were accepted by the receiver.
+	Delivered DeliveryStatus = "delivered"
+	// Failed deliveries exhausted their attempts or were rejected by the receiver.
+	Failed DeliveryStatus = "failed"
+)
+
+// Delivery with the state of the notification of an operation result to a webhook.
+type Delivery struct {
+	// ID with the delivery identifier.
+	ID string `json:"id"`
+	// RequestID of the notified operation.
+	RequestID string `json:"request_id"`
+	// URL of the webhook.
+	URL string `json:"url"`
+	// Event with the type of event being notified.
+	Event string `json:"event"`
+	// Payload with the serialized body of the notification.
+	Payload json.RawMessage `json:"payload"`
+	// Status of the delivery.
+	Status DeliveryStatus `json:"status"`
+	// Attempts with the number of attempts performed.
+	Attempts int `json:"attempts"`
+	// LastError with the error of the last failed attempt.
+	LastError string `json:"last_error,omitempty"`
+	// NextAttempt with the timestamp of the next attempt of pending deliveries.
+	NextAttempt int64 `json:"next_attempt,omitempty"`
+	// Created with the timestamp when the delivery was created.
+	Created int64 `json:"created"`
+	// Updated with the timestamp of the last update of the delivery.
+	Updated int64 `json:"updated"`
+}
+
+// DeliveryStore interface defining the operations required to persist the delivery log.
+type DeliveryStore interface {
+	// Save creates or updates a delivery.
+	Save(delivery Delivery) derrors.Error
+	// List retrieves all the stored deliveries sorted by creation time.
+	List() ([]Delivery, derrors.Error)
+	// Close releases the resources associated with the store.
+	Close() derrors.Error
+}
+
+// NewDeliveryStore creates the store for a given path. If no path is provided, the delivery log is only kept
+// in memory.
+func NewDeliveryStore(path string, retention time.Duration) (DeliveryStore, derrors.Error) {
+	if path == "" {
+		return NewMemoryDeliveryStore(), nil
+	}
+	return NewFileDeliveryStore(path, retention)
+}
+
+// MemoryDeliveryStore with a volatile implementation of the delivery store.
+type MemoryDeliveryStore struct {
+	sync.Mutex
+	deliveries map[string]Delivery
+}
+
+// NewMemoryDeliveryStore creates an empty in-memory store.
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{
+		deliveries: make(map[string]Delivery, 0),
+	}
+}
+
+// Save creates or updates a delivery.
+func (mds *MemoryDeliveryStore) Save(delivery Delivery) derrors.Error {
+	mds.Lock()
+	defer mds.Unlock()
+	mds.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// List retrieves all the stored deliveries sorted by creation time.
+func (mds *MemoryDeliveryStore) List() ([]Delivery, derrors.Error) {
+	mds.Lock()
+	defer mds.Unlock()
+	result := make([]Delivery, 0, len(mds.deliveries))
+	for _, delivery := range mds.deliveries {
+		result = append(result, delivery)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+	return result, nil
+}
+
+// Close releases the resources associated with the store.
+func (mds *MemoryDeliveryStore) Close() derrors.Error {
+	return nil
+}
+
+// FileDeliveryStore with an append-only journal implementation of the delivery store. Each line of the journal
+// contains the new state of a delivery. When the store is opened, the journal is replayed and compacted,
+// dropping the completed deliveries older than the retention period.
+type FileDeliveryStore struct {
+	*MemoryDeliveryStore
+	path    string
+	journal *os.File
+}
+
+// NewFileDeliveryStore opens or creates a journal on the given path. If retention is 0, completed deliveries
+// are kept forever.
+func NewFileDeliveryStore(path string, retention time.Duration) (*FileDeliveryStore, derrors.Error) {
+	fds := &FileDeliveryStore{
+		MemoryDeliveryStore: NewMemoryDeliveryStore(),
+		path:                path,
+	}
+	err := fds.replay()
+	if err != nil {
+		return nil, err
+	}
+	if retention > 0 {
+		fds.expire(time.Now().Add(-retention).Unix())
+	}
+	err = fds.compact()
+	if err != nil {
+		return nil, err
+	}
+	journal, oErr := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if oErr != nil {
+		return nil, derrors.AsError(oErr, "cannot open delivery journal")
+	}
+	fds.journal = journal
+	log.Info().Str("path", path).Int("deliveries", len(fds.deliveries)).Msg("webhook delivery store loaded")
+	return fds, nil
+}
+
+// replay reads the journal and applies all the entries to the in-memory state.
+func (fds *FileDeliveryStore) replay() derrors.Error {
+	file, err := os.Open(fds.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return derrors.AsError(err, "cannot open delivery journal")
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		delivery := Delivery{}
+		err := json.Unmarshal(scanner.Bytes(), &delivery)
+		if err != nil || delivery.ID == "" {
+			// A partially written entry may be found if the provisioner died while writing.
+			log.Warn().Int("line", line).Msg("skipping invalid delivery journal entry")
+			continue
+		}
+		fds.deliveries[delivery.ID] = delivery
+	}
+	if err := scanner.Err(); err != nil {
+		return derrors.AsError(err, "cannot read delivery journal")
+	}
+	return nil
+}
+
+// expire removes the completed deliveries last updated before a given timestamp.
+func (fds *FileDeliveryStore) expire(before int64) {
+	for id, delivery := range fds.deliveries {
+		if delivery.Status != Pending && delivery.Updated < before {
+			delete(fds.deliveries, id)
+		}
+	}
+}
+
+// compact rewrites the journal so that it only contains the current state of the deliveries.
+func (fds *FileDeliveryStore) compact() derrors.Error {
+	err := os.MkdirAll(filepath.Dir(fds.path), 0700)
+	if err != nil {
+		return derrors.AsError(err, "cannot create delivery journal directory")
+	}
+	tmpPath := fds.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return derrors.AsError(err, "cannot create temporal delivery journal")
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, delivery := range fds.deliveries {
+		wErr := writeDelivery(writer, delivery)
+		if wErr != nil {
+			tmp.Close()
+			return wErr
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot write temporal delivery journal")
+	}
+	err = os.Rename(tmpPath, fds.path)
+	if err != nil {
+		return derrors.AsError(err, "cannot replace delivery journal")
+	}
+	return nil
+}
+
+// writeDelivery serializes a delivery as a new line of the journal.
+func writeDelivery(writer *bufio.Writer, delivery Delivery) derrors.Error {
+	raw, err := json.Marshal(delivery)
+	if err != nil {
+		return derrors.AsError(err, "cannot serialize delivery")
+	}
+	_, err = writer.Write(append(raw, '\n'))
+	if err != nil {
+		return derrors.AsError(err, "cannot write delivery journal entry")
+	}
+	return nil
+}
+
+// Save creates or updates a delivery.
+func (fds *FileDeliveryStore) Save(delivery Delivery) derrors.Error {
+	fds.Lock()
+	defer fds.Unlock()
+	if fds.journal == nil {
+		return derrors.NewFailedPreconditionError("delivery journal is closed")
+	}
+	writer := bufio.NewWriter(fds.journal)
+	err := writeDelivery(writer, delivery)
+	if err != nil {
+		return err
+	}
+	fErr := writer.Flush()
+	if fErr == nil {
+		fErr = fds.journal.Sync()
+	}
+	if fErr != nil {
+		return derrors.AsError(fErr, "cannot persist delivery journal entry")
+	}
+	fds.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// Close releases the resources associated with the store.
+func (fds *FileDeliveryStore) Close() derrors.Error {
+	fds.Lock()
+	defer fds.Unlock()
+	if fds.journal == nil {
+		return nil
+	}
+	err := fds.journal.Close()
+	fds.journal = nil
+	if err != nil {
+		return derrors.AsError(err, "cannot close delivery journal")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("File delivery store", func() {
+
+	var tempDir string
+	var journalPath string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "webhook")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+		journalPath = filepath.Join(tempDir, "webhooks.journal")
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	ginkgo.It("should recover the deliveries after reopening the journal", func() {
+		fds, err := NewFileDeliveryStore(journalPath, DefaultRetention)
+		gomega.Expect(err).To(gomega.BeNil())
+		now := time.Now().Unix()
+		delivery := Delivery{ID: "first", RequestID: "request", URL: "http://a.example", Payload: []byte("{}"), Status: Pending,
+			Created: now, Updated: now}
+		gomega.Expect(fds.Save(delivery)).To(gomega.BeNil())
+		delivery.Attempts = 1
+		delivery.Status = Delivered
+		gomega.Expect(fds.Save(delivery)).To(gomega.BeNil())
+		second := Delivery{ID: "second", RequestID: "request", URL: "http://b.example", Payload: []byte("{}"), Status: Pending,
+			Created: now + 1, Updated: now + 1}
+		gomega.Expect(fds.Save(second)).To(gomega.BeNil())
+		gomega.Expect(fds.Close()).To(gomega.BeNil())
+
+		reopened, err := NewFileDeliveryStore(journalPath, DefaultRetention)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		deliveries, err := reopened.List()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries).To(gomega.Equal([]Delivery{delivery, second}))
+	})
+
+	ginkgo.It("should drop the completed deliveries older than the retention", func() {
+		fds, err := NewFileDeliveryStore(journalPath, time.Hour)
+		gomega.Expect(err).To(gomega.BeNil())
+		old := time.Now().Add(-2 * time.Hour).Unix()
+		gomega.Expect(fds.Save(Delivery{ID: "delivered", Status: Delivered, Created: old, Updated: old})).To(gomega.BeNil())
+		gomega.Expect(fds.Save(Delivery{ID: "failed", Status: Failed, Created: old, Updated: old})).To(gomega.BeNil())
+		gomega.Expect(fds.Save(Delivery{ID: "pending", Status: Pending, Created: old, Updated: old})).To(gomega.BeNil())
+		gomega.Expect(fds.Close()).To(gomega.BeNil())
+
+		reopened, err := NewFileDeliveryStore(journalPath, time.Hour)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer reopened.Close()
+		deliveries, err := reopened.List()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries).To(gomega.HaveLen(1))
+		gomega.Expect(deliveries[0].ID).To(gomega.Equal("pending"))
+	})
+
+	ginkgo.It("should skip partially written entries", func() {
+		gomega.Expect(ioutil.WriteFile(journalPath, []byte("{\"id\":\"valid\",\"status\":\"pending\"}\n{\"id\":\"trun"), 0600)).To(gomega.Succeed())
+		fds, err := NewFileDeliveryStore(journalPath, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		defer fds.Close()
+		deliveries, err := fds.List()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(deliveries).To(gomega.HaveLen(1))
+	})
+})
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// URLMetadataKey with the name of the metadata entry used to register webhooks for a request as the option is
+// not part of the request messages. The entry may be repeated or contain a comma separated list of URLs, which
+// must comply with the URLPolicy of the dispatcher.
+const URLMetadataKey = "x-webhook-url"
+
+const (
+	// SignatureHeader with the HMAC-SHA256 signature of the timestamp and the body of the request.
+	SignatureHeader = "X-Provisioner-Signature"
+	// TimestampHeader with the Unix timestamp used to compute the signature.
+	TimestampHeader = "X-Provisioner-Timestamp"
+	// DeliveryHeader with the identifier of the delivery, shared by all its attempts.
+	DeliveryHeader = "X-Provisioner-Delivery"
+	// EventHeader with the type of event being notified.
+	EventHeader = "X-Provisioner-Event"
+	// SignaturePrefix with the algorithm prefix of the signature value.
+	SignaturePrefix = "sha256="
+)
+
+const (
+	// FinishedEvent is sent when an operation finishes successfully.
+	FinishedEvent = "operation.finished"
+	// FailedEvent is sent when an operation finishes with an error.
+	FailedEvent = "operation.failed"
+)
+
+// Payload with the JSON document posted to the webhooks. The kubeconfig of the cluster is not included, the
+// receivers are expected to retrieve it through the provisioner API.
+type Payload struct {
+	// Event with the type of event.
+	Event string `json:"event"`
+	// Timestamp when the operation finished.
+	Timestamp int64 `json:"timestamp"`
+	// OrganizationID with the organization identifier.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID with the cluster identifier.
+	ClusterID string `json:"cluster_id"`
+	// RequestID with the request identifier.
+	RequestID string `json:"request_id"`
+	// Type of operation.
+	Type string `json:"type"`
+	// Progress with the final state of the operation.
+	Progress string `json:"progress"`
+	// ElapsedTime with the duration of the operation.
+	ElapsedTime int64 `json:"elapsed_time"`
+	// Error with the description of the error for failed operations.
+	Error string `json:"error,omitempty"`
+	// ClusterName with the name of the provisioned cluster.
+	ClusterName string `json:"cluster_name,omitempty"`
+	// Hostname with the hostname of the provisioned cluster.
+	Hostname string `json:"hostname,omitempty"`
+	// Rollback with the actions performed to undo a failed operation.
+	Rollback []entities.RollbackAction `json:"rollback,omitempty"`
+}
+
+// NewPayload builds the payload notifying the result of an operation.
+func NewPayload(result entities.OperationResult, clusterID string, timestamp int64) Payload {
+	event := FinishedEvent
+	if result.Progress != entities.Finished {
+		event = FailedEvent
+	}
+	payload := Payload{
+		Event:          event,
+		Timestamp:      timestamp,
+		OrganizationID: result.OrganizationId,
+		ClusterID:      clusterID,
+		RequestID:      result.RequestId,
+		Type:           entities.ToOperationTypeString[result.Type],
+		Progress:       entities.TaskProgressToString[result.Progress],
+		ElapsedTime:    result.ElapsedTime,
+		Error:          result.ErrorMsg,
+		Rollback:       result.Rollback,
+	}
+	if result.ProvisionResult != nil {
+		payload.ClusterName = result.ProvisionResult.ClusterName
+		payload.Hostname = result.ProvisionResult.Hostname
+	}
+	return payload
+}
+
+// Sign computes the signature of a request body sent at a given timestamp.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = fmt.Fprintf(mac, "%d.", timestamp)
+	_, _ = mac.Write(body)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a request body. Receivers may use it to authenticate the notifications.
+func Verify(secret []byte, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// ValidURL checks that a webhook URL is an absolute HTTP or HTTPS URL.
+func ValidURL(rawURL string) derrors.Error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid webhook URL").WithParams(rawURL)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return derrors.NewInvalidArgumentError("webhook URL must be an absolute http or https URL").WithParams(rawURL)
+	}
+	return nil
+}
+
+// ParseURLs splits and validates a list of webhook URLs. Empty entries are ignored.
+func ParseURLs(values []string) ([]string, derrors.Error) {
+	return parseURLs(values, ValidURL)
+}
+
+// parseURLs splits a list of webhook URLs and validates them with a given check. Empty entries are ignored.
+func parseURLs(values []string, check func(rawURL string) derrors.Error) ([]string, derrors.Error) {
+	result := make([]string, 0)
+	for _, value := range values {
+		for _, rawURL := range strings.Split(value, ",") {
+			rawURL = strings.TrimSpace(rawURL)
+			if rawURL == "" {
+				continue
+			}
+			err := check(rawURL)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, rawURL)
+		}
+	}
+	return result, nil
+}
@@ -17,56 +17,393 @@
 package workflow
 
 import (
+	"context"
+	"github.com/nalej/derrors"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
+	"time"
 )
 
+// MaxConcurrentOperation with the default number of operations executed at the same time.
 const MaxConcurrentOperation = 5
 
-var executorInstance Executor
+// DefaultCheckpointInterval with the default period to persist the state of the operations being executed.
+const DefaultCheckpointInterval = 30 * time.Second
+
+// LockPolicy determines how the executor handles the operations targeting a cluster that is being modified by
+// another operation.
+type LockPolicy int
+
+const (
+	// WaitForLock queues the conflicting operations so that they are executed in order once the cluster is released.
+	WaitForLock LockPolicy = iota + 1
+	// RejectOnConflict rejects the conflicting operations.
+	RejectOnConflict
+)
+
+// LockPolicyFromString map translating the configuration values into lock policies.
+var LockPolicyFromString = map[string]LockPolicy{
+	"wait":   WaitForLock,
+	"reject": RejectOnConflict,
+}
+
+// ClusterLock with the operation holding the lock of a cluster.
+type ClusterLock struct {
+	// OrganizationID of the cluster.
+	OrganizationID string
+	// ClusterID of the cluster. For clusters without identifier, the cluster name is used.
+	ClusterID string
+	// RequestID of the operation holding the lock.
+	RequestID string
+	// Since with the timestamp when the lock was acquired.
+	Since int64
+}
+
+var executorInstance *Executor
 var onceExecutor sync.Once
 
 // Executor structure inspired by the one on the installer component. In this case, the executor
 // is responsible of executing a set of provider operations.
 type Executor struct {
 	sync.Mutex
-	// Queue of operation to be executed
-	Queue []entities.InfrastructureOperation
+	// Scheduler with the operations waiting to be executed.
+	Scheduler Scheduler
+	// MaxConcurrent with the maximum number of operations executed at the same time.
+	MaxConcurrent int
+	// MaxConcurrentPerOrganization with the maximum number of operations of the same organization executed at
+	// the same time. A value of 0 disables the limit.
+	MaxConcurrentPerOrganization int
 	// OnExecution contains the operations being executed at the moment
 	OnExecution map[string]entities.InfrastructureOperation
 	// Managed map of operations.
 	Managed map[string]bool
+	// Locks contains the lock of each cluster being modified indexed by cluster key.
+	Locks map[string]ClusterLock
+	// LockPolicy determines how operations targeting a locked cluster are handled.
+	LockPolicy LockPolicy
+	// Store used to persist the state of the operations.
+	Store store.OperationStore
+	// Restored contains the records of the operations loaded from the store.
+	Restored map[string]entities.OperationRecord
+	// Deadlines with the maximum duration of each type of operation. Types without a deadline are not limited.
+	Deadlines map[entities.OperationType]time.Duration
+	// StalledTimeout with the maximum time an operation may run without adding entries to its log.
+	StalledTimeout time.Duration
+	// executions contains the execution state of the operations being executed.
+	executions map[string]*execution
+	// nextExecution with the identifier of the last execution started.
+	nextExecution int64
+	// expired contains the executions released by the watchdog or the shutdown whose callback has not been
+	// received yet, indexed by execution identifier.
+	expired map[int64]*execution
+	// stopCheckpoint is used to stop the checkpoint loop.
+	stopCheckpoint chan struct{}
+	// stopWatchdog is used to stop the watchdog loop.
+	stopWatchdog chan struct{}
+	// observers notified of the lifecycle of the operations.
+	observers []Observer
+	// queued contains the trace of the operations waiting to be executed.
+	queued map[string]queuedTrace
+	// mode determines whether new operations are accepted and started.
+	mode ExecutorMode
+	// storeErr with the error of the last write to the store, nil if it succeeded.
+	storeErr derrors.Error
+	// closed is set once the store has been closed, so that late operations are no longer persisted.
+	closed bool
+}
+
+// queuedTrace with the trace of an operation waiting to be executed.
+type queuedTrace struct {
+	// ctx with the span of the request that scheduled the operation.
+	ctx context.Context
+	// span measuring the time spent in the queue.
+	span trace.Span
 }
 
-func NewExecutor() Executor {
-	return Executor{
-		Queue:       make([]entities.InfrastructureOperation, 0),
-		OnExecution: make(map[string]entities.InfrastructureOperation, 0),
-		Managed:     make(map[string]bool, 0),
+func NewExecutor(operationStore store.OperationStore) *Executor {
+	return &Executor{
+		Scheduler:     NewFairScheduler(),
+		MaxConcurrent: MaxConcurrentOperation,
+		OnExecution:   make(map[string]entities.InfrastructureOperation, 0),
+		Managed:       make(map[string]bool, 0),
+		Locks:         make(map[string]ClusterLock, 0),
+		LockPolicy:    WaitForLock,
+		Store:         operationStore,
+		Restored:      make(map[string]entities.OperationRecord, 0),
+		Deadlines:     make(map[entities.OperationType]time.Duration, 0),
+		executions:    make(map[string]*execution, 0),
+		expired:       make(map[int64]*execution, 0),
+		queued:        make(map[string]queuedTrace, 0),
+		mode:          ActiveMode,
 	}
 }
 
-func GetExecutor() Executor {
+func GetExecutor() *Executor {
 	onceExecutor.Do(func() {
-		executorInstance = NewExecutor()
+		executorInstance = NewExecutor(store.NewMemoryOperationStore())
 	})
 	return executorInstance
 }
 
-// ScheduleOperation schedules an operation for execution
-func (e *Executor) ScheduleOperation(operation entities.InfrastructureOperation) {
-	operation.SetProgress(entities.Registered)
+// UseStore sets the store used to persist the operations and restores the operations found on it. Operations
+// that did not reach a final state are marked as interrupted. A checkpoint loop is launched to periodically
+// persist the state of the ongoing operations.
+func (e *Executor) UseStore(operationStore store.OperationStore, checkpointInterval time.Duration) derrors.Error {
+	records, err := operationStore.List()
+	if err != nil {
+		return err
+	}
 	e.Lock()
 	defer e.Unlock()
+	e.Store = operationStore
+	e.storeErr = nil
+	e.closed = false
+	for _, record := range records {
+		if !record.Progress.IsTerminal() {
+			log.Warn().Str("requestID", record.RequestID).
+				Str("progress", entities.TaskProgressToString[record.Progress]).Msg("operation was interrupted")
+			record.MarkInterrupted()
+			sErr := e.Store.Save(record)
+			if sErr != nil {
+				return sErr
+			}
+		}
+		e.Restored[record.RequestID] = record
+	}
+	log.Info().Int("restored", len(e.Restored)).Msg("operations restored from store")
+	if checkpointInterval > 0 && e.stopCheckpoint == nil {
+		e.stopCheckpoint = make(chan struct{})
+		go e.checkpointLoop(checkpointInterval, e.stopCheckpoint)
+	}
+	return nil
+}
+
+// SetLockPolicy sets how operations targeting a locked cluster are handled.
+func (e *Executor) SetLockPolicy(policy LockPolicy) {
+	e.Lock()
+	defer e.Unlock()
+	e.LockPolicy = policy
+}
+
+// SetConcurrency sets the maximum number of operations executed at the same time globally and per organization.
+// A perOrganization value of 0 disables the limit per organization.
+func (e *Executor) SetConcurrency(global int, perOrganization int) {
+	e.Lock()
+	defer e.Unlock()
+	e.MaxConcurrent = global
+	e.MaxConcurrentPerOrganization = perOrganization
+	e.startEligible()
+}
+
+// RestoredOperations returns the operations of a given type loaded from the store.
+func (e *Executor) RestoredOperations(operationType entities.OperationType) []entities.InfrastructureOperation {
+	e.Lock()
+	defer e.Unlock()
+	result := make([]entities.InfrastructureOperation, 0)
+	for _, record := range e.Restored {
+		if record.Type == operationType {
+			result = append(result, NewRestoredOperation(record))
+		}
+	}
+	return result
+}
+
+// ForgetOperation removes the persisted state of an operation.
+func (e *Executor) ForgetOperation(requestID string) {
+	e.Lock()
+	defer e.Unlock()
+	delete(e.Restored, requestID)
+	err := e.Store.Remove(requestID)
+	if err != nil && err.Type() != derrors.NotFound {
+		log.Warn().Str("requestID", requestID).Str("err", err.Error()).Msg("cannot remove operation from the store")
+		e.storeErr = err
+		return
+	}
+	e.storeErr = nil
+}
+
+// ScheduleOperation schedules an operation for execution. Operations targeting a cluster that is locked by another
+// operation wait for it to finish or are rejected with a FailedPrecondition error depending on the lock policy.
+func (e *Executor) ScheduleOperation(operation entities.InfrastructureOperation) derrors.Error {
+	return e.ScheduleOperationContext(context.Background(), operation)
+}
+
+// ScheduleOperationContext schedules an operation for execution tracing it as part of the span found in the
+// context. The context is only used for tracing, so the operation is not cancelled with it.
+func (e *Executor) ScheduleOperationContext(ctx context.Context, operation entities.InfrastructureOperation) derrors.Error {
+	e.Lock()
+	defer e.Unlock()
+	if err := e.accepting(); err != nil {
+		return err
+	}
+	if e.LockPolicy == RejectOnConflict {
+		holder := e.clusterHolder(operation.Metadata().ClusterKey())
+		if holder != "" {
+			return derrors.NewFailedPreconditionError("cluster is locked by another operation").WithParams(holder)
+		}
+	}
+	operation.SetProgress(entities.Registered)
 	e.Managed[operation.RequestID()] = true
-	if len(e.OnExecution) > MaxConcurrentOperation {
-		log.Debug().Msg("operation has been queued")
-		e.Queue = append(e.Queue, operation)
-	} else {
+	ctx = tracing.Detach(ctx)
+	_, span := tracing.StartSpan(ctx, "workflow.Executor.Queue", tracing.OperationAttributes(operation)...)
+	e.queued[operation.RequestID()] = queuedTrace{ctx: ctx, span: span}
+	e.Scheduler.Push(operation)
+	for _, observer := range e.observers {
+		observer.OperationScheduled(operation)
+	}
+	e.startEligible()
+	e.checkpoint(operation)
+	return nil
+}
+
+// clusterHolder returns the request identifier of the operation that holds the lock of a cluster, or the first
+// queued operation on it if the cluster is not locked. The caller is expected to hold the lock.
+func (e *Executor) clusterHolder(clusterKey string) string {
+	if clusterKey == "" {
+		return ""
+	}
+	if lock, exists := e.Locks[clusterKey]; exists {
+		return lock.RequestID
+	}
+	for _, queued := range e.Scheduler.Operations() {
+		if queued.Metadata().ClusterKey() == clusterKey {
+			return queued.RequestID()
+		}
+	}
+	return ""
+}
+
+// startEligible starts the queued operations in the order decided by the scheduler while there is capacity.
+// Operations targeting a locked cluster remain in the queue, as well as the ones that follow them on the same
+// cluster so that the order is preserved. Operations of organizations that reached their concurrency limit also
+// wait. No operation is started while the executor is paused or stopping. The caller is expected to hold the lock.
+func (e *Executor) startEligible() {
+	if e.holdingQueue() {
+		return
+	}
+	blocked := make(map[string]bool, 0)
+	running := make(map[string]int, 0)
+	for _, operation := range e.OnExecution {
+		running[operation.Metadata().OrganizationID]++
+	}
+	eligible := func(operation entities.InfrastructureOperation) bool {
+		metadata := operation.Metadata()
+		clusterKey := metadata.ClusterKey()
+		_, locked := e.Locks[clusterKey]
+		limited := e.MaxConcurrentPerOrganization > 0 && running[metadata.OrganizationID] >= e.MaxConcurrentPerOrganization
+		if limited || (clusterKey != "" && (locked || blocked[clusterKey])) {
+			if clusterKey != "" {
+				blocked[clusterKey] = true
+			}
+			return false
+		}
+		return true
+	}
+	for len(e.OnExecution) < e.MaxConcurrent {
+		operation, found := e.Scheduler.Next(eligible)
+		if !found {
+			break
+		}
+		metadata := operation.Metadata()
+		clusterKey := metadata.ClusterKey()
+		if clusterKey != "" {
+			cluster := metadata.ClusterID
+			if cluster == "" {
+				cluster = metadata.ClusterName
+			}
+			e.Locks[clusterKey] = ClusterLock{
+				OrganizationID: metadata.OrganizationID,
+				ClusterID:      cluster,
+				RequestID:      operation.RequestID(),
+				Since:          time.Now().Unix(),
+			}
+		}
+		running[metadata.OrganizationID]++
 		e.OnExecution[operation.RequestID()] = operation
-		go operation.Execute(e.operationCallback)
+		ctx, executionID := e.startExecution(operation)
+		for _, observer := range e.observers {
+			observer.OperationStarted(operation)
+		}
+		go operation.Execute(ctx, func(requestID string) {
+			e.operationCallback(requestID, executionID)
+		})
+	}
+	if e.Scheduler.Len() > 0 {
+		log.Debug().Int("queued", e.Scheduler.Len()).Int("onExecution", len(e.OnExecution)).Msg("operations have been queued")
+	}
+}
+
+// QueuePosition returns the position starting at 1 of a queued operation in the expected execution order, or 0
+// if the operation is not queued.
+func (e *Executor) QueuePosition(requestID string) int {
+	e.Lock()
+	defer e.Unlock()
+	return e.Scheduler.Position(requestID)
+}
+
+// ClusterLocks returns the locks currently held on the clusters.
+func (e *Executor) ClusterLocks() []ClusterLock {
+	e.Lock()
+	defer e.Unlock()
+	result := make([]ClusterLock, 0, len(e.Locks))
+	for _, lock := range e.Locks {
+		result = append(result, lock)
+	}
+	return result
+}
+
+// LockHolder returns the request identifier of the operation holding the lock of the cluster targeted by a queued
+// operation. An empty string is returned if the operation is not waiting for a cluster lock.
+func (e *Executor) LockHolder(requestID string) string {
+	e.Lock()
+	defer e.Unlock()
+	for _, queued := range e.Scheduler.Operations() {
+		if queued.RequestID() == requestID {
+			if lock, exists := e.Locks[queued.Metadata().ClusterKey()]; exists {
+				return lock.RequestID
+			}
+			return ""
+		}
 	}
+	return ""
+}
+
+// CancelOperation cancels a queued or ongoing operation. Queued operations are removed from the queue, while
+// ongoing operations will stop at the next step boundary and notify the executor through the callback.
+func (e *Executor) CancelOperation(requestID string) derrors.Error {
+	e.Lock()
+	defer e.Unlock()
+	for _, operation := range e.Scheduler.Operations() {
+		if operation.RequestID() == requestID {
+			err := operation.Cancel()
+			if err != nil {
+				return err
+			}
+			e.Scheduler.Remove(requestID)
+			delete(e.Managed, requestID)
+			if queued, exists := e.queued[requestID]; exists {
+				tracing.EndOperationSpan(queued.span, operation)
+				delete(e.queued, requestID)
+			}
+			e.checkpoint(operation)
+			for _, observer := range e.observers {
+				observer.OperationFinished(operation, 0)
+			}
+			e.startEligible()
+			log.Debug().Str("requestID", requestID).Msg("queued operation has been cancelled")
+			return nil
+		}
+	}
+	operation, exists := e.OnExecution[requestID]
+	if !exists {
+		return derrors.NewNotFoundError("operation is not being executed").WithParams(requestID)
+	}
+	log.Debug().Str("requestID", requestID).Msg("cancelling ongoing operation")
+	return operation.Cancel()
 }
 
 // IsManaged enables the manager to check if the operation is queued or in progress
@@ -77,33 +414,134 @@ func (e *Executor) IsManaged(requestID string) bool {
 	return exists
 }
 
-// rescheduleNextOperation checks the queued list and picks the first element and proceeds with its execution.
-func (e *Executor) rescheduleNextOperation() {
+// operationCallback function called when an execution of an operation finished. This releases the lock of the
+// cluster and enables rescheduling the next operations from the queue.
+func (e *Executor) operationCallback(requestID string, executionID int64) {
+	log.Debug().Str("requestID", requestID).Int64("execution", executionID).Msg("operation callback received")
 	e.Lock()
 	defer e.Unlock()
-	log.Debug().Int("queued", len(e.Queue)).Int("onExecution", len(e.OnExecution)).Msg("rescheduling next operation")
-	if len(e.Queue) == 0 {
+	if expired, exists := e.expired[executionID]; exists {
+		log.Debug().Str("requestID", requestID).Msg("operation released by the watchdog has finished")
+		delete(e.expired, executionID)
+		if e.mode != StoppingMode {
+			// Persist the entries added by the operation after its expiration.
+			e.checkpoint(expired.operation)
+		}
+		e.releaseCluster(expired.operation)
+		e.startEligible()
+		return
+	}
+	execution, exists := e.executions[requestID]
+	if !exists || execution.id != executionID {
+		log.Error().Str("requestID", requestID).Int64("execution", executionID).Msg("attempting to remove an execution not managed by the executor")
+		return
+	}
+	e.release(execution.operation)
+	log.Debug().Int("queued", e.Scheduler.Len()).Int("onExecution", len(e.OnExecution)).Msg("rescheduling next operations")
+	e.startEligible()
+}
+
+// release persists the state of an operation that is no longer executed and releases its slot and the lock of
+// its cluster. The caller is expected to hold the lock.
+func (e *Executor) release(operation entities.InfrastructureOperation) {
+	e.releaseSlot(operation)
+	e.releaseCluster(operation)
+}
+
+// releaseSlot persists the state of an operation that is no longer executed and releases its slot. The caller is
+// expected to hold the lock.
+func (e *Executor) releaseSlot(operation entities.InfrastructureOperation) {
+	requestID := operation.RequestID()
+	e.checkpoint(operation)
+	var duration time.Duration
+	if execution, exists := e.executions[requestID]; exists {
+		duration = time.Since(execution.started)
+		tracing.EndOperationSpan(execution.span, operation)
+		execution.cancel()
+		delete(e.executions, requestID)
+	}
+	delete(e.OnExecution, requestID)
+	for _, observer := range e.observers {
+		observer.OperationFinished(operation, duration)
+	}
+}
+
+// releaseCluster stops managing an operation and releases the lock of its cluster. The caller is expected to hold
+// the lock.
+func (e *Executor) releaseCluster(operation entities.InfrastructureOperation) {
+	requestID := operation.RequestID()
+	delete(e.Managed, requestID)
+	clusterKey := operation.Metadata().ClusterKey()
+	if lock, locked := e.Locks[clusterKey]; locked && lock.RequestID == requestID {
+		delete(e.Locks, clusterKey)
+	}
+}
+
+// checkpoint persists the current state of an operation. Writes after the store is closed are ignored. The
+// caller is expected to hold the lock.
+func (e *Executor) checkpoint(operation entities.InfrastructureOperation) {
+	if e.closed {
+		log.Debug().Str("requestID", operation.RequestID()).Msg("store is closed, operation state is not persisted")
 		return
 	}
-	// Pick first element of the queue and schedule it.
-	first := e.Queue[0]
-	e.Queue = e.Queue[1:]
-	e.OnExecution[first.RequestID()] = first
-	go first.Execute(e.operationCallback)
+	err := e.Store.Save(entities.NewOperationRecord(operation))
+	if err != nil {
+		log.Error().Str("requestID", operation.RequestID()).Str("trace", err.DebugReport()).Msg("cannot persist operation state")
+	}
+	e.storeErr = err
 }
 
-// operationCallback function called when the operation finished its execution. This enables rescheduling the next
-// operations from the queue.
-func (e *Executor) operationCallback(requestID string) {
-	log.Debug().Str("requestID", requestID).Msg("operation callback received")
+// StoreError returns the reason why the operations cannot be persisted, or nil if the store is available. The
+// store is considered unavailable if the last write failed or if its own check fails.
+func (e *Executor) StoreError() derrors.Error {
 	e.Lock()
 	defer e.Unlock()
-	_, exists := e.OnExecution[requestID]
-	if !exists {
-		log.Error().Str("requestID", requestID).Msg("attempting to remove a request id not managed by the executor")
-	} else {
-		delete(e.OnExecution, requestID)
-		delete(e.Managed, requestID)
-		go e.rescheduleNextOperation()
+	if e.storeErr != nil {
+		return e.storeErr
+	}
+	if checker, ok := e.Store.(store.HealthChecker); ok {
+		return checker.Check()
+	}
+	return nil
+}
+
+// checkpointLoop periodically persists the state of the operations being executed so that the log and
+// progress is available after a restart.
+func (e *Executor) checkpointLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Lock()
+			for _, operation := range e.OnExecution {
+				e.checkpoint(operation)
+			}
+			e.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops the checkpoint and watchdog loops persisting the state of all managed operations and closes the store.
+func (e *Executor) Close() derrors.Error {
+	e.Lock()
+	defer e.Unlock()
+	if e.stopCheckpoint != nil {
+		close(e.stopCheckpoint)
+		e.stopCheckpoint = nil
+	}
+	if e.stopWatchdog != nil {
+		close(e.stopWatchdog)
+		e.stopWatchdog = nil
+	}
+	for _, operation := range e.OnExecution {
+		e.checkpoint(operation)
+	}
+	for _, operation := range e.Scheduler.Operations() {
+		e.checkpoint(operation)
 	}
+	e.closed = true
+	return e.Store.Close()
 }
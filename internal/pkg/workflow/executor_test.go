@@ -17,25 +17,63 @@
 package workflow
 
 import (
+	"context"
 	"github.com/nalej/derrors"
 	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
 	"github.com/satori/go.uuid"
+	"sync"
 	"time"
 )
 
 type TestOperation struct {
-	requestID string
-	progress  entities.TaskProgress
-	started   int64
+	sync.Mutex
+	requestID      string
+	organizationID string
+	clusterID      string
+	management     bool
+	// blocked operations ignore the cancellation of the context until they are unblocked.
+	blocked  chan struct{}
+	progress entities.TaskProgress
+	started  int64
+	cancel   context.CancelFunc
 }
 
 func NewTestOperation(requestID string) entities.InfrastructureOperation {
 	return &TestOperation{
-		requestID: requestID,
-		progress:  entities.Init,
+		requestID:      requestID,
+		organizationID: "org",
+		progress:       entities.Init,
+	}
+}
+
+func NewTestClusterOperation(requestID string, clusterID string) entities.InfrastructureOperation {
+	return &TestOperation{
+		requestID:      requestID,
+		organizationID: "org",
+		clusterID:      clusterID,
+		progress:       entities.Init,
+	}
+}
+
+func NewTestOrganizationOperation(requestID string, organizationID string, management bool) entities.InfrastructureOperation {
+	return &TestOperation{
+		requestID:      requestID,
+		organizationID: organizationID,
+		management:     management,
+		progress:       entities.Init,
+	}
+}
+
+func NewTestBlockedOperation(requestID string) *TestOperation {
+	return &TestOperation{
+		requestID:      requestID,
+		organizationID: "org",
+		blocked:        make(chan struct{}),
+		progress:       entities.Init,
 	}
 }
 
@@ -44,30 +82,61 @@ func (to *TestOperation) RequestID() string {
 }
 
 func (to *TestOperation) Metadata() entities.OperationMetadata {
-	panic("implement me")
+	return entities.OperationMetadata{
+		OrganizationID:      to.organizationID,
+		ClusterID:           to.clusterID,
+		IsManagementCluster: to.management,
+		RequestID:           to.requestID,
+	}
 }
 
-func (to *TestOperation) Log() []string {
-	return []string{}
+func (to *TestOperation) Log() []entities.LogEntry {
+	return []entities.LogEntry{}
 }
 
 func (to *TestOperation) Progress() entities.TaskProgress {
+	to.Lock()
+	defer to.Unlock()
 	return to.progress
 }
 
-func (to *TestOperation) Execute(callback func(requestID string)) {
+func (to *TestOperation) Execute(ctx context.Context, callback func(requestID string)) {
+	to.Lock()
+	ctx, to.cancel = context.WithCancel(ctx)
+	if to.progress == entities.Cancelled {
+		to.cancel()
+	}
 	to.started = time.Now().Unix()
+	to.Unlock()
 	log.Debug().Msg("executing test operation")
-	time.Sleep(time.Second)
-	to.progress = entities.Finished
+	if to.blocked != nil {
+		<-to.blocked
+		callback(to.requestID)
+		return
+	}
+	select {
+	case <-time.After(time.Second):
+		to.SetProgress(entities.Finished)
+	case <-ctx.Done():
+		to.SetProgress(entities.Cancelled)
+	}
 	callback(to.requestID)
 }
 
 func (to *TestOperation) Cancel() derrors.Error {
-	panic("implement me")
+	to.Lock()
+	defer to.Unlock()
+	if to.cancel == nil {
+		to.progress = entities.Cancelled
+		return nil
+	}
+	to.cancel()
+	return nil
 }
 
 func (to *TestOperation) SetProgress(progress entities.TaskProgress) {
+	to.Lock()
+	defer to.Unlock()
 	to.progress = progress
 }
 
@@ -75,7 +144,7 @@ func (to *TestOperation) Result() entities.OperationResult {
 	return entities.OperationResult{
 		RequestId: to.requestID,
 		Type:      entities.Provision,
-		Progress:  to.progress,
+		Progress:  to.Progress(),
 		//ElapsedTime:     time.Now().Sub(time.Unix(to.started, 0)).Nanoseconds(),
 		ErrorMsg:        "",
 		ProvisionResult: nil,
@@ -117,4 +186,251 @@ var _ = ginkgo.Describe("Executor basic tests", func() {
 			gomega.Expect(operations[index].Progress()).To(gomega.Equal(entities.Finished))
 		}
 	})
+
+	ginkgo.It("should be able to cancel an ongoing operation", func() {
+		test := NewTestOperation(uuid.NewV4().String())
+		executor.ScheduleOperation(test)
+		gomega.Expect(executor.CancelOperation(test.RequestID())).To(gomega.Succeed())
+		retries := 0
+		maxWait := 5
+		for ; executor.IsManaged(test.RequestID()) && retries < maxWait; retries++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		gomega.Expect(retries).ShouldNot(gomega.Equal(maxWait))
+		gomega.Expect(test.Progress()).To(gomega.Equal(entities.Cancelled))
+	})
+})
+
+var _ = ginkgo.Describe("Executor cluster locks", func() {
+
+	var executor *Executor
+
+	ginkgo.BeforeEach(func() {
+		executor = NewExecutor(store.NewMemoryOperationStore())
+	})
+
+	waitFinished := func(operation entities.InfrastructureOperation) {
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(operation.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+	}
+
+	ginkgo.It("should queue operations on a locked cluster", func() {
+		first := NewTestClusterOperation(uuid.NewV4().String(), "cluster")
+		second := NewTestClusterOperation(uuid.NewV4().String(), "cluster")
+		other := NewTestClusterOperation(uuid.NewV4().String(), "other")
+		gomega.Expect(executor.ScheduleOperation(first)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(second)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(other)).To(gomega.BeNil())
+
+		gomega.Expect(executor.LockHolder(second.RequestID())).To(gomega.Equal(first.RequestID()))
+		gomega.Expect(executor.LockHolder(other.RequestID())).To(gomega.BeEmpty())
+		result := second.Result()
+		executor.SetSchedulingState(&result)
+		gomega.Expect(result.LockHolder).To(gomega.Equal(first.RequestID()))
+		gomega.Expect(len(executor.ClusterLocks())).To(gomega.Equal(2))
+		gomega.Expect(second.Progress()).To(gomega.Equal(entities.Registered))
+
+		waitFinished(first)
+		gomega.Expect(first.Progress()).To(gomega.Equal(entities.Finished))
+		waitFinished(second)
+		gomega.Expect(second.Progress()).To(gomega.Equal(entities.Finished))
+		waitFinished(other)
+		gomega.Expect(len(executor.ClusterLocks())).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should reject operations on a locked cluster", func() {
+		executor.SetLockPolicy(RejectOnConflict)
+		first := NewTestClusterOperation(uuid.NewV4().String(), "cluster")
+		second := NewTestClusterOperation(uuid.NewV4().String(), "cluster")
+		gomega.Expect(executor.ScheduleOperation(first)).To(gomega.BeNil())
+		err := executor.ScheduleOperation(second)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.FailedPrecondition))
+		gomega.Expect(executor.IsManaged(second.RequestID())).To(gomega.BeFalse())
+
+		waitFinished(first)
+		gomega.Expect(executor.ScheduleOperation(second)).To(gomega.BeNil())
+		waitFinished(second)
+		gomega.Expect(second.Progress()).To(gomega.Equal(entities.Finished))
+	})
+})
+
+var _ = ginkgo.Describe("Executor concurrency limits", func() {
+
+	var executor *Executor
+
+	ginkgo.BeforeEach(func() {
+		executor = NewExecutor(store.NewMemoryOperationStore())
+	})
+
+	ginkgo.It("should limit the operations executed per organization", func() {
+		executor.SetConcurrency(3, 1)
+		first := NewTestOrganizationOperation(uuid.NewV4().String(), "org1", false)
+		second := NewTestOrganizationOperation(uuid.NewV4().String(), "org1", false)
+		other := NewTestOrganizationOperation(uuid.NewV4().String(), "org2", false)
+		gomega.Expect(executor.ScheduleOperation(first)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(second)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(other)).To(gomega.BeNil())
+
+		gomega.Expect(executor.QueuePosition(first.RequestID())).To(gomega.Equal(0))
+		gomega.Expect(executor.QueuePosition(second.RequestID())).To(gomega.Equal(1))
+		gomega.Expect(executor.QueuePosition(other.RequestID())).To(gomega.Equal(0))
+		md := executor.SchedulingMetadata(second.RequestID())
+		gomega.Expect(md.Get(QueuePositionHeader)).To(gomega.Equal([]string{"1"}))
+		result := second.Result()
+		executor.SetSchedulingState(&result)
+		gomega.Expect(result.QueuePosition).To(gomega.Equal(1))
+
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(second.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+		gomega.Expect(second.Progress()).To(gomega.Equal(entities.Finished))
+	})
+
+	ginkgo.It("should limit the operations executed globally", func() {
+		executor.SetConcurrency(1, 0)
+		first := NewTestOrganizationOperation(uuid.NewV4().String(), "org1", false)
+		second := NewTestOrganizationOperation(uuid.NewV4().String(), "org2", false)
+		management := NewTestOrganizationOperation(uuid.NewV4().String(), "org3", true)
+		gomega.Expect(executor.ScheduleOperation(first)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(second)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(management)).To(gomega.BeNil())
+
+		gomega.Expect(executor.QueuePosition(management.RequestID())).To(gomega.Equal(1))
+		gomega.Expect(executor.QueuePosition(second.RequestID())).To(gomega.Equal(2))
+		gomega.Expect(executor.SchedulingMetadata(first.RequestID()).Len()).To(gomega.Equal(0))
+
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(second.RequestID())
+		}, 10*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+		gomega.Expect(management.Progress()).To(gomega.Equal(entities.Finished))
+	})
+})
+
+var _ = ginkgo.Describe("Executor watchdog", func() {
+
+	var executor *Executor
+
+	ginkgo.BeforeEach(func() {
+		executor = NewExecutor(store.NewMemoryOperationStore())
+	})
+
+	ginkgo.It("should release the slot of an operation that exceeds its deadline", func() {
+		executor.SetConcurrency(1, 0)
+		executor.SetDeadlines(map[entities.OperationType]time.Duration{entities.Provision: time.Minute}, 0)
+		blocked := NewTestBlockedOperation(uuid.NewV4().String())
+		next := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(blocked)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(next)).To(gomega.BeNil())
+		gomega.Expect(executor.QueuePosition(next.RequestID())).To(gomega.Equal(1))
+
+		executor.Lock()
+		executor.expireOperations(time.Now().Add(30 * time.Second))
+		gomega.Expect(executor.OnExecution).To(gomega.HaveKey(blocked.RequestID()))
+		executor.expireOperations(time.Now().Add(2 * time.Minute))
+		gomega.Expect(executor.OnExecution).ToNot(gomega.HaveKey(blocked.RequestID()))
+		executor.Unlock()
+
+		// The expired operation cannot be resumed until it actually returns.
+		gomega.Expect(executor.IsManaged(blocked.RequestID())).To(gomega.BeTrue())
+		gomega.Expect(blocked.Progress()).To(gomega.Equal(entities.Error))
+		gomega.Expect(executor.QueuePosition(next.RequestID())).To(gomega.Equal(0))
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(next.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+
+		// The late callback of the expired operation only releases the operation.
+		close(blocked.blocked)
+		gomega.Eventually(func() int {
+			executor.Lock()
+			defer executor.Unlock()
+			return len(executor.expired)
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.Equal(0))
+		gomega.Expect(executor.IsManaged(blocked.RequestID())).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should keep the cluster locked until the expired operation returns", func() {
+		executor.SetDeadlines(map[entities.OperationType]time.Duration{entities.Provision: time.Minute}, 0)
+		blocked := NewTestBlockedOperation(uuid.NewV4().String())
+		blocked.clusterID = "cluster"
+		next := NewTestClusterOperation(uuid.NewV4().String(), "cluster")
+		gomega.Expect(executor.ScheduleOperation(blocked)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(next)).To(gomega.BeNil())
+
+		executor.Lock()
+		executor.expireOperations(time.Now().Add(2 * time.Minute))
+		gomega.Expect(executor.OnExecution).To(gomega.BeEmpty())
+		executor.Unlock()
+		gomega.Expect(executor.ClusterLocks()).To(gomega.HaveLen(1))
+		gomega.Expect(executor.ClusterLocks()[0].RequestID).To(gomega.Equal(blocked.RequestID()))
+		gomega.Expect(executor.QueuePosition(next.RequestID())).To(gomega.Equal(1))
+
+		// Callbacks of other executions of the operation are not mistaken for the expired one.
+		executor.operationCallback(blocked.RequestID(), -1)
+		gomega.Expect(executor.IsManaged(blocked.RequestID())).To(gomega.BeTrue())
+		gomega.Expect(executor.QueuePosition(next.RequestID())).To(gomega.Equal(1))
+
+		close(blocked.blocked)
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(blocked.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(next.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+		gomega.Expect(next.Progress()).To(gomega.Equal(entities.Finished))
+	})
+
+	ginkgo.It("should release the slot of an operation that stops making progress", func() {
+		executor.SetDeadlines(map[entities.OperationType]time.Duration{}, time.Minute)
+		blocked := NewTestBlockedOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(blocked)).To(gomega.BeNil())
+
+		executor.Lock()
+		executor.expireOperations(time.Now().Add(2 * time.Minute))
+		gomega.Expect(executor.OnExecution).To(gomega.BeEmpty())
+		executor.Unlock()
+
+		gomega.Expect(blocked.Progress()).To(gomega.Equal(entities.Error))
+		close(blocked.blocked)
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(blocked.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+	})
+})
+
+// TestRequestOperation is a test operation exposing the request that originated it.
+type TestRequestOperation struct {
+	*TestOperation
+	request interface{}
+}
+
+func (tro *TestRequestOperation) Request() interface{} {
+	return tro.request
+}
+
+var _ = ginkgo.Describe("Executor persistence", func() {
+
+	ginkgo.It("should not persist the credentials of the requests", func() {
+		operationStore := store.NewMemoryOperationStore()
+		executor := NewExecutor(operationStore)
+		test := &TestRequestOperation{
+			TestOperation: NewTestBlockedOperation(uuid.NewV4().String()),
+			request: map[string]interface{}{
+				"cluster_name": "cluster",
+				"credentials":  map[string]interface{}{"client_id": "client", "client_secret": "secret-value"},
+			},
+		}
+		gomega.Expect(executor.ScheduleOperation(test)).To(gomega.BeNil())
+		close(test.blocked)
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(test.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+
+		record, err := operationStore.Get(test.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(string(record.Request)).To(gomega.ContainSubstring("cluster"))
+		gomega.Expect(string(record.Request)).To(gomega.ContainSubstring("client"))
+		gomega.Expect(string(record.Request)).NotTo(gomega.ContainSubstring("secret-value"))
+	})
 })
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// QueuePositionHeader with the name of the response header containing the position of a queued operation. The
+// provision and scale responses do not have a field to report it.
+const QueuePositionHeader = "x-queue-position"
+
+// LockHolderHeader with the name of the response header containing the request identifier of the operation
+// holding the lock of the cluster targeted by a queued operation.
+const LockHolderHeader = "x-lock-holder"
+
+// SetSchedulingState fills the scheduling state of the operation of a result.
+func (e *Executor) SetSchedulingState(result *entities.OperationResult) {
+	result.LockHolder = e.LockHolder(result.RequestId)
+	result.QueuePosition = e.QueuePosition(result.RequestId)
+}
+
+// SchedulingMetadata returns the scheduling state of a queued operation as gRPC metadata. The metadata is empty
+// if the operation is not queued.
+func (e *Executor) SchedulingMetadata(requestID string) metadata.MD {
+	md := metadata.MD{}
+	position := e.QueuePosition(requestID)
+	if position == 0 {
+		return md
+	}
+	md.Set(QueuePositionHeader, strconv.Itoa(position))
+	holder := e.LockHolder(requestID)
+	if holder != "" {
+		md.Set(LockHolderHeader, holder)
+	}
+	return md
+}
+
+// SendSchedulingHeaders sends the scheduling state of a queued operation as headers of a gRPC response.
+func (e *Executor) SendSchedulingHeaders(ctx context.Context, requestID string) {
+	md := e.SchedulingMetadata(requestID)
+	if md.Len() == 0 {
+		return
+	}
+	err := grpc.SetHeader(ctx, md)
+	if err != nil {
+		log.Debug().Str("requestID", requestID).Str("err", err.Error()).Msg("cannot send scheduling headers")
+	}
+}
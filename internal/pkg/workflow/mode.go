@@ -0,0 +1,176 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultShutdownGracePeriod with the default time the running operations are given to finish when the
+// provisioner is stopped.
+const DefaultShutdownGracePeriod = 10 * time.Minute
+
+// idlePollInterval with the period to check if the running operations finished.
+const idlePollInterval = 100 * time.Millisecond
+
+// ExecutorMode determines whether the executor accepts and starts new operations.
+type ExecutorMode int
+
+const (
+	// ActiveMode accepts new operations and executes them.
+	ActiveMode ExecutorMode = iota + 1
+	// PausedMode accepts new operations but keeps them queued. The running operations are not affected.
+	PausedMode
+	// DrainingMode rejects new operations and executes those already queued.
+	DrainingMode
+	// StoppingMode rejects new operations and keeps the queued ones while the provisioner shuts down.
+	StoppingMode
+)
+
+// ExecutorModeToString map translating executor modes into their string representation.
+var ExecutorModeToString = map[ExecutorMode]string{
+	ActiveMode:   "active",
+	PausedMode:   "paused",
+	DrainingMode: "draining",
+	StoppingMode: "stopping",
+}
+
+// ExecutorModeFromString map translating the modes that can be requested into executor modes.
+var ExecutorModeFromString = map[string]ExecutorMode{
+	"active":   ActiveMode,
+	"paused":   PausedMode,
+	"draining": DrainingMode,
+}
+
+// Mode returns the current mode of the executor.
+func (e *Executor) Mode() ExecutorMode {
+	e.Lock()
+	defer e.Unlock()
+	return e.mode
+}
+
+// SetMode changes the mode of the executor. The mode cannot be changed once the executor is stopping.
+func (e *Executor) SetMode(mode ExecutorMode) derrors.Error {
+	e.Lock()
+	defer e.Unlock()
+	if mode != ActiveMode && mode != PausedMode && mode != DrainingMode {
+		return derrors.NewInvalidArgumentError("unsupported executor mode").WithParams(ExecutorModeToString[mode])
+	}
+	if e.mode == StoppingMode {
+		return derrors.NewFailedPreconditionError("executor is stopping")
+	}
+	if e.mode != mode {
+		log.Info().Str("from", ExecutorModeToString[e.mode]).Str("to", ExecutorModeToString[mode]).Msg("executor mode changed")
+	}
+	e.mode = mode
+	e.startEligible()
+	return nil
+}
+
+// Status returns the mode of the executor and the number of queued and running operations.
+func (e *Executor) Status() entities.ExecutorStatus {
+	e.Lock()
+	defer e.Unlock()
+	return entities.ExecutorStatus{
+		Mode:              ExecutorModeToString[e.mode],
+		QueuedOperations:  e.Scheduler.Len(),
+		RunningOperations: len(e.OnExecution),
+	}
+}
+
+// accepting checks if new operations can be scheduled. The caller is expected to hold the lock.
+func (e *Executor) accepting() derrors.Error {
+	if e.mode == DrainingMode || e.mode == StoppingMode {
+		return derrors.NewUnavailableError("provisioner is not accepting new operations").WithParams(ExecutorModeToString[e.mode])
+	}
+	return nil
+}
+
+// holdingQueue checks if the queued operations must wait. The caller is expected to hold the lock.
+func (e *Executor) holdingQueue() bool {
+	return e.mode == PausedMode || e.mode == StoppingMode
+}
+
+// WaitIdle blocks until no operation is being executed or the context is done. It returns whether the executor
+// became idle.
+func (e *Executor) WaitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for {
+		if e.RunningOperations() == 0 {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Shutdown stops accepting and starting operations, and waits up to the grace period for the running operations
+// to finish. The operations still running afterwards are persisted as interrupted so that they can be resumed
+// after a restart, they are stopped at the next step boundary without being rolled back and their slots are
+// released. It returns the number of interrupted operations.
+func (e *Executor) Shutdown(grace time.Duration) int {
+	e.Lock()
+	e.mode = StoppingMode
+	log.Info().Int("running", len(e.OnExecution)).Int("queued", e.Scheduler.Len()).
+		Str("grace", grace.String()).Msg("waiting for the running operations to finish")
+	e.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if e.WaitIdle(ctx) {
+		return 0
+	}
+	e.Lock()
+	defer e.Unlock()
+	interrupted := 0
+	for requestID, operation := range e.OnExecution {
+		log.Warn().Str("requestID", requestID).Msg("operation interrupted by the shutdown")
+		record := entities.NewOperationRecord(operation)
+		record.MarkInterrupted()
+		err := e.Store.Save(record)
+		if err != nil {
+			log.Error().Str("requestID", requestID).Str("trace", err.DebugReport()).Msg("cannot persist interrupted operation")
+		}
+		if execution, exists := e.executions[requestID]; exists {
+			// Stop the operation at the next step boundary instead of letting it call the provider while the
+			// store is being closed. Interruptible operations let the running step finish and are not rolled
+			// back, while the rest have their execution context cancelled.
+			if interruptible, ok := operation.(entities.InterruptibleOperation); ok {
+				interruptible.Interrupt()
+			} else {
+				execution.cancel()
+			}
+			tracing.EndOperationSpan(execution.span, operation)
+			delete(e.executions, requestID)
+			// The callback of the operation, if it ever arrives, is ignored.
+			e.expired[execution.id] = execution
+		}
+		delete(e.OnExecution, requestID)
+		delete(e.Managed, requestID)
+		interrupted++
+	}
+	return interrupted
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+)
+
+var _ = ginkgo.Describe("Executor modes", func() {
+
+	var operationStore *store.MemoryOperationStore
+	var executor *Executor
+
+	ginkgo.BeforeEach(func() {
+		operationStore = store.NewMemoryOperationStore()
+		executor = NewExecutor(operationStore)
+	})
+
+	waitFinished := func(operation entities.InfrastructureOperation) {
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(operation.RequestID())
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.BeFalse())
+	}
+
+	ginkgo.It("should keep the operations queued while paused", func() {
+		gomega.Expect(executor.SetMode(PausedMode)).To(gomega.BeNil())
+		test := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(test)).To(gomega.BeNil())
+		gomega.Consistently(executor.RunningOperations, 300*time.Millisecond).Should(gomega.Equal(0))
+		gomega.Expect(executor.Status()).To(gomega.Equal(entities.ExecutorStatus{Mode: "paused", QueuedOperations: 1}))
+
+		gomega.Expect(executor.SetMode(ActiveMode)).To(gomega.BeNil())
+		waitFinished(test)
+		gomega.Expect(test.Progress()).To(gomega.Equal(entities.Finished))
+	})
+
+	ginkgo.It("should reject new operations while draining", func() {
+		executor.SetConcurrency(1, 0)
+		running := NewTestOperation(uuid.NewV4().String())
+		queued := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(running)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(queued)).To(gomega.BeNil())
+		gomega.Expect(executor.SetMode(DrainingMode)).To(gomega.BeNil())
+
+		err := executor.ScheduleOperation(NewTestOperation(uuid.NewV4().String()))
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.Unavailable))
+		waitFinished(queued)
+		gomega.Expect(queued.Progress()).To(gomega.Equal(entities.Finished))
+	})
+
+	ginkgo.It("should let the running operations finish on shutdown", func() {
+		executor.SetConcurrency(1, 0)
+		running := NewTestOperation(uuid.NewV4().String())
+		queued := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(running)).To(gomega.BeNil())
+		gomega.Expect(executor.ScheduleOperation(queued)).To(gomega.BeNil())
+
+		gomega.Expect(executor.Shutdown(5 * time.Second)).To(gomega.Equal(0))
+		gomega.Expect(running.Progress()).To(gomega.Equal(entities.Finished))
+		gomega.Expect(queued.Progress()).To(gomega.Equal(entities.Registered))
+		gomega.Expect(executor.SetMode(ActiveMode)).ToNot(gomega.BeNil())
+		err := executor.ScheduleOperation(NewTestOperation(uuid.NewV4().String()))
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.Unavailable))
+	})
+
+	ginkgo.It("should interrupt the operations running after the grace period", func() {
+		blocked := NewTestBlockedOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(blocked)).To(gomega.BeNil())
+
+		gomega.Expect(executor.Shutdown(200 * time.Millisecond)).To(gomega.Equal(1))
+		gomega.Expect(executor.IsManaged(blocked.RequestID())).To(gomega.BeFalse())
+		record, err := operationStore.Get(blocked.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(record.Progress).To(gomega.Equal(entities.Interrupted))
+
+		// The late callback of the interrupted operation must be ignored.
+		close(blocked.blocked)
+		gomega.Eventually(func() int {
+			executor.Lock()
+			defer executor.Unlock()
+			return len(executor.expired)
+		}, 5*time.Second, 100*time.Millisecond).Should(gomega.Equal(0))
+		record, err = operationStore.Get(blocked.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(record.Progress).To(gomega.Equal(entities.Interrupted))
+	})
+
+	ginkgo.It("should cancel the interrupted operations and ignore their state after closing", func() {
+		running := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperation(running)).To(gomega.BeNil())
+
+		gomega.Expect(executor.Shutdown(100 * time.Millisecond)).To(gomega.Equal(1))
+		gomega.Expect(executor.Close()).To(gomega.BeNil())
+		// The operation stops with the cancellation of its context instead of running to completion.
+		gomega.Eventually(running.Progress, 5*time.Second, 50*time.Millisecond).Should(gomega.Equal(entities.Cancelled))
+
+		executor.Lock()
+		executor.checkpoint(running)
+		executor.Unlock()
+		record, err := operationStore.Get(running.RequestID())
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(record.Progress).To(gomega.Equal(entities.Interrupted))
+	})
+})
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"time"
+
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Observer is notified of the lifecycle of the operations managed by the executor. The methods are called with
+// the executor lock held so they must return quickly and must not call the executor.
+type Observer interface {
+	// OperationScheduled is called when an operation is added to the queue.
+	OperationScheduled(operation entities.InfrastructureOperation)
+	// OperationStarted is called when an operation leaves the queue and starts its execution.
+	OperationStarted(operation entities.InfrastructureOperation)
+	// OperationFinished is called when an operation is no longer managed by the executor, either because it
+	// finished, it expired or it was cancelled. The duration of operations cancelled while queued is 0.
+	OperationFinished(operation entities.InfrastructureOperation, duration time.Duration)
+}
+
+// AddObserver registers an observer of the operations managed by the executor.
+func (e *Executor) AddObserver(observer Observer) {
+	e.Lock()
+	defer e.Unlock()
+	e.observers = append(e.observers, observer)
+}
+
+// QueueLength returns the number of operations waiting to be executed.
+func (e *Executor) QueueLength() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.Scheduler.Len()
+}
+
+// RunningOperations returns the number of operations being executed.
+func (e *Executor) RunningOperations() int {
+	e.Lock()
+	defer e.Unlock()
+	return len(e.OnExecution)
+}
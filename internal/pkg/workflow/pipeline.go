@@ -0,0 +1,260 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// Step represents a named unit of work of an operation. Steps must be idempotent as a resumed operation will
+// execute again the step that failed.
+type Step struct {
+	// Name of the step. The name is used to track the completed steps so it must be unique in a pipeline.
+	Name string
+	// Run performs the step.
+	Run func(ctx context.Context) derrors.Error
+	// Compensate undoes the changes performed by the step. It may be nil for steps that do not require to be
+	// undone. Only the completed steps are compensated, unless CompensateFailed is set.
+	Compensate func(ctx context.Context) derrors.Error
+	// CompensateFailed is set for the steps that may leave partial resources when they fail. Their compensation is
+	// also executed when they fail, so it must check that the resources were created by the operation before
+	// removing them.
+	CompensateFailed bool
+}
+
+// NewStep creates a new step.
+func NewStep(name string, run func(ctx context.Context) derrors.Error) Step {
+	return Step{Name: name, Run: run}
+}
+
+// NewCompensableStep creates a new step that can be undone.
+func NewCompensableStep(name string, run func(ctx context.Context) derrors.Error, compensate func(ctx context.Context) derrors.Error) Step {
+	return Step{Name: name, Run: run, Compensate: compensate}
+}
+
+// NewPartialCompensableStep creates a new step that can be undone even if it fails. The compensation must only
+// remove the resources that were created by the operation.
+func NewPartialCompensableStep(name string, run func(ctx context.Context) derrors.Error, compensate func(ctx context.Context) derrors.Error) Step {
+	return Step{Name: name, Run: run, Compensate: compensate, CompensateFailed: true}
+}
+
+// Pipeline executes a sequence of steps keeping track of the completed ones and the outputs they produce so
+// that a failed execution can be resumed from the failing step.
+type Pipeline struct {
+	sync.Mutex
+	steps      []Step
+	checkpoint *entities.StepCheckpoint
+	// interrupted is set when the execution must stop at the next step boundary.
+	interrupted bool
+	// onStepStarted is called before each step is executed.
+	onStepStarted func(stepName string)
+	// onStepCompleted is called after each step is successfully executed.
+	onStepCompleted func(stepName string)
+}
+
+// NewPipeline creates a pipeline with a given sequence of steps.
+func NewPipeline(steps ...Step) *Pipeline {
+	return &Pipeline{
+		steps:      steps,
+		checkpoint: entities.NewStepCheckpoint(),
+	}
+}
+
+// OnStepStarted sets a function to be called before each step is executed.
+func (p *Pipeline) OnStepStarted(callback func(stepName string)) {
+	p.Lock()
+	defer p.Unlock()
+	p.onStepStarted = callback
+}
+
+// OnStepCompleted sets a function to be called after each step is successfully executed.
+func (p *Pipeline) OnStepCompleted(callback func(stepName string)) {
+	p.Lock()
+	defer p.Unlock()
+	p.onStepCompleted = callback
+}
+
+// Run executes the steps that have not been completed yet. The execution stops on the first failing step, when
+// the context is cancelled or when the pipeline is interrupted. Cancellation and interruption are checked on each
+// step boundary, and the steps that are not started because of them are not recorded as failed.
+func (p *Pipeline) Run(ctx context.Context) derrors.Error {
+	for _, step := range p.steps {
+		p.Lock()
+		completed := p.checkpoint.IsCompleted(step.Name)
+		interrupted := p.interrupted
+		p.Unlock()
+		if completed {
+			log.Debug().Str("step", step.Name).Msg("skipping completed step")
+			continue
+		}
+		if interrupted {
+			return derrors.NewUnavailableError("operation interrupted before step").WithParams(step.Name)
+		}
+		if ctx.Err() != nil {
+			return derrors.NewCanceledError("operation stopped before step", ctx.Err()).WithParams(step.Name)
+		}
+		log.Debug().Str("step", step.Name).Msg("executing step")
+		p.Lock()
+		started := p.onStepStarted
+		p.Unlock()
+		if started != nil {
+			started(step.Name)
+		}
+		err := p.runStep(ctx, step)
+		if err != nil {
+			return p.fail(step.Name, err)
+		}
+		p.Lock()
+		p.checkpoint.Completed = append(p.checkpoint.Completed, step.Name)
+		p.checkpoint.Failed = ""
+		callback := p.onStepCompleted
+		p.Unlock()
+		if callback != nil {
+			callback(step.Name)
+		}
+	}
+	return nil
+}
+
+// Interrupt stops the execution at the next step boundary. Unlike the cancellation of the context, the running
+// step is not stopped, so the pipeline can be resumed from the next step.
+func (p *Pipeline) Interrupt() {
+	p.Lock()
+	defer p.Unlock()
+	p.interrupted = true
+}
+
+// runStep executes a step inside its own span.
+func (p *Pipeline) runStep(ctx context.Context, step Step) derrors.Error {
+	ctx, span := tracing.StartSpan(ctx, "step "+step.Name, tracing.StepKey.String(step.Name))
+	defer span.End()
+	return tracing.Fail(span, step.Run(ctx))
+}
+
+// fail records the step that failed.
+func (p *Pipeline) fail(stepName string, err derrors.Error) derrors.Error {
+	p.Lock()
+	defer p.Unlock()
+	p.checkpoint.Failed = stepName
+	log.Debug().Str("step", stepName).Str("err", err.Error()).Msg("step failed")
+	return err
+}
+
+// Rollback undoes in reverse order the completed steps. The step that failed is only undone if it is declared as
+// leaving partial resources, as the resources it found may not belong to the operation. Steps without compensation
+// are skipped. The rollback continues after a failed compensation so that as much as possible is undone. If all the
+// compensations succeed, the checkpoint is cleared so that a resumed execution starts over.
+func (p *Pipeline) Rollback(ctx context.Context) []entities.RollbackAction {
+	checkpoint := p.Checkpoint()
+	actions := make([]entities.RollbackAction, 0)
+	failed := false
+	for index := len(p.steps) - 1; index >= 0; index-- {
+		step := p.steps[index]
+		if !mustCompensate(step, checkpoint) {
+			continue
+		}
+		log.Debug().Str("step", step.Name).Msg("compensating step")
+		action := entities.RollbackAction{Step: step.Name}
+		err := tracing.Trace(ctx, "compensate "+step.Name, step.Compensate)
+		if err != nil {
+			log.Warn().Str("step", step.Name).Str("trace", err.DebugReport()).Msg("cannot compensate step")
+			action.ErrorMsg = err.Error()
+			failed = true
+		}
+		actions = append(actions, action)
+	}
+	if !failed {
+		p.Lock()
+		p.checkpoint = entities.NewStepCheckpoint()
+		p.Unlock()
+	}
+	return actions
+}
+
+// mustCompensate checks if a step has to be undone by a rollback.
+func mustCompensate(step Step, checkpoint *entities.StepCheckpoint) bool {
+	if step.Compensate == nil {
+		return false
+	}
+	return checkpoint.IsCompleted(step.Name) || (step.CompensateFailed && checkpoint.Failed == step.Name)
+}
+
+// SetOutput stores a value produced by a step.
+func (p *Pipeline) SetOutput(key string, value string) {
+	p.Lock()
+	defer p.Unlock()
+	p.checkpoint.Outputs[key] = value
+}
+
+// Output retrieves a value produced by a previous step.
+func (p *Pipeline) Output(key string) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+	value, exists := p.checkpoint.Outputs[key]
+	return value, exists
+}
+
+// Checkpoint returns a copy of the current state of the pipeline.
+func (p *Pipeline) Checkpoint() *entities.StepCheckpoint {
+	p.Lock()
+	defer p.Unlock()
+	return p.checkpoint.Copy()
+}
+
+// Restore sets the state of the pipeline from a previous checkpoint and clears a previous interruption.
+// Checkpoints referencing steps that are not part of the pipeline are rejected.
+func (p *Pipeline) Restore(checkpoint entities.StepCheckpoint) derrors.Error {
+	restored := checkpoint.Copy()
+	for _, completed := range restored.Completed {
+		if !p.hasStep(completed) {
+			return derrors.NewInvalidArgumentError("checkpoint contains an unknown step").WithParams(completed)
+		}
+	}
+	if restored.Outputs == nil {
+		restored.Outputs = make(map[string]string, 0)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.checkpoint = restored
+	p.interrupted = false
+	return nil
+}
+
+// hasStep checks if a step with a given name is part of the pipeline.
+func (p *Pipeline) hasStep(stepName string) bool {
+	for _, step := range p.steps {
+		if step.Name == stepName {
+			return true
+		}
+	}
+	return false
+}
+
+// StepNames returns the names of the steps of the pipeline in execution order.
+func (p *Pipeline) StepNames() []string {
+	result := make([]string, 0, len(p.steps))
+	for _, step := range p.steps {
+		result = append(result, step.Name)
+	}
+	return result
+}
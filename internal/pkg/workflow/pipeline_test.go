@@ -0,0 +1,202 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Pipeline", func() {
+
+	var executed []string
+	var failOn string
+
+	var pipeline *Pipeline
+
+	recordStep := func(name string) Step {
+		return NewStep(name, func(ctx context.Context) derrors.Error {
+			executed = append(executed, name)
+			if name == failOn {
+				return derrors.NewInternalError("step failed")
+			}
+			pipeline.SetOutput(name, "output of "+name)
+			return nil
+		})
+	}
+
+	ginkgo.BeforeEach(func() {
+		executed = make([]string, 0)
+		failOn = ""
+		pipeline = NewPipeline(recordStep("first"), recordStep("second"), recordStep("third"))
+	})
+
+	ginkgo.It("should execute the steps in order", func() {
+		started := make([]string, 0)
+		completed := make([]string, 0)
+		pipeline.OnStepStarted(func(stepName string) {
+			started = append(started, stepName)
+		})
+		pipeline.OnStepCompleted(func(stepName string) {
+			completed = append(completed, stepName)
+		})
+		gomega.Expect(pipeline.Run(context.Background())).To(gomega.BeNil())
+		gomega.Expect(executed).To(gomega.Equal([]string{"first", "second", "third"}))
+		gomega.Expect(started).To(gomega.Equal(executed))
+		gomega.Expect(completed).To(gomega.Equal(executed))
+		gomega.Expect(pipeline.Checkpoint().Failed).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should resume from the failing step", func() {
+		failOn = "second"
+		gomega.Expect(pipeline.Run(context.Background())).ToNot(gomega.BeNil())
+		checkpoint := pipeline.Checkpoint()
+		gomega.Expect(checkpoint.Completed).To(gomega.Equal([]string{"first"}))
+		gomega.Expect(checkpoint.Failed).To(gomega.Equal("second"))
+
+		// Resume on a new pipeline as it happens after a restart.
+		executed = make([]string, 0)
+		failOn = ""
+		pipeline = NewPipeline(recordStep("first"), recordStep("second"), recordStep("third"))
+		gomega.Expect(pipeline.Restore(*checkpoint)).To(gomega.BeNil())
+		output, exists := pipeline.Output("first")
+		gomega.Expect(exists).To(gomega.BeTrue())
+		gomega.Expect(output).To(gomega.Equal("output of first"))
+		gomega.Expect(pipeline.Run(context.Background())).To(gomega.BeNil())
+		gomega.Expect(executed).To(gomega.Equal([]string{"second", "third"}))
+		gomega.Expect(pipeline.Checkpoint().Completed).To(gomega.Equal([]string{"first", "second", "third"}))
+	})
+
+	ginkgo.It("should stop on step boundaries after a cancellation", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		pipeline = NewPipeline(recordStep("first"), NewStep("cancel", func(ctx context.Context) derrors.Error {
+			cancel()
+			return nil
+		}), recordStep("third"))
+		gomega.Expect(pipeline.Run(ctx)).ToNot(gomega.BeNil())
+		gomega.Expect(executed).To(gomega.Equal([]string{"first"}))
+		checkpoint := pipeline.Checkpoint()
+		gomega.Expect(checkpoint.Completed).To(gomega.Equal([]string{"first", "cancel"}))
+		// The step that was not started is not recorded as failed.
+		gomega.Expect(checkpoint.Failed).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should finish the running step when interrupted", func() {
+		var stepCtx context.Context
+		pipeline = NewPipeline(recordStep("first"), NewStep("interrupt", func(ctx context.Context) derrors.Error {
+			pipeline.Interrupt()
+			stepCtx = ctx
+			return nil
+		}), recordStep("third"))
+		err := pipeline.Run(context.Background())
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.Unavailable))
+		gomega.Expect(stepCtx.Err()).To(gomega.BeNil())
+		gomega.Expect(executed).To(gomega.Equal([]string{"first"}))
+		checkpoint := pipeline.Checkpoint()
+		gomega.Expect(checkpoint.Completed).To(gomega.Equal([]string{"first", "interrupt"}))
+		gomega.Expect(checkpoint.Failed).To(gomega.BeEmpty())
+
+		gomega.Expect(pipeline.Restore(*checkpoint)).To(gomega.Succeed())
+		gomega.Expect(pipeline.Run(context.Background())).To(gomega.Succeed())
+		gomega.Expect(executed).To(gomega.Equal([]string{"first", "third"}))
+	})
+
+	ginkgo.It("should undo the executed steps in reverse order", func() {
+		compensated := make([]string, 0)
+		compensableStep := func(name string) Step {
+			step := recordStep(name)
+			step.Compensate = func(ctx context.Context) derrors.Error {
+				compensated = append(compensated, name)
+				if name == "first" {
+					return derrors.NewInternalError("cannot undo step")
+				}
+				return nil
+			}
+			return step
+		}
+		failOn = "fourth"
+		pipeline = NewPipeline(compensableStep("first"), recordStep("second"), compensableStep("third"), compensableStep("fourth"))
+		gomega.Expect(pipeline.Run(context.Background())).ToNot(gomega.BeNil())
+		actions := pipeline.Rollback(context.Background())
+		gomega.Expect(compensated).To(gomega.Equal([]string{"third", "first"}))
+		gomega.Expect(len(actions)).To(gomega.Equal(2))
+		gomega.Expect(actions[0]).To(gomega.Equal(entities.RollbackAction{Step: "third"}))
+		gomega.Expect(actions[1].Step).To(gomega.Equal("first"))
+		gomega.Expect(actions[1].ErrorMsg).ToNot(gomega.BeEmpty())
+		// The checkpoint is kept as the rollback did not complete.
+		gomega.Expect(pipeline.Checkpoint().Failed).To(gomega.Equal("fourth"))
+	})
+
+	ginkgo.It("should not undo the step that failed", func() {
+		compensated := false
+		failOn = "create-cluster"
+		pipeline = NewPipeline(NewCompensableStep("create-cluster", recordStep("create-cluster").Run, func(ctx context.Context) derrors.Error {
+			compensated = true
+			return nil
+		}))
+		gomega.Expect(pipeline.Run(context.Background())).ToNot(gomega.BeNil())
+		gomega.Expect(pipeline.Rollback(context.Background())).To(gomega.BeEmpty())
+		gomega.Expect(compensated).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should not undo the steps that were not started", func() {
+		compensated := false
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		pipeline = NewPipeline(NewCompensableStep("create-cluster", recordStep("create-cluster").Run, func(ctx context.Context) derrors.Error {
+			compensated = true
+			return nil
+		}))
+		gomega.Expect(pipeline.Run(ctx)).ToNot(gomega.BeNil())
+		gomega.Expect(executed).To(gomega.BeEmpty())
+		gomega.Expect(pipeline.Rollback(context.Background())).To(gomega.BeEmpty())
+		gomega.Expect(compensated).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should undo the failed steps that leave partial resources", func() {
+		failOn = "join-workers"
+		pipeline = NewPipeline(NewPartialCompensableStep("join-workers", recordStep("join-workers").Run, func(ctx context.Context) derrors.Error {
+			return nil
+		}))
+		gomega.Expect(pipeline.Run(context.Background())).ToNot(gomega.BeNil())
+		gomega.Expect(pipeline.Rollback(context.Background())).To(gomega.Equal([]entities.RollbackAction{{Step: "join-workers"}}))
+	})
+
+	ginkgo.It("should clear the checkpoint after a complete rollback", func() {
+		failOn = "second"
+		pipeline = NewPipeline(NewCompensableStep("first", recordStep("first").Run, func(ctx context.Context) derrors.Error {
+			return nil
+		}), recordStep("second"))
+		gomega.Expect(pipeline.Run(context.Background())).ToNot(gomega.BeNil())
+		actions := pipeline.Rollback(context.Background())
+		gomega.Expect(actions).To(gomega.Equal([]entities.RollbackAction{{Step: "first"}}))
+		checkpoint := pipeline.Checkpoint()
+		gomega.Expect(checkpoint.Completed).To(gomega.BeEmpty())
+		gomega.Expect(checkpoint.Failed).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should reject checkpoints with unknown steps", func() {
+		checkpoint := entities.NewStepCheckpoint()
+		checkpoint.Completed = append(checkpoint.Completed, "unknown")
+		gomega.Expect(pipeline.Restore(*checkpoint)).ToNot(gomega.BeNil())
+	})
+})
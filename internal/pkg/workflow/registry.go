@@ -0,0 +1,292 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultOperationTTL with the default time finished operations are kept in the registry.
+const DefaultOperationTTL = 24 * time.Hour
+
+// DefaultRegistryGCInterval with the default period to remove the expired operations from the registry.
+const DefaultRegistryGCInterval = 5 * time.Minute
+
+// registryEntry with an operation and its tracking information.
+type registryEntry struct {
+	operation     entities.InfrastructureOperation
+	operationType entities.OperationType
+	registered    time.Time
+	// finished with the time the operation was first found in a terminal state.
+	finished time.Time
+}
+
+var registryInstance *Registry
+var onceRegistry sync.Once
+
+// Registry contains the operations known by the provisioner regardless of their type. Finished operations are
+// kept for a TTL and then removed.
+type Registry struct {
+	sync.Mutex
+	entries map[string]*registryEntry
+	// TTL with the time finished operations are kept. A value of 0 keeps them until they are removed.
+	TTL time.Duration
+	// stopGC is used to stop the garbage collection loop.
+	stopGC chan struct{}
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[string]*registryEntry, 0),
+		TTL:     DefaultOperationTTL,
+	}
+}
+
+// GetRegistry returns the registry shared by the managers.
+func GetRegistry() *Registry {
+	onceRegistry.Do(func() {
+		registryInstance = NewRegistry()
+	})
+	return registryInstance
+}
+
+// SetTTL sets the time finished operations are kept in the registry.
+func (r *Registry) SetTTL(ttl time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	r.TTL = ttl
+}
+
+// Register adds a new operation to the registry. An AlreadyExists error is returned if the request identifier
+// is being used by another operation.
+func (r *Registry) Register(operation entities.InfrastructureOperation) derrors.Error {
+	r.Lock()
+	defer r.Unlock()
+	if _, exists := r.entries[operation.RequestID()]; exists {
+		return derrors.NewAlreadyExistsError("request is already being processed").WithParams(operation.RequestID())
+	}
+	r.put(operation)
+	return nil
+}
+
+// Put adds an operation to the registry replacing the previous operation with the same request identifier.
+// The registration time of the previous operation is kept.
+func (r *Registry) Put(operation entities.InfrastructureOperation) {
+	r.Lock()
+	defer r.Unlock()
+	r.put(operation)
+}
+
+// put adds or replaces an operation. The caller is expected to hold the lock.
+func (r *Registry) put(operation entities.InfrastructureOperation) {
+	entry := &registryEntry{
+		operation:     operation,
+		operationType: operation.Result().Type,
+		registered:    time.Now(),
+	}
+	if restored, ok := operation.(*RestoredOperation); ok {
+		entry.registered = time.Unix(restored.record.Created, 0)
+		if restored.record.Progress.IsTerminal() {
+			entry.finished = time.Unix(restored.record.Updated, 0)
+		}
+	}
+	if previous, exists := r.entries[operation.RequestID()]; exists {
+		entry.registered = previous.registered
+	}
+	r.entries[operation.RequestID()] = entry
+}
+
+// Exists checks if an operation with a given request identifier is registered.
+func (r *Registry) Exists(requestID string) bool {
+	r.Lock()
+	defer r.Unlock()
+	_, exists := r.entries[requestID]
+	return exists
+}
+
+// Get returns the operation of a given type associated with a request identifier.
+func (r *Registry) Get(requestID string, operationType entities.OperationType) (entities.InfrastructureOperation, bool) {
+	r.Lock()
+	defer r.Unlock()
+	entry, exists := r.entries[requestID]
+	if !exists || entry.operationType != operationType {
+		return nil, false
+	}
+	return entry.operation, true
+}
+
+// Find returns the operation associated with a request identifier regardless of its type.
+func (r *Registry) Find(requestID string) (entities.InfrastructureOperation, bool) {
+	r.Lock()
+	defer r.Unlock()
+	entry, exists := r.entries[requestID]
+	if !exists {
+		return nil, false
+	}
+	return entry.operation, true
+}
+
+// Remove removes an operation from the registry.
+func (r *Registry) Remove(requestID string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.entries, requestID)
+}
+
+// List returns a page of the operations matching a filter ordered by registration time.
+func (r *Registry) List(filter entities.OperationFilter) entities.OperationList {
+	r.Lock()
+	matching := make([]*registryEntry, 0)
+	for _, entry := range r.entries {
+		if r.matches(entry, filter) {
+			matching = append(matching, entry)
+		}
+	}
+	r.Unlock()
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].registered.Equal(matching[j].registered) {
+			return matching[i].operation.RequestID() < matching[j].operation.RequestID()
+		}
+		return matching[i].registered.Before(matching[j].registered)
+	})
+	limit := filter.Limit
+	if limit == 0 {
+		limit = entities.DefaultListLimit
+	}
+	result := entities.OperationList{
+		Operations: make([]entities.OperationSummary, 0),
+		Total:      len(matching),
+	}
+	for index := filter.Offset; index < len(matching) && index < filter.Offset+limit; index++ {
+		result.Operations = append(result.Operations, summaryOf(matching[index]))
+	}
+	if filter.Offset+limit < len(matching) {
+		result.NextOffset = filter.Offset + limit
+	}
+	return result
+}
+
+// matches checks if an entry matches a filter. The caller is expected to hold the lock.
+func (r *Registry) matches(entry *registryEntry, filter entities.OperationFilter) bool {
+	metadata := entry.operation.Metadata()
+	if filter.OrganizationID != "" && metadata.OrganizationID != filter.OrganizationID {
+		return false
+	}
+	if filter.ClusterID != "" && metadata.ClusterID != filter.ClusterID && metadata.ClusterName != filter.ClusterID {
+		return false
+	}
+	if filter.Type != nil && entry.operationType != *filter.Type {
+		return false
+	}
+	if filter.Progress != nil && entry.operation.Progress() != *filter.Progress {
+		return false
+	}
+	if filter.From != 0 && entry.registered.Unix() < filter.From {
+		return false
+	}
+	if filter.To != 0 && entry.registered.Unix() > filter.To {
+		return false
+	}
+	return true
+}
+
+// summaryOf returns the summary of the operation of an entry.
+func summaryOf(entry *registryEntry) entities.OperationSummary {
+	metadata := entry.operation.Metadata()
+	result := entry.operation.Result()
+	return entities.OperationSummary{
+		RequestID:      entry.operation.RequestID(),
+		Type:           entry.operationType,
+		OrganizationID: metadata.OrganizationID,
+		ClusterID:      metadata.ClusterID,
+		ClusterName:    metadata.ClusterName,
+		Progress:       entry.operation.Progress(),
+		Registered:     entry.registered.Unix(),
+		ElapsedTime:    result.ElapsedTime,
+		ErrorMsg:       result.ErrorMsg,
+	}
+}
+
+// Collect removes the operations that finished longer than the TTL ago, including their persisted state.
+// Operations managed by the executor are never removed. It returns the number of removed operations.
+func (r *Registry) Collect(now time.Time, executor *Executor) int {
+	r.Lock()
+	defer r.Unlock()
+	if r.TTL <= 0 {
+		return 0
+	}
+	removed := 0
+	for requestID, entry := range r.entries {
+		if !entry.operation.Progress().IsTerminal() || executor.IsManaged(requestID) {
+			continue
+		}
+		if entry.finished.IsZero() {
+			entry.finished = now
+			continue
+		}
+		if now.Sub(entry.finished) > r.TTL {
+			delete(r.entries, requestID)
+			executor.ForgetOperation(requestID)
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Debug().Int("removed", removed).Int("remaining", len(r.entries)).Msg("expired operations removed")
+	}
+	return removed
+}
+
+// StartGC launches a loop that periodically removes the expired operations.
+func (r *Registry) StartGC(interval time.Duration, executor *Executor) {
+	r.Lock()
+	defer r.Unlock()
+	if interval <= 0 || r.stopGC != nil {
+		return
+	}
+	r.stopGC = make(chan struct{})
+	go r.gcLoop(interval, executor, r.stopGC)
+}
+
+func (r *Registry) gcLoop(interval time.Duration, executor *Executor, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Collect(time.Now(), executor)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops the garbage collection loop.
+func (r *Registry) Close() {
+	r.Lock()
+	defer r.Unlock()
+	if r.stopGC != nil {
+		close(r.stopGC)
+		r.stopGC = nil
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func summaryIDs(list entities.OperationList) []string {
+	result := make([]string, 0, len(list.Operations))
+	for _, operation := range list.Operations {
+		result = append(result, operation.RequestID)
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Operation registry", func() {
+
+	var registry *Registry
+
+	ginkgo.BeforeEach(func() {
+		registry = NewRegistry()
+		for _, operation := range []entities.InfrastructureOperation{
+			NewTestOrganizationOperation("r1", "org1", false),
+			NewTestOrganizationOperation("r2", "org2", false),
+			NewTestClusterOperation("r3", "cluster"),
+		} {
+			gomega.Expect(registry.Register(operation)).To(gomega.Succeed())
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	ginkgo.It("should reject duplicated request identifiers", func() {
+		err := registry.Register(NewTestOperation("r1"))
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.AlreadyExists))
+	})
+
+	ginkgo.It("should return the operations of a given type", func() {
+		_, found := registry.Get("r1", entities.Provision)
+		gomega.Expect(found).To(gomega.BeTrue())
+		_, found = registry.Get("r1", entities.Scale)
+		gomega.Expect(found).To(gomega.BeFalse())
+		gomega.Expect(registry.Exists("r1")).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should filter the operations", func() {
+		list := registry.List(entities.OperationFilter{OrganizationID: "org1"})
+		gomega.Expect(summaryIDs(list)).To(gomega.Equal([]string{"r1"}))
+		list = registry.List(entities.OperationFilter{ClusterID: "cluster"})
+		gomega.Expect(summaryIDs(list)).To(gomega.Equal([]string{"r3"}))
+		progress := entities.Finished
+		list = registry.List(entities.OperationFilter{Progress: &progress})
+		gomega.Expect(list.Total).To(gomega.Equal(0))
+		operationType := entities.Provision
+		list = registry.List(entities.OperationFilter{Type: &operationType})
+		gomega.Expect(list.Total).To(gomega.Equal(3))
+		list = registry.List(entities.OperationFilter{To: time.Now().Add(-time.Hour).Unix()})
+		gomega.Expect(list.Total).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should paginate the operations by registration time", func() {
+		list := registry.List(entities.OperationFilter{Limit: 2})
+		gomega.Expect(summaryIDs(list)).To(gomega.Equal([]string{"r1", "r2"}))
+		gomega.Expect(list.Total).To(gomega.Equal(3))
+		gomega.Expect(list.NextOffset).To(gomega.Equal(2))
+		list = registry.List(entities.OperationFilter{Offset: list.NextOffset, Limit: 2})
+		gomega.Expect(summaryIDs(list)).To(gomega.Equal([]string{"r3"}))
+		gomega.Expect(list.NextOffset).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should remove the finished operations after the TTL", func() {
+		executor := NewExecutor(store.NewMemoryOperationStore())
+		registry.SetTTL(time.Hour)
+		finished, _ := registry.Get("r1", entities.Provision)
+		finished.SetProgress(entities.Finished)
+		now := time.Now()
+		gomega.Expect(registry.Collect(now, executor)).To(gomega.Equal(0))
+		gomega.Expect(registry.Collect(now.Add(30*time.Minute), executor)).To(gomega.Equal(0))
+		gomega.Expect(registry.Collect(now.Add(2*time.Hour), executor)).To(gomega.Equal(1))
+		gomega.Expect(registry.Exists("r1")).To(gomega.BeFalse())
+		gomega.Expect(registry.Exists("r2")).To(gomega.BeTrue())
+	})
+})
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// RestoredOperation represents an operation loaded from the store. Restored operations cannot be executed
+// again, they only expose the last known state of the operation.
+type RestoredOperation struct {
+	record entities.OperationRecord
+}
+
+// NewRestoredOperation creates an operation from its persisted record.
+func NewRestoredOperation(record entities.OperationRecord) *RestoredOperation {
+	return &RestoredOperation{record: record}
+}
+
+// RequestID returns the request identifier associated with this operation
+func (ro *RestoredOperation) RequestID() string {
+	return ro.record.RequestID
+}
+
+// Metadata returns the operation associated metadata
+func (ro *RestoredOperation) Metadata() entities.OperationMetadata {
+	return entities.OperationMetadata{
+		OrganizationID: ro.record.OrganizationID,
+		ClusterID:      ro.record.ClusterID,
+		RequestID:      ro.record.RequestID,
+	}
+}
+
+// Log returns the entries describing the execution of the operation
+func (ro *RestoredOperation) Log() []entities.LogEntry {
+	return ro.record.Log
+}
+
+// Progress returns the operation state
+func (ro *RestoredOperation) Progress() entities.TaskProgress {
+	return ro.record.Progress
+}
+
+// Checkpoint returns the last known state of the steps of the operation, if any.
+func (ro *RestoredOperation) Checkpoint() *entities.StepCheckpoint {
+	return ro.record.Checkpoint
+}
+
+// Execute does not trigger any action as restored operations are only kept for reference.
+func (ro *RestoredOperation) Execute(_ context.Context, callback func(requestID string)) {
+	callback(ro.record.RequestID)
+}
+
+// Cancel is not supported on restored operations.
+func (ro *RestoredOperation) Cancel() derrors.Error {
+	return derrors.NewFailedPreconditionError("restored operations cannot be cancelled").WithParams(ro.record.RequestID)
+}
+
+// SetProgress set a new progress to the operation.
+func (ro *RestoredOperation) SetProgress(progress entities.TaskProgress) {
+	ro.record.Progress = progress
+	ro.record.Result.Progress = progress
+}
+
+// Result returns the last known result of the operation.
+func (ro *RestoredOperation) Result() entities.OperationResult {
+	return ro.record.Result
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"github.com/nalej/provisioner/internal/pkg/entities"
+)
+
+// Priority class of an operation. Operations with a higher priority are executed first.
+type Priority int
+
+const (
+	// ApplicationPriority is assigned to the operations on application clusters.
+	ApplicationPriority Priority = iota
+	// ManagementPriority is assigned to the operations on management clusters.
+	ManagementPriority
+)
+
+// priorities contains the priority classes from the highest to the lowest one.
+var priorities = []Priority{ManagementPriority, ApplicationPriority}
+
+// PriorityOf returns the priority class of an operation.
+func PriorityOf(operation entities.InfrastructureOperation) Priority {
+	if operation.Metadata().IsManagementCluster {
+		return ManagementPriority
+	}
+	return ApplicationPriority
+}
+
+// Scheduler decides the order in which the queued operations are executed.
+type Scheduler interface {
+	// Push adds an operation to the queue.
+	Push(operation entities.InfrastructureOperation)
+	// Next removes and returns the next operation to be executed among the ones accepted by the eligible function.
+	Next(eligible func(operation entities.InfrastructureOperation) bool) (entities.InfrastructureOperation, bool)
+	// Remove removes a queued operation.
+	Remove(requestID string) (entities.InfrastructureOperation, bool)
+	// Position returns the position starting at 1 of a queued operation in the expected execution order, or 0 if
+	// the operation is not queued.
+	Position(requestID string) int
+	// Operations returns the queued operations in the expected execution order.
+	Operations() []entities.InfrastructureOperation
+	// Len returns the number of queued operations.
+	Len() int
+}
+
+// fairQueue contains the operations of a priority class with a queue per organization.
+type fairQueue struct {
+	// organizations in round robin order.
+	organizations []string
+	// queues with the operations of each organization in arrival order.
+	queues map[string][]entities.InfrastructureOperation
+	// next with the index of the organization to be served next.
+	next int
+}
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{
+		organizations: make([]string, 0),
+		queues:        make(map[string][]entities.InfrastructureOperation, 0),
+	}
+}
+
+func (fq *fairQueue) push(operation entities.InfrastructureOperation) {
+	organizationID := operation.Metadata().OrganizationID
+	queue, exists := fq.queues[organizationID]
+	if !exists {
+		fq.organizations = append(fq.organizations, organizationID)
+	}
+	fq.queues[organizationID] = append(queue, operation)
+}
+
+// orderedOrganizations returns the organizations starting with the one to be served next.
+func (fq *fairQueue) orderedOrganizations() []string {
+	result := make([]string, 0, len(fq.organizations))
+	for index := range fq.organizations {
+		result = append(result, fq.organizations[(fq.next+index)%len(fq.organizations)])
+	}
+	return result
+}
+
+// positionOf returns the index of an organization in the round robin.
+func (fq *fairQueue) positionOf(organizationID string) int {
+	for index, organization := range fq.organizations {
+		if organization == organizationID {
+			return index
+		}
+	}
+	return 0
+}
+
+// removeAt removes an operation from the queue of an organization. Organizations without queued operations
+// are removed from the round robin.
+func (fq *fairQueue) removeAt(organizationID string, index int) entities.InfrastructureOperation {
+	queue := fq.queues[organizationID]
+	operation := queue[index]
+	queue = append(queue[:index:index], queue[index+1:]...)
+	if len(queue) > 0 {
+		fq.queues[organizationID] = queue
+		return operation
+	}
+	delete(fq.queues, organizationID)
+	for position, organization := range fq.organizations {
+		if organization == organizationID {
+			fq.organizations = append(fq.organizations[:position], fq.organizations[position+1:]...)
+			if position < fq.next {
+				fq.next--
+			}
+			break
+		}
+	}
+	if len(fq.organizations) == 0 || fq.next >= len(fq.organizations) {
+		fq.next = 0
+	}
+	return operation
+}
+
+// ordered returns the operations in the order they would be served if all of them were eligible.
+func (fq *fairQueue) ordered() []entities.InfrastructureOperation {
+	result := make([]entities.InfrastructureOperation, 0)
+	organizations := fq.orderedOrganizations()
+	for round := 0; ; round++ {
+		added := false
+		for _, organizationID := range organizations {
+			queue := fq.queues[organizationID]
+			if round < len(queue) {
+				result = append(result, queue[round])
+				added = true
+			}
+		}
+		if !added {
+			return result
+		}
+	}
+}
+
+// FairScheduler serves the operations by priority class and, inside each class, in round robin across the
+// organizations so that an organization with many queued operations does not starve the rest.
+type FairScheduler struct {
+	classes map[Priority]*fairQueue
+}
+
+// NewFairScheduler creates an empty scheduler.
+func NewFairScheduler() *FairScheduler {
+	classes := make(map[Priority]*fairQueue, len(priorities))
+	for _, priority := range priorities {
+		classes[priority] = newFairQueue()
+	}
+	return &FairScheduler{classes: classes}
+}
+
+// Push adds an operation to the queue of its organization in its priority class.
+func (fs *FairScheduler) Push(operation entities.InfrastructureOperation) {
+	fs.classes[PriorityOf(operation)].push(operation)
+}
+
+// Next returns the first eligible operation of the highest priority class that has one. Inside a class, the
+// organizations are visited in round robin starting with the one after the last served.
+func (fs *FairScheduler) Next(eligible func(operation entities.InfrastructureOperation) bool) (entities.InfrastructureOperation, bool) {
+	for _, priority := range priorities {
+		class := fs.classes[priority]
+		for _, organizationID := range class.orderedOrganizations() {
+			for index, operation := range class.queues[organizationID] {
+				if !eligible(operation) {
+					continue
+				}
+				position := class.positionOf(organizationID)
+				class.removeAt(organizationID, index)
+				// Serve the following organization on the next call.
+				if _, stillQueued := class.queues[organizationID]; stillQueued {
+					class.next = (position + 1) % len(class.organizations)
+				} else if len(class.organizations) > 0 {
+					class.next = position % len(class.organizations)
+				}
+				return operation, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Remove removes a queued operation.
+func (fs *FairScheduler) Remove(requestID string) (entities.InfrastructureOperation, bool) {
+	for _, priority := range priorities {
+		class := fs.classes[priority]
+		for organizationID, queue := range class.queues {
+			for index, operation := range queue {
+				if operation.RequestID() == requestID {
+					return class.removeAt(organizationID, index), true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// Position returns the position starting at 1 of a queued operation in the expected execution order.
+func (fs *FairScheduler) Position(requestID string) int {
+	for index, operation := range fs.Operations() {
+		if operation.RequestID() == requestID {
+			return index + 1
+		}
+	}
+	return 0
+}
+
+// Operations returns the queued operations in the expected execution order.
+func (fs *FairScheduler) Operations() []entities.InfrastructureOperation {
+	result := make([]entities.InfrastructureOperation, 0)
+	for _, priority := range priorities {
+		result = append(result, fs.classes[priority].ordered()...)
+	}
+	return result
+}
+
+// Len returns the number of queued operations.
+func (fs *FairScheduler) Len() int {
+	result := 0
+	for _, class := range fs.classes {
+		for _, queue := range class.queues {
+			result += len(queue)
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func anyOperation(_ entities.InfrastructureOperation) bool {
+	return true
+}
+
+func requestIDs(operations []entities.InfrastructureOperation) []string {
+	result := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		result = append(result, operation.RequestID())
+	}
+	return result
+}
+
+func drain(scheduler Scheduler) []string {
+	result := make([]string, 0)
+	for {
+		operation, found := scheduler.Next(anyOperation)
+		if !found {
+			return result
+		}
+		result = append(result, operation.RequestID())
+	}
+}
+
+var _ = ginkgo.Describe("Fair scheduler", func() {
+
+	var scheduler *FairScheduler
+
+	ginkgo.BeforeEach(func() {
+		scheduler = NewFairScheduler()
+	})
+
+	ginkgo.It("should serve the organizations in round robin", func() {
+		for _, requestID := range []string{"a1", "a2", "a3"} {
+			scheduler.Push(NewTestOrganizationOperation(requestID, "a", false))
+		}
+		scheduler.Push(NewTestOrganizationOperation("b1", "b", false))
+		scheduler.Push(NewTestOrganizationOperation("c1", "c", false))
+		scheduler.Push(NewTestOrganizationOperation("b2", "b", false))
+		expected := []string{"a1", "b1", "c1", "a2", "b2", "a3"}
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(6))
+		gomega.Expect(requestIDs(scheduler.Operations())).To(gomega.Equal(expected))
+		gomega.Expect(drain(scheduler)).To(gomega.Equal(expected))
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should serve management operations first", func() {
+		scheduler.Push(NewTestOrganizationOperation("a1", "a", false))
+		scheduler.Push(NewTestOrganizationOperation("a2", "a", false))
+		scheduler.Push(NewTestOrganizationOperation("m1", "m", true))
+		gomega.Expect(scheduler.Position("m1")).To(gomega.Equal(1))
+		gomega.Expect(scheduler.Position("a2")).To(gomega.Equal(3))
+		gomega.Expect(drain(scheduler)).To(gomega.Equal([]string{"m1", "a1", "a2"}))
+	})
+
+	ginkgo.It("should skip the operations that are not eligible", func() {
+		scheduler.Push(NewTestOrganizationOperation("a1", "a", false))
+		scheduler.Push(NewTestOrganizationOperation("b1", "b", false))
+		operation, found := scheduler.Next(func(operation entities.InfrastructureOperation) bool {
+			return operation.Metadata().OrganizationID != "a"
+		})
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(operation.RequestID()).To(gomega.Equal("b1"))
+		_, found = scheduler.Next(func(operation entities.InfrastructureOperation) bool {
+			return false
+		})
+		gomega.Expect(found).To(gomega.BeFalse())
+		gomega.Expect(scheduler.Position("a1")).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should remove queued operations", func() {
+		scheduler.Push(NewTestOrganizationOperation("a1", "a", false))
+		scheduler.Push(NewTestOrganizationOperation("b1", "b", false))
+		scheduler.Push(NewTestOrganizationOperation("a2", "a", false))
+		_, removed := scheduler.Remove("b1")
+		gomega.Expect(removed).To(gomega.BeTrue())
+		_, removed = scheduler.Remove("b1")
+		gomega.Expect(removed).To(gomega.BeFalse())
+		gomega.Expect(scheduler.Position("b1")).To(gomega.Equal(0))
+		gomega.Expect(drain(scheduler)).To(gomega.Equal([]string{"a1", "a2"}))
+	})
+})
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/store"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanNamed returns the first recorded span with a given name.
+func spanNamed(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for index := range spans {
+		if spans[index].Name == name {
+			return &spans[index]
+		}
+	}
+	return nil
+}
+
+var _ = ginkgo.Describe("Tracing", func() {
+
+	var exporter *tracetest.InMemoryExporter
+
+	ginkgo.BeforeEach(func() {
+		exporter = tracing.UseInMemoryExporter()
+	})
+
+	ginkgo.It("should trace the operations as part of the request that scheduled them", func() {
+		executor := NewExecutor(store.NewMemoryOperationStore())
+		ctx, request := tracing.StartSpan(context.Background(), "request")
+		test := NewTestOperation(uuid.NewV4().String())
+		gomega.Expect(executor.ScheduleOperationContext(ctx, test)).To(gomega.Succeed())
+		request.End()
+		gomega.Eventually(func() bool {
+			return executor.IsManaged(test.RequestID())
+		}, 5*time.Second).Should(gomega.BeFalse())
+
+		spans := exporter.GetSpans()
+		queued := spanNamed(spans, "workflow.Executor.Queue")
+		execute := spanNamed(spans, "workflow.Executor.Execute")
+		gomega.Expect(queued).ShouldNot(gomega.BeNil())
+		gomega.Expect(execute).ShouldNot(gomega.BeNil())
+		gomega.Expect(queued.Parent.SpanID()).Should(gomega.Equal(request.SpanContext().SpanID()))
+		gomega.Expect(execute.Parent.SpanID()).Should(gomega.Equal(request.SpanContext().SpanID()))
+		gomega.Expect(execute.Attributes).Should(gomega.ContainElement(tracing.RequestIDKey.String(test.RequestID())))
+		gomega.Expect(execute.Attributes).Should(gomega.ContainElement(
+			tracing.ProgressKey.String(entities.TaskProgressToString[entities.Finished])))
+	})
+
+	ginkgo.It("should trace the pipeline steps", func() {
+		pipeline := NewPipeline(
+			NewStep("first", func(ctx context.Context) derrors.Error {
+				return nil
+			}),
+			NewStep("second", func(ctx context.Context) derrors.Error {
+				return derrors.NewInternalError("step failed")
+			}))
+		ctx, operation := tracing.StartSpan(context.Background(), "operation")
+		gomega.Expect(pipeline.Run(ctx)).ToNot(gomega.Succeed())
+		operation.End()
+
+		spans := exporter.GetSpans()
+		first := spanNamed(spans, "step first")
+		second := spanNamed(spans, "step second")
+		gomega.Expect(first).ShouldNot(gomega.BeNil())
+		gomega.Expect(second).ShouldNot(gomega.BeNil())
+		gomega.Expect(first.Parent.SpanID()).Should(gomega.Equal(operation.SpanContext().SpanID()))
+		gomega.Expect(first.Status.Code).ShouldNot(gomega.Equal(codes.Error))
+		gomega.Expect(second.Status.Code).Should(gomega.Equal(codes.Error))
+	})
+
+})
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/provisioner/internal/pkg/entities"
+	"github.com/nalej/provisioner/internal/pkg/tracing"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultProvisionDeadline with the default maximum duration of a provisioning operation.
+const DefaultProvisionDeadline = time.Hour
+
+// DefaultScaleDeadline with the default maximum duration of a scaling operation.
+const DefaultScaleDeadline = 45 * time.Minute
+
+// DefaultDecommissionDeadline with the default maximum duration of a decommission operation.
+const DefaultDecommissionDeadline = 45 * time.Minute
+
+// DefaultManagementDeadline with the default maximum duration of a management operation.
+const DefaultManagementDeadline = 10 * time.Minute
+
+// DefaultStalledOperationTimeout with the default maximum time an operation may run without adding entries to
+// its log. It must be longer than the longest wait of an operation step, the creation of a cluster.
+const DefaultStalledOperationTimeout = 40 * time.Minute
+
+// DefaultWatchdogInterval with the default period to check the operations being executed.
+const DefaultWatchdogInterval = 30 * time.Second
+
+// execution with the state of an operation being executed that is tracked by the watchdog.
+type execution struct {
+	// id identifying the execution, so that the callback of an expired execution is not mistaken for the one of
+	// a later execution of the same operation.
+	id int64
+	// operation being executed.
+	operation entities.InfrastructureOperation
+	// cancel function of the execution context.
+	cancel context.CancelFunc
+	// span tracing the execution.
+	span trace.Span
+	// started with the time the execution started.
+	started time.Time
+	// deadline with the maximum duration of the execution, or 0 if it is not limited.
+	deadline time.Duration
+	// logEntries with the number of log entries found on the last check.
+	logEntries int
+	// lastActivity with the time a new log entry was last found.
+	lastActivity time.Time
+}
+
+// SetDeadlines sets the maximum duration of each type of operation and the maximum time an operation may run
+// without adding entries to its log. A value of 0 disables the corresponding check. The deadlines apply to
+// the operations started afterwards.
+func (e *Executor) SetDeadlines(deadlines map[entities.OperationType]time.Duration, stalledTimeout time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+	e.Deadlines = deadlines
+	e.StalledTimeout = stalledTimeout
+}
+
+// StartWatchdog launches a loop that periodically stops the operations that exceeded their deadline or stopped
+// making progress so that their slots are released.
+func (e *Executor) StartWatchdog(interval time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+	if interval <= 0 || e.stopWatchdog != nil {
+		return
+	}
+	e.stopWatchdog = make(chan struct{})
+	go e.watchdogLoop(interval, e.stopWatchdog)
+}
+
+// startExecution derives the execution context of an operation applying the deadline of its type, and starts
+// tracking it. The execution is traced as part of the span of the request that scheduled the operation. It
+// returns the context and the identifier of the execution. The caller is expected to hold the lock.
+func (e *Executor) startExecution(operation entities.InfrastructureOperation) (context.Context, int64) {
+	parent := context.Background()
+	if queued, exists := e.queued[operation.RequestID()]; exists {
+		queued.span.End()
+		parent = queued.ctx
+		delete(e.queued, operation.RequestID())
+	}
+	parent, span := tracing.StartSpan(parent, "workflow.Executor.Execute", tracing.OperationAttributes(operation)...)
+	deadline := e.Deadlines[operation.Result().Type]
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline > 0 {
+		ctx, cancel = context.WithTimeout(parent, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	now := time.Now()
+	e.nextExecution++
+	e.executions[operation.RequestID()] = &execution{
+		id:           e.nextExecution,
+		operation:    operation,
+		cancel:       cancel,
+		span:         span,
+		started:      now,
+		deadline:     deadline,
+		logEntries:   len(operation.Log()),
+		lastActivity: now,
+	}
+	return ctx, e.nextExecution
+}
+
+func (e *Executor) watchdogLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Lock()
+			e.expireOperations(time.Now())
+			e.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// expireOperations stops the operations that exceeded their deadline or did not add entries to their log for
+// longer than the stalled timeout. Their slots are released without waiting for the operations to finish, as
+// they may be blocked on calls that ignore the cancellation. The locks of their clusters are kept until they
+// actually return, so that they cannot be resumed or followed by other operations on the same cluster while they
+// are still running. The caller is expected to hold the lock.
+func (e *Executor) expireOperations(now time.Time) {
+	released := false
+	for requestID, operation := range e.OnExecution {
+		execution, tracked := e.executions[requestID]
+		if !tracked {
+			continue
+		}
+		entries := len(operation.Log())
+		if entries != execution.logEntries {
+			execution.logEntries = entries
+			execution.lastActivity = now
+		}
+		var reason derrors.Error
+		if execution.deadline > 0 && now.Sub(execution.started) > execution.deadline {
+			reason = derrors.NewDeadlineExceededError("operation exceeded its deadline").WithParams(execution.deadline.String())
+		} else if e.StalledTimeout > 0 && now.Sub(execution.lastActivity) > e.StalledTimeout {
+			reason = derrors.NewDeadlineExceededError("operation stopped making progress").WithParams(e.StalledTimeout.String())
+		}
+		if reason == nil {
+			continue
+		}
+		log.Warn().Str("requestID", requestID).Str("reason", reason.Error()).Msg("expiring operation")
+		e.expire(operation, reason)
+		released = true
+	}
+	if released {
+		e.startEligible()
+	}
+}
+
+// expire stops an operation marking it as failed and releases its slot. The operation remains managed and keeps
+// the lock of its cluster until the callback of the expired execution is received. The caller is expected to
+// hold the lock.
+func (e *Executor) expire(operation entities.InfrastructureOperation, reason derrors.Error) {
+	if expirable, ok := operation.(entities.ExpirableOperation); ok {
+		expirable.Expire(reason)
+	} else {
+		err := operation.Cancel()
+		if err != nil {
+			log.Warn().Str("requestID", operation.RequestID()).Str("err", err.Error()).Msg("cannot cancel expired operation")
+		}
+	}
+	if operation.Progress() != entities.Error {
+		operation.SetProgress(entities.Error)
+	}
+	if execution, exists := e.executions[operation.RequestID()]; exists {
+		e.expired[execution.id] = execution
+	}
+	e.releaseSlot(operation)
+}